@@ -39,30 +39,43 @@ func main() {
 		zap.Int("port", cfg.Server.Port),
 	)
 
-	// Initialize DAOs (Data Access Objects)
-	logger.Info("Initializing data access objects...")
-	
-	jaegerDAO := dao.NewJaegerDAO(cfg.Jaeger.URL, logger)
-	promDAO := dao.NewPrometheusDAO(cfg.Prometheus.URL, logger)
-	esDAO := dao.NewElasticsearchDAO(cfg.Elasticsearch.URL, logger)
+	// Initialize the stores the API reads from
+	logger.Info("Initializing data access objects...",
+		zap.String("traces", cfg.Storage.Traces),
+		zap.String("metrics", cfg.Storage.Metrics),
+		zap.String("logs", cfg.Storage.Logs),
+	)
+
+	traceReader, err := dao.NewTraceReader(cfg, logger)
+	if err != nil {
+		logger.Fatal("Failed to create trace store", zap.Error(err))
+	}
+	metricReader, err := dao.NewMetricReader(cfg, logger)
+	if err != nil {
+		logger.Fatal("Failed to create metric store", zap.Error(err))
+	}
+	logReader, err := dao.NewLogReader(cfg, logger)
+	if err != nil {
+		logger.Fatal("Failed to create log store", zap.Error(err))
+	}
 
 	// Test connections
-	if err := jaegerDAO.Ping(context.Background()); err != nil {
-		logger.Warn("Failed to connect to Jaeger", zap.Error(err))
+	if err := traceReader.Ping(context.Background()); err != nil {
+		logger.Warn("Failed to connect to trace store", zap.Error(err))
 	} else {
-		logger.Info("Connected to Jaeger successfully")
+		logger.Info("Connected to trace store successfully")
 	}
 
-	if err := promDAO.Ping(context.Background()); err != nil {
-		logger.Warn("Failed to connect to Prometheus", zap.Error(err))
+	if err := metricReader.Ping(context.Background()); err != nil {
+		logger.Warn("Failed to connect to metric store", zap.Error(err))
 	} else {
-		logger.Info("Connected to Prometheus successfully")
+		logger.Info("Connected to metric store successfully")
 	}
 
-	if err := esDAO.Ping(context.Background()); err != nil {
-		logger.Warn("Failed to connect to Elasticsearch", zap.Error(err))
+	if err := logReader.Ping(context.Background()); err != nil {
+		logger.Warn("Failed to connect to log store", zap.Error(err))
 	} else {
-		logger.Info("Connected to Elasticsearch successfully")
+		logger.Info("Connected to log store successfully")
 	}
 
 	// Set Gin mode
@@ -72,7 +85,7 @@ func main() {
 
 	// Initialize API router
 	logger.Info("Initializing API router...")
-	router := api.NewRouter(cfg, jaegerDAO, promDAO, esDAO, logger)
+	router := api.NewRouter(cfg, traceReader, metricReader, logReader, logger)
 
 	// Create HTTP server
 	srv := &http.Server{
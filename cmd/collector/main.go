@@ -2,135 +2,146 @@ package main
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"net"
+	"net/http"
 	"os"
 	"os/signal"
-	"sync"
 	"syscall"
 	"time"
 
-	"github.com/gaurav/otel-observability/internal/config"
-	"github.com/gaurav/otel-observability/internal/logging"
-	"github.com/gaurav/otel-observability/pkg/models"
+	"github.com/gaurav/watchingcat/internal/collector/components"
+	"github.com/gaurav/watchingcat/internal/collector/exporters"
+	"github.com/gaurav/watchingcat/internal/collector/pipeline"
+	"github.com/gaurav/watchingcat/internal/collector/processors"
+	"github.com/gaurav/watchingcat/internal/collector/zpages"
+	"github.com/gaurav/watchingcat/internal/config"
+	"github.com/gaurav/watchingcat/internal/logging"
 	"go.uber.org/zap"
-	"google.golang.org/grpc"
 )
 
+// configPath is the collector's config file, watched for changes
+const configPath = "configs/config.yaml"
+
 // Collector receives and processes telemetry data
 type Collector struct {
-	config   *config.Config
-	logger   *logging.Logger
-	server   *grpc.Server
-	
-	// Storage
-	spans      []models.Span
-	logs       []models.LogRecord
-	metrics    []models.Metric
-	exceptions []models.ExceptionRecord
-	mu         sync.RWMutex
+	config  *config.Config
+	logger  *logging.Logger
+	service *pipeline.Service
+	admin   *http.Server
+	cancel  context.CancelFunc
 }
 
-// NewCollector creates a new telemetry collector
-func NewCollector(cfg *config.Config, logger *logging.Logger) *Collector {
-	return &Collector{
-		config:     cfg,
-		logger:     logger,
-		spans:      make([]models.Span, 0),
-		logs:       make([]models.LogRecord, 0),
-		metrics:    make([]models.Metric, 0),
-		exceptions: make([]models.ExceptionRecord, 0),
+// NewCollector creates a new telemetry collector, building the pipelines
+// declared under collector.pipelines
+func NewCollector(cfg *config.Config, logger *logging.Logger) (*Collector, error) {
+	service, err := pipeline.New(cfg, components.Registry(), logger.Logger)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, p := range service.Pipelines() {
+		pcfg := p.Config()
+		logger.Info("Pipeline configured",
+			zap.String("pipeline", p.Name()),
+			zap.Strings("receivers", pcfg.Receivers),
+			zap.Strings("processors", pcfg.Processors),
+			zap.Strings("exporters", pcfg.Exporters),
+		)
 	}
+
+	return &Collector{
+		config:  cfg,
+		logger:  logger,
+		service: service,
+	}, nil
 }
 
 // Start starts the collector service
 func (c *Collector) Start(ctx context.Context) error {
-	// Start gRPC server
-	listener, err := net.Listen("tcp", c.config.Collector.GRPC.Endpoint)
-	if err != nil {
-		return fmt.Errorf("failed to listen: %w", err)
+	ctx, c.cancel = context.WithCancel(ctx)
+
+	if err := c.startAdmin(); err != nil {
+		return err
 	}
 
-	c.server = grpc.NewServer()
-	
-	// Note: In a real implementation, you would register OTLP service handlers here
-	// For this skeleton, we're showing the structure
-	
-	c.logger.Info("Collector gRPC server starting",
-		zap.String("endpoint", c.config.Collector.GRPC.Endpoint),
-	)
+	if err := c.service.Start(ctx); err != nil {
+		return err
+	}
 
-	// Start background processors
 	go c.processIncomingData(ctx)
-	go c.exportData(ctx)
 	go c.printStats(ctx)
 
-	// Start server
-	go func() {
-		if err := c.server.Serve(listener); err != nil {
-			c.logger.Error("gRPC server error", zap.Error(err))
-		}
-	}()
-
 	return nil
 }
 
-// Stop stops the collector service
+// Stop stops the collector service. Receivers are shut down first, then
+// whatever is still buffered is exported synchronously.
 func (c *Collector) Stop() {
-	if c.server != nil {
-		c.logger.Info("Stopping collector server...")
-		c.server.GracefulStop()
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	c.logger.Info("Stopping collector pipelines...")
+	c.service.Shutdown(ctx)
+
+	if c.admin != nil {
+		if err := c.admin.Shutdown(ctx); err != nil {
+			c.logger.Warn("Admin server shutdown error", zap.Error(err))
+		}
 	}
-}
 
-// ReceiveSpan receives a trace span
-func (c *Collector) ReceiveSpan(span models.Span) {
-	c.mu.Lock()
-	defer c.mu.Unlock()
-	c.spans = append(c.spans, span)
-	
-	c.logger.Debug("Span received",
-		zap.String("trace_id", span.TraceID),
-		zap.String("span_id", span.SpanID),
-		zap.String("name", span.Name),
-	)
+	if c.cancel != nil {
+		c.cancel()
+	}
 }
 
-// ReceiveLog receives a log record
-func (c *Collector) ReceiveLog(log models.LogRecord) {
-	c.mu.Lock()
-	defer c.mu.Unlock()
-	c.logs = append(c.logs, log)
-	
-	c.logger.Debug("Log received",
-		zap.String("severity", log.Severity),
-		zap.String("message", log.Message),
-	)
-}
+// Reload re-reads the config file and applies it to the running pipelines.
+// An invalid config is logged and the running one kept.
+func (c *Collector) Reload() {
+	c.logger.Info("Reloading configuration", zap.String("path", configPath))
 
-// ReceiveMetric receives a metric
-func (c *Collector) ReceiveMetric(metric models.Metric) {
-	c.mu.Lock()
-	defer c.mu.Unlock()
-	c.metrics = append(c.metrics, metric)
-	
-	c.logger.Debug("Metric received",
-		zap.String("name", metric.Name),
-		zap.Float64("value", metric.Value),
-	)
+	cfg, err := config.Load(configPath)
+	if err != nil {
+		c.logger.Error("Config reload rejected", zap.Error(err))
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	if err := c.service.Reload(ctx, cfg); err != nil {
+		c.logger.Error("Config reload failed", zap.Error(err))
+		return
+	}
+	c.config = cfg
 }
 
-// ReceiveException receives an exception record
-func (c *Collector) ReceiveException(exception models.ExceptionRecord) {
-	c.mu.Lock()
-	defer c.mu.Unlock()
-	c.exceptions = append(c.exceptions, exception)
-	
-	c.logger.Debug("Exception received",
-		zap.String("id", exception.ID),
-		zap.String("type", exception.Type),
-		zap.String("message", exception.Message),
+// startAdmin serves the collector's own metrics, debug pages and health
+// checks on collector.telemetry.endpoint, if set
+func (c *Collector) startAdmin() error {
+	endpoint := c.config.Collector.Telemetry.Endpoint
+	if endpoint == "" {
+		return nil
+	}
+
+	listener, err := net.Listen("tcp", endpoint)
+	if err != nil {
+		return fmt.Errorf("failed to listen on telemetry endpoint: %w", err)
+	}
+
+	c.admin = &http.Server{Handler: zpages.NewHandler(c.service, c.logger.Logger)}
+
+	c.logger.Info("Admin server listening",
+		zap.String("endpoint", endpoint),
 	)
+
+	go func() {
+		if err := c.admin.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			c.logger.Error("Admin server error", zap.Error(err))
+		}
+	}()
+	return nil
 }
 
 // processIncomingData processes incoming telemetry data
@@ -143,134 +154,146 @@ func (c *Collector) processIncomingData(ctx context.Context) {
 		case <-ctx.Done():
 			return
 		case <-ticker.C:
-			c.mu.RLock()
-			spanCount := len(c.spans)
-			logCount := len(c.logs)
-			metricCount := len(c.metrics)
-			exceptionCount := len(c.exceptions)
-			c.mu.RUnlock()
-
-			if spanCount > 0 || logCount > 0 || metricCount > 0 || exceptionCount > 0 {
-				c.logger.Debug("Processing telemetry data",
-					zap.Int("spans", spanCount),
-					zap.Int("logs", logCount),
-					zap.Int("metrics", metricCount),
-					zap.Int("exceptions", exceptionCount),
-				)
+			for receiver, stats := range c.service.BufferStats() {
+				spanCount := stats.Spans.Buffered
+				logCount := stats.Logs.Buffered
+				metricCount := stats.Metrics.Buffered
+				exceptionCount := stats.Exceptions.Buffered
+
+				if spanCount > 0 || logCount > 0 || metricCount > 0 || exceptionCount > 0 {
+					c.logger.Debug("Processing telemetry data",
+						zap.String("receiver", receiver),
+						zap.Int("spans", spanCount),
+						zap.Int("logs", logCount),
+						zap.Int("metrics", metricCount),
+						zap.Int("exceptions", exceptionCount),
+					)
+				}
 			}
 
-			// In a real implementation, here you would:
-			// 1. Process and transform data
-			// 2. Apply sampling/filtering rules
-			// 3. Enrich with additional context
-			// 4. Detect anomalies
+			// Transforms and sampling run in the pipelines on flush.
+			// In a real implementation, here you would also:
+			// 1. Enrich with additional context
+			// 2. Detect anomalies
 		}
 	}
 }
 
-// exportData exports telemetry data to configured backends
-func (c *Collector) exportData(ctx context.Context) {
-	ticker := time.NewTicker(10 * time.Second)
+// printStats prints periodic statistics
+func (c *Collector) printStats(ctx context.Context) {
+	ticker := time.NewTicker(30 * time.Second)
 	defer ticker.Stop()
 
+	startTime := time.Now()
+
 	for {
 		select {
 		case <-ctx.Done():
 			return
 		case <-ticker.C:
-			c.mu.Lock()
-			batch := models.TelemetryBatch{
-				Spans:      c.spans,
-				Logs:       c.logs,
-				Metrics:    c.metrics,
-				Exceptions: c.exceptions,
+			uptime := time.Since(startTime)
+
+			for receiver, stats := range c.service.BufferStats() {
+				c.logger.Info("Collector statistics",
+					zap.String("receiver", receiver),
+					zap.Duration("uptime", uptime),
+					zap.Int("spans_buffered", stats.Spans.Buffered),
+					zap.Int("logs_buffered", stats.Logs.Buffered),
+					zap.Int("metrics_buffered", stats.Metrics.Buffered),
+					zap.Int("exceptions_buffered", stats.Exceptions.Buffered),
+					zap.Uint64("spans_dropped", stats.Spans.Dropped),
+					zap.Uint64("logs_dropped", stats.Logs.Dropped),
+					zap.Uint64("metrics_dropped", stats.Metrics.Dropped),
+					zap.Uint64("exceptions_dropped", stats.Exceptions.Dropped),
+					zap.Uint64("spans_refused", stats.Spans.Refused),
+					zap.Uint64("logs_refused", stats.Logs.Refused),
+					zap.Uint64("metrics_refused", stats.Metrics.Refused),
+					zap.Uint64("exceptions_refused", stats.Exceptions.Refused),
+				)
+			}
+
+			for _, p := range c.service.Pipelines() {
+				for i, proc := range p.Processors() {
+					c.logProcessorStats(p.Name(), p.Config().Processors[i], proc)
+				}
 			}
-			
-			// Clear after copying
-			c.spans = make([]models.Span, 0)
-			c.logs = make([]models.LogRecord, 0)
-			c.metrics = make([]models.Metric, 0)
-			c.exceptions = make([]models.ExceptionRecord, 0)
-			c.mu.Unlock()
-
-			if len(batch.Spans) > 0 || len(batch.Logs) > 0 || 
-			   len(batch.Metrics) > 0 || len(batch.Exceptions) > 0 {
-				c.exportBatch(batch)
+
+			for id, exporter := range c.service.Exporters() {
+				c.logExporterStats(id, exporter)
 			}
 		}
 	}
 }
 
-// exportBatch exports a batch of telemetry data
-func (c *Collector) exportBatch(batch models.TelemetryBatch) {
-	// Export to Jaeger (if enabled)
-	if cfg, ok := c.config.Collector.Exporters["jaeger"]; ok && cfg.Enabled {
-		c.logger.Debug("Exporting to Jaeger",
-			zap.Int("spans", len(batch.Spans)),
-		)
-		// In real implementation: send to Jaeger
+// logProcessorStats logs the statistics of processors that keep them
+func (c *Collector) logProcessorStats(pipelineName, id string, proc processors.Processor) {
+	component := []zap.Field{zap.String("pipeline", pipelineName), zap.String("processor", id)}
+
+	switch p := proc.(type) {
+	case *processors.TailSampler:
+		stats := p.Stats()
+		c.logger.Info("Tail sampling statistics", append(component,
+			zap.Uint64("traces_sampled", stats.TracesSampled),
+			zap.Uint64("traces_dropped", stats.TracesDropped),
+			zap.Int("traces_pending", stats.TracesPending),
+		)...)
+
+	case *processors.ExceptionExtractor:
+		c.logger.Info("Exception extraction statistics", append(component,
+			zap.Uint64("exceptions_extracted", p.Extracted()),
+		)...)
+
+	case *processors.Filter:
+		stats := p.Stats()
+		c.logger.Info("Filter statistics", append(component,
+			zap.Uint64("spans_dropped", stats.Spans),
+			zap.Uint64("logs_dropped", stats.Logs),
+			zap.Uint64("metrics_dropped", stats.Metrics),
+			zap.Uint64("exceptions_dropped", stats.Exceptions),
+		)...)
+
+	case *processors.Redactor:
+		for name, count := range p.Stats() {
+			component = append(component, zap.Uint64(name, count))
+		}
+		c.logger.Info("Redaction statistics", component...)
 	}
+}
 
-	// Export to Prometheus (if enabled)
-	if cfg, ok := c.config.Collector.Exporters["prometheus"]; ok && cfg.Enabled {
-		c.logger.Debug("Exporting to Prometheus",
-			zap.Int("metrics", len(batch.Metrics)),
+// logExporterStats logs the statistics of exporters that keep them
+func (c *Collector) logExporterStats(id string, exporter exporters.Exporter) {
+	switch e := exporter.(type) {
+	case *exporters.OTLPTraceExporter:
+		stats := e.Stats()
+		c.logger.Info("Trace exporter statistics",
+			zap.String("exporter", id),
+			zap.Uint64("spans_sent", stats.Sent),
+			zap.Uint64("spans_failed", stats.Failed),
+			zap.Uint64("spans_dropped", stats.Dropped),
+			zap.Int("spans_queued", stats.Queued),
 		)
-		// In real implementation: send to Prometheus
-	}
 
-	// Export to Elasticsearch (if enabled)
-	if cfg, ok := c.config.Collector.Exporters["elasticsearch"]; ok && cfg.Enabled {
-		c.logger.Debug("Exporting to Elasticsearch",
-			zap.Int("logs", len(batch.Logs)),
-			zap.Int("exceptions", len(batch.Exceptions)),
+	case *exporters.ElasticsearchExporter:
+		stats := e.Stats()
+		c.logger.Info("Elasticsearch exporter statistics",
+			zap.String("exporter", id),
+			zap.Uint64("documents_indexed", stats.Indexed),
+			zap.Uint64("documents_failed", stats.Failed),
 		)
-		// In real implementation: send to Elasticsearch
-	}
-
-	c.logger.Info("Batch exported",
-		zap.Int("spans", len(batch.Spans)),
-		zap.Int("logs", len(batch.Logs)),
-		zap.Int("metrics", len(batch.Metrics)),
-		zap.Int("exceptions", len(batch.Exceptions)),
-	)
-}
-
-// printStats prints periodic statistics
-func (c *Collector) printStats(ctx context.Context) {
-	ticker := time.NewTicker(30 * time.Second)
-	defer ticker.Stop()
-
-	startTime := time.Now()
-
-	for {
-		select {
-		case <-ctx.Done():
-			return
-		case <-ticker.C:
-			c.mu.RLock()
-			spanCount := len(c.spans)
-			logCount := len(c.logs)
-			metricCount := len(c.metrics)
-			exceptionCount := len(c.exceptions)
-			c.mu.RUnlock()
-
-			uptime := time.Since(startTime)
 
-			c.logger.Info("Collector statistics",
-				zap.Duration("uptime", uptime),
-				zap.Int("spans_buffered", spanCount),
-				zap.Int("logs_buffered", logCount),
-				zap.Int("metrics_buffered", metricCount),
-				zap.Int("exceptions_buffered", exceptionCount),
-			)
-		}
+	case *exporters.PrometheusExporter:
+		stats := e.Stats()
+		c.logger.Info("Prometheus exporter statistics",
+			zap.String("exporter", id),
+			zap.Uint64("samples_sent", stats.SamplesSent),
+			zap.Uint64("samples_failed", stats.SamplesFailed),
+		)
 	}
 }
 
 func main() {
 	// Load configuration
-	cfg, err := config.Load("configs/config.yaml")
+	cfg, err := config.Load(configPath)
 	if err != nil {
 		fmt.Printf("Failed to load config: %v\n", err)
 		os.Exit(1)
@@ -294,10 +317,11 @@ func main() {
 		zap.String("environment", cfg.Service.Environment),
 	)
 
-	// Create collector (pass the underlying zap logger)
-	zapLogger := logger.Logger
-	_ = zapLogger // We'll use the logger wrapper instead
-	collector := NewCollector(cfg, logger)
+	// Create collector
+	collector, err := NewCollector(cfg, logger)
+	if err != nil {
+		logger.Fatal("Failed to create collector", zap.Error(err))
+	}
 
 	// Start collector
 	ctx, cancel := context.WithCancel(context.Background())
@@ -309,16 +333,38 @@ func main() {
 
 	logger.Info("Collector started successfully")
 
-	// Wait for interrupt signal
+	// Reload on SIGHUP or when the config file changes, until interrupted.
+	// Reloads run here, one at a time.
+	changed := make(chan struct{}, 1)
+	err = config.Watch(ctx, configPath, func() {
+		select {
+		case changed <- struct{}{}:
+		default:
+		}
+	})
+	if err != nil {
+		logger.Warn("Not watching config file", zap.Error(err))
+	}
+
 	sigChan := make(chan os.Signal, 1)
-	signal.Notify(sigChan, os.Interrupt, syscall.SIGTERM)
-	<-sigChan
+	signal.Notify(sigChan, os.Interrupt, syscall.SIGTERM, syscall.SIGHUP)
+
+wait:
+	for {
+		select {
+		case sig := <-sigChan:
+			if sig != syscall.SIGHUP {
+				break wait
+			}
+			collector.Reload()
+		case <-changed:
+			collector.Reload()
+		}
+	}
 
 	logger.Info("Shutting down collector...")
 	collector.Stop()
 	cancel()
-	
-	time.Sleep(2 * time.Second)
+
 	logger.Info("Collector stopped")
 }
-
@@ -6,31 +6,54 @@ import (
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/gaurav/watchingcat/internal/config"
 	"github.com/gaurav/watchingcat/internal/dao"
 	"go.uber.org/zap"
 )
 
 // HealthHandler handles health check endpoints
 type HealthHandler struct {
-	jaegerDAO *dao.JaegerDAO
-	promDAO   *dao.PrometheusDAO
-	esDAO     *dao.ElasticsearchDAO
-	logger    *zap.Logger
+	stores []storeCheck
+	logger *zap.Logger
 }
 
-// NewHealthHandler creates a new health handler
+// storeCheck pings one store under the name /health reports it by
+type storeCheck struct {
+	name string
+	ping func(context.Context) error
+}
+
+// NewHealthHandler creates a new health handler. Stores are reported by
+// the backend storage selects for them.
 func NewHealthHandler(
-	jaegerDAO *dao.JaegerDAO,
-	promDAO *dao.PrometheusDAO,
-	esDAO *dao.ElasticsearchDAO,
+	storage config.StorageConfig,
+	traces dao.TraceReader,
+	metrics dao.MetricReader,
+	logs dao.LogReader,
 	logger *zap.Logger,
 ) *HealthHandler {
 	return &HealthHandler{
-		jaegerDAO: jaegerDAO,
-		promDAO:   promDAO,
-		esDAO:     esDAO,
-		logger:    logger,
+		stores: []storeCheck{
+			{storeName(storage.Traces, "jaeger", "traces"), traces.Ping},
+			{storeName(storage.Metrics, "prometheus", "metrics"), metrics.Ping},
+			{storeName(storage.Logs, "elasticsearch", "logs"), logs.Ping},
+		},
+		logger: logger,
+	}
+}
+
+// storeName names a store by its backend, so the jaeger, prometheus and
+// elasticsearch backends keep the keys /health has always reported.
+// Backends the signals can share, embedded and memory, are qualified by
+// signal, as in embedded/traces.
+func storeName(backend, fallback, signal string) string {
+	switch backend {
+	case "":
+		return fallback
+	case "jaeger", "prometheus", "elasticsearch":
+		return backend
 	}
+	return backend + "/" + signal
 }
 
 // HealthCheck returns the overall health status
@@ -46,25 +69,13 @@ func (h *HealthHandler) HealthCheck(c *gin.Context) {
 
 	services := status["services"].(gin.H)
 
-	// Check Jaeger
-	if err := h.jaegerDAO.Ping(ctx); err != nil {
-		services["jaeger"] = gin.H{"status": "unhealthy", "error": err.Error()}
-	} else {
-		services["jaeger"] = gin.H{"status": "healthy"}
-	}
-
-	// Check Prometheus
-	if err := h.promDAO.Ping(ctx); err != nil {
-		services["prometheus"] = gin.H{"status": "unhealthy", "error": err.Error()}
-	} else {
-		services["prometheus"] = gin.H{"status": "healthy"}
-	}
-
-	// Check Elasticsearch
-	if err := h.esDAO.Ping(ctx); err != nil {
-		services["elasticsearch"] = gin.H{"status": "unhealthy", "error": err.Error()}
-	} else {
-		services["elasticsearch"] = gin.H{"status": "healthy"}
+	// Check each store, whichever backend it is
+	for _, store := range h.stores {
+		if err := store.ping(ctx); err != nil {
+			services[store.name] = gin.H{"status": "unhealthy", "error": err.Error()}
+		} else {
+			services[store.name] = gin.H{"status": "healthy"}
+		}
 	}
 
 	// Determine overall status
@@ -92,11 +103,12 @@ func (h *HealthHandler) ReadinessCheck(c *gin.Context) {
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
-	// Check critical services
-	if err := h.jaegerDAO.Ping(ctx); err != nil {
+	// Check critical services: the trace store
+	traces := h.stores[0]
+	if err := traces.ping(ctx); err != nil {
 		c.JSON(http.StatusServiceUnavailable, gin.H{
 			"status": "not ready",
-			"reason": "jaeger unavailable",
+			"reason": traces.name + " unavailable",
 		})
 		return
 	}
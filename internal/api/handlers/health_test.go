@@ -0,0 +1,49 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+
+	"github.com/gaurav/watchingcat/internal/config"
+	"github.com/gaurav/watchingcat/internal/dao"
+	"go.uber.org/zap"
+)
+
+var errStoreDown = errors.New("store unavailable")
+
+func TestHealthCheck(t *testing.T) {
+	traces, metrics, logs := dao.NewMemoryTraceReader(), dao.NewMemoryMetricReader(), dao.NewMemoryLogReader()
+	storage := config.StorageConfig{Traces: "memory", Logs: "memory"}
+	h := NewHealthHandler(storage, traces, metrics, logs, zap.NewNop())
+
+	code, resp := serve(t, http.MethodGet, "/health", "/health", "", h.HealthCheck)
+	if code != http.StatusOK || resp["status"] != "ok" {
+		t.Errorf("Expected healthy stores to be ok, got %d %v", code, resp)
+	}
+
+	logs.SetError(errStoreDown)
+	code, resp = serve(t, http.MethodGet, "/health", "/health", "", h.HealthCheck)
+	if code != http.StatusServiceUnavailable || resp["status"] != "degraded" {
+		t.Fatalf("Expected a failing store to degrade health, got %d %v", code, resp)
+	}
+	services := resp["services"].(map[string]any)
+	if services["memory/logs"].(map[string]any)["status"] != "unhealthy" || services["memory/traces"].(map[string]any)["status"] != "healthy" {
+		t.Errorf("Unexpected per-store status %v", services)
+	}
+	// The metrics backend is unset, so it keeps its historical name
+	if services["prometheus"].(map[string]any)["status"] != "healthy" {
+		t.Errorf("Expected the metric store to be reported as prometheus, got %v", services)
+	}
+
+	// Readiness only depends on the trace store
+	code, _ = serve(t, http.MethodGet, "/health/ready", "/health/ready", "", h.ReadinessCheck)
+	if code != http.StatusOK {
+		t.Errorf("Expected ready despite the log store, got %d", code)
+	}
+	traces.SetError(errStoreDown)
+	code, _ = serve(t, http.MethodGet, "/health/ready", "/health/ready", "", h.ReadinessCheck)
+	if code != http.StatusServiceUnavailable {
+		t.Errorf("Expected not ready without the trace store, got %d", code)
+	}
+}
@@ -11,14 +11,14 @@ import (
 
 // LogsHandler handles log-related endpoints
 type LogsHandler struct {
-	esDAO  *dao.ElasticsearchDAO
+	logs   dao.LogReader
 	logger *zap.Logger
 }
 
 // NewLogsHandler creates a new logs handler
-func NewLogsHandler(esDAO *dao.ElasticsearchDAO, logger *zap.Logger) *LogsHandler {
+func NewLogsHandler(logs dao.LogReader, logger *zap.Logger) *LogsHandler {
 	return &LogsHandler{
-		esDAO:  esDAO,
+		logs:   logs,
 		logger: logger,
 	}
 }
@@ -73,7 +73,7 @@ func (h *LogsHandler) SearchLogs(c *gin.Context) {
 		params.Size = 100
 	}
 
-	result, err := h.esDAO.SearchLogs(c.Request.Context(), params)
+	result, err := h.logs.SearchLogs(c.Request.Context(), params)
 	if err != nil {
 		h.logger.Error("Failed to search logs", zap.Error(err))
 		c.JSON(http.StatusInternalServerError, gin.H{
@@ -101,7 +101,7 @@ func (h *LogsHandler) GetLogsByTrace(c *gin.Context) {
 		zap.String("trace_id", traceID),
 	)
 
-	logs, err := h.esDAO.GetLogsByTraceID(c.Request.Context(), traceID)
+	logs, err := h.logs.GetLogsByTraceID(c.Request.Context(), traceID)
 	if err != nil {
 		h.logger.Error("Failed to fetch logs", zap.Error(err))
 		c.JSON(http.StatusInternalServerError, gin.H{
@@ -0,0 +1,51 @@
+package handlers
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/gaurav/watchingcat/internal/dao"
+	"go.uber.org/zap"
+)
+
+func testLogs() *dao.MemoryLogReader {
+	return dao.NewMemoryLogReader(
+		dao.LogEntry{Timestamp: "2024-01-02T10:00:00Z", Level: "info", Message: "order placed", Service: "checkout", TraceID: "t1"},
+		dao.LogEntry{Timestamp: "2024-01-02T10:00:01Z", Level: "error", Message: "card declined", Service: "payment", TraceID: "t1"},
+		dao.LogEntry{Timestamp: "2024-01-02T10:00:02Z", Level: "error", Message: "cart expired", Service: "cart"},
+	)
+}
+
+func TestSearchLogs(t *testing.T) {
+	h := NewLogsHandler(testLogs(), zap.NewNop())
+
+	code, resp := serve(t, http.MethodPost, "/logs/search", "/logs/search", `{"level":"ERROR","size":1}`, h.SearchLogs)
+	if code != http.StatusOK || resp["total"] != float64(2) {
+		t.Fatalf("Expected two errors in total, got %d %v", code, resp)
+	}
+	logs := resp["logs"].([]any)
+	if len(logs) != 1 || logs[0].(map[string]any)["message"] != "cart expired" {
+		t.Errorf("Expected one page with the latest error, got %v", logs)
+	}
+
+	code, resp = serve(t, http.MethodPost, "/logs/search", "/logs/search", `{"query":"declined","startTime":1704189600}`, h.SearchLogs)
+	if code != http.StatusOK || resp["total"] != float64(1) {
+		t.Errorf("Expected the query to match one log, got %d %v", code, resp)
+	}
+}
+
+func TestGetLogsByTrace(t *testing.T) {
+	reader := testLogs()
+	h := NewLogsHandler(reader, zap.NewNop())
+
+	code, resp := serve(t, http.MethodGet, "/logs/trace/:traceId", "/logs/trace/t1", "", h.GetLogsByTrace)
+	if code != http.StatusOK || resp["trace_id"] != "t1" || resp["total"] != float64(2) {
+		t.Errorf("Expected the trace's two logs, got %d %v", code, resp)
+	}
+
+	reader.SetError(errStoreDown)
+	code, _ = serve(t, http.MethodGet, "/logs/trace/:traceId", "/logs/trace/t1", "", h.GetLogsByTrace)
+	if code != http.StatusInternalServerError {
+		t.Errorf("Expected a store failure to be a 500, got %d", code)
+	}
+}
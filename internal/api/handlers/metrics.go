@@ -11,14 +11,14 @@ import (
 
 // MetricsHandler handles metrics-related endpoints
 type MetricsHandler struct {
-	promDAO *dao.PrometheusDAO
+	metrics dao.MetricReader
 	logger  *zap.Logger
 }
 
 // NewMetricsHandler creates a new metrics handler
-func NewMetricsHandler(promDAO *dao.PrometheusDAO, logger *zap.Logger) *MetricsHandler {
+func NewMetricsHandler(metrics dao.MetricReader, logger *zap.Logger) *MetricsHandler {
 	return &MetricsHandler{
-		promDAO: promDAO,
+		metrics: metrics,
 		logger:  logger,
 	}
 }
@@ -58,7 +58,7 @@ func (h *MetricsHandler) Query(c *gin.Context) {
 		timestamp = time.Unix(req.Time, 0)
 	}
 
-	result, err := h.promDAO.Query(c.Request.Context(), req.Query, timestamp)
+	result, err := h.metrics.Query(c.Request.Context(), req.Query, timestamp)
 	if err != nil {
 		h.logger.Error("Failed to execute query", zap.Error(err))
 		c.JSON(http.StatusInternalServerError, gin.H{
@@ -99,7 +99,7 @@ func (h *MetricsHandler) QueryRange(c *gin.Context) {
 		step = 15 * time.Second
 	}
 
-	result, err := h.promDAO.QueryRange(c.Request.Context(), req.Query, start, end, step)
+	result, err := h.metrics.QueryRange(c.Request.Context(), req.Query, start, end, step)
 	if err != nil {
 		h.logger.Error("Failed to execute range query", zap.Error(err))
 		c.JSON(http.StatusInternalServerError, gin.H{
@@ -113,7 +113,7 @@ func (h *MetricsHandler) QueryRange(c *gin.Context) {
 
 // GetLabels returns all label names
 func (h *MetricsHandler) GetLabels(c *gin.Context) {
-	labels, err := h.promDAO.GetLabels(c.Request.Context())
+	labels, err := h.metrics.GetLabels(c.Request.Context())
 	if err != nil {
 		h.logger.Error("Failed to fetch labels", zap.Error(err))
 		c.JSON(http.StatusInternalServerError, gin.H{
@@ -131,7 +131,7 @@ func (h *MetricsHandler) GetLabels(c *gin.Context) {
 func (h *MetricsHandler) GetLabelValues(c *gin.Context) {
 	labelName := c.Param("name")
 
-	values, err := h.promDAO.GetLabelValues(c.Request.Context(), labelName)
+	values, err := h.metrics.GetLabelValues(c.Request.Context(), labelName)
 	if err != nil {
 		h.logger.Error("Failed to fetch label values", zap.Error(err))
 		c.JSON(http.StatusInternalServerError, gin.H{
@@ -0,0 +1,69 @@
+package handlers
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/gaurav/watchingcat/internal/dao"
+	"go.uber.org/zap"
+)
+
+func TestQuery(t *testing.T) {
+	reader := dao.NewMemoryMetricReader()
+	result := &dao.QueryResult{Status: "success"}
+	result.Data.ResultType = "vector"
+	result.Data.Result = []dao.MetricResult{{Metric: map[string]string{"job": "api"}, Value: []any{1704189600.0, "1"}}}
+	reader.SetResult("up", result)
+	h := NewMetricsHandler(reader, zap.NewNop())
+
+	code, resp := serve(t, http.MethodPost, "/metrics/query", "/metrics/query", `{"query":"up"}`, h.Query)
+	if code != http.StatusOK || resp["status"] != "success" {
+		t.Fatalf("Unexpected response %d %v", code, resp)
+	}
+	data := resp["data"].(map[string]any)
+	if series := data["result"].([]any); len(series) != 1 {
+		t.Errorf("Expected one series, got %v", series)
+	}
+
+	code, _ = serve(t, http.MethodPost, "/metrics/query", "/metrics/query", `{}`, h.Query)
+	if code != http.StatusBadRequest {
+		t.Errorf("Expected a missing query to be a 400, got %d", code)
+	}
+}
+
+func TestQueryRange(t *testing.T) {
+	reader := dao.NewMemoryMetricReader()
+	h := NewMetricsHandler(reader, zap.NewNop())
+
+	body := `{"query":"rate(http_requests_total[5m])","start":1704189600,"end":1704193200}`
+	code, resp := serve(t, http.MethodPost, "/metrics/query_range", "/metrics/query_range", body, h.QueryRange)
+	if code != http.StatusOK || resp["data"].(map[string]any)["resultType"] != "matrix" {
+		t.Errorf("Expected an empty matrix, got %d %v", code, resp)
+	}
+
+	reader.SetError(errStoreDown)
+	code, _ = serve(t, http.MethodPost, "/metrics/query_range", "/metrics/query_range", body, h.QueryRange)
+	if code != http.StatusInternalServerError {
+		t.Errorf("Expected a store failure to be a 500, got %d", code)
+	}
+}
+
+func TestLabels(t *testing.T) {
+	reader := dao.NewMemoryMetricReader()
+	reader.AddSeries(
+		map[string]string{"__name__": "up", "job": "api"},
+		map[string]string{"__name__": "up", "job": "worker", "zone": "eu"},
+	)
+	h := NewMetricsHandler(reader, zap.NewNop())
+
+	code, resp := serve(t, http.MethodGet, "/metrics/labels", "/metrics/labels", "", h.GetLabels)
+	if code != http.StatusOK || len(resp["labels"].([]any)) != 3 {
+		t.Errorf("Expected three label names, got %d %v", code, resp)
+	}
+
+	code, resp = serve(t, http.MethodGet, "/metrics/labels/:name/values", "/metrics/labels/job/values", "", h.GetLabelValues)
+	values := resp["values"].([]any)
+	if code != http.StatusOK || resp["label"] != "job" || len(values) != 2 || values[0] != "api" {
+		t.Errorf("Expected the job values, got %d %v", code, resp)
+	}
+}
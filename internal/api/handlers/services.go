@@ -2,23 +2,26 @@ package handlers
 
 import (
 	"net/http"
+	"strconv"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/gaurav/watchingcat/internal/dao"
+	"github.com/gaurav/watchingcat/internal/servicegraph"
 	"go.uber.org/zap"
 )
 
 // ServicesHandler handles service-related endpoints
 type ServicesHandler struct {
-	jaegerDAO *dao.JaegerDAO
-	logger    *zap.Logger
+	traces dao.TraceReader
+	logger *zap.Logger
 }
 
 // NewServicesHandler creates a new services handler
-func NewServicesHandler(jaegerDAO *dao.JaegerDAO, logger *zap.Logger) *ServicesHandler {
+func NewServicesHandler(traces dao.TraceReader, logger *zap.Logger) *ServicesHandler {
 	return &ServicesHandler{
-		jaegerDAO: jaegerDAO,
-		logger:    logger,
+		traces: traces,
+		logger: logger,
 	}
 }
 
@@ -26,7 +29,7 @@ func NewServicesHandler(jaegerDAO *dao.JaegerDAO, logger *zap.Logger) *ServicesH
 func (h *ServicesHandler) ListServices(c *gin.Context) {
 	h.logger.Info("Fetching services list")
 
-	services, err := h.jaegerDAO.GetServices(c.Request.Context())
+	services, err := h.traces.GetServices(c.Request.Context())
 	if err != nil {
 		h.logger.Error("Failed to fetch services", zap.Error(err))
 		c.JSON(http.StatusInternalServerError, gin.H{
@@ -49,7 +52,7 @@ func (h *ServicesHandler) GetService(c *gin.Context) {
 		zap.String("service", serviceName),
 	)
 
-	operations, err := h.jaegerDAO.GetOperations(c.Request.Context(), serviceName)
+	operations, err := h.traces.GetOperations(c.Request.Context(), serviceName)
 	if err != nil {
 		h.logger.Error("Failed to fetch service operations", zap.Error(err))
 		c.JSON(http.StatusInternalServerError, gin.H{
@@ -72,7 +75,7 @@ func (h *ServicesHandler) GetOperations(c *gin.Context) {
 		zap.String("service", serviceName),
 	)
 
-	operations, err := h.jaegerDAO.GetOperations(c.Request.Context(), serviceName)
+	operations, err := h.traces.GetOperations(c.Request.Context(), serviceName)
 	if err != nil {
 		h.logger.Error("Failed to fetch operations", zap.Error(err))
 		c.JSON(http.StatusInternalServerError, gin.H{
@@ -87,3 +90,104 @@ func (h *ServicesHandler) GetOperations(c *gin.Context) {
 	})
 }
 
+// Bounds on the trace searches one service graph request makes
+const (
+	maxGraphServices = 50
+	maxGraphLimit    = 1000
+)
+
+// GetServiceGraph returns the calls between services within a time range.
+// start and end are microseconds since epoch and default to the last hour.
+//
+// The graph is built from a sample, not from every call: at most limit
+// traces (default 100, at most 1000) are searched for each of at most 50
+// services, in the order the backend lists them. Edge calls, errors and
+// latencies describe the sampled traces only, whose number is returned as
+// traces. services_skipped counts services left out by the bound. Complete
+// call counts come from the servicegraph connector's metrics.
+func (h *ServicesHandler) GetServiceGraph(c *gin.Context) {
+	end := time.Now().UnixMicro()
+	if v := c.Query("end"); v != "" {
+		parsed, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "Invalid end time",
+			})
+			return
+		}
+		end = parsed
+	}
+
+	start := end - time.Hour.Microseconds()
+	if v := c.Query("start"); v != "" {
+		parsed, err := strconv.ParseInt(v, 10, 64)
+		if err != nil || parsed > end {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "Invalid start time",
+			})
+			return
+		}
+		start = parsed
+	}
+
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "100"))
+	if err != nil || limit <= 0 {
+		limit = 100
+	}
+	limit = min(limit, maxGraphLimit)
+
+	h.logger.Info("Building service graph",
+		zap.Int64("start", start),
+		zap.Int64("end", end),
+	)
+
+	services, err := h.traces.GetServices(c.Request.Context())
+	if err != nil {
+		h.logger.Error("Failed to fetch services", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Failed to build service graph",
+		})
+		return
+	}
+
+	skipped := max(len(services)-maxGraphServices, 0)
+	services = services[:len(services)-skipped]
+
+	// A trace spanning several services is returned once per service
+	seen := make(map[string]bool)
+	var spans []servicegraph.Span
+	for _, service := range services {
+		traces, err := h.traces.SearchTraces(c.Request.Context(), dao.SearchParams{
+			ServiceName: service,
+			Limit:       limit,
+			Start:       start,
+			End:         end,
+		})
+		if err != nil {
+			h.logger.Warn("Failed to search traces for service graph",
+				zap.String("service", service),
+				zap.Error(err),
+			)
+			continue
+		}
+		for _, trace := range traces {
+			if seen[trace.TraceID] {
+				continue
+			}
+			seen[trace.TraceID] = true
+			spans = append(spans, servicegraph.FromJaeger(trace)...)
+		}
+	}
+
+	edges := servicegraph.Build(spans)
+
+	c.JSON(http.StatusOK, gin.H{
+		"edges":            edges,
+		"total":            len(edges),
+		"traces":           len(seen),
+		"limit":            limit,
+		"services_skipped": skipped,
+		"start":            start,
+		"end":              end,
+	})
+}
@@ -0,0 +1,50 @@
+package handlers
+
+import (
+	"net/http"
+	"testing"
+
+	"go.uber.org/zap"
+)
+
+func TestListServices(t *testing.T) {
+	h := NewServicesHandler(testTraces(), zap.NewNop())
+
+	code, resp := serve(t, http.MethodGet, "/services", "/services", "", h.ListServices)
+	services := resp["services"].([]any)
+	if code != http.StatusOK || len(services) != 3 || services[0] != "cart" {
+		t.Errorf("Expected cart, checkout and payment, got %d %v", code, resp)
+	}
+
+	code, resp = serve(t, http.MethodGet, "/services/:name/operations", "/services/checkout/operations", "", h.GetOperations)
+	if ops := resp["operations"].([]any); code != http.StatusOK || len(ops) != 1 || ops[0] != "POST /checkout" {
+		t.Errorf("Expected checkout's operation, got %d %v", code, resp)
+	}
+}
+
+func TestGetServiceGraph(t *testing.T) {
+	h := NewServicesHandler(testTraces(), zap.NewNop())
+
+	// t1 is found through both checkout and payment but counted once
+	code, resp := serve(t, http.MethodGet, "/services/graph", "/services/graph?start=0&end=10000", "", h.GetServiceGraph)
+	if code != http.StatusOK || resp["traces"] != float64(2) || resp["total"] != float64(1) {
+		t.Fatalf("Expected one edge from two traces, got %d %v", code, resp)
+	}
+	if resp["limit"] != float64(100) || resp["services_skipped"] != float64(0) {
+		t.Errorf("Expected the sample bounds in the response, got %v", resp)
+	}
+	edge := resp["edges"].([]any)[0].(map[string]any)
+	if edge["client"] != "checkout" || edge["server"] != "payment" {
+		t.Errorf("Expected checkout -> payment, got %v", edge)
+	}
+
+	_, resp = serve(t, http.MethodGet, "/services/graph", "/services/graph?start=0&end=10000&limit=5000", "", h.GetServiceGraph)
+	if resp["limit"] != float64(maxGraphLimit) {
+		t.Errorf("Expected the limit to be capped, got %v", resp["limit"])
+	}
+
+	code, _ = serve(t, http.MethodGet, "/services/graph", "/services/graph?start=5&end=1", "", h.GetServiceGraph)
+	if code != http.StatusBadRequest {
+		t.Errorf("Expected start after end to be a 400, got %d", code)
+	}
+}
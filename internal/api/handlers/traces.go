@@ -11,15 +11,15 @@ import (
 
 // TracesHandler handles trace-related endpoints
 type TracesHandler struct {
-	jaegerDAO *dao.JaegerDAO
-	logger    *zap.Logger
+	traces dao.TraceReader
+	logger *zap.Logger
 }
 
 // NewTracesHandler creates a new traces handler
-func NewTracesHandler(jaegerDAO *dao.JaegerDAO, logger *zap.Logger) *TracesHandler {
+func NewTracesHandler(traces dao.TraceReader, logger *zap.Logger) *TracesHandler {
 	return &TracesHandler{
-		jaegerDAO: jaegerDAO,
-		logger:    logger,
+		traces: traces,
+		logger: logger,
 	}
 }
 
@@ -45,7 +45,7 @@ func (h *TracesHandler) ListTraces(c *gin.Context) {
 		Limit:       limit,
 	}
 
-	traces, err := h.jaegerDAO.SearchTraces(c.Request.Context(), params)
+	traces, err := h.traces.SearchTraces(c.Request.Context(), params)
 	if err != nil {
 		h.logger.Error("Failed to search traces", zap.Error(err))
 		c.JSON(http.StatusInternalServerError, gin.H{
@@ -68,7 +68,7 @@ func (h *TracesHandler) GetTrace(c *gin.Context) {
 		zap.String("trace_id", traceID),
 	)
 
-	trace, err := h.jaegerDAO.GetTrace(c.Request.Context(), traceID)
+	trace, err := h.traces.GetTrace(c.Request.Context(), traceID)
 	if err != nil {
 		h.logger.Error("Failed to fetch trace",
 			zap.String("trace_id", traceID),
@@ -125,7 +125,7 @@ func (h *TracesHandler) SearchTraces(c *gin.Context) {
 		params.Limit = 20
 	}
 
-	traces, err := h.jaegerDAO.SearchTraces(c.Request.Context(), params)
+	traces, err := h.traces.SearchTraces(c.Request.Context(), params)
 	if err != nil {
 		h.logger.Error("Failed to search traces", zap.Error(err))
 		c.JSON(http.StatusInternalServerError, gin.H{
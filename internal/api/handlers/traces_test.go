@@ -0,0 +1,120 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gaurav/watchingcat/internal/dao"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+func init() {
+	gin.SetMode(gin.TestMode)
+}
+
+// serve sends a request through a router with one route and decodes the
+// JSON response
+func serve(t *testing.T, method, route, target, body string, handler gin.HandlerFunc) (int, map[string]any) {
+	t.Helper()
+	router := gin.New()
+	router.Handle(method, route, handler)
+
+	req := httptest.NewRequest(method, target, strings.NewReader(body))
+	if body != "" {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+
+	var resp map[string]any
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("Invalid JSON response %q: %v", rec.Body.String(), err)
+	}
+	return rec.Code, resp
+}
+
+// testTraces has a checkout trace calling payment and a slower cart trace
+func testTraces() *dao.MemoryTraceReader {
+	return dao.NewMemoryTraceReader(
+		dao.Trace{
+			TraceID: "t1",
+			Spans: []dao.Span{
+				{TraceID: "t1", SpanID: "a", OperationName: "POST /checkout", StartTime: 1000, Duration: 50000, ProcessID: "p1",
+					Tags: []dao.Tag{{Key: "http.status_code", Type: "int64", Value: 200}}},
+				{TraceID: "t1", SpanID: "b", OperationName: "Charge", StartTime: 1100, Duration: 20000, ProcessID: "p2",
+					References: []dao.Reference{{RefType: "CHILD_OF", TraceID: "t1", SpanID: "a"}}},
+			},
+			Processes: map[string]dao.Process{"p1": {ServiceName: "checkout"}, "p2": {ServiceName: "payment"}},
+		},
+		dao.Trace{
+			TraceID: "t2",
+			Spans: []dao.Span{
+				{TraceID: "t2", SpanID: "c", OperationName: "GET /cart", StartTime: 2000, Duration: 900000, ProcessID: "p1"},
+			},
+			Processes: map[string]dao.Process{"p1": {ServiceName: "cart"}},
+		},
+	)
+}
+
+func TestListTraces(t *testing.T) {
+	h := NewTracesHandler(testTraces(), zap.NewNop())
+
+	code, resp := serve(t, http.MethodGet, "/traces", "/traces?service=payment", "", h.ListTraces)
+	if code != http.StatusOK || resp["total"] != float64(1) {
+		t.Fatalf("Expected one payment trace, got %d %v", code, resp)
+	}
+	traces := resp["traces"].([]any)
+	if id := traces[0].(map[string]any)["traceID"]; id != "t1" {
+		t.Errorf("Expected trace t1, got %v", id)
+	}
+}
+
+func TestGetTrace(t *testing.T) {
+	h := NewTracesHandler(testTraces(), zap.NewNop())
+
+	code, resp := serve(t, http.MethodGet, "/traces/:id", "/traces/t2", "", h.GetTrace)
+	if code != http.StatusOK || resp["trace"].(map[string]any)["traceID"] != "t2" {
+		t.Errorf("Expected trace t2, got %d %v", code, resp)
+	}
+
+	code, _ = serve(t, http.MethodGet, "/traces/:id", "/traces/missing", "", h.GetTrace)
+	if code != http.StatusNotFound {
+		t.Errorf("Expected 404 for an unknown trace, got %d", code)
+	}
+}
+
+func TestSearchTraces(t *testing.T) {
+	reader := testTraces()
+	h := NewTracesHandler(reader, zap.NewNop())
+
+	tests := []struct {
+		name, body string
+		code       int
+		total      float64
+	}{
+		{"by tag", `{"service":"checkout","tags":{"http.status_code":"200"}}`, http.StatusOK, 1},
+		{"by duration", `{"service":"cart","minDuration":"500ms"}`, http.StatusOK, 1},
+		{"duration excludes", `{"service":"checkout","minDuration":"500ms"}`, http.StatusOK, 0},
+		{"missing service", `{"operation":"Charge"}`, http.StatusBadRequest, 0},
+	}
+	for _, tt := range tests {
+		code, resp := serve(t, http.MethodPost, "/traces/search", "/traces/search", tt.body, h.SearchTraces)
+		if code != tt.code {
+			t.Errorf("%s: expected status %d, got %d", tt.name, tt.code, code)
+			continue
+		}
+		if code == http.StatusOK && resp["total"] != tt.total {
+			t.Errorf("%s: expected %v traces, got %v", tt.name, tt.total, resp["total"])
+		}
+	}
+
+	reader.SetError(errStoreDown)
+	code, resp := serve(t, http.MethodPost, "/traces/search", "/traces/search", `{"service":"cart"}`, h.SearchTraces)
+	if code != http.StatusInternalServerError || resp["error"] != "Search failed" {
+		t.Errorf("Expected a store failure to be a 500, got %d %v", code, resp)
+	}
+}
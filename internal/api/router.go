@@ -11,12 +11,12 @@ import (
 	"go.uber.org/zap"
 )
 
-// NewRouter creates and configures the API router
+// NewRouter creates and configures the API router over the given stores
 func NewRouter(
 	cfg *config.Config,
-	jaegerDAO *dao.JaegerDAO,
-	promDAO *dao.PrometheusDAO,
-	esDAO *dao.ElasticsearchDAO,
+	traceReader dao.TraceReader,
+	metricReader dao.MetricReader,
+	logReader dao.LogReader,
 	logger *zap.Logger,
 ) *gin.Engine {
 	router := gin.New()
@@ -27,11 +27,11 @@ func NewRouter(
 	router.Use(middleware.CORS(cfg.CORS))
 
 	// Initialize handlers
-	healthHandler := handlers.NewHealthHandler(jaegerDAO, promDAO, esDAO, logger)
-	tracesHandler := handlers.NewTracesHandler(jaegerDAO, logger)
-	metricsHandler := handlers.NewMetricsHandler(promDAO, logger)
-	logsHandler := handlers.NewLogsHandler(esDAO, logger)
-	servicesHandler := handlers.NewServicesHandler(jaegerDAO, logger)
+	healthHandler := handlers.NewHealthHandler(cfg.Storage, traceReader, metricReader, logReader, logger)
+	tracesHandler := handlers.NewTracesHandler(traceReader, logger)
+	metricsHandler := handlers.NewMetricsHandler(metricReader, logger)
+	logsHandler := handlers.NewLogsHandler(logReader, logger)
+	servicesHandler := handlers.NewServicesHandler(traceReader, logger)
 
 	// Serve static files (Frontend)
 	router.Static("/static", "./web/static")
@@ -71,6 +71,7 @@ func NewRouter(
 		services := v1.Group("/services")
 		{
 			services.GET("", servicesHandler.ListServices)
+			services.GET("/graph", servicesHandler.GetServiceGraph)
 			services.GET("/:name", servicesHandler.GetService)
 			services.GET("/:name/operations", servicesHandler.GetOperations)
 		}
@@ -0,0 +1,255 @@
+package buffer
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+
+	"github.com/gaurav/watchingcat/internal/config"
+	"github.com/gaurav/watchingcat/pkg/models"
+)
+
+// Policy decides what happens to incoming data when a buffer is full
+type Policy string
+
+const (
+	// DropOldest evicts the oldest buffered items to make room
+	DropOldest Policy = "drop_oldest"
+	// DropNewest keeps what is buffered and discards the overflow
+	DropNewest Policy = "drop_newest"
+	// Reject refuses the whole batch so the sender can retry later
+	Reject Policy = "reject"
+)
+
+var (
+	// ErrFull is returned under the reject policy when a batch does not fit
+	ErrFull = errors.New("buffer full")
+	// ErrMemoryLimit is returned while the memory limiter refuses data
+	ErrMemoryLimit = errors.New("memory limit exceeded")
+)
+
+// Buffer holds telemetry between exports. Each signal is bounded by its own
+// capacity, and Ready fires once any signal reaches the send batch size so
+// the caller can flush early.
+type Buffer struct {
+	capacity      config.SignalCapacity
+	policy        Policy
+	sendBatchSize int
+	limiter       *MemoryLimiter
+
+	mu         sync.Mutex
+	spans      []models.Span
+	logs       []models.LogRecord
+	metrics    []models.Metric
+	exceptions []models.ExceptionRecord
+
+	dropped signalCounters
+	refused signalCounters
+	ready   chan struct{}
+}
+
+// signalCounters counts items per signal
+type signalCounters struct {
+	spans, logs, metrics, exceptions atomic.Uint64
+}
+
+// Stats describes the buffer's current contents and losses
+type Stats struct {
+	Spans      SignalStats
+	Logs       SignalStats
+	Metrics    SignalStats
+	Exceptions SignalStats
+}
+
+// SignalStats holds buffer counters for one signal
+type SignalStats struct {
+	Buffered int
+	Dropped  uint64 // discarded by the drop_oldest or drop_newest policy
+	Refused  uint64 // returned to the sender by the reject policy or memory limiter
+}
+
+// New creates a buffer. limiter may be nil.
+func New(cfg config.BufferConfig, limiter *MemoryLimiter) (*Buffer, error) {
+	policy := Policy(cfg.Policy)
+	switch policy {
+	case "":
+		policy = DropOldest
+	case DropOldest, DropNewest, Reject:
+	default:
+		return nil, fmt.Errorf("unknown buffer policy %q", cfg.Policy)
+	}
+
+	return &Buffer{
+		capacity:      cfg.Capacity,
+		policy:        policy,
+		sendBatchSize: cfg.SendBatchSize,
+		limiter:       limiter,
+		ready:         make(chan struct{}, 1),
+	}, nil
+}
+
+// AddSpans buffers spans
+func (b *Buffer) AddSpans(spans []models.Span) error {
+	if err := b.admit(); err != nil {
+		b.refused.spans.Add(uint64(len(spans)))
+		return err
+	}
+
+	b.mu.Lock()
+	var dropped int
+	var err error
+	b.spans, dropped, err = add(b.spans, spans, b.capacity.Spans, b.policy)
+	b.signal(len(b.spans))
+	b.mu.Unlock()
+
+	return b.count(&b.dropped.spans, &b.refused.spans, len(spans), dropped, err)
+}
+
+// AddLogs buffers log records
+func (b *Buffer) AddLogs(logs []models.LogRecord) error {
+	if err := b.admit(); err != nil {
+		b.refused.logs.Add(uint64(len(logs)))
+		return err
+	}
+
+	b.mu.Lock()
+	var dropped int
+	var err error
+	b.logs, dropped, err = add(b.logs, logs, b.capacity.Logs, b.policy)
+	b.signal(len(b.logs))
+	b.mu.Unlock()
+
+	return b.count(&b.dropped.logs, &b.refused.logs, len(logs), dropped, err)
+}
+
+// AddMetrics buffers metric points
+func (b *Buffer) AddMetrics(metrics []models.Metric) error {
+	if err := b.admit(); err != nil {
+		b.refused.metrics.Add(uint64(len(metrics)))
+		return err
+	}
+
+	b.mu.Lock()
+	var dropped int
+	var err error
+	b.metrics, dropped, err = add(b.metrics, metrics, b.capacity.Metrics, b.policy)
+	b.signal(len(b.metrics))
+	b.mu.Unlock()
+
+	return b.count(&b.dropped.metrics, &b.refused.metrics, len(metrics), dropped, err)
+}
+
+// AddExceptions buffers exception records
+func (b *Buffer) AddExceptions(exceptions []models.ExceptionRecord) error {
+	if err := b.admit(); err != nil {
+		b.refused.exceptions.Add(uint64(len(exceptions)))
+		return err
+	}
+
+	b.mu.Lock()
+	var dropped int
+	var err error
+	b.exceptions, dropped, err = add(b.exceptions, exceptions, b.capacity.Exceptions, b.policy)
+	b.signal(len(b.exceptions))
+	b.mu.Unlock()
+
+	return b.count(&b.dropped.exceptions, &b.refused.exceptions, len(exceptions), dropped, err)
+}
+
+// Drain removes and returns everything buffered
+func (b *Buffer) Drain() models.TelemetryBatch {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	batch := models.TelemetryBatch{
+		Spans:      b.spans,
+		Logs:       b.logs,
+		Metrics:    b.metrics,
+		Exceptions: b.exceptions,
+	}
+	b.spans = nil
+	b.logs = nil
+	b.metrics = nil
+	b.exceptions = nil
+
+	return batch
+}
+
+// Ready fires when a signal has reached the send batch size
+func (b *Buffer) Ready() <-chan struct{} {
+	return b.ready
+}
+
+// Stats returns buffered item counts and loss counters
+func (b *Buffer) Stats() Stats {
+	b.mu.Lock()
+	spans, logs, metrics, exceptions := len(b.spans), len(b.logs), len(b.metrics), len(b.exceptions)
+	b.mu.Unlock()
+
+	return Stats{
+		Spans:      SignalStats{Buffered: spans, Dropped: b.dropped.spans.Load(), Refused: b.refused.spans.Load()},
+		Logs:       SignalStats{Buffered: logs, Dropped: b.dropped.logs.Load(), Refused: b.refused.logs.Load()},
+		Metrics:    SignalStats{Buffered: metrics, Dropped: b.dropped.metrics.Load(), Refused: b.refused.metrics.Load()},
+		Exceptions: SignalStats{Buffered: exceptions, Dropped: b.dropped.exceptions.Load(), Refused: b.refused.exceptions.Load()},
+	}
+}
+
+// admit checks the memory limiter before data is buffered
+func (b *Buffer) admit() error {
+	if b.limiter != nil && !b.limiter.Allow() {
+		return ErrMemoryLimit
+	}
+	return nil
+}
+
+// signal notifies Ready once a signal reaches the send batch size.
+// Must be called with mu held.
+func (b *Buffer) signal(size int) {
+	if b.sendBatchSize <= 0 || size < b.sendBatchSize {
+		return
+	}
+	select {
+	case b.ready <- struct{}{}:
+	default:
+	}
+}
+
+// count records the outcome of an add
+func (b *Buffer) count(dropped, refused *atomic.Uint64, n, droppedItems int, err error) error {
+	if err != nil {
+		refused.Add(uint64(n))
+		return err
+	}
+	if droppedItems > 0 {
+		dropped.Add(uint64(droppedItems))
+	}
+	return nil
+}
+
+// add appends items to buf without exceeding capacity, applying the overflow
+// policy. A capacity of zero or less means unbounded. It returns the new
+// buffer and the number of items dropped.
+func add[T any](buf, items []T, capacity int, policy Policy) ([]T, int, error) {
+	if capacity <= 0 || len(buf)+len(items) <= capacity {
+		return append(buf, items...), 0, nil
+	}
+
+	overflow := len(buf) + len(items) - capacity
+
+	switch policy {
+	case Reject:
+		return buf, 0, fmt.Errorf("%w: %d of %d slots free", ErrFull, capacity-len(buf), capacity)
+
+	case DropNewest:
+		return append(buf, items[:len(items)-overflow]...), overflow, nil
+
+	default:
+		if len(items) >= capacity {
+			return append(buf[:0], items[len(items)-capacity:]...), overflow, nil
+		}
+		// Shift instead of reslicing so the backing array does not keep growing
+		n := copy(buf, buf[overflow:])
+		return append(buf[:n], items...), overflow, nil
+	}
+}
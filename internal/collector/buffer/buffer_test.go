@@ -0,0 +1,158 @@
+package buffer
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/gaurav/watchingcat/internal/config"
+	"github.com/gaurav/watchingcat/pkg/models"
+	"go.uber.org/zap"
+)
+
+func namedSpans(names ...string) []models.Span {
+	spans := make([]models.Span, len(names))
+	for i, name := range names {
+		spans[i] = models.Span{Name: name}
+	}
+	return spans
+}
+
+func spanNames(spans []models.Span) []string {
+	names := make([]string, len(spans))
+	for i, span := range spans {
+		names[i] = span.Name
+	}
+	return names
+}
+
+func newTestBuffer(t *testing.T, policy Policy, limiter *MemoryLimiter) *Buffer {
+	b, err := New(config.BufferConfig{
+		Capacity:      config.SignalCapacity{Spans: 3, Logs: 3, Metrics: 3, Exceptions: 3},
+		Policy:        string(policy),
+		SendBatchSize: 2,
+	}, limiter)
+	if err != nil {
+		t.Fatalf("Failed to create buffer: %v", err)
+	}
+	return b
+}
+
+func TestBufferPolicies(t *testing.T) {
+	cases := []struct {
+		policy  Policy
+		want    []string
+		dropped uint64
+		refused uint64
+	}{
+		{DropOldest, []string{"c", "d", "e"}, 2, 0},
+		{DropNewest, []string{"a", "b", "c"}, 2, 0},
+		{Reject, []string{"a", "b"}, 0, 3},
+	}
+
+	for _, tc := range cases {
+		t.Run(string(tc.policy), func(t *testing.T) {
+			b := newTestBuffer(t, tc.policy, nil)
+
+			if err := b.AddSpans(namedSpans("a", "b")); err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			err := b.AddSpans(namedSpans("c", "d", "e"))
+			if tc.policy == Reject {
+				if !errors.Is(err, ErrFull) {
+					t.Errorf("Expected ErrFull, got %v", err)
+				}
+			} else if err != nil {
+				t.Errorf("Unexpected error: %v", err)
+			}
+
+			stats := b.Stats().Spans
+			if stats.Dropped != tc.dropped || stats.Refused != tc.refused {
+				t.Errorf("Expected %d dropped and %d refused, got %+v", tc.dropped, tc.refused, stats)
+			}
+
+			got := spanNames(b.Drain().Spans)
+			if len(got) != len(tc.want) {
+				t.Fatalf("Expected %v, got %v", tc.want, got)
+			}
+			for i := range got {
+				if got[i] != tc.want[i] {
+					t.Errorf("Expected %v, got %v", tc.want, got)
+					break
+				}
+			}
+		})
+	}
+}
+
+func TestBufferDropOldestOversizedBatch(t *testing.T) {
+	b := newTestBuffer(t, DropOldest, nil)
+	b.AddSpans(namedSpans("a"))
+	b.AddSpans(namedSpans("b", "c", "d", "e"))
+
+	got := spanNames(b.Drain().Spans)
+	if len(got) != 3 || got[0] != "c" || got[2] != "e" {
+		t.Errorf("Expected the newest 3 spans, got %v", got)
+	}
+	if dropped := b.Stats().Spans.Dropped; dropped != 2 {
+		t.Errorf("Expected 2 dropped, got %d", dropped)
+	}
+}
+
+func TestBufferReadyAtSendBatchSize(t *testing.T) {
+	b := newTestBuffer(t, DropOldest, nil)
+
+	b.AddLogs([]models.LogRecord{{Message: "one"}})
+	select {
+	case <-b.Ready():
+		t.Fatal("Expected no flush below the send batch size")
+	default:
+	}
+
+	b.AddLogs([]models.LogRecord{{Message: "two"}})
+	select {
+	case <-b.Ready():
+	default:
+		t.Fatal("Expected a flush at the send batch size")
+	}
+
+	if batch := b.Drain(); len(batch.Logs) != 2 {
+		t.Errorf("Expected 2 logs drained, got %d", len(batch.Logs))
+	}
+	if stats := b.Stats(); stats.Logs.Buffered != 0 {
+		t.Errorf("Expected an empty buffer after drain, got %+v", stats.Logs)
+	}
+}
+
+func TestBufferUnknownPolicy(t *testing.T) {
+	if _, err := New(config.BufferConfig{Policy: "drop_random"}, nil); err == nil {
+		t.Error("Expected error for unknown policy")
+	}
+}
+
+func TestMemoryLimiterRefusesAboveLimit(t *testing.T) {
+	limiter := NewMemoryLimiter(config.MemoryLimiterConfig{LimitMiB: 1}, zap.NewNop())
+	heap := uint64(2 << 20)
+	limiter.heapAlloc = func() uint64 { return heap }
+
+	b := newTestBuffer(t, DropOldest, limiter)
+
+	limiter.check()
+	if err := b.AddMetrics([]models.Metric{{Name: "up"}}); !errors.Is(err, ErrMemoryLimit) {
+		t.Errorf("Expected ErrMemoryLimit, got %v", err)
+	}
+	if refused := b.Stats().Metrics.Refused; refused != 1 {
+		t.Errorf("Expected 1 refused metric, got %d", refused)
+	}
+
+	heap = 512 << 10
+	limiter.check()
+	if err := b.AddMetrics([]models.Metric{{Name: "up"}}); err != nil {
+		t.Errorf("Expected data to be accepted below the limit, got %v", err)
+	}
+}
+
+func TestMemoryLimiterDisabled(t *testing.T) {
+	if limiter := NewMemoryLimiter(config.MemoryLimiterConfig{}, zap.NewNop()); limiter != nil {
+		t.Error("Expected no limiter without a limit")
+	}
+}
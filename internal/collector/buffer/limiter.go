@@ -0,0 +1,92 @@
+package buffer
+
+import (
+	"context"
+	"runtime"
+	"sync/atomic"
+	"time"
+
+	"github.com/gaurav/watchingcat/internal/config"
+	"go.uber.org/zap"
+)
+
+// MemoryLimiter refuses incoming data while the Go heap is above a limit.
+// The heap is sampled on an interval rather than per request because
+// runtime.ReadMemStats stops the world.
+type MemoryLimiter struct {
+	limit    uint64
+	interval time.Duration
+	logger   *zap.Logger
+
+	refusing  atomic.Bool
+	heapAlloc func() uint64
+}
+
+// NewMemoryLimiter creates a memory limiter, or returns nil if no limit is configured
+func NewMemoryLimiter(cfg config.MemoryLimiterConfig, logger *zap.Logger) *MemoryLimiter {
+	if cfg.LimitMiB <= 0 {
+		return nil
+	}
+
+	interval := cfg.CheckInterval
+	if interval <= 0 {
+		interval = time.Second
+	}
+
+	return &MemoryLimiter{
+		limit:     uint64(cfg.LimitMiB) << 20,
+		interval:  interval,
+		logger:    logger,
+		heapAlloc: readHeapAlloc,
+	}
+}
+
+// Start samples heap usage until ctx is cancelled
+func (m *MemoryLimiter) Start(ctx context.Context) {
+	ticker := time.NewTicker(m.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			m.check()
+		}
+	}
+}
+
+// Allow reports whether new data may be accepted
+func (m *MemoryLimiter) Allow() bool {
+	return !m.refusing.Load()
+}
+
+// check samples the heap, forcing a GC first when above the limit so that
+// garbage alone does not cause data to be refused
+func (m *MemoryLimiter) check() {
+	heap := m.heapAlloc()
+	if heap > m.limit {
+		runtime.GC()
+		heap = m.heapAlloc()
+	}
+
+	refusing := heap > m.limit
+	if m.refusing.Swap(refusing) != refusing {
+		if refusing {
+			m.logger.Warn("Memory limit exceeded, refusing data",
+				zap.Uint64("heap_bytes", heap),
+				zap.Uint64("limit_bytes", m.limit),
+			)
+		} else {
+			m.logger.Info("Memory usage back below limit, accepting data",
+				zap.Uint64("heap_bytes", heap),
+			)
+		}
+	}
+}
+
+func readHeapAlloc() uint64 {
+	var stats runtime.MemStats
+	runtime.ReadMemStats(&stats)
+	return stats.HeapAlloc
+}
@@ -0,0 +1,318 @@
+// Package components registers the collector's built-in receivers,
+// processors, connectors and exporters
+package components
+
+import (
+	"github.com/gaurav/watchingcat/internal/collector/exporters"
+	"github.com/gaurav/watchingcat/internal/collector/filelog"
+	"github.com/gaurav/watchingcat/internal/collector/hostmetrics"
+	"github.com/gaurav/watchingcat/internal/collector/otlp"
+	"github.com/gaurav/watchingcat/internal/collector/pipeline"
+	"github.com/gaurav/watchingcat/internal/collector/processors"
+	"github.com/gaurav/watchingcat/internal/collector/scrape"
+	"github.com/gaurav/watchingcat/internal/collector/syslog"
+	"github.com/gaurav/watchingcat/internal/collector/zipkin"
+	"github.com/gaurav/watchingcat/internal/config"
+)
+
+var (
+	allSignals   = []pipeline.Signal{pipeline.Traces, pipeline.Metrics, pipeline.Logs}
+	traces       = []pipeline.Signal{pipeline.Traces}
+	metrics      = []pipeline.Signal{pipeline.Metrics}
+	logs         = []pipeline.Signal{pipeline.Logs}
+	tracesOrLogs = []pipeline.Signal{pipeline.Traces, pipeline.Logs}
+)
+
+// Registry returns a registry of the built-in components. Processors are
+// registered in the order default pipelines apply them.
+func Registry() *pipeline.Registry {
+	r := pipeline.NewRegistry()
+
+	r.RegisterReceiver("otlp", pipeline.ReceiverFactory{
+		Signals: allSignals,
+		Create:  createOTLPReceiver,
+	})
+	r.RegisterReceiver("zipkin", pipeline.ReceiverFactory{
+		Signals: traces,
+		Create:  createZipkinReceiver,
+	})
+	r.RegisterReceiver("prometheus", pipeline.ReceiverFactory{
+		Signals: metrics,
+		Create:  createPrometheusReceiver,
+	})
+	r.RegisterReceiver("hostmetrics", pipeline.ReceiverFactory{
+		Signals: metrics,
+		Create:  createHostMetricsReceiver,
+	})
+	r.RegisterReceiver("syslog", pipeline.ReceiverFactory{
+		Signals: logs,
+		Create:  createSyslogReceiver,
+	})
+	r.RegisterReceiver("filelog", pipeline.ReceiverFactory{
+		Signals: logs,
+		Create:  createFileLogReceiver,
+	})
+
+	// Redaction runs first so sensitive values never reach other processors
+	r.RegisterProcessor("redaction", pipeline.ProcessorFactory{
+		Signals: tracesOrLogs,
+		Create:  createRedactor,
+	})
+	r.RegisterProcessor("exceptions", pipeline.ProcessorFactory{
+		Signals: traces,
+		Emits:   []pipeline.Signal{pipeline.Exceptions},
+		Create:  createExceptionExtractor,
+	})
+	r.RegisterProcessor("attributes", pipeline.ProcessorFactory{
+		Signals: allSignals,
+		Create:  createAttributesProcessor,
+	})
+	r.RegisterProcessor("filter", pipeline.ProcessorFactory{
+		Signals: allSignals,
+		Create:  createFilter,
+	})
+	// Connectors are registered before sampling so derived metrics count
+	// every span
+	r.RegisterConnector("spanmetrics", pipeline.ConnectorFactory{
+		From:   pipeline.Traces,
+		To:     pipeline.Metrics,
+		Create: createSpanMetrics,
+	})
+	r.RegisterConnector("servicegraph", pipeline.ConnectorFactory{
+		From:   pipeline.Traces,
+		To:     pipeline.Metrics,
+		Create: createServiceGraph,
+	})
+	r.RegisterProcessor("tail_sampling", pipeline.ProcessorFactory{
+		Signals: traces,
+		Create:  createTailSampler,
+	})
+
+	// jaeger is an OTLP trace exporter pointed at Jaeger's OTLP receiver
+	r.RegisterExporter("jaeger", pipeline.ExporterFactory{
+		Signals: traces,
+		Create:  createOTLPTraceExporter,
+	})
+	r.RegisterExporter("otlp", pipeline.ExporterFactory{
+		Signals: traces,
+		Create:  createOTLPTraceExporter,
+	})
+	r.RegisterExporter("prometheus", pipeline.ExporterFactory{
+		Signals: metrics,
+		Create:  createPrometheusExporter,
+	})
+	r.RegisterExporter("elasticsearch", pipeline.ExporterFactory{
+		Signals: []pipeline.Signal{pipeline.Logs, pipeline.Exceptions},
+		Create:  createElasticsearchExporter,
+	})
+	r.RegisterExporter("tracestore", pipeline.ExporterFactory{
+		Signals: traces,
+		Create:  createTraceStoreExporter,
+	})
+	r.RegisterExporter("metricstore", pipeline.ExporterFactory{
+		Signals: metrics,
+		Create:  createMetricStoreExporter,
+	})
+	r.RegisterExporter("logstore", pipeline.ExporterFactory{
+		Signals: []pipeline.Signal{pipeline.Logs, pipeline.Exceptions},
+		Create:  createLogStoreExporter,
+	})
+
+	return r
+}
+
+func createOTLPReceiver(set pipeline.Settings, cfg config.ComponentConfig, next pipeline.Consumer) (pipeline.Component, error) {
+	var c config.OTLPReceiverConfig
+	if err := cfg.Decode(&c); err != nil {
+		return nil, err
+	}
+	if c.GRPC.Endpoint == "" {
+		c.GRPC = set.Config.Collector.GRPC
+	}
+	if c.HTTP.Endpoint == "" {
+		c.HTTP = set.Config.Collector.HTTP
+	}
+	return otlp.NewReceiver(c, next, set.Logger), nil
+}
+
+func createZipkinReceiver(set pipeline.Settings, cfg config.ComponentConfig, next pipeline.Consumer) (pipeline.Component, error) {
+	c := config.ZipkinReceiverConfig{Endpoint: "0.0.0.0:9411"}
+	if err := cfg.Decode(&c); err != nil {
+		return nil, err
+	}
+	return zipkin.NewReceiver(c, next, set.Logger), nil
+}
+
+func createPrometheusReceiver(set pipeline.Settings, cfg config.ComponentConfig, next pipeline.Consumer) (pipeline.Component, error) {
+	var c config.PrometheusReceiverConfig
+	if err := cfg.Decode(&c); err != nil {
+		return nil, err
+	}
+	return scrape.NewReceiver(c, next, set.Logger)
+}
+
+func createHostMetricsReceiver(set pipeline.Settings, cfg config.ComponentConfig, next pipeline.Consumer) (pipeline.Component, error) {
+	var c config.HostMetricsReceiverConfig
+	if err := cfg.Decode(&c); err != nil {
+		return nil, err
+	}
+	return hostmetrics.NewReceiver(c, next, set.Logger)
+}
+
+func createSyslogReceiver(set pipeline.Settings, cfg config.ComponentConfig, next pipeline.Consumer) (pipeline.Component, error) {
+	c := config.SyslogReceiverConfig{Endpoint: "0.0.0.0:5514"}
+	if err := cfg.Decode(&c); err != nil {
+		return nil, err
+	}
+	return syslog.NewReceiver(c, next, set.Logger)
+}
+
+func createFileLogReceiver(set pipeline.Settings, cfg config.ComponentConfig, next pipeline.Consumer) (pipeline.Component, error) {
+	var c config.FileLogReceiverConfig
+	if err := cfg.Decode(&c); err != nil {
+		return nil, err
+	}
+	return filelog.NewReceiver(c, next, set.Logger)
+}
+
+func createRedactor(set pipeline.Settings, cfg config.ComponentConfig) (processors.Processor, error) {
+	var c config.RedactionConfig
+	if err := cfg.Decode(&c); err != nil {
+		return nil, err
+	}
+	redactor, err := processors.NewRedactor(c, set.Logger)
+	if err != nil {
+		return nil, err
+	}
+	return redactor, nil
+}
+
+func createExceptionExtractor(set pipeline.Settings, cfg config.ComponentConfig) (processors.Processor, error) {
+	return processors.NewExceptionExtractor(set.Logger), nil
+}
+
+func createAttributesProcessor(set pipeline.Settings, cfg config.ComponentConfig) (processors.Processor, error) {
+	var c config.AttributesConfig
+	if err := cfg.Decode(&c); err != nil {
+		return nil, err
+	}
+	attributes, err := processors.NewAttributesProcessor(c, set.Logger)
+	if err != nil {
+		return nil, err
+	}
+	return attributes, nil
+}
+
+func createFilter(set pipeline.Settings, cfg config.ComponentConfig) (processors.Processor, error) {
+	var c config.FilterConfig
+	if err := cfg.Decode(&c); err != nil {
+		return nil, err
+	}
+	filter, err := processors.NewFilter(c, set.Logger)
+	if err != nil {
+		return nil, err
+	}
+	return filter, nil
+}
+
+func createSpanMetrics(set pipeline.Settings, cfg config.ComponentConfig, next pipeline.Consumer) (exporters.Exporter, error) {
+	var c config.SpanMetricsConfig
+	if err := cfg.Decode(&c); err != nil {
+		return nil, err
+	}
+	buckets := set.Config.Metrics.HistogramBuckets(c.Histogram)
+	return processors.NewSpanMetrics(c, buckets, next, set.Logger), nil
+}
+
+func createServiceGraph(set pipeline.Settings, cfg config.ComponentConfig, next pipeline.Consumer) (exporters.Exporter, error) {
+	var c config.ServiceGraphConfig
+	if err := cfg.Decode(&c); err != nil {
+		return nil, err
+	}
+	buckets := set.Config.Metrics.HistogramBuckets(c.Histogram)
+	return processors.NewServiceGraph(c, buckets, next, set.Logger), nil
+}
+
+func createTailSampler(set pipeline.Settings, cfg config.ComponentConfig) (processors.Processor, error) {
+	var c config.TailSamplingConfig
+	if err := cfg.Decode(&c); err != nil {
+		return nil, err
+	}
+	sampler, err := processors.NewTailSampler(c, set.Logger)
+	if err != nil {
+		return nil, err
+	}
+	return sampler, nil
+}
+
+func createOTLPTraceExporter(set pipeline.Settings, cfg config.ComponentConfig) (exporters.Exporter, error) {
+	var c config.ExporterConfig
+	if err := cfg.Decode(&c); err != nil {
+		return nil, err
+	}
+	exporter, err := exporters.NewOTLPTraceExporter(c, set.Logger)
+	if err != nil {
+		return nil, err
+	}
+	return exporter, nil
+}
+
+func createPrometheusExporter(set pipeline.Settings, cfg config.ComponentConfig) (exporters.Exporter, error) {
+	var c config.ExporterConfig
+	if err := cfg.Decode(&c); err != nil {
+		return nil, err
+	}
+	return exporters.NewPrometheusExporter(c, set.Logger), nil
+}
+
+func createElasticsearchExporter(set pipeline.Settings, cfg config.ComponentConfig) (exporters.Exporter, error) {
+	var c config.ExporterConfig
+	if err := cfg.Decode(&c); err != nil {
+		return nil, err
+	}
+	exporter, err := exporters.NewElasticsearchExporter(c, set.Logger)
+	if err != nil {
+		return nil, err
+	}
+	return exporter, nil
+}
+
+func createTraceStoreExporter(set pipeline.Settings, cfg config.ComponentConfig) (exporters.Exporter, error) {
+	c := set.Config.TraceStore
+	if err := cfg.Decode(&c); err != nil {
+		return nil, err
+	}
+	exporter, err := exporters.NewTraceStoreExporter(c, set.Logger)
+	if err != nil {
+		return nil, err
+	}
+	return exporter, nil
+}
+
+func createMetricStoreExporter(set pipeline.Settings, cfg config.ComponentConfig) (exporters.Exporter, error) {
+	c := set.Config.MetricStore
+	if err := cfg.Decode(&c); err != nil {
+		return nil, err
+	}
+	var ec config.ExporterConfig
+	if err := cfg.Decode(&ec); err != nil {
+		return nil, err
+	}
+	exporter, err := exporters.NewMetricStoreExporter(c, ec.Namespace, set.Logger)
+	if err != nil {
+		return nil, err
+	}
+	return exporter, nil
+}
+
+func createLogStoreExporter(set pipeline.Settings, cfg config.ComponentConfig) (exporters.Exporter, error) {
+	c := set.Config.LogStore
+	if err := cfg.Decode(&c); err != nil {
+		return nil, err
+	}
+	exporter, err := exporters.NewLogStoreExporter(c, set.Logger)
+	if err != nil {
+		return nil, err
+	}
+	return exporter, nil
+}
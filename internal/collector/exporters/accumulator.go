@@ -0,0 +1,113 @@
+package exporters
+
+import (
+	"sync"
+	"time"
+
+	"github.com/gaurav/watchingcat/pkg/models"
+)
+
+// accumulator turns delta points into running totals, since Prometheus
+// expects counters and histograms to only go up. A series not updated
+// within the expiry is forgotten and restarts from zero.
+type accumulator struct {
+	expiry time.Duration
+
+	mu     sync.Mutex
+	totals map[string]*runningTotal
+	swept  time.Time
+}
+
+// runningTotal is the sum of a series' delta points so far
+type runningTotal struct {
+	value     float64
+	histogram *models.HistogramData
+	updated   time.Time
+}
+
+func newAccumulator(expiry time.Duration) *accumulator {
+	return &accumulator{expiry: expiry, totals: make(map[string]*runningTotal)}
+}
+
+// cumulative returns the metrics with every delta point replaced by its
+// series' running total. Cumulative points are returned as they are.
+func (a *accumulator) cumulative(metrics []models.Metric) []models.Metric {
+	now := time.Now()
+	out := make([]models.Metric, len(metrics))
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	for i, metric := range metrics {
+		out[i] = metric
+		if metric.Temporality != models.TemporalityDelta {
+			continue
+		}
+
+		s := toSeries("", metric)
+		key := seriesKey(s.name, s.labels)
+		total := a.totals[key]
+		if total == nil {
+			total = &runningTotal{}
+			a.totals[key] = total
+		}
+		total.updated = now
+
+		if metric.Histogram != nil {
+			total.histogram = addHistogram(total.histogram, metric.Histogram)
+			out[i].Histogram = copyHistogram(total.histogram)
+			out[i].Value = total.histogram.Sum
+		} else {
+			total.value += metric.Value
+			out[i].Value = total.value
+		}
+		out[i].Temporality = ""
+	}
+
+	if now.Sub(a.swept) >= a.expiry {
+		a.swept = now
+		cutoff := now.Add(-a.expiry)
+		for key, total := range a.totals {
+			if total.updated.Before(cutoff) {
+				delete(a.totals, key)
+			}
+		}
+	}
+
+	return out
+}
+
+// addHistogram adds a delta histogram to a running total. A change of
+// bounds restarts the total.
+func addHistogram(total, delta *models.HistogramData) *models.HistogramData {
+	if total == nil || !sameBounds(total.Bounds, delta.Bounds) || len(total.Buckets) != len(delta.Buckets) {
+		return copyHistogram(delta)
+	}
+	total.Count += delta.Count
+	total.Sum += delta.Sum
+	for i, c := range delta.Buckets {
+		total.Buckets[i] += c
+	}
+	return total
+}
+
+func sameBounds(a, b []float64) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func copyHistogram(h *models.HistogramData) *models.HistogramData {
+	return &models.HistogramData{
+		Count:   h.Count,
+		Sum:     h.Sum,
+		Bounds:  append([]float64(nil), h.Bounds...),
+		Buckets: append([]uint64(nil), h.Buckets...),
+	}
+}
@@ -0,0 +1,297 @@
+package exporters
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	elasticsearch "github.com/elastic/go-elasticsearch/v8"
+	"github.com/gaurav/watchingcat/internal/config"
+	"github.com/gaurav/watchingcat/internal/dao"
+	"github.com/gaurav/watchingcat/pkg/models"
+	"go.uber.org/zap"
+)
+
+// esTimestampLayout matches the layout dao.ElasticsearchDAO uses in range queries
+const esTimestampLayout = "2006-01-02T15:04:05.000Z"
+
+// ElasticsearchExporter bulk-indexes logs and exceptions into Elasticsearch.
+// Logs go to <prefix>-YYYY.MM.DD and exceptions to <prefix>-exceptions-YYYY.MM.DD,
+// both using the dao.LogEntry document shape the backend searches.
+type ElasticsearchExporter struct {
+	client      *elasticsearch.Client
+	indexPrefix string
+	maxRetries  int
+	backoff     time.Duration
+	logger      *zap.Logger
+
+	indexed atomic.Uint64
+	failed  atomic.Uint64
+}
+
+// ElasticsearchStats holds indexing counters
+type ElasticsearchStats struct {
+	Indexed uint64
+	Failed  uint64
+}
+
+// bulkItem is a single document waiting to be indexed
+type bulkItem struct {
+	index string
+	doc   []byte
+}
+
+// bulkResponse is the subset of the _bulk response we inspect
+type bulkResponse struct {
+	Errors bool `json:"errors"`
+	Items  []map[string]struct {
+		Status int `json:"status"`
+		Error  struct {
+			Type   string `json:"type"`
+			Reason string `json:"reason"`
+		} `json:"error"`
+	} `json:"items"`
+}
+
+// NewElasticsearchExporter creates a new Elasticsearch exporter
+func NewElasticsearchExporter(cfg config.ExporterConfig, logger *zap.Logger) (*ElasticsearchExporter, error) {
+	addresses := cfg.Endpoints
+	if len(addresses) == 0 && cfg.Endpoint != "" {
+		addresses = []string{cfg.Endpoint}
+	}
+
+	client, err := elasticsearch.NewClient(elasticsearch.Config{
+		Addresses: addresses,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create elasticsearch client: %w", err)
+	}
+
+	indexPrefix := cfg.IndexPrefix
+	if indexPrefix == "" {
+		indexPrefix = "otel-logs"
+	}
+
+	maxRetries := cfg.MaxRetries
+	if maxRetries <= 0 {
+		maxRetries = 3
+	}
+
+	return &ElasticsearchExporter{
+		client:      client,
+		indexPrefix: indexPrefix,
+		maxRetries:  maxRetries,
+		backoff:     200 * time.Millisecond,
+		logger:      logger,
+	}, nil
+}
+
+// Export indexes the batch's logs and exceptions
+func (e *ElasticsearchExporter) Export(ctx context.Context, batch models.TelemetryBatch) error {
+	items := make([]bulkItem, 0, len(batch.Logs)+len(batch.Exceptions))
+
+	for _, log := range batch.Logs {
+		item, err := e.newItem(e.indexName("", log.Timestamp), logEntryFromLog(log))
+		if err != nil {
+			return err
+		}
+		items = append(items, item)
+	}
+
+	for _, exc := range batch.Exceptions {
+		item, err := e.newItem(e.indexName("exceptions", exc.Timestamp), logEntryFromException(exc))
+		if err != nil {
+			return err
+		}
+		items = append(items, item)
+	}
+
+	if len(items) == 0 {
+		return nil
+	}
+
+	return e.bulk(ctx, items)
+}
+
+// Stats returns the number of documents indexed and failed so far
+func (e *ElasticsearchExporter) Stats() ElasticsearchStats {
+	return ElasticsearchStats{
+		Indexed: e.indexed.Load(),
+		Failed:  e.failed.Load(),
+	}
+}
+
+// bulk sends items through the _bulk API, retrying only the items that
+// failed with a retryable status
+func (e *ElasticsearchExporter) bulk(ctx context.Context, items []bulkItem) error {
+	pending := items
+
+	for attempt := 0; len(pending) > 0; attempt++ {
+		if attempt > 0 {
+			if attempt > e.maxRetries {
+				e.failed.Add(uint64(len(pending)))
+				return fmt.Errorf("%d documents failed after %d retries", len(pending), e.maxRetries)
+			}
+
+			select {
+			case <-ctx.Done():
+				e.failed.Add(uint64(len(pending)))
+				return ctx.Err()
+			case <-time.After(e.backoff << (attempt - 1)):
+			}
+		}
+
+		retry, err := e.send(ctx, pending)
+		if err != nil {
+			e.logger.Warn("Elasticsearch bulk request failed",
+				zap.Int("attempt", attempt+1),
+				zap.Int("documents", len(pending)),
+				zap.Error(err),
+			)
+			continue
+		}
+		pending = retry
+	}
+
+	return nil
+}
+
+// send performs one _bulk request and returns the items that should be retried
+func (e *ElasticsearchExporter) send(ctx context.Context, items []bulkItem) ([]bulkItem, error) {
+	var body bytes.Buffer
+	for _, item := range items {
+		fmt.Fprintf(&body, `{"index":{"_index":%q}}`+"\n", item.index)
+		body.Write(item.doc)
+		body.WriteByte('\n')
+	}
+
+	res, err := e.client.Bulk(bytes.NewReader(body.Bytes()), e.client.Bulk.WithContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	if res.IsError() {
+		return nil, fmt.Errorf("bulk request returned %s", res.Status())
+	}
+
+	var result bulkResponse
+	if err := json.NewDecoder(res.Body).Decode(&result); err != nil {
+		return nil, fmt.Errorf("failed to decode bulk response: %w", err)
+	}
+
+	if len(result.Items) != len(items) {
+		return nil, fmt.Errorf("bulk response has %d items, expected %d", len(result.Items), len(items))
+	}
+
+	var retry []bulkItem
+	for i, entry := range result.Items {
+		for _, status := range entry {
+			switch {
+			case status.Status >= 200 && status.Status < 300:
+				e.indexed.Add(1)
+			case isRetryableStatus(status.Status):
+				retry = append(retry, items[i])
+			default:
+				e.failed.Add(1)
+				e.logger.Warn("Elasticsearch rejected document",
+					zap.String("index", items[i].index),
+					zap.Int("status", status.Status),
+					zap.String("error_type", status.Error.Type),
+					zap.String("reason", status.Error.Reason),
+				)
+			}
+		}
+	}
+
+	return retry, nil
+}
+
+// newItem encodes a document for the given index
+func (e *ElasticsearchExporter) newItem(index string, entry dao.LogEntry) (bulkItem, error) {
+	doc, err := json.Marshal(entry)
+	if err != nil {
+		return bulkItem{}, fmt.Errorf("failed to encode document: %w", err)
+	}
+	return bulkItem{index: index, doc: doc}, nil
+}
+
+// indexName returns the date-suffixed index for a document
+func (e *ElasticsearchExporter) indexName(kind string, ts time.Time) string {
+	if ts.IsZero() {
+		ts = time.Now()
+	}
+	date := ts.UTC().Format("2006.01.02")
+	if kind == "" {
+		return fmt.Sprintf("%s-%s", e.indexPrefix, date)
+	}
+	return fmt.Sprintf("%s-%s-%s", e.indexPrefix, kind, date)
+}
+
+// logEntryFromLog maps a log record onto the document shape the backend queries
+func logEntryFromLog(log models.LogRecord) dao.LogEntry {
+	return dao.LogEntry{
+		Timestamp:  formatTimestamp(log.Timestamp),
+		Level:      log.Severity,
+		Message:    log.Message,
+		Service:    log.ServiceName,
+		TraceID:    log.TraceID,
+		SpanID:     log.SpanID,
+		Attributes: stringAttributes(log.Attributes),
+	}
+}
+
+// logEntryFromException maps an exception onto the log document shape so
+// exceptions show up in log searches by trace ID
+func logEntryFromException(exc models.ExceptionRecord) dao.LogEntry {
+	attrs := stringAttributes(exc.Tags)
+	if attrs == nil {
+		attrs = make(map[string]interface{})
+	}
+	attrs["exception.id"] = exc.ID
+	attrs["exception.type"] = exc.Type
+	attrs["exception.stacktrace"] = exc.StackTrace
+
+	level := exc.Severity
+	if level == "" {
+		level = "error"
+	}
+
+	return dao.LogEntry{
+		Timestamp:  formatTimestamp(exc.Timestamp),
+		Level:      level,
+		Message:    exc.Message,
+		Service:    exc.ServiceName,
+		TraceID:    exc.TraceID,
+		SpanID:     exc.SpanID,
+		Attributes: attrs,
+	}
+}
+
+// formatTimestamp formats a time in UTC with millisecond precision
+func formatTimestamp(ts time.Time) string {
+	if ts.IsZero() {
+		ts = time.Now()
+	}
+	return ts.UTC().Format(esTimestampLayout)
+}
+
+// stringAttributes converts string attributes into a document field map
+func stringAttributes(attrs map[string]string) map[string]interface{} {
+	if len(attrs) == 0 {
+		return nil
+	}
+	result := make(map[string]interface{}, len(attrs))
+	for k, v := range attrs {
+		result[k] = v
+	}
+	return result
+}
+
+// isRetryableStatus reports whether an item-level status is worth retrying
+func isRetryableStatus(status int) bool {
+	return status == 429 || status == 502 || status == 503 || status == 504
+}
@@ -0,0 +1,176 @@
+package exporters
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gaurav/watchingcat/internal/config"
+	"github.com/gaurav/watchingcat/pkg/models"
+	"go.uber.org/zap"
+)
+
+// fakeBulkServer answers _bulk requests using respond to pick each item's status
+type fakeBulkServer struct {
+	mu       sync.Mutex
+	requests int
+	indices  []string
+	docs     []map[string]interface{}
+	respond  func(request, item int) int
+}
+
+func (f *fakeBulkServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	w.Header().Set("X-Elastic-Product", "Elasticsearch")
+	w.Header().Set("Content-Type", "application/json")
+
+	var items []map[string]interface{}
+	scanner := bufio.NewScanner(r.Body)
+	for i := 0; scanner.Scan(); i++ {
+		var line map[string]interface{}
+		json.Unmarshal(scanner.Bytes(), &line)
+		if i%2 == 0 {
+			action := line["index"].(map[string]interface{})
+			f.indices = append(f.indices, action["_index"].(string))
+			continue
+		}
+		f.docs = append(f.docs, line)
+
+		status := f.respond(f.requests, len(items))
+		items = append(items, map[string]interface{}{
+			"index": map[string]interface{}{"status": status},
+		})
+	}
+	f.requests++
+
+	json.NewEncoder(w).Encode(map[string]interface{}{"errors": false, "items": items})
+}
+
+func newTestExporter(t *testing.T, server *fakeBulkServer) *ElasticsearchExporter {
+	ts := httptest.NewServer(server)
+	t.Cleanup(ts.Close)
+
+	exporter, err := NewElasticsearchExporter(config.ExporterConfig{
+		Endpoints:   []string{ts.URL},
+		IndexPrefix: "otel-logs",
+		MaxRetries:  2,
+	}, zap.NewNop())
+	if err != nil {
+		t.Fatalf("Failed to create exporter: %v", err)
+	}
+	exporter.backoff = time.Millisecond
+	return exporter
+}
+
+func TestElasticsearchExportDocumentShape(t *testing.T) {
+	server := &fakeBulkServer{respond: func(request, item int) int { return 201 }}
+	exporter := newTestExporter(t, server)
+
+	ts := time.Date(2024, 3, 15, 10, 30, 0, 0, time.UTC)
+	err := exporter.Export(context.Background(), models.TelemetryBatch{
+		Logs: []models.LogRecord{{
+			Timestamp:   ts,
+			TraceID:     "abc123",
+			Severity:    "error",
+			Message:     "payment failed",
+			ServiceName: "checkoutservice",
+		}},
+		Exceptions: []models.ExceptionRecord{{
+			ID:          "exc_1",
+			Type:        "*errors.errorString",
+			Message:     "card declined",
+			Timestamp:   ts,
+			ServiceName: "checkoutservice",
+		}},
+	})
+	if err != nil {
+		t.Fatalf("Export failed: %v", err)
+	}
+
+	if len(server.indices) != 2 {
+		t.Fatalf("Expected 2 documents, got %d", len(server.indices))
+	}
+	if server.indices[0] != "otel-logs-2024.03.15" {
+		t.Errorf("Unexpected log index %s", server.indices[0])
+	}
+	if server.indices[1] != "otel-logs-exceptions-2024.03.15" {
+		t.Errorf("Unexpected exception index %s", server.indices[1])
+	}
+
+	doc := server.docs[0]
+	for field, want := range map[string]string{
+		"timestamp": "2024-03-15T10:30:00.000Z",
+		"level":     "error",
+		"service":   "checkoutservice",
+		"trace_id":  "abc123",
+	} {
+		if doc[field] != want {
+			t.Errorf("Expected %s=%q, got %v", field, want, doc[field])
+		}
+	}
+
+	if stats := exporter.Stats(); stats.Indexed != 2 || stats.Failed != 0 {
+		t.Errorf("Unexpected stats %+v", stats)
+	}
+}
+
+func TestElasticsearchExportRetriesFailedItems(t *testing.T) {
+	server := &fakeBulkServer{respond: func(request, item int) int {
+		// The second document is throttled on the first attempt and the
+		// third is rejected permanently
+		if request == 0 && item == 1 {
+			return 429
+		}
+		if request == 0 && item == 2 {
+			return 400
+		}
+		return 201
+	}}
+	exporter := newTestExporter(t, server)
+
+	logs := make([]models.LogRecord, 3)
+	for i := range logs {
+		logs[i] = models.LogRecord{Timestamp: time.Now(), Message: strings.Repeat("x", i+1)}
+	}
+
+	if err := exporter.Export(context.Background(), models.TelemetryBatch{Logs: logs}); err != nil {
+		t.Fatalf("Export failed: %v", err)
+	}
+
+	if server.requests != 2 {
+		t.Errorf("Expected 2 bulk requests, got %d", server.requests)
+	}
+	if server.docs[len(server.docs)-1]["message"] != "xx" {
+		t.Error("Expected only the throttled document to be retried")
+	}
+	if stats := exporter.Stats(); stats.Indexed != 2 || stats.Failed != 1 {
+		t.Errorf("Expected 2 indexed and 1 failed, got %+v", stats)
+	}
+}
+
+func TestElasticsearchExportGivesUpAfterMaxRetries(t *testing.T) {
+	server := &fakeBulkServer{respond: func(request, item int) int { return 503 }}
+	exporter := newTestExporter(t, server)
+
+	err := exporter.Export(context.Background(), models.TelemetryBatch{
+		Logs: []models.LogRecord{{Message: "unavailable"}},
+	})
+	if err == nil {
+		t.Fatal("Expected error after exhausting retries")
+	}
+
+	if server.requests != 3 {
+		t.Errorf("Expected 3 attempts, got %d", server.requests)
+	}
+	if stats := exporter.Stats(); stats.Failed != 1 {
+		t.Errorf("Expected 1 failed document, got %+v", stats)
+	}
+}
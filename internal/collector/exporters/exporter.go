@@ -0,0 +1,12 @@
+package exporters
+
+import (
+	"context"
+
+	"github.com/gaurav/watchingcat/pkg/models"
+)
+
+// Exporter sends a batch of telemetry to a backend
+type Exporter interface {
+	Export(ctx context.Context, batch models.TelemetryBatch) error
+}
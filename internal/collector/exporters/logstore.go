@@ -0,0 +1,105 @@
+package exporters
+
+import (
+	"context"
+	"errors"
+	"sync"
+
+	"github.com/gaurav/watchingcat/internal/config"
+	"github.com/gaurav/watchingcat/internal/logstore"
+	"github.com/gaurav/watchingcat/pkg/models"
+	"go.uber.org/zap"
+)
+
+// LogStoreExporter writes logs and exceptions into the embedded log store,
+// which the backend can search instead of Elasticsearch. Exceptions are
+// stored as log records, as the Elasticsearch exporter indexes them, so
+// they show up in searches by trace ID. The store is opened on Start and
+// closed on Shutdown, so a reload can hand its directory to a new exporter.
+type LogStoreExporter struct {
+	cfg    config.LogStoreConfig
+	logger *zap.Logger
+
+	mu    sync.RWMutex
+	store *logstore.Store
+}
+
+// NewLogStoreExporter creates a log store exporter
+func NewLogStoreExporter(cfg config.LogStoreConfig, logger *zap.Logger) (*LogStoreExporter, error) {
+	if cfg.Directory == "" {
+		return nil, errors.New("log store exporter requires a directory")
+	}
+	return &LogStoreExporter{cfg: cfg, logger: logger}, nil
+}
+
+// Start opens the store, recovering records logged by a previous run
+func (e *LogStoreExporter) Start(ctx context.Context) error {
+	store, err := logstore.Open(e.cfg, e.logger)
+	if err != nil {
+		return err
+	}
+
+	e.mu.Lock()
+	e.store = store
+	e.mu.Unlock()
+	return nil
+}
+
+// Shutdown closes the store
+func (e *LogStoreExporter) Shutdown(ctx context.Context) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.store == nil {
+		return nil
+	}
+	err := e.store.Close()
+	e.store = nil
+	return err
+}
+
+// Export writes the batch's logs and exceptions to the store
+func (e *LogStoreExporter) Export(ctx context.Context, batch models.TelemetryBatch) error {
+	if len(batch.Logs) == 0 && len(batch.Exceptions) == 0 {
+		return nil
+	}
+
+	logs := make([]models.LogRecord, 0, len(batch.Logs)+len(batch.Exceptions))
+	logs = append(logs, batch.Logs...)
+	for _, exc := range batch.Exceptions {
+		logs = append(logs, logRecordFromException(exc))
+	}
+
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	if e.store == nil {
+		return errors.New("log store is not open")
+	}
+	return e.store.Write(logs)
+}
+
+// logRecordFromException maps an exception onto a log record with the same
+// fields logEntryFromException gives its document
+func logRecordFromException(exc models.ExceptionRecord) models.LogRecord {
+	attrs := make(map[string]string, len(exc.Tags)+3)
+	for k, v := range exc.Tags {
+		attrs[k] = v
+	}
+	attrs["exception.id"] = exc.ID
+	attrs["exception.type"] = exc.Type
+	attrs["exception.stacktrace"] = exc.StackTrace
+
+	level := exc.Severity
+	if level == "" {
+		level = "error"
+	}
+
+	return models.LogRecord{
+		Timestamp:   exc.Timestamp,
+		TraceID:     exc.TraceID,
+		SpanID:      exc.SpanID,
+		Severity:    level,
+		Message:     exc.Message,
+		Attributes:  attrs,
+		ServiceName: exc.ServiceName,
+	}
+}
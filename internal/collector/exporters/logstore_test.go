@@ -0,0 +1,61 @@
+package exporters
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/gaurav/watchingcat/internal/config"
+	"github.com/gaurav/watchingcat/internal/logstore"
+	"github.com/gaurav/watchingcat/pkg/models"
+	"go.uber.org/zap"
+)
+
+func TestLogStoreExporter(t *testing.T) {
+	cfg := config.LogStoreConfig{Directory: t.TempDir()}
+	exporter, err := NewLogStoreExporter(cfg, zap.NewNop())
+	if err != nil {
+		t.Fatalf("NewLogStoreExporter failed: %v", err)
+	}
+	ctx := context.Background()
+
+	now := time.Now()
+	batch := models.TelemetryBatch{
+		Logs: []models.LogRecord{{Timestamp: now, Severity: "INFO", Message: "Order placed", TraceID: "abc", ServiceName: "web"}},
+		Exceptions: []models.ExceptionRecord{{
+			ID: "exc_1", Type: "ValueError", Message: "bad order", Timestamp: now,
+			TraceID: "abc", StackTrace: "at checkout()", ServiceName: "web",
+		}},
+	}
+
+	if err := exporter.Export(ctx, batch); err == nil {
+		t.Error("Expected exports before Start to fail")
+	}
+	if err := exporter.Start(ctx); err != nil {
+		t.Fatalf("Start failed: %v", err)
+	}
+	if err := exporter.Export(ctx, batch); err != nil {
+		t.Fatalf("Export failed: %v", err)
+	}
+	if err := exporter.Shutdown(ctx); err != nil {
+		t.Fatalf("Shutdown failed: %v", err)
+	}
+
+	// The records survive the exporter and are visible to a reader
+	reader, err := logstore.OpenReader(cfg, zap.NewNop())
+	if err != nil {
+		t.Fatalf("OpenReader failed: %v", err)
+	}
+	result, err := reader.Search(logstore.Query{TraceID: "abc"})
+	if err != nil || result.Total != 2 {
+		t.Fatalf("Expected the exported log and exception, got %+v %v", result, err)
+	}
+	result, _ = reader.Search(logstore.Query{Text: "exception.type:ValueError"})
+	if result.Total != 1 || result.Records[0].Severity != "error" || result.Records[0].Attributes["exception.stacktrace"] != "at checkout()" {
+		t.Errorf("Expected the exception as an error record, got %+v", result)
+	}
+
+	if _, err := NewLogStoreExporter(config.LogStoreConfig{}, zap.NewNop()); err == nil {
+		t.Error("Expected a missing directory to be rejected")
+	}
+}
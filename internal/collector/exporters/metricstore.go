@@ -0,0 +1,94 @@
+package exporters
+
+import (
+	"context"
+	"errors"
+	"sync"
+
+	"github.com/gaurav/watchingcat/internal/config"
+	"github.com/gaurav/watchingcat/internal/metricstore"
+	"github.com/gaurav/watchingcat/pkg/models"
+	"go.uber.org/zap"
+)
+
+// MetricStoreExporter writes metrics into the embedded metric store, which
+// the backend can query instead of Prometheus. Series are named and
+// labelled as the Prometheus exporter exposes them, so the same queries
+// work against either, and delta points are likewise accumulated into
+// running totals. The store is opened on Start and closed on Shutdown,
+// so a reload can hand its directory to a new exporter.
+type MetricStoreExporter struct {
+	cfg       config.MetricStoreConfig
+	namespace string
+	totals    *accumulator
+	logger    *zap.Logger
+
+	mu    sync.RWMutex
+	store *metricstore.Store
+}
+
+// NewMetricStoreExporter creates a metric store exporter. Metric names are
+// prefixed with namespace, if set.
+func NewMetricStoreExporter(cfg config.MetricStoreConfig, namespace string, logger *zap.Logger) (*MetricStoreExporter, error) {
+	if cfg.Directory == "" {
+		return nil, errors.New("metric store exporter requires a directory")
+	}
+	return &MetricStoreExporter{
+		cfg:       cfg,
+		namespace: namespace,
+		totals:    newAccumulator(defaultSeriesExpiry),
+		logger:    logger,
+	}, nil
+}
+
+// Start opens the store, recovering samples logged by a previous run
+func (e *MetricStoreExporter) Start(ctx context.Context) error {
+	store, err := metricstore.Open(e.cfg, e.logger)
+	if err != nil {
+		return err
+	}
+
+	e.mu.Lock()
+	e.store = store
+	e.mu.Unlock()
+	return nil
+}
+
+// Shutdown closes the store
+func (e *MetricStoreExporter) Shutdown(ctx context.Context) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.store == nil {
+		return nil
+	}
+	err := e.store.Close()
+	e.store = nil
+	return err
+}
+
+// Export writes the batch's metrics to the store
+func (e *MetricStoreExporter) Export(ctx context.Context, batch models.TelemetryBatch) error {
+	if len(batch.Metrics) == 0 {
+		return nil
+	}
+
+	timeSeries := toTimeSeries(e.namespace, e.totals.cumulative(batch.Metrics))
+	series := make([]metricstore.Series, len(timeSeries))
+	for i, ts := range timeSeries {
+		labels := make(metricstore.Labels, len(ts.labels))
+		for j, l := range ts.labels {
+			labels[j] = metricstore.Label{Name: l.name, Value: l.value}
+		}
+		series[i] = metricstore.Series{
+			Labels:  labels,
+			Samples: []metricstore.Sample{{T: ts.timestamp, V: ts.value}},
+		}
+	}
+
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	if e.store == nil {
+		return errors.New("metric store is not open")
+	}
+	return e.store.Write(series)
+}
@@ -0,0 +1,61 @@
+package exporters
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/gaurav/watchingcat/internal/config"
+	"github.com/gaurav/watchingcat/internal/metricstore"
+	"github.com/gaurav/watchingcat/pkg/models"
+	"go.uber.org/zap"
+)
+
+func TestMetricStoreExporter(t *testing.T) {
+	cfg := config.MetricStoreConfig{Directory: t.TempDir()}
+	exporter, err := NewMetricStoreExporter(cfg, "app", zap.NewNop())
+	if err != nil {
+		t.Fatalf("NewMetricStoreExporter failed: %v", err)
+	}
+	ctx := context.Background()
+
+	now := time.Now()
+	batch := models.TelemetryBatch{Metrics: []models.Metric{
+		{Name: "http.requests", Type: "counter", Value: 3, Timestamp: now, ServiceName: "web"},
+		{
+			Name: "http.duration", Type: "histogram", Timestamp: now, ServiceName: "web",
+			Histogram: &models.HistogramData{Count: 4, Sum: 1.5, Bounds: []float64{0.1, 1}, Buckets: []uint64{1, 2, 1}},
+		},
+	}}
+
+	if err := exporter.Export(ctx, batch); err == nil {
+		t.Error("Expected exports before Start to fail")
+	}
+	if err := exporter.Start(ctx); err != nil {
+		t.Fatalf("Start failed: %v", err)
+	}
+	if err := exporter.Export(ctx, batch); err != nil {
+		t.Fatalf("Export failed: %v", err)
+	}
+	if err := exporter.Shutdown(ctx); err != nil {
+		t.Fatalf("Shutdown failed: %v", err)
+	}
+
+	// Series are named as the Prometheus exporter names them
+	reader, err := metricstore.OpenReader(cfg, zap.NewNop())
+	if err != nil {
+		t.Fatalf("OpenReader failed: %v", err)
+	}
+	result, err := reader.Query(`app_http_requests_total{service_name="web"}`, now)
+	if err != nil || len(result.Series) != 1 || result.Series[0].Samples[0].V != 3 {
+		t.Errorf("Expected the exported counter, got %+v %v", result, err)
+	}
+	result, err = reader.Query(`app_http_duration_bucket`, now)
+	if err != nil || len(result.Series) != 3 {
+		t.Errorf("Expected three buckets, got %+v %v", result, err)
+	}
+
+	if _, err := NewMetricStoreExporter(config.MetricStoreConfig{}, "", zap.NewNop()); err == nil {
+		t.Error("Expected a missing directory to be rejected")
+	}
+}
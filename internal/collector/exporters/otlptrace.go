@@ -0,0 +1,373 @@
+package exporters
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gaurav/watchingcat/internal/collector/otlp"
+	"github.com/gaurav/watchingcat/internal/config"
+	"github.com/gaurav/watchingcat/pkg/models"
+	collectortrace "go.opentelemetry.io/proto/otlp/collector/trace/v1"
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	defaultTraceQueueSize  = 10000
+	defaultTraceMaxRetries = 5
+	maxTraceBackoff        = 30 * time.Second
+	traceExportTimeout     = 10 * time.Second
+)
+
+// OTLPTraceExporter forwards spans to a downstream OTLP gRPC endpoint such
+// as Jaeger. Batches are queued and sent in the background; batches that
+// fail with a retryable status stay queued and are retried with exponential
+// backoff. When the queue is full the oldest batches are dropped.
+type OTLPTraceExporter struct {
+	conn       *grpc.ClientConn
+	client     collectortrace.TraceServiceClient
+	queue      *spanQueue
+	maxRetries int
+	backoff    time.Duration
+	logger     *zap.Logger
+
+	sent    atomic.Uint64
+	failed  atomic.Uint64
+	dropped atomic.Uint64
+
+	stop         chan struct{}
+	done         chan struct{}
+	shutdownOnce sync.Once
+	shutdownErr  error
+}
+
+// TraceExportStats holds span forwarding counters
+type TraceExportStats struct {
+	Sent    uint64
+	Failed  uint64
+	Dropped uint64
+	Queued  int
+}
+
+// NewOTLPTraceExporter creates a trace exporter and starts its sender
+func NewOTLPTraceExporter(cfg config.ExporterConfig, logger *zap.Logger) (*OTLPTraceExporter, error) {
+	if cfg.Endpoint == "" {
+		return nil, errors.New("trace exporter endpoint is required")
+	}
+
+	creds := credentials.NewTLS(nil)
+	if cfg.Insecure {
+		creds = insecure.NewCredentials()
+	}
+
+	conn, err := grpc.Dial(cfg.Endpoint, grpc.WithTransportCredentials(creds))
+	if err != nil {
+		return nil, fmt.Errorf("failed to dial %s: %w", cfg.Endpoint, err)
+	}
+
+	queueSize := cfg.QueueSize
+	if queueSize <= 0 {
+		queueSize = defaultTraceQueueSize
+	}
+	maxRetries := cfg.MaxRetries
+	if maxRetries <= 0 {
+		maxRetries = defaultTraceMaxRetries
+	}
+
+	e := &OTLPTraceExporter{
+		conn:       conn,
+		client:     collectortrace.NewTraceServiceClient(conn),
+		queue:      newSpanQueue(queueSize),
+		maxRetries: maxRetries,
+		backoff:    time.Second,
+		logger:     logger,
+		stop:       make(chan struct{}),
+		done:       make(chan struct{}),
+	}
+
+	go e.run()
+
+	return e, nil
+}
+
+// Export queues the batch's spans for forwarding. It only fails when spans
+// had to be dropped because the queue is full.
+func (e *OTLPTraceExporter) Export(ctx context.Context, batch models.TelemetryBatch) error {
+	return e.ExportAsync(batch, nil)
+}
+
+// ExportAsync queues the batch's spans like Export and calls done once they
+// are no longer the exporter's responsibility: delivered, permanently failed
+// or dropped from a full queue. done is not called for spans still pending
+// at shutdown, so callers can keep them for redelivery.
+func (e *OTLPTraceExporter) ExportAsync(batch models.TelemetryBatch, done func()) error {
+	if len(batch.Spans) == 0 {
+		if done != nil {
+			done()
+		}
+		return nil
+	}
+
+	if dropped := e.queue.push(queuedBatch{spans: batch.Spans, done: done}); dropped > 0 {
+		e.dropped.Add(uint64(dropped))
+		return fmt.Errorf("trace queue full: dropped %d spans", dropped)
+	}
+
+	return nil
+}
+
+// Stats returns span forwarding counters
+func (e *OTLPTraceExporter) Stats() TraceExportStats {
+	return TraceExportStats{
+		Sent:    e.sent.Load(),
+		Failed:  e.failed.Load(),
+		Dropped: e.dropped.Load(),
+		Queued:  e.queue.len(),
+	}
+}
+
+// Shutdown stops the sender, giving queued spans until ctx is done to be
+// delivered. Spans still queued afterwards are counted as dropped. Later
+// calls return the first call's result.
+func (e *OTLPTraceExporter) Shutdown(ctx context.Context) error {
+	e.shutdownOnce.Do(func() {
+		e.shutdownErr = e.shutdown(ctx)
+	})
+	return e.shutdownErr
+}
+
+func (e *OTLPTraceExporter) shutdown(ctx context.Context) error {
+	close(e.stop)
+	<-e.done
+
+	for {
+		batch, ok := e.queue.pop()
+		if !ok {
+			break
+		}
+		if ctx.Err() != nil {
+			e.dropped.Add(uint64(len(batch.spans)))
+			continue
+		}
+		if err := e.send(ctx, batch.spans); err != nil {
+			e.logger.Warn("Failed to flush spans on shutdown", zap.Error(err))
+			e.failed.Add(uint64(len(batch.spans)))
+			continue
+		}
+		batch.finish()
+	}
+
+	return e.conn.Close()
+}
+
+// run sends queued batches until the exporter is stopped
+func (e *OTLPTraceExporter) run() {
+	defer close(e.done)
+
+	for {
+		select {
+		case <-e.stop:
+			return
+		case <-e.queue.ready:
+		}
+
+		for {
+			batch, ok := e.queue.pop()
+			if !ok {
+				break
+			}
+			if !e.deliver(batch) {
+				return
+			}
+		}
+	}
+}
+
+// deliver sends one batch, retrying retryable failures with exponential
+// backoff. It returns false if the exporter was stopped while waiting, in
+// which case the batch is put back on the queue.
+func (e *OTLPTraceExporter) deliver(batch queuedBatch) bool {
+	spans := batch.spans
+	for attempt := 0; ; attempt++ {
+		err := e.send(context.Background(), spans)
+		if err == nil {
+			batch.finish()
+			return true
+		}
+
+		retryable := isRetryable(err)
+		e.logger.Warn("Trace export failed",
+			zap.Int("attempt", attempt+1),
+			zap.Int("spans", len(spans)),
+			zap.Bool("retryable", retryable),
+			zap.Error(err),
+		)
+
+		if !retryable || attempt >= e.maxRetries {
+			e.failed.Add(uint64(len(spans)))
+			batch.finish()
+			return true
+		}
+
+		backoff := e.backoff << attempt
+		if backoff > maxTraceBackoff || backoff <= 0 {
+			backoff = maxTraceBackoff
+		}
+
+		select {
+		case <-e.stop:
+			if !e.queue.requeue(batch) {
+				e.dropped.Add(uint64(len(spans)))
+				batch.finish()
+			}
+			return false
+		case <-time.After(backoff):
+		}
+	}
+}
+
+// send performs one Export call and records accepted and rejected spans
+func (e *OTLPTraceExporter) send(ctx context.Context, spans []models.Span) error {
+	ctx, cancel := context.WithTimeout(ctx, traceExportTimeout)
+	defer cancel()
+
+	resp, err := e.client.Export(ctx, &collectortrace.ExportTraceServiceRequest{
+		ResourceSpans: otlp.SpansToResourceSpans(spans),
+	})
+	if err != nil {
+		return err
+	}
+
+	rejected := resp.GetPartialSuccess().GetRejectedSpans()
+	if rejected > 0 {
+		e.logger.Warn("Downstream rejected spans",
+			zap.Int64("rejected", rejected),
+			zap.String("message", resp.GetPartialSuccess().GetErrorMessage()),
+		)
+		e.failed.Add(uint64(rejected))
+	}
+	e.sent.Add(uint64(int64(len(spans)) - rejected))
+
+	return nil
+}
+
+// isRetryable reports whether an export error is transient per the OTLP spec
+func isRetryable(err error) bool {
+	switch status.Code(err) {
+	case codes.Canceled, codes.DeadlineExceeded, codes.ResourceExhausted,
+		codes.Aborted, codes.OutOfRange, codes.Unavailable, codes.DataLoss:
+		return true
+	}
+	return false
+}
+
+// queuedBatch is a batch of spans waiting to be sent
+type queuedBatch struct {
+	spans []models.Span
+	done  func()
+}
+
+// finish reports that the batch has left the queue for good
+func (b queuedBatch) finish() {
+	if b.done != nil {
+		b.done()
+	}
+}
+
+// spanQueue is a FIFO of span batches bounded by the total number of spans
+type spanQueue struct {
+	mu       sync.Mutex
+	batches  []queuedBatch
+	spans    int
+	capacity int
+	ready    chan struct{}
+}
+
+func newSpanQueue(capacity int) *spanQueue {
+	return &spanQueue{
+		capacity: capacity,
+		ready:    make(chan struct{}, 1),
+	}
+}
+
+// push appends a batch, dropping the oldest batches to make room. A batch
+// larger than the whole queue is truncated. It returns the spans dropped.
+func (q *spanQueue) push(batch queuedBatch) int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	dropped := 0
+	if len(batch.spans) > q.capacity {
+		dropped += len(batch.spans) - q.capacity
+		batch.spans = batch.spans[len(batch.spans)-q.capacity:]
+	}
+
+	for q.spans+len(batch.spans) > q.capacity {
+		oldest := q.batches[0]
+		dropped += len(oldest.spans)
+		q.spans -= len(oldest.spans)
+		q.batches = q.batches[1:]
+		oldest.finish()
+	}
+
+	q.batches = append(q.batches, batch)
+	q.spans += len(batch.spans)
+	q.notify()
+
+	return dropped
+}
+
+// requeue puts a batch back at the head of the queue. If newer batches have
+// filled the queue in the meantime, the batch is not requeued and false is
+// returned.
+func (q *spanQueue) requeue(batch queuedBatch) bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if q.spans+len(batch.spans) > q.capacity {
+		return false
+	}
+
+	q.batches = append([]queuedBatch{batch}, q.batches...)
+	q.spans += len(batch.spans)
+	q.notify()
+
+	return true
+}
+
+// pop removes the oldest batch
+func (q *spanQueue) pop() (queuedBatch, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if len(q.batches) == 0 {
+		return queuedBatch{}, false
+	}
+
+	batch := q.batches[0]
+	q.batches = q.batches[1:]
+	q.spans -= len(batch.spans)
+
+	return batch, true
+}
+
+func (q *spanQueue) len() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.spans
+}
+
+func (q *spanQueue) notify() {
+	select {
+	case q.ready <- struct{}{}:
+	default:
+	}
+}
@@ -0,0 +1,211 @@
+package exporters
+
+import (
+	"context"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gaurav/watchingcat/internal/config"
+	"github.com/gaurav/watchingcat/pkg/models"
+	collectortrace "go.opentelemetry.io/proto/otlp/collector/trace/v1"
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// fakeTraceServer answers Export calls using respond to pick each call's error
+type fakeTraceServer struct {
+	collectortrace.UnimplementedTraceServiceServer
+
+	mu       sync.Mutex
+	requests int
+	spans    int
+	respond  func(request int) error
+}
+
+func (f *fakeTraceServer) Export(ctx context.Context, req *collectortrace.ExportTraceServiceRequest) (*collectortrace.ExportTraceServiceResponse, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	err := f.respond(f.requests)
+	f.requests++
+	if err != nil {
+		return nil, err
+	}
+
+	for _, rs := range req.GetResourceSpans() {
+		for _, ss := range rs.GetScopeSpans() {
+			f.spans += len(ss.GetSpans())
+		}
+	}
+	return &collectortrace.ExportTraceServiceResponse{}, nil
+}
+
+func (f *fakeTraceServer) received() (int, int) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.requests, f.spans
+}
+
+func newTestTraceExporter(t *testing.T, server *fakeTraceServer, queueSize int) *OTLPTraceExporter {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	grpcServer := grpc.NewServer()
+	collectortrace.RegisterTraceServiceServer(grpcServer, server)
+	go grpcServer.Serve(listener)
+	t.Cleanup(grpcServer.Stop)
+
+	exporter, err := NewOTLPTraceExporter(config.ExporterConfig{
+		Endpoint:   listener.Addr().String(),
+		Insecure:   true,
+		QueueSize:  queueSize,
+		MaxRetries: 3,
+	}, zap.NewNop())
+	if err != nil {
+		t.Fatalf("Failed to create exporter: %v", err)
+	}
+	exporter.backoff = time.Millisecond
+	return exporter
+}
+
+func testSpans(n int) []models.Span {
+	spans := make([]models.Span, n)
+	for i := range spans {
+		spans[i] = models.Span{
+			TraceID:    "0102030405060708090a0b0c0d0e0f10",
+			SpanID:     "aabbccddeeff0011",
+			Name:       "GET /",
+			Attributes: map[string]string{"service.name": "frontend"},
+		}
+	}
+	return spans
+}
+
+// waitFor polls cond until it holds or a second has passed
+func waitFor(t *testing.T, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal("Timed out waiting for condition")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestOTLPTraceExportRetriesUnavailable(t *testing.T) {
+	server := &fakeTraceServer{respond: func(request int) error {
+		if request < 2 {
+			return status.Error(codes.Unavailable, "jaeger restarting")
+		}
+		return nil
+	}}
+	exporter := newTestTraceExporter(t, server, 100)
+
+	if err := exporter.Export(context.Background(), models.TelemetryBatch{Spans: testSpans(3)}); err != nil {
+		t.Fatalf("Export failed: %v", err)
+	}
+
+	waitFor(t, func() bool { return exporter.Stats().Sent == 3 })
+
+	if requests, spans := server.received(); requests != 3 || spans != 3 {
+		t.Errorf("Expected 3 requests delivering 3 spans, got %d requests and %d spans", requests, spans)
+	}
+	if err := exporter.Shutdown(context.Background()); err != nil {
+		t.Errorf("Shutdown failed: %v", err)
+	}
+	if err := exporter.Shutdown(context.Background()); err != nil {
+		t.Errorf("Expected a second Shutdown to be a no-op, got %v", err)
+	}
+}
+
+func TestOTLPTraceExportAsyncCallsDone(t *testing.T) {
+	server := &fakeTraceServer{respond: func(request int) error { return nil }}
+	exporter := newTestTraceExporter(t, server, 100)
+	defer exporter.Shutdown(context.Background())
+
+	done := make(chan struct{})
+	if err := exporter.ExportAsync(models.TelemetryBatch{Spans: testSpans(2)}, func() { close(done) }); err != nil {
+		t.Fatalf("ExportAsync failed: %v", err)
+	}
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Expected done to be called after delivery")
+	}
+	if sent := exporter.Stats().Sent; sent != 2 {
+		t.Errorf("Expected 2 spans sent, got %d", sent)
+	}
+}
+
+func TestOTLPTraceExportDoesNotRetryPermanentErrors(t *testing.T) {
+	server := &fakeTraceServer{respond: func(request int) error {
+		return status.Error(codes.InvalidArgument, "bad span")
+	}}
+	exporter := newTestTraceExporter(t, server, 100)
+	defer exporter.Shutdown(context.Background())
+
+	exporter.Export(context.Background(), models.TelemetryBatch{Spans: testSpans(2)})
+
+	waitFor(t, func() bool { return exporter.Stats().Failed == 2 })
+
+	if requests, _ := server.received(); requests != 1 {
+		t.Errorf("Expected a single attempt, got %d", requests)
+	}
+}
+
+func TestOTLPTraceExportGivesUpAfterMaxRetries(t *testing.T) {
+	server := &fakeTraceServer{respond: func(request int) error {
+		return status.Error(codes.Unavailable, "down")
+	}}
+	exporter := newTestTraceExporter(t, server, 100)
+	defer exporter.Shutdown(context.Background())
+
+	exporter.Export(context.Background(), models.TelemetryBatch{Spans: testSpans(1)})
+
+	waitFor(t, func() bool { return exporter.Stats().Failed == 1 })
+
+	if requests, _ := server.received(); requests != 4 {
+		t.Errorf("Expected 4 attempts, got %d", requests)
+	}
+}
+
+func TestSpanQueueDropsOldest(t *testing.T) {
+	q := newSpanQueue(5)
+
+	var finished int
+	done := func() { finished++ }
+
+	if dropped := q.push(queuedBatch{spans: testSpans(3), done: done}); dropped != 0 {
+		t.Errorf("Expected no drops, got %d", dropped)
+	}
+	if dropped := q.push(queuedBatch{spans: testSpans(2)}); dropped != 0 {
+		t.Errorf("Expected no drops, got %d", dropped)
+	}
+	if dropped := q.push(queuedBatch{spans: testSpans(1)}); dropped != 3 {
+		t.Errorf("Expected the oldest batch of 3 to be dropped, got %d", dropped)
+	}
+	if finished != 1 {
+		t.Error("Expected the dropped batch to be finished")
+	}
+	if q.len() != 3 {
+		t.Errorf("Expected 3 queued spans, got %d", q.len())
+	}
+
+	if dropped := q.push(queuedBatch{spans: testSpans(8)}); dropped != 6 {
+		t.Errorf("Expected oversized batch to be truncated, got %d dropped", dropped)
+	}
+	if q.len() != 5 {
+		t.Errorf("Expected a full queue, got %d", q.len())
+	}
+
+	if q.requeue(queuedBatch{spans: testSpans(1)}) {
+		t.Error("Expected requeue into a full queue to fail")
+	}
+}
@@ -0,0 +1,380 @@
+package exporters
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gaurav/watchingcat/internal/config"
+	"github.com/gaurav/watchingcat/pkg/models"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"go.uber.org/zap"
+)
+
+// defaultSeriesExpiry is how long a series stays exposed without updates
+const defaultSeriesExpiry = 5 * time.Minute
+
+// PrometheusExporter exposes collected metrics for scraping and, when a
+// remote-write URL is configured, pushes them to Prometheus as well. Delta
+// points are accumulated into running totals, as Prometheus only
+// understands cumulative counters and histograms.
+type PrometheusExporter struct {
+	namespace   string
+	endpoint    string // /metrics scrape endpoint, served between Start and Shutdown
+	expiry      time.Duration
+	registry    *prometheus.Registry
+	remoteWrite *remoteWriteClient
+	server      *http.Server
+	logger      *zap.Logger
+
+	totals *accumulator
+
+	series map[string]*promSeries
+	mu     sync.RWMutex
+}
+
+// promSeries holds the latest value of one exposed time series
+type promSeries struct {
+	name       string
+	metricType string
+	labels     []promLabel
+	value      float64
+	histogram  *models.HistogramData
+	updated    time.Time
+}
+
+// promLabel is a sanitized label name/value pair
+type promLabel struct {
+	name  string
+	value string
+}
+
+// NewPrometheusExporter creates a new Prometheus exporter
+func NewPrometheusExporter(cfg config.ExporterConfig, logger *zap.Logger) *PrometheusExporter {
+	e := &PrometheusExporter{
+		namespace: cfg.Namespace,
+		endpoint:  cfg.Endpoint,
+		expiry:    defaultSeriesExpiry,
+		registry:  prometheus.NewRegistry(),
+		totals:    newAccumulator(defaultSeriesExpiry),
+		logger:    logger,
+		series:    make(map[string]*promSeries),
+	}
+
+	if cfg.RemoteWriteURL != "" {
+		e.remoteWrite = newRemoteWriteClient(cfg.RemoteWriteURL, cfg.MaxRetries, logger)
+	}
+
+	e.registry.MustRegister(e)
+
+	return e
+}
+
+// Handler returns the /metrics scrape handler
+func (e *PrometheusExporter) Handler() http.Handler {
+	return promhttp.HandlerFor(e.registry, promhttp.HandlerOpts{
+		ErrorHandling: promhttp.ContinueOnError,
+	})
+}
+
+// Start serves /metrics on the configured endpoint, if any
+func (e *PrometheusExporter) Start(ctx context.Context) error {
+	if e.endpoint == "" {
+		return nil
+	}
+
+	listener, err := net.Listen("tcp", e.endpoint)
+	if err != nil {
+		return fmt.Errorf("failed to listen on prometheus endpoint: %w", err)
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", e.Handler())
+	e.server = &http.Server{Handler: mux}
+
+	e.logger.Info("Prometheus exporter serving /metrics",
+		zap.String("endpoint", e.endpoint),
+	)
+
+	go func() {
+		if err := e.server.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			e.logger.Error("Metrics server error", zap.Error(err))
+		}
+	}()
+	return nil
+}
+
+// Shutdown stops serving /metrics
+func (e *PrometheusExporter) Shutdown(ctx context.Context) error {
+	if e.server == nil {
+		return nil
+	}
+	return e.server.Shutdown(ctx)
+}
+
+// Export records the batch's metrics for scraping and pushes them via remote-write
+func (e *PrometheusExporter) Export(ctx context.Context, batch models.TelemetryBatch) error {
+	if len(batch.Metrics) == 0 {
+		return nil
+	}
+
+	metrics := e.totals.cumulative(batch.Metrics)
+	now := time.Now()
+
+	e.mu.Lock()
+	for _, metric := range metrics {
+		s := toSeries(e.namespace, metric)
+		s.updated = now
+		e.series[seriesKey(s.name, s.labels)] = s
+	}
+	e.mu.Unlock()
+
+	if e.remoteWrite != nil {
+		return e.remoteWrite.write(ctx, toTimeSeries(e.namespace, metrics))
+	}
+
+	return nil
+}
+
+// Stats returns remote-write counters
+func (e *PrometheusExporter) Stats() RemoteWriteStats {
+	if e.remoteWrite == nil {
+		return RemoteWriteStats{}
+	}
+	return e.remoteWrite.stats()
+}
+
+// Describe implements prometheus.Collector. No descriptors are sent, which
+// makes this an unchecked collector since series are only known at runtime.
+func (e *PrometheusExporter) Describe(ch chan<- *prometheus.Desc) {}
+
+// Collect implements prometheus.Collector
+func (e *PrometheusExporter) Collect(ch chan<- prometheus.Metric) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	cutoff := time.Now().Add(-e.expiry)
+
+	for key, s := range e.series {
+		if s.updated.Before(cutoff) {
+			delete(e.series, key)
+			continue
+		}
+
+		names := make([]string, len(s.labels))
+		values := make([]string, len(s.labels))
+		for i, l := range s.labels {
+			names[i] = l.name
+			values[i] = l.value
+		}
+
+		desc := prometheus.NewDesc(s.name, "Collected by the WatchingCat collector", names, nil)
+
+		var (
+			metric prometheus.Metric
+			err    error
+		)
+		switch s.metricType {
+		case "counter":
+			metric, err = prometheus.NewConstMetric(desc, prometheus.CounterValue, s.value, values...)
+		case "histogram":
+			count, sum, buckets := cumulativeBuckets(s.histogram)
+			metric, err = prometheus.NewConstHistogram(desc, count, sum, buckets, values...)
+		default:
+			metric, err = prometheus.NewConstMetric(desc, prometheus.GaugeValue, s.value, values...)
+		}
+		if err != nil {
+			e.logger.Debug("Skipping invalid series",
+				zap.String("name", s.name),
+				zap.Error(err),
+			)
+			continue
+		}
+
+		ch <- metric
+	}
+}
+
+// toSeries converts a metric point into an exposed series
+func toSeries(namespace string, metric models.Metric) *promSeries {
+	metricType := metric.Type
+	if metricType == "histogram" && metric.Histogram == nil {
+		metricType = "gauge"
+	}
+
+	name := sanitizeMetricName(metric.Name)
+	if namespace != "" {
+		name = sanitizeMetricName(namespace) + "_" + name
+	}
+	if metricType == "counter" && !strings.HasSuffix(name, "_total") {
+		name += "_total"
+	}
+
+	labels := promLabels(metric)
+	if metricType == "histogram" {
+		// le is reserved for the bucket bound
+		labels = renameLabel(labels, "le", "key_le")
+	}
+
+	return &promSeries{
+		name:       name,
+		metricType: metricType,
+		labels:     labels,
+		value:      metric.Value,
+		histogram:  metric.Histogram,
+	}
+}
+
+// toTimeSeries expands metric points into remote-write series. Histograms
+// become cumulative _bucket series plus _sum and _count.
+func toTimeSeries(namespace string, metrics []models.Metric) []remoteSeries {
+	series := make([]remoteSeries, 0, len(metrics))
+
+	for _, metric := range metrics {
+		s := toSeries(namespace, metric)
+
+		ts := metric.Timestamp
+		if ts.IsZero() {
+			ts = time.Now()
+		}
+		timestamp := ts.UnixMilli()
+
+		if s.metricType != "histogram" {
+			series = append(series, newRemoteSeries(s.name, s.labels, s.value, timestamp))
+			continue
+		}
+
+		count, sum, buckets := cumulativeBuckets(s.histogram)
+		bounds := make([]float64, 0, len(buckets))
+		for bound := range buckets {
+			bounds = append(bounds, bound)
+		}
+		sort.Float64s(bounds)
+
+		for _, bound := range bounds {
+			labels := append(append([]promLabel{}, s.labels...), promLabel{name: "le", value: formatBound(bound)})
+			series = append(series, newRemoteSeries(s.name+"_bucket", labels, float64(buckets[bound]), timestamp))
+		}
+		infLabels := append(append([]promLabel{}, s.labels...), promLabel{name: "le", value: "+Inf"})
+		series = append(series,
+			newRemoteSeries(s.name+"_bucket", infLabels, float64(count), timestamp),
+			newRemoteSeries(s.name+"_sum", s.labels, sum, timestamp),
+			newRemoteSeries(s.name+"_count", s.labels, float64(count), timestamp),
+		)
+	}
+
+	return series
+}
+
+// cumulativeBuckets converts per-bucket counts into Prometheus' cumulative
+// upper-bound form. The +Inf bucket is implied by the total count.
+func cumulativeBuckets(h *models.HistogramData) (uint64, float64, map[float64]uint64) {
+	buckets := make(map[float64]uint64, len(h.Bounds))
+
+	var cumulative uint64
+	for i, bound := range h.Bounds {
+		if i < len(h.Buckets) {
+			cumulative += h.Buckets[i]
+		}
+		buckets[bound] = cumulative
+	}
+
+	count := h.Count
+	if count < cumulative {
+		count = cumulative
+	}
+
+	return count, h.Sum, buckets
+}
+
+// promLabels builds sorted, sanitized labels from a metric's attributes
+func promLabels(metric models.Metric) []promLabel {
+	byName := make(map[string]string, len(metric.Attributes)+1)
+	for k, v := range metric.Attributes {
+		byName[sanitizeLabelName(k)] = v
+	}
+	if metric.ServiceName != "" {
+		byName["service_name"] = metric.ServiceName
+	}
+
+	labels := make([]promLabel, 0, len(byName))
+	for name, value := range byName {
+		if value == "" {
+			continue
+		}
+		labels = append(labels, promLabel{name: name, value: value})
+	}
+	sort.Slice(labels, func(i, j int) bool { return labels[i].name < labels[j].name })
+
+	return labels
+}
+
+// renameLabel renames a label, keeping the labels sorted
+func renameLabel(labels []promLabel, from, to string) []promLabel {
+	renamed := false
+	for i := range labels {
+		if labels[i].name == from {
+			labels[i].name = to
+			renamed = true
+		}
+	}
+	if renamed {
+		sort.Slice(labels, func(i, j int) bool { return labels[i].name < labels[j].name })
+	}
+	return labels
+}
+
+// seriesKey identifies a series by name and labels
+func seriesKey(name string, labels []promLabel) string {
+	var b strings.Builder
+	b.WriteString(name)
+	for _, l := range labels {
+		b.WriteByte(0xff)
+		b.WriteString(l.name)
+		b.WriteByte('=')
+		b.WriteString(l.value)
+	}
+	return b.String()
+}
+
+// sanitizeMetricName replaces characters not allowed in Prometheus metric names
+func sanitizeMetricName(name string) string {
+	return sanitize(name, true)
+}
+
+// sanitizeLabelName replaces characters not allowed in Prometheus label names
+func sanitizeLabelName(name string) string {
+	name = sanitize(name, false)
+	if strings.HasPrefix(name, "__") {
+		name = "key" + name
+	}
+	return name
+}
+
+func sanitize(name string, allowColon bool) string {
+	var b strings.Builder
+	for i, r := range name {
+		valid := r == '_' ||
+			(r >= 'a' && r <= 'z') ||
+			(r >= 'A' && r <= 'Z') ||
+			(r >= '0' && r <= '9' && i > 0) ||
+			(r == ':' && allowColon)
+		if r >= '0' && r <= '9' && i == 0 {
+			b.WriteString("key_")
+			valid = true
+		}
+		if valid {
+			b.WriteRune(r)
+		} else {
+			b.WriteByte('_')
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,193 @@
+package exporters
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gaurav/watchingcat/internal/config"
+	"github.com/gaurav/watchingcat/pkg/models"
+	"github.com/golang/snappy"
+	"go.uber.org/zap"
+)
+
+func testMetrics() []models.Metric {
+	return []models.Metric{
+		{
+			Name:        "http.requests",
+			Type:        "counter",
+			Value:       42,
+			Timestamp:   time.Now(),
+			Attributes:  map[string]string{"http.method": "GET"},
+			ServiceName: "frontend",
+		},
+		{
+			Name:        "queue_depth",
+			Type:        "gauge",
+			Value:       7,
+			ServiceName: "cartservice",
+		},
+		{
+			Name:        "http_request_duration",
+			Type:        "histogram",
+			Value:       1.5,
+			ServiceName: "frontend",
+			Histogram: &models.HistogramData{
+				Count:   4,
+				Sum:     1.5,
+				Bounds:  []float64{0.1, 1},
+				Buckets: []uint64{1, 2, 1},
+			},
+		},
+	}
+}
+
+func scrape(t *testing.T, exporter *PrometheusExporter) string {
+	rec := httptest.NewRecorder()
+	exporter.Handler().ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d", rec.Code)
+	}
+	return rec.Body.String()
+}
+
+func TestPrometheusExposition(t *testing.T) {
+	exporter := NewPrometheusExporter(config.ExporterConfig{}, zap.NewNop())
+
+	if err := exporter.Export(context.Background(), models.TelemetryBatch{Metrics: testMetrics()}); err != nil {
+		t.Fatalf("Export failed: %v", err)
+	}
+
+	body := scrape(t, exporter)
+
+	for _, want := range []string{
+		"# TYPE http_requests_total counter",
+		`http_requests_total{http_method="GET",service_name="frontend"} 42`,
+		"# TYPE queue_depth gauge",
+		`queue_depth{service_name="cartservice"} 7`,
+		"# TYPE http_request_duration histogram",
+		`http_request_duration_bucket{service_name="frontend",le="0.1"} 1`,
+		`http_request_duration_bucket{service_name="frontend",le="1"} 3`,
+		`http_request_duration_bucket{service_name="frontend",le="+Inf"} 4`,
+		`http_request_duration_count{service_name="frontend"} 4`,
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("Expected exposition to contain %q\n%s", want, body)
+		}
+	}
+}
+
+func TestPrometheusSeriesExpire(t *testing.T) {
+	exporter := NewPrometheusExporter(config.ExporterConfig{}, zap.NewNop())
+	exporter.Export(context.Background(), models.TelemetryBatch{Metrics: testMetrics()[:1]})
+
+	exporter.expiry = -time.Second
+
+	if body := scrape(t, exporter); strings.Contains(body, "http_requests_total") {
+		t.Error("Expected stale series to be dropped")
+	}
+}
+
+func TestPrometheusDeltaAndLe(t *testing.T) {
+	exporter := NewPrometheusExporter(config.ExporterConfig{}, zap.NewNop())
+	delta := func(value float64, buckets ...uint64) models.TelemetryBatch {
+		return models.TelemetryBatch{Metrics: []models.Metric{
+			{Name: "jobs", Type: "counter", Value: value, Temporality: models.TemporalityDelta},
+			{
+				Name: "latency", Type: "histogram", Temporality: models.TemporalityDelta,
+				Attributes: map[string]string{"le": "user"},
+				Histogram:  &models.HistogramData{Count: 2, Sum: 1, Bounds: []float64{1}, Buckets: buckets},
+			},
+		}}
+	}
+	exporter.Export(context.Background(), delta(3, 1, 1))
+	exporter.Export(context.Background(), delta(2, 2, 0))
+
+	body := scrape(t, exporter)
+	for _, want := range []string{
+		"jobs_total 5",
+		`latency_bucket{key_le="user",le="1"} 3`,
+		`latency_count{key_le="user"} 4`,
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("Expected exposition to contain %q\n%s", want, body)
+		}
+	}
+}
+
+func TestPrometheusRemoteWrite(t *testing.T) {
+	var received []byte
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Content-Encoding") != "snappy" {
+			t.Errorf("Expected snappy encoding, got %q", r.Header.Get("Content-Encoding"))
+		}
+		if r.Header.Get("X-Prometheus-Remote-Write-Version") != "0.1.0" {
+			t.Error("Expected remote-write version header")
+		}
+		body, _ := io.ReadAll(r.Body)
+		received, _ = snappy.Decode(nil, body)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	exporter := NewPrometheusExporter(config.ExporterConfig{
+		RemoteWriteURL: server.URL,
+	}, zap.NewNop())
+
+	if err := exporter.Export(context.Background(), models.TelemetryBatch{Metrics: testMetrics()}); err != nil {
+		t.Fatalf("Export failed: %v", err)
+	}
+
+	for _, want := range []string{"__name__", "http_requests_total", "http_request_duration_bucket", "+Inf"} {
+		if !strings.Contains(string(received), want) {
+			t.Errorf("Expected write request to contain %q", want)
+		}
+	}
+
+	// counter + gauge + 3 buckets (0.1, 1, +Inf) + _sum + _count
+	if stats := exporter.Stats(); stats.SamplesSent != 7 {
+		t.Errorf("Expected 7 samples sent, got %+v", stats)
+	}
+}
+
+func TestPrometheusRemoteWriteClientError(t *testing.T) {
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		http.Error(w, "out of order sample", http.StatusBadRequest)
+	}))
+	defer server.Close()
+
+	exporter := NewPrometheusExporter(config.ExporterConfig{
+		RemoteWriteURL: server.URL,
+	}, zap.NewNop())
+
+	err := exporter.Export(context.Background(), models.TelemetryBatch{Metrics: testMetrics()[:1]})
+	if err == nil {
+		t.Fatal("Expected error for rejected write")
+	}
+	if requests != 1 {
+		t.Errorf("Expected no retry on 400, got %d requests", requests)
+	}
+}
+
+func TestSanitizeNames(t *testing.T) {
+	cases := map[string]string{
+		"http.server.duration": "http_server_duration",
+		"1xx":                  "key_1xx",
+		"ok_name:sub":          "ok_name:sub",
+	}
+	for in, want := range cases {
+		if got := sanitizeMetricName(in); got != want {
+			t.Errorf("sanitizeMetricName(%q) = %q, want %q", in, got, want)
+		}
+	}
+
+	if got := sanitizeLabelName("__reserved"); got != "key__reserved" {
+		t.Errorf("Expected reserved label prefix to be escaped, got %q", got)
+	}
+}
@@ -0,0 +1,191 @@
+package exporters
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/golang/snappy"
+	"go.uber.org/zap"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// remoteWriteClient pushes samples to a Prometheus remote-write endpoint
+type remoteWriteClient struct {
+	url        string
+	httpClient *http.Client
+	maxRetries int
+	backoff    time.Duration
+	logger     *zap.Logger
+
+	sent   atomic.Uint64
+	failed atomic.Uint64
+}
+
+// RemoteWriteStats holds remote-write sample counters
+type RemoteWriteStats struct {
+	SamplesSent   uint64
+	SamplesFailed uint64
+}
+
+// remoteSeries is one prompb.TimeSeries with a single sample
+type remoteSeries struct {
+	labels    []promLabel
+	value     float64
+	timestamp int64 // milliseconds since epoch
+}
+
+// newRemoteSeries builds a series with __name__ and sorted labels
+func newRemoteSeries(name string, labels []promLabel, value float64, timestamp int64) remoteSeries {
+	all := make([]promLabel, 0, len(labels)+1)
+	all = append(all, promLabel{name: "__name__", value: name})
+	all = append(all, labels...)
+	sort.Slice(all, func(i, j int) bool { return all[i].name < all[j].name })
+
+	return remoteSeries{labels: all, value: value, timestamp: timestamp}
+}
+
+func newRemoteWriteClient(url string, maxRetries int, logger *zap.Logger) *remoteWriteClient {
+	if maxRetries <= 0 {
+		maxRetries = 3
+	}
+	return &remoteWriteClient{
+		url: url,
+		httpClient: &http.Client{
+			Timeout: 30 * time.Second,
+		},
+		maxRetries: maxRetries,
+		backoff:    500 * time.Millisecond,
+		logger:     logger,
+	}
+}
+
+// write sends the series as a snappy-compressed WriteRequest, retrying on
+// throttling and server errors
+func (c *remoteWriteClient) write(ctx context.Context, series []remoteSeries) error {
+	if len(series) == 0 {
+		return nil
+	}
+
+	body := snappy.Encode(nil, encodeWriteRequest(series))
+
+	var lastErr error
+	for attempt := 0; attempt <= c.maxRetries; attempt++ {
+		if attempt > 0 {
+			select {
+			case <-ctx.Done():
+				c.failed.Add(uint64(len(series)))
+				return ctx.Err()
+			case <-time.After(c.backoff << (attempt - 1)):
+			}
+		}
+
+		retryable, err := c.send(ctx, body)
+		if err == nil {
+			c.sent.Add(uint64(len(series)))
+			return nil
+		}
+		lastErr = err
+
+		c.logger.Warn("Prometheus remote-write failed",
+			zap.Int("attempt", attempt+1),
+			zap.Int("samples", len(series)),
+			zap.Error(err),
+		)
+
+		if !retryable {
+			break
+		}
+	}
+
+	c.failed.Add(uint64(len(series)))
+	return fmt.Errorf("remote-write failed: %w", lastErr)
+}
+
+// send performs one remote-write request and reports whether a failure is retryable
+func (c *remoteWriteClient) send(ctx context.Context, body []byte) (bool, error) {
+	req, err := http.NewRequestWithContext(ctx, "POST", c.url, bytes.NewReader(body))
+	if err != nil {
+		return false, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/x-protobuf")
+	req.Header.Set("Content-Encoding", "snappy")
+	req.Header.Set("X-Prometheus-Remote-Write-Version", "0.1.0")
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return true, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode/100 == 2 {
+		io.Copy(io.Discard, resp.Body)
+		return false, nil
+	}
+
+	msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+	err = fmt.Errorf("remote-write endpoint returned status %d: %s", resp.StatusCode, bytes.TrimSpace(msg))
+
+	return resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500, err
+}
+
+func (c *remoteWriteClient) stats() RemoteWriteStats {
+	return RemoteWriteStats{
+		SamplesSent:   c.sent.Load(),
+		SamplesFailed: c.failed.Load(),
+	}
+}
+
+// encodeWriteRequest encodes a prometheus.WriteRequest:
+//
+//	WriteRequest { repeated TimeSeries timeseries = 1; }
+//	TimeSeries   { repeated Label labels = 1; repeated Sample samples = 2; }
+//	Label        { string name = 1; string value = 2; }
+//	Sample       { double value = 1; int64 timestamp = 2; }
+func encodeWriteRequest(series []remoteSeries) []byte {
+	var req []byte
+
+	for _, s := range series {
+		var ts []byte
+
+		for _, l := range s.labels {
+			var label []byte
+			label = protowire.AppendTag(label, 1, protowire.BytesType)
+			label = protowire.AppendString(label, l.name)
+			label = protowire.AppendTag(label, 2, protowire.BytesType)
+			label = protowire.AppendString(label, l.value)
+
+			ts = protowire.AppendTag(ts, 1, protowire.BytesType)
+			ts = protowire.AppendBytes(ts, label)
+		}
+
+		var sample []byte
+		sample = protowire.AppendTag(sample, 1, protowire.Fixed64Type)
+		sample = protowire.AppendFixed64(sample, math.Float64bits(s.value))
+		sample = protowire.AppendTag(sample, 2, protowire.VarintType)
+		sample = protowire.AppendVarint(sample, uint64(s.timestamp))
+
+		ts = protowire.AppendTag(ts, 2, protowire.BytesType)
+		ts = protowire.AppendBytes(ts, sample)
+
+		req = protowire.AppendTag(req, 1, protowire.BytesType)
+		req = protowire.AppendBytes(req, ts)
+	}
+
+	return req
+}
+
+// formatBound formats a histogram bucket bound for the le label
+func formatBound(bound float64) string {
+	if math.IsInf(bound, 1) {
+		return "+Inf"
+	}
+	return strconv.FormatFloat(bound, 'g', -1, 64)
+}
@@ -0,0 +1,70 @@
+package exporters
+
+import (
+	"context"
+	"errors"
+	"sync"
+
+	"github.com/gaurav/watchingcat/internal/config"
+	"github.com/gaurav/watchingcat/internal/tracestore"
+	"github.com/gaurav/watchingcat/pkg/models"
+	"go.uber.org/zap"
+)
+
+// TraceStoreExporter writes spans into the embedded trace store, which the
+// backend can read instead of Jaeger. The store is opened on Start and
+// closed on Shutdown, so a reload can hand its directory to a new exporter.
+type TraceStoreExporter struct {
+	cfg    config.TraceStoreConfig
+	logger *zap.Logger
+
+	mu    sync.RWMutex
+	store *tracestore.Store
+}
+
+// NewTraceStoreExporter creates a trace store exporter
+func NewTraceStoreExporter(cfg config.TraceStoreConfig, logger *zap.Logger) (*TraceStoreExporter, error) {
+	if cfg.Directory == "" {
+		return nil, errors.New("trace store exporter requires a directory")
+	}
+	return &TraceStoreExporter{cfg: cfg, logger: logger}, nil
+}
+
+// Start opens the store, recovering spans logged by a previous run
+func (e *TraceStoreExporter) Start(ctx context.Context) error {
+	store, err := tracestore.Open(e.cfg, e.logger)
+	if err != nil {
+		return err
+	}
+
+	e.mu.Lock()
+	e.store = store
+	e.mu.Unlock()
+	return nil
+}
+
+// Shutdown closes the store
+func (e *TraceStoreExporter) Shutdown(ctx context.Context) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.store == nil {
+		return nil
+	}
+	err := e.store.Close()
+	e.store = nil
+	return err
+}
+
+// Export writes the batch's spans to the store
+func (e *TraceStoreExporter) Export(ctx context.Context, batch models.TelemetryBatch) error {
+	if len(batch.Spans) == 0 {
+		return nil
+	}
+
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	if e.store == nil {
+		return errors.New("trace store is not open")
+	}
+	return e.store.Write(batch.Spans)
+}
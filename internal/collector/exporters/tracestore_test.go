@@ -0,0 +1,57 @@
+package exporters
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/gaurav/watchingcat/internal/config"
+	"github.com/gaurav/watchingcat/internal/tracestore"
+	"github.com/gaurav/watchingcat/pkg/models"
+	"go.uber.org/zap"
+)
+
+func TestTraceStoreExporter(t *testing.T) {
+	cfg := config.TraceStoreConfig{Directory: t.TempDir()}
+	exporter, err := NewTraceStoreExporter(cfg, zap.NewNop())
+	if err != nil {
+		t.Fatalf("NewTraceStoreExporter failed: %v", err)
+	}
+	ctx := context.Background()
+
+	span := models.Span{
+		TraceID:    "abc",
+		SpanID:     "1",
+		Name:       "GET /",
+		StartTime:  time.Now(),
+		EndTime:    time.Now().Add(time.Millisecond),
+		Attributes: map[string]string{"service.name": "web"},
+	}
+	batch := models.TelemetryBatch{Spans: []models.Span{span}}
+
+	if err := exporter.Export(ctx, batch); err == nil {
+		t.Error("Expected exports before Start to fail")
+	}
+	if err := exporter.Start(ctx); err != nil {
+		t.Fatalf("Start failed: %v", err)
+	}
+	if err := exporter.Export(ctx, batch); err != nil {
+		t.Fatalf("Export failed: %v", err)
+	}
+	if err := exporter.Shutdown(ctx); err != nil {
+		t.Fatalf("Shutdown failed: %v", err)
+	}
+
+	// The spans survive the exporter and are visible to a reader
+	reader, err := tracestore.OpenReader(cfg, zap.NewNop())
+	if err != nil {
+		t.Fatalf("OpenReader failed: %v", err)
+	}
+	if trace, err := reader.GetTrace("abc"); err != nil || len(trace.Spans) != 1 {
+		t.Errorf("Expected the exported span, got %+v %v", trace, err)
+	}
+
+	if _, err := NewTraceStoreExporter(config.TraceStoreConfig{}, zap.NewNop()); err == nil {
+		t.Error("Expected a missing directory to be rejected")
+	}
+}
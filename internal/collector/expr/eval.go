@@ -0,0 +1,232 @@
+package expr
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// valueKind is the type of a Value
+type valueKind int
+
+const (
+	kindNull valueKind = iota
+	kindString
+	kindNumber
+	kindBool
+	kindSeverity
+)
+
+// Value is the result of evaluating a field or literal
+type Value struct {
+	kind valueKind
+	str  string
+	num  float64
+	b    bool
+}
+
+// String returns a string value
+func String(s string) Value { return Value{kind: kindString, str: s} }
+
+// Number returns a numeric value
+func Number(n float64) Value { return Value{kind: kindNumber, num: n} }
+
+// Bool returns a boolean value
+func Bool(b bool) Value { return Value{kind: kindBool, b: b} }
+
+// Severity returns a log severity. It orders by level, so it can be compared
+// with a severity name such as "info".
+func Severity(s string) Value {
+	rank, ok := SeverityRank(s)
+	if !ok {
+		return String(s)
+	}
+	return Value{kind: kindSeverity, str: s, num: float64(rank)}
+}
+
+// SeverityRank returns the level of a severity name, from trace (0) to
+// fatal (5)
+func SeverityRank(s string) (int, bool) {
+	switch strings.ToLower(s) {
+	case "trace":
+		return 0, true
+	case "debug":
+		return 1, true
+	case "info", "information":
+		return 2, true
+	case "warn", "warning":
+		return 3, true
+	case "error":
+		return 4, true
+	case "fatal", "critical":
+		return 5, true
+	}
+	return 0, false
+}
+
+// Truthy reports whether a value counts as true on its own: a true bool, a
+// non-empty string or a non-zero number
+func (v Value) Truthy() bool {
+	switch v.kind {
+	case kindBool:
+		return v.b
+	case kindString:
+		return v.str != ""
+	case kindNumber:
+		return v.num != 0
+	case kindSeverity:
+		return true
+	}
+	return false
+}
+
+// node is an expression tree node
+type node interface {
+	eval(env Env) Value
+}
+
+type orNode struct{ left, right node }
+
+func (n *orNode) eval(env Env) Value {
+	return Bool(n.left.eval(env).Truthy() || n.right.eval(env).Truthy())
+}
+
+type andNode struct{ left, right node }
+
+func (n *andNode) eval(env Env) Value {
+	return Bool(n.left.eval(env).Truthy() && n.right.eval(env).Truthy())
+}
+
+type notNode struct{ operand node }
+
+func (n *notNode) eval(env Env) Value {
+	return Bool(!n.operand.eval(env).Truthy())
+}
+
+type literalNode struct{ value Value }
+
+func (n *literalNode) eval(env Env) Value { return n.value }
+
+type fieldNode struct{ ref Ref }
+
+func (n *fieldNode) eval(env Env) Value {
+	v, ok := env.Lookup(n.ref)
+	if !ok {
+		return Value{}
+	}
+	return v
+}
+
+type compareNode struct {
+	op          string
+	left, right node
+	pattern     *regexp.Regexp // for =~ and !~
+}
+
+func (n *compareNode) eval(env Env) Value {
+	left := n.left.eval(env)
+	if left.kind == kindNull {
+		return Bool(false)
+	}
+
+	if n.pattern != nil {
+		if left.kind != kindString && left.kind != kindSeverity {
+			return Bool(false)
+		}
+		return Bool(n.pattern.MatchString(left.str) == (n.op == "=~"))
+	}
+
+	right := n.right.eval(env)
+	if right.kind == kindNull {
+		return Bool(false)
+	}
+
+	c, ok := compare(left, right)
+	if !ok {
+		return Bool(false)
+	}
+
+	switch n.op {
+	case "==":
+		return Bool(c == 0)
+	case "!=":
+		return Bool(c != 0)
+	case "<":
+		return Bool(c < 0)
+	case "<=":
+		return Bool(c <= 0)
+	case ">":
+		return Bool(c > 0)
+	case ">=":
+		return Bool(c >= 0)
+	}
+	return Bool(false)
+}
+
+// compare orders two values, converting between kinds where it makes sense:
+// severity names compare by level, and strings holding numbers compare with
+// numbers. ok is false if the values cannot be compared.
+func compare(a, b Value) (int, bool) {
+	switch {
+	case a.kind == kindSeverity || b.kind == kindSeverity:
+		ra, okA := asSeverity(a)
+		rb, okB := asSeverity(b)
+		if !okA || !okB {
+			return 0, false
+		}
+		return compareNumbers(ra, rb), true
+
+	case a.kind == kindNumber || b.kind == kindNumber:
+		na, okA := asNumber(a)
+		nb, okB := asNumber(b)
+		if !okA || !okB {
+			return 0, false
+		}
+		return compareNumbers(na, nb), true
+
+	case a.kind == kindBool && b.kind == kindBool:
+		if a.b == b.b {
+			return 0, true
+		}
+		if !a.b {
+			return -1, true
+		}
+		return 1, true
+
+	case a.kind == kindString && b.kind == kindString:
+		return strings.Compare(a.str, b.str), true
+	}
+	return 0, false
+}
+
+func asSeverity(v Value) (float64, bool) {
+	switch v.kind {
+	case kindSeverity:
+		return v.num, true
+	case kindString:
+		rank, ok := SeverityRank(v.str)
+		return float64(rank), ok
+	}
+	return 0, false
+}
+
+func asNumber(v Value) (float64, bool) {
+	switch v.kind {
+	case kindNumber:
+		return v.num, true
+	case kindString:
+		n, err := strconv.ParseFloat(v.str, 64)
+		return n, err == nil
+	}
+	return 0, false
+}
+
+func compareNumbers(a, b float64) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,249 @@
+// Package expr implements the boolean expression language used to select
+// telemetry, for example
+//
+//	span.name == "GET /health" or log.severity < "info"
+//
+// Fields are written signal.field, and attributes signal.attributes["key"].
+// Comparisons are ==, !=, <, <=, >, >=, and =~ / !~ against a regex literal.
+// They combine with and, or, not (or &&, ||, !) and parentheses. A field
+// that does not apply to the telemetry being evaluated, such as a log field
+// on a span, makes every comparison with it false.
+package expr
+
+import (
+	"fmt"
+	"regexp"
+)
+
+// Ref is a field reference. Key is set for attributes["key"].
+type Ref struct {
+	Signal string
+	Field  string
+	Key    string
+}
+
+func (r Ref) String() string {
+	if r.Key != "" {
+		return fmt.Sprintf("%s.%s[%q]", r.Signal, r.Field, r.Key)
+	}
+	return r.Signal + "." + r.Field
+}
+
+// Env resolves field references during evaluation. ok is false if the
+// field does not apply, or an attribute is missing.
+type Env interface {
+	Lookup(ref Ref) (Value, bool)
+}
+
+// Program is a compiled expression
+type Program struct {
+	source string
+	root   node
+	refs   []Ref
+}
+
+// Compile parses an expression
+func Compile(source string) (*Program, error) {
+	tokens, err := lex(source)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &parser{tokens: tokens}
+	root, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if t := p.peek(); t.kind != tokenEOF {
+		return nil, fmt.Errorf("unexpected token at %d", t.pos)
+	}
+
+	return &Program{source: source, root: root, refs: p.refs}, nil
+}
+
+// Eval evaluates the expression against env
+func (p *Program) Eval(env Env) bool {
+	return p.root.eval(env).Truthy()
+}
+
+// Refs returns the fields the expression references
+func (p *Program) Refs() []Ref {
+	return p.refs
+}
+
+// Signals returns the distinct signals the expression references
+func (p *Program) Signals() []string {
+	seen := make(map[string]bool)
+	var signals []string
+	for _, ref := range p.refs {
+		if !seen[ref.Signal] {
+			seen[ref.Signal] = true
+			signals = append(signals, ref.Signal)
+		}
+	}
+	return signals
+}
+
+func (p *Program) String() string {
+	return p.source
+}
+
+// parser is a recursive descent parser over tokens
+type parser struct {
+	tokens []token
+	pos    int
+	refs   []Ref
+}
+
+func (p *parser) peek() token {
+	return p.tokens[p.pos]
+}
+
+func (p *parser) next() token {
+	t := p.tokens[p.pos]
+	if t.kind != tokenEOF {
+		p.pos++
+	}
+	return t
+}
+
+func (p *parser) expect(kind tokenKind, what string) (token, error) {
+	t := p.next()
+	if t.kind != kind {
+		return t, fmt.Errorf("expected %s at %d", what, t.pos)
+	}
+	return t, nil
+}
+
+// parseOr parses and-expressions joined by or
+func (p *parser) parseOr() (node, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for p.peek().kind == tokenOr {
+		p.next()
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = &orNode{left: left, right: right}
+	}
+	return left, nil
+}
+
+// parseAnd parses unary expressions joined by and
+func (p *parser) parseAnd() (node, error) {
+	left, err := p.parseNot()
+	if err != nil {
+		return nil, err
+	}
+	for p.peek().kind == tokenAnd {
+		p.next()
+		right, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		left = &andNode{left: left, right: right}
+	}
+	return left, nil
+}
+
+// parseNot parses an optionally negated comparison
+func (p *parser) parseNot() (node, error) {
+	if p.peek().kind == tokenNot {
+		p.next()
+		operand, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		return &notNode{operand: operand}, nil
+	}
+	return p.parseComparison()
+}
+
+// parseComparison parses an operand, optionally compared with another
+func (p *parser) parseComparison() (node, error) {
+	left, err := p.parseOperand()
+	if err != nil {
+		return nil, err
+	}
+	if p.peek().kind != tokenOp {
+		return left, nil
+	}
+
+	op := p.next()
+	right, err := p.parseOperand()
+	if err != nil {
+		return nil, err
+	}
+
+	cmp := &compareNode{op: op.text, left: left, right: right}
+	if op.text == "=~" || op.text == "!~" {
+		lit, ok := right.(*literalNode)
+		if !ok || lit.value.kind != kindString {
+			return nil, fmt.Errorf("%s at %d requires a string pattern", op.text, op.pos)
+		}
+		cmp.pattern, err = regexp.Compile(lit.value.str)
+		if err != nil {
+			return nil, fmt.Errorf("invalid pattern at %d: %w", op.pos, err)
+		}
+	}
+	return cmp, nil
+}
+
+// parseOperand parses a literal, a field or a parenthesized expression
+func (p *parser) parseOperand() (node, error) {
+	t := p.next()
+	switch t.kind {
+	case tokenString:
+		return &literalNode{value: String(t.text)}, nil
+	case tokenNumber:
+		return &literalNode{value: Number(t.num)}, nil
+	case tokenLParen:
+		inner, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if _, err := p.expect(tokenRParen, ")"); err != nil {
+			return nil, err
+		}
+		return inner, nil
+	case tokenIdent:
+		switch t.text {
+		case "true":
+			return &literalNode{value: Bool(true)}, nil
+		case "false":
+			return &literalNode{value: Bool(false)}, nil
+		}
+		return p.parseField(t)
+	}
+	return nil, fmt.Errorf("expected a value at %d", t.pos)
+}
+
+// parseField parses signal.field or signal.field["key"]
+func (p *parser) parseField(signal token) (node, error) {
+	if _, err := p.expect(tokenDot, "."); err != nil {
+		return nil, fmt.Errorf("expected a field like %s.name at %d", signal.text, signal.pos)
+	}
+	field, err := p.expect(tokenIdent, "a field name")
+	if err != nil {
+		return nil, err
+	}
+
+	ref := Ref{Signal: signal.text, Field: field.text}
+	if p.peek().kind == tokenLBracket {
+		p.next()
+		key, err := p.expect(tokenString, "a quoted key")
+		if err != nil {
+			return nil, err
+		}
+		if _, err := p.expect(tokenRBracket, "]"); err != nil {
+			return nil, err
+		}
+		ref.Key = key.text
+	}
+
+	p.refs = append(p.refs, ref)
+	return &fieldNode{ref: ref}, nil
+}
@@ -0,0 +1,91 @@
+package expr
+
+import "testing"
+
+// mapEnv resolves fields from a map keyed by Ref.String()
+type mapEnv map[string]Value
+
+func (e mapEnv) Lookup(ref Ref) (Value, bool) {
+	v, ok := e[ref.String()]
+	return v, ok
+}
+
+func TestEval(t *testing.T) {
+	span := mapEnv{
+		"span.name":                      String("GET /health"),
+		"span.duration":                  Number(250),
+		`span.attributes["http.status"]`: String("503"),
+	}
+	log := mapEnv{
+		"log.severity": Severity("debug"),
+		"log.message":  String("cache miss for user 42"),
+	}
+
+	cases := []struct {
+		expr string
+		env  mapEnv
+		want bool
+	}{
+		{`span.name == "GET /health" or log.severity < "info"`, span, true},
+		{`span.name == "GET /health" or log.severity < "info"`, log, true},
+		{`log.severity < "info"`, mapEnv{"log.severity": Severity("WARN")}, false},
+		{`log.severity >= 'warning'`, mapEnv{"log.severity": Severity("error")}, true},
+		{`log.message == 'it\'s'`, mapEnv{"log.message": String("it's")}, true},
+		{`log.message == 'a\"b' and log.message == 'a"b'`, mapEnv{"log.message": String(`a"b`)}, true},
+		{`log.message == "it's \u00e9t\u00e9" or log.message == "\x41"`, mapEnv{"log.message": String("it's été")}, true},
+		{`span.duration > 100 and span.duration <= 250`, span, true},
+		{`span.duration == 2.5e+2 and span.duration > 1E-3`, span, true},
+		{`span.duration > -2.5e2`, span, true},
+		{`span.attributes["http.status"] >= 500`, span, true},
+		{`span.attributes["missing"] != "x"`, span, false},
+		{`not span.attributes["missing"]`, span, true},
+		{`log.message =~ "user \\d+"`, log, true},
+		{`log.message !~ "^cache"`, log, false},
+		{`!(span.name == "GET /health") || span.duration < 0`, span, false},
+		{`span.name == "GET /health" && (span.duration > 1000 || span.attributes["http.status"] == "503")`, span, true},
+	}
+
+	for _, tc := range cases {
+		p, err := Compile(tc.expr)
+		if err != nil {
+			t.Errorf("Compile(%q) failed: %v", tc.expr, err)
+			continue
+		}
+		if got := p.Eval(tc.env); got != tc.want {
+			t.Errorf("%s = %v, want %v", tc.expr, got, tc.want)
+		}
+	}
+}
+
+func TestCompileErrors(t *testing.T) {
+	for _, src := range []string{
+		``,
+		`span.name ==`,
+		`span.name = "x"`,
+		`span == "x"`,
+		`(span.name == "x"`,
+		`span.name == "x" extra`,
+		`span.attributes["k" == "x"`,
+		`span.name =~ span.kind`,
+		`span.name =~ "("`,
+		`span.name == "unterminated`,
+		`span.duration > 1e+`,
+		`log.message == 'bad \q'`,
+		`span.duration > 1.2.3`,
+		`span.name == "x" € 1`,
+	} {
+		if _, err := Compile(src); err == nil {
+			t.Errorf("Expected error for %q", src)
+		}
+	}
+}
+
+func TestSignals(t *testing.T) {
+	p, err := Compile(`span.name == "a" or log.severity < "info" or span.kind == "server"`)
+	if err != nil {
+		t.Fatalf("Compile failed: %v", err)
+	}
+	if signals := p.Signals(); len(signals) != 2 || signals[0] != "span" || signals[1] != "log" {
+		t.Errorf("Expected span and log, got %v", signals)
+	}
+}
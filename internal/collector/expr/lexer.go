@@ -0,0 +1,196 @@
+package expr
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// tokenKind classifies lexer tokens
+type tokenKind int
+
+const (
+	tokenEOF tokenKind = iota
+	tokenIdent
+	tokenString
+	tokenNumber
+	tokenOp // comparison operators
+	tokenAnd
+	tokenOr
+	tokenNot
+	tokenDot
+	tokenLParen
+	tokenRParen
+	tokenLBracket
+	tokenRBracket
+)
+
+type token struct {
+	kind tokenKind
+	text string // identifier, operator or unquoted string
+	num  float64
+	pos  int
+}
+
+// lex splits an expression into tokens
+func lex(input string) ([]token, error) {
+	var tokens []token
+	i := 0
+
+	for i < len(input) {
+		c := input[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			i++
+
+		case c == '(':
+			tokens = append(tokens, token{kind: tokenLParen, pos: i})
+			i++
+		case c == ')':
+			tokens = append(tokens, token{kind: tokenRParen, pos: i})
+			i++
+		case c == '[':
+			tokens = append(tokens, token{kind: tokenLBracket, pos: i})
+			i++
+		case c == ']':
+			tokens = append(tokens, token{kind: tokenRBracket, pos: i})
+			i++
+		case c == '.':
+			tokens = append(tokens, token{kind: tokenDot, pos: i})
+			i++
+
+		case c == '"' || c == '\'':
+			end := i + 1
+			for end < len(input) && input[end] != c {
+				if input[end] == '\\' {
+					end++
+				}
+				end++
+			}
+			if end >= len(input) {
+				return nil, fmt.Errorf("unterminated string at %d", i)
+			}
+			s, err := unquote(input[i+1:end], c)
+			if err != nil {
+				return nil, fmt.Errorf("invalid string at %d: %w", i, err)
+			}
+			tokens = append(tokens, token{kind: tokenString, text: s, pos: i})
+			i = end + 1
+
+		case isDigit(c) || (c == '-' && i+1 < len(input) && isDigit(input[i+1])):
+			end := scanNumber(input, i+1)
+			n, err := strconv.ParseFloat(input[i:end], 64)
+			if err != nil {
+				return nil, fmt.Errorf("invalid number %q at %d", input[i:end], i)
+			}
+			tokens = append(tokens, token{kind: tokenNumber, num: n, text: input[i:end], pos: i})
+			i = end
+
+		case c == '&' && strings.HasPrefix(input[i:], "&&"):
+			tokens = append(tokens, token{kind: tokenAnd, pos: i})
+			i += 2
+		case c == '|' && strings.HasPrefix(input[i:], "||"):
+			tokens = append(tokens, token{kind: tokenOr, pos: i})
+			i += 2
+
+		case strings.IndexByte("=!<>", c) >= 0:
+			op := string(c)
+			if i+1 < len(input) && (input[i+1] == '=' || input[i+1] == '~') {
+				op += string(input[i+1])
+			}
+			switch op {
+			case "!":
+				tokens = append(tokens, token{kind: tokenNot, pos: i})
+			case "==", "!=", "<", "<=", ">", ">=", "=~", "!~":
+				tokens = append(tokens, token{kind: tokenOp, text: op, pos: i})
+			default:
+				return nil, fmt.Errorf("unknown operator %q at %d", op, i)
+			}
+			i += len(op)
+
+		case isIdentStart(input[i:]):
+			end := i
+			for end < len(input) {
+				r, size := utf8.DecodeRuneInString(input[end:])
+				if r != '_' && !unicode.IsLetter(r) && !unicode.IsDigit(r) {
+					break
+				}
+				end += size
+			}
+			word := input[i:end]
+			switch word {
+			case "and":
+				tokens = append(tokens, token{kind: tokenAnd, pos: i})
+			case "or":
+				tokens = append(tokens, token{kind: tokenOr, pos: i})
+			case "not":
+				tokens = append(tokens, token{kind: tokenNot, pos: i})
+			default:
+				tokens = append(tokens, token{kind: tokenIdent, text: word, pos: i})
+			}
+			i = end
+
+		default:
+			r, _ := utf8.DecodeRuneInString(input[i:])
+			return nil, fmt.Errorf("unexpected character %q at %d", r, i)
+		}
+	}
+
+	return append(tokens, token{kind: tokenEOF, pos: len(input)}), nil
+}
+
+// unquote decodes the body of a string enclosed in quote. Go's escapes
+// apply, and either quote may be escaped whichever encloses the string.
+func unquote(body string, quote byte) (string, error) {
+	var b strings.Builder
+	for len(body) > 0 {
+		if len(body) >= 2 && body[0] == '\\' && (body[1] == '\'' || body[1] == '"') {
+			b.WriteByte(body[1])
+			body = body[2:]
+			continue
+		}
+		r, multibyte, tail, err := strconv.UnquoteChar(body, quote)
+		if err != nil {
+			return "", err
+		}
+		if multibyte {
+			b.WriteRune(r)
+		} else {
+			b.WriteByte(byte(r))
+		}
+		body = tail
+	}
+	return b.String(), nil
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+// isIdentStart reports whether s begins with a letter or underscore
+func isIdentStart(s string) bool {
+	r, _ := utf8.DecodeRuneInString(s)
+	return r == '_' || unicode.IsLetter(r)
+}
+
+// scanNumber returns the end of the number continuing at i: digits, dots
+// and an exponent with an optional sign. It only finds the extent;
+// strconv.ParseFloat decides whether the text is a valid number.
+func scanNumber(input string, i int) int {
+	for i < len(input) {
+		switch c := input[i]; {
+		case isDigit(c) || c == '.':
+			i++
+		case c == 'e' || c == 'E':
+			i++
+			if i < len(input) && (input[i] == '+' || input[i] == '-') {
+				i++
+			}
+		default:
+			return i
+		}
+	}
+	return i
+}
@@ -0,0 +1,145 @@
+package filelog
+
+import (
+	"bytes"
+	"encoding/json"
+	"math"
+	"strings"
+	"time"
+
+	"github.com/gaurav/watchingcat/internal/collector/otlp"
+	"github.com/gaurav/watchingcat/pkg/models"
+)
+
+// Field names read from JSON lines. The first of each list present wins;
+// the defaults of logging.NewLogger come first.
+var (
+	timestampFields = []string{"timestamp", "ts", "time", "@timestamp"}
+	severityFields  = []string{"level", "severity", "lvl"}
+	messageFields   = []string{"msg", "message"}
+	traceIDFields   = []string{"trace_id", "traceId"}
+	spanIDFields    = []string{"span_id", "spanId"}
+	serviceFields   = []string{"service", otlp.ServiceNameKey, "service_name"}
+)
+
+// timestampLayouts are tried in order for string timestamps. The second is
+// zap's ISO8601 encoder.
+var timestampLayouts = []string{time.RFC3339Nano, "2006-01-02T15:04:05.000Z0700"}
+
+// severityAliases normalizes level names to the severities used elsewhere
+var severityAliases = map[string]string{
+	"warning":  "warn",
+	"err":      "error",
+	"critical": "fatal",
+	"dpanic":   "fatal",
+	"panic":    "fatal",
+}
+
+// ParseLine turns a log line into a record. JSON objects have their
+// timestamp, level, message, trace context and service lifted into the
+// record and their other fields kept as attributes; anything else becomes
+// the message, timestamped now.
+func ParseLine(line []byte, now time.Time) models.LogRecord {
+	line = bytes.TrimRight(line, "\r\n")
+	record := models.LogRecord{
+		Timestamp:  now,
+		Attributes: make(map[string]string),
+	}
+
+	fields := make(map[string]any)
+	decoder := json.NewDecoder(bytes.NewReader(line))
+	decoder.UseNumber()
+	if err := decoder.Decode(&fields); err != nil || fields == nil || decoder.More() {
+		record.Message = string(line)
+		return record
+	}
+
+	if v, ok := take(fields, timestampFields); ok {
+		if ts, ok := parseTimestamp(v); ok {
+			record.Timestamp = ts
+		} else {
+			record.Attributes["timestamp"] = stringify(v)
+		}
+	}
+	if v, ok := take(fields, severityFields); ok {
+		severity := strings.ToLower(stringify(v))
+		if alias, ok := severityAliases[severity]; ok {
+			severity = alias
+		}
+		record.Severity = severity
+	}
+	if v, ok := take(fields, messageFields); ok {
+		record.Message = stringify(v)
+	}
+	if v, ok := take(fields, traceIDFields); ok {
+		record.TraceID = strings.ToLower(stringify(v))
+	}
+	if v, ok := take(fields, spanIDFields); ok {
+		record.SpanID = strings.ToLower(stringify(v))
+	}
+	if v, ok := take(fields, serviceFields); ok {
+		record.ServiceName = stringify(v)
+		record.Attributes[otlp.ServiceNameKey] = record.ServiceName
+	}
+
+	for k, v := range fields {
+		record.Attributes[k] = stringify(v)
+	}
+	return record
+}
+
+// take removes and returns the first of names present in fields
+func take(fields map[string]any, names []string) (any, bool) {
+	for _, name := range names {
+		if v, ok := fields[name]; ok && v != nil {
+			delete(fields, name)
+			return v, true
+		}
+	}
+	return nil, false
+}
+
+// parseTimestamp reads a formatted time or a Unix epoch number, whose unit
+// is guessed from its magnitude
+func parseTimestamp(v any) (time.Time, bool) {
+	switch v := v.(type) {
+	case string:
+		for _, layout := range timestampLayouts {
+			if ts, err := time.Parse(layout, v); err == nil {
+				return ts, true
+			}
+		}
+	case json.Number:
+		f, err := v.Float64()
+		if err != nil || f <= 0 {
+			return time.Time{}, false
+		}
+		switch {
+		case f >= 1e17:
+			return time.Unix(0, int64(f)).UTC(), true
+		case f >= 1e14:
+			return time.UnixMicro(int64(f)).UTC(), true
+		case f >= 1e11:
+			return time.UnixMilli(int64(f)).UTC(), true
+		default:
+			sec, frac := math.Modf(f)
+			return time.Unix(int64(sec), int64(frac*1e9)).UTC(), true
+		}
+	}
+	return time.Time{}, false
+}
+
+// stringify keeps strings as they are and encodes other values as JSON
+func stringify(v any) string {
+	switch v := v.(type) {
+	case string:
+		return v
+	case json.Number:
+		return v.String()
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		return ""
+	}
+	return string(data)
+}
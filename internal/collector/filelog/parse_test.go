@@ -0,0 +1,83 @@
+package filelog
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseLine(t *testing.T) {
+	now := time.Date(2024, 1, 2, 10, 0, 0, 0, time.UTC)
+
+	// As written by logging.NewLogger with WithContext fields
+	line := `{"level":"warn","timestamp":"2024-01-02T09:59:58.123Z","caller":"cart/handler.go:42","msg":"cart is empty","service":"cartservice","trace_id":"4BF92F3577B34DA6A3CE929D0E0E4736","span_id":"00f067aa0ba902b7","items":0,"user":{"id":7}}` + "\n"
+	record := ParseLine([]byte(line), now)
+
+	if want := time.Date(2024, 1, 2, 9, 59, 58, 123e6, time.UTC); !record.Timestamp.Equal(want) {
+		t.Errorf("Expected timestamp %v, got %v", want, record.Timestamp)
+	}
+	if record.Severity != "warn" || record.Message != "cart is empty" || record.ServiceName != "cartservice" {
+		t.Errorf("Unexpected record %+v", record)
+	}
+	if record.TraceID != "4bf92f3577b34da6a3ce929d0e0e4736" || record.SpanID != "00f067aa0ba902b7" {
+		t.Errorf("Expected trace context lifted from fields, got %q/%q", record.TraceID, record.SpanID)
+	}
+	want := map[string]string{
+		"caller":       "cart/handler.go:42",
+		"items":        "0",
+		"user":         `{"id":7}`,
+		"service.name": "cartservice",
+	}
+	for k, v := range want {
+		if record.Attributes[k] != v {
+			t.Errorf("Expected %s=%q, got %q", k, v, record.Attributes[k])
+		}
+	}
+	for _, k := range []string{"msg", "level", "timestamp", "trace_id", "span_id", "service"} {
+		if _, ok := record.Attributes[k]; ok {
+			t.Errorf("Expected lifted field %s not to be kept as an attribute", k)
+		}
+	}
+}
+
+func TestParseLineVariants(t *testing.T) {
+	now := time.Date(2024, 1, 2, 10, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name, line        string
+		timestamp         time.Time
+		severity, message string
+	}{
+		{
+			name:      "zap production defaults",
+			line:      `{"level":"dpanic","ts":1704189600.5,"msg":"boom"}`,
+			timestamp: time.Date(2024, 1, 2, 10, 0, 0, 5e8, time.UTC),
+			severity:  "fatal",
+			message:   "boom",
+		},
+		{
+			name:      "epoch milliseconds",
+			line:      `{"severity":"WARNING","time":1704189600000,"message":"slow"}`,
+			timestamp: time.Date(2024, 1, 2, 10, 0, 0, 0, time.UTC),
+			severity:  "warn",
+			message:   "slow",
+		},
+		{
+			name:      "plain text",
+			line:      "GET /healthz 200\n",
+			timestamp: now,
+			message:   "GET /healthz 200",
+		},
+		{
+			name:      "not an object",
+			line:      `["a","b"]`,
+			timestamp: now,
+			message:   `["a","b"]`,
+		},
+	}
+
+	for _, tt := range tests {
+		record := ParseLine([]byte(tt.line), now)
+		if !record.Timestamp.Equal(tt.timestamp) || record.Severity != tt.severity || record.Message != tt.message {
+			t.Errorf("%s: unexpected record %+v", tt.name, record)
+		}
+	}
+}
@@ -0,0 +1,408 @@
+// Package filelog tails log files, following rotation and remembering
+// offsets across restarts
+package filelog
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/gaurav/watchingcat/internal/config"
+	"github.com/gaurav/watchingcat/pkg/models"
+	"go.uber.org/zap"
+)
+
+const (
+	defaultPollInterval = 200 * time.Millisecond
+
+	// fingerprintSize is how much of a file's head identifies it, so that a
+	// file is recognized after being renamed by rotation or across restarts
+	fingerprintSize = 256
+
+	// maxLineSize bounds a line; longer lines are split
+	maxLineSize = 1 << 20
+
+	// maxBatchSize bounds the records handed to the consumer at once
+	maxBatchSize = 1000
+)
+
+// Consumer receives records read from files. An error means they were
+// refused, typically because buffers are full; they are read again on the
+// next poll.
+type Consumer interface {
+	ReceiveLogs(logs []models.LogRecord) error
+}
+
+// Receiver polls files matching its include patterns and reads new lines
+type Receiver struct {
+	cfg      config.FileLogReceiverConfig
+	consumer Consumer
+	logger   *zap.Logger
+
+	readers     []*reader
+	checkpoints []checkpoint // loaded at start, not yet matched to a file
+	firstPoll   bool
+	dirty       bool // offsets changed since the last checkpoint
+
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+// reader follows one file. The file stays open so a rotated file can be
+// read to its end after it is renamed or deleted.
+type reader struct {
+	path        string
+	file        *os.File
+	fingerprint []byte
+	offset      int64
+}
+
+// checkpoint is a reader's position as persisted
+type checkpoint struct {
+	Path        string `json:"path"`
+	Fingerprint []byte `json:"fingerprint"`
+	Offset      int64  `json:"offset"`
+}
+
+// NewReceiver validates cfg's patterns
+func NewReceiver(cfg config.FileLogReceiverConfig, consumer Consumer, logger *zap.Logger) (*Receiver, error) {
+	if len(cfg.Include) == 0 {
+		return nil, errors.New("include requires at least one pattern")
+	}
+	for _, pattern := range append(append([]string(nil), cfg.Include...), cfg.Exclude...) {
+		if _, err := filepath.Match(pattern, ""); err != nil {
+			return nil, fmt.Errorf("invalid pattern %q: %w", pattern, err)
+		}
+	}
+	switch cfg.StartAt {
+	case "":
+		cfg.StartAt = "end"
+	case "beginning", "end":
+	default:
+		return nil, fmt.Errorf("start_at must be beginning or end, got %q", cfg.StartAt)
+	}
+	if cfg.PollInterval <= 0 {
+		cfg.PollInterval = defaultPollInterval
+	}
+
+	return &Receiver{cfg: cfg, consumer: consumer, logger: logger, firstPoll: true}, nil
+}
+
+// Start loads the checkpoint and polls in the background
+func (r *Receiver) Start(ctx context.Context) error {
+	if err := r.loadCheckpoints(); err != nil {
+		r.logger.Warn("Ignoring unreadable checkpoint",
+			zap.String("path", r.cfg.CheckpointPath),
+			zap.Error(err),
+		)
+	}
+
+	ctx, r.cancel = context.WithCancel(ctx)
+	r.done = make(chan struct{})
+
+	r.logger.Info("File log receiver starting",
+		zap.Strings("include", r.cfg.Include),
+		zap.String("start_at", r.cfg.StartAt),
+		zap.Int("checkpoints", len(r.checkpoints)),
+	)
+
+	go func() {
+		defer close(r.done)
+		ticker := time.NewTicker(r.cfg.PollInterval)
+		defer ticker.Stop()
+
+		for {
+			r.poll()
+
+			select {
+			case <-ctx.Done():
+				r.saveCheckpoints()
+				for _, rd := range r.readers {
+					rd.file.Close()
+				}
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+	return nil
+}
+
+// Shutdown stops polling and saves the checkpoint, waiting until ctx is
+// done
+func (r *Receiver) Shutdown(ctx context.Context) error {
+	if r.cancel == nil {
+		return nil
+	}
+	r.cancel()
+
+	select {
+	case <-r.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// poll picks up new and rotated files, reads every followed file and drops
+// files that no longer match once they are read to the end
+func (r *Receiver) poll() {
+	seen := make(map[*reader]bool)
+	for _, path := range r.match() {
+		if rd := r.open(path); rd != nil {
+			seen[rd] = true
+		}
+	}
+
+	readers := r.readers[:0]
+	for _, rd := range r.readers {
+		drained := r.read(rd)
+		if seen[rd] || !drained {
+			readers = append(readers, rd)
+			continue
+		}
+		rd.file.Close()
+		r.dirty = true
+	}
+	r.readers = readers
+	r.firstPoll = false
+
+	if r.dirty {
+		r.saveCheckpoints()
+	}
+}
+
+// match lists the files matching include and not exclude
+func (r *Receiver) match() []string {
+	var paths []string
+	seen := make(map[string]bool)
+	for _, pattern := range r.cfg.Include {
+		matches, _ := filepath.Glob(pattern)
+		for _, path := range matches {
+			if seen[path] || r.excluded(path) {
+				continue
+			}
+			seen[path] = true
+			paths = append(paths, path)
+		}
+	}
+	return paths
+}
+
+func (r *Receiver) excluded(path string) bool {
+	for _, pattern := range r.cfg.Exclude {
+		if ok, _ := filepath.Match(pattern, path); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// open returns the reader following path's file, creating one for a file
+// not seen before. Empty files are skipped until they have a fingerprint.
+func (r *Receiver) open(path string) *reader {
+	file, err := os.Open(path)
+	if err != nil {
+		r.logger.Debug("Cannot open log file", zap.String("path", path), zap.Error(err))
+		return nil
+	}
+	info, err := file.Stat()
+	if err != nil || !info.Mode().IsRegular() {
+		file.Close()
+		return nil
+	}
+	fingerprint, err := readFingerprint(file)
+	if err != nil || len(fingerprint) == 0 {
+		file.Close()
+		return nil
+	}
+
+	// A known file, possibly renamed or grown since
+	for _, rd := range r.readers {
+		if !bytes.HasPrefix(fingerprint, rd.fingerprint) {
+			continue
+		}
+		file.Close()
+		if rd.path != path || len(fingerprint) > len(rd.fingerprint) {
+			rd.path, rd.fingerprint = path, fingerprint
+			r.dirty = true
+		}
+		return rd
+	}
+	// The same file with new content, truncated and rewritten in place
+	for _, rd := range r.readers {
+		if rdInfo, err := rd.file.Stat(); err == nil && os.SameFile(info, rdInfo) {
+			file.Close()
+			rd.path, rd.fingerprint, rd.offset = path, fingerprint, 0
+			r.dirty = true
+			return rd
+		}
+	}
+
+	rd := &reader{path: path, file: file, fingerprint: fingerprint}
+	switch cp, ok := r.takeCheckpoint(fingerprint); {
+	case ok && cp.Offset <= info.Size():
+		rd.offset = cp.Offset
+	case r.firstPoll && r.cfg.StartAt == "end" && !ok:
+		rd.offset = info.Size()
+	}
+	r.readers = append(r.readers, rd)
+	r.dirty = true
+
+	r.logger.Debug("Following log file",
+		zap.String("path", path),
+		zap.Int64("offset", rd.offset),
+	)
+	return rd
+}
+
+// takeCheckpoint removes and returns the loaded checkpoint of a file
+func (r *Receiver) takeCheckpoint(fingerprint []byte) (checkpoint, bool) {
+	for i, cp := range r.checkpoints {
+		if len(cp.Fingerprint) > 0 && bytes.HasPrefix(fingerprint, cp.Fingerprint) {
+			r.checkpoints = append(r.checkpoints[:i], r.checkpoints[i+1:]...)
+			return cp, true
+		}
+	}
+	return checkpoint{}, false
+}
+
+// read hands a file's complete lines past its offset to the consumer,
+// advancing the offset only for accepted records. It returns true if the
+// file was read to its end.
+func (r *Receiver) read(rd *reader) bool {
+	info, err := rd.file.Stat()
+	if err != nil {
+		return true
+	}
+	// Truncated in place, as copytruncate rotation does
+	if info.Size() < rd.offset {
+		rd.offset = 0
+		r.dirty = true
+	}
+	if _, err := rd.file.Seek(rd.offset, io.SeekStart); err != nil {
+		r.logger.Warn("Cannot seek log file", zap.String("path", rd.path), zap.Error(err))
+		return true
+	}
+
+	attrs := map[string]string{
+		"log.file.path": rd.path,
+		"log.file.name": filepath.Base(rd.path),
+	}
+	buf := bufio.NewReaderSize(rd.file, 64<<10)
+	var (
+		batch []models.LogRecord
+		read  int64
+		line  []byte
+	)
+	for {
+		chunk, err := buf.ReadSlice('\n')
+		line = append(line, chunk...)
+		if errors.Is(err, bufio.ErrBufferFull) && len(line) < maxLineSize {
+			continue
+		}
+		if err != nil && !errors.Is(err, bufio.ErrBufferFull) {
+			// A partial last line waits for the rest of it
+			break
+		}
+
+		read += int64(len(line))
+		if len(bytes.TrimSpace(line)) > 0 {
+			record := ParseLine(line, time.Now())
+			for k, v := range attrs {
+				record.Attributes[k] = v
+			}
+			batch = append(batch, record)
+		}
+		line = line[:0]
+
+		if len(batch) >= maxBatchSize {
+			if !r.deliver(rd, batch, read) {
+				return false
+			}
+			batch, read = nil, 0
+		}
+	}
+	if read > 0 && !r.deliver(rd, batch, read) {
+		return false
+	}
+	return rd.offset+int64(len(line)) >= info.Size()
+}
+
+// deliver hands a batch to the consumer and advances the reader past the
+// bytes it was read from
+func (r *Receiver) deliver(rd *reader, batch []models.LogRecord, read int64) bool {
+	if len(batch) > 0 {
+		if err := r.consumer.ReceiveLogs(batch); err != nil {
+			r.logger.Debug("File logs refused, retrying on next poll",
+				zap.String("path", rd.path),
+				zap.Int("records", len(batch)),
+				zap.Error(err),
+			)
+			return false
+		}
+	}
+	rd.offset += read
+	r.dirty = true
+	return true
+}
+
+// readFingerprint reads the head of a file
+func readFingerprint(file *os.File) ([]byte, error) {
+	buf := make([]byte, fingerprintSize)
+	n, err := file.ReadAt(buf, 0)
+	if err != nil && !errors.Is(err, io.EOF) {
+		return nil, err
+	}
+	return buf[:n], nil
+}
+
+// loadCheckpoints reads the checkpoint file, if any
+func (r *Receiver) loadCheckpoints() error {
+	if r.cfg.CheckpointPath == "" {
+		return nil
+	}
+	data, err := os.ReadFile(r.cfg.CheckpointPath)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, &r.checkpoints)
+}
+
+// saveCheckpoints writes the readers' positions, replacing the checkpoint
+// file atomically so a crash leaves the previous one intact
+func (r *Receiver) saveCheckpoints() {
+	if r.cfg.CheckpointPath == "" {
+		return
+	}
+
+	checkpoints := make([]checkpoint, 0, len(r.readers))
+	for _, rd := range r.readers {
+		checkpoints = append(checkpoints, checkpoint{Path: rd.path, Fingerprint: rd.fingerprint, Offset: rd.offset})
+	}
+	data, err := json.Marshal(checkpoints)
+	if err == nil {
+		tmp := r.cfg.CheckpointPath + ".tmp"
+		if err = os.WriteFile(tmp, data, 0o644); err == nil {
+			err = os.Rename(tmp, r.cfg.CheckpointPath)
+		}
+	}
+	if err != nil {
+		r.logger.Warn("Failed to save checkpoint",
+			zap.String("path", r.cfg.CheckpointPath),
+			zap.Error(err),
+		)
+		return
+	}
+	r.dirty = false
+}
@@ -0,0 +1,208 @@
+package filelog
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/gaurav/watchingcat/internal/config"
+	"github.com/gaurav/watchingcat/pkg/models"
+	"go.uber.org/zap"
+)
+
+// recordingConsumer keeps the logs it receives, or refuses them
+type recordingConsumer struct {
+	logs   []models.LogRecord
+	refuse bool
+}
+
+func (c *recordingConsumer) ReceiveLogs(logs []models.LogRecord) error {
+	if c.refuse {
+		return errors.New("buffer full")
+	}
+	c.logs = append(c.logs, logs...)
+	return nil
+}
+
+func (c *recordingConsumer) messages() []string {
+	var messages []string
+	for _, l := range c.logs {
+		messages = append(messages, l.Message)
+	}
+	return messages
+}
+
+func appendLines(t *testing.T, path string, lines ...string) {
+	t.Helper()
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	for _, line := range lines {
+		fmt.Fprintln(f, line)
+	}
+}
+
+func newTestReceiver(t *testing.T, cfg config.FileLogReceiverConfig, consumer Consumer) *Receiver {
+	t.Helper()
+	r, err := NewReceiver(cfg, consumer, zap.NewNop())
+	if err != nil {
+		t.Fatalf("NewReceiver failed: %v", err)
+	}
+	if err := r.loadCheckpoints(); err != nil {
+		t.Fatalf("loadCheckpoints failed: %v", err)
+	}
+	t.Cleanup(func() {
+		for _, rd := range r.readers {
+			rd.file.Close()
+		}
+	})
+	return r
+}
+
+func expectMessages(t *testing.T, consumer *recordingConsumer, want ...string) {
+	t.Helper()
+	got := consumer.messages()
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("Expected messages %q, got %q", want, got)
+	}
+	consumer.logs = nil
+}
+
+func TestTailFollowsRotation(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "app.log")
+	appendLines(t, path, `{"msg":"before start"}`)
+
+	consumer := &recordingConsumer{}
+	r := newTestReceiver(t, config.FileLogReceiverConfig{Include: []string{filepath.Join(dir, "*.log")}}, consumer)
+
+	// start_at defaults to end for files present at startup
+	r.poll()
+	expectMessages(t, consumer)
+
+	appendLines(t, path, `{"msg":"one"}`)
+	f, _ := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0o644)
+	f.WriteString(`{"msg":"partial`)
+	f.Close()
+	r.poll()
+	expectMessages(t, consumer, "one")
+
+	// Rotate by rename: the rest of the old file is read, then the new one
+	// from its beginning
+	appendLines(t, path, `"}`)
+	appendLines(t, path, `{"msg":"last in old file"}`)
+	if err := os.Rename(path, path+".1"); err != nil {
+		t.Fatal(err)
+	}
+	appendLines(t, path, `{"msg":"first in new file"}`)
+	r.poll()
+	expectMessages(t, consumer, "partial", "last in old file", "first in new file")
+	if len(r.readers) != 1 {
+		t.Errorf("Expected the rotated file to be dropped once read, following %d files", len(r.readers))
+	}
+
+	if got := r.readers[0].file.Name(); got != path {
+		t.Errorf("Expected to follow %s, got %s", path, got)
+	}
+}
+
+func TestTailCopyTruncate(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "app.log")
+
+	consumer := &recordingConsumer{}
+	r := newTestReceiver(t, config.FileLogReceiverConfig{Include: []string{path}, StartAt: "beginning"}, consumer)
+
+	appendLines(t, path, "a fairly long first line", "second line")
+	r.poll()
+	expectMessages(t, consumer, "a fairly long first line", "second line")
+
+	if err := os.Truncate(path, 0); err != nil {
+		t.Fatal(err)
+	}
+	appendLines(t, path, "after truncate")
+	r.poll()
+	expectMessages(t, consumer, "after truncate")
+}
+
+func TestTailRetriesRefusedRecords(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "app.log")
+	appendLines(t, path, "kept for retry")
+
+	consumer := &recordingConsumer{refuse: true}
+	r := newTestReceiver(t, config.FileLogReceiverConfig{Include: []string{path}, StartAt: "beginning"}, consumer)
+
+	r.poll()
+	consumer.refuse = false
+	r.poll()
+	expectMessages(t, consumer, "kept for retry")
+}
+
+func TestCheckpointSurvivesRestart(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "app.log")
+	cfg := config.FileLogReceiverConfig{
+		Include:        []string{path},
+		StartAt:        "beginning",
+		CheckpointPath: filepath.Join(dir, "checkpoint.json"),
+	}
+	appendLines(t, path, "one", "two")
+
+	consumer := &recordingConsumer{}
+	r := newTestReceiver(t, cfg, consumer)
+	r.poll()
+	expectMessages(t, consumer, "one", "two")
+
+	// Written while the collector was down
+	appendLines(t, path, "three")
+
+	restarted := newTestReceiver(t, cfg, consumer)
+	restarted.poll()
+	expectMessages(t, consumer, "three")
+
+	if restarted.readers[0].offset != int64(len("one\ntwo\nthree\n")) {
+		t.Errorf("Unexpected offset %d", restarted.readers[0].offset)
+	}
+}
+
+func TestRecordsCarryFileAttributes(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "app.log")
+
+	consumer := &recordingConsumer{}
+	r := newTestReceiver(t, config.FileLogReceiverConfig{
+		Include: []string{filepath.Join(dir, "*")},
+		Exclude: []string{filepath.Join(dir, "*.gz")},
+		StartAt: "beginning",
+	}, consumer)
+
+	appendLines(t, path, `{"msg":"hello"}`)
+	appendLines(t, filepath.Join(dir, "old.gz"), "compressed")
+	r.poll()
+
+	if len(consumer.logs) != 1 {
+		t.Fatalf("Expected excluded files to be skipped, got %q", consumer.messages())
+	}
+	attrs := consumer.logs[0].Attributes
+	if attrs["log.file.path"] != path || attrs["log.file.name"] != "app.log" {
+		t.Errorf("Expected file attributes, got %v", attrs)
+	}
+}
+
+func TestNewReceiverValidates(t *testing.T) {
+	tests := map[string]config.FileLogReceiverConfig{
+		"no include":   {},
+		"bad pattern":  {Include: []string{"[a-"}},
+		"bad start_at": {Include: []string{"*.log"}, StartAt: "middle"},
+	}
+	for name, cfg := range tests {
+		if _, err := NewReceiver(cfg, &recordingConsumer{}, zap.NewNop()); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
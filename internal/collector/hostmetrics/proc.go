@@ -0,0 +1,199 @@
+package hostmetrics
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// cpuStates names the columns of a cpu line in /proc/stat, in order
+var cpuStates = []string{"user", "nice", "system", "idle", "iowait", "irq", "softirq", "steal"}
+
+// cpuTimes holds one cpu line of /proc/stat in clock ticks, by state
+type cpuTimes struct {
+	cpu   string
+	ticks []uint64
+}
+
+func (c cpuTimes) total() uint64 {
+	var sum uint64
+	for _, t := range c.ticks {
+		sum += t
+	}
+	return sum
+}
+
+// parseStat reads the cpu lines of /proc/stat. The first is the "cpu"
+// line summing all CPUs.
+func parseStat(r io.Reader) ([]cpuTimes, error) {
+	var times []cpuTimes
+
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 5 || !strings.HasPrefix(fields[0], "cpu") {
+			continue
+		}
+
+		// guest and guest_nice are already part of user and nice
+		cols := fields[1:]
+		if len(cols) > len(cpuStates) {
+			cols = cols[:len(cpuStates)]
+		}
+		t := cpuTimes{cpu: fields[0], ticks: make([]uint64, len(cpuStates))}
+		for i, col := range cols {
+			v, err := strconv.ParseUint(col, 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("invalid %s %s: %w", fields[0], cpuStates[i], err)
+			}
+			t.ticks[i] = v
+		}
+		times = append(times, t)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if len(times) == 0 {
+		return nil, fmt.Errorf("no cpu lines")
+	}
+	return times, nil
+}
+
+// parseMeminfo reads /proc/meminfo into bytes by field name
+func parseMeminfo(r io.Reader) (map[string]uint64, error) {
+	info := make(map[string]uint64)
+
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		name, rest, ok := strings.Cut(scanner.Text(), ":")
+		if !ok {
+			continue
+		}
+		fields := strings.Fields(rest)
+		if len(fields) == 0 {
+			continue
+		}
+		v, err := strconv.ParseUint(fields[0], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s: %w", name, err)
+		}
+		if len(fields) > 1 && fields[1] == "kB" {
+			v *= 1024
+		}
+		info[name] = v
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if _, ok := info["MemTotal"]; !ok {
+		return nil, fmt.Errorf("no MemTotal")
+	}
+	return info, nil
+}
+
+// diskStats holds the counters of one /proc/diskstats line
+type diskStats struct {
+	device        string
+	reads, writes uint64 // completed operations
+	readSectors   uint64
+	writeSectors  uint64
+	ioTimeMs      uint64 // time spent doing I/O
+}
+
+// parseDiskstats reads /proc/diskstats, skipping loop and ram devices
+func parseDiskstats(r io.Reader) ([]diskStats, error) {
+	var disks []diskStats
+
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 14 {
+			continue
+		}
+		device := fields[2]
+		if strings.HasPrefix(device, "loop") || strings.HasPrefix(device, "ram") {
+			continue
+		}
+
+		var v [14]uint64
+		for i := 3; i < 14; i++ {
+			n, err := strconv.ParseUint(fields[i], 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("invalid diskstats for %s: %w", device, err)
+			}
+			v[i] = n
+		}
+		disks = append(disks, diskStats{
+			device:       device,
+			reads:        v[3],
+			readSectors:  v[5],
+			writes:       v[7],
+			writeSectors: v[9],
+			ioTimeMs:     v[12],
+		})
+	}
+	return disks, scanner.Err()
+}
+
+// netStats holds the counters of one /proc/net/dev interface
+type netStats struct {
+	device string
+	// indexed by direction: 0 receive, 1 transmit
+	bytes, packets, errors, dropped [2]uint64
+}
+
+// parseNetDev reads /proc/net/dev
+func parseNetDev(r io.Reader) ([]netStats, error) {
+	var stats []netStats
+
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		name, rest, ok := strings.Cut(scanner.Text(), ":")
+		if !ok {
+			continue
+		}
+		fields := strings.Fields(rest)
+		if len(fields) < 12 {
+			continue
+		}
+
+		var v [12]uint64
+		for i := range v {
+			n, err := strconv.ParseUint(fields[i], 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("invalid net/dev for %s: %w", strings.TrimSpace(name), err)
+			}
+			v[i] = n
+		}
+		stats = append(stats, netStats{
+			device:  strings.TrimSpace(name),
+			bytes:   [2]uint64{v[0], v[8]},
+			packets: [2]uint64{v[1], v[9]},
+			errors:  [2]uint64{v[2], v[10]},
+			dropped: [2]uint64{v[3], v[11]},
+		})
+	}
+	return stats, scanner.Err()
+}
+
+// parseLoadavg reads the 1, 5 and 15 minute load averages
+func parseLoadavg(r io.Reader) ([3]float64, error) {
+	var load [3]float64
+
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return load, err
+	}
+	fields := strings.Fields(string(data))
+	if len(fields) < 3 {
+		return load, fmt.Errorf("unexpected loadavg %q", strings.TrimSpace(string(data)))
+	}
+	for i := range load {
+		if load[i], err = strconv.ParseFloat(fields[i], 64); err != nil {
+			return load, fmt.Errorf("invalid loadavg: %w", err)
+		}
+	}
+	return load, nil
+}
@@ -0,0 +1,364 @@
+// Package hostmetrics collects node-level metrics from /proc
+package hostmetrics
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"time"
+
+	"github.com/gaurav/watchingcat/internal/config"
+	"github.com/gaurav/watchingcat/pkg/models"
+	"go.uber.org/zap"
+)
+
+const (
+	defaultInterval = time.Minute
+
+	// clockTicks is USER_HZ, the unit of /proc/stat. It is 100 on every
+	// architecture Linux exposes to user space.
+	clockTicks = 100
+
+	// sectorSize is the unit of /proc/diskstats, regardless of the device
+	sectorSize = 512
+)
+
+// directions label the two sides of disk and network counters
+var (
+	diskDirections    = [2]string{"read", "write"}
+	networkDirections = [2]string{"receive", "transmit"}
+)
+
+// Consumer receives collected metrics. An error means they were refused,
+// typically because buffers are full; that collection is lost.
+type Consumer interface {
+	ReceiveMetrics(metrics []models.Metric) error
+}
+
+// Receiver reads /proc on an interval and emits host metrics
+type Receiver struct {
+	root     string
+	interval time.Duration
+	scrapers []string
+	resource map[string]string
+	consumer Consumer
+	logger   *zap.Logger
+
+	// prevCPU is the previous total cpu line, to derive utilization
+	prevCPU *cpuTimes
+
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+// scrapeFunc reads one group of metrics into the batch
+type scrapeFunc func(r *Receiver, b *batch) error
+
+var scrapeFuncs = map[string]scrapeFunc{
+	"cpu":     (*Receiver).scrapeCPU,
+	"memory":  (*Receiver).scrapeMemory,
+	"disk":    (*Receiver).scrapeDisk,
+	"network": (*Receiver).scrapeNetwork,
+	"load":    (*Receiver).scrapeLoad,
+}
+
+// allScrapers is the order scrapers run in when none are configured
+var allScrapers = []string{"cpu", "memory", "disk", "network", "load"}
+
+// NewReceiver validates cfg's scrapers and resolves the host's identity
+func NewReceiver(cfg config.HostMetricsReceiverConfig, consumer Consumer, logger *zap.Logger) (*Receiver, error) {
+	if cfg.CollectionInterval <= 0 {
+		cfg.CollectionInterval = defaultInterval
+	}
+	if cfg.RootPath == "" {
+		cfg.RootPath = "/"
+	}
+
+	scrapers := cfg.Scrapers
+	if len(scrapers) == 0 {
+		scrapers = allScrapers
+	}
+	seen := make(map[string]bool)
+	for _, name := range scrapers {
+		if _, ok := scrapeFuncs[name]; !ok {
+			return nil, fmt.Errorf("unknown scraper %q", name)
+		}
+		if seen[name] {
+			return nil, fmt.Errorf("duplicate scraper %q", name)
+		}
+		seen[name] = true
+	}
+
+	hostname, err := hostName(cfg.HostName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve host name: %w", err)
+	}
+
+	return &Receiver{
+		root:     cfg.RootPath,
+		interval: cfg.CollectionInterval,
+		scrapers: scrapers,
+		resource: map[string]string{
+			"host.name": hostname,
+			"host.arch": runtime.GOARCH,
+			"os.type":   runtime.GOOS,
+		},
+		consumer: consumer,
+		logger:   logger,
+	}, nil
+}
+
+// hostName returns the configured name, else the node name Kubernetes
+// passes through the downward API, else the OS host name. In a daemonset
+// the OS host name is the pod's, not the node's.
+func hostName(configured string) (string, error) {
+	if configured != "" {
+		return configured, nil
+	}
+	for _, env := range []string{"K8S_NODE_NAME", "NODE_NAME"} {
+		if name := os.Getenv(env); name != "" {
+			return name, nil
+		}
+	}
+	return os.Hostname()
+}
+
+// Start collects right away, then on the collection interval
+func (r *Receiver) Start(ctx context.Context) error {
+	ctx, r.cancel = context.WithCancel(ctx)
+	r.done = make(chan struct{})
+
+	r.logger.Info("Host metrics receiver starting",
+		zap.String("root_path", r.root),
+		zap.Strings("scrapers", r.scrapers),
+		zap.Duration("interval", r.interval),
+	)
+
+	go func() {
+		defer close(r.done)
+		ticker := time.NewTicker(r.interval)
+		defer ticker.Stop()
+
+		for {
+			r.collect(time.Now())
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+	return nil
+}
+
+// Shutdown stops collecting, waiting for a collection in flight until ctx
+// is done
+func (r *Receiver) Shutdown(ctx context.Context) error {
+	if r.cancel == nil {
+		return nil
+	}
+	r.cancel()
+
+	select {
+	case <-r.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// collect runs every scraper and hands the result to the consumer. A
+// failing scraper is logged and the others still report.
+func (r *Receiver) collect(now time.Time) {
+	b := &batch{now: now, resource: r.resource}
+	for _, name := range r.scrapers {
+		if err := scrapeFuncs[name](r, b); err != nil {
+			r.logger.Warn("Host metrics scraper failed",
+				zap.String("scraper", name),
+				zap.Error(err),
+			)
+		}
+	}
+	if len(b.metrics) == 0 {
+		return
+	}
+
+	if err := r.consumer.ReceiveMetrics(b.metrics); err != nil {
+		r.logger.Warn("Host metrics refused",
+			zap.Int("metrics", len(b.metrics)),
+			zap.Error(err),
+		)
+	}
+}
+
+// open opens a file under the receiver's proc directory
+func (r *Receiver) open(name string) (*os.File, error) {
+	return os.Open(filepath.Join(r.root, "proc", name))
+}
+
+func (r *Receiver) scrapeCPU(b *batch) error {
+	f, err := r.open("stat")
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	times, err := parseStat(f)
+	if err != nil {
+		return err
+	}
+
+	for _, t := range times[1:] {
+		for i, state := range cpuStates {
+			b.add("system.cpu.time", "counter", float64(t.ticks[i])/clockTicks, "cpu", t.cpu, "state", state)
+		}
+	}
+
+	// Utilization needs two reads, so the first collection has none
+	total := times[0]
+	if prev := r.prevCPU; prev != nil && total.total() > prev.total() {
+		elapsed := float64(total.total() - prev.total())
+		for i, state := range cpuStates {
+			var delta uint64
+			if total.ticks[i] > prev.ticks[i] {
+				delta = total.ticks[i] - prev.ticks[i]
+			}
+			b.add("system.cpu.utilization", "gauge", float64(delta)/elapsed, "state", state)
+		}
+	}
+	r.prevCPU = &total
+	return nil
+}
+
+func (r *Receiver) scrapeMemory(b *batch) error {
+	f, err := r.open("meminfo")
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	info, err := parseMeminfo(f)
+	if err != nil {
+		return err
+	}
+
+	total := info["MemTotal"]
+	free, buffered := info["MemFree"], info["Buffers"]
+	cached := info["Cached"] + info["SReclaimable"]
+	var used uint64
+	if total > free+buffered+cached {
+		used = total - free - buffered - cached
+	}
+
+	usage := []struct {
+		state string
+		bytes uint64
+	}{
+		{"used", used},
+		{"free", free},
+		{"buffered", buffered},
+		{"cached", cached},
+	}
+	for _, u := range usage {
+		b.add("system.memory.usage", "gauge", float64(u.bytes), "state", u.state)
+		if total > 0 {
+			b.add("system.memory.utilization", "gauge", float64(u.bytes)/float64(total), "state", u.state)
+		}
+	}
+	return nil
+}
+
+func (r *Receiver) scrapeDisk(b *batch) error {
+	f, err := r.open("diskstats")
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	disks, err := parseDiskstats(f)
+	if err != nil {
+		return err
+	}
+
+	for _, d := range disks {
+		sectors := [2]uint64{d.readSectors, d.writeSectors}
+		ops := [2]uint64{d.reads, d.writes}
+		for i, direction := range diskDirections {
+			b.add("system.disk.io", "counter", float64(sectors[i]*sectorSize), "device", d.device, "direction", direction)
+			b.add("system.disk.operations", "counter", float64(ops[i]), "device", d.device, "direction", direction)
+		}
+		b.add("system.disk.io_time", "counter", float64(d.ioTimeMs)/1000, "device", d.device)
+	}
+	return nil
+}
+
+func (r *Receiver) scrapeNetwork(b *batch) error {
+	f, err := r.open("net/dev")
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	stats, err := parseNetDev(f)
+	if err != nil {
+		return err
+	}
+
+	for _, s := range stats {
+		for i, direction := range networkDirections {
+			b.add("system.network.io", "counter", float64(s.bytes[i]), "device", s.device, "direction", direction)
+			b.add("system.network.packets", "counter", float64(s.packets[i]), "device", s.device, "direction", direction)
+			b.add("system.network.errors", "counter", float64(s.errors[i]), "device", s.device, "direction", direction)
+			b.add("system.network.dropped", "counter", float64(s.dropped[i]), "device", s.device, "direction", direction)
+		}
+	}
+	return nil
+}
+
+func (r *Receiver) scrapeLoad(b *batch) error {
+	f, err := r.open("loadavg")
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	load, err := parseLoadavg(f)
+	if err != nil {
+		return err
+	}
+
+	b.add("system.cpu.load_average.1m", "gauge", load[0])
+	b.add("system.cpu.load_average.5m", "gauge", load[1])
+	b.add("system.cpu.load_average.15m", "gauge", load[2])
+	return nil
+}
+
+// batch accumulates one collection's metrics
+type batch struct {
+	now      time.Time
+	resource map[string]string
+	metrics  []models.Metric
+}
+
+// add appends a metric carrying the host resource attributes and the
+// given attribute pairs
+func (b *batch) add(name, metricType string, value float64, attrs ...string) {
+	attributes := make(map[string]string, len(b.resource)+len(attrs)/2)
+	for k, v := range b.resource {
+		attributes[k] = v
+	}
+	for i := 0; i+1 < len(attrs); i += 2 {
+		attributes[attrs[i]] = attrs[i+1]
+	}
+
+	b.metrics = append(b.metrics, models.Metric{
+		Name:       name,
+		Type:       metricType,
+		Value:      value,
+		Timestamp:  b.now,
+		Attributes: attributes,
+	})
+}
@@ -0,0 +1,242 @@
+package hostmetrics
+
+import (
+	"context"
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/gaurav/watchingcat/internal/config"
+	"github.com/gaurav/watchingcat/pkg/models"
+	"go.uber.org/zap"
+)
+
+// recordingConsumer keeps the metrics it receives
+type recordingConsumer struct {
+	metrics []models.Metric
+}
+
+func (c *recordingConsumer) ReceiveMetrics(metrics []models.Metric) error {
+	c.metrics = append(c.metrics, metrics...)
+	return nil
+}
+
+func (c *recordingConsumer) find(name string, attrs map[string]string) *models.Metric {
+	for i, m := range c.metrics {
+		if m.Name != name {
+			continue
+		}
+		match := true
+		for k, v := range attrs {
+			if m.Attributes[k] != v {
+				match = false
+			}
+		}
+		if match {
+			return &c.metrics[i]
+		}
+	}
+	return nil
+}
+
+const (
+	statBefore = `cpu  1000 0 500 8000 100 0 0 0 0 0
+cpu0 600 0 300 4000 50 0 0 0 0 0
+cpu1 400 0 200 4000 50 0 0 0 0 0
+intr 12345
+ctxt 67890
+`
+	statAfter = `cpu  1100 0 550 8300 150 0 0 0 0 0
+cpu0 650 0 325 4150 75 0 0 0 0 0
+cpu1 450 0 225 4150 75 0 0 0 0 0
+`
+	meminfo = `MemTotal:        1000 kB
+MemFree:          400 kB
+MemAvailable:     700 kB
+Buffers:          100 kB
+Cached:           150 kB
+SReclaimable:      50 kB
+`
+	diskstats = `   7       0 loop0 10 0 20 1 0 0 0 0 0 1 1 0 0 0 0 0 0
+ 259       0 nvme0n1 100 5 2000 40 50 3 800 60 0 1500 100 0 0 0 0 0 0
+`
+	netDev = `Inter-|   Receive                                                |  Transmit
+ face |bytes    packets errs drop fifo frame compressed multicast|bytes    packets errs drop fifo colls carrier compressed
+    lo:    500       5    0    0    0     0          0         0      500       5    0    0    0     0       0          0
+  eth0: 123456     100    1    2    0     0          0         0    65432      80    3    4    0     0       0          0
+`
+	loadavg = "0.74 0.34 0.26 2/72 5191\n"
+)
+
+// fakeRoot writes proc files under a temporary root path
+func fakeRoot(t *testing.T, files map[string]string) string {
+	t.Helper()
+	root := t.TempDir()
+	for name, content := range files {
+		path := filepath.Join(root, "proc", name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return root
+}
+
+func TestCollect(t *testing.T) {
+	root := fakeRoot(t, map[string]string{
+		"stat":      statBefore,
+		"meminfo":   meminfo,
+		"diskstats": diskstats,
+		"net/dev":   netDev,
+		"loadavg":   loadavg,
+	})
+
+	consumer := &recordingConsumer{}
+	r, err := NewReceiver(config.HostMetricsReceiverConfig{RootPath: root}, consumer, zap.NewNop())
+	if err != nil {
+		t.Fatalf("NewReceiver failed: %v", err)
+	}
+	r.collect(time.Now())
+
+	cpu := consumer.find("system.cpu.time", map[string]string{"cpu": "cpu1", "state": "user"})
+	if cpu == nil || cpu.Type != "counter" || cpu.Value != 4 {
+		t.Fatalf("Expected 400 ticks as 4 seconds of user time, got %+v", cpu)
+	}
+	if cpu.Attributes["host.name"] == "" || cpu.Attributes["os.type"] == "" {
+		t.Errorf("Expected host resource attributes, got %v", cpu.Attributes)
+	}
+	if consumer.find("system.cpu.utilization", nil) != nil {
+		t.Error("Expected no utilization from a single read")
+	}
+
+	mem := map[string]float64{"used": 300 * 1024, "free": 400 * 1024, "buffered": 100 * 1024, "cached": 200 * 1024}
+	for state, want := range mem {
+		if m := consumer.find("system.memory.usage", map[string]string{"state": state}); m == nil || m.Value != want {
+			t.Errorf("Expected %s memory of %v bytes, got %+v", state, want, m)
+		}
+	}
+	if m := consumer.find("system.memory.utilization", map[string]string{"state": "used"}); m == nil || m.Value != 0.3 {
+		t.Errorf("Expected used utilization 0.3, got %+v", m)
+	}
+
+	if consumer.find("system.disk.io", map[string]string{"device": "loop0"}) != nil {
+		t.Error("Expected loop devices to be skipped")
+	}
+	if d := consumer.find("system.disk.io", map[string]string{"device": "nvme0n1", "direction": "write"}); d == nil || d.Value != 800*512 {
+		t.Errorf("Expected 800 sectors written as bytes, got %+v", d)
+	}
+	if d := consumer.find("system.disk.operations", map[string]string{"device": "nvme0n1", "direction": "read"}); d == nil || d.Value != 100 {
+		t.Errorf("Expected 100 reads, got %+v", d)
+	}
+	if d := consumer.find("system.disk.io_time", map[string]string{"device": "nvme0n1"}); d == nil || d.Value != 1.5 {
+		t.Errorf("Expected 1.5s of I/O time, got %+v", d)
+	}
+
+	if n := consumer.find("system.network.io", map[string]string{"device": "eth0", "direction": "transmit"}); n == nil || n.Value != 65432 {
+		t.Errorf("Expected transmitted bytes, got %+v", n)
+	}
+	if n := consumer.find("system.network.dropped", map[string]string{"device": "eth0", "direction": "receive"}); n == nil || n.Value != 2 {
+		t.Errorf("Expected received drops, got %+v", n)
+	}
+
+	if l := consumer.find("system.cpu.load_average.5m", nil); l == nil || l.Type != "gauge" || l.Value != 0.34 {
+		t.Errorf("Expected the 5m load average, got %+v", l)
+	}
+}
+
+func TestCPUUtilization(t *testing.T) {
+	root := fakeRoot(t, map[string]string{"stat": statBefore})
+
+	consumer := &recordingConsumer{}
+	r, err := NewReceiver(config.HostMetricsReceiverConfig{RootPath: root, Scrapers: []string{"cpu"}}, consumer, zap.NewNop())
+	if err != nil {
+		t.Fatalf("NewReceiver failed: %v", err)
+	}
+	r.collect(time.Now())
+
+	if err := os.WriteFile(filepath.Join(root, "proc", "stat"), []byte(statAfter), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	r.collect(time.Now())
+
+	// 500 ticks elapsed: 100 user, 50 system, 300 idle, 50 iowait
+	want := map[string]float64{"user": 0.2, "system": 0.1, "idle": 0.6, "iowait": 0.1, "steal": 0}
+	for state, v := range want {
+		m := consumer.find("system.cpu.utilization", map[string]string{"state": state})
+		if m == nil || math.Abs(m.Value-v) > 1e-9 {
+			t.Errorf("Expected %s utilization %v, got %+v", state, v, m)
+		}
+	}
+}
+
+func TestFailingScraperDoesNotStopOthers(t *testing.T) {
+	root := fakeRoot(t, map[string]string{"loadavg": loadavg})
+
+	consumer := &recordingConsumer{}
+	r, err := NewReceiver(config.HostMetricsReceiverConfig{RootPath: root, Scrapers: []string{"memory", "load"}}, consumer, zap.NewNop())
+	if err != nil {
+		t.Fatalf("NewReceiver failed: %v", err)
+	}
+	r.collect(time.Now())
+
+	if consumer.find("system.cpu.load_average.1m", nil) == nil {
+		t.Error("Expected load metrics despite the missing meminfo")
+	}
+}
+
+func TestNewReceiverValidatesScrapers(t *testing.T) {
+	for _, scrapers := range [][]string{{"gpu"}, {"cpu", "cpu"}} {
+		_, err := NewReceiver(config.HostMetricsReceiverConfig{Scrapers: scrapers}, &recordingConsumer{}, zap.NewNop())
+		if err == nil {
+			t.Errorf("Expected an error for scrapers %v", scrapers)
+		}
+	}
+}
+
+func TestHostName(t *testing.T) {
+	t.Setenv("K8S_NODE_NAME", "")
+	t.Setenv("NODE_NAME", "node-b")
+	if name, _ := hostName(""); name != "node-b" {
+		t.Errorf("Expected NODE_NAME to be used, got %q", name)
+	}
+
+	t.Setenv("K8S_NODE_NAME", "node-a")
+	if name, _ := hostName(""); name != "node-a" {
+		t.Errorf("Expected K8S_NODE_NAME to take precedence, got %q", name)
+	}
+	if name, _ := hostName("configured"); name != "configured" {
+		t.Errorf("Expected the configured name to take precedence, got %q", name)
+	}
+
+	t.Setenv("K8S_NODE_NAME", "")
+	t.Setenv("NODE_NAME", "")
+	hostname, _ := os.Hostname()
+	if name, _ := hostName(""); name != hostname {
+		t.Errorf("Expected the OS host name %q, got %q", hostname, name)
+	}
+}
+
+func TestReceiverStartAndShutdown(t *testing.T) {
+	root := fakeRoot(t, map[string]string{"loadavg": loadavg})
+
+	r, err := NewReceiver(config.HostMetricsReceiverConfig{
+		RootPath:           root,
+		Scrapers:           []string{"load"},
+		CollectionInterval: 10 * time.Millisecond,
+	}, &recordingConsumer{}, zap.NewNop())
+	if err != nil {
+		t.Fatalf("NewReceiver failed: %v", err)
+	}
+
+	if err := r.Start(context.Background()); err != nil {
+		t.Fatalf("Start failed: %v", err)
+	}
+	time.Sleep(30 * time.Millisecond)
+	if err := r.Shutdown(context.Background()); err != nil {
+		t.Errorf("Shutdown failed: %v", err)
+	}
+}
@@ -0,0 +1,40 @@
+// Package httpbody reads request bodies for the collector's HTTP receivers
+package httpbody
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"net/http"
+)
+
+// MaxSize limits both the raw and the decompressed body
+const MaxSize = 32 << 20
+
+// Read reads the request body, decompressing it when gzip-encoded
+func Read(w http.ResponseWriter, r *http.Request) ([]byte, error) {
+	var reader io.Reader = http.MaxBytesReader(w, r.Body, MaxSize)
+
+	switch r.Header.Get("Content-Encoding") {
+	case "", "identity":
+	case "gzip":
+		gz, err := gzip.NewReader(reader)
+		if err != nil {
+			return nil, fmt.Errorf("invalid gzip body: %w", err)
+		}
+		defer gz.Close()
+		reader = io.LimitReader(gz, MaxSize+1)
+	default:
+		return nil, fmt.Errorf("unsupported content encoding %q", r.Header.Get("Content-Encoding"))
+	}
+
+	body, err := io.ReadAll(reader)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read body: %w", err)
+	}
+	if len(body) > MaxSize {
+		return nil, fmt.Errorf("body exceeds %d bytes", MaxSize)
+	}
+
+	return body, nil
+}
@@ -0,0 +1,44 @@
+package httpbody
+
+import (
+	"bytes"
+	"compress/gzip"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestRead(t *testing.T) {
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	gz.Write([]byte("payload"))
+	gz.Close()
+
+	req := httptest.NewRequest("POST", "/", &buf)
+	req.Header.Set("Content-Encoding", "gzip")
+	body, err := Read(httptest.NewRecorder(), req)
+	if err != nil || string(body) != "payload" {
+		t.Errorf("Expected the gzip body to be decompressed, got %q and %v", body, err)
+	}
+
+	req = httptest.NewRequest("POST", "/", bytes.NewReader([]byte("payload")))
+	req.Header.Set("Content-Encoding", "br")
+	if _, err := Read(httptest.NewRecorder(), req); err == nil {
+		t.Error("Expected an unsupported encoding to be rejected")
+	}
+}
+
+func TestReadLimitsDecompressedSize(t *testing.T) {
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	gz.Write(make([]byte, MaxSize+1))
+	gz.Close()
+	if buf.Len() > MaxSize {
+		t.Fatalf("Expected the compressed body to fit the limit, got %d bytes", buf.Len())
+	}
+
+	req := httptest.NewRequest("POST", "/", &buf)
+	req.Header.Set("Content-Encoding", "gzip")
+	if _, err := Read(httptest.NewRecorder(), req); err == nil {
+		t.Error("Expected a body decompressing past the limit to be rejected")
+	}
+}
@@ -0,0 +1,537 @@
+package otlp
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gaurav/watchingcat/pkg/models"
+	commonpb "go.opentelemetry.io/proto/otlp/common/v1"
+	logspb "go.opentelemetry.io/proto/otlp/logs/v1"
+	metricspb "go.opentelemetry.io/proto/otlp/metrics/v1"
+	resourcepb "go.opentelemetry.io/proto/otlp/resource/v1"
+	tracepb "go.opentelemetry.io/proto/otlp/trace/v1"
+)
+
+// ServiceNameKey is the resource attribute identifying the emitting service
+const ServiceNameKey = "service.name"
+
+// ConvertSpans converts OTLP resource spans into model spans
+func ConvertSpans(resourceSpans []*tracepb.ResourceSpans) []models.Span {
+	var spans []models.Span
+
+	for _, rs := range resourceSpans {
+		resourceAttrs := resourceAttributes(rs.GetResource())
+
+		for _, ss := range rs.GetScopeSpans() {
+			for _, s := range ss.GetSpans() {
+				attrs := mergeAttributes(resourceAttrs, s.GetAttributes())
+				addScope(attrs, ss.GetScope())
+
+				span := models.Span{
+					TraceID:    hex.EncodeToString(s.GetTraceId()),
+					SpanID:     hex.EncodeToString(s.GetSpanId()),
+					ParentID:   hex.EncodeToString(s.GetParentSpanId()),
+					Name:       s.GetName(),
+					Kind:       spanKind(s.GetKind()),
+					StartTime:  unixNano(s.GetStartTimeUnixNano()),
+					EndTime:    unixNano(s.GetEndTimeUnixNano()),
+					Attributes: attrs,
+					Events:     make([]models.SpanEvent, 0, len(s.GetEvents())),
+					Status: models.SpanStatus{
+						Code:    statusCode(s.GetStatus().GetCode()),
+						Message: s.GetStatus().GetMessage(),
+					},
+				}
+
+				for _, e := range s.GetEvents() {
+					span.Events = append(span.Events, models.SpanEvent{
+						Name:       e.GetName(),
+						Timestamp:  unixNano(e.GetTimeUnixNano()),
+						Attributes: mergeAttributes(nil, e.GetAttributes()),
+					})
+				}
+
+				spans = append(spans, span)
+			}
+		}
+	}
+
+	return spans
+}
+
+// ConvertLogs converts OTLP resource logs into model log records
+func ConvertLogs(resourceLogs []*logspb.ResourceLogs) []models.LogRecord {
+	var logs []models.LogRecord
+
+	for _, rl := range resourceLogs {
+		resourceAttrs := resourceAttributes(rl.GetResource())
+		serviceName := resourceAttrs[ServiceNameKey]
+
+		for _, sl := range rl.GetScopeLogs() {
+			for _, l := range sl.GetLogRecords() {
+				attrs := mergeAttributes(resourceAttrs, l.GetAttributes())
+				addScope(attrs, sl.GetScope())
+
+				timestamp := l.GetTimeUnixNano()
+				if timestamp == 0 {
+					timestamp = l.GetObservedTimeUnixNano()
+				}
+
+				logs = append(logs, models.LogRecord{
+					Timestamp:   unixNano(timestamp),
+					TraceID:     hex.EncodeToString(l.GetTraceId()),
+					SpanID:      hex.EncodeToString(l.GetSpanId()),
+					Severity:    severity(l.GetSeverityNumber(), l.GetSeverityText()),
+					Message:     anyValueString(l.GetBody()),
+					Attributes:  attrs,
+					ServiceName: serviceName,
+				})
+			}
+		}
+	}
+
+	return logs
+}
+
+// ConvertMetrics converts OTLP resource metrics into model metric points.
+// Every data point becomes one models.Metric; summaries are expanded into
+// per-quantile gauges plus _sum and _count counters.
+func ConvertMetrics(resourceMetrics []*metricspb.ResourceMetrics) []models.Metric {
+	var metrics []models.Metric
+
+	for _, rm := range resourceMetrics {
+		resourceAttrs := resourceAttributes(rm.GetResource())
+		serviceName := resourceAttrs[ServiceNameKey]
+
+		point := func(name, metricType string, value float64, ts uint64, attrs []*commonpb.KeyValue) models.Metric {
+			return models.Metric{
+				Name:        name,
+				Type:        metricType,
+				Value:       value,
+				Timestamp:   unixNano(ts),
+				Attributes:  mergeAttributes(resourceAttrs, attrs),
+				ServiceName: serviceName,
+			}
+		}
+
+		for _, sm := range rm.GetScopeMetrics() {
+			for _, m := range sm.GetMetrics() {
+				name := m.GetName()
+
+				switch data := m.GetData().(type) {
+				case *metricspb.Metric_Gauge:
+					for _, dp := range data.Gauge.GetDataPoints() {
+						metrics = append(metrics, point(name, "gauge", numberValue(dp), dp.GetTimeUnixNano(), dp.GetAttributes()))
+					}
+
+				case *metricspb.Metric_Sum:
+					metricType := "gauge"
+					if data.Sum.GetIsMonotonic() {
+						metricType = "counter"
+					}
+					for _, dp := range data.Sum.GetDataPoints() {
+						metric := point(name, metricType, numberValue(dp), dp.GetTimeUnixNano(), dp.GetAttributes())
+						metric.Temporality = temporality(data.Sum.GetAggregationTemporality())
+						metrics = append(metrics, metric)
+					}
+
+				case *metricspb.Metric_Histogram:
+					for _, dp := range data.Histogram.GetDataPoints() {
+						metric := point(name, "histogram", dp.GetSum(), dp.GetTimeUnixNano(), dp.GetAttributes())
+						metric.Histogram = &models.HistogramData{
+							Count:   dp.GetCount(),
+							Sum:     dp.GetSum(),
+							Bounds:  dp.GetExplicitBounds(),
+							Buckets: dp.GetBucketCounts(),
+						}
+						metric.Temporality = temporality(data.Histogram.GetAggregationTemporality())
+						metrics = append(metrics, metric)
+					}
+
+				case *metricspb.Metric_ExponentialHistogram:
+					for _, dp := range data.ExponentialHistogram.GetDataPoints() {
+						metric := point(name, "histogram", dp.GetSum(), dp.GetTimeUnixNano(), dp.GetAttributes())
+						metric.Histogram = exponentialToExplicit(dp)
+						metric.Temporality = temporality(data.ExponentialHistogram.GetAggregationTemporality())
+						metrics = append(metrics, metric)
+					}
+
+				case *metricspb.Metric_Summary:
+					for _, dp := range data.Summary.GetDataPoints() {
+						ts := dp.GetTimeUnixNano()
+						metrics = append(metrics,
+							point(name+"_sum", "counter", dp.GetSum(), ts, dp.GetAttributes()),
+							point(name+"_count", "counter", float64(dp.GetCount()), ts, dp.GetAttributes()),
+						)
+						for _, q := range dp.GetQuantileValues() {
+							metric := point(name, "gauge", q.GetValue(), ts, dp.GetAttributes())
+							metric.Attributes["quantile"] = strconv.FormatFloat(q.GetQuantile(), 'g', -1, 64)
+							metrics = append(metrics, metric)
+						}
+					}
+				}
+			}
+		}
+	}
+
+	return metrics
+}
+
+// temporality maps OTLP aggregation temporality onto models.Metric's
+func temporality(t metricspb.AggregationTemporality) string {
+	if t == metricspb.AggregationTemporality_AGGREGATION_TEMPORALITY_DELTA {
+		return models.TemporalityDelta
+	}
+	return ""
+}
+
+// exponentialToExplicit flattens an exponential histogram into explicit
+// bounds. Negative and zero buckets are folded into the first (<= 0) bucket.
+func exponentialToExplicit(dp *metricspb.ExponentialHistogramDataPoint) *models.HistogramData {
+	base := math.Pow(2, math.Pow(2, -float64(dp.GetScale())))
+	offset := dp.GetPositive().GetOffset()
+	positive := dp.GetPositive().GetBucketCounts()
+
+	nonPositive := dp.GetZeroCount()
+	for _, c := range dp.GetNegative().GetBucketCounts() {
+		nonPositive += c
+	}
+
+	hist := &models.HistogramData{
+		Count:   dp.GetCount(),
+		Sum:     dp.GetSum(),
+		Bounds:  make([]float64, 0, len(positive)+1),
+		Buckets: make([]uint64, 0, len(positive)+2),
+	}
+
+	hist.Bounds = append(hist.Bounds, 0)
+	hist.Buckets = append(hist.Buckets, nonPositive)
+	for i, c := range positive {
+		hist.Bounds = append(hist.Bounds, math.Pow(base, float64(offset)+float64(i)+1))
+		hist.Buckets = append(hist.Buckets, c)
+	}
+	hist.Buckets = append(hist.Buckets, 0)
+
+	return hist
+}
+
+// resourceAttributes flattens resource attributes into a string map
+func resourceAttributes(resource *resourcepb.Resource) map[string]string {
+	return mergeAttributes(nil, resource.GetAttributes())
+}
+
+// mergeAttributes copies base and overlays the given key-values on top
+func mergeAttributes(base map[string]string, kvs []*commonpb.KeyValue) map[string]string {
+	attrs := make(map[string]string, len(base)+len(kvs))
+	for k, v := range base {
+		attrs[k] = v
+	}
+	for _, kv := range kvs {
+		attrs[kv.GetKey()] = anyValueString(kv.GetValue())
+	}
+	return attrs
+}
+
+// addScope records the instrumentation scope on the attributes
+func addScope(attrs map[string]string, scope *commonpb.InstrumentationScope) {
+	if scope.GetName() != "" {
+		attrs["otel.scope.name"] = scope.GetName()
+	}
+	if scope.GetVersion() != "" {
+		attrs["otel.scope.version"] = scope.GetVersion()
+	}
+}
+
+// anyValueString renders an OTLP AnyValue as a string
+func anyValueString(v *commonpb.AnyValue) string {
+	switch val := v.GetValue().(type) {
+	case *commonpb.AnyValue_StringValue:
+		return val.StringValue
+	case *commonpb.AnyValue_BoolValue:
+		return strconv.FormatBool(val.BoolValue)
+	case *commonpb.AnyValue_IntValue:
+		return strconv.FormatInt(val.IntValue, 10)
+	case *commonpb.AnyValue_DoubleValue:
+		return strconv.FormatFloat(val.DoubleValue, 'g', -1, 64)
+	case *commonpb.AnyValue_BytesValue:
+		return base64.StdEncoding.EncodeToString(val.BytesValue)
+	case *commonpb.AnyValue_ArrayValue, *commonpb.AnyValue_KvlistValue:
+		data, err := json.Marshal(anyValueInterface(v))
+		if err != nil {
+			return ""
+		}
+		return string(data)
+	}
+	return ""
+}
+
+// anyValueInterface converts an AnyValue into plain Go values for JSON encoding
+func anyValueInterface(v *commonpb.AnyValue) interface{} {
+	switch val := v.GetValue().(type) {
+	case *commonpb.AnyValue_StringValue:
+		return val.StringValue
+	case *commonpb.AnyValue_BoolValue:
+		return val.BoolValue
+	case *commonpb.AnyValue_IntValue:
+		return val.IntValue
+	case *commonpb.AnyValue_DoubleValue:
+		return val.DoubleValue
+	case *commonpb.AnyValue_BytesValue:
+		return base64.StdEncoding.EncodeToString(val.BytesValue)
+	case *commonpb.AnyValue_ArrayValue:
+		values := make([]interface{}, 0, len(val.ArrayValue.GetValues()))
+		for _, item := range val.ArrayValue.GetValues() {
+			values = append(values, anyValueInterface(item))
+		}
+		return values
+	case *commonpb.AnyValue_KvlistValue:
+		values := make(map[string]interface{}, len(val.KvlistValue.GetValues()))
+		for _, kv := range val.KvlistValue.GetValues() {
+			values[kv.GetKey()] = anyValueInterface(kv.GetValue())
+		}
+		return values
+	}
+	return nil
+}
+
+// numberValue returns a number data point as float64
+func numberValue(dp *metricspb.NumberDataPoint) float64 {
+	switch v := dp.GetValue().(type) {
+	case *metricspb.NumberDataPoint_AsDouble:
+		return v.AsDouble
+	case *metricspb.NumberDataPoint_AsInt:
+		return float64(v.AsInt)
+	}
+	return 0
+}
+
+// spanKind maps an OTLP span kind to its lowercase name
+func spanKind(kind tracepb.Span_SpanKind) string {
+	switch kind {
+	case tracepb.Span_SPAN_KIND_INTERNAL:
+		return "internal"
+	case tracepb.Span_SPAN_KIND_SERVER:
+		return "server"
+	case tracepb.Span_SPAN_KIND_CLIENT:
+		return "client"
+	case tracepb.Span_SPAN_KIND_PRODUCER:
+		return "producer"
+	case tracepb.Span_SPAN_KIND_CONSUMER:
+		return "consumer"
+	}
+	return "unspecified"
+}
+
+// statusCode maps an OTLP status code to OK, ERROR or UNSET
+func statusCode(code tracepb.Status_StatusCode) string {
+	switch code {
+	case tracepb.Status_STATUS_CODE_OK:
+		return "OK"
+	case tracepb.Status_STATUS_CODE_ERROR:
+		return "ERROR"
+	}
+	return "UNSET"
+}
+
+// severity normalizes an OTLP severity into trace, debug, info, warn, error or fatal
+func severity(number logspb.SeverityNumber, text string) string {
+	switch {
+	case number >= logspb.SeverityNumber_SEVERITY_NUMBER_FATAL:
+		return "fatal"
+	case number >= logspb.SeverityNumber_SEVERITY_NUMBER_ERROR:
+		return "error"
+	case number >= logspb.SeverityNumber_SEVERITY_NUMBER_WARN:
+		return "warn"
+	case number >= logspb.SeverityNumber_SEVERITY_NUMBER_INFO:
+		return "info"
+	case number >= logspb.SeverityNumber_SEVERITY_NUMBER_DEBUG:
+		return "debug"
+	case number >= logspb.SeverityNumber_SEVERITY_NUMBER_TRACE:
+		return "trace"
+	}
+	return strings.ToLower(text)
+}
+
+// unixNano converts nanoseconds since epoch into a time, keeping zero as zero
+func unixNano(ns uint64) time.Time {
+	if ns == 0 {
+		return time.Time{}
+	}
+	return time.Unix(0, int64(ns)).UTC()
+}
+
+// resourceKeyPrefixes identifies span attributes that came from the resource.
+// ConvertSpans flattens resource attributes onto spans; these are moved back
+// onto the resource when spans are forwarded.
+var resourceKeyPrefixes = []string{
+	"service.", "telemetry.", "host.", "process.", "deployment.",
+	"container.", "k8s.", "os.", "cloud.",
+}
+
+// SpansToResourceSpans converts model spans back into OTLP resource spans,
+// grouping them by service and instrumentation scope
+func SpansToResourceSpans(spans []models.Span) []*tracepb.ResourceSpans {
+	var result []*tracepb.ResourceSpans
+	resources := make(map[string]*tracepb.ResourceSpans)
+	scopes := make(map[string]*tracepb.ScopeSpans)
+
+	for _, span := range spans {
+		resourceAttrs := make(map[string]string)
+		spanAttrs := make(map[string]string, len(span.Attributes))
+		scope := &commonpb.InstrumentationScope{}
+
+		for k, v := range span.Attributes {
+			switch {
+			case k == "otel.scope.name":
+				scope.Name = v
+			case k == "otel.scope.version":
+				scope.Version = v
+			case isResourceKey(k):
+				resourceAttrs[k] = v
+			default:
+				spanAttrs[k] = v
+			}
+		}
+
+		resourceKey := attributesKey(resourceAttrs)
+		rs, ok := resources[resourceKey]
+		if !ok {
+			rs = &tracepb.ResourceSpans{
+				Resource: &resourcepb.Resource{Attributes: keyValues(resourceAttrs)},
+			}
+			resources[resourceKey] = rs
+			result = append(result, rs)
+		}
+
+		scopeKey := resourceKey + "\xff" + scope.Name + "\xff" + scope.Version
+		ss, ok := scopes[scopeKey]
+		if !ok {
+			ss = &tracepb.ScopeSpans{Scope: scope}
+			scopes[scopeKey] = ss
+			rs.ScopeSpans = append(rs.ScopeSpans, ss)
+		}
+
+		ss.Spans = append(ss.Spans, toProtoSpan(span, spanAttrs))
+	}
+
+	return result
+}
+
+// toProtoSpan converts a model span into an OTLP span with the given attributes
+func toProtoSpan(span models.Span, attrs map[string]string) *tracepb.Span {
+	traceID, _ := hex.DecodeString(span.TraceID)
+	spanID, _ := hex.DecodeString(span.SpanID)
+	parentID, _ := hex.DecodeString(span.ParentID)
+
+	s := &tracepb.Span{
+		TraceId:           traceID,
+		SpanId:            spanID,
+		ParentSpanId:      parentID,
+		Name:              span.Name,
+		Kind:              protoSpanKind(span.Kind),
+		StartTimeUnixNano: toUnixNano(span.StartTime),
+		EndTimeUnixNano:   toUnixNano(span.EndTime),
+		Attributes:        keyValues(attrs),
+		Status: &tracepb.Status{
+			Code:    protoStatusCode(span.Status.Code),
+			Message: span.Status.Message,
+		},
+	}
+
+	for _, e := range span.Events {
+		s.Events = append(s.Events, &tracepb.Span_Event{
+			Name:         e.Name,
+			TimeUnixNano: toUnixNano(e.Timestamp),
+			Attributes:   keyValues(e.Attributes),
+		})
+	}
+
+	return s
+}
+
+// keyValues converts a string map into sorted OTLP key-values
+func keyValues(attrs map[string]string) []*commonpb.KeyValue {
+	keys := make([]string, 0, len(attrs))
+	for k := range attrs {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	kvs := make([]*commonpb.KeyValue, 0, len(keys))
+	for _, k := range keys {
+		kvs = append(kvs, &commonpb.KeyValue{
+			Key:   k,
+			Value: &commonpb.AnyValue{Value: &commonpb.AnyValue_StringValue{StringValue: attrs[k]}},
+		})
+	}
+	return kvs
+}
+
+// attributesKey builds a stable grouping key for an attribute set
+func attributesKey(attrs map[string]string) string {
+	keys := make([]string, 0, len(attrs))
+	for k := range attrs {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var b strings.Builder
+	for _, k := range keys {
+		b.WriteString(k)
+		b.WriteByte('=')
+		b.WriteString(attrs[k])
+		b.WriteByte(0xff)
+	}
+	return b.String()
+}
+
+func isResourceKey(key string) bool {
+	for _, prefix := range resourceKeyPrefixes {
+		if strings.HasPrefix(key, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// protoSpanKind is the inverse of spanKind
+func protoSpanKind(kind string) tracepb.Span_SpanKind {
+	switch kind {
+	case "internal":
+		return tracepb.Span_SPAN_KIND_INTERNAL
+	case "server":
+		return tracepb.Span_SPAN_KIND_SERVER
+	case "client":
+		return tracepb.Span_SPAN_KIND_CLIENT
+	case "producer":
+		return tracepb.Span_SPAN_KIND_PRODUCER
+	case "consumer":
+		return tracepb.Span_SPAN_KIND_CONSUMER
+	}
+	return tracepb.Span_SPAN_KIND_UNSPECIFIED
+}
+
+// protoStatusCode is the inverse of statusCode
+func protoStatusCode(code string) tracepb.Status_StatusCode {
+	switch code {
+	case "OK":
+		return tracepb.Status_STATUS_CODE_OK
+	case "ERROR":
+		return tracepb.Status_STATUS_CODE_ERROR
+	}
+	return tracepb.Status_STATUS_CODE_UNSET
+}
+
+// toUnixNano converts a time to nanoseconds since epoch, keeping zero as zero
+func toUnixNano(t time.Time) uint64 {
+	if t.IsZero() {
+		return 0
+	}
+	return uint64(t.UnixNano())
+}
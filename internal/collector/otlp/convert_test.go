@@ -0,0 +1,210 @@
+package otlp
+
+import (
+	"testing"
+
+	commonpb "go.opentelemetry.io/proto/otlp/common/v1"
+	logspb "go.opentelemetry.io/proto/otlp/logs/v1"
+	metricspb "go.opentelemetry.io/proto/otlp/metrics/v1"
+	resourcepb "go.opentelemetry.io/proto/otlp/resource/v1"
+	tracepb "go.opentelemetry.io/proto/otlp/trace/v1"
+	"google.golang.org/protobuf/proto"
+)
+
+func stringKV(key, value string) *commonpb.KeyValue {
+	return &commonpb.KeyValue{
+		Key:   key,
+		Value: &commonpb.AnyValue{Value: &commonpb.AnyValue_StringValue{StringValue: value}},
+	}
+}
+
+func testResource() *resourcepb.Resource {
+	return &resourcepb.Resource{
+		Attributes: []*commonpb.KeyValue{stringKV("service.name", "checkoutservice")},
+	}
+}
+
+func TestConvertSpans(t *testing.T) {
+	spans := ConvertSpans([]*tracepb.ResourceSpans{{
+		Resource: testResource(),
+		ScopeSpans: []*tracepb.ScopeSpans{{
+			Spans: []*tracepb.Span{{
+				TraceId:           []byte{0x01, 0x02, 0x03, 0x04, 0x05, 0x06, 0x07, 0x08, 0x09, 0x0a, 0x0b, 0x0c, 0x0d, 0x0e, 0x0f, 0x10},
+				SpanId:            []byte{0xaa, 0xbb, 0xcc, 0xdd, 0xee, 0xff, 0x00, 0x11},
+				Name:              "POST /checkout",
+				Kind:              tracepb.Span_SPAN_KIND_SERVER,
+				StartTimeUnixNano: 1000,
+				EndTimeUnixNano:   2000,
+				Attributes:        []*commonpb.KeyValue{stringKV("http.method", "POST")},
+				Events: []*tracepb.Span_Event{{
+					Name:       "exception",
+					Attributes: []*commonpb.KeyValue{stringKV("exception.message", "boom")},
+				}},
+				Status: &tracepb.Status{Code: tracepb.Status_STATUS_CODE_ERROR, Message: "failed"},
+			}},
+		}},
+	}})
+
+	if len(spans) != 1 {
+		t.Fatalf("Expected 1 span, got %d", len(spans))
+	}
+
+	span := spans[0]
+	if span.TraceID != "0102030405060708090a0b0c0d0e0f10" {
+		t.Errorf("Unexpected trace ID %s", span.TraceID)
+	}
+	if span.SpanID != "aabbccddeeff0011" {
+		t.Errorf("Unexpected span ID %s", span.SpanID)
+	}
+	if span.ParentID != "" {
+		t.Errorf("Expected empty parent ID, got %s", span.ParentID)
+	}
+	if span.Kind != "server" {
+		t.Errorf("Expected kind 'server', got '%s'", span.Kind)
+	}
+	if span.Status.Code != "ERROR" {
+		t.Errorf("Expected status ERROR, got %s", span.Status.Code)
+	}
+	if span.Attributes["service.name"] != "checkoutservice" {
+		t.Error("Expected resource attribute service.name to be kept")
+	}
+	if span.Attributes["http.method"] != "POST" {
+		t.Error("Expected span attribute http.method")
+	}
+	if len(span.Events) != 1 || span.Events[0].Attributes["exception.message"] != "boom" {
+		t.Error("Expected exception event to be converted")
+	}
+	if span.EndTime.Sub(span.StartTime) != 1000 {
+		t.Errorf("Unexpected duration %v", span.EndTime.Sub(span.StartTime))
+	}
+}
+
+func TestSpansToResourceSpansRoundTrip(t *testing.T) {
+	original := []*tracepb.ResourceSpans{{
+		Resource: testResource(),
+		ScopeSpans: []*tracepb.ScopeSpans{{
+			Scope: &commonpb.InstrumentationScope{Name: "checkout", Version: "1.0"},
+			Spans: []*tracepb.Span{{
+				TraceId:           []byte{0x01, 0x02, 0x03, 0x04, 0x05, 0x06, 0x07, 0x08, 0x09, 0x0a, 0x0b, 0x0c, 0x0d, 0x0e, 0x0f, 0x10},
+				SpanId:            []byte{0xaa, 0xbb, 0xcc, 0xdd, 0xee, 0xff, 0x00, 0x11},
+				ParentSpanId:      []byte{0x11, 0x22, 0x33, 0x44, 0x55, 0x66, 0x77, 0x88},
+				Name:              "POST /checkout",
+				Kind:              tracepb.Span_SPAN_KIND_CLIENT,
+				StartTimeUnixNano: 1000,
+				EndTimeUnixNano:   2000,
+				Attributes:        []*commonpb.KeyValue{stringKV("http.method", "POST")},
+				Status:            &tracepb.Status{Code: tracepb.Status_STATUS_CODE_ERROR, Message: "failed"},
+			}},
+		}},
+	}}
+
+	converted := SpansToResourceSpans(ConvertSpans(original))
+	if len(converted) != 1 || len(converted[0].GetScopeSpans()) != 1 {
+		t.Fatalf("Expected one resource with one scope, got %v", converted)
+	}
+
+	resource := converted[0].GetResource().GetAttributes()
+	if len(resource) != 1 || resource[0].GetKey() != "service.name" {
+		t.Errorf("Expected service.name to move back to the resource, got %v", resource)
+	}
+
+	scope := converted[0].GetScopeSpans()[0]
+	if scope.GetScope().GetName() != "checkout" || scope.GetScope().GetVersion() != "1.0" {
+		t.Errorf("Unexpected scope %v", scope.GetScope())
+	}
+
+	want := original[0].GetScopeSpans()[0].GetSpans()[0]
+	got := scope.GetSpans()[0]
+	if !proto.Equal(got, want) {
+		t.Errorf("Span did not round-trip:\n got  %v\n want %v", got, want)
+	}
+}
+
+func TestConvertLogs(t *testing.T) {
+	logs := ConvertLogs([]*logspb.ResourceLogs{{
+		Resource: testResource(),
+		ScopeLogs: []*logspb.ScopeLogs{{
+			LogRecords: []*logspb.LogRecord{{
+				ObservedTimeUnixNano: 5000,
+				SeverityNumber:       logspb.SeverityNumber_SEVERITY_NUMBER_WARN2,
+				SeverityText:         "WARNING",
+				Body:                 &commonpb.AnyValue{Value: &commonpb.AnyValue_StringValue{StringValue: "payment slow"}},
+				TraceId:              []byte{0x01, 0x02, 0x03, 0x04, 0x05, 0x06, 0x07, 0x08, 0x09, 0x0a, 0x0b, 0x0c, 0x0d, 0x0e, 0x0f, 0x10},
+			}},
+		}},
+	}})
+
+	if len(logs) != 1 {
+		t.Fatalf("Expected 1 log, got %d", len(logs))
+	}
+
+	log := logs[0]
+	if log.Severity != "warn" {
+		t.Errorf("Expected severity 'warn', got '%s'", log.Severity)
+	}
+	if log.Message != "payment slow" {
+		t.Errorf("Unexpected message '%s'", log.Message)
+	}
+	if log.ServiceName != "checkoutservice" {
+		t.Errorf("Expected service name 'checkoutservice', got '%s'", log.ServiceName)
+	}
+	if log.Timestamp.UnixNano() != 5000 {
+		t.Error("Expected observed time to be used when time is unset")
+	}
+	if log.TraceID == "" {
+		t.Error("Expected trace ID to be set")
+	}
+}
+
+func TestConvertMetrics(t *testing.T) {
+	metrics := ConvertMetrics([]*metricspb.ResourceMetrics{{
+		Resource: testResource(),
+		ScopeMetrics: []*metricspb.ScopeMetrics{{
+			Metrics: []*metricspb.Metric{
+				{
+					Name: "http_requests_total",
+					Data: &metricspb.Metric_Sum{Sum: &metricspb.Sum{
+						IsMonotonic:            true,
+						AggregationTemporality: metricspb.AggregationTemporality_AGGREGATION_TEMPORALITY_DELTA,
+						DataPoints: []*metricspb.NumberDataPoint{{
+							Value: &metricspb.NumberDataPoint_AsInt{AsInt: 42},
+						}},
+					}},
+				},
+				{
+					Name: "http_request_duration",
+					Data: &metricspb.Metric_Histogram{Histogram: &metricspb.Histogram{
+						DataPoints: []*metricspb.HistogramDataPoint{{
+							Count:          3,
+							Sum:            proto.Float64(1.5),
+							ExplicitBounds: []float64{0.1, 1},
+							BucketCounts:   []uint64{1, 1, 1},
+						}},
+					}},
+				},
+			},
+		}},
+	}})
+
+	if len(metrics) != 2 {
+		t.Fatalf("Expected 2 metrics, got %d", len(metrics))
+	}
+
+	if metrics[0].Type != "counter" || metrics[0].Value != 42 {
+		t.Errorf("Expected counter with value 42, got %s %f", metrics[0].Type, metrics[0].Value)
+	}
+	if metrics[0].Temporality != "delta" || metrics[1].Temporality != "" {
+		t.Errorf("Expected only the sum to be delta, got %q and %q", metrics[0].Temporality, metrics[1].Temporality)
+	}
+	if metrics[0].ServiceName != "checkoutservice" {
+		t.Errorf("Expected service name 'checkoutservice', got '%s'", metrics[0].ServiceName)
+	}
+
+	hist := metrics[1]
+	if hist.Type != "histogram" || hist.Histogram == nil {
+		t.Fatal("Expected histogram with bucket data")
+	}
+	if hist.Histogram.Count != 3 || len(hist.Histogram.Buckets) != 3 {
+		t.Errorf("Unexpected histogram data %+v", hist.Histogram)
+	}
+}
@@ -0,0 +1,136 @@
+package otlp
+
+import (
+	"time"
+
+	"github.com/gaurav/watchingcat/pkg/models"
+	collectorlogs "go.opentelemetry.io/proto/otlp/collector/logs/v1"
+	collectormetrics "go.opentelemetry.io/proto/otlp/collector/metrics/v1"
+	collectortrace "go.opentelemetry.io/proto/otlp/collector/trace/v1"
+	"go.uber.org/zap"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/durationpb"
+)
+
+// Consumer receives telemetry decoded from OTLP requests. An error means
+// the batch was refused, typically because buffers are full, and is reported
+// to the client as retryable RESOURCE_EXHAUSTED.
+type Consumer interface {
+	ReceiveSpans(spans []models.Span) error
+	ReceiveLogs(logs []models.LogRecord) error
+	ReceiveMetrics(metrics []models.Metric) error
+}
+
+// retryDelay is the backoff hint sent with refused requests
+const retryDelay = time.Second
+
+// exporter converts OTLP export requests and hands the result to a Consumer.
+// It is shared by the gRPC and HTTP receivers so both report partial
+// success the same way.
+type exporter struct {
+	consumer Consumer
+	logger   *zap.Logger
+}
+
+// exportTraces forwards valid spans and reports the rejected ones
+func (e *exporter) exportTraces(req *collectortrace.ExportTraceServiceRequest) (*collectortrace.ExportTraceServiceResponse, error) {
+	spans := ConvertSpans(req.GetResourceSpans())
+
+	var rejected int64
+	valid := spans[:0]
+	for _, span := range spans {
+		if span.TraceID == "" || span.SpanID == "" {
+			rejected++
+			continue
+		}
+		valid = append(valid, span)
+	}
+
+	if len(valid) > 0 {
+		if err := e.consumer.ReceiveSpans(valid); err != nil {
+			return nil, e.refused("spans", len(valid), err)
+		}
+	}
+
+	e.logger.Debug("OTLP spans received",
+		zap.Int("spans", len(spans)),
+		zap.Int64("rejected", rejected),
+	)
+
+	resp := &collectortrace.ExportTraceServiceResponse{}
+	if rejected > 0 {
+		resp.PartialSuccess = &collectortrace.ExportTracePartialSuccess{
+			RejectedSpans: rejected,
+			ErrorMessage:  "spans without a trace ID or span ID were rejected",
+		}
+	}
+	return resp, nil
+}
+
+// exportMetrics forwards valid metric points and reports the rejected ones
+func (e *exporter) exportMetrics(req *collectormetrics.ExportMetricsServiceRequest) (*collectormetrics.ExportMetricsServiceResponse, error) {
+	metrics := ConvertMetrics(req.GetResourceMetrics())
+
+	var rejected int64
+	valid := metrics[:0]
+	for _, metric := range metrics {
+		if metric.Name == "" {
+			rejected++
+			continue
+		}
+		valid = append(valid, metric)
+	}
+
+	if len(valid) > 0 {
+		if err := e.consumer.ReceiveMetrics(valid); err != nil {
+			return nil, e.refused("metrics", len(valid), err)
+		}
+	}
+
+	e.logger.Debug("OTLP metrics received",
+		zap.Int("metrics", len(metrics)),
+		zap.Int64("rejected", rejected),
+	)
+
+	resp := &collectormetrics.ExportMetricsServiceResponse{}
+	if rejected > 0 {
+		resp.PartialSuccess = &collectormetrics.ExportMetricsPartialSuccess{
+			RejectedDataPoints: rejected,
+			ErrorMessage:       "metrics without a name were rejected",
+		}
+	}
+	return resp, nil
+}
+
+// exportLogs forwards log records
+func (e *exporter) exportLogs(req *collectorlogs.ExportLogsServiceRequest) (*collectorlogs.ExportLogsServiceResponse, error) {
+	logs := ConvertLogs(req.GetResourceLogs())
+
+	if len(logs) > 0 {
+		if err := e.consumer.ReceiveLogs(logs); err != nil {
+			return nil, e.refused("logs", len(logs), err)
+		}
+	}
+
+	e.logger.Debug("OTLP logs received", zap.Int("logs", len(logs)))
+
+	return &collectorlogs.ExportLogsServiceResponse{}, nil
+}
+
+// refused builds the RESOURCE_EXHAUSTED status returned when the consumer
+// refuses a batch. The RetryInfo detail tells OTLP clients to retry.
+func (e *exporter) refused(signal string, count int, err error) error {
+	e.logger.Warn("OTLP data refused",
+		zap.String("signal", signal),
+		zap.Int("count", count),
+		zap.Error(err),
+	)
+
+	st := status.New(codes.ResourceExhausted, err.Error())
+	if detailed, derr := st.WithDetails(&errdetails.RetryInfo{RetryDelay: durationpb.New(retryDelay)}); derr == nil {
+		st = detailed
+	}
+	return st.Err()
+}
@@ -0,0 +1,56 @@
+package otlp
+
+import (
+	"context"
+
+	collectorlogs "go.opentelemetry.io/proto/otlp/collector/logs/v1"
+	collectormetrics "go.opentelemetry.io/proto/otlp/collector/metrics/v1"
+	collectortrace "go.opentelemetry.io/proto/otlp/collector/trace/v1"
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+
+	// Register the gzip codec so SDKs sending compressed payloads are accepted
+	_ "google.golang.org/grpc/encoding/gzip"
+)
+
+// RegisterServices registers the OTLP trace, metrics and logs services on a gRPC server
+func RegisterServices(server *grpc.Server, consumer Consumer, logger *zap.Logger) {
+	e := &exporter{consumer: consumer, logger: logger}
+
+	collectortrace.RegisterTraceServiceServer(server, &traceService{exporter: e})
+	collectormetrics.RegisterMetricsServiceServer(server, &metricsService{exporter: e})
+	collectorlogs.RegisterLogsServiceServer(server, &logsService{exporter: e})
+}
+
+// traceService implements the OTLP TraceService
+type traceService struct {
+	collectortrace.UnimplementedTraceServiceServer
+	exporter *exporter
+}
+
+// Export receives a batch of spans
+func (s *traceService) Export(ctx context.Context, req *collectortrace.ExportTraceServiceRequest) (*collectortrace.ExportTraceServiceResponse, error) {
+	return s.exporter.exportTraces(req)
+}
+
+// metricsService implements the OTLP MetricsService
+type metricsService struct {
+	collectormetrics.UnimplementedMetricsServiceServer
+	exporter *exporter
+}
+
+// Export receives a batch of metrics
+func (s *metricsService) Export(ctx context.Context, req *collectormetrics.ExportMetricsServiceRequest) (*collectormetrics.ExportMetricsServiceResponse, error) {
+	return s.exporter.exportMetrics(req)
+}
+
+// logsService implements the OTLP LogsService
+type logsService struct {
+	collectorlogs.UnimplementedLogsServiceServer
+	exporter *exporter
+}
+
+// Export receives a batch of log records
+func (s *logsService) Export(ctx context.Context, req *collectorlogs.ExportLogsServiceRequest) (*collectorlogs.ExportLogsServiceResponse, error) {
+	return s.exporter.exportLogs(req)
+}
@@ -0,0 +1,238 @@
+package otlp
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"mime"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gaurav/watchingcat/internal/collector/httpbody"
+	collectorlogs "go.opentelemetry.io/proto/otlp/collector/logs/v1"
+	collectormetrics "go.opentelemetry.io/proto/otlp/collector/metrics/v1"
+	collectortrace "go.opentelemetry.io/proto/otlp/collector/trace/v1"
+	"go.uber.org/zap"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+)
+
+const (
+	contentTypeProtobuf = "application/x-protobuf"
+	contentTypeJSON     = "application/json"
+)
+
+// httpHandler serves the OTLP/HTTP endpoints
+type httpHandler struct {
+	exporter *exporter
+	logger   *zap.Logger
+}
+
+// NewHTTPHandler returns a handler serving the OTLP/HTTP /v1/traces,
+// /v1/metrics and /v1/logs endpoints. Both binary protobuf and JSON bodies
+// are accepted, optionally gzip-compressed.
+func NewHTTPHandler(consumer Consumer, logger *zap.Logger) http.Handler {
+	h := &httpHandler{
+		exporter: &exporter{consumer: consumer, logger: logger},
+		logger:   logger,
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/v1/traces", h.handleTraces)
+	mux.HandleFunc("/v1/metrics", h.handleMetrics)
+	mux.HandleFunc("/v1/logs", h.handleLogs)
+
+	return mux
+}
+
+// handleTraces handles POST /v1/traces
+func (h *httpHandler) handleTraces(w http.ResponseWriter, r *http.Request) {
+	req := &collectortrace.ExportTraceServiceRequest{}
+	contentType, ok := h.readRequest(w, r, req)
+	if !ok {
+		return
+	}
+	resp, err := h.exporter.exportTraces(req)
+	if err != nil {
+		h.writeRefused(w, contentType, err)
+		return
+	}
+	h.writeMessage(w, contentType, http.StatusOK, resp)
+}
+
+// handleMetrics handles POST /v1/metrics
+func (h *httpHandler) handleMetrics(w http.ResponseWriter, r *http.Request) {
+	req := &collectormetrics.ExportMetricsServiceRequest{}
+	contentType, ok := h.readRequest(w, r, req)
+	if !ok {
+		return
+	}
+	resp, err := h.exporter.exportMetrics(req)
+	if err != nil {
+		h.writeRefused(w, contentType, err)
+		return
+	}
+	h.writeMessage(w, contentType, http.StatusOK, resp)
+}
+
+// handleLogs handles POST /v1/logs
+func (h *httpHandler) handleLogs(w http.ResponseWriter, r *http.Request) {
+	req := &collectorlogs.ExportLogsServiceRequest{}
+	contentType, ok := h.readRequest(w, r, req)
+	if !ok {
+		return
+	}
+	resp, err := h.exporter.exportLogs(req)
+	if err != nil {
+		h.writeRefused(w, contentType, err)
+		return
+	}
+	h.writeMessage(w, contentType, http.StatusOK, resp)
+}
+
+// readRequest validates the request and decodes its body into msg.
+// On failure the error response has already been written.
+func (h *httpHandler) readRequest(w http.ResponseWriter, r *http.Request, msg proto.Message) (string, bool) {
+	setCORSHeaders(w, r)
+
+	if r.Method == http.MethodOptions {
+		w.WriteHeader(http.StatusNoContent)
+		return "", false
+	}
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", "POST, OPTIONS")
+		h.writeError(w, contentTypeJSON, http.StatusMethodNotAllowed, "method not allowed")
+		return "", false
+	}
+
+	contentType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if err != nil || (contentType != contentTypeProtobuf && contentType != contentTypeJSON) {
+		h.writeError(w, contentTypeJSON, http.StatusUnsupportedMediaType,
+			fmt.Sprintf("unsupported content type %q", r.Header.Get("Content-Type")))
+		return "", false
+	}
+
+	body, err := httpbody.Read(w, r)
+	if err != nil {
+		h.writeError(w, contentType, http.StatusBadRequest, err.Error())
+		return "", false
+	}
+
+	if contentType == contentTypeJSON {
+		err = unmarshalJSON(body, msg)
+	} else {
+		err = proto.Unmarshal(body, msg)
+	}
+	if err != nil {
+		h.logger.Debug("Failed to decode OTLP request",
+			zap.String("path", r.URL.Path),
+			zap.Error(err),
+		)
+		h.writeError(w, contentType, http.StatusBadRequest, fmt.Sprintf("failed to decode request: %v", err))
+		return "", false
+	}
+
+	return contentType, true
+}
+
+// unmarshalJSON decodes an OTLP/JSON payload. OTLP encodes trace and span
+// IDs as hex rather than the base64 protojson expects, so they are
+// converted before decoding.
+func unmarshalJSON(body []byte, msg proto.Message) error {
+	// UseNumber keeps nanosecond timestamps from losing precision as float64
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	decoder.UseNumber()
+
+	var doc interface{}
+	if err := decoder.Decode(&doc); err != nil {
+		return err
+	}
+
+	normalized, err := json.Marshal(hexIDsToBase64(doc))
+	if err != nil {
+		return err
+	}
+
+	return protojson.UnmarshalOptions{DiscardUnknown: true}.Unmarshal(normalized, msg)
+}
+
+// hexIDsToBase64 rewrites hex-encoded traceId, spanId and parentSpanId values in place
+func hexIDsToBase64(v interface{}) interface{} {
+	switch val := v.(type) {
+	case map[string]interface{}:
+		for k, item := range val {
+			switch k {
+			case "traceId", "spanId", "parentSpanId":
+				if s, ok := item.(string); ok {
+					if raw, err := hex.DecodeString(s); err == nil {
+						val[k] = base64.StdEncoding.EncodeToString(raw)
+					}
+				}
+			default:
+				val[k] = hexIDsToBase64(item)
+			}
+		}
+	case []interface{}:
+		for i, item := range val {
+			val[i] = hexIDsToBase64(item)
+		}
+	}
+	return v
+}
+
+// writeMessage encodes msg in the request's content type
+func (h *httpHandler) writeMessage(w http.ResponseWriter, contentType string, statusCode int, msg proto.Message) {
+	var (
+		data []byte
+		err  error
+	)
+	if contentType == contentTypeProtobuf {
+		data, err = proto.Marshal(msg)
+	} else {
+		contentType = contentTypeJSON
+		data, err = protojson.Marshal(msg)
+	}
+	if err != nil {
+		h.logger.Error("Failed to encode OTLP response", zap.Error(err))
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", contentType)
+	w.WriteHeader(statusCode)
+	w.Write(data)
+}
+
+// writeError writes a google.rpc.Status body as required by OTLP/HTTP
+func (h *httpHandler) writeError(w http.ResponseWriter, contentType string, statusCode int, message string) {
+	code := codes.InvalidArgument
+	if statusCode == http.StatusMethodNotAllowed || statusCode == http.StatusUnsupportedMediaType {
+		code = codes.Unimplemented
+	}
+	h.writeMessage(w, contentType, statusCode, status.New(code, message).Proto())
+}
+
+// writeRefused reports a refused batch as 429 with the gRPC status as body,
+// which OTLP/HTTP clients treat as retryable
+func (h *httpHandler) writeRefused(w http.ResponseWriter, contentType string, err error) {
+	w.Header().Set("Retry-After", strconv.Itoa(int(retryDelay/time.Second)))
+	h.writeMessage(w, contentType, http.StatusTooManyRequests, status.Convert(err).Proto())
+}
+
+// setCORSHeaders allows browser SDKs to post telemetry cross-origin
+func setCORSHeaders(w http.ResponseWriter, r *http.Request) {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return
+	}
+	w.Header().Set("Access-Control-Allow-Origin", origin)
+	w.Header().Set("Access-Control-Allow-Methods", "POST, OPTIONS")
+	w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Content-Encoding")
+	w.Header().Set("Access-Control-Max-Age", "86400")
+	w.Header().Add("Vary", "Origin")
+}
@@ -0,0 +1,221 @@
+package otlp
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gaurav/watchingcat/pkg/models"
+	collectorlogs "go.opentelemetry.io/proto/otlp/collector/logs/v1"
+	collectortrace "go.opentelemetry.io/proto/otlp/collector/trace/v1"
+	logspb "go.opentelemetry.io/proto/otlp/logs/v1"
+	tracepb "go.opentelemetry.io/proto/otlp/trace/v1"
+	"go.uber.org/zap"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+)
+
+// recordingConsumer keeps what it receives, or refuses everything with err
+type recordingConsumer struct {
+	spans   []models.Span
+	logs    []models.LogRecord
+	metrics []models.Metric
+	err     error
+}
+
+func (c *recordingConsumer) ReceiveSpans(spans []models.Span) error {
+	c.spans = append(c.spans, spans...)
+	return c.err
+}
+
+func (c *recordingConsumer) ReceiveLogs(logs []models.LogRecord) error {
+	c.logs = append(c.logs, logs...)
+	return c.err
+}
+
+func (c *recordingConsumer) ReceiveMetrics(metrics []models.Metric) error {
+	c.metrics = append(c.metrics, metrics...)
+	return c.err
+}
+
+const jsonTraces = `{
+  "resourceSpans": [{
+    "resource": {"attributes": [{"key": "service.name", "value": {"stringValue": "frontend"}}]},
+    "scopeSpans": [{
+      "spans": [
+        {
+          "traceId": "5b8efff798038103d269b633813fc60c",
+          "spanId": "eee19b7ec3c1b174",
+          "name": "GET /products",
+          "kind": 2,
+          "startTimeUnixNano": "1544712660000000000",
+          "endTimeUnixNano": "1544712661000000000"
+        },
+        {"name": "missing ids"}
+      ]
+    }]
+  }]
+}`
+
+func TestHTTPTracesJSON(t *testing.T) {
+	consumer := &recordingConsumer{}
+	handler := NewHTTPHandler(consumer, zap.NewNop())
+
+	req := httptest.NewRequest(http.MethodPost, "/v1/traces", strings.NewReader(jsonTraces))
+	req.Header.Set("Content-Type", "application/json")
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	if len(consumer.spans) != 1 {
+		t.Fatalf("Expected 1 accepted span, got %d", len(consumer.spans))
+	}
+
+	span := consumer.spans[0]
+	if span.TraceID != "5b8efff798038103d269b633813fc60c" {
+		t.Errorf("Unexpected trace ID %s", span.TraceID)
+	}
+	if span.StartTime.UnixNano() != 1544712660000000000 {
+		t.Errorf("Start time lost precision: %d", span.StartTime.UnixNano())
+	}
+	if span.Attributes["service.name"] != "frontend" {
+		t.Error("Expected service.name resource attribute")
+	}
+
+	var resp struct {
+		PartialSuccess struct {
+			RejectedSpans string `json:"rejectedSpans"`
+		} `json:"partialSuccess"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if resp.PartialSuccess.RejectedSpans != "1" {
+		t.Errorf("Expected 1 rejected span, got %q", resp.PartialSuccess.RejectedSpans)
+	}
+}
+
+func TestHTTPTracesGzipProtobuf(t *testing.T) {
+	consumer := &recordingConsumer{}
+	handler := NewHTTPHandler(consumer, zap.NewNop())
+
+	body, err := proto.Marshal(&collectortrace.ExportTraceServiceRequest{
+		ResourceSpans: []*tracepb.ResourceSpans{{
+			ScopeSpans: []*tracepb.ScopeSpans{{
+				Spans: []*tracepb.Span{{
+					TraceId: bytes.Repeat([]byte{0x01}, 16),
+					SpanId:  bytes.Repeat([]byte{0x02}, 8),
+					Name:    "checkout",
+				}},
+			}},
+		}},
+	})
+	if err != nil {
+		t.Fatalf("Failed to marshal request: %v", err)
+	}
+
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	gz.Write(body)
+	gz.Close()
+
+	req := httptest.NewRequest(http.MethodPost, "/v1/traces", &buf)
+	req.Header.Set("Content-Type", "application/x-protobuf")
+	req.Header.Set("Content-Encoding", "gzip")
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d", rec.Code)
+	}
+	if rec.Header().Get("Content-Type") != "application/x-protobuf" {
+		t.Errorf("Expected protobuf response, got %s", rec.Header().Get("Content-Type"))
+	}
+	if len(consumer.spans) != 1 || consumer.spans[0].Name != "checkout" {
+		t.Errorf("Expected span 'checkout' to be received, got %+v", consumer.spans)
+	}
+}
+
+func TestHTTPUnsupportedContentType(t *testing.T) {
+	handler := NewHTTPHandler(&recordingConsumer{}, zap.NewNop())
+
+	req := httptest.NewRequest(http.MethodPost, "/v1/logs", strings.NewReader("hello"))
+	req.Header.Set("Content-Type", "text/plain")
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusUnsupportedMediaType {
+		t.Errorf("Expected status 415, got %d", rec.Code)
+	}
+}
+
+func TestHTTPInvalidBody(t *testing.T) {
+	handler := NewHTTPHandler(&recordingConsumer{}, zap.NewNop())
+
+	req := httptest.NewRequest(http.MethodPost, "/v1/metrics", strings.NewReader("{not json"))
+	req.Header.Set("Content-Type", "application/json")
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("Expected status 400, got %d", rec.Code)
+	}
+}
+
+func TestHTTPRefusedIsRetryable(t *testing.T) {
+	handler := NewHTTPHandler(&recordingConsumer{err: errors.New("buffer full")}, zap.NewNop())
+
+	req := httptest.NewRequest(http.MethodPost, "/v1/traces", strings.NewReader(jsonTraces))
+	req.Header.Set("Content-Type", "application/json")
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusTooManyRequests {
+		t.Fatalf("Expected status 429, got %d", rec.Code)
+	}
+	if rec.Header().Get("Retry-After") == "" {
+		t.Error("Expected a Retry-After header")
+	}
+	if !strings.Contains(rec.Body.String(), "buffer full") {
+		t.Errorf("Expected the refusal reason in the body, got %s", rec.Body.String())
+	}
+}
+
+func TestGRPCRefusedIsResourceExhausted(t *testing.T) {
+	e := &exporter{consumer: &recordingConsumer{err: errors.New("buffer full")}, logger: zap.NewNop()}
+	service := &logsService{exporter: e}
+
+	_, err := service.Export(context.Background(), &collectorlogs.ExportLogsServiceRequest{
+		ResourceLogs: []*logspb.ResourceLogs{{
+			ScopeLogs: []*logspb.ScopeLogs{{
+				LogRecords: []*logspb.LogRecord{{TimeUnixNano: 1}},
+			}},
+		}},
+	})
+
+	st := status.Convert(err)
+	if st.Code() != codes.ResourceExhausted {
+		t.Fatalf("Expected RESOURCE_EXHAUSTED, got %v", err)
+	}
+
+	var hasRetryInfo bool
+	for _, detail := range st.Details() {
+		if _, ok := detail.(*errdetails.RetryInfo); ok {
+			hasRetryInfo = true
+		}
+	}
+	if !hasRetryInfo {
+		t.Error("Expected RetryInfo so clients retry the request")
+	}
+}
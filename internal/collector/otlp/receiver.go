@@ -0,0 +1,103 @@
+package otlp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/gaurav/watchingcat/internal/config"
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+)
+
+// Receiver serves OTLP over gRPC and, if an HTTP endpoint is set, HTTP
+type Receiver struct {
+	cfg      config.OTLPReceiverConfig
+	consumer Consumer
+	logger   *zap.Logger
+
+	grpcServer *grpc.Server
+	httpServer *http.Server
+}
+
+// NewReceiver creates an OTLP receiver handing data to consumer
+func NewReceiver(cfg config.OTLPReceiverConfig, consumer Consumer, logger *zap.Logger) *Receiver {
+	return &Receiver{cfg: cfg, consumer: consumer, logger: logger}
+}
+
+// Start listens on the configured endpoints and serves in the background
+func (r *Receiver) Start(ctx context.Context) error {
+	listener, err := net.Listen("tcp", r.cfg.GRPC.Endpoint)
+	if err != nil {
+		return fmt.Errorf("failed to listen: %w", err)
+	}
+
+	var httpListener net.Listener
+	if endpoint := r.cfg.HTTP.Endpoint; endpoint != "" {
+		httpListener, err = net.Listen("tcp", endpoint)
+		if err != nil {
+			listener.Close()
+			return fmt.Errorf("failed to listen on http endpoint: %w", err)
+		}
+	}
+
+	r.grpcServer = grpc.NewServer()
+	RegisterServices(r.grpcServer, r.consumer, r.logger)
+
+	r.logger.Info("OTLP gRPC receiver starting",
+		zap.String("endpoint", r.cfg.GRPC.Endpoint),
+	)
+
+	go func() {
+		if err := r.grpcServer.Serve(listener); err != nil {
+			r.logger.Error("gRPC server error", zap.Error(err))
+		}
+	}()
+
+	if httpListener != nil {
+		r.httpServer = &http.Server{
+			Handler:     NewHTTPHandler(r.consumer, r.logger),
+			ReadTimeout: 30 * time.Second,
+			IdleTimeout: 60 * time.Second,
+		}
+
+		r.logger.Info("OTLP HTTP receiver starting",
+			zap.String("endpoint", r.cfg.HTTP.Endpoint),
+		)
+
+		go func() {
+			if err := r.httpServer.Serve(httpListener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+				r.logger.Error("HTTP server error", zap.Error(err))
+			}
+		}()
+	}
+
+	return nil
+}
+
+// Shutdown stops accepting requests and waits for in-flight ones until ctx
+// is done
+func (r *Receiver) Shutdown(ctx context.Context) error {
+	var err error
+	if r.httpServer != nil {
+		err = r.httpServer.Shutdown(ctx)
+	}
+
+	if r.grpcServer != nil {
+		stopped := make(chan struct{})
+		go func() {
+			r.grpcServer.GracefulStop()
+			close(stopped)
+		}()
+		select {
+		case <-stopped:
+		case <-ctx.Done():
+			r.grpcServer.Stop()
+		}
+	}
+
+	return err
+}
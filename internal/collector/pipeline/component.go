@@ -0,0 +1,172 @@
+// Package pipeline builds the collector's receivers, processors and
+// exporters from config and routes telemetry between them. Each pipeline
+// carries one signal from its receivers, through its processors in order,
+// to its exporters.
+package pipeline
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/gaurav/watchingcat/internal/collector/exporters"
+	"github.com/gaurav/watchingcat/internal/collector/processors"
+	"github.com/gaurav/watchingcat/internal/config"
+	"github.com/gaurav/watchingcat/pkg/models"
+	"go.uber.org/zap"
+)
+
+// Signal is a type of telemetry
+type Signal string
+
+const (
+	Traces     Signal = "traces"
+	Metrics    Signal = "metrics"
+	Logs       Signal = "logs"
+	Exceptions Signal = "exceptions" // derived from spans by processors, never received
+)
+
+// SignalOf returns the signal carried by a pipeline, named signal[/name]
+func SignalOf(pipeline string) (Signal, error) {
+	switch s := Signal(Type(pipeline)); s {
+	case Traces, Metrics, Logs:
+		return s, nil
+	}
+	return "", fmt.Errorf("pipeline %q must be named traces, metrics or logs, optionally followed by /name", pipeline)
+}
+
+// Type returns the type of a component ID, type[/name]
+func Type(id string) string {
+	typ, _, _ := strings.Cut(id, "/")
+	return typ
+}
+
+// Consumer accepts telemetry from receivers. An error refuses the data, so
+// the sender can retry later.
+type Consumer interface {
+	ReceiveSpans(spans []models.Span) error
+	ReceiveLogs(logs []models.LogRecord) error
+	ReceiveMetrics(metrics []models.Metric) error
+}
+
+// Component is started before telemetry flows and shut down afterwards.
+// Receivers must implement it; exporters may.
+type Component interface {
+	Start(ctx context.Context) error
+	Shutdown(ctx context.Context) error
+}
+
+// AsyncExporter is an exporter that queues batches and calls done once a
+// batch has been delivered
+type AsyncExporter interface {
+	ExportAsync(batch models.TelemetryBatch, done func()) error
+}
+
+// Settings are passed to component factories
+type Settings struct {
+	ID     string
+	Config *config.Config
+	Logger *zap.Logger
+}
+
+// ReceiverFactory creates receivers handing their data to a consumer
+type ReceiverFactory struct {
+	Signals []Signal // signals the receiver produces
+	Create  func(set Settings, cfg config.ComponentConfig, next Consumer) (Component, error)
+}
+
+// ProcessorFactory creates processors. Every pipeline listing a processor
+// gets its own instance.
+type ProcessorFactory struct {
+	Signals []Signal // signals the processor acts on
+	Emits   []Signal // signals the processor adds to batches, such as exceptions derived from spans
+	Create  func(set Settings, cfg config.ComponentConfig) (processors.Processor, error)
+}
+
+// ConnectorFactory creates connectors. A connector is an exporter in
+// pipelines of one signal and a receiver in pipelines of another: what it
+// derives from the data it is sent enters the pipelines listing it as a
+// receiver, and passes through their processors. A connector is shared by
+// every pipeline listing it.
+type ConnectorFactory struct {
+	From   Signal // signal the connector is sent, as an exporter
+	To     Signal // signal it produces, as a receiver
+	Create func(set Settings, cfg config.ComponentConfig, next Consumer) (exporters.Exporter, error)
+}
+
+// ExporterFactory creates exporters. An exporter is shared by every
+// pipeline listing it.
+type ExporterFactory struct {
+	Signals []Signal // signals the exporter sends
+	Create  func(set Settings, cfg config.ComponentConfig) (exporters.Exporter, error)
+}
+
+// Registry maps component types to their factories
+type Registry struct {
+	receivers  map[string]ReceiverFactory
+	processors map[string]ProcessorFactory
+	connectors map[string]ConnectorFactory
+	exporters  map[string]ExporterFactory
+
+	// processorOrder is the registration order, which default pipelines
+	// apply processors in. Default pipelines feeding connectors apply the
+	// first connectorsAfter of them.
+	processorOrder  []string
+	connectorsAfter int
+}
+
+// NewRegistry creates an empty registry
+func NewRegistry() *Registry {
+	return &Registry{
+		receivers:  make(map[string]ReceiverFactory),
+		processors: make(map[string]ProcessorFactory),
+		connectors: make(map[string]ConnectorFactory),
+		exporters:  make(map[string]ExporterFactory),
+	}
+}
+
+// RegisterReceiver registers a receiver type
+func (r *Registry) RegisterReceiver(typ string, f ReceiverFactory) {
+	r.receivers[typ] = f
+}
+
+// RegisterProcessor registers a processor type
+func (r *Registry) RegisterProcessor(typ string, f ProcessorFactory) {
+	if _, ok := r.processors[typ]; !ok {
+		r.processorOrder = append(r.processorOrder, typ)
+	}
+	r.processors[typ] = f
+}
+
+// RegisterConnector registers a connector type. Processors registered
+// before the first connector are the ones default pipelines apply to the
+// data connectors are sent.
+func (r *Registry) RegisterConnector(typ string, f ConnectorFactory) {
+	if len(r.connectors) == 0 {
+		r.connectorsAfter = len(r.processorOrder)
+	}
+	r.connectors[typ] = f
+}
+
+// RegisterExporter registers an exporter type
+func (r *Registry) RegisterExporter(typ string, f ExporterFactory) {
+	r.exporters[typ] = f
+}
+
+func hasSignal(signals []Signal, s Signal) bool {
+	for _, signal := range signals {
+		if signal == s {
+			return true
+		}
+	}
+	return false
+}
+
+func hasAnySignal(signals, of []Signal) bool {
+	for _, s := range of {
+		if hasSignal(signals, s) {
+			return true
+		}
+	}
+	return false
+}
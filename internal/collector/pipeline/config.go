@@ -0,0 +1,239 @@
+package pipeline
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/gaurav/watchingcat/internal/config"
+)
+
+// defaultReceivers is used when no receivers are configured
+var defaultReceivers = map[string]config.ComponentConfig{"otlp": {}}
+
+// Receivers returns the configured receivers, or a single otlp receiver if
+// none are
+func Receivers(cc config.CollectorConfig) map[string]config.ComponentConfig {
+	if len(cc.Receivers) == 0 {
+		return defaultReceivers
+	}
+	return cc.Receivers
+}
+
+// Pipelines returns the pipelines to run. Without declared pipelines, there
+// is one per signal: every receiver and connector producing the signal, the
+// enabled processors in registration order, and the enabled exporters, each
+// where it handles the signal. Connectors are sent data by pipelines of
+// their own, signal/connectors, which apply only the processors registered
+// before them.
+func (r *Registry) Pipelines(cc config.CollectorConfig) map[string]config.PipelineConfig {
+	if len(cc.Pipelines) > 0 {
+		return cc.Pipelines
+	}
+
+	pipelines := make(map[string]config.PipelineConfig)
+	for _, signal := range []Signal{Traces, Metrics, Logs} {
+		var p config.PipelineConfig
+
+		for _, id := range sortedIDs(Receivers(cc)) {
+			if f, ok := r.receivers[Type(id)]; ok && hasSignal(f.Signals, signal) {
+				p.Receivers = append(p.Receivers, id)
+			}
+		}
+		receivers := p.Receivers
+		for _, id := range sortedIDs(cc.Connectors) {
+			if f, ok := r.connectors[Type(id)]; ok && f.To == signal && cc.Connectors[id].Enabled() {
+				p.Receivers = append(p.Receivers, id)
+			}
+		}
+		if len(p.Receivers) == 0 {
+			continue
+		}
+
+		var signals []Signal
+		p.Processors, signals = r.defaultProcessors(cc, signal, r.processorOrder)
+		for _, id := range sortedIDs(cc.Exporters) {
+			if f, ok := r.exporters[Type(id)]; ok && cc.Exporters[id].Enabled() && hasAnySignal(f.Signals, signals) {
+				p.Exporters = append(p.Exporters, id)
+			}
+		}
+		pipelines[string(signal)] = p
+
+		// Connectors only read the signal, so nothing another processor
+		// emits is needed
+		c := config.PipelineConfig{Receivers: receivers}
+		for _, id := range sortedIDs(cc.Connectors) {
+			if f, ok := r.connectors[Type(id)]; ok && f.From == signal && cc.Connectors[id].Enabled() {
+				c.Exporters = append(c.Exporters, id)
+			}
+		}
+		if len(c.Receivers) > 0 && len(c.Exporters) > 0 {
+			c.Processors, _ = r.defaultProcessors(cc, signal, r.processorOrder[:r.connectorsAfter])
+			pipelines[string(signal)+"/connectors"] = c
+		}
+	}
+	return pipelines
+}
+
+// defaultProcessors returns the enabled processors of types handling
+// signal, in the order of types, and the signals they leave in batches
+func (r *Registry) defaultProcessors(cc config.CollectorConfig, signal Signal, types []string) ([]string, []Signal) {
+	var ids []string
+	signals := []Signal{signal}
+	for _, typ := range types {
+		f := r.processors[typ]
+		if !hasSignal(f.Signals, signal) {
+			continue
+		}
+		for _, id := range sortedIDs(cc.Processors) {
+			if Type(id) == typ && cc.Processors[id].Enabled() {
+				ids = append(ids, id)
+				signals = append(signals, f.Emits...)
+			}
+		}
+	}
+	return ids, signals
+}
+
+// Validate checks that every pipeline names a signal and only references
+// configured components of registered types that handle what reaches them,
+// and that every connector both receives and produces data. Declared
+// pipelines also need at least one exporter. All problems found are
+// reported.
+func (r *Registry) Validate(cc config.CollectorConfig) error {
+	pipelines := r.Pipelines(cc)
+	receivers := Receivers(cc)
+
+	var errs []error
+	connectorUse := make(map[string]map[string]bool) // connector ID to "exporter" and "receiver"
+	for _, name := range sortedIDs(pipelines) {
+		p := pipelines[name]
+		fail := func(format string, args ...interface{}) {
+			errs = append(errs, fmt.Errorf("pipeline %q: %s", name, fmt.Sprintf(format, args...)))
+		}
+		connector := func(id, use string) (ConnectorFactory, bool) {
+			f, ok := r.connectors[Type(id)]
+			if !ok {
+				return f, false
+			}
+			if !hasKey(cc.Connectors, id) {
+				fail("connector %q is not configured", id)
+				return f, false
+			}
+			if connectorUse[id] == nil {
+				connectorUse[id] = make(map[string]bool)
+			}
+			connectorUse[id][use] = true
+			return f, true
+		}
+
+		signal, err := SignalOf(name)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+
+		if len(p.Receivers) == 0 {
+			fail("no receivers")
+		}
+		if len(p.Exporters) == 0 && len(cc.Pipelines) > 0 {
+			fail("no exporters")
+		}
+
+		for _, id := range duplicates(p.Receivers, p.Processors, p.Exporters) {
+			fail("%q is listed more than once", id)
+		}
+
+		for _, id := range p.Receivers {
+			if _, isConnector := r.connectors[Type(id)]; isConnector {
+				if f, ok := connector(id, "receiver"); ok && f.To != signal {
+					fail("connector %q does not produce %s", id, signal)
+				}
+				continue
+			}
+			f, ok := r.receivers[Type(id)]
+			switch {
+			case !hasKey(receivers, id):
+				fail("receiver %q is not configured", id)
+			case !ok:
+				fail("unknown receiver type %q", Type(id))
+			case !hasSignal(f.Signals, signal):
+				fail("receiver %q does not produce %s", id, signal)
+			}
+		}
+
+		signals := []Signal{signal}
+		for _, id := range p.Processors {
+			f, ok := r.processors[Type(id)]
+			switch {
+			case !hasKey(cc.Processors, id):
+				fail("processor %q is not configured", id)
+			case !ok:
+				fail("unknown processor type %q", Type(id))
+			case !hasSignal(f.Signals, signal):
+				fail("processor %q does not handle %s", id, signal)
+			default:
+				signals = append(signals, f.Emits...)
+			}
+		}
+
+		for _, id := range p.Exporters {
+			if _, isConnector := r.connectors[Type(id)]; isConnector {
+				if f, ok := connector(id, "exporter"); ok && f.From != signal {
+					fail("connector %q does not accept %s", id, signal)
+				}
+				continue
+			}
+			f, ok := r.exporters[Type(id)]
+			switch {
+			case !hasKey(cc.Exporters, id):
+				fail("exporter %q is not configured", id)
+			case !ok:
+				fail("unknown exporter type %q", Type(id))
+			case !hasAnySignal(f.Signals, signals):
+				fail("exporter %q does not accept %s", id, signal)
+			}
+		}
+	}
+
+	for _, id := range sortedIDs(connectorUse) {
+		use := connectorUse[id]
+		switch {
+		case !use["receiver"]:
+			errs = append(errs, fmt.Errorf("connector %q is not a receiver of any pipeline", id))
+		case !use["exporter"]:
+			errs = append(errs, fmt.Errorf("connector %q is not an exporter of any pipeline", id))
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// duplicates returns the IDs listed more than once within any of lists
+func duplicates(lists ...[]string) []string {
+	var dups []string
+	for _, list := range lists {
+		seen := make(map[string]bool)
+		for _, id := range list {
+			if seen[id] {
+				dups = append(dups, id)
+			}
+			seen[id] = true
+		}
+	}
+	return dups
+}
+
+func hasKey[V any](m map[string]V, key string) bool {
+	_, ok := m[key]
+	return ok
+}
+
+func sortedIDs[V any](m map[string]V) []string {
+	ids := make([]string, 0, len(m))
+	for id := range m {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids
+}
@@ -0,0 +1,225 @@
+package pipeline
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/gaurav/watchingcat/internal/collector/exporters"
+	"github.com/gaurav/watchingcat/internal/collector/processors"
+	"github.com/gaurav/watchingcat/internal/config"
+	"github.com/gaurav/watchingcat/pkg/models"
+)
+
+// nopProcessor passes batches through unchanged
+type nopProcessor struct{}
+
+func (nopProcessor) Process(ctx context.Context, batch models.TelemetryBatch) (models.TelemetryBatch, error) {
+	return batch, nil
+}
+
+// testRegistry registers fake receivers, processors, a connector from
+// traces to metrics and an exporter per signal
+func testRegistry() *Registry {
+	r := NewRegistry()
+	receiver := ReceiverFactory{
+		Signals: []Signal{Traces, Metrics, Logs},
+		Create: func(set Settings, cfg config.ComponentConfig, next Consumer) (Component, error) {
+			return &fakeReceiver{consumer: next}, nil
+		},
+	}
+	r.RegisterReceiver("otlp", receiver)
+	r.RegisterReceiver("recv", receiver)
+
+	nop := func(set Settings, cfg config.ComponentConfig) (processors.Processor, error) {
+		return nopProcessor{}, nil
+	}
+	r.RegisterProcessor("redact", ProcessorFactory{Signals: []Signal{Traces, Logs}, Create: nop})
+	r.RegisterConnector("derive", ConnectorFactory{
+		From: Traces,
+		To:   Metrics,
+		Create: func(set Settings, cfg config.ComponentConfig, next Consumer) (exporters.Exporter, error) {
+			return &fakeExporter{}, nil
+		},
+	})
+	r.RegisterProcessor("sample", ProcessorFactory{Signals: []Signal{Traces}, Create: nop})
+
+	for _, s := range []Signal{Traces, Metrics, Logs} {
+		signals := []Signal{s}
+		r.RegisterExporter(string(s)+"db", ExporterFactory{
+			Signals: signals,
+			Create: func(set Settings, cfg config.ComponentConfig) (exporters.Exporter, error) {
+				return &fakeExporter{}, nil
+			},
+		})
+	}
+	return r
+}
+
+func TestDefaultPipelines(t *testing.T) {
+	cc := config.CollectorConfig{
+		Processors: map[string]config.ComponentConfig{
+			"sample":   {"enabled": true},
+			"redact":   {"enabled": "true"},
+			"redact/b": {"enabled": false},
+		},
+		Connectors: map[string]config.ComponentConfig{
+			"derive": {"enabled": true},
+		},
+		Exporters: map[string]config.ComponentConfig{
+			"tracesdb":  {"enabled": true},
+			"metricsdb": {"enabled": true},
+			"logsdb":    {},
+		},
+	}
+
+	r := testRegistry()
+	got := r.Pipelines(cc)
+	want := map[string]config.PipelineConfig{
+		"traces": {
+			Receivers:  []string{"otlp"},
+			Processors: []string{"redact", "sample"},
+			Exporters:  []string{"tracesdb"},
+		},
+		"traces/connectors": {
+			Receivers:  []string{"otlp"},
+			Processors: []string{"redact"},
+			Exporters:  []string{"derive"},
+		},
+		"metrics": {
+			Receivers: []string{"otlp", "derive"},
+			Exporters: []string{"metricsdb"},
+		},
+		"logs": {
+			Receivers:  []string{"otlp"},
+			Processors: []string{"redact"},
+		},
+	}
+
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Unexpected default pipelines:\n got %+v\nwant %+v", got, want)
+	}
+	if err := r.Validate(cc); err != nil {
+		t.Errorf("Expected default pipelines to be valid, got %v", err)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	base := func() config.CollectorConfig {
+		return config.CollectorConfig{
+			Receivers:  map[string]config.ComponentConfig{"recv": {}, "recv/b": {}},
+			Processors: map[string]config.ComponentConfig{"redact": {}, "sample": {}, "bogus": {}},
+			Connectors: map[string]config.ComponentConfig{"derive": {}},
+			Exporters:  map[string]config.ComponentConfig{"tracesdb": {}, "metricsdb": {}, "logsdb": {}},
+		}
+	}
+
+	tests := []struct {
+		name      string
+		pipelines map[string]config.PipelineConfig
+		wantErr   []string
+	}{
+		{
+			name: "valid with several pipelines per signal",
+			pipelines: map[string]config.PipelineConfig{
+				"traces":         {Receivers: []string{"recv"}, Exporters: []string{"derive"}},
+				"traces/sampled": {Receivers: []string{"recv", "recv/b"}, Processors: []string{"redact", "sample"}, Exporters: []string{"tracesdb"}},
+				"metrics":        {Receivers: []string{"recv", "derive"}, Exporters: []string{"metricsdb"}},
+				"logs":           {Receivers: []string{"recv"}, Exporters: []string{"logsdb"}},
+			},
+		},
+		{
+			name: "connector signal mismatch",
+			pipelines: map[string]config.PipelineConfig{
+				"traces": {Receivers: []string{"derive"}, Exporters: []string{"tracesdb"}},
+				"logs":   {Receivers: []string{"recv"}, Exporters: []string{"derive", "logsdb"}},
+			},
+			wantErr: []string{
+				`connector "derive" does not produce traces`,
+				`connector "derive" does not accept logs`,
+			},
+		},
+		{
+			name: "connector without both ends",
+			pipelines: map[string]config.PipelineConfig{
+				"traces":  {Receivers: []string{"recv"}, Exporters: []string{"derive"}},
+				"metrics": {Receivers: []string{"recv", "derive/x"}, Exporters: []string{"metricsdb"}},
+			},
+			wantErr: []string{
+				`connector "derive/x" is not configured`,
+				`connector "derive" is not a receiver of any pipeline`,
+			},
+		},
+		{
+			name: "unknown signal",
+			pipelines: map[string]config.PipelineConfig{
+				"events": {Receivers: []string{"recv"}, Exporters: []string{"logsdb"}},
+			},
+			wantErr: []string{`pipeline "events" must be named traces, metrics or logs`},
+		},
+		{
+			name: "missing receivers and exporters",
+			pipelines: map[string]config.PipelineConfig{
+				"logs/empty": {},
+			},
+			wantErr: []string{`"logs/empty": no receivers`, `"logs/empty": no exporters`},
+		},
+		{
+			name: "unconfigured and unknown components",
+			pipelines: map[string]config.PipelineConfig{
+				"traces": {
+					Receivers:  []string{"recv/c"},
+					Processors: []string{"bogus", "redact/x"},
+					Exporters:  []string{"tracesdb/x"},
+				},
+			},
+			wantErr: []string{
+				`receiver "recv/c" is not configured`,
+				`unknown processor type "bogus"`,
+				`processor "redact/x" is not configured`,
+				`exporter "tracesdb/x" is not configured`,
+			},
+		},
+		{
+			name: "signal mismatch",
+			pipelines: map[string]config.PipelineConfig{
+				"logs": {Receivers: []string{"recv"}, Processors: []string{"sample"}, Exporters: []string{"tracesdb"}},
+			},
+			wantErr: []string{
+				`processor "sample" does not handle logs`,
+				`exporter "tracesdb" does not accept logs`,
+			},
+		},
+		{
+			name: "duplicates",
+			pipelines: map[string]config.PipelineConfig{
+				"traces": {Receivers: []string{"recv", "recv"}, Exporters: []string{"tracesdb"}},
+			},
+			wantErr: []string{`"recv" is listed more than once`},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cc := base()
+			cc.Pipelines = tt.pipelines
+
+			err := testRegistry().Validate(cc)
+			if len(tt.wantErr) == 0 {
+				if err != nil {
+					t.Fatalf("Expected a valid config, got %v", err)
+				}
+				return
+			}
+			if err == nil {
+				t.Fatalf("Expected errors %v, got none", tt.wantErr)
+			}
+			for _, want := range tt.wantErr {
+				if !strings.Contains(err.Error(), want) {
+					t.Errorf("Expected error to contain %q, got:\n%v", want, err)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,168 @@
+package pipeline
+
+import (
+	"context"
+	"path/filepath"
+	"sync"
+
+	"github.com/gaurav/watchingcat/internal/collector/buffer"
+	"github.com/gaurav/watchingcat/internal/collector/wal"
+	"github.com/gaurav/watchingcat/internal/config"
+	"github.com/gaurav/watchingcat/pkg/models"
+	"go.uber.org/zap"
+)
+
+// ingest holds a receiver's data until it is routed to the receiver's
+// pipelines. With the WAL enabled, each receiver logs to its own directory
+// below the configured one.
+type ingest struct {
+	id        string
+	buffer    *buffer.Buffer
+	telemetry *telemetry
+	logger    *zap.Logger
+
+	// stop ends the ingest's flush loop, which closes done on return
+	stop context.CancelFunc
+	done chan struct{}
+
+	// wal persists buffered data until it is exported. walMu makes appending
+	// to the buffer and the WAL atomic with respect to draining the buffer
+	// and sealing the WAL segment.
+	wal   *wal.WAL
+	walMu sync.RWMutex
+}
+
+func newIngest(id string, cc config.CollectorConfig, limiter *buffer.MemoryLimiter, t *telemetry, logger *zap.Logger) (*ingest, error) {
+	buf, err := buffer.New(cc.Buffer, limiter)
+	if err != nil {
+		return nil, err
+	}
+
+	in := &ingest{id: id, buffer: buf, telemetry: t, logger: logger}
+
+	if cc.WAL.Enabled {
+		walCfg := cc.WAL
+		walCfg.Directory = filepath.Join(cc.WAL.Directory, filepath.FromSlash(id))
+		if in.wal, err = wal.Open(walCfg, logger); err != nil {
+			return nil, err
+		}
+	}
+
+	return in, nil
+}
+
+// ReceiveSpans receives trace spans
+func (in *ingest) ReceiveSpans(spans []models.Span) error {
+	in.logger.Debug("Spans received", zap.Int("count", len(spans)))
+
+	in.walMu.RLock()
+	defer in.walMu.RUnlock()
+
+	err := in.buffer.AddSpans(spans)
+	in.telemetry.received(in.id, Traces, len(spans), err)
+	if err != nil {
+		return err
+	}
+	in.appendWAL(models.TelemetryBatch{Spans: spans})
+	return nil
+}
+
+// ReceiveLogs receives log records
+func (in *ingest) ReceiveLogs(logs []models.LogRecord) error {
+	in.logger.Debug("Logs received", zap.Int("count", len(logs)))
+
+	in.walMu.RLock()
+	defer in.walMu.RUnlock()
+
+	err := in.buffer.AddLogs(logs)
+	in.telemetry.received(in.id, Logs, len(logs), err)
+	if err != nil {
+		return err
+	}
+	in.appendWAL(models.TelemetryBatch{Logs: logs})
+	return nil
+}
+
+// ReceiveMetrics receives metrics
+func (in *ingest) ReceiveMetrics(metrics []models.Metric) error {
+	in.logger.Debug("Metrics received", zap.Int("count", len(metrics)))
+
+	in.walMu.RLock()
+	defer in.walMu.RUnlock()
+
+	err := in.buffer.AddMetrics(metrics)
+	in.telemetry.received(in.id, Metrics, len(metrics), err)
+	if err != nil {
+		return err
+	}
+	in.appendWAL(models.TelemetryBatch{Metrics: metrics})
+	return nil
+}
+
+// appendWAL persists accepted data. A WAL failure is logged rather than
+// refusing data that is already buffered.
+func (in *ingest) appendWAL(batch models.TelemetryBatch) {
+	if in.wal == nil {
+		return
+	}
+	if err := in.wal.Append(batch); err != nil {
+		in.logger.Error("Failed to append to WAL", zap.Error(err))
+	}
+}
+
+// drain empties the buffer. With the WAL enabled, the segment holding the
+// drained data is sealed in the same step; remove it once exported.
+func (in *ingest) drain() (models.TelemetryBatch, uint64) {
+	in.walMu.Lock()
+	defer in.walMu.Unlock()
+
+	batch := in.buffer.Drain()
+	var segment uint64
+	if in.wal != nil {
+		var err error
+		if segment, err = in.wal.Rotate(); err != nil {
+			in.logger.Error("Failed to rotate WAL segment", zap.Error(err))
+		}
+	}
+	return batch, segment
+}
+
+// removeSegment deletes a segment whose data has been exported
+func (in *ingest) removeSegment(segment uint64) {
+	if segment == 0 {
+		return
+	}
+	if err := in.wal.Remove(segment); err != nil {
+		in.logger.Error("Failed to remove WAL segment",
+			zap.Uint64("segment", segment),
+			zap.Error(err),
+		)
+	}
+}
+
+// replay hands data left in the WAL by a previous run to fn
+func (in *ingest) replay(fn func(segment uint64, batch models.TelemetryBatch)) {
+	if in.wal == nil {
+		return
+	}
+
+	in.wal.Replay(func(segment uint64, batch models.TelemetryBatch) {
+		in.logger.Info("Replaying WAL segment",
+			zap.Uint64("segment", segment),
+			zap.Int("spans", len(batch.Spans)),
+			zap.Int("logs", len(batch.Logs)),
+			zap.Int("metrics", len(batch.Metrics)),
+			zap.Int("exceptions", len(batch.Exceptions)),
+		)
+		fn(segment, batch)
+	})
+}
+
+func (in *ingest) close() {
+	if in.wal == nil {
+		return
+	}
+	if err := in.wal.Close(); err != nil {
+		in.logger.Warn("WAL close error", zap.Error(err))
+	}
+}
@@ -0,0 +1,349 @@
+package pipeline
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gaurav/watchingcat/internal/collector/exporters"
+	"github.com/gaurav/watchingcat/internal/collector/processors"
+	"github.com/gaurav/watchingcat/internal/config"
+	"github.com/gaurav/watchingcat/pkg/models"
+	"go.uber.org/zap"
+)
+
+// Pipeline carries one signal from its receivers through its processors to
+// its exporters
+type Pipeline struct {
+	name       string
+	signal     Signal
+	cfg        config.PipelineConfig
+	processors []processors.Processor
+	exporters  []pipelineExporter
+	telemetry  *telemetry
+	recent     *spanRing // for /debug/tracez
+	logger     *zap.Logger
+
+	batches  atomic.Uint64
+	itemsIn  atomic.Uint64
+	itemsOut atomic.Uint64
+}
+
+// Stats counts the batches a pipeline consumed, the items they carried in
+// and the items that reached its exporters, including derived ones
+type Stats struct {
+	Batches  uint64
+	ItemsIn  uint64
+	ItemsOut uint64
+}
+
+// pipelineExporter is an exporter as used by one pipeline
+type pipelineExporter struct {
+	id       string
+	signals  []Signal
+	exporter exporters.Exporter
+}
+
+// spanHolder is a processor that holds spans back, such as the tail
+// sampler. Expire releases the spans that are due; Flush releases all of
+// them on shutdown. The batch acknowledgement in ctx is that of the batch
+// the released spans are sent on in.
+type spanHolder interface {
+	Expire(ctx context.Context) []models.Span
+	Flush(ctx context.Context) []models.Span
+}
+
+// Name returns the pipeline name
+func (p *Pipeline) Name() string {
+	return p.name
+}
+
+// Signal returns the signal the pipeline carries
+func (p *Pipeline) Signal() Signal {
+	return p.signal
+}
+
+// Config returns the pipeline's receivers, processors and exporters
+func (p *Pipeline) Config() config.PipelineConfig {
+	return p.cfg
+}
+
+// Processors returns the pipeline's processor instances, in the order of
+// Config().Processors
+func (p *Pipeline) Processors() []processors.Processor {
+	return p.processors
+}
+
+// Stats returns the pipeline's traffic counters
+func (p *Pipeline) Stats() Stats {
+	return Stats{
+		Batches:  p.batches.Load(),
+		ItemsIn:  p.itemsIn.Load(),
+		ItemsOut: p.itemsOut.Load(),
+	}
+}
+
+// RecentSpans returns the spans the pipeline exported last, newest first
+func (p *Pipeline) RecentSpans() []models.Span {
+	return p.recent.list()
+}
+
+// consume processes a batch and hands it to the exporters. Each exporter
+// holds ack until it has delivered the batch; one that fails never releases
+// it, so the batch stays in the WAL for replay.
+func (p *Pipeline) consume(ctx context.Context, batch models.TelemetryBatch, ack *batchAck) {
+	p.batches.Add(1)
+	p.itemsIn.Add(uint64(batchSize(batch)))
+	batch = p.process(processors.WithBatchAck(ctx, ack), batch, 0)
+	p.export(ctx, batch, ack)
+}
+
+// process runs a batch through the processors from index from on. A failing
+// processor is skipped so its input still reaches the exporters.
+func (p *Pipeline) process(ctx context.Context, batch models.TelemetryBatch, from int) models.TelemetryBatch {
+	for i := from; i < len(p.processors); i++ {
+		processed, err := p.processors[i].Process(ctx, batch)
+		if err != nil {
+			p.logger.Error("Processor failed",
+				zap.String("processor", p.cfg.Processors[i]),
+				zap.Error(err),
+			)
+			continue
+		}
+		batch = processed
+	}
+	return batch
+}
+
+// export sends a batch to every exporter accepting a signal it holds
+func (p *Pipeline) export(ctx context.Context, batch models.TelemetryBatch, ack *batchAck) {
+	if batchEmpty(batch) {
+		return
+	}
+
+	p.itemsOut.Add(uint64(batchSize(batch)))
+	p.recent.add(batch.Spans)
+
+	for _, e := range p.exporters {
+		if !holdsAny(batch, e.signals) {
+			continue
+		}
+
+		p.logger.Debug("Exporting batch", zap.String("exporter", e.id))
+		start := time.Now()
+
+		if async, ok := e.exporter.(AsyncExporter); ok {
+			id := e.id
+			ack.add()
+			err := async.ExportAsync(batch, func() {
+				p.telemetry.exported(id, start, nil)
+				ack.release()
+			})
+			if err != nil {
+				p.telemetry.exported(e.id, start, err)
+				p.logger.Error("Failed to export batch",
+					zap.String("exporter", e.id),
+					zap.Error(err),
+				)
+			}
+			continue
+		}
+
+		ack.add()
+		err := e.exporter.Export(ctx, batch)
+		p.telemetry.exported(e.id, start, err)
+		if err != nil {
+			p.logger.Error("Failed to export batch",
+				zap.String("exporter", e.id),
+				zap.Error(err),
+			)
+			continue
+		}
+		ack.release()
+	}
+
+	p.logger.Info("Batch exported",
+		zap.Int("spans", len(batch.Spans)),
+		zap.Int("logs", len(batch.Logs)),
+		zap.Int("metrics", len(batch.Metrics)),
+		zap.Int("exceptions", len(batch.Exceptions)),
+	)
+}
+
+// expire sends spans whose holding processors are done with them through
+// the rest of the pipeline
+func (p *Pipeline) expire(ctx context.Context) {
+	p.release(ctx, spanHolder.Expire)
+}
+
+// flush releases every span held by processors and sends them through the
+// rest of the pipeline
+func (p *Pipeline) flush(ctx context.Context) {
+	p.release(ctx, spanHolder.Flush)
+}
+
+func (p *Pipeline) release(ctx context.Context, take func(spanHolder, context.Context) []models.Span) {
+	for i, proc := range p.processors {
+		holder, ok := proc.(spanHolder)
+		if !ok {
+			continue
+		}
+		ack := newBatchAck(nil)
+		actx := processors.WithBatchAck(ctx, ack)
+		if spans := take(holder, actx); len(spans) > 0 {
+			batch := p.process(actx, models.TelemetryBatch{Spans: spans}, i+1)
+			p.export(ctx, batch, ack)
+		}
+		if ctx.Err() == nil {
+			ack.release()
+		}
+	}
+}
+
+// batchAck calls done once every exporter handling a batch has delivered it
+// and every processor holding part of it has let go
+type batchAck struct {
+	remaining atomic.Int32
+
+	mu   sync.Mutex
+	done []func()
+}
+
+func newBatchAck(done func()) *batchAck {
+	a := &batchAck{}
+	if done != nil {
+		a.done = append(a.done, done)
+	}
+	a.remaining.Store(1)
+	return a
+}
+
+func (a *batchAck) add() {
+	a.remaining.Add(1)
+}
+
+func (a *batchAck) release() {
+	if a.remaining.Add(-1) != 0 {
+		return
+	}
+	a.mu.Lock()
+	done := a.done
+	a.done = nil
+	a.mu.Unlock()
+	for _, fn := range done {
+		fn()
+	}
+}
+
+// Hold implements processors.BatchAck
+func (a *batchAck) Hold() func() {
+	a.add()
+	return a.release
+}
+
+// OnAck implements processors.BatchAck
+func (a *batchAck) OnAck(fn func()) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.done = append(a.done, fn)
+}
+
+// selectSignal returns the part of a batch carrying signal
+func selectSignal(batch models.TelemetryBatch, signal Signal) models.TelemetryBatch {
+	switch signal {
+	case Traces:
+		return models.TelemetryBatch{Spans: batch.Spans}
+	case Metrics:
+		return models.TelemetryBatch{Metrics: batch.Metrics}
+	case Logs:
+		return models.TelemetryBatch{Logs: batch.Logs}
+	case Exceptions:
+		return models.TelemetryBatch{Exceptions: batch.Exceptions}
+	}
+	return models.TelemetryBatch{}
+}
+
+// holdsAny reports whether a batch has items of any of signals
+func holdsAny(batch models.TelemetryBatch, signals []Signal) bool {
+	for _, s := range signals {
+		if !batchEmpty(selectSignal(batch, s)) {
+			return true
+		}
+	}
+	return false
+}
+
+func batchSize(batch models.TelemetryBatch) int {
+	return len(batch.Spans) + len(batch.Logs) + len(batch.Metrics) + len(batch.Exceptions)
+}
+
+func batchEmpty(batch models.TelemetryBatch) bool {
+	return len(batch.Spans) == 0 && len(batch.Logs) == 0 &&
+		len(batch.Metrics) == 0 && len(batch.Exceptions) == 0
+}
+
+// cloneBatch deep copies a batch, so that pipelines sharing data do not
+// see each other's changes
+func cloneBatch(batch models.TelemetryBatch) models.TelemetryBatch {
+	var out models.TelemetryBatch
+
+	if batch.Spans != nil {
+		out.Spans = make([]models.Span, len(batch.Spans))
+		for i, s := range batch.Spans {
+			s.Attributes = cloneMap(s.Attributes)
+			if s.Events != nil {
+				events := make([]models.SpanEvent, len(s.Events))
+				for j, e := range s.Events {
+					e.Attributes = cloneMap(e.Attributes)
+					events[j] = e
+				}
+				s.Events = events
+			}
+			out.Spans[i] = s
+		}
+	}
+
+	if batch.Logs != nil {
+		out.Logs = make([]models.LogRecord, len(batch.Logs))
+		for i, l := range batch.Logs {
+			l.Attributes = cloneMap(l.Attributes)
+			out.Logs[i] = l
+		}
+	}
+
+	if batch.Metrics != nil {
+		out.Metrics = make([]models.Metric, len(batch.Metrics))
+		for i, m := range batch.Metrics {
+			m.Attributes = cloneMap(m.Attributes)
+			if m.Histogram != nil {
+				h := *m.Histogram
+				h.Bounds = append([]float64(nil), h.Bounds...)
+				h.Buckets = append([]uint64(nil), h.Buckets...)
+				m.Histogram = &h
+			}
+			out.Metrics[i] = m
+		}
+	}
+
+	if batch.Exceptions != nil {
+		out.Exceptions = make([]models.ExceptionRecord, len(batch.Exceptions))
+		for i, x := range batch.Exceptions {
+			x.Tags = cloneMap(x.Tags)
+			out.Exceptions[i] = x
+		}
+	}
+
+	return out
+}
+
+func cloneMap(m map[string]string) map[string]string {
+	if m == nil {
+		return nil
+	}
+	out := make(map[string]string, len(m))
+	for k, v := range m {
+		out[k] = v
+	}
+	return out
+}
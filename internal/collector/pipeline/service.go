@@ -0,0 +1,804 @@
+package pipeline
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gaurav/watchingcat/internal/collector/buffer"
+	"github.com/gaurav/watchingcat/internal/collector/exporters"
+	"github.com/gaurav/watchingcat/internal/config"
+	"github.com/gaurav/watchingcat/pkg/models"
+	"go.uber.org/zap"
+)
+
+// expireInterval is how often processors holding spans back are asked for
+// the ones that are due
+const expireInterval = time.Second
+
+// Service runs the collector's pipelines. Receivers and connectors hand
+// data to a buffer of their own, which is flushed on an interval into every
+// pipeline listing them as a receiver. Exporters and connectors are shared
+// between pipelines; processors are not.
+type Service struct {
+	registry *Registry
+	logger   *zap.Logger
+
+	limiter   *buffer.MemoryLimiter
+	telemetry *telemetry
+	ready     atomic.Bool // receivers are up and not shutting down
+
+	// mu guards cfg and current, which Reload replaces. Routing holds it for
+	// reading, so a reload waits for batches already on their way.
+	mu      sync.RWMutex
+	cfg     *config.Config
+	current *graph
+
+	ctx    context.Context // lives until Shutdown; components started by Reload use it
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+// graph is one generation of the service's components. A reload builds a
+// new graph sharing whatever did not change with the running one.
+type graph struct {
+	receivers map[string]Component
+	ingests   map[string]*ingest
+	pipelines map[string]*Pipeline
+	exporters map[string]exporters.Exporter
+
+	// routes lists the pipelines fed by each receiver, by pipeline name
+	routes map[string][]*Pipeline
+}
+
+func newGraph() *graph {
+	return &graph{
+		receivers: make(map[string]Component),
+		ingests:   make(map[string]*ingest),
+		pipelines: make(map[string]*Pipeline),
+		exporters: make(map[string]exporters.Exporter),
+		routes:    make(map[string][]*Pipeline),
+	}
+}
+
+// New validates the collector config and creates the components its
+// pipelines reference
+func New(cfg *config.Config, registry *Registry, logger *zap.Logger) (*Service, error) {
+	s := &Service{
+		registry: registry,
+		logger:   logger,
+		limiter:  buffer.NewMemoryLimiter(cfg.Collector.MemoryLimiter, logger),
+	}
+	s.telemetry = newTelemetry(s)
+
+	g, _, err := s.build(cfg, nil)
+	if err != nil {
+		return nil, err
+	}
+	s.cfg, s.current = cfg, g
+	return s, nil
+}
+
+// build creates the components cfg's pipelines need. Given the running
+// graph, it keeps every pipeline, exporter and receiver whose config did not
+// change, and every receiver's ingest so that buffered data carries over.
+// fresh holds the components build created; on error they are released.
+func (s *Service) build(cfg *config.Config, prev *graph) (next, fresh *graph, err error) {
+	cc := cfg.Collector
+	if err := s.registry.Validate(cc); err != nil {
+		return nil, nil, fmt.Errorf("invalid pipelines: %w", err)
+	}
+
+	next, fresh = newGraph(), newGraph()
+	defer func() {
+		if err != nil {
+			s.release(context.Background(), fresh)
+		}
+	}()
+
+	// Components may read the receiver endpoint defaults, the metrics
+	// section and the store sections, so a change there rebuilds them all
+	reuse := prev != nil && sharedUnchanged(s.cfg, cfg)
+	b := builder{s: s, cfg: cfg, prev: prev, next: next, fresh: fresh, reuse: reuse}
+
+	configs := s.registry.Pipelines(cc)
+	for _, name := range sortedIDs(configs) {
+		pcfg := configs[name]
+		if reuse && b.unchanged(name, pcfg) {
+			p := prev.pipelines[name]
+			next.pipelines[name] = p
+			for _, e := range p.exporters {
+				next.exporters[e.id] = e.exporter
+			}
+			continue
+		}
+
+		p, err := b.pipeline(name, pcfg)
+		if err != nil {
+			return nil, nil, err
+		}
+		next.pipelines[name] = p
+		fresh.pipelines[name] = p
+	}
+
+	for _, name := range sortedIDs(next.pipelines) {
+		p := next.pipelines[name]
+		for _, id := range p.cfg.Receivers {
+			if err := b.receiver(id); err != nil {
+				return nil, nil, fmt.Errorf("pipeline %q: receiver %q: %w", name, id, err)
+			}
+			next.routes[id] = append(next.routes[id], p)
+		}
+	}
+
+	return next, fresh, nil
+}
+
+// builder creates the components of one graph
+type builder struct {
+	s     *Service
+	cfg   *config.Config
+	prev  *graph // nil when building the first graph
+	next  *graph
+	fresh *graph
+	reuse bool
+}
+
+// unchanged reports whether a running pipeline has the same config as
+// pcfg, as do its processors and exporters
+func (b *builder) unchanged(name string, pcfg config.PipelineConfig) bool {
+	p, ok := b.prev.pipelines[name]
+	if !ok || !samePipeline(p.cfg, pcfg) {
+		return false
+	}
+
+	old, cc := b.s.cfg.Collector, b.cfg.Collector
+	for _, id := range pcfg.Processors {
+		if !reflect.DeepEqual(old.Processors[id], cc.Processors[id]) {
+			return false
+		}
+	}
+	for _, id := range pcfg.Exporters {
+		if !reflect.DeepEqual(exporterConfig(old, id), exporterConfig(cc, id)) {
+			return false
+		}
+	}
+	return true
+}
+
+func (b *builder) pipeline(name string, pcfg config.PipelineConfig) (*Pipeline, error) {
+	signal, _ := SignalOf(name)
+	p := &Pipeline{
+		name:      name,
+		signal:    signal,
+		cfg:       pcfg,
+		telemetry: b.s.telemetry,
+		recent:    newSpanRing(b.cfg.Collector.Telemetry.RecentSpans),
+		logger:    b.s.logger.With(zap.String("pipeline", name)),
+	}
+	if b.prev != nil && b.prev.pipelines[name] != nil {
+		p.recent = b.prev.pipelines[name].recent
+	}
+
+	for _, id := range pcfg.Processors {
+		proc, err := b.s.registry.processors[Type(id)].Create(b.settings(id), b.cfg.Collector.Processors[id])
+		if err != nil {
+			return nil, fmt.Errorf("pipeline %q: processor %q: %w", name, id, err)
+		}
+		p.processors = append(p.processors, proc)
+	}
+
+	for _, id := range pcfg.Exporters {
+		exp, err := b.exporter(id)
+		if err != nil {
+			return nil, fmt.Errorf("pipeline %q: exporter %q: %w", name, id, err)
+		}
+		signals := b.s.registry.exporters[Type(id)].Signals
+		if c, ok := b.s.registry.connectors[Type(id)]; ok {
+			signals = []Signal{c.From}
+		}
+		p.exporters = append(p.exporters, pipelineExporter{
+			id:       id,
+			signals:  signals,
+			exporter: exp,
+		})
+	}
+
+	return p, nil
+}
+
+func (b *builder) exporter(id string) (exporters.Exporter, error) {
+	if exp, ok := b.next.exporters[id]; ok {
+		return exp, nil
+	}
+
+	cfg := exporterConfig(b.cfg.Collector, id)
+	if exp, ok := b.prev.exporter(id); ok && b.reuse && reflect.DeepEqual(exporterConfig(b.s.cfg.Collector, id), cfg) {
+		b.next.exporters[id] = exp
+		return exp, nil
+	}
+
+	var exp exporters.Exporter
+	var err error
+	if c, ok := b.s.registry.connectors[Type(id)]; ok {
+		var in *ingest
+		if in, err = b.ingest(id); err != nil {
+			return nil, err
+		}
+		exp, err = c.Create(b.settings(id), cfg, in)
+	} else {
+		exp, err = b.s.registry.exporters[Type(id)].Create(b.settings(id), cfg)
+	}
+	if err != nil {
+		return nil, err
+	}
+	b.next.exporters[id] = exp
+	b.fresh.exporters[id] = exp
+	return exp, nil
+}
+
+// receiver creates a receiver and its ingest. A connector is created as an
+// exporter, so only its ingest is needed.
+func (b *builder) receiver(id string) error {
+	if _, ok := b.next.receivers[id]; ok {
+		return nil
+	}
+	if b.s.isConnector(id) {
+		_, err := b.ingest(id)
+		return err
+	}
+
+	set := b.settings(id)
+	in, err := b.ingest(id)
+	if err != nil {
+		return err
+	}
+
+	cfg := Receivers(b.cfg.Collector)[id]
+	if r, ok := b.prev.receiver(id); ok && b.reuse && reflect.DeepEqual(Receivers(b.s.cfg.Collector)[id], cfg) {
+		b.next.receivers[id] = r
+		return nil
+	}
+
+	receiver, err := b.s.registry.receivers[Type(id)].Create(set, cfg, in)
+	if err != nil {
+		return err
+	}
+	b.next.receivers[id] = receiver
+	b.fresh.receivers[id] = receiver
+	return nil
+}
+
+// ingest returns the running ingest of a receiver or connector, or creates
+// one
+func (b *builder) ingest(id string) (*ingest, error) {
+	if in, ok := b.next.ingests[id]; ok {
+		return in, nil
+	}
+
+	in, ok := b.prev.ingest(id)
+	if !ok {
+		var err error
+		if in, err = newIngest(id, b.cfg.Collector, b.s.limiter, b.s.telemetry, b.settings(id).Logger); err != nil {
+			return nil, err
+		}
+		b.fresh.ingests[id] = in
+	}
+	b.next.ingests[id] = in
+	return in, nil
+}
+
+func (b *builder) settings(id string) Settings {
+	return Settings{
+		ID:     id,
+		Config: b.cfg,
+		Logger: b.s.logger.With(zap.String("component", id)),
+	}
+}
+
+func (g *graph) exporter(id string) (exporters.Exporter, bool) {
+	if g == nil {
+		return nil, false
+	}
+	exp, ok := g.exporters[id]
+	return exp, ok
+}
+
+func (g *graph) receiver(id string) (Component, bool) {
+	if g == nil {
+		return nil, false
+	}
+	r, ok := g.receivers[id]
+	return r, ok
+}
+
+func (g *graph) ingest(id string) (*ingest, bool) {
+	if g == nil {
+		return nil, false
+	}
+	in, ok := g.ingests[id]
+	return in, ok
+}
+
+// exporterConfig returns an exporter's or connector's config
+func exporterConfig(cc config.CollectorConfig, id string) config.ComponentConfig {
+	if cfg, ok := cc.Exporters[id]; ok {
+		return cfg
+	}
+	return cc.Connectors[id]
+}
+
+// sharedUnchanged reports whether the settings any component may read
+// besides its own config are the same in both configs
+func sharedUnchanged(old, cfg *config.Config) bool {
+	return old.Collector.GRPC == cfg.Collector.GRPC &&
+		old.Collector.HTTP == cfg.Collector.HTTP &&
+		reflect.DeepEqual(old.Metrics, cfg.Metrics) &&
+		old.TraceStore == cfg.TraceStore &&
+		old.MetricStore == cfg.MetricStore &&
+		old.LogStore == cfg.LogStore
+}
+
+func samePipeline(a, b config.PipelineConfig) bool {
+	return slices.Equal(a.Receivers, b.Receivers) &&
+		slices.Equal(a.Processors, b.Processors) &&
+		slices.Equal(a.Exporters, b.Exporters)
+}
+
+// Start starts the exporters, the flush loops, then the receivers
+func (s *Service) Start(ctx context.Context) error {
+	s.ctx, s.cancel = context.WithCancel(ctx)
+
+	if err := s.startExporters(s.current.exporters); err != nil {
+		return err
+	}
+
+	if s.limiter != nil {
+		go s.limiter.Start(s.ctx)
+	}
+
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		s.expire(s.ctx)
+	}()
+
+	for _, in := range s.current.ingests {
+		s.startIngest(in)
+	}
+
+	if err := s.startReceivers(s.current.receivers); err != nil {
+		return err
+	}
+
+	s.ready.Store(true)
+	return nil
+}
+
+func (s *Service) startExporters(exps map[string]exporters.Exporter) error {
+	for _, id := range sortedIDs(exps) {
+		if c, ok := exps[id].(interface{ Start(context.Context) error }); ok {
+			if err := c.Start(s.ctx); err != nil {
+				return fmt.Errorf("failed to start exporter %q: %w", id, err)
+			}
+		}
+	}
+	return nil
+}
+
+func (s *Service) startReceivers(receivers map[string]Component) error {
+	for _, id := range sortedIDs(receivers) {
+		if err := receivers[id].Start(s.ctx); err != nil {
+			return fmt.Errorf("failed to start receiver %q: %w", id, err)
+		}
+	}
+	return nil
+}
+
+// startIngest replays what a previous run left in the receiver's WAL, then
+// flushes its buffer until the service shuts down or the ingest is stopped
+func (s *Service) startIngest(in *ingest) {
+	ctx, cancel := context.WithCancel(s.ctx)
+	in.stop = cancel
+	in.done = make(chan struct{})
+
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		defer close(in.done)
+		in.replay(func(segment uint64, batch models.TelemetryBatch) {
+			s.route(ctx, in.id, batch, func() { in.removeSegment(segment) })
+		})
+		s.run(ctx, in)
+	}()
+}
+
+// Ready reports whether the receivers are accepting data
+func (s *Service) Ready() bool {
+	return s.ready.Load()
+}
+
+// Reload applies a new config to the running service. Pipelines whose
+// config, processors and exporters are unchanged keep running as they are;
+// the others are rebuilt. Receivers keep their buffers and WALs, so nothing
+// they accepted is lost. An invalid config, one whose components cannot be
+// created, or one whose exporters fail to start is rejected and the running
+// pipelines are left alone.
+//
+// Receivers that fail to start are reported once the new config is in
+// place. Reload must not be called concurrently with Start or Shutdown.
+func (s *Service) Reload(ctx context.Context, cfg *config.Config) error {
+	if s.ctx == nil {
+		return fmt.Errorf("service not started")
+	}
+
+	prev := s.current
+	next, fresh, err := s.build(cfg, prev)
+	if err != nil {
+		return err
+	}
+	warnRestartOnly(s.logger, s.cfg.Collector, cfg.Collector)
+
+	// Stop the receivers being replaced or removed, and drain the buffers of
+	// removed ones into the pipelines they fed until now
+	var stopped []string
+	for _, id := range sortedIDs(prev.receivers) {
+		if !retired(id, next.receivers, fresh.receivers) {
+			continue
+		}
+		if err := prev.receivers[id].Shutdown(ctx); err != nil {
+			s.logger.Warn("Receiver shutdown error", zap.String("receiver", id), zap.Error(err))
+		}
+		stopped = append(stopped, id)
+	}
+	var removed []*ingest
+	for _, id := range sortedIDs(prev.ingests) {
+		if _, ok := next.ingests[id]; ok {
+			continue
+		}
+		in := prev.ingests[id]
+		in.stop()
+		<-in.done
+		s.flush(ctx, in)
+		removed = append(removed, in)
+	}
+
+	// Block routing until the new exporters are started. Retired pipelines
+	// first release what their processors hold back, as the exporters they
+	// send to may be about to stop.
+	s.mu.Lock()
+	var rebuilt, kept []string
+	for _, name := range sortedIDs(next.pipelines) {
+		if _, ok := fresh.pipelines[name]; ok {
+			rebuilt = append(rebuilt, name)
+		} else {
+			kept = append(kept, name)
+		}
+	}
+	var dropped []string
+	for _, name := range sortedIDs(prev.pipelines) {
+		if retired(name, next.pipelines, fresh.pipelines) {
+			prev.pipelines[name].flush(ctx)
+		}
+		if _, ok := next.pipelines[name]; !ok {
+			dropped = append(dropped, name)
+		}
+	}
+	replaced, err := s.changeExporters(ctx, prev, fresh)
+	if err != nil {
+		s.restore(prev, stopped, removed)
+		s.mu.Unlock()
+		for _, in := range fresh.ingests {
+			in.close()
+		}
+		return err
+	}
+	s.cfg, s.current = cfg, next
+	s.mu.Unlock()
+
+	// Let retired exporters deliver their queues
+	old := newGraph()
+	for id, exp := range prev.exporters {
+		if retired(id, next.exporters, fresh.exporters) && !replaced[id] {
+			old.exporters[id] = exp
+		}
+	}
+	for _, in := range removed {
+		old.ingests[in.id] = in
+	}
+	s.release(ctx, old)
+
+	s.logger.Info("Configuration reloaded",
+		zap.Strings("rebuilt", rebuilt),
+		zap.Strings("kept", kept),
+		zap.Strings("removed", dropped),
+	)
+
+	var errs []error
+	for _, in := range fresh.ingests {
+		s.startIngest(in)
+	}
+	if err := s.startReceivers(fresh.receivers); err != nil {
+		errs = append(errs, err)
+	}
+	return errors.Join(errs...)
+}
+
+// changeExporters starts a reload's fresh exporters. One that replaces a
+// running exporter may need its endpoint or directory, so the running one
+// is shut down first; it returns those it shut down. If any fails to start,
+// the fresh exporters are shut down and the replaced ones started again.
+func (s *Service) changeExporters(ctx context.Context, prev, fresh *graph) (map[string]bool, error) {
+	replaced := make(map[string]bool)
+	for _, id := range sortedIDs(fresh.exporters) {
+		c, ok := fresh.exporters[id].(interface{ Start(context.Context) error })
+		if !ok {
+			continue
+		}
+		if running, ok := prev.exporters[id].(Component); ok {
+			if err := running.Shutdown(ctx); err != nil {
+				s.logger.Warn("Exporter shutdown error", zap.String("exporter", id), zap.Error(err))
+			}
+			replaced[id] = true
+		}
+		if err := c.Start(s.ctx); err != nil {
+			err = fmt.Errorf("failed to start exporter %q: %w", id, err)
+			s.shutdownExporters(ctx, fresh.exporters)
+			for _, id := range sortedIDs(replaced) {
+				if err := prev.exporters[id].(Component).Start(s.ctx); err != nil {
+					s.logger.Error("Failed to restart exporter", zap.String("exporter", id), zap.Error(err))
+				}
+			}
+			return nil, err
+		}
+	}
+	return replaced, nil
+}
+
+// restore brings back what a rejected reload stopped. Receivers cannot be
+// started twice, so the stopped ones are created again from the running
+// config. Must be called with mu held.
+func (s *Service) restore(prev *graph, stopped []string, removed []*ingest) {
+	for _, in := range removed {
+		s.startIngest(in)
+	}
+	for _, id := range stopped {
+		set := Settings{
+			ID:     id,
+			Config: s.cfg,
+			Logger: s.logger.With(zap.String("component", id)),
+		}
+		r, err := s.registry.receivers[Type(id)].Create(set, Receivers(s.cfg.Collector)[id], prev.ingests[id])
+		if err == nil {
+			err = r.Start(s.ctx)
+		}
+		if err != nil {
+			s.logger.Error("Failed to restore receiver", zap.String("receiver", id), zap.Error(err))
+			continue
+		}
+		prev.receivers[id] = r
+	}
+}
+
+// retired reports whether the running component id is missing from the
+// next graph or replaced by a fresh one
+func retired[T any](id string, next, fresh map[string]T) bool {
+	_, kept := next[id]
+	_, replaced := fresh[id]
+	return !kept || replaced
+}
+
+// warnRestartOnly logs settings a reload does not apply to running receivers
+func warnRestartOnly(logger *zap.Logger, old, cc config.CollectorConfig) {
+	var changed []string
+	if !reflect.DeepEqual(old.Buffer, cc.Buffer) {
+		changed = append(changed, "buffer")
+	}
+	if old.MemoryLimiter != cc.MemoryLimiter {
+		changed = append(changed, "memory_limiter")
+	}
+	if old.WAL != cc.WAL {
+		changed = append(changed, "wal")
+	}
+	if old.Telemetry != cc.Telemetry {
+		changed = append(changed, "telemetry")
+	}
+	if len(changed) > 0 {
+		logger.Warn("Changed settings apply to existing receivers after a restart",
+			zap.Strings("settings", changed),
+		)
+	}
+}
+
+// Shutdown stops the receivers, exports whatever is still buffered or held
+// by processors, then shuts the exporters down
+func (s *Service) Shutdown(ctx context.Context) {
+	s.ready.Store(false)
+	g := s.current
+
+	for _, id := range sortedIDs(g.receivers) {
+		if err := g.receivers[id].Shutdown(ctx); err != nil {
+			s.logger.Warn("Receiver shutdown error", zap.String("receiver", id), zap.Error(err))
+		}
+	}
+
+	// Stop background processing, then do a final flush
+	if s.cancel != nil {
+		s.cancel()
+	}
+	s.wg.Wait()
+	for _, id := range sortedIDs(g.ingests) {
+		if !s.isConnector(id) {
+			s.flush(ctx, g.ingests[id])
+		}
+	}
+	for _, name := range sortedIDs(g.pipelines) {
+		g.pipelines[name].flush(ctx)
+	}
+
+	// Connectors are shut down once the pipelines sending to them are done,
+	// so what they emit on shutdown is flushed with the rest
+	for _, id := range sortedIDs(g.exporters) {
+		if !s.isConnector(id) {
+			continue
+		}
+		if c, ok := g.exporters[id].(interface{ Shutdown(context.Context) error }); ok {
+			if err := c.Shutdown(ctx); err != nil {
+				s.logger.Warn("Connector shutdown error", zap.String("connector", id), zap.Error(err))
+			}
+		}
+	}
+	for _, id := range sortedIDs(g.ingests) {
+		if s.isConnector(id) {
+			s.flush(ctx, g.ingests[id])
+		}
+	}
+
+	s.release(ctx, g)
+}
+
+func (s *Service) isConnector(id string) bool {
+	_, ok := s.registry.connectors[Type(id)]
+	return ok
+}
+
+// release shuts a graph's exporters down and closes its WALs
+func (s *Service) release(ctx context.Context, g *graph) {
+	s.shutdownExporters(ctx, g.exporters)
+	for _, in := range g.ingests {
+		in.close()
+	}
+}
+
+func (s *Service) shutdownExporters(ctx context.Context, exps map[string]exporters.Exporter) {
+	for _, id := range sortedIDs(exps) {
+		if c, ok := exps[id].(interface{ Shutdown(context.Context) error }); ok {
+			if err := c.Shutdown(ctx); err != nil {
+				s.logger.Warn("Exporter shutdown error", zap.String("exporter", id), zap.Error(err))
+			}
+		}
+	}
+}
+
+// run flushes a receiver's buffer on the flush interval, or as soon as a
+// signal reaches the send batch size
+func (s *Service) run(ctx context.Context, in *ingest) {
+	s.mu.RLock()
+	interval := s.cfg.Collector.Buffer.Timeout
+	s.mu.RUnlock()
+	if interval <= 0 {
+		interval = 10 * time.Second
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-in.buffer.Ready():
+			ticker.Reset(interval)
+		}
+
+		s.flush(ctx, in)
+	}
+}
+
+// expire releases spans that processors have held for long enough, such as
+// traces whose decision window has ended, whether or not data arrives
+func (s *Service) expire(ctx context.Context) {
+	ticker := time.NewTicker(expireInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		s.mu.RLock()
+		for _, name := range sortedIDs(s.current.pipelines) {
+			s.current.pipelines[name].expire(ctx)
+		}
+		s.mu.RUnlock()
+	}
+}
+
+// flush drains a receiver's buffer into its pipelines. The WAL segment
+// holding the data is removed once every exporter has acknowledged it.
+func (s *Service) flush(ctx context.Context, in *ingest) {
+	batch, segment := in.drain()
+	if batchEmpty(batch) {
+		in.removeSegment(segment)
+		return
+	}
+	s.route(ctx, in.id, batch, func() { in.removeSegment(segment) })
+}
+
+// route hands each pipeline fed by a receiver the part of the batch
+// carrying its signal. Pipelines sharing a signal each get their own copy.
+// done is called once every exporter has acknowledged the batch; it is not
+// called if ctx is cancelled first, so the data is kept for replay.
+func (s *Service) route(ctx context.Context, receiver string, batch models.TelemetryBatch, done func()) {
+	ack := newBatchAck(done)
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	targets := s.current.routes[receiver]
+	for i, p := range targets {
+		part := selectSignal(batch, p.signal)
+		if batchEmpty(part) {
+			continue
+		}
+		for _, later := range targets[i+1:] {
+			if later.signal == p.signal {
+				part = cloneBatch(part)
+				break
+			}
+		}
+		p.consume(ctx, part, ack)
+	}
+
+	if ctx.Err() == nil {
+		ack.release()
+	}
+}
+
+// Pipelines returns the running pipelines, by name
+func (s *Service) Pipelines() []*Pipeline {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	pipelines := make([]*Pipeline, 0, len(s.current.pipelines))
+	for _, name := range sortedIDs(s.current.pipelines) {
+		pipelines = append(pipelines, s.current.pipelines[name])
+	}
+	return pipelines
+}
+
+// Exporters returns the exporter instances by ID
+func (s *Service) Exporters() map[string]exporters.Exporter {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.current.exporters
+}
+
+// BufferStats returns each receiver's buffer statistics by receiver ID
+func (s *Service) BufferStats() map[string]buffer.Stats {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	stats := make(map[string]buffer.Stats, len(s.current.ingests))
+	for id, in := range s.current.ingests {
+		stats[id] = in.buffer.Stats()
+	}
+	return stats
+}
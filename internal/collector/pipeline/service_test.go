@@ -0,0 +1,542 @@
+package pipeline
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gaurav/watchingcat/internal/collector/exporters"
+	"github.com/gaurav/watchingcat/internal/collector/processors"
+	"github.com/gaurav/watchingcat/internal/config"
+	"github.com/gaurav/watchingcat/pkg/models"
+	"go.uber.org/zap"
+)
+
+// fakeReceiver hands whatever the test sends to its consumer
+type fakeReceiver struct {
+	consumer Consumer
+	started  bool
+}
+
+func (r *fakeReceiver) Start(ctx context.Context) error    { r.started = true; return nil }
+func (r *fakeReceiver) Shutdown(ctx context.Context) error { return nil }
+
+// fakeExporter records the batches it is given, failing with err if set
+type fakeExporter struct {
+	mu      sync.Mutex
+	batches []models.TelemetryBatch
+	err     error
+}
+
+func (e *fakeExporter) Export(ctx context.Context, batch models.TelemetryBatch) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.batches = append(e.batches, batch)
+	return e.err
+}
+
+func (e *fakeExporter) received() []models.TelemetryBatch {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.batches
+}
+
+// asyncExporter holds on to done until the test releases it
+type asyncExporter struct {
+	fakeExporter
+	pending []func()
+}
+
+func (e *asyncExporter) ExportAsync(batch models.TelemetryBatch, done func()) error {
+	e.Export(context.Background(), batch)
+	e.pending = append(e.pending, done)
+	return nil
+}
+
+// startExporter is an exporter with a lifecycle, failing to start with err
+type startExporter struct {
+	fakeExporter
+	err     error
+	running bool
+}
+
+func (e *startExporter) Start(ctx context.Context) error {
+	if e.err != nil {
+		return e.err
+	}
+	e.running = true
+	return nil
+}
+
+func (e *startExporter) Shutdown(ctx context.Context) error {
+	e.running = false
+	return nil
+}
+
+// tagProcessor sets an attribute on every span and metric
+type tagProcessor struct{ value string }
+
+func (p tagProcessor) Process(ctx context.Context, batch models.TelemetryBatch) (models.TelemetryBatch, error) {
+	for i := range batch.Spans {
+		batch.Spans[i].Attributes["tag"] = p.value
+	}
+	for i := range batch.Metrics {
+		batch.Metrics[i].Attributes = map[string]string{"tag": p.value}
+	}
+	return batch, nil
+}
+
+// countConnector counts the spans it is sent and, like the span metrics
+// connectors, emits what it holds on shutdown
+type countConnector struct {
+	next  Consumer
+	spans int
+}
+
+func (c *countConnector) Export(ctx context.Context, batch models.TelemetryBatch) error {
+	c.spans += len(batch.Spans)
+	return nil
+}
+
+func (c *countConnector) Shutdown(ctx context.Context) error {
+	if c.spans == 0 {
+		return nil
+	}
+	err := c.next.ReceiveMetrics([]models.Metric{{Name: "spans", Value: float64(c.spans)}})
+	c.spans = 0
+	return err
+}
+
+// holdProcessor holds every span until expired
+type holdProcessor struct{ held []models.Span }
+
+func (p *holdProcessor) Process(ctx context.Context, batch models.TelemetryBatch) (models.TelemetryBatch, error) {
+	p.held = append(p.held, batch.Spans...)
+	batch.Spans = nil
+	return batch, nil
+}
+
+func (p *holdProcessor) Expire(ctx context.Context) []models.Span {
+	held := p.held
+	p.held = nil
+	return held
+}
+
+func (p *holdProcessor) Flush(ctx context.Context) []models.Span { return p.Expire(ctx) }
+
+// newTestService builds a service from pipelines over the test registry,
+// with a tag processor and traces exporters named by the test
+func newTestService(t *testing.T, pipelines map[string]config.PipelineConfig, exps map[string]exporters.Exporter) *Service {
+	t.Helper()
+
+	r := testRegistry()
+	r.RegisterProcessor("tag", ProcessorFactory{
+		Signals: []Signal{Traces, Metrics},
+		Create: func(set Settings, cfg config.ComponentConfig) (processors.Processor, error) {
+			return tagProcessor{value: set.ID}, nil
+		},
+	})
+	r.RegisterProcessor("hold", ProcessorFactory{
+		Signals: []Signal{Traces},
+		Create: func(set Settings, cfg config.ComponentConfig) (processors.Processor, error) {
+			return &holdProcessor{}, nil
+		},
+	})
+	r.RegisterConnector("count", ConnectorFactory{
+		From: Traces,
+		To:   Metrics,
+		Create: func(set Settings, cfg config.ComponentConfig, next Consumer) (exporters.Exporter, error) {
+			return &countConnector{next: next}, nil
+		},
+	})
+	r.RegisterConnector("calls", ConnectorFactory{
+		From: Traces,
+		To:   Metrics,
+		Create: func(set Settings, cfg config.ComponentConfig, next Consumer) (exporters.Exporter, error) {
+			return processors.NewSpanMetrics(config.SpanMetricsConfig{Interval: 10 * time.Millisecond}, nil, next, set.Logger), nil
+		},
+	})
+	r.RegisterExporter("out", ExporterFactory{
+		Signals: []Signal{Traces, Metrics, Logs},
+		Create: func(set Settings, cfg config.ComponentConfig) (exporters.Exporter, error) {
+			return exps[set.ID], nil
+		},
+	})
+
+	s, err := New(testConfig(pipelines, exps), r, zap.NewNop())
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+	return s
+}
+
+func testConfig(pipelines map[string]config.PipelineConfig, exps map[string]exporters.Exporter) *config.Config {
+	cfg := &config.Config{Collector: config.CollectorConfig{
+		Buffer:     config.BufferConfig{Policy: "drop_newest", Timeout: time.Hour},
+		Receivers:  map[string]config.ComponentConfig{"recv": {}, "recv/b": {}},
+		Processors: map[string]config.ComponentConfig{"tag/a": {}, "tag/b": {}, "hold": {}},
+		Connectors: map[string]config.ComponentConfig{"count": {}, "calls": {}},
+		Exporters:  make(map[string]config.ComponentConfig),
+		Pipelines:  pipelines,
+	}}
+	for id := range exps {
+		cfg.Collector.Exporters[id] = config.ComponentConfig{}
+	}
+	return cfg
+}
+
+func TestServiceRoutesToPipelines(t *testing.T) {
+	a, b, logs := &fakeExporter{}, &fakeExporter{}, &fakeExporter{}
+	s := newTestService(t, map[string]config.PipelineConfig{
+		"traces":   {Receivers: []string{"recv"}, Processors: []string{"tag/a"}, Exporters: []string{"out/a"}},
+		"traces/b": {Receivers: []string{"recv", "recv/b"}, Processors: []string{"tag/b"}, Exporters: []string{"out/b"}},
+		"logs":     {Receivers: []string{"recv"}, Exporters: []string{"out/logs"}},
+	}, map[string]exporters.Exporter{"out/a": a, "out/b": b, "out/logs": logs})
+
+	if err := s.Start(context.Background()); err != nil {
+		t.Fatalf("Start failed: %v", err)
+	}
+	for id, r := range s.current.receivers {
+		if !r.(*fakeReceiver).started {
+			t.Errorf("Receiver %s was not started", id)
+		}
+	}
+
+	recv := s.current.receivers["recv"].(*fakeReceiver).consumer
+	recv.ReceiveSpans([]models.Span{{Name: "GET /", Attributes: map[string]string{}}})
+	recv.ReceiveLogs([]models.LogRecord{{Message: "hello"}})
+	s.current.receivers["recv/b"].(*fakeReceiver).consumer.ReceiveSpans([]models.Span{{Name: "GET /b", Attributes: map[string]string{}}})
+
+	s.Shutdown(context.Background())
+
+	if got := a.received(); len(got) != 1 || len(got[0].Spans) != 1 || len(got[0].Logs) != 0 {
+		t.Fatalf("Expected traces to export the recv span only, got %+v", got)
+	}
+	if tag := a.received()[0].Spans[0].Attributes["tag"]; tag != "tag/a" {
+		t.Errorf("Expected traces to see only its own processor, got tag %q", tag)
+	}
+
+	var names []string
+	for _, batch := range b.received() {
+		for _, span := range batch.Spans {
+			names = append(names, span.Name)
+			if span.Attributes["tag"] != "tag/b" {
+				t.Errorf("Expected traces/b to see only its own processor, got tag %q", span.Attributes["tag"])
+			}
+		}
+	}
+	if len(names) != 2 {
+		t.Errorf("Expected traces/b to export spans from both receivers, got %v", names)
+	}
+
+	if got := logs.received(); len(got) != 1 || len(got[0].Logs) != 1 || len(got[0].Spans) != 0 {
+		t.Errorf("Expected logs to export the log record only, got %+v", got)
+	}
+}
+
+func TestServiceAcksOnceExported(t *testing.T) {
+	async, direct := &asyncExporter{}, &fakeExporter{}
+	s := newTestService(t, map[string]config.PipelineConfig{
+		"traces":   {Receivers: []string{"recv"}, Exporters: []string{"out/async"}},
+		"traces/b": {Receivers: []string{"recv"}, Exporters: []string{"out/sync"}},
+	}, map[string]exporters.Exporter{"out/async": async, "out/sync": direct})
+
+	acked := false
+	batch := models.TelemetryBatch{Spans: []models.Span{{Name: "GET /"}}}
+	s.route(context.Background(), "recv", batch, func() { acked = true })
+
+	if len(direct.received()) != 1 || len(async.pending) != 1 {
+		t.Fatalf("Expected both pipelines to export the batch")
+	}
+	if acked {
+		t.Fatal("Expected no ack before the async exporter delivered the batch")
+	}
+	async.pending[0]()
+	if !acked {
+		t.Error("Expected an ack once every exporter was done")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	acked = false
+	s.route(ctx, "recv", batch, func() { acked = true })
+	async.pending[1]()
+	if acked {
+		t.Error("Expected no ack for a batch routed after cancellation, so it is replayed")
+	}
+
+	direct.err = errors.New("unavailable")
+	acked = false
+	s.route(context.Background(), "recv", batch, func() { acked = true })
+	async.pending[2]()
+	if acked {
+		t.Error("Expected no ack for a batch an exporter failed on, so it is replayed")
+	}
+}
+
+func TestServiceConnectors(t *testing.T) {
+	out := &fakeExporter{}
+	s := newTestService(t, map[string]config.PipelineConfig{
+		"traces":  {Receivers: []string{"recv"}, Exporters: []string{"count"}},
+		"metrics": {Receivers: []string{"count"}, Processors: []string{"tag/a"}, Exporters: []string{"out"}},
+	}, map[string]exporters.Exporter{"out": out})
+	if err := s.Start(context.Background()); err != nil {
+		t.Fatalf("Start failed: %v", err)
+	}
+
+	recv := s.current.receivers["recv"].(*fakeReceiver).consumer
+	recv.ReceiveSpans([]models.Span{{Name: "GET /"}, {Name: "GET /cart"}})
+	s.Shutdown(context.Background())
+
+	got := out.received()
+	if len(got) != 1 || len(got[0].Metrics) != 1 || got[0].Metrics[0].Value != 2 {
+		t.Fatalf("Expected the derived metric to reach the metrics pipeline, got %+v", got)
+	}
+	if got[0].Metrics[0].Attributes["tag"] != "tag/a" {
+		t.Errorf("Expected the metrics pipeline's processors to apply, got %v", got[0].Metrics[0].Attributes)
+	}
+}
+
+func TestServiceExpiresHeldSpans(t *testing.T) {
+	out := &fakeExporter{}
+	s := newTestService(t, map[string]config.PipelineConfig{
+		"traces": {Receivers: []string{"recv"}, Processors: []string{"hold", "tag/a"}, Exporters: []string{"out"}},
+	}, map[string]exporters.Exporter{"out": out})
+
+	batch := models.TelemetryBatch{Spans: []models.Span{{Name: "GET /", Attributes: map[string]string{}}}}
+	s.route(context.Background(), "recv", batch, nil)
+	if len(out.received()) != 0 {
+		t.Fatal("Expected the span to be held")
+	}
+
+	s.current.pipelines["traces"].expire(context.Background())
+	got := out.received()
+	if len(got) != 1 || len(got[0].Spans) != 1 || got[0].Spans[0].Attributes["tag"] != "tag/a" {
+		t.Errorf("Expected the expired span to pass through the later processors, got %+v", got)
+	}
+}
+
+func TestServiceReload(t *testing.T) {
+	a, b := &fakeExporter{}, &fakeExporter{}
+	exps := map[string]exporters.Exporter{"out/a": a, "out/b": b}
+	s := newTestService(t, map[string]config.PipelineConfig{
+		"traces":   {Receivers: []string{"recv"}, Processors: []string{"tag/a"}, Exporters: []string{"out/a"}},
+		"traces/b": {Receivers: []string{"recv"}, Processors: []string{"tag/b"}, Exporters: []string{"out/b"}},
+	}, exps)
+	if err := s.Start(context.Background()); err != nil {
+		t.Fatalf("Start failed: %v", err)
+	}
+	before := s.current
+	recv := before.receivers["recv"].(*fakeReceiver).consumer
+	recv.ReceiveSpans([]models.Span{{Name: "buffered", Attributes: map[string]string{}}})
+
+	invalid := testConfig(map[string]config.PipelineConfig{
+		"traces": {Receivers: []string{"recv"}, Exporters: []string{"out/missing"}},
+	}, exps)
+	if err := s.Reload(context.Background(), invalid); err == nil {
+		t.Fatal("Expected an invalid config to be rejected")
+	}
+	if s.current != before {
+		t.Fatal("Expected a rejected config to leave the running pipelines alone")
+	}
+
+	err := s.Reload(context.Background(), testConfig(map[string]config.PipelineConfig{
+		"traces":   {Receivers: []string{"recv"}, Processors: []string{"tag/a"}, Exporters: []string{"out/a"}},
+		"traces/b": {Receivers: []string{"recv"}, Processors: []string{"tag/a"}, Exporters: []string{"out/b"}},
+	}, exps))
+	if err != nil {
+		t.Fatalf("Reload failed: %v", err)
+	}
+
+	if s.current.pipelines["traces"] != before.pipelines["traces"] {
+		t.Error("Expected the unchanged pipeline to keep running")
+	}
+	if s.current.pipelines["traces/b"] == before.pipelines["traces/b"] {
+		t.Error("Expected the changed pipeline to be rebuilt")
+	}
+	if s.current.receivers["recv"] != before.receivers["recv"] || s.current.ingests["recv"] != before.ingests["recv"] {
+		t.Error("Expected the unchanged receiver and its buffer to be kept")
+	}
+
+	s.Shutdown(context.Background())
+
+	got := b.received()
+	if len(got) != 1 || len(got[0].Spans) != 1 {
+		t.Fatalf("Expected the span buffered before the reload to be exported once, got %+v", got)
+	}
+	if tag := got[0].Spans[0].Attributes["tag"]; tag != "tag/a" {
+		t.Errorf("Expected the rebuilt pipeline's processors to apply, got tag %q", tag)
+	}
+	if len(a.received()) != 1 {
+		t.Errorf("Expected the kept pipeline to export the buffered span, got %+v", a.received())
+	}
+}
+
+func TestServiceReloadSharedSettings(t *testing.T) {
+	exps := map[string]exporters.Exporter{"out/a": &fakeExporter{}}
+	pipelines := map[string]config.PipelineConfig{
+		"traces": {Receivers: []string{"recv"}, Exporters: []string{"out/a"}},
+	}
+	s := newTestService(t, pipelines, exps)
+	if err := s.Start(context.Background()); err != nil {
+		t.Fatalf("Start failed: %v", err)
+	}
+	defer s.Shutdown(context.Background())
+
+	// Store exporters take their defaults from the store sections
+	cfg := testConfig(pipelines, exps)
+	cfg.TraceStore.Directory = "/var/lib/watchingcat/traces"
+	before := s.current
+	if err := s.Reload(context.Background(), cfg); err != nil {
+		t.Fatalf("Reload failed: %v", err)
+	}
+	if s.current.pipelines["traces"] == before.pipelines["traces"] {
+		t.Error("Expected a store section change to rebuild the pipelines")
+	}
+}
+
+func TestServiceReloadRollsBack(t *testing.T) {
+	a := &startExporter{}
+	exps := map[string]exporters.Exporter{"out/a": a}
+	s := newTestService(t, map[string]config.PipelineConfig{
+		"traces": {Receivers: []string{"recv"}, Exporters: []string{"out/a"}},
+	}, exps)
+	if err := s.Start(context.Background()); err != nil {
+		t.Fatalf("Start failed: %v", err)
+	}
+	before := s.current
+
+	// Replace out/a and the receiver, and add an exporter that fails to start
+	replacement, failing := &startExporter{}, &startExporter{err: errors.New("address in use")}
+	exps["out/a"], exps["out/b"] = replacement, failing
+	cfg := testConfig(map[string]config.PipelineConfig{
+		"traces":   {Receivers: []string{"recv"}, Exporters: []string{"out/a"}},
+		"traces/b": {Receivers: []string{"recv"}, Exporters: []string{"out/b"}},
+	}, exps)
+	cfg.Collector.Exporters["out/a"] = config.ComponentConfig{"endpoint": "changed"}
+	cfg.Collector.Receivers["recv"] = config.ComponentConfig{"endpoint": "changed"}
+
+	if err := s.Reload(context.Background(), cfg); err == nil || !strings.Contains(err.Error(), "out/b") {
+		t.Fatalf("Expected the failed start to be reported, got %v", err)
+	}
+	if s.current != before {
+		t.Fatal("Expected the running pipelines to be kept")
+	}
+	if !a.running || replacement.running {
+		t.Error("Expected the replaced exporter to be started again and its replacement stopped")
+	}
+
+	recv, ok := s.current.receivers["recv"].(*fakeReceiver)
+	if !ok || !recv.started {
+		t.Fatal("Expected the stopped receiver to be restored")
+	}
+	recv.consumer.ReceiveSpans([]models.Span{{Name: "GET /"}})
+	s.Shutdown(context.Background())
+	if len(a.received()) != 1 {
+		t.Errorf("Expected the restored pipeline to export, got %+v", a.received())
+	}
+}
+
+func TestServiceReloadRollsBackConnectors(t *testing.T) {
+	out, failing := &fakeExporter{}, &startExporter{err: errors.New("address in use")}
+	exps := map[string]exporters.Exporter{"out/a": out}
+	s := newTestService(t, map[string]config.PipelineConfig{
+		"traces":  {Receivers: []string{"recv"}, Exporters: []string{"calls"}},
+		"metrics": {Receivers: []string{"calls"}, Exporters: []string{"out/a"}},
+	}, exps)
+	if err := s.Start(context.Background()); err != nil {
+		t.Fatalf("Start failed: %v", err)
+	}
+	before := s.current
+
+	// Replace the connector, which is shut down before out/b fails to start
+	exps["out/b"] = failing
+	cfg := testConfig(map[string]config.PipelineConfig{
+		"traces":   {Receivers: []string{"recv"}, Exporters: []string{"calls"}},
+		"traces/b": {Receivers: []string{"recv"}, Exporters: []string{"out/b"}},
+		"metrics":  {Receivers: []string{"calls"}, Exporters: []string{"out/a"}},
+	}, exps)
+	cfg.Collector.Connectors["calls"] = config.ComponentConfig{"dimensions": []string{"http.method"}}
+	if err := s.Reload(context.Background(), cfg); err == nil {
+		t.Fatal("Expected the failed start to be reported")
+	}
+	if s.current != before {
+		t.Fatal("Expected the running pipelines to be kept")
+	}
+
+	batch := models.TelemetryBatch{Spans: []models.Span{{Name: "GET /", Attributes: map[string]string{}}}}
+	s.route(context.Background(), "recv", batch, nil)
+
+	// The restarted connector emits on its interval
+	calls := s.current.ingests["calls"]
+	deadline := time.Now().Add(5 * time.Second)
+	for calls.buffer.Stats().Metrics.Buffered == 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("Expected the restarted connector to emit on its interval")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	// and once more on shutdown
+	s.Shutdown(context.Background())
+	var last float64
+	for _, b := range out.received() {
+		for _, m := range b.Metrics {
+			if m.Name == processors.SpanCallsMetric {
+				last = m.Value
+			}
+		}
+	}
+	if last != 1 {
+		t.Errorf("Expected the span to be counted after the rollback, got %v", last)
+	}
+}
+
+func TestCloneBatch(t *testing.T) {
+	batch := models.TelemetryBatch{
+		Spans: []models.Span{{
+			Attributes: map[string]string{"k": "v"},
+			Events:     []models.SpanEvent{{Attributes: map[string]string{"k": "v"}}},
+		}},
+		Metrics: []models.Metric{{Histogram: &models.HistogramData{Buckets: []uint64{1}}}},
+	}
+
+	clone := cloneBatch(batch)
+	clone.Spans[0].Attributes["k"] = "changed"
+	clone.Spans[0].Events[0].Attributes["k"] = "changed"
+	clone.Metrics[0].Histogram.Buckets[0] = 2
+
+	if batch.Spans[0].Attributes["k"] != "v" || batch.Spans[0].Events[0].Attributes["k"] != "v" {
+		t.Error("Expected span attributes to be copied")
+	}
+	if batch.Metrics[0].Histogram.Buckets[0] != 1 {
+		t.Error("Expected histogram buckets to be copied")
+	}
+	if clone.Logs != nil {
+		t.Error("Expected nil slices to stay nil")
+	}
+}
+
+func TestSpanRing(t *testing.T) {
+	r := newSpanRing(3)
+	r.add([]models.Span{{Name: "a"}, {Name: "b"}})
+	if got := r.list(); len(got) != 2 || got[0].Name != "b" {
+		t.Fatalf("Expected newest first, got %+v", got)
+	}
+
+	r.add([]models.Span{{Name: "c"}, {Name: "d"}})
+	var names []string
+	for _, s := range r.list() {
+		names = append(names, s.Name)
+	}
+	if strings.Join(names, ",") != "d,c,b" {
+		t.Errorf("Expected the oldest span to be evicted, got %v", names)
+	}
+
+	if got := newSpanRing(0); len(got.list()) != 0 {
+		t.Error("Expected a zero-sized ring to keep nothing")
+	}
+}
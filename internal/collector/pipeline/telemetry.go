@@ -0,0 +1,202 @@
+package pipeline
+
+import (
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gaurav/watchingcat/internal/collector/exporters"
+	"github.com/gaurav/watchingcat/pkg/models"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// telemetry holds the collector's metrics about itself. Counters are
+// updated as data flows; buffer, queue and pipeline figures are read from
+// the components on scrape.
+type telemetry struct {
+	registry *prometheus.Registry
+
+	accepted     *prometheus.CounterVec
+	refused      *prometheus.CounterVec
+	sendDuration *prometheus.HistogramVec
+	sent         *prometheus.CounterVec
+	failed       *prometheus.CounterVec
+}
+
+func newTelemetry(s *Service) *telemetry {
+	t := &telemetry{
+		registry: prometheus.NewRegistry(),
+		accepted: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "otelcol_receiver_accepted_items_total",
+			Help: "Items accepted by a receiver into its buffer.",
+		}, []string{"receiver", "signal"}),
+		refused: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "otelcol_receiver_refused_items_total",
+			Help: "Items refused by a receiver, because its buffer was full or memory was short.",
+		}, []string{"receiver", "signal"}),
+		sendDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "otelcol_exporter_send_duration_seconds",
+			Help:    "Time from handing a batch to an exporter until it is done with it.",
+			Buckets: prometheus.ExponentialBuckets(0.001, 4, 9),
+		}, []string{"exporter"}),
+		sent: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "otelcol_exporter_sent_batches_total",
+			Help: "Batches an exporter finished with.",
+		}, []string{"exporter"}),
+		failed: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "otelcol_exporter_failed_batches_total",
+			Help: "Batches an exporter failed to send or queue.",
+		}, []string{"exporter"}),
+	}
+
+	t.registry.MustRegister(
+		t.accepted, t.refused, t.sendDuration, t.sent, t.failed,
+		&statsCollector{service: s},
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+	)
+	return t
+}
+
+// received counts items a receiver accepted or refused
+func (t *telemetry) received(receiver string, signal Signal, n int, err error) {
+	if err != nil {
+		t.refused.WithLabelValues(receiver, string(signal)).Add(float64(n))
+		return
+	}
+	t.accepted.WithLabelValues(receiver, string(signal)).Add(float64(n))
+}
+
+// exported records one batch handed to an exporter
+func (t *telemetry) exported(exporter string, start time.Time, err error) {
+	if err != nil {
+		t.failed.WithLabelValues(exporter).Inc()
+		return
+	}
+	t.sendDuration.WithLabelValues(exporter).Observe(time.Since(start).Seconds())
+	t.sent.WithLabelValues(exporter).Inc()
+}
+
+// MetricsHandler serves the collector's metrics about itself
+func (s *Service) MetricsHandler() http.Handler {
+	return promhttp.HandlerFor(s.telemetry.registry, promhttp.HandlerOpts{
+		ErrorHandling: promhttp.ContinueOnError,
+	})
+}
+
+var (
+	bufferItemsDesc = prometheus.NewDesc("otelcol_buffer_items",
+		"Items waiting in a receiver's buffer.", []string{"receiver", "signal"}, nil)
+	bufferDroppedDesc = prometheus.NewDesc("otelcol_buffer_dropped_items_total",
+		"Items dropped from a receiver's full buffer.", []string{"receiver", "signal"}, nil)
+	exporterQueueDesc = prometheus.NewDesc("otelcol_exporter_queue_size",
+		"Items waiting in an exporter's send queue.", []string{"exporter"}, nil)
+	exporterFailedItemsDesc = prometheus.NewDesc("otelcol_exporter_failed_items_total",
+		"Items a queueing exporter gave up sending.", []string{"exporter"}, nil)
+	exporterDroppedItemsDesc = prometheus.NewDesc("otelcol_exporter_dropped_items_total",
+		"Items dropped from a queueing exporter's full queue.", []string{"exporter"}, nil)
+	pipelineItemsDesc = prometheus.NewDesc("otelcol_pipeline_items_total",
+		"Items entering a pipeline (in) and reaching its exporters (out).", []string{"pipeline", "direction"}, nil)
+)
+
+// statsCollector reports figures the components already keep
+type statsCollector struct {
+	service *Service
+}
+
+func (c *statsCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- bufferItemsDesc
+	ch <- bufferDroppedDesc
+	ch <- exporterQueueDesc
+	ch <- exporterFailedItemsDesc
+	ch <- exporterDroppedItemsDesc
+	ch <- pipelineItemsDesc
+}
+
+func (c *statsCollector) Collect(ch chan<- prometheus.Metric) {
+	for receiver, stats := range c.service.BufferStats() {
+		for _, s := range []struct {
+			signal string
+			items  int
+			drops  uint64
+		}{
+			{"traces", stats.Spans.Buffered, stats.Spans.Dropped},
+			{"logs", stats.Logs.Buffered, stats.Logs.Dropped},
+			{"metrics", stats.Metrics.Buffered, stats.Metrics.Dropped},
+			{"exceptions", stats.Exceptions.Buffered, stats.Exceptions.Dropped},
+		} {
+			ch <- prometheus.MustNewConstMetric(bufferItemsDesc, prometheus.GaugeValue, float64(s.items), receiver, s.signal)
+			ch <- prometheus.MustNewConstMetric(bufferDroppedDesc, prometheus.CounterValue, float64(s.drops), receiver, s.signal)
+		}
+	}
+
+	for id, exporter := range c.service.Exporters() {
+		queued, ok := exporter.(interface {
+			Stats() exporters.TraceExportStats
+		})
+		if !ok {
+			continue
+		}
+		stats := queued.Stats()
+		ch <- prometheus.MustNewConstMetric(exporterQueueDesc, prometheus.GaugeValue, float64(stats.Queued), id)
+		ch <- prometheus.MustNewConstMetric(exporterFailedItemsDesc, prometheus.CounterValue, float64(stats.Failed), id)
+		ch <- prometheus.MustNewConstMetric(exporterDroppedItemsDesc, prometheus.CounterValue, float64(stats.Dropped), id)
+	}
+
+	for _, p := range c.service.Pipelines() {
+		stats := p.Stats()
+		ch <- prometheus.MustNewConstMetric(pipelineItemsDesc, prometheus.CounterValue, float64(stats.ItemsIn), p.name, "in")
+		ch <- prometheus.MustNewConstMetric(pipelineItemsDesc, prometheus.CounterValue, float64(stats.ItemsOut), p.name, "out")
+	}
+}
+
+// spanRing keeps the most recent spans a pipeline exported
+type spanRing struct {
+	mu    sync.Mutex
+	spans []models.Span
+	next  int
+	full  bool
+}
+
+func newSpanRing(size int) *spanRing {
+	if size < 0 {
+		size = 0
+	}
+	return &spanRing{spans: make([]models.Span, size)}
+}
+
+func (r *spanRing) add(spans []models.Span) {
+	if len(r.spans) == 0 {
+		return
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, span := range spans {
+		r.spans[r.next] = span
+		r.next = (r.next + 1) % len(r.spans)
+		if r.next == 0 {
+			r.full = true
+		}
+	}
+}
+
+// list returns the spans, newest first
+func (r *spanRing) list() []models.Span {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	n := r.next
+	if r.full {
+		n = len(r.spans)
+	}
+
+	out := make([]models.Span, 0, n)
+	for i := 1; i <= n; i++ {
+		out = append(out, r.spans[(r.next-i+len(r.spans))%len(r.spans)])
+	}
+	return out
+}
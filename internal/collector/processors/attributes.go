@@ -0,0 +1,206 @@
+package processors
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+
+	"github.com/gaurav/watchingcat/internal/config"
+	"github.com/gaurav/watchingcat/pkg/models"
+	"go.uber.org/zap"
+)
+
+// AttributesProcessor applies a chain of attribute actions, in order, to the
+// spans, logs and metrics selected by its include and exclude rules
+type AttributesProcessor struct {
+	selector selector
+	actions  []attributeAction
+	logger   *zap.Logger
+}
+
+// attributeAction modifies an attribute map in place
+type attributeAction struct {
+	key           string
+	kind          string
+	value         string
+	fromAttribute string
+	newKey        string
+	pattern       *regexp.Regexp
+	hashKey       []byte // HMAC key, set for the hash action
+}
+
+// NewAttributesProcessor creates an attributes processor
+func NewAttributesProcessor(cfg config.AttributesConfig, logger *zap.Logger) (*AttributesProcessor, error) {
+	if len(cfg.Actions) == 0 {
+		return nil, fmt.Errorf("attributes processor requires at least one action")
+	}
+
+	sel, err := newSelector(cfg.Include, cfg.Exclude)
+	if err != nil {
+		return nil, err
+	}
+
+	key := hashKey(cfg.HashKey, cfg.HashKeyEnv)
+	actions := make([]attributeAction, 0, len(cfg.Actions))
+	for i, ac := range cfg.Actions {
+		action, err := newAttributeAction(ac, key)
+		if err != nil {
+			return nil, fmt.Errorf("action %d: %w", i, err)
+		}
+		actions = append(actions, action)
+	}
+
+	return &AttributesProcessor{
+		selector: sel,
+		actions:  actions,
+		logger:   logger,
+	}, nil
+}
+
+// newAttributeAction validates and compiles an action. Hashing values
+// requires hashKey.
+func newAttributeAction(cfg config.AttributeActionConfig, hashKey []byte) (attributeAction, error) {
+	if cfg.Key == "" {
+		return attributeAction{}, fmt.Errorf("key is required")
+	}
+
+	action := attributeAction{
+		key:           cfg.Key,
+		kind:          cfg.Action,
+		value:         cfg.Value,
+		fromAttribute: cfg.FromAttribute,
+		newKey:        cfg.NewKey,
+	}
+
+	switch cfg.Action {
+	case "insert", "update", "upsert":
+		if cfg.Value == "" && cfg.FromAttribute == "" {
+			return attributeAction{}, fmt.Errorf("%s %s requires value or from_attribute", cfg.Action, cfg.Key)
+		}
+	case "delete":
+	case "hash":
+		if hashKey == nil {
+			return attributeAction{}, fmt.Errorf("hash %s: %w", cfg.Key, errNoHashKey)
+		}
+		action.hashKey = hashKey
+	case "rename":
+		if cfg.NewKey == "" {
+			return attributeAction{}, fmt.Errorf("rename %s requires new_key", cfg.Key)
+		}
+	case "extract":
+		re, err := regexp.Compile(cfg.Pattern)
+		if err != nil {
+			return attributeAction{}, fmt.Errorf("extract %s: invalid pattern: %w", cfg.Key, err)
+		}
+		named := false
+		for _, name := range re.SubexpNames() {
+			if name != "" {
+				named = true
+			}
+		}
+		if !named {
+			return attributeAction{}, fmt.Errorf("extract %s: pattern has no named groups", cfg.Key)
+		}
+		action.pattern = re
+	default:
+		return attributeAction{}, fmt.Errorf("unknown action %q", cfg.Action)
+	}
+
+	return action, nil
+}
+
+// Process applies the actions to the selected spans, logs and metrics.
+// Exceptions pass through.
+func (p *AttributesProcessor) Process(ctx context.Context, batch models.TelemetryBatch) (models.TelemetryBatch, error) {
+	for i := range batch.Spans {
+		span := &batch.Spans[i]
+		if p.selector.selects(span.Attributes[serviceNameKey], span.Name) {
+			span.Attributes = p.apply(span.Attributes)
+		}
+	}
+
+	for i := range batch.Logs {
+		log := &batch.Logs[i]
+		if p.selector.selects(serviceOf(log.ServiceName, log.Attributes), "") {
+			log.Attributes = p.apply(log.Attributes)
+		}
+	}
+
+	for i := range batch.Metrics {
+		metric := &batch.Metrics[i]
+		if p.selector.selects(serviceOf(metric.ServiceName, metric.Attributes), metric.Name) {
+			metric.Attributes = p.apply(metric.Attributes)
+		}
+	}
+
+	return batch, nil
+}
+
+// apply runs every action on attrs, allocating the map if needed
+func (p *AttributesProcessor) apply(attrs map[string]string) map[string]string {
+	if attrs == nil {
+		attrs = make(map[string]string)
+	}
+	for _, action := range p.actions {
+		action.apply(attrs)
+	}
+	return attrs
+}
+
+func (a attributeAction) apply(attrs map[string]string) {
+	current, exists := attrs[a.key]
+
+	switch a.kind {
+	case "insert", "update", "upsert":
+		if (a.kind == "insert" && exists) || (a.kind == "update" && !exists) {
+			return
+		}
+		value := a.value
+		if a.fromAttribute != "" {
+			from, ok := attrs[a.fromAttribute]
+			if !ok {
+				return
+			}
+			value = from
+		}
+		attrs[a.key] = value
+
+	case "delete":
+		delete(attrs, a.key)
+
+	case "hash":
+		if exists {
+			attrs[a.key] = hmacValue(a.hashKey, current)
+		}
+
+	case "rename":
+		if exists {
+			delete(attrs, a.key)
+			attrs[a.newKey] = current
+		}
+
+	case "extract":
+		if !exists {
+			return
+		}
+		match := a.pattern.FindStringSubmatchIndex(current)
+		if match == nil {
+			return
+		}
+		// Optional groups that did not participate are skipped
+		for i, name := range a.pattern.SubexpNames() {
+			if name != "" && match[2*i] >= 0 {
+				attrs[name] = current[match[2*i]:match[2*i+1]]
+			}
+		}
+	}
+}
+
+// serviceOf returns the service name field, falling back to the
+// service.name attribute
+func serviceOf(serviceName string, attrs map[string]string) string {
+	if serviceName != "" {
+		return serviceName
+	}
+	return attrs[serviceNameKey]
+}
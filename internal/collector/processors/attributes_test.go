@@ -0,0 +1,112 @@
+package processors
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/gaurav/watchingcat/internal/config"
+	"github.com/gaurav/watchingcat/pkg/models"
+	"go.uber.org/zap"
+)
+
+func TestAttributeActions(t *testing.T) {
+	p, err := NewAttributesProcessor(config.AttributesConfig{
+		Actions: []config.AttributeActionConfig{
+			{Key: "env", Value: "dev", Action: "insert"},
+			{Key: "region", Value: "eu", Action: "insert"},
+			{Key: "missing", Value: "x", Action: "update"},
+			{Key: "owner", FromAttribute: "team", Action: "upsert"},
+			{Key: "secret", Action: "delete"},
+			{Key: "user.email", Action: "hash"},
+			{Key: "tier", NewKey: "customer.tier", Action: "rename"},
+			{Key: "http.url", Pattern: `^https?://(?P<http_host>[^/]+)(?P<http_target>/.*)$`, Action: "extract"},
+		},
+		HashKey: "secret",
+	}, zap.NewNop())
+	if err != nil {
+		t.Fatalf("Failed to create processor: %v", err)
+	}
+
+	s := span("t", "root", "", time.Millisecond)
+	s.Attributes = map[string]string{
+		"region":     "us",
+		"team":       "payments",
+		"secret":     "hunter2",
+		"user.email": "a@example.com",
+		"tier":       "gold",
+		"http.url":   "https://shop.example.com/cart?id=1",
+	}
+
+	batch, _ := p.Process(context.Background(), models.TelemetryBatch{Spans: []models.Span{s}})
+	got := batch.Spans[0].Attributes
+
+	want := map[string]string{
+		"env":           "dev",
+		"region":        "us",
+		"team":          "payments",
+		"owner":         "payments",
+		"user.email":    hmacValue([]byte("secret"), "a@example.com"),
+		"customer.tier": "gold",
+		"http.url":      "https://shop.example.com/cart?id=1",
+		"http_host":     "shop.example.com",
+		"http_target":   "/cart?id=1",
+	}
+	if len(got) != len(want) {
+		t.Errorf("Expected %d attributes, got %v", len(want), got)
+	}
+	for k, v := range want {
+		if got[k] != v {
+			t.Errorf("Expected %s=%q, got %q", k, v, got[k])
+		}
+	}
+}
+
+func TestAttributesIncludeExclude(t *testing.T) {
+	p, err := NewAttributesProcessor(config.AttributesConfig{
+		Include: config.MatchConfig{MatchType: "regexp", Services: []string{"^cart"}},
+		Exclude: config.MatchConfig{Names: []string{"health"}},
+		Actions: []config.AttributeActionConfig{{Key: "tagged", Value: "yes", Action: "insert"}},
+	}, zap.NewNop())
+	if err != nil {
+		t.Fatalf("Failed to create processor: %v", err)
+	}
+
+	batch, _ := p.Process(context.Background(), models.TelemetryBatch{
+		Logs: []models.LogRecord{
+			{ServiceName: "cartservice"},
+			{ServiceName: "frontend"},
+		},
+		Metrics: []models.Metric{
+			{Name: "requests", ServiceName: "cartservice"},
+			{Name: "health", ServiceName: "cartservice"},
+		},
+	})
+
+	if batch.Logs[0].Attributes["tagged"] != "yes" || batch.Logs[1].Attributes["tagged"] != "" {
+		t.Errorf("Expected only cartservice logs to be tagged, got %v and %v", batch.Logs[0].Attributes, batch.Logs[1].Attributes)
+	}
+	if batch.Metrics[0].Attributes["tagged"] != "yes" || batch.Metrics[1].Attributes["tagged"] != "" {
+		t.Errorf("Expected the excluded metric to be untouched, got %v and %v", batch.Metrics[0].Attributes, batch.Metrics[1].Attributes)
+	}
+}
+
+func TestAttributesConfigErrors(t *testing.T) {
+	for _, cfg := range []config.AttributesConfig{
+		{},
+		{Actions: []config.AttributeActionConfig{{Action: "insert", Value: "x"}}},
+		{Actions: []config.AttributeActionConfig{{Key: "k", Action: "insert"}}},
+		{Actions: []config.AttributeActionConfig{{Key: "k", Action: "rename"}}},
+		{Actions: []config.AttributeActionConfig{{Key: "k", Action: "extract", Pattern: "(.*)"}}},
+		{Actions: []config.AttributeActionConfig{{Key: "k", Action: "unknown"}}},
+		{Actions: []config.AttributeActionConfig{{Key: "k", Action: "hash"}}}, // without a hash_key
+		{
+			Include: config.MatchConfig{MatchType: "glob", Services: []string{"cart"}},
+			Actions: []config.AttributeActionConfig{{Key: "k", Action: "delete"}},
+		},
+	} {
+		if _, err := NewAttributesProcessor(cfg, zap.NewNop()); err == nil {
+			t.Errorf("Expected error for %+v", cfg)
+		}
+	}
+}
@@ -0,0 +1,77 @@
+package processors
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// overflowAttribute labels the series a connector counts data in once it
+// tracks as many series as it may
+const overflowAttribute = "otel.metric.overflow"
+
+// emitter calls emit on an interval between Start and Shutdown, and once
+// more on Shutdown so nothing recorded since the last tick is lost. Like
+// the exporters it can be started again after Shutdown, as a rejected
+// reload does with the components it stopped.
+type emitter struct {
+	interval time.Duration
+	emit     func()
+
+	mu      sync.Mutex
+	stop    chan struct{} // nil when not running
+	done    chan struct{}
+	stopped bool // Shutdown has emitted since the last Start
+}
+
+func newEmitter(interval time.Duration, emit func()) *emitter {
+	return &emitter{
+		interval: interval,
+		emit:     emit,
+	}
+}
+
+// Start begins emitting on the interval. Starting a running emitter does
+// nothing.
+func (e *emitter) Start(ctx context.Context) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.stop != nil {
+		return nil
+	}
+	e.stop, e.done, e.stopped = make(chan struct{}), make(chan struct{}), false
+
+	go func(stop <-chan struct{}, done chan<- struct{}) {
+		defer close(done)
+		ticker := time.NewTicker(e.interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+				e.emit()
+			}
+		}
+	}(e.stop, e.done)
+	return nil
+}
+
+// Shutdown stops emitting on the interval and emits a last time. Later
+// calls do nothing until the emitter is started again.
+func (e *emitter) Shutdown(ctx context.Context) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.stopped {
+		return nil
+	}
+	if e.stop != nil {
+		close(e.stop)
+		<-e.done
+		e.stop, e.done = nil, nil
+	}
+	e.stopped = true
+	e.emit()
+	return nil
+}
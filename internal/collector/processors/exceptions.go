@@ -0,0 +1,103 @@
+package processors
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"sync/atomic"
+
+	"github.com/gaurav/watchingcat/pkg/models"
+	"go.uber.org/zap"
+)
+
+// Semantic convention names for recorded exceptions
+const (
+	exceptionEventName     = "exception"
+	exceptionTypeKey       = "exception.type"
+	exceptionMessageKey    = "exception.message"
+	exceptionStacktraceKey = "exception.stacktrace"
+	exceptionSeverityKey   = "exception.severity" // set by exceptions.Tracker
+)
+
+// ExceptionExtractor turns the exception events that span.RecordError adds
+// to spans into exception records, so exceptions from any OTel SDK are
+// tracked. Spans pass through unchanged.
+type ExceptionExtractor struct {
+	logger    *zap.Logger
+	extracted atomic.Uint64
+}
+
+// NewExceptionExtractor creates an exception extractor
+func NewExceptionExtractor(logger *zap.Logger) *ExceptionExtractor {
+	return &ExceptionExtractor{logger: logger}
+}
+
+// Process appends a record for every exception event in the batch's spans
+func (x *ExceptionExtractor) Process(ctx context.Context, batch models.TelemetryBatch) (models.TelemetryBatch, error) {
+	extracted := 0
+	for _, span := range batch.Spans {
+		for i, event := range span.Events {
+			if event.Name != exceptionEventName {
+				continue
+			}
+			batch.Exceptions = append(batch.Exceptions, exceptionFromEvent(span, i))
+			extracted++
+		}
+	}
+
+	if extracted > 0 {
+		x.extracted.Add(uint64(extracted))
+		x.logger.Debug("Extracted exceptions from spans", zap.Int("count", extracted))
+	}
+
+	return batch, nil
+}
+
+// Extracted returns the number of exceptions extracted so far
+func (x *ExceptionExtractor) Extracted() uint64 {
+	return x.extracted.Load()
+}
+
+// exceptionFromEvent builds a record from the span's i-th event. The ID is
+// derived from the span and event, so replaying a batch yields the same
+// record.
+func exceptionFromEvent(span models.Span, i int) models.ExceptionRecord {
+	event := span.Events[i]
+
+	tags := make(map[string]string)
+	for k, v := range event.Attributes {
+		switch k {
+		case exceptionTypeKey, exceptionMessageKey, exceptionStacktraceKey:
+		default:
+			tags[k] = v
+		}
+	}
+	tags["span.name"] = span.Name
+
+	severity := span.Attributes[exceptionSeverityKey]
+	if severity == "" {
+		severity = "error"
+	}
+
+	message := event.Attributes[exceptionMessageKey]
+	if message == "" {
+		message = span.Status.Message
+	}
+
+	sum := sha256.Sum256([]byte(fmt.Sprintf("%s/%s/%d", span.TraceID, span.SpanID, i)))
+
+	return models.ExceptionRecord{
+		ID:          "exc_" + hex.EncodeToString(sum[:8]),
+		Type:        event.Attributes[exceptionTypeKey],
+		Message:     message,
+		Severity:    severity,
+		Timestamp:   event.Timestamp,
+		TraceID:     span.TraceID,
+		SpanID:      span.SpanID,
+		StackTrace:  strings.TrimSpace(event.Attributes[exceptionStacktraceKey]),
+		Tags:        tags,
+		ServiceName: span.Attributes[serviceNameKey],
+	}
+}
@@ -0,0 +1,68 @@
+package processors
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/gaurav/watchingcat/pkg/models"
+	"go.uber.org/zap"
+)
+
+func TestExceptionExtractor(t *testing.T) {
+	x := NewExceptionExtractor(zap.NewNop())
+
+	failed := span("t1", "s1", "", time.Millisecond)
+	failed.Attributes["exception.severity"] = "critical"
+	failed.Events = []models.SpanEvent{
+		{Name: "cache miss"},
+		{
+			Name:      "exception",
+			Timestamp: time.Unix(1700000001, 0),
+			Attributes: map[string]string{
+				"exception.type":       "java.lang.IllegalStateException",
+				"exception.message":    "cart is empty",
+				"exception.stacktrace": "java.lang.IllegalStateException: cart is empty\n\tat Cart.checkout(Cart.java:42)\n",
+				"exception.escaped":    "true",
+			},
+		},
+	}
+
+	batch, _ := x.Process(context.Background(), models.TelemetryBatch{
+		Spans:      []models.Span{failed, span("t2", "s2", "", 0)},
+		Exceptions: []models.ExceptionRecord{{ID: "existing"}},
+	})
+
+	if len(batch.Spans) != 2 {
+		t.Errorf("Expected spans to pass through, got %d", len(batch.Spans))
+	}
+	if len(batch.Exceptions) != 2 {
+		t.Fatalf("Expected the existing and one extracted exception, got %d", len(batch.Exceptions))
+	}
+
+	exc := batch.Exceptions[1]
+	if exc.Type != "java.lang.IllegalStateException" || exc.Message != "cart is empty" {
+		t.Errorf("Unexpected type or message %+v", exc)
+	}
+	if exc.StackTrace != "java.lang.IllegalStateException: cart is empty\n\tat Cart.checkout(Cart.java:42)" {
+		t.Errorf("Unexpected stack trace %q", exc.StackTrace)
+	}
+	if exc.TraceID != "t1" || exc.SpanID != "s1" || exc.ServiceName != "frontend" || exc.Severity != "critical" {
+		t.Errorf("Unexpected span context %+v", exc)
+	}
+	if exc.Tags["exception.escaped"] != "true" || exc.Tags["span.name"] != "op" {
+		t.Errorf("Unexpected tags %v", exc.Tags)
+	}
+	if !exc.Timestamp.Equal(time.Unix(1700000001, 0)) {
+		t.Errorf("Expected the event timestamp, got %v", exc.Timestamp)
+	}
+
+	// Replaying the same span yields the same ID
+	again, _ := x.Process(context.Background(), models.TelemetryBatch{Spans: []models.Span{failed}})
+	if again.Exceptions[0].ID != exc.ID {
+		t.Errorf("Expected a stable ID, got %s and %s", exc.ID, again.Exceptions[0].ID)
+	}
+	if x.Extracted() != 2 {
+		t.Errorf("Expected 2 extracted, got %d", x.Extracted())
+	}
+}
@@ -0,0 +1,277 @@
+package processors
+
+import (
+	"context"
+	"fmt"
+	"sync/atomic"
+
+	"github.com/gaurav/watchingcat/internal/collector/expr"
+	"github.com/gaurav/watchingcat/internal/config"
+	"github.com/gaurav/watchingcat/pkg/models"
+	"go.uber.org/zap"
+)
+
+// filterFields lists the fields each signal exposes to expressions. Fields
+// marked true take a key, as in span.attributes["http.route"].
+var filterFields = map[string]map[string]bool{
+	"span": {
+		"name": false, "kind": false, "status": false, "status_message": false,
+		"service": false, "trace_id": false, "span_id": false, "parent_id": false,
+		"duration": false, "attributes": true,
+	},
+	"log": {
+		"severity": false, "message": false, "service": false,
+		"trace_id": false, "span_id": false, "attributes": true,
+	},
+	"metric": {
+		"name": false, "type": false, "value": false, "service": false, "attributes": true,
+	},
+	"exception": {
+		"type": false, "message": false, "severity": false, "service": false,
+		"trace_id": false, "stack_trace": false, "tags": true, "attributes": true,
+	},
+}
+
+// Filter drops telemetry using boolean expressions. An item is dropped if
+// it matches any drop expression, or if keep expressions reference its
+// signal and it matches none of them. Expressions only apply to the signals
+// they reference.
+type Filter struct {
+	drop   map[string][]*expr.Program // by referenced signal
+	keep   map[string][]*expr.Program
+	logger *zap.Logger
+
+	dropped [4]atomic.Uint64 // spans, logs, metrics, exceptions
+}
+
+// FilterStats holds the number of items dropped per signal
+type FilterStats struct {
+	Spans      uint64
+	Logs       uint64
+	Metrics    uint64
+	Exceptions uint64
+}
+
+// NewFilter creates a filter processor
+func NewFilter(cfg config.FilterConfig, logger *zap.Logger) (*Filter, error) {
+	if len(cfg.Drop) == 0 && len(cfg.Keep) == 0 {
+		return nil, fmt.Errorf("filter requires drop or keep expressions")
+	}
+
+	drop, err := compileFilters(cfg.Drop)
+	if err != nil {
+		return nil, fmt.Errorf("drop: %w", err)
+	}
+	keep, err := compileFilters(cfg.Keep)
+	if err != nil {
+		return nil, fmt.Errorf("keep: %w", err)
+	}
+
+	return &Filter{
+		drop:   drop,
+		keep:   keep,
+		logger: logger,
+	}, nil
+}
+
+// compileFilters compiles expressions, checks their field references and
+// groups them by the signals they reference
+func compileFilters(sources []string) (map[string][]*expr.Program, error) {
+	programs := make(map[string][]*expr.Program)
+	for _, source := range sources {
+		program, err := expr.Compile(source)
+		if err != nil {
+			return nil, fmt.Errorf("%q: %w", source, err)
+		}
+		if len(program.Refs()) == 0 {
+			return nil, fmt.Errorf("%q: expression references no fields", source)
+		}
+		for _, ref := range program.Refs() {
+			fields, ok := filterFields[ref.Signal]
+			if !ok {
+				return nil, fmt.Errorf("%q: unknown signal %q", source, ref.Signal)
+			}
+			keyed, ok := fields[ref.Field]
+			if !ok {
+				return nil, fmt.Errorf("%q: unknown field %s", source, ref)
+			}
+			if keyed != (ref.Key != "") {
+				if keyed {
+					return nil, fmt.Errorf("%q: %s needs a key, as in %s.%s[\"key\"]", source, ref, ref.Signal, ref.Field)
+				}
+				return nil, fmt.Errorf("%q: %s does not take a key", source, ref)
+			}
+		}
+		for _, signal := range program.Signals() {
+			programs[signal] = append(programs[signal], program)
+		}
+	}
+	return programs, nil
+}
+
+// Process drops the items selected by the filter expressions
+func (f *Filter) Process(ctx context.Context, batch models.TelemetryBatch) (models.TelemetryBatch, error) {
+	batch.Spans = filterItems(f, "span", batch.Spans, &f.dropped[0], func(s *models.Span) expr.Env { return spanEnv{s} })
+	batch.Logs = filterItems(f, "log", batch.Logs, &f.dropped[1], func(l *models.LogRecord) expr.Env { return logEnv{l} })
+	batch.Metrics = filterItems(f, "metric", batch.Metrics, &f.dropped[2], func(m *models.Metric) expr.Env { return metricEnv{m} })
+	batch.Exceptions = filterItems(f, "exception", batch.Exceptions, &f.dropped[3], func(e *models.ExceptionRecord) expr.Env { return exceptionEnv{e} })
+	return batch, nil
+}
+
+// Stats returns the number of items dropped per signal
+func (f *Filter) Stats() FilterStats {
+	return FilterStats{
+		Spans:      f.dropped[0].Load(),
+		Logs:       f.dropped[1].Load(),
+		Metrics:    f.dropped[2].Load(),
+		Exceptions: f.dropped[3].Load(),
+	}
+}
+
+// filterItems removes dropped items in place
+func filterItems[T any](f *Filter, signal string, items []T, dropped *atomic.Uint64, env func(*T) expr.Env) []T {
+	drop := f.drop[signal]
+	keep := f.keep[signal]
+	if len(items) == 0 || (len(drop) == 0 && len(keep) == 0) {
+		return items
+	}
+
+	kept := items[:0]
+	for i := range items {
+		e := env(&items[i])
+		if matchesAny(drop, e) || (len(keep) > 0 && !matchesAny(keep, e)) {
+			continue
+		}
+		kept = append(kept, items[i])
+	}
+
+	if n := len(items) - len(kept); n > 0 {
+		dropped.Add(uint64(n))
+	}
+	return kept
+}
+
+func matchesAny(programs []*expr.Program, env expr.Env) bool {
+	for _, p := range programs {
+		if p.Eval(env) {
+			return true
+		}
+	}
+	return false
+}
+
+// spanEnv exposes a span's fields
+type spanEnv struct{ span *models.Span }
+
+func (e spanEnv) Lookup(ref expr.Ref) (expr.Value, bool) {
+	if ref.Signal != "span" {
+		return expr.Value{}, false
+	}
+	s := e.span
+	switch ref.Field {
+	case "name":
+		return expr.String(s.Name), true
+	case "kind":
+		return expr.String(s.Kind), true
+	case "status":
+		return expr.String(s.Status.Code), true
+	case "status_message":
+		return expr.String(s.Status.Message), true
+	case "service":
+		return expr.String(s.Attributes[serviceNameKey]), true
+	case "trace_id":
+		return expr.String(s.TraceID), true
+	case "span_id":
+		return expr.String(s.SpanID), true
+	case "parent_id":
+		return expr.String(s.ParentID), true
+	case "duration":
+		return expr.Number(float64(s.EndTime.Sub(s.StartTime).Microseconds()) / 1000), true
+	case "attributes":
+		return lookupKey(s.Attributes, ref.Key)
+	}
+	return expr.Value{}, false
+}
+
+// logEnv exposes a log record's fields
+type logEnv struct{ log *models.LogRecord }
+
+func (e logEnv) Lookup(ref expr.Ref) (expr.Value, bool) {
+	if ref.Signal != "log" {
+		return expr.Value{}, false
+	}
+	l := e.log
+	switch ref.Field {
+	case "severity":
+		return expr.Severity(l.Severity), true
+	case "message":
+		return expr.String(l.Message), true
+	case "service":
+		return expr.String(serviceOf(l.ServiceName, l.Attributes)), true
+	case "trace_id":
+		return expr.String(l.TraceID), true
+	case "span_id":
+		return expr.String(l.SpanID), true
+	case "attributes":
+		return lookupKey(l.Attributes, ref.Key)
+	}
+	return expr.Value{}, false
+}
+
+// metricEnv exposes a metric's fields
+type metricEnv struct{ metric *models.Metric }
+
+func (e metricEnv) Lookup(ref expr.Ref) (expr.Value, bool) {
+	if ref.Signal != "metric" {
+		return expr.Value{}, false
+	}
+	m := e.metric
+	switch ref.Field {
+	case "name":
+		return expr.String(m.Name), true
+	case "type":
+		return expr.String(m.Type), true
+	case "value":
+		return expr.Number(m.Value), true
+	case "service":
+		return expr.String(serviceOf(m.ServiceName, m.Attributes)), true
+	case "attributes":
+		return lookupKey(m.Attributes, ref.Key)
+	}
+	return expr.Value{}, false
+}
+
+// exceptionEnv exposes an exception's fields
+type exceptionEnv struct{ exception *models.ExceptionRecord }
+
+func (e exceptionEnv) Lookup(ref expr.Ref) (expr.Value, bool) {
+	if ref.Signal != "exception" {
+		return expr.Value{}, false
+	}
+	x := e.exception
+	switch ref.Field {
+	case "type":
+		return expr.String(x.Type), true
+	case "message":
+		return expr.String(x.Message), true
+	case "severity":
+		return expr.Severity(x.Severity), true
+	case "service":
+		return expr.String(x.ServiceName), true
+	case "trace_id":
+		return expr.String(x.TraceID), true
+	case "stack_trace":
+		return expr.String(x.StackTrace), true
+	case "tags", "attributes":
+		return lookupKey(x.Tags, ref.Key)
+	}
+	return expr.Value{}, false
+}
+
+func lookupKey(attrs map[string]string, key string) (expr.Value, bool) {
+	v, ok := attrs[key]
+	if !ok {
+		return expr.Value{}, false
+	}
+	return expr.String(v), true
+}
@@ -0,0 +1,87 @@
+package processors
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/gaurav/watchingcat/internal/config"
+	"github.com/gaurav/watchingcat/pkg/models"
+	"go.uber.org/zap"
+)
+
+func TestFilterDrop(t *testing.T) {
+	f, err := NewFilter(config.FilterConfig{
+		Drop: []string{`span.name == "GET /health" or log.severity < "info"`},
+	}, zap.NewNop())
+	if err != nil {
+		t.Fatalf("Failed to create filter: %v", err)
+	}
+
+	health := span("t1", "a", "", time.Millisecond)
+	health.Name = "GET /health"
+
+	batch, _ := f.Process(context.Background(), models.TelemetryBatch{
+		Spans: []models.Span{health, span("t2", "a", "", time.Millisecond)},
+		Logs: []models.LogRecord{
+			{Severity: "DEBUG", Message: "noise"},
+			{Severity: "INFO", Message: "kept"},
+		},
+		Metrics: []models.Metric{{Name: "untouched"}},
+	})
+
+	if len(batch.Spans) != 1 || batch.Spans[0].TraceID != "t2" {
+		t.Errorf("Expected only the non-health span, got %+v", batch.Spans)
+	}
+	if len(batch.Logs) != 1 || batch.Logs[0].Message != "kept" {
+		t.Errorf("Expected only the info log, got %+v", batch.Logs)
+	}
+	if len(batch.Metrics) != 1 {
+		t.Errorf("Expected metrics to pass through, got %d", len(batch.Metrics))
+	}
+
+	if stats := f.Stats(); stats.Spans != 1 || stats.Logs != 1 || stats.Metrics != 0 {
+		t.Errorf("Unexpected stats %+v", stats)
+	}
+}
+
+func TestFilterKeep(t *testing.T) {
+	f, err := NewFilter(config.FilterConfig{
+		Keep: []string{`metric.name =~ "^http_" and metric.attributes["env"] == "prod"`},
+	}, zap.NewNop())
+	if err != nil {
+		t.Fatalf("Failed to create filter: %v", err)
+	}
+
+	batch, _ := f.Process(context.Background(), models.TelemetryBatch{
+		Spans: []models.Span{span("t", "a", "", 0)},
+		Metrics: []models.Metric{
+			{Name: "http_requests", Attributes: map[string]string{"env": "prod"}},
+			{Name: "http_requests", Attributes: map[string]string{"env": "dev"}},
+			{Name: "go_goroutines"},
+		},
+	})
+
+	if len(batch.Metrics) != 1 || batch.Metrics[0].Attributes["env"] != "prod" {
+		t.Errorf("Expected only the prod http metric, got %+v", batch.Metrics)
+	}
+	if len(batch.Spans) != 1 {
+		t.Errorf("Expected spans to pass through a metric-only keep rule, got %d", len(batch.Spans))
+	}
+}
+
+func TestFilterConfigErrors(t *testing.T) {
+	for _, cfg := range []config.FilterConfig{
+		{},
+		{Drop: []string{`span.name ==`}},
+		{Drop: []string{`trace.name == "x"`}},
+		{Drop: []string{`span.colour == "x"`}},
+		{Drop: []string{`span.attributes == "x"`}},
+		{Drop: []string{`span.name["k"] == "x"`}},
+		{Keep: []string{`true`}},
+	} {
+		if _, err := NewFilter(cfg, zap.NewNop()); err == nil {
+			t.Errorf("Expected error for %+v", cfg)
+		}
+	}
+}
@@ -0,0 +1,32 @@
+package processors
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"os"
+)
+
+var errNoHashKey = errors.New("hash requires a hash_key, or a hash_key_env naming a set variable")
+
+// hashKey returns key, or else the value of the environment variable env so
+// the key need not be written into the config file. It returns nil if
+// neither is set.
+func hashKey(key, env string) []byte {
+	if key == "" && env != "" {
+		key = os.Getenv(env)
+	}
+	if key == "" {
+		return nil
+	}
+	return []byte(key)
+}
+
+// hmacValue returns the hex HMAC-SHA256 of a value. Unlike a plain hash,
+// it cannot be reversed by hashing likely values without the key.
+func hmacValue(key []byte, value string) string {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(value))
+	return hex.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,62 @@
+package processors
+
+import (
+	"sort"
+
+	"github.com/gaurav/watchingcat/pkg/models"
+)
+
+// defaultDurationBuckets are used when no histogram buckets are configured
+var defaultDurationBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// durationBounds returns sorted bucket bounds in seconds, or the defaults
+func durationBounds(buckets []float64) []float64 {
+	if len(buckets) == 0 {
+		buckets = defaultDurationBuckets
+	}
+	sorted := append([]float64(nil), buckets...)
+	sort.Float64s(sorted)
+	return sorted
+}
+
+// durationHistogram accumulates durations in seconds into fixed buckets
+type durationHistogram struct {
+	bounds []float64
+	counts []uint64 // len(bounds)+1, last is +Inf
+	count  uint64
+	sum    float64
+}
+
+func newDurationHistogram(bounds []float64) *durationHistogram {
+	return &durationHistogram{
+		bounds: bounds,
+		counts: make([]uint64, len(bounds)+1),
+	}
+}
+
+func (h *durationHistogram) observe(seconds float64) {
+	if seconds < 0 {
+		seconds = 0
+	}
+	h.counts[sort.SearchFloat64s(h.bounds, seconds)]++
+	h.count++
+	h.sum += seconds
+}
+
+// data returns a snapshot of the histogram
+func (h *durationHistogram) data() *models.HistogramData {
+	return &models.HistogramData{
+		Count:   h.count,
+		Sum:     h.sum,
+		Bounds:  h.bounds,
+		Buckets: append([]uint64(nil), h.counts...),
+	}
+}
+
+func copyAttributes(attrs map[string]string) map[string]string {
+	copied := make(map[string]string, len(attrs))
+	for k, v := range attrs {
+		copied[k] = v
+	}
+	return copied
+}
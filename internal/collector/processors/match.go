@@ -0,0 +1,101 @@
+package processors
+
+import (
+	"fmt"
+	"regexp"
+
+	"github.com/gaurav/watchingcat/internal/config"
+)
+
+// matcher selects telemetry by service and name
+type matcher struct {
+	services []*regexp.Regexp
+	names    []*regexp.Regexp
+}
+
+// newMatcher compiles a match config. It returns nil for an empty config,
+// which callers treat as no restriction.
+func newMatcher(cfg config.MatchConfig) (*matcher, error) {
+	if len(cfg.Services) == 0 && len(cfg.Names) == 0 {
+		return nil, nil
+	}
+
+	compile := func(patterns []string) ([]*regexp.Regexp, error) {
+		compiled := make([]*regexp.Regexp, 0, len(patterns))
+		for _, p := range patterns {
+			switch cfg.MatchType {
+			case "", "strict":
+				p = "^" + regexp.QuoteMeta(p) + "$"
+			case "regexp":
+			default:
+				return nil, fmt.Errorf("unknown match_type %q", cfg.MatchType)
+			}
+			re, err := regexp.Compile(p)
+			if err != nil {
+				return nil, fmt.Errorf("invalid pattern %q: %w", p, err)
+			}
+			compiled = append(compiled, re)
+		}
+		return compiled, nil
+	}
+
+	services, err := compile(cfg.Services)
+	if err != nil {
+		return nil, err
+	}
+	names, err := compile(cfg.Names)
+	if err != nil {
+		return nil, err
+	}
+
+	return &matcher{services: services, names: names}, nil
+}
+
+// match reports whether both the service and the name match one of their
+// patterns. Logs have no name and are matched with an empty one.
+func (m *matcher) match(service, name string) bool {
+	return matchAny(m.services, service) && matchAny(m.names, name)
+}
+
+// matchAny reports whether value matches one of the patterns, or true if
+// there are none
+func matchAny(patterns []*regexp.Regexp, value string) bool {
+	if len(patterns) == 0 {
+		return true
+	}
+	for _, re := range patterns {
+		if re.MatchString(value) {
+			return true
+		}
+	}
+	return false
+}
+
+// selector combines include and exclude matchers
+type selector struct {
+	include *matcher
+	exclude *matcher
+}
+
+func newSelector(include, exclude config.MatchConfig) (selector, error) {
+	in, err := newMatcher(include)
+	if err != nil {
+		return selector{}, fmt.Errorf("include: %w", err)
+	}
+	ex, err := newMatcher(exclude)
+	if err != nil {
+		return selector{}, fmt.Errorf("exclude: %w", err)
+	}
+	return selector{include: in, exclude: ex}, nil
+}
+
+// selects reports whether telemetry is included and not excluded
+func (s selector) selects(service, name string) bool {
+	if s.include != nil && !s.include.match(service, name) {
+		return false
+	}
+	if s.exclude != nil && s.exclude.match(service, name) {
+		return false
+	}
+	return true
+}
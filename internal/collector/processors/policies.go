@@ -0,0 +1,224 @@
+package processors
+
+import (
+	"fmt"
+	"hash/fnv"
+	"sync"
+	"time"
+
+	"github.com/gaurav/watchingcat/internal/config"
+	"github.com/gaurav/watchingcat/pkg/models"
+)
+
+// serviceNameKey is the span attribute naming the emitting service
+const serviceNameKey = "service.name"
+
+// samplingPolicy decides whether a complete trace is kept
+type samplingPolicy interface {
+	name() string
+	evaluate(spans []models.Span) bool
+}
+
+// newSamplingPolicy builds a policy from its config
+func newSamplingPolicy(cfg config.SamplingPolicyConfig) (samplingPolicy, error) {
+	name := cfg.Name
+	if name == "" {
+		name = cfg.Type
+	}
+
+	switch cfg.Type {
+	case "status_code":
+		return &errorPolicy{policyName: name}, nil
+
+	case "latency":
+		if cfg.Threshold <= 0 {
+			return nil, fmt.Errorf("policy %s: latency threshold must be positive", name)
+		}
+		return &latencyPolicy{policyName: name, threshold: cfg.Threshold}, nil
+
+	case "string_attribute":
+		if cfg.Key == "" || len(cfg.Values) == 0 {
+			return nil, fmt.Errorf("policy %s: string_attribute requires key and values", name)
+		}
+		values := make(map[string]bool, len(cfg.Values))
+		for _, v := range cfg.Values {
+			values[v] = true
+		}
+		return &attributePolicy{policyName: name, key: cfg.Key, values: values}, nil
+
+	case "rate_limiting":
+		if cfg.TracesPerSecond <= 0 {
+			return nil, fmt.Errorf("policy %s: traces_per_second must be positive", name)
+		}
+		return &rateLimitPolicy{
+			policyName: name,
+			limit:      cfg.TracesPerSecond,
+			now:        time.Now,
+			windows:    make(map[string]*rateWindow),
+		}, nil
+
+	case "probabilistic":
+		if cfg.SamplingPercentage < 0 || cfg.SamplingPercentage > 100 {
+			return nil, fmt.Errorf("policy %s: sampling_percentage must be between 0 and 100", name)
+		}
+		return &probabilisticPolicy{policyName: name, ratio: cfg.SamplingPercentage / 100}, nil
+	}
+
+	return nil, fmt.Errorf("policy %s: unknown type %q", name, cfg.Type)
+}
+
+// errorPolicy samples traces containing a span with error status
+type errorPolicy struct {
+	policyName string
+}
+
+func (p *errorPolicy) name() string { return p.policyName }
+
+func (p *errorPolicy) evaluate(spans []models.Span) bool {
+	for _, span := range spans {
+		if span.Status.Code == "ERROR" {
+			return true
+		}
+	}
+	return false
+}
+
+// latencyPolicy samples traces whose root span is slower than the threshold.
+// Without a root span the duration of the whole trace is used.
+type latencyPolicy struct {
+	policyName string
+	threshold  time.Duration
+}
+
+func (p *latencyPolicy) name() string { return p.policyName }
+
+func (p *latencyPolicy) evaluate(spans []models.Span) bool {
+	if root := rootSpan(spans); root != nil {
+		return root.EndTime.Sub(root.StartTime) > p.threshold
+	}
+
+	var start, end time.Time
+	for _, span := range spans {
+		if start.IsZero() || span.StartTime.Before(start) {
+			start = span.StartTime
+		}
+		if span.EndTime.After(end) {
+			end = span.EndTime
+		}
+	}
+	return end.Sub(start) > p.threshold
+}
+
+// attributePolicy samples traces with a span attribute set to one of the
+// configured values
+type attributePolicy struct {
+	policyName string
+	key        string
+	values     map[string]bool
+}
+
+func (p *attributePolicy) name() string { return p.policyName }
+
+func (p *attributePolicy) evaluate(spans []models.Span) bool {
+	for _, span := range spans {
+		if v, ok := span.Attributes[p.key]; ok && p.values[v] {
+			return true
+		}
+	}
+	return false
+}
+
+// rateLimitPolicy samples up to limit traces per second for each service,
+// keyed by the root span's service. Windows are dropped once their second
+// has passed, so only services seen in the current second are held.
+type rateLimitPolicy struct {
+	policyName string
+	limit      int
+	now        func() time.Time
+
+	mu      sync.Mutex
+	windows map[string]*rateWindow
+	swept   int64 // second the stale windows were last dropped in
+}
+
+// rateWindow counts traces sampled within one second
+type rateWindow struct {
+	second int64
+	count  int
+}
+
+func (p *rateLimitPolicy) name() string { return p.policyName }
+
+func (p *rateLimitPolicy) evaluate(spans []models.Span) bool {
+	service := ""
+	if root := rootSpan(spans); root != nil {
+		service = root.Attributes[serviceNameKey]
+	} else if len(spans) > 0 {
+		service = spans[0].Attributes[serviceNameKey]
+	}
+
+	second := p.now().Unix()
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if second != p.swept {
+		for key, w := range p.windows {
+			if w.second != second {
+				delete(p.windows, key)
+			}
+		}
+		p.swept = second
+	}
+
+	w, ok := p.windows[service]
+	if !ok || w.second != second {
+		w = &rateWindow{second: second}
+		p.windows[service] = w
+	}
+	if w.count >= p.limit {
+		return false
+	}
+	w.count++
+	return true
+}
+
+// probabilisticPolicy samples a fixed share of traces by hashing the trace
+// ID, so every collector makes the same decision for a trace
+type probabilisticPolicy struct {
+	policyName string
+	ratio      float64
+}
+
+func (p *probabilisticPolicy) name() string { return p.policyName }
+
+func (p *probabilisticPolicy) evaluate(spans []models.Span) bool {
+	if len(spans) == 0 {
+		return false
+	}
+	h := fnv.New64a()
+	h.Write([]byte(spans[0].TraceID))
+	// Map the top 53 bits of the mixed hash onto [0, 1)
+	return float64(mix64(h.Sum64())>>11)/(1<<53) < p.ratio
+}
+
+// mix64 is the splitmix64 finalizer. FNV alone leaves the high bits poorly
+// distributed for IDs that differ only in their last characters.
+func mix64(x uint64) uint64 {
+	x ^= x >> 30
+	x *= 0xbf58476d1ce4e5b9
+	x ^= x >> 27
+	x *= 0x94d049bb133111eb
+	x ^= x >> 31
+	return x
+}
+
+// rootSpan returns the span without a parent, if the trace has one
+func rootSpan(spans []models.Span) *models.Span {
+	for i := range spans {
+		if spans[i].ParentID == "" {
+			return &spans[i]
+		}
+	}
+	return nil
+}
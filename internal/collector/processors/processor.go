@@ -0,0 +1,41 @@
+package processors
+
+import (
+	"context"
+
+	"github.com/gaurav/watchingcat/pkg/models"
+)
+
+// Processor transforms a batch of telemetry on its way to the exporters
+type Processor interface {
+	Process(ctx context.Context, batch models.TelemetryBatch) (models.TelemetryBatch, error)
+}
+
+// BatchAck is the acknowledgement of the batch being processed. A processor
+// holding data back past Process uses it to keep the batch, and its WAL
+// segment, until the held data has been exported.
+type BatchAck interface {
+	// Hold delays the acknowledgement until release is called
+	Hold() (release func())
+	// OnAck calls fn once the batch has been acknowledged
+	OnAck(fn func())
+}
+
+type batchAckKey struct{}
+
+// WithBatchAck returns a context carrying the acknowledgement of the batch
+// being processed
+func WithBatchAck(ctx context.Context, ack BatchAck) context.Context {
+	return context.WithValue(ctx, batchAckKey{}, ack)
+}
+
+// batchAckFrom returns the acknowledgement ctx carries, or nil
+func batchAckFrom(ctx context.Context) BatchAck {
+	ack, _ := ctx.Value(batchAckKey{}).(BatchAck)
+	return ack
+}
+
+// MetricsConsumer accepts the metrics a connector derives
+type MetricsConsumer interface {
+	ReceiveMetrics(metrics []models.Metric) error
+}
@@ -0,0 +1,266 @@
+package processors
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"regexp"
+	"strings"
+	"sync/atomic"
+
+	"github.com/gaurav/watchingcat/internal/config"
+	"github.com/gaurav/watchingcat/pkg/models"
+	"go.uber.org/zap"
+)
+
+// builtinDetectors are the detector types available without a pattern.
+// A group named value narrows the redaction to part of the match.
+var builtinDetectors = map[string]struct {
+	pattern string
+	valid   func(string) bool
+	bounded bool
+}{
+	"credit_card":  {pattern: `\b(?:\d[ -]?){12,18}\d\b`, valid: luhnValid},
+	"email":        {pattern: `[A-Za-z0-9._%+-]+@[A-Za-z0-9.-]+\.[A-Za-z]{2,}`},
+	"ip":           {pattern: `(?:\d{1,3}\.){3}\d{1,3}|[0-9A-Fa-f]{0,4}(?::[0-9A-Fa-f]{0,4}){2,7}`, valid: ipValid, bounded: true},
+	"bearer_token": {pattern: `(?i)\bbearer\s+(?P<value>[A-Za-z0-9\-._~+/]+=*)`},
+}
+
+// defaultDetectorTypes are used when redaction is enabled without detectors
+var defaultDetectorTypes = []string{"bearer_token", "email", "credit_card", "ip"}
+
+// Redactor masks or hashes sensitive values in span attributes, event
+// attributes and status messages, log messages and attributes, and
+// exception messages, stack traces and tags. Detectors run in order.
+type Redactor struct {
+	detectors []*detector
+	logger    *zap.Logger
+}
+
+// detector finds one kind of sensitive value
+type detector struct {
+	name    string
+	re      *regexp.Regexp
+	group   int               // submatch to redact, or 0 for the whole match
+	valid   func(string) bool // rejects false positives, may be nil
+	bounded bool              // the value must not touch word characters
+	hashKey []byte            // HMAC key, set for the hash action
+	count   atomic.Uint64
+}
+
+// NewRedactor creates a redaction processor
+func NewRedactor(cfg config.RedactionConfig, logger *zap.Logger) (*Redactor, error) {
+	detectorCfgs := cfg.Detectors
+	if len(detectorCfgs) == 0 {
+		for _, t := range defaultDetectorTypes {
+			detectorCfgs = append(detectorCfgs, config.RedactionDetectorConfig{Type: t})
+		}
+	}
+
+	detectors := make([]*detector, 0, len(detectorCfgs))
+	names := make(map[string]bool, len(detectorCfgs))
+	for _, dc := range detectorCfgs {
+		d, err := newDetector(dc, hashKey(cfg.HashKey, cfg.HashKeyEnv))
+		if err != nil {
+			return nil, err
+		}
+		if names[d.name] {
+			return nil, fmt.Errorf("detector %s: duplicate name", d.name)
+		}
+		names[d.name] = true
+		detectors = append(detectors, d)
+	}
+
+	return &Redactor{
+		detectors: detectors,
+		logger:    logger,
+	}, nil
+}
+
+// newDetector builds a detector from its config. Hashing values requires
+// hashKey.
+func newDetector(cfg config.RedactionDetectorConfig, hashKey []byte) (*detector, error) {
+	name := cfg.Name
+	if name == "" {
+		name = cfg.Type
+	}
+
+	d := &detector{name: name}
+
+	switch cfg.Action {
+	case "", "mask":
+	case "hash":
+		if hashKey == nil {
+			return nil, fmt.Errorf("detector %s: %w", name, errNoHashKey)
+		}
+		d.hashKey = hashKey
+	default:
+		return nil, fmt.Errorf("detector %s: unknown action %q", name, cfg.Action)
+	}
+
+	pattern := cfg.Pattern
+	if cfg.Type == "regex" {
+		if pattern == "" {
+			return nil, fmt.Errorf("detector %s: regex requires a pattern", name)
+		}
+	} else {
+		builtin, ok := builtinDetectors[cfg.Type]
+		if !ok {
+			return nil, fmt.Errorf("detector %s: unknown type %q", name, cfg.Type)
+		}
+		pattern = builtin.pattern
+		d.valid = builtin.valid
+		d.bounded = builtin.bounded
+	}
+
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, fmt.Errorf("detector %s: invalid pattern: %w", name, err)
+	}
+	d.re = re
+	if i := re.SubexpIndex("value"); i > 0 {
+		d.group = i
+	}
+
+	return d, nil
+}
+
+// Process redacts the batch's spans, logs and exceptions. Metrics pass
+// through.
+func (r *Redactor) Process(ctx context.Context, batch models.TelemetryBatch) (models.TelemetryBatch, error) {
+	for i := range batch.Spans {
+		span := &batch.Spans[i]
+		r.redactMap(span.Attributes)
+		for j := range span.Events {
+			r.redactMap(span.Events[j].Attributes)
+		}
+		span.Status.Message = r.redact(span.Status.Message)
+	}
+
+	for i := range batch.Logs {
+		log := &batch.Logs[i]
+		log.Message = r.redact(log.Message)
+		r.redactMap(log.Attributes)
+	}
+
+	for i := range batch.Exceptions {
+		exc := &batch.Exceptions[i]
+		exc.Message = r.redact(exc.Message)
+		exc.StackTrace = r.redact(exc.StackTrace)
+		r.redactMap(exc.Tags)
+	}
+
+	return batch, nil
+}
+
+// Stats returns the number of redactions per detector
+func (r *Redactor) Stats() map[string]uint64 {
+	stats := make(map[string]uint64, len(r.detectors))
+	for _, d := range r.detectors {
+		stats[d.name] = d.count.Load()
+	}
+	return stats
+}
+
+// redactMap redacts attribute values in place
+func (r *Redactor) redactMap(attrs map[string]string) {
+	for k, v := range attrs {
+		if redacted := r.redact(v); redacted != v {
+			attrs[k] = redacted
+		}
+	}
+}
+
+// redact runs every detector over s
+func (r *Redactor) redact(s string) string {
+	if s == "" {
+		return s
+	}
+	for _, d := range r.detectors {
+		s = d.redact(s)
+	}
+	return s
+}
+
+// redact replaces the detector's matches in s and counts them
+func (d *detector) redact(s string) string {
+	matches := d.re.FindAllStringSubmatchIndex(s, -1)
+	if matches == nil {
+		return s
+	}
+
+	var b strings.Builder
+	last, redacted := 0, 0
+	for _, m := range matches {
+		start, end := m[0], m[1]
+		if d.group > 0 {
+			if m[2*d.group] < 0 {
+				continue
+			}
+			start, end = m[2*d.group], m[2*d.group+1]
+		}
+
+		value := s[start:end]
+		if value == "" || (d.valid != nil && !d.valid(value)) {
+			continue
+		}
+		if d.bounded && (touchesWord(s, start-1) || touchesWord(s, end)) {
+			continue
+		}
+
+		b.WriteString(s[last:start])
+		if d.hashKey != nil {
+			b.WriteString(hmacValue(d.hashKey, value))
+		} else {
+			b.WriteString("[REDACTED:" + d.name + "]")
+		}
+		last = end
+		redacted++
+	}
+
+	if redacted == 0 {
+		return s
+	}
+	b.WriteString(s[last:])
+	d.count.Add(uint64(redacted))
+
+	return b.String()
+}
+
+// touchesWord reports whether s[i] exists and is a word character, so the
+// value is part of a longer identifier such as std::basic
+func touchesWord(s string, i int) bool {
+	if i < 0 || i >= len(s) {
+		return false
+	}
+	c := s[i]
+	return c == '_' || (c >= '0' && c <= '9') || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
+
+// luhnValid reports whether the digits of s pass the Luhn checksum
+func luhnValid(s string) bool {
+	sum, digits := 0, 0
+	double := false
+	for i := len(s) - 1; i >= 0; i-- {
+		c := s[i]
+		if c < '0' || c > '9' {
+			continue
+		}
+		n := int(c - '0')
+		if double {
+			n *= 2
+			if n > 9 {
+				n -= 9
+			}
+		}
+		sum += n
+		double = !double
+		digits++
+	}
+	return digits >= 13 && digits <= 19 && sum%10 == 0
+}
+
+// ipValid reports whether s is an IPv4 or IPv6 address
+func ipValid(s string) bool {
+	return net.ParseIP(s) != nil
+}
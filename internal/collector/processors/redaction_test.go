@@ -0,0 +1,111 @@
+package processors
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/gaurav/watchingcat/internal/config"
+	"github.com/gaurav/watchingcat/pkg/models"
+	"go.uber.org/zap"
+)
+
+func TestRedactorBuiltins(t *testing.T) {
+	r, err := NewRedactor(config.RedactionConfig{}, zap.NewNop())
+	if err != nil {
+		t.Fatalf("Failed to create redactor: %v", err)
+	}
+
+	cases := []struct {
+		in   string
+		want string
+	}{
+		{"card 4111 1111 1111 1111 charged", "card [REDACTED:credit_card] charged"},
+		{"order 4111111111111112 placed", "order 4111111111111112 placed"}, // fails Luhn
+		{"mail jane.doe+shop@example.com now", "mail [REDACTED:email] now"},
+		{"from 10.0.0.12.", "from [REDACTED:ip]."},
+		{"peer fe80::1 closed", "peer [REDACTED:ip] closed"},
+		{"at std::basic_string", "at std::basic_string"},
+		{"Authorization: Bearer abc.def-123=", "Authorization: Bearer [REDACTED:bearer_token]"},
+		{"at 12:30:45", "at 12:30:45"},
+	}
+
+	for _, tc := range cases {
+		if got := r.redact(tc.in); got != tc.want {
+			t.Errorf("redact(%q) = %q, want %q", tc.in, got, tc.want)
+		}
+	}
+}
+
+func TestRedactorFieldsAndStats(t *testing.T) {
+	r, err := NewRedactor(config.RedactionConfig{
+		Detectors: []config.RedactionDetectorConfig{
+			{Type: "email", Action: "hash"},
+			{Name: "ssn", Type: "regex", Pattern: `\b\d{3}-\d{2}-\d{4}\b`},
+		},
+		HashKey: "secret",
+	}, zap.NewNop())
+	if err != nil {
+		t.Fatalf("Failed to create redactor: %v", err)
+	}
+
+	batch, _ := r.Process(context.Background(), models.TelemetryBatch{
+		Spans: []models.Span{{
+			Attributes: map[string]string{"user.email": "a@example.com"},
+			Events:     []models.SpanEvent{{Attributes: map[string]string{"exception.message": "bad ssn 123-45-6789"}}},
+		}},
+		Logs:       []models.LogRecord{{Message: "login by a@example.com"}},
+		Exceptions: []models.ExceptionRecord{{StackTrace: "ssn=123-45-6789\n\tat main.go:10"}},
+	})
+
+	if got := batch.Spans[0].Attributes["user.email"]; got != hmacValue([]byte("secret"), "a@example.com") {
+		t.Errorf("Expected the email to be hashed with the key, got %q", got)
+	}
+	if got := batch.Spans[0].Events[0].Attributes["exception.message"]; got != "bad ssn [REDACTED:ssn]" {
+		t.Errorf("Unexpected event attribute %q", got)
+	}
+	if got := batch.Logs[0].Message; !strings.HasPrefix(got, "login by ") || strings.Contains(got, "@") {
+		t.Errorf("Expected the log message email to be hashed, got %q", got)
+	}
+	if got := batch.Exceptions[0].StackTrace; got != "ssn=[REDACTED:ssn]\n\tat main.go:10" {
+		t.Errorf("Unexpected stack trace %q", got)
+	}
+
+	if stats := r.Stats(); stats["email"] != 2 || stats["ssn"] != 2 {
+		t.Errorf("Unexpected redaction counts %v", stats)
+	}
+}
+
+func TestRedactorHashKeyEnv(t *testing.T) {
+	cfg := config.RedactionConfig{
+		Detectors:  []config.RedactionDetectorConfig{{Type: "email", Action: "hash"}},
+		HashKeyEnv: "TEST_REDACTION_HASH_KEY",
+	}
+	t.Setenv("TEST_REDACTION_HASH_KEY", "")
+	if _, err := NewRedactor(cfg, zap.NewNop()); err == nil {
+		t.Error("Expected an error for an unset hash_key_env")
+	}
+
+	t.Setenv("TEST_REDACTION_HASH_KEY", "secret")
+	r, err := NewRedactor(cfg, zap.NewNop())
+	if err != nil {
+		t.Fatalf("Failed to create redactor: %v", err)
+	}
+	if got := r.redact("a@example.com"); got != hmacValue([]byte("secret"), "a@example.com") {
+		t.Errorf("Expected the email to be hashed with the key from the environment, got %q", got)
+	}
+}
+
+func TestRedactorConfigErrors(t *testing.T) {
+	for _, dc := range []config.RedactionDetectorConfig{
+		{Type: "passport"},
+		{Type: "regex"},
+		{Type: "regex", Pattern: "("},
+		{Type: "email", Action: "drop"},
+		{Type: "email", Action: "hash"}, // without a hash_key
+	} {
+		if _, err := NewRedactor(config.RedactionConfig{Detectors: []config.RedactionDetectorConfig{dc}}, zap.NewNop()); err == nil {
+			t.Errorf("Expected error for %+v", dc)
+		}
+	}
+}
@@ -0,0 +1,210 @@
+package processors
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/gaurav/watchingcat/internal/config"
+	"github.com/gaurav/watchingcat/internal/servicegraph"
+	"github.com/gaurav/watchingcat/pkg/models"
+	"go.uber.org/zap"
+)
+
+// Names of the metrics derived from service-to-service calls
+const (
+	ServiceGraphRequestsMetric = "servicegraph_requests"
+	ServiceGraphFailedMetric   = "servicegraph_failed_requests"
+	ServiceGraphLatencyMetric  = "servicegraph_request_duration_seconds"
+)
+
+// ServiceGraph is a connector from traces to metrics. It pairs each span with
+// its parent and, when they belong to different services, counts a call on
+// the client to server edge. Parents and children may arrive in different
+// batches. The edge metrics are handed to next.
+//
+// Like SpanMetrics, values are cumulative, every edge is emitted on the
+// interval, edges without calls for the expiry are dropped and calls beyond
+// maxSeries edges are counted in a single overflow series.
+type ServiceGraph struct {
+	*emitter
+
+	buckets   []float64
+	maxSeries int
+	expiry    time.Duration
+	next      MetricsConsumer
+	logger    *zap.Logger
+	now       func() time.Time
+
+	mu       sync.Mutex
+	matcher  *servicegraph.Matcher
+	edges    map[edgeKey]*edgeSeries
+	overflow *edgeSeries
+}
+
+// edgeKey identifies a client to server edge
+type edgeKey struct {
+	client string
+	server string
+}
+
+// edgeSeries accumulates call metrics for one edge
+type edgeSeries struct {
+	attributes map[string]string
+	requests   uint64
+	failed     uint64
+	latency    *durationHistogram
+	updated    time.Time
+}
+
+// NewServiceGraph creates a service graph connector with the given latency
+// buckets in seconds
+func NewServiceGraph(cfg config.ServiceGraphConfig, buckets []float64, next MetricsConsumer, logger *zap.Logger) *ServiceGraph {
+	maxPending := cfg.MaxPending
+	if maxPending <= 0 {
+		maxPending = 10000
+	}
+	interval := cfg.Interval
+	if interval <= 0 {
+		interval = 15 * time.Second
+	}
+	maxSeries := cfg.MaxSeries
+	if maxSeries <= 0 {
+		maxSeries = 10000
+	}
+	expiry := cfg.Expiry
+	if expiry <= 0 {
+		expiry = 5 * time.Minute
+	}
+
+	g := &ServiceGraph{
+		buckets:   durationBounds(buckets),
+		maxSeries: maxSeries,
+		expiry:    expiry,
+		next:      next,
+		logger:    logger,
+		now:       time.Now,
+		matcher:   servicegraph.NewMatcher(maxPending),
+		edges:     make(map[edgeKey]*edgeSeries),
+	}
+	g.emitter = newEmitter(interval, g.emit)
+	return g
+}
+
+// Export pairs the batch's spans and records the calls found. They are
+// emitted on the next interval.
+func (g *ServiceGraph) Export(ctx context.Context, batch models.TelemetryBatch) error {
+	if len(batch.Spans) == 0 {
+		return nil
+	}
+
+	g.mu.Lock()
+	now := g.now()
+	for _, span := range servicegraph.FromModels(batch.Spans) {
+		for _, call := range g.matcher.Add(span) {
+			g.record(call, now)
+		}
+	}
+	g.mu.Unlock()
+	return nil
+}
+
+// emit drops expired edges and hands the rest to next
+func (g *ServiceGraph) emit() {
+	g.mu.Lock()
+	now := g.now()
+	for key, edge := range g.edges {
+		if now.Sub(edge.updated) > g.expiry {
+			delete(g.edges, key)
+		}
+	}
+	if g.overflow != nil && now.Sub(g.overflow.updated) > g.expiry {
+		g.overflow = nil
+	}
+	metrics := g.metrics(now)
+	g.mu.Unlock()
+
+	if len(metrics) == 0 {
+		return
+	}
+	if err := g.next.ReceiveMetrics(metrics); err != nil {
+		g.logger.Warn("Service graph metrics refused", zap.Error(err))
+	}
+}
+
+// metrics returns every edge's metrics. Must be called with mu held.
+func (g *ServiceGraph) metrics(now time.Time) []models.Metric {
+	metrics := make([]models.Metric, 0, 3*(len(g.edges)+1))
+
+	all := make([]*edgeSeries, 0, len(g.edges)+1)
+	for _, edge := range g.edges {
+		all = append(all, edge)
+	}
+	if g.overflow != nil {
+		all = append(all, g.overflow)
+	}
+	for _, edge := range all {
+		metrics = append(metrics,
+			models.Metric{
+				Name:       ServiceGraphRequestsMetric,
+				Type:       "counter",
+				Value:      float64(edge.requests),
+				Timestamp:  now,
+				Attributes: copyAttributes(edge.attributes),
+			},
+			models.Metric{
+				Name:       ServiceGraphFailedMetric,
+				Type:       "counter",
+				Value:      float64(edge.failed),
+				Timestamp:  now,
+				Attributes: copyAttributes(edge.attributes),
+			},
+			models.Metric{
+				Name:       ServiceGraphLatencyMetric,
+				Type:       "histogram",
+				Value:      edge.latency.sum,
+				Timestamp:  now,
+				Attributes: copyAttributes(edge.attributes),
+				Histogram:  edge.latency.data(),
+			},
+		)
+	}
+	return metrics
+}
+
+// record adds a call to its edge. Must be called with mu held.
+func (g *ServiceGraph) record(call servicegraph.Call, now time.Time) {
+	key := edgeKey{client: call.Client, server: call.Server}
+	edge, ok := g.edges[key]
+	switch {
+	case ok:
+	case len(g.edges) >= g.maxSeries:
+		if g.overflow == nil {
+			g.overflow = &edgeSeries{
+				attributes: map[string]string{overflowAttribute: "true"},
+				latency:    newDurationHistogram(g.buckets),
+			}
+			g.logger.Warn("Service graph edge limit reached, counting further calls together",
+				zap.Int("max_series", g.maxSeries),
+			)
+		}
+		edge = g.overflow
+	default:
+		edge = &edgeSeries{
+			attributes: map[string]string{"client": call.Client, "server": call.Server},
+			latency:    newDurationHistogram(g.buckets),
+		}
+		g.edges[key] = edge
+		g.logger.Debug("New service graph edge",
+			zap.String("client", call.Client),
+			zap.String("server", call.Server),
+		)
+	}
+
+	edge.updated = now
+	edge.requests++
+	if call.Error {
+		edge.failed++
+	}
+	edge.latency.observe(call.Duration.Seconds())
+}
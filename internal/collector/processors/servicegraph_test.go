@@ -0,0 +1,109 @@
+package processors
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/gaurav/watchingcat/internal/config"
+	"github.com/gaurav/watchingcat/pkg/models"
+	"go.uber.org/zap"
+)
+
+func TestServiceGraphAcrossBatches(t *testing.T) {
+	sink := &metricsSink{}
+	connector := NewServiceGraph(config.ServiceGraphConfig{}, []float64{0.1}, sink, zap.NewNop())
+
+	child := span("t1", "child", "root", 50*time.Millisecond)
+	child.Attributes = map[string]string{"service.name": "cartservice"}
+	child.Status.Code = "ERROR"
+
+	if err := connector.Export(context.Background(), models.TelemetryBatch{Spans: []models.Span{child}}); err != nil {
+		t.Fatalf("Export failed: %v", err)
+	}
+	if len(sink.emitted) != 0 {
+		t.Errorf("Expected no edges before the parent arrives, got %+v", sink.emitted)
+	}
+
+	connector.emit()
+	if len(sink.emitted) != 0 {
+		t.Errorf("Expected no edges before the parent arrives, got %+v", sink.emitted)
+	}
+
+	connector.Export(context.Background(), models.TelemetryBatch{Spans: []models.Span{span("t1", "root", "", time.Second)}})
+	connector.emit()
+	if len(sink.last()) != 3 {
+		t.Fatalf("Expected 3 edge metrics, got %d", len(sink.last()))
+	}
+
+	for _, m := range sink.last() {
+		if m.Attributes["client"] != "frontend" || m.Attributes["server"] != "cartservice" {
+			t.Errorf("Unexpected edge labels %v", m.Attributes)
+		}
+		switch m.Name {
+		case ServiceGraphRequestsMetric, ServiceGraphFailedMetric:
+			if m.Value != 1 {
+				t.Errorf("Expected %s to be 1, got %v", m.Name, m.Value)
+			}
+		case ServiceGraphLatencyMetric:
+			if m.Histogram == nil || m.Histogram.Count != 1 || m.Histogram.Buckets[0] != 1 {
+				t.Errorf("Unexpected latency histogram %+v", m.Histogram)
+			}
+		default:
+			t.Errorf("Unexpected metric %s", m.Name)
+		}
+	}
+}
+
+func TestServiceGraphLimits(t *testing.T) {
+	sink := &metricsSink{}
+	connector := NewServiceGraph(config.ServiceGraphConfig{MaxSeries: 1, Expiry: time.Minute}, nil, sink, zap.NewNop())
+	now := time.Now()
+	connector.now = func() time.Time { return now }
+
+	// call returns a root span and a child from server, a new trace each time
+	var traces int
+	call := func(server string) []models.Span {
+		traces++
+		traceID := fmt.Sprintf("t%d", traces)
+		child := span(traceID, "child", "root", 0)
+		child.Attributes = map[string]string{"service.name": server}
+		return []models.Span{span(traceID, "root", "", 0), child}
+	}
+
+	var spans []models.Span
+	for _, server := range []string{"cartservice", "adservice", "adservice"} {
+		spans = append(spans, call(server)...)
+	}
+	connector.Export(context.Background(), models.TelemetryBatch{Spans: spans})
+	connector.emit()
+
+	// The second edge is counted in the overflow series
+	var overflow *models.Metric
+	for i, m := range sink.last() {
+		if m.Name == ServiceGraphRequestsMetric && m.Attributes[overflowAttribute] == "true" {
+			overflow = &sink.last()[i]
+		}
+	}
+	if len(sink.last()) != 6 || overflow == nil || overflow.Value != 2 {
+		t.Fatalf("Expected one edge and 2 calls in the overflow series, got %+v", sink.last())
+	}
+
+	// Edges without calls for the expiry are dropped, freeing room
+	now = now.Add(2 * time.Minute)
+	connector.emit()
+	connector.Export(context.Background(), models.TelemetryBatch{Spans: call("adservice")})
+	connector.emit()
+	metrics := sink.last()
+	if len(metrics) != 3 || metrics[0].Attributes["server"] != "adservice" || metrics[0].Value != 1 {
+		t.Errorf("Expected a new edge once the others expired, got %+v", metrics)
+	}
+
+	// Shutdown emits a last time
+	emitted := len(sink.emitted)
+	connector.Shutdown(context.Background())
+	if len(sink.emitted) != emitted+1 {
+		t.Errorf("Expected shutdown to emit, got %d emissions", len(sink.emitted)-emitted)
+	}
+}
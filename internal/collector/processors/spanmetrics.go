@@ -0,0 +1,213 @@
+package processors
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gaurav/watchingcat/internal/config"
+	"github.com/gaurav/watchingcat/pkg/models"
+	"go.uber.org/zap"
+)
+
+// Names of the metrics derived from spans
+const (
+	SpanCallsMetric    = "spanmetrics_calls"
+	SpanErrorsMetric   = "spanmetrics_errors"
+	SpanDurationMetric = "spanmetrics_duration_seconds"
+)
+
+// SpanMetrics is a connector from traces to metrics. It derives request
+// count, error count and a duration histogram per service, span name, kind
+// and status code from the spans it is sent, and hands them to next.
+//
+// Values are cumulative since a series was created, matching how counters
+// and histograms are exposed to Prometheus. Every series is emitted on the
+// interval whether or not it saw spans, so metrics next refuses are made up
+// for by the following emission. Series without spans for the expiry are
+// dropped, and once maxSeries are tracked further label sets are counted in
+// a single overflow series.
+type SpanMetrics struct {
+	*emitter
+
+	buckets   []float64
+	maxSeries int
+	expiry    time.Duration
+	next      MetricsConsumer
+	logger    *zap.Logger
+	now       func() time.Time
+
+	mu       sync.Mutex
+	series   map[string]*spanSeries
+	overflow *spanSeries
+}
+
+// spanSeries accumulates RED metrics for one label set
+type spanSeries struct {
+	service    string
+	attributes map[string]string
+	calls      uint64
+	errors     uint64
+	duration   *durationHistogram
+	updated    time.Time
+}
+
+// NewSpanMetrics creates a span metrics connector with the given duration
+// buckets in seconds
+func NewSpanMetrics(cfg config.SpanMetricsConfig, buckets []float64, next MetricsConsumer, logger *zap.Logger) *SpanMetrics {
+	interval := cfg.Interval
+	if interval <= 0 {
+		interval = 15 * time.Second
+	}
+	maxSeries := cfg.MaxSeries
+	if maxSeries <= 0 {
+		maxSeries = 10000
+	}
+	expiry := cfg.Expiry
+	if expiry <= 0 {
+		expiry = 5 * time.Minute
+	}
+
+	s := &SpanMetrics{
+		buckets:   durationBounds(buckets),
+		maxSeries: maxSeries,
+		expiry:    expiry,
+		next:      next,
+		logger:    logger,
+		now:       time.Now,
+		series:    make(map[string]*spanSeries),
+	}
+	s.emitter = newEmitter(interval, s.emit)
+	return s
+}
+
+// Export records the batch's spans. They are emitted on the next interval.
+func (s *SpanMetrics) Export(ctx context.Context, batch models.TelemetryBatch) error {
+	if len(batch.Spans) == 0 {
+		return nil
+	}
+
+	s.mu.Lock()
+	now := s.now()
+	for _, span := range batch.Spans {
+		s.record(span, now)
+	}
+	s.mu.Unlock()
+	return nil
+}
+
+// emit drops expired series and hands the rest to next
+func (s *SpanMetrics) emit() {
+	s.mu.Lock()
+	now := s.now()
+	for key, series := range s.series {
+		if now.Sub(series.updated) > s.expiry {
+			delete(s.series, key)
+		}
+	}
+	if s.overflow != nil && now.Sub(s.overflow.updated) > s.expiry {
+		s.overflow = nil
+	}
+	metrics := s.metrics(now)
+	s.mu.Unlock()
+
+	if len(metrics) == 0 {
+		return
+	}
+	if err := s.next.ReceiveMetrics(metrics); err != nil {
+		s.logger.Warn("Span metrics refused", zap.Error(err))
+	}
+}
+
+// metrics returns every series' metrics. Must be called with mu held.
+func (s *SpanMetrics) metrics(now time.Time) []models.Metric {
+	metrics := make([]models.Metric, 0, 3*(len(s.series)+1))
+
+	all := make([]*spanSeries, 0, len(s.series)+1)
+	for _, series := range s.series {
+		all = append(all, series)
+	}
+	if s.overflow != nil {
+		all = append(all, s.overflow)
+	}
+	for _, series := range all {
+		metrics = append(metrics,
+			models.Metric{
+				Name:        SpanCallsMetric,
+				Type:        "counter",
+				Value:       float64(series.calls),
+				Timestamp:   now,
+				Attributes:  copyAttributes(series.attributes),
+				ServiceName: series.service,
+			},
+			models.Metric{
+				Name:        SpanErrorsMetric,
+				Type:        "counter",
+				Value:       float64(series.errors),
+				Timestamp:   now,
+				Attributes:  copyAttributes(series.attributes),
+				ServiceName: series.service,
+			},
+			models.Metric{
+				Name:        SpanDurationMetric,
+				Type:        "histogram",
+				Value:       series.duration.sum,
+				Timestamp:   now,
+				Attributes:  copyAttributes(series.attributes),
+				ServiceName: series.service,
+				Histogram:   series.duration.data(),
+			},
+		)
+	}
+	return metrics
+}
+
+// record adds one span to its series. Must be called with mu held.
+func (s *SpanMetrics) record(span models.Span, now time.Time) {
+	service := span.Attributes[serviceNameKey]
+	kind := span.Kind
+	status := span.Status.Code
+	if status == "" {
+		status = "UNSET"
+	}
+
+	key := strings.Join([]string{service, span.Name, kind, status}, "\xff")
+	series, ok := s.series[key]
+	switch {
+	case ok:
+	case len(s.series) >= s.maxSeries:
+		if s.overflow == nil {
+			s.overflow = &spanSeries{
+				attributes: map[string]string{overflowAttribute: "true"},
+				duration:   newDurationHistogram(s.buckets),
+			}
+			s.logger.Warn("Span metrics series limit reached, counting further label sets together",
+				zap.Int("max_series", s.maxSeries),
+			)
+		}
+		series = s.overflow
+	default:
+		series = &spanSeries{
+			service: service,
+			attributes: map[string]string{
+				"span.name":   span.Name,
+				"span.kind":   kind,
+				"status.code": status,
+			},
+			duration: newDurationHistogram(s.buckets),
+		}
+		s.series[key] = series
+		s.logger.Debug("New span metrics series",
+			zap.String("service", service),
+			zap.String("span_name", span.Name),
+		)
+	}
+
+	series.updated = now
+	series.calls++
+	if status == "ERROR" {
+		series.errors++
+	}
+	series.duration.observe(span.EndTime.Sub(span.StartTime).Seconds())
+}
@@ -0,0 +1,162 @@
+package processors
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/gaurav/watchingcat/internal/config"
+	"github.com/gaurav/watchingcat/pkg/models"
+	"go.uber.org/zap"
+)
+
+// metricsSink records the metrics a connector emits
+type metricsSink struct {
+	emitted [][]models.Metric
+}
+
+func (s *metricsSink) ReceiveMetrics(metrics []models.Metric) error {
+	s.emitted = append(s.emitted, metrics)
+	return nil
+}
+
+// last returns the most recent emission
+func (s *metricsSink) last() []models.Metric {
+	if len(s.emitted) == 0 {
+		return nil
+	}
+	return s.emitted[len(s.emitted)-1]
+}
+
+func findMetric(metrics []models.Metric, name, spanName, status string) *models.Metric {
+	for i := range metrics {
+		m := &metrics[i]
+		if m.Name == name && m.Attributes["span.name"] == spanName && m.Attributes["status.code"] == status {
+			return m
+		}
+	}
+	return nil
+}
+
+func TestSpanMetricsRED(t *testing.T) {
+	sink := &metricsSink{}
+	connector := NewSpanMetrics(config.SpanMetricsConfig{}, []float64{0.1, 1}, sink, zap.NewNop())
+
+	failed := span("t2", "root", "", 2*time.Second)
+	failed.Status.Code = "ERROR"
+
+	err := connector.Export(context.Background(), models.TelemetryBatch{
+		Spans: []models.Span{
+			span("t1", "root", "", 50*time.Millisecond),
+			span("t1", "child", "root", 500*time.Millisecond),
+			failed,
+		},
+	})
+	if err != nil {
+		t.Fatalf("Export failed: %v", err)
+	}
+	if len(sink.emitted) != 0 {
+		t.Fatalf("Expected nothing emitted before the interval, got %d emissions", len(sink.emitted))
+	}
+	connector.emit()
+
+	// Calls, errors and duration for two series
+	metrics := sink.last()
+	if len(sink.emitted) != 1 || len(metrics) != 6 {
+		t.Fatalf("Expected 6 metrics emitted once, got %d emissions of %d", len(sink.emitted), len(metrics))
+	}
+
+	calls := findMetric(metrics, SpanCallsMetric, "op", "UNSET")
+	if calls == nil || calls.Value != 2 || calls.ServiceName != "frontend" {
+		t.Errorf("Unexpected calls metric %+v", calls)
+	}
+	errors := findMetric(metrics, SpanErrorsMetric, "op", "ERROR")
+	if errors == nil || errors.Value != 1 {
+		t.Errorf("Unexpected errors metric %+v", errors)
+	}
+
+	duration := findMetric(metrics, SpanDurationMetric, "op", "UNSET")
+	if duration == nil || duration.Histogram == nil {
+		t.Fatalf("Expected a duration histogram, got %+v", duration)
+	}
+	h := duration.Histogram
+	if h.Count != 2 || h.Sum != 0.55 {
+		t.Errorf("Expected count 2 and sum 0.55, got %d and %v", h.Count, h.Sum)
+	}
+	if want := []uint64{1, 1, 0}; len(h.Buckets) != 3 || h.Buckets[0] != want[0] || h.Buckets[1] != want[1] || h.Buckets[2] != want[2] {
+		t.Errorf("Expected buckets %v, got %v", want, h.Buckets)
+	}
+}
+
+func TestSpanMetricsCumulative(t *testing.T) {
+	sink := &metricsSink{}
+	connector := NewSpanMetrics(config.SpanMetricsConfig{}, nil, sink, zap.NewNop())
+
+	// Nothing is emitted before there are series
+	connector.emit()
+	if len(sink.emitted) != 0 {
+		t.Errorf("Expected no metrics without series, got %d emissions", len(sink.emitted))
+	}
+
+	for i := 0; i < 2; i++ {
+		if err := connector.Export(context.Background(), models.TelemetryBatch{Spans: []models.Span{span("t", "root", "", 0)}}); err != nil {
+			t.Fatalf("Export failed: %v", err)
+		}
+	}
+	connector.emit()
+	connector.Export(context.Background(), models.TelemetryBatch{Spans: []models.Span{span("t", "root", "", 0)}})
+
+	// Shutdown emits what was recorded since the last interval, once
+	connector.Shutdown(context.Background())
+	connector.Shutdown(context.Background())
+	if len(sink.emitted) != 2 {
+		t.Fatalf("Expected 2 emissions, got %d", len(sink.emitted))
+	}
+	if calls := findMetric(sink.last(), SpanCallsMetric, "op", "UNSET"); calls == nil || calls.Value != 3 {
+		t.Errorf("Expected cumulative call count 3, got %+v", calls)
+	}
+}
+
+func TestSpanMetricsLimits(t *testing.T) {
+	sink := &metricsSink{}
+	connector := NewSpanMetrics(config.SpanMetricsConfig{MaxSeries: 1, Expiry: time.Minute}, nil, sink, zap.NewNop())
+	now := time.Now()
+	connector.now = func() time.Time { return now }
+
+	failed := span("t", "root", "", 0)
+	failed.Status.Code = "ERROR"
+	connector.Export(context.Background(), models.TelemetryBatch{Spans: []models.Span{span("t", "root", "", 0), failed, failed}})
+	connector.emit()
+
+	// The second label set is counted in the overflow series
+	metrics := sink.last()
+	if len(metrics) != 6 {
+		t.Fatalf("Expected one series and the overflow series, got %d metrics", len(metrics))
+	}
+	var overflow *models.Metric
+	for i := range metrics {
+		if metrics[i].Name == SpanCallsMetric && metrics[i].Attributes[overflowAttribute] == "true" {
+			overflow = &metrics[i]
+		}
+	}
+	if overflow == nil || overflow.Value != 2 {
+		t.Errorf("Expected 2 calls in the overflow series, got %+v", overflow)
+	}
+
+	// Series without spans for the expiry are dropped, freeing room
+	now = now.Add(2 * time.Minute)
+	connector.Export(context.Background(), models.TelemetryBatch{Spans: []models.Span{failed}})
+	now = now.Add(30 * time.Second)
+	connector.emit()
+	if metrics := sink.last(); len(metrics) != 3 || metrics[0].Attributes[overflowAttribute] != "true" {
+		t.Fatalf("Expected only the overflow series to remain, got %+v", metrics)
+	}
+
+	now = now.Add(2 * time.Minute)
+	connector.emit()
+	connector.Export(context.Background(), models.TelemetryBatch{Spans: []models.Span{failed}})
+	connector.emit()
+	if errors := findMetric(sink.last(), SpanErrorsMetric, "op", "ERROR"); errors == nil || errors.Value != 1 {
+		t.Errorf("Expected a new series once the others expired, got %+v", sink.last())
+	}
+}
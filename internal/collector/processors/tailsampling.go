@@ -0,0 +1,254 @@
+package processors
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gaurav/watchingcat/internal/config"
+	"github.com/gaurav/watchingcat/pkg/models"
+	"go.uber.org/zap"
+)
+
+const (
+	defaultDecisionWait = 10 * time.Second
+	defaultNumTraces    = 50000
+)
+
+// TailSampler buffers spans by trace ID for a decision window, then keeps or
+// drops each trace as a whole. A trace is kept if any policy samples it.
+// Decisions are remembered so spans arriving after the window follow their
+// trace.
+//
+// A held trace holds the acknowledgement of every batch it has spans in.
+// Once decided, those are released when the batch carrying its spans on is
+// acknowledged, so a crash before then replays the trace from the WAL.
+type TailSampler struct {
+	decisionWait time.Duration
+	maxTraces    int
+	policies     []samplingPolicy
+	logger       *zap.Logger
+	now          func() time.Time
+
+	mu      sync.Mutex
+	pending map[string]*pendingTrace
+	order   []string // pending trace IDs by arrival
+	decided *decisionCache
+
+	sampled atomic.Uint64
+	dropped atomic.Uint64
+}
+
+// pendingTrace holds the spans of a trace awaiting a decision, and the
+// acknowledgements of the batches they came in
+type pendingTrace struct {
+	spans    []models.Span
+	arrival  time.Time
+	releases []func()
+}
+
+// TailSamplingStats holds trace decision counters
+type TailSamplingStats struct {
+	TracesSampled uint64
+	TracesDropped uint64
+	TracesPending int
+}
+
+// NewTailSampler creates a tail sampling processor
+func NewTailSampler(cfg config.TailSamplingConfig, logger *zap.Logger) (*TailSampler, error) {
+	if len(cfg.Policies) == 0 {
+		return nil, fmt.Errorf("tail sampling requires at least one policy")
+	}
+
+	policies := make([]samplingPolicy, 0, len(cfg.Policies))
+	for _, pc := range cfg.Policies {
+		policy, err := newSamplingPolicy(pc)
+		if err != nil {
+			return nil, err
+		}
+		policies = append(policies, policy)
+	}
+
+	decisionWait := cfg.DecisionWait
+	if decisionWait <= 0 {
+		decisionWait = defaultDecisionWait
+	}
+	maxTraces := cfg.NumTraces
+	if maxTraces <= 0 {
+		maxTraces = defaultNumTraces
+	}
+
+	return &TailSampler{
+		decisionWait: decisionWait,
+		maxTraces:    maxTraces,
+		policies:     policies,
+		logger:       logger,
+		now:          time.Now,
+		pending:      make(map[string]*pendingTrace),
+		decided:      newDecisionCache(maxTraces),
+	}, nil
+}
+
+// Process holds the batch's spans and returns the spans of traces whose
+// decision window has ended and were sampled. Other signals pass through.
+func (t *TailSampler) Process(ctx context.Context, batch models.TelemetryBatch) (models.TelemetryBatch, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	now := t.now()
+	ack := batchAckFrom(ctx)
+	held := make(map[*pendingTrace]bool)
+	var kept []models.Span
+
+	for _, span := range batch.Spans {
+		if sampled, ok := t.decided.get(span.TraceID); ok {
+			if sampled {
+				kept = append(kept, span)
+			}
+			continue
+		}
+
+		trace, ok := t.pending[span.TraceID]
+		if !ok {
+			// Make room by deciding the oldest trace early
+			if len(t.order) >= t.maxTraces {
+				kept = append(kept, t.decide(t.order[0], ack)...)
+				t.order = t.order[1:]
+			}
+			trace = &pendingTrace{arrival: now}
+			t.pending[span.TraceID] = trace
+			t.order = append(t.order, span.TraceID)
+		}
+		trace.spans = append(trace.spans, span)
+		if ack != nil && !held[trace] {
+			trace.releases = append(trace.releases, ack.Hold())
+			held[trace] = true
+		}
+	}
+
+	batch.Spans = append(kept, t.expire(now, ack)...)
+	return batch, nil
+}
+
+// Expire decides the pending traces whose decision window has ended and
+// returns the sampled spans, so traces are decided while no spans arrive.
+// ctx carries the acknowledgement of the batch the spans are sent on in.
+func (t *TailSampler) Expire(ctx context.Context) []models.Span {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.expire(t.now(), batchAckFrom(ctx))
+}
+
+// expire decides the traces whose decision window ended by now. Must be
+// called with mu held.
+func (t *TailSampler) expire(now time.Time, ack BatchAck) []models.Span {
+	var kept []models.Span
+
+	// Traces are ordered by arrival, so the ready ones form a prefix
+	ready := 0
+	for ready < len(t.order) && now.Sub(t.pending[t.order[ready]].arrival) >= t.decisionWait {
+		kept = append(kept, t.decide(t.order[ready], ack)...)
+		ready++
+	}
+	t.order = t.order[ready:]
+
+	return kept
+}
+
+// Flush decides every pending trace immediately and returns the sampled
+// spans. It is used on shutdown; ctx is as for Expire.
+func (t *TailSampler) Flush(ctx context.Context) []models.Span {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	ack := batchAckFrom(ctx)
+	var kept []models.Span
+	for _, traceID := range t.order {
+		kept = append(kept, t.decide(traceID, ack)...)
+	}
+	t.order = nil
+
+	return kept
+}
+
+// Stats returns trace decision counters
+func (t *TailSampler) Stats() TailSamplingStats {
+	t.mu.Lock()
+	pending := len(t.pending)
+	t.mu.Unlock()
+
+	return TailSamplingStats{
+		TracesSampled: t.sampled.Load(),
+		TracesDropped: t.dropped.Load(),
+		TracesPending: pending,
+	}
+}
+
+// decide evaluates the policies for a pending trace, records the decision
+// and returns the trace's spans if it is sampled. The batches the trace
+// held are released once ack is. Must be called with mu held; the caller
+// removes the trace from order.
+func (t *TailSampler) decide(traceID string, ack BatchAck) []models.Span {
+	trace := t.pending[traceID]
+	delete(t.pending, traceID)
+	for _, release := range trace.releases {
+		if ack != nil {
+			ack.OnAck(release)
+		} else {
+			release()
+		}
+	}
+
+	sampled := false
+	for _, policy := range t.policies {
+		if policy.evaluate(trace.spans) {
+			t.logger.Debug("Trace sampled",
+				zap.String("trace_id", traceID),
+				zap.String("policy", policy.name()),
+			)
+			sampled = true
+			break
+		}
+	}
+	t.decided.put(traceID, sampled)
+
+	if !sampled {
+		t.dropped.Add(1)
+		return nil
+	}
+	t.sampled.Add(1)
+	return trace.spans
+}
+
+// decisionCache remembers the most recent trace decisions, evicting the
+// oldest once full
+type decisionCache struct {
+	decisions map[string]bool
+	ring      []string
+	next      int
+}
+
+func newDecisionCache(size int) *decisionCache {
+	return &decisionCache{
+		decisions: make(map[string]bool, size),
+		ring:      make([]string, size),
+	}
+}
+
+func (c *decisionCache) get(traceID string) (bool, bool) {
+	sampled, ok := c.decisions[traceID]
+	return sampled, ok
+}
+
+func (c *decisionCache) put(traceID string, sampled bool) {
+	if _, ok := c.decisions[traceID]; !ok {
+		if old := c.ring[c.next]; old != "" {
+			delete(c.decisions, old)
+		}
+		c.ring[c.next] = traceID
+		c.next = (c.next + 1) % len(c.ring)
+	}
+	c.decisions[traceID] = sampled
+}
@@ -0,0 +1,235 @@
+package processors
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/gaurav/watchingcat/internal/config"
+	"github.com/gaurav/watchingcat/pkg/models"
+	"go.uber.org/zap"
+)
+
+// fakeClock is a settable time source
+type fakeClock struct{ t time.Time }
+
+func (c *fakeClock) now() time.Time { return c.t }
+
+func newTestSampler(t *testing.T, policies ...config.SamplingPolicyConfig) (*TailSampler, *fakeClock) {
+	sampler, err := NewTailSampler(config.TailSamplingConfig{
+		DecisionWait: 10 * time.Second,
+		NumTraces:    100,
+		Policies:     policies,
+	}, zap.NewNop())
+	if err != nil {
+		t.Fatalf("Failed to create sampler: %v", err)
+	}
+	clock := &fakeClock{t: time.Unix(1700000000, 0)}
+	sampler.now = clock.now
+	return sampler, clock
+}
+
+func span(traceID, spanID, parentID string, duration time.Duration) models.Span {
+	start := time.Unix(1700000000, 0)
+	return models.Span{
+		TraceID:    traceID,
+		SpanID:     spanID,
+		ParentID:   parentID,
+		Name:       "op",
+		StartTime:  start,
+		EndTime:    start.Add(duration),
+		Attributes: map[string]string{"service.name": "frontend"},
+		Status:     models.SpanStatus{Code: "UNSET"},
+	}
+}
+
+func process(t *testing.T, sampler *TailSampler, spans ...models.Span) []models.Span {
+	batch, err := sampler.Process(context.Background(), models.TelemetryBatch{Spans: spans})
+	if err != nil {
+		t.Fatalf("Process failed: %v", err)
+	}
+	return batch.Spans
+}
+
+func TestTailSamplerKeepsWholeErrorTrace(t *testing.T) {
+	sampler, clock := newTestSampler(t, config.SamplingPolicyConfig{Type: "status_code"})
+
+	failed := span("t1", "child", "root", time.Millisecond)
+	failed.Status.Code = "ERROR"
+
+	if kept := process(t, sampler, span("t1", "root", "", time.Millisecond), span("t2", "root", "", time.Millisecond)); len(kept) != 0 {
+		t.Fatalf("Expected spans to be held during the decision window, got %d", len(kept))
+	}
+	process(t, sampler, failed)
+
+	// The window ends without further spans arriving
+	clock.t = clock.t.Add(10 * time.Second)
+	kept := sampler.Expire(context.Background())
+
+	if len(kept) != 2 {
+		t.Fatalf("Expected both spans of the failed trace, got %d", len(kept))
+	}
+	for _, s := range kept {
+		if s.TraceID != "t1" {
+			t.Errorf("Expected only trace t1 to be kept, got %s", s.TraceID)
+		}
+	}
+
+	// A late span follows its trace's decision
+	if kept := process(t, sampler, span("t1", "late", "root", 0), span("t2", "late", "root", 0)); len(kept) != 1 || kept[0].TraceID != "t1" {
+		t.Errorf("Expected the late t1 span to be kept and t2 dropped, got %+v", kept)
+	}
+
+	if stats := sampler.Stats(); stats.TracesSampled != 1 || stats.TracesDropped != 1 {
+		t.Errorf("Unexpected stats %+v", stats)
+	}
+}
+
+func TestTailSamplerPolicies(t *testing.T) {
+	vip := span("t", "root", "", time.Millisecond)
+	vip.Attributes["customer.tier"] = "gold"
+
+	cases := []struct {
+		name   string
+		policy config.SamplingPolicyConfig
+		spans  []models.Span
+		want   bool
+	}{
+		{"slow root", config.SamplingPolicyConfig{Type: "latency", Threshold: time.Second}, []models.Span{span("t", "root", "", 2*time.Second)}, true},
+		{"fast root", config.SamplingPolicyConfig{Type: "latency", Threshold: time.Second}, []models.Span{span("t", "root", "", time.Millisecond)}, false},
+		{"attribute match", config.SamplingPolicyConfig{Type: "string_attribute", Key: "customer.tier", Values: []string{"gold"}}, []models.Span{vip}, true},
+		{"attribute miss", config.SamplingPolicyConfig{Type: "string_attribute", Key: "customer.tier", Values: []string{"gold"}}, []models.Span{span("t", "root", "", 0)}, false},
+		{"probabilistic all", config.SamplingPolicyConfig{Type: "probabilistic", SamplingPercentage: 100}, []models.Span{span("t", "root", "", 0)}, true},
+		{"probabilistic none", config.SamplingPolicyConfig{Type: "probabilistic", SamplingPercentage: 0}, []models.Span{span("t", "root", "", 0)}, false},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			policy, err := newSamplingPolicy(tc.policy)
+			if err != nil {
+				t.Fatalf("Failed to create policy: %v", err)
+			}
+			if got := policy.evaluate(tc.spans); got != tc.want {
+				t.Errorf("Expected %v, got %v", tc.want, got)
+			}
+		})
+	}
+}
+
+func TestRateLimitPolicyPerService(t *testing.T) {
+	policy, err := newSamplingPolicy(config.SamplingPolicyConfig{Type: "rate_limiting", TracesPerSecond: 2})
+	if err != nil {
+		t.Fatalf("Failed to create policy: %v", err)
+	}
+	clock := &fakeClock{t: time.Unix(1700000000, 0)}
+	policy.(*rateLimitPolicy).now = clock.now
+
+	frontend := []models.Span{span("t", "root", "", 0)}
+	cart := []models.Span{span("t", "root", "", 0)}
+	cart[0].Attributes = map[string]string{"service.name": "cartservice"}
+
+	for i, want := range []bool{true, true, false} {
+		if got := policy.evaluate(frontend); got != want {
+			t.Errorf("frontend trace %d: expected %v, got %v", i, want, got)
+		}
+	}
+	if !policy.evaluate(cart) {
+		t.Error("Expected another service to have its own limit")
+	}
+
+	clock.t = clock.t.Add(time.Second)
+	if !policy.evaluate(frontend) {
+		t.Error("Expected the limit to reset the next second")
+	}
+	if windows := policy.(*rateLimitPolicy).windows; len(windows) != 1 {
+		t.Errorf("Expected the idle service's window to be dropped, got %v", windows)
+	}
+}
+
+func TestProbabilisticPolicyShare(t *testing.T) {
+	policy, _ := newSamplingPolicy(config.SamplingPolicyConfig{Type: "probabilistic", SamplingPercentage: 25})
+
+	sampled := 0
+	for i := 0; i < 10000; i++ {
+		if policy.evaluate([]models.Span{span(fmt.Sprintf("%032x", i), "root", "", 0)}) {
+			sampled++
+		}
+	}
+	if sampled < 2200 || sampled > 2800 {
+		t.Errorf("Expected about 25%% of traces sampled, got %d of 10000", sampled)
+	}
+}
+
+func TestTailSamplerEvictsOldestWhenFull(t *testing.T) {
+	sampler, err := NewTailSampler(config.TailSamplingConfig{
+		NumTraces: 2,
+		Policies:  []config.SamplingPolicyConfig{{Type: "probabilistic", SamplingPercentage: 100}},
+	}, zap.NewNop())
+	if err != nil {
+		t.Fatalf("Failed to create sampler: %v", err)
+	}
+
+	kept := process(t, sampler, span("t1", "a", "", 0), span("t2", "a", "", 0), span("t3", "a", "", 0))
+	if len(kept) != 1 || kept[0].TraceID != "t1" {
+		t.Errorf("Expected the oldest trace to be decided early, got %+v", kept)
+	}
+	if flushed := sampler.Flush(context.Background()); len(flushed) != 2 {
+		t.Errorf("Expected the remaining traces on flush, got %d", len(flushed))
+	}
+}
+
+// fakeAck counts holds, running callbacks once acked
+type fakeAck struct {
+	held  int
+	onAck []func()
+}
+
+func (a *fakeAck) Hold() func()    { a.held++; return func() { a.held-- } }
+func (a *fakeAck) OnAck(fn func()) { a.onAck = append(a.onAck, fn) }
+
+func (a *fakeAck) ack() {
+	for _, fn := range a.onAck {
+		fn()
+	}
+	a.onAck = nil
+}
+
+func TestTailSamplerHoldsBatchAck(t *testing.T) {
+	sampler, clock := newTestSampler(t, config.SamplingPolicyConfig{Type: "probabilistic", SamplingPercentage: 100})
+
+	first, second := &fakeAck{}, &fakeAck{}
+	sampler.Process(WithBatchAck(context.Background(), first), models.TelemetryBatch{Spans: []models.Span{
+		span("t1", "a", "", 0), span("t1", "b", "a", 0), span("t2", "a", "", 0),
+	}})
+	sampler.Process(WithBatchAck(context.Background(), second), models.TelemetryBatch{Spans: []models.Span{span("t1", "c", "a", 0)}})
+	if first.held != 2 || second.held != 1 {
+		t.Fatalf("Expected a hold per trace and batch, got %d and %d", first.held, second.held)
+	}
+
+	clock.t = clock.t.Add(10 * time.Second)
+	carrier := &fakeAck{}
+	if kept := sampler.Expire(WithBatchAck(context.Background(), carrier)); len(kept) != 4 {
+		t.Fatalf("Expected every span to be sampled, got %d", len(kept))
+	}
+	if first.held != 2 || second.held != 1 {
+		t.Error("Expected the batches to be held until the decided spans are acknowledged")
+	}
+	carrier.ack()
+	if first.held != 0 || second.held != 0 {
+		t.Errorf("Expected the batches to be released, got %d and %d held", first.held, second.held)
+	}
+}
+
+func TestTailSamplerConfigErrors(t *testing.T) {
+	for _, cfg := range []config.TailSamplingConfig{
+		{},
+		{Policies: []config.SamplingPolicyConfig{{Type: "latency"}}},
+		{Policies: []config.SamplingPolicyConfig{{Type: "unknown"}}},
+		{Policies: []config.SamplingPolicyConfig{{Type: "probabilistic", SamplingPercentage: 150}}},
+	} {
+		if _, err := NewTailSampler(cfg, zap.NewNop()); err == nil {
+			t.Errorf("Expected error for %+v", cfg)
+		}
+	}
+}
@@ -0,0 +1,145 @@
+package scrape
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/gaurav/watchingcat/internal/config"
+)
+
+// labels is a label set. Names starting with __ are internal to relabeling.
+type labels map[string]string
+
+func (l labels) clone() labels {
+	out := make(labels, len(l))
+	for k, v := range l {
+		out[k] = v
+	}
+	return out
+}
+
+// relabelRule is a compiled relabel config
+type relabelRule struct {
+	sourceLabels []string
+	separator    string
+	regex        *regexp.Regexp
+	targetLabel  string
+	replacement  string
+	action       string
+}
+
+// compileRelabel compiles relabel configs, applying Prometheus' defaults.
+// An empty replacement means $1, so removing a label takes labeldrop.
+func compileRelabel(cfgs []config.RelabelConfig) ([]relabelRule, error) {
+	rules := make([]relabelRule, 0, len(cfgs))
+	for i, cfg := range cfgs {
+		rule := relabelRule{
+			sourceLabels: cfg.SourceLabels,
+			separator:    cfg.Separator,
+			targetLabel:  cfg.TargetLabel,
+			replacement:  cfg.Replacement,
+			action:       strings.ToLower(cfg.Action),
+		}
+		if rule.separator == "" {
+			rule.separator = ";"
+		}
+		if rule.replacement == "" {
+			rule.replacement = "$1"
+		}
+		if rule.action == "" {
+			rule.action = "replace"
+		}
+
+		pattern := cfg.Regex
+		if pattern == "" {
+			pattern = "(.*)"
+		}
+		re, err := regexp.Compile("^(?:" + pattern + ")$")
+		if err != nil {
+			return nil, fmt.Errorf("relabel rule %d: invalid regex: %w", i, err)
+		}
+		rule.regex = re
+
+		switch rule.action {
+		case "replace":
+			if rule.targetLabel == "" {
+				return nil, fmt.Errorf("relabel rule %d: replace requires target_label", i)
+			}
+		case "keep", "drop":
+			if len(rule.sourceLabels) == 0 {
+				return nil, fmt.Errorf("relabel rule %d: %s requires source_labels", i, rule.action)
+			}
+		case "labelmap", "labeldrop", "labelkeep":
+		default:
+			return nil, fmt.Errorf("relabel rule %d: unknown action %q", i, cfg.Action)
+		}
+
+		rules = append(rules, rule)
+	}
+	return rules, nil
+}
+
+// relabel applies rules in order to a copy of lset. It returns false if a
+// keep or drop rule dropped the label set.
+func relabel(lset labels, rules []relabelRule) (labels, bool) {
+	if len(rules) == 0 {
+		return lset, true
+	}
+
+	lset = lset.clone()
+	for _, rule := range rules {
+		values := make([]string, len(rule.sourceLabels))
+		for i, name := range rule.sourceLabels {
+			values[i] = lset[name]
+		}
+		value := strings.Join(values, rule.separator)
+
+		switch rule.action {
+		case "keep":
+			if !rule.regex.MatchString(value) {
+				return nil, false
+			}
+		case "drop":
+			if rule.regex.MatchString(value) {
+				return nil, false
+			}
+		case "replace":
+			match := rule.regex.FindStringSubmatchIndex(value)
+			if match == nil {
+				continue
+			}
+			target := string(rule.regex.ExpandString(nil, rule.targetLabel, value, match))
+			replaced := string(rule.regex.ExpandString(nil, rule.replacement, value, match))
+			if replaced == "" {
+				delete(lset, target)
+				continue
+			}
+			lset[target] = replaced
+		case "labelmap":
+			for _, name := range sortedNames(lset) {
+				if match := rule.regex.FindStringSubmatchIndex(name); match != nil {
+					lset[string(rule.regex.ExpandString(nil, rule.replacement, name, match))] = lset[name]
+				}
+			}
+		case "labeldrop", "labelkeep":
+			keep := rule.action == "labelkeep"
+			for name := range lset {
+				if rule.regex.MatchString(name) != keep {
+					delete(lset, name)
+				}
+			}
+		}
+	}
+	return lset, true
+}
+
+func sortedNames(lset labels) []string {
+	names := make([]string, 0, len(lset))
+	for name := range lset {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
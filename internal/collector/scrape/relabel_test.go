@@ -0,0 +1,82 @@
+package scrape
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/gaurav/watchingcat/internal/config"
+)
+
+func TestRelabel(t *testing.T) {
+	tests := []struct {
+		name  string
+		rules []config.RelabelConfig
+		in    labels
+		want  labels // nil when dropped
+	}{
+		{
+			name:  "replace joins source labels",
+			rules: []config.RelabelConfig{{SourceLabels: []string{"a", "b"}, Separator: "-", TargetLabel: "c"}},
+			in:    labels{"a": "x", "b": "y"},
+			want:  labels{"a": "x", "b": "y", "c": "x-y"},
+		},
+		{
+			name:  "replace expands groups",
+			rules: []config.RelabelConfig{{SourceLabels: []string{"__address__"}, Regex: "(.+):(\\d+)", TargetLabel: "port", Replacement: "p$2"}},
+			in:    labels{"__address__": "host:9100"},
+			want:  labels{"__address__": "host:9100", "port": "p9100"},
+		},
+		{
+			name:  "replace without a match leaves labels alone",
+			rules: []config.RelabelConfig{{SourceLabels: []string{"a"}, Regex: "z+", TargetLabel: "b"}},
+			in:    labels{"a": "x"},
+			want:  labels{"a": "x"},
+		},
+		{
+			name:  "replace with an empty result removes the target",
+			rules: []config.RelabelConfig{{SourceLabels: []string{"missing"}, TargetLabel: "a"}},
+			in:    labels{"a": "x"},
+			want:  labels{},
+		},
+		{
+			name:  "keep drops what does not match",
+			rules: []config.RelabelConfig{{SourceLabels: []string{"env"}, Regex: "prod", Action: "keep"}},
+			in:    labels{"env": "production"},
+		},
+		{
+			name:  "drop is anchored",
+			rules: []config.RelabelConfig{{SourceLabels: []string{"env"}, Regex: "prod", Action: "drop"}},
+			in:    labels{"env": "production"},
+			want:  labels{"env": "production"},
+		},
+		{
+			name:  "labelmap copies matching names",
+			rules: []config.RelabelConfig{{Regex: "__meta_(.+)", Action: "labelmap"}},
+			in:    labels{"__meta_zone": "eu", "a": "x"},
+			want:  labels{"__meta_zone": "eu", "zone": "eu", "a": "x"},
+		},
+		{
+			name:  "labeldrop and labelkeep",
+			rules: []config.RelabelConfig{{Regex: "tmp_.*", Action: "labeldrop"}, {Regex: "a|tmp_b", Action: "labelkeep"}},
+			in:    labels{"a": "1", "b": "2", "tmp_b": "3"},
+			want:  labels{"a": "1"},
+		},
+	}
+
+	for _, tt := range tests {
+		rules, err := compileRelabel(tt.rules)
+		if err != nil {
+			t.Fatalf("%s: compile failed: %v", tt.name, err)
+		}
+		got, keep := relabel(tt.in, rules)
+		if tt.want == nil {
+			if keep {
+				t.Errorf("%s: expected the label set to be dropped, got %v", tt.name, got)
+			}
+			continue
+		}
+		if !keep || !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: expected %v, got %v (kept %v)", tt.name, tt.want, got, keep)
+		}
+	}
+}
@@ -0,0 +1,424 @@
+// Package scrape pulls metrics from Prometheus text-format endpoints
+package scrape
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gaurav/watchingcat/internal/config"
+	"github.com/gaurav/watchingcat/pkg/models"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/expfmt"
+	"go.uber.org/zap"
+)
+
+const (
+	defaultInterval = time.Minute
+	defaultTimeout  = 10 * time.Second
+
+	// acceptHeader asks for the text format, the only one parsed
+	acceptHeader = "text/plain;version=0.0.4;q=1,*/*;q=0.1"
+)
+
+// Consumer receives scraped metrics. An error means they were refused,
+// typically because buffers are full; that scrape's samples are lost.
+type Consumer interface {
+	ReceiveMetrics(metrics []models.Metric) error
+}
+
+// Receiver scrapes its targets, each on its own interval
+type Receiver struct {
+	targets  []*target
+	consumer Consumer
+	client   *http.Client
+	logger   *zap.Logger
+
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+// target is one endpoint to scrape
+type target struct {
+	url      string
+	labels   labels // job, instance and static labels, added to every sample
+	interval time.Duration
+	timeout  time.Duration
+
+	honorLabels   bool
+	metricRelabel []relabelRule
+}
+
+// NewReceiver resolves the static targets of cfg through their relabel rules
+func NewReceiver(cfg config.PrometheusReceiverConfig, consumer Consumer, logger *zap.Logger) (*Receiver, error) {
+	if cfg.ScrapeInterval <= 0 {
+		cfg.ScrapeInterval = defaultInterval
+	}
+	if cfg.ScrapeTimeout <= 0 {
+		cfg.ScrapeTimeout = defaultTimeout
+	}
+
+	r := &Receiver{
+		consumer: consumer,
+		client:   &http.Client{},
+		logger:   logger,
+	}
+
+	jobs := make(map[string]bool)
+	for _, sc := range cfg.ScrapeConfigs {
+		if sc.JobName == "" {
+			return nil, fmt.Errorf("scrape config without job_name")
+		}
+		if jobs[sc.JobName] {
+			return nil, fmt.Errorf("duplicate job_name %q", sc.JobName)
+		}
+		jobs[sc.JobName] = true
+
+		targets, err := resolveTargets(sc, cfg)
+		if err != nil {
+			return nil, fmt.Errorf("job %q: %w", sc.JobName, err)
+		}
+		r.targets = append(r.targets, targets...)
+	}
+
+	return r, nil
+}
+
+// resolveTargets applies defaults and target relabeling to a job's static
+// targets. Targets dropped by relabeling are left out.
+func resolveTargets(sc config.ScrapeConfig, cfg config.PrometheusReceiverConfig) ([]*target, error) {
+	interval, timeout := sc.ScrapeInterval, sc.ScrapeTimeout
+	if interval <= 0 {
+		interval = cfg.ScrapeInterval
+	}
+	if timeout <= 0 {
+		timeout = cfg.ScrapeTimeout
+	}
+	if timeout > interval {
+		return nil, fmt.Errorf("scrape_timeout %v exceeds scrape_interval %v", timeout, interval)
+	}
+
+	scheme, path := sc.Scheme, sc.MetricsPath
+	if scheme == "" {
+		scheme = "http"
+	}
+	if path == "" {
+		path = "/metrics"
+	}
+
+	targetRules, err := compileRelabel(sc.RelabelConfigs)
+	if err != nil {
+		return nil, err
+	}
+	metricRules, err := compileRelabel(sc.MetricRelabelConfigs)
+	if err != nil {
+		return nil, err
+	}
+
+	var targets []*target
+	for _, static := range sc.StaticConfigs {
+		for _, addr := range static.Targets {
+			lset := labels{
+				"__address__":      addr,
+				"__scheme__":       scheme,
+				"__metrics_path__": path,
+				"job":              sc.JobName,
+			}
+			for k, v := range static.Labels {
+				lset[k] = v
+			}
+
+			lset, keep := relabel(lset, targetRules)
+			if !keep {
+				continue
+			}
+			if lset["__address__"] == "" {
+				return nil, fmt.Errorf("target %q has no __address__ after relabeling", addr)
+			}
+			if _, ok := lset["instance"]; !ok {
+				lset["instance"] = lset["__address__"]
+			}
+
+			u := url.URL{Scheme: lset["__scheme__"], Host: lset["__address__"], Path: lset["__metrics_path__"]}
+			for name := range lset {
+				if strings.HasPrefix(name, "__") {
+					delete(lset, name)
+				}
+			}
+
+			targets = append(targets, &target{
+				url:           u.String(),
+				labels:        lset,
+				interval:      interval,
+				timeout:       timeout,
+				honorLabels:   sc.HonorLabels,
+				metricRelabel: metricRules,
+			})
+		}
+	}
+	return targets, nil
+}
+
+// Start scrapes every target right away, then on its interval
+func (r *Receiver) Start(ctx context.Context) error {
+	ctx, r.cancel = context.WithCancel(ctx)
+
+	r.logger.Info("Prometheus scrape receiver starting",
+		zap.Int("targets", len(r.targets)),
+	)
+
+	for _, t := range r.targets {
+		t := t
+		r.wg.Add(1)
+		go func() {
+			defer r.wg.Done()
+			r.run(ctx, t)
+		}()
+	}
+	return nil
+}
+
+// Shutdown stops scraping, waiting for scrapes in flight until ctx is done
+func (r *Receiver) Shutdown(ctx context.Context) error {
+	if r.cancel == nil {
+		return nil
+	}
+	r.cancel()
+
+	done := make(chan struct{})
+	go func() {
+		r.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (r *Receiver) run(ctx context.Context, t *target) {
+	ticker := time.NewTicker(t.interval)
+	defer ticker.Stop()
+
+	for {
+		r.scrape(ctx, t)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// scrape fetches one target and hands its samples to the consumer, with
+// the up, scrape_duration_seconds and scrape_samples_scraped series
+// Prometheus adds to every scrape. Here scrape_samples_scraped counts the
+// metrics kept after relabeling, a histogram being one.
+func (r *Receiver) scrape(ctx context.Context, t *target) {
+	start := time.Now()
+	metrics, err := r.fetch(ctx, t, start)
+	if ctx.Err() != nil {
+		return
+	}
+
+	up := 1.0
+	if err != nil {
+		up = 0
+		r.logger.Warn("Scrape failed",
+			zap.String("target", t.url),
+			zap.Error(err),
+		)
+	}
+	samples := len(metrics)
+	metrics = append(metrics,
+		t.metric("up", "gauge", up, start),
+		t.metric("scrape_duration_seconds", "gauge", time.Since(start).Seconds(), start),
+		t.metric("scrape_samples_scraped", "gauge", float64(samples), start),
+	)
+
+	if err := r.consumer.ReceiveMetrics(metrics); err != nil {
+		r.logger.Warn("Scraped metrics refused",
+			zap.String("target", t.url),
+			zap.Int("metrics", len(metrics)),
+			zap.Error(err),
+		)
+	}
+}
+
+// fetch scrapes a target and converts its samples
+func (r *Receiver) fetch(ctx context.Context, t *target, now time.Time) ([]models.Metric, error) {
+	ctx, cancel := context.WithTimeout(ctx, t.timeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, t.url, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", acceptHeader)
+	req.Header.Set("X-Prometheus-Scrape-Timeout-Seconds", strconv.FormatFloat(t.timeout.Seconds(), 'f', -1, 64))
+
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status %s", resp.Status)
+	}
+
+	var parser expfmt.TextParser
+	families, err := parser.TextToMetricFamilies(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse metrics: %w", err)
+	}
+
+	return t.convert(families, now), nil
+}
+
+// convert turns metric families into model metrics. Counters and gauges
+// keep their names; untyped samples become gauges; histograms become one
+// metric with buckets; summaries become a gauge per quantile plus _sum and
+// _count counters.
+func (t *target) convert(families map[string]*dto.MetricFamily, now time.Time) []models.Metric {
+	names := make([]string, 0, len(families))
+	for name := range families {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var metrics []models.Metric
+	for _, name := range names {
+		family := families[name]
+		for _, m := range family.GetMetric() {
+			ts := now
+			if m.TimestampMs != nil {
+				ts = time.UnixMilli(m.GetTimestampMs())
+			}
+
+			add := func(name, metricType string, value float64, hist *models.HistogramData, extra ...string) {
+				if metric, ok := t.sample(name, metricType, value, m.GetLabel(), ts, extra...); ok {
+					metric.Histogram = hist
+					metrics = append(metrics, metric)
+				}
+			}
+
+			switch family.GetType() {
+			case dto.MetricType_COUNTER:
+				add(name, "counter", m.GetCounter().GetValue(), nil)
+			case dto.MetricType_GAUGE:
+				add(name, "gauge", m.GetGauge().GetValue(), nil)
+			case dto.MetricType_HISTOGRAM:
+				add(name, "histogram", 0, histogram(m.GetHistogram()))
+			case dto.MetricType_SUMMARY:
+				s := m.GetSummary()
+				for _, q := range s.GetQuantile() {
+					add(name, "gauge", q.GetValue(), nil, "quantile", formatFloat(q.GetQuantile()))
+				}
+				add(name+"_sum", "counter", s.GetSampleSum(), nil)
+				add(name+"_count", "counter", float64(s.GetSampleCount()), nil)
+			default:
+				add(name, "gauge", m.GetUntyped().GetValue(), nil)
+			}
+		}
+	}
+	return metrics
+}
+
+// sample builds a metric from a scraped sample, attaching the target's
+// labels and applying metric relabeling. It returns false if relabeling
+// dropped the sample.
+func (t *target) sample(name, metricType string, value float64, pairs []*dto.LabelPair, ts time.Time, extra ...string) (models.Metric, bool) {
+	lset := make(labels, len(pairs)+len(t.labels)+2)
+	for _, p := range pairs {
+		lset[p.GetName()] = p.GetValue()
+	}
+	for i := 0; i+1 < len(extra); i += 2 {
+		lset[extra[i]] = extra[i+1]
+	}
+
+	// On a clash the scraped label is kept as exported_<name> unless
+	// honor_labels is set, as Prometheus does
+	for k, v := range t.labels {
+		if scraped, ok := lset[k]; ok {
+			if t.honorLabels {
+				continue
+			}
+			lset["exported_"+k] = scraped
+		}
+		lset[k] = v
+	}
+	lset["__name__"] = name
+
+	lset, keep := relabel(lset, t.metricRelabel)
+	if !keep {
+		return models.Metric{}, false
+	}
+
+	name = lset["__name__"]
+	delete(lset, "__name__")
+	return models.Metric{
+		Name:        name,
+		Type:        metricType,
+		Value:       value,
+		Timestamp:   ts,
+		Attributes:  lset,
+		ServiceName: lset["job"],
+	}, true
+}
+
+// metric builds one of the series added to every scrape
+func (t *target) metric(name, metricType string, value float64, ts time.Time) models.Metric {
+	return models.Metric{
+		Name:        name,
+		Type:        metricType,
+		Value:       value,
+		Timestamp:   ts,
+		Attributes:  t.labels.clone(),
+		ServiceName: t.labels["job"],
+	}
+}
+
+// histogram converts cumulative Prometheus buckets into per-bucket counts,
+// the last of which is +Inf
+func histogram(h *dto.Histogram) *models.HistogramData {
+	data := &models.HistogramData{
+		Count: h.GetSampleCount(),
+		Sum:   h.GetSampleSum(),
+	}
+
+	var cumulative uint64
+	for _, b := range h.GetBucket() {
+		if math.IsInf(b.GetUpperBound(), 1) {
+			continue
+		}
+		count := b.GetCumulativeCount()
+		if count < cumulative {
+			count = cumulative
+		}
+		data.Bounds = append(data.Bounds, b.GetUpperBound())
+		data.Buckets = append(data.Buckets, count-cumulative)
+		cumulative = count
+	}
+
+	var rest uint64
+	if data.Count > cumulative {
+		rest = data.Count - cumulative
+	}
+	data.Buckets = append(data.Buckets, rest)
+	return data
+}
+
+func formatFloat(f float64) string {
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
@@ -0,0 +1,237 @@
+package scrape
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gaurav/watchingcat/internal/config"
+	"github.com/gaurav/watchingcat/pkg/models"
+	"go.uber.org/zap"
+)
+
+// recordingConsumer keeps the metrics it receives
+type recordingConsumer struct {
+	metrics []models.Metric
+}
+
+func (c *recordingConsumer) ReceiveMetrics(metrics []models.Metric) error {
+	c.metrics = append(c.metrics, metrics...)
+	return nil
+}
+
+func (c *recordingConsumer) find(name string, attrs map[string]string) *models.Metric {
+	for i, m := range c.metrics {
+		if m.Name != name {
+			continue
+		}
+		match := true
+		for k, v := range attrs {
+			if m.Attributes[k] != v {
+				match = false
+			}
+		}
+		if match {
+			return &c.metrics[i]
+		}
+	}
+	return nil
+}
+
+const exposition = `# HELP http_requests_total Requests handled.
+# TYPE http_requests_total counter
+http_requests_total{method="GET",code="200",job="app"} 1027
+http_requests_total{method="POST",code="500"} 3
+# TYPE memory_bytes gauge
+memory_bytes 1.5e+06
+# TYPE request_duration_seconds histogram
+request_duration_seconds_bucket{le="0.1"} 2
+request_duration_seconds_bucket{le="0.5"} 5
+request_duration_seconds_bucket{le="+Inf"} 6
+request_duration_seconds_sum 2.5
+request_duration_seconds_count 6
+# TYPE rpc_latency summary
+rpc_latency{quantile="0.5"} 0.05
+rpc_latency{quantile="0.99"} 0.3
+rpc_latency_sum 12
+rpc_latency_count 100
+go_goroutines 42
+debug_noise 1
+`
+
+func TestScrape(t *testing.T) {
+	var gotAccept string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/custom/metrics" {
+			http.NotFound(w, r)
+			return
+		}
+		gotAccept = r.Header.Get("Accept")
+		w.Write([]byte(exposition))
+	}))
+	defer server.Close()
+	addr := strings.TrimPrefix(server.URL, "http://")
+
+	consumer := &recordingConsumer{}
+	r, err := NewReceiver(config.PrometheusReceiverConfig{
+		ScrapeConfigs: []config.ScrapeConfig{{
+			JobName:     "checkout",
+			MetricsPath: "/custom/metrics",
+			StaticConfigs: []config.StaticConfig{
+				{Targets: []string{addr}, Labels: map[string]string{"env": "staging"}},
+				{Targets: []string{"skipped:9090"}, Labels: map[string]string{"env": "dev"}},
+			},
+			RelabelConfigs: []config.RelabelConfig{
+				{SourceLabels: []string{"env"}, Regex: "staging|production", Action: "keep"},
+				{SourceLabels: []string{"__address__"}, Regex: "([^:]+):.*", TargetLabel: "host"},
+			},
+			MetricRelabelConfigs: []config.RelabelConfig{
+				{SourceLabels: []string{"__name__"}, Regex: "debug_.*", Action: "drop"},
+			},
+		}},
+	}, consumer, zap.NewNop())
+	if err != nil {
+		t.Fatalf("NewReceiver failed: %v", err)
+	}
+	if len(r.targets) != 1 {
+		t.Fatalf("Expected the keep rule to leave one target, got %d", len(r.targets))
+	}
+
+	r.scrape(context.Background(), r.targets[0])
+
+	if !strings.HasPrefix(gotAccept, "text/plain") {
+		t.Errorf("Expected the text format to be requested, got %q", gotAccept)
+	}
+
+	target := map[string]string{"job": "checkout", "instance": addr, "env": "staging", "host": "127.0.0.1"}
+	counter := consumer.find("http_requests_total", map[string]string{"method": "GET"})
+	if counter == nil || counter.Type != "counter" || counter.Value != 1027 || counter.ServiceName != "checkout" {
+		t.Fatalf("Unexpected counter %+v", counter)
+	}
+	for k, v := range target {
+		if counter.Attributes[k] != v {
+			t.Errorf("Expected target label %s=%s, got %q", k, v, counter.Attributes[k])
+		}
+	}
+	if counter.Attributes["exported_job"] != "app" {
+		t.Errorf("Expected the clashing scraped job label as exported_job, got %v", counter.Attributes)
+	}
+	if _, ok := counter.Attributes["__address__"]; ok {
+		t.Error("Expected internal labels to be removed")
+	}
+
+	if g := consumer.find("memory_bytes", nil); g == nil || g.Type != "gauge" || g.Value != 1.5e6 {
+		t.Errorf("Unexpected gauge %+v", g)
+	}
+	if g := consumer.find("go_goroutines", nil); g == nil || g.Type != "gauge" || g.Value != 42 {
+		t.Errorf("Expected an untyped sample as a gauge, got %+v", g)
+	}
+
+	h := consumer.find("request_duration_seconds", nil)
+	if h == nil || h.Type != "histogram" || h.Histogram == nil {
+		t.Fatalf("Unexpected histogram %+v", h)
+	}
+	if got := h.Histogram; got.Count != 6 || got.Sum != 2.5 || len(got.Bounds) != 2 ||
+		len(got.Buckets) != 3 || got.Buckets[0] != 2 || got.Buckets[1] != 3 || got.Buckets[2] != 1 {
+		t.Errorf("Expected per-bucket counts 2, 3, 1, got %+v", got)
+	}
+
+	if q := consumer.find("rpc_latency", map[string]string{"quantile": "0.99"}); q == nil || q.Value != 0.3 {
+		t.Errorf("Expected a gauge per quantile, got %+v", q)
+	}
+	if c := consumer.find("rpc_latency_count", nil); c == nil || c.Type != "counter" || c.Value != 100 {
+		t.Errorf("Expected the summary count as a counter, got %+v", c)
+	}
+
+	if consumer.find("debug_noise", nil) != nil {
+		t.Error("Expected metric relabeling to drop debug_noise")
+	}
+	if up := consumer.find("up", target); up == nil || up.Value != 1 {
+		t.Errorf("Expected up=1 for a successful scrape, got %+v", up)
+	}
+	if n := consumer.find("scrape_samples_scraped", nil); n == nil || n.Value != 9 {
+		t.Errorf("Expected 9 metrics kept after relabeling, got %+v", n)
+	}
+}
+
+func TestScrapeFailureReportsDown(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "boom", http.StatusInternalServerError)
+	}))
+	defer server.Close()
+
+	consumer := &recordingConsumer{}
+	r, err := NewReceiver(config.PrometheusReceiverConfig{
+		ScrapeConfigs: []config.ScrapeConfig{{
+			JobName:       "broken",
+			StaticConfigs: []config.StaticConfig{{Targets: []string{strings.TrimPrefix(server.URL, "http://")}}},
+		}},
+	}, consumer, zap.NewNop())
+	if err != nil {
+		t.Fatalf("NewReceiver failed: %v", err)
+	}
+
+	r.scrape(context.Background(), r.targets[0])
+	if up := consumer.find("up", nil); up == nil || up.Value != 0 {
+		t.Errorf("Expected up=0 for a failed scrape, got %+v", up)
+	}
+}
+
+func TestReceiverStartAndShutdown(t *testing.T) {
+	scraped := make(chan struct{}, 10)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("up_metric 1\n"))
+		scraped <- struct{}{}
+	}))
+	defer server.Close()
+
+	r, err := NewReceiver(config.PrometheusReceiverConfig{
+		ScrapeInterval: 10 * time.Millisecond,
+		ScrapeTimeout:  10 * time.Millisecond,
+		ScrapeConfigs: []config.ScrapeConfig{{
+			JobName:       "fast",
+			StaticConfigs: []config.StaticConfig{{Targets: []string{strings.TrimPrefix(server.URL, "http://")}}},
+		}},
+	}, &recordingConsumer{}, zap.NewNop())
+	if err != nil {
+		t.Fatalf("NewReceiver failed: %v", err)
+	}
+
+	if err := r.Start(context.Background()); err != nil {
+		t.Fatalf("Start failed: %v", err)
+	}
+	for i := 0; i < 2; i++ {
+		select {
+		case <-scraped:
+		case <-time.After(time.Second):
+			t.Fatal("Expected the target to be scraped repeatedly")
+		}
+	}
+	if err := r.Shutdown(context.Background()); err != nil {
+		t.Errorf("Shutdown failed: %v", err)
+	}
+}
+
+func TestNewReceiverValidates(t *testing.T) {
+	tests := map[string]config.ScrapeConfig{
+		"missing job name": {},
+		"timeout over interval": {
+			JobName: "slow", ScrapeInterval: time.Second, ScrapeTimeout: 2 * time.Second,
+		},
+		"bad regex": {
+			JobName: "bad", RelabelConfigs: []config.RelabelConfig{{TargetLabel: "x", Regex: "("}},
+		},
+		"unknown action": {
+			JobName: "bad", RelabelConfigs: []config.RelabelConfig{{Action: "hashmod"}},
+		},
+	}
+	for name, sc := range tests {
+		_, err := NewReceiver(config.PrometheusReceiverConfig{ScrapeConfigs: []config.ScrapeConfig{sc}}, &recordingConsumer{}, zap.NewNop())
+		if err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
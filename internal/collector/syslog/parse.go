@@ -0,0 +1,259 @@
+package syslog
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/gaurav/watchingcat/internal/collector/otlp"
+	"github.com/gaurav/watchingcat/pkg/models"
+)
+
+// Message formats
+const (
+	FormatRFC5424 = "rfc5424"
+	FormatRFC3164 = "rfc3164"
+)
+
+// facilities names syslog facility codes, as in RFC 5424 section 6.2.1
+var facilities = []string{
+	"kern", "user", "mail", "daemon", "auth", "syslog", "lpr", "news",
+	"uucp", "cron", "authpriv", "ftp", "ntp", "security", "console", "solaris-cron",
+	"local0", "local1", "local2", "local3", "local4", "local5", "local6", "local7",
+}
+
+// severities maps syslog severity codes to log severities; emergency,
+// alert and critical are all fatal and notice is info
+var severities = []string{"fatal", "fatal", "fatal", "error", "warn", "info", "info", "debug"}
+
+// bom is the UTF-8 byte order mark RFC 5424 allows before a message
+const bom = "\ufeff"
+
+var errNoPriority = errors.New("missing <priority>")
+
+// Parse parses a syslog message in the given format, detecting it when
+// format is empty. now dates RFC 3164 timestamps, which have no year, and
+// stands in for missing timestamps.
+func Parse(msg []byte, format string, now time.Time) (models.LogRecord, error) {
+	msg = bytes.TrimRight(msg, "\r\n\x00")
+	if !utf8.Valid(msg) {
+		msg = bytes.ToValidUTF8(msg, []byte("\ufffd"))
+	}
+	s := string(msg)
+
+	pri, rest, err := parsePriority(s)
+	if err != nil {
+		return models.LogRecord{}, err
+	}
+	record := models.LogRecord{
+		Severity: severities[pri%8],
+		Attributes: map[string]string{
+			"syslog.facility": facilities[pri/8],
+		},
+	}
+
+	if format == "" {
+		format = FormatRFC3164
+		if len(rest) > 1 && rest[0] >= '1' && rest[0] <= '9' && rest[1] == ' ' {
+			format = FormatRFC5424
+		}
+	}
+	switch format {
+	case FormatRFC5424:
+		err = parseRFC5424(rest, &record, now)
+	case FormatRFC3164:
+		parseRFC3164(rest, &record, now)
+	default:
+		err = fmt.Errorf("unknown format %q", format)
+	}
+	if err != nil {
+		return models.LogRecord{}, err
+	}
+
+	if record.ServiceName != "" {
+		record.Attributes[otlp.ServiceNameKey] = record.ServiceName
+	}
+	return record, nil
+}
+
+// parsePriority reads the <PRI> prefix, at most 191
+func parsePriority(s string) (int, string, error) {
+	if !strings.HasPrefix(s, "<") {
+		return 0, "", errNoPriority
+	}
+	end := strings.IndexByte(s, '>')
+	if end < 2 || end > 4 {
+		return 0, "", errNoPriority
+	}
+	pri, err := strconv.Atoi(s[1:end])
+	if err != nil || pri < 0 || pri > 191 {
+		return 0, "", fmt.Errorf("invalid priority %q", s[1:end])
+	}
+	return pri, s[end+1:], nil
+}
+
+// parseRFC5424 parses "VERSION TIMESTAMP HOSTNAME APP-NAME PROCID MSGID
+// STRUCTURED-DATA [MSG]". Structured data params become <sd-id>.<name>
+// attributes, except trace_id and span_id, which set the record's trace
+// context.
+func parseRFC5424(s string, record *models.LogRecord, now time.Time) error {
+	fields := strings.SplitN(s, " ", 7)
+	if len(fields) < 7 {
+		return errors.New("truncated RFC 5424 header")
+	}
+	if fields[0] != "1" {
+		return fmt.Errorf("unsupported version %q", fields[0])
+	}
+
+	record.Timestamp = now
+	if fields[1] != "-" {
+		ts, err := time.Parse(time.RFC3339Nano, fields[1])
+		if err != nil {
+			return fmt.Errorf("invalid timestamp %q", fields[1])
+		}
+		record.Timestamp = ts
+	}
+
+	setField(record.Attributes, "host.name", fields[2])
+	if fields[3] != "-" {
+		record.ServiceName = fields[3]
+	}
+	setField(record.Attributes, "syslog.procid", fields[4])
+	setField(record.Attributes, "syslog.msgid", fields[5])
+
+	msg, err := parseStructuredData(fields[6], record)
+	if err != nil {
+		return err
+	}
+	record.Message = strings.TrimPrefix(msg, bom)
+	return nil
+}
+
+// parseStructuredData reads "-" or a run of [id name="value" ...]
+// elements, returning the message that follows
+func parseStructuredData(s string, record *models.LogRecord) (string, error) {
+	if strings.HasPrefix(s, "-") {
+		return strings.TrimPrefix(s[1:], " "), nil
+	}
+
+	for strings.HasPrefix(s, "[") {
+		end := strings.IndexAny(s, " ]")
+		if end < 0 {
+			return "", errors.New("unterminated structured data")
+		}
+		id := s[1:end]
+		s = s[end:]
+
+		for strings.HasPrefix(s, " ") {
+			eq := strings.Index(s, `="`)
+			if eq < 0 {
+				return "", fmt.Errorf("invalid structured data param in %q", id)
+			}
+			name := s[1:eq]
+
+			value, n, err := readParamValue(s[eq+2:])
+			if err != nil {
+				return "", fmt.Errorf("structured data %q: %w", id, err)
+			}
+			s = s[eq+2+n:]
+
+			switch name {
+			case "trace_id":
+				record.TraceID = strings.ToLower(value)
+			case "span_id":
+				record.SpanID = strings.ToLower(value)
+			default:
+				record.Attributes[id+"."+name] = value
+			}
+		}
+		if !strings.HasPrefix(s, "]") {
+			return "", fmt.Errorf("unterminated structured data %q", id)
+		}
+		s = s[1:]
+	}
+
+	if s != "" && !strings.HasPrefix(s, " ") {
+		return "", errors.New("invalid structured data")
+	}
+	return strings.TrimPrefix(s, " "), nil
+}
+
+// readParamValue reads a param value up to its closing quote, undoing the
+// \", \\ and \] escapes. It returns the bytes consumed, quote included.
+func readParamValue(s string) (string, int, error) {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; c {
+		case '"':
+			return b.String(), i + 1, nil
+		case '\\':
+			if i+1 < len(s) && strings.IndexByte(`"\]`, s[i+1]) >= 0 {
+				i++
+				c = s[i]
+			}
+			b.WriteByte(c)
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return "", 0, errors.New("unterminated param value")
+}
+
+// parseRFC3164 parses "TIMESTAMP HOSTNAME TAG[PID]: MSG". BSD syslog is
+// loosely followed in practice, so a missing timestamp or hostname leaves
+// the rest as the message rather than failing.
+func parseRFC3164(s string, record *models.LogRecord, now time.Time) {
+	record.Timestamp = now
+	if len(s) >= len(time.Stamp) {
+		if ts, err := time.ParseInLocation(time.Stamp, s[:len(time.Stamp)], now.Location()); err == nil {
+			record.Timestamp = withYear(ts, now)
+			s = strings.TrimPrefix(s[len(time.Stamp):], " ")
+
+			// A hostname is the next word, unless it is already the tag
+			if host, rest, ok := strings.Cut(s, " "); ok && !isTag(host) {
+				setField(record.Attributes, "host.name", host)
+				s = rest
+			}
+		}
+	}
+
+	if tag, msg, ok := strings.Cut(s, ": "); ok && isTag(tag+":") {
+		if name, pid, ok := strings.Cut(tag, "["); ok {
+			tag = name
+			setField(record.Attributes, "syslog.procid", strings.TrimSuffix(pid, "]"))
+		}
+		record.ServiceName = tag
+		s = msg
+	}
+	record.Message = s
+}
+
+// isTag reports whether a word is a TAG or TAG[PID] followed by a colon
+func isTag(word string) bool {
+	if !strings.HasSuffix(word, ":") || len(word) > 49 {
+		return false
+	}
+	return !strings.ContainsAny(word[:len(word)-1], " :")
+}
+
+// withYear dates an RFC 3164 timestamp in the year of now, or the year
+// before when that would put it more than a day in the future, as happens
+// for messages sent just before new year
+func withYear(ts, now time.Time) time.Time {
+	ts = ts.AddDate(now.Year(), 0, 0)
+	if ts.After(now.Add(24 * time.Hour)) {
+		ts = ts.AddDate(-1, 0, 0)
+	}
+	return ts
+}
+
+// setField sets an attribute unless value is RFC 5424's nil value
+func setField(attrs map[string]string, key, value string) {
+	if value != "" && value != "-" {
+		attrs[key] = value
+	}
+}
@@ -0,0 +1,125 @@
+package syslog
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseRFC5424(t *testing.T) {
+	now := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	msg := `<165>1 2024-02-29T22:14:15.003Z web-1 checkout 4321 ID47 [trace@32473 trace_id="4BF92F3577B34DA6A3CE929D0E0E4736" span_id="00f067aa0ba902b7"][order@32473 id="A\"1\]" total="9.99"] ` + "\ufeff" + "payment declined\n"
+
+	record, err := Parse([]byte(msg), "", now)
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+
+	if want := time.Date(2024, 2, 29, 22, 14, 15, 3e6, time.UTC); !record.Timestamp.Equal(want) {
+		t.Errorf("Expected timestamp %v, got %v", want, record.Timestamp)
+	}
+	// 165 is facility local4, severity notice
+	if record.Severity != "info" || record.Attributes["syslog.facility"] != "local4" {
+		t.Errorf("Unexpected severity %q and facility %q", record.Severity, record.Attributes["syslog.facility"])
+	}
+	if record.ServiceName != "checkout" || record.Attributes["service.name"] != "checkout" {
+		t.Errorf("Expected the app name as service, got %q", record.ServiceName)
+	}
+	if record.TraceID != "4bf92f3577b34da6a3ce929d0e0e4736" || record.SpanID != "00f067aa0ba902b7" {
+		t.Errorf("Expected trace context lifted from structured data, got %q/%q", record.TraceID, record.SpanID)
+	}
+	if _, ok := record.Attributes["trace@32473.trace_id"]; ok {
+		t.Error("Expected trace_id not to be kept as an attribute")
+	}
+	want := map[string]string{
+		"host.name":         "web-1",
+		"syslog.procid":     "4321",
+		"syslog.msgid":      "ID47",
+		"order@32473.id":    `A"1]`,
+		"order@32473.total": "9.99",
+	}
+	for k, v := range want {
+		if record.Attributes[k] != v {
+			t.Errorf("Expected %s=%q, got %q", k, v, record.Attributes[k])
+		}
+	}
+	if record.Message != "payment declined" {
+		t.Errorf("Expected the message without BOM and newline, got %q", record.Message)
+	}
+}
+
+func TestParseRFC5424NilValues(t *testing.T) {
+	now := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	record, err := Parse([]byte("<11>1 - - - - - -"), FormatRFC5424, now)
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	if !record.Timestamp.Equal(now) || record.Severity != "error" || record.Message != "" {
+		t.Errorf("Unexpected record %+v", record)
+	}
+	if _, ok := record.Attributes["host.name"]; ok {
+		t.Error("Expected nil fields to be left out")
+	}
+}
+
+func TestParseRFC3164(t *testing.T) {
+	now := time.Date(2024, 1, 2, 10, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name, msg                      string
+		host, service, procid, message string
+		timestamp                      time.Time
+	}{
+		{
+			name:      "full header",
+			msg:       "<34>Oct 11 22:14:15 mymachine su[230]: 'su root' failed for lonvick",
+			host:      "mymachine",
+			service:   "su",
+			procid:    "230",
+			message:   "'su root' failed for lonvick",
+			timestamp: time.Date(2023, 10, 11, 22, 14, 15, 0, time.UTC),
+		},
+		{
+			name:      "padded day without hostname",
+			msg:       "<13>Jan  2 09:30:00 cron: job started",
+			service:   "cron",
+			message:   "job started",
+			timestamp: time.Date(2024, 1, 2, 9, 30, 0, 0, time.UTC),
+		},
+		{
+			name:      "no header",
+			msg:       "<13>just a message",
+			message:   "just a message",
+			timestamp: now,
+		},
+	}
+
+	for _, tt := range tests {
+		record, err := Parse([]byte(tt.msg), "", now)
+		if err != nil {
+			t.Fatalf("%s: Parse failed: %v", tt.name, err)
+		}
+		if record.Attributes["host.name"] != tt.host || record.ServiceName != tt.service ||
+			record.Attributes["syslog.procid"] != tt.procid || record.Message != tt.message {
+			t.Errorf("%s: unexpected record %+v", tt.name, record)
+		}
+		if !record.Timestamp.Equal(tt.timestamp) {
+			t.Errorf("%s: expected timestamp %v, got %v", tt.name, tt.timestamp, record.Timestamp)
+		}
+	}
+}
+
+func TestParseRejects(t *testing.T) {
+	now := time.Now()
+	tests := map[string]string{
+		"missing priority":      "hello",
+		"priority out of range": "<192>1 - - - - - -",
+		"truncated header":      "<13>1 2024-01-01T00:00:00Z host",
+		"bad timestamp":         "<13>1 yesterday host app - - -",
+		"unterminated sd":       `<13>1 - host app - - [id a="b"`,
+		"unterminated sd value": `<13>1 - host app - - [id a="b]`,
+	}
+	for name, msg := range tests {
+		if _, err := Parse([]byte(msg), "", now); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
@@ -0,0 +1,243 @@
+// Package syslog receives RFC 5424 and RFC 3164 syslog messages over UDP
+// and TCP
+package syslog
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gaurav/watchingcat/internal/config"
+	"github.com/gaurav/watchingcat/pkg/models"
+	"go.uber.org/zap"
+)
+
+// maxMessageSize bounds a message, whether a datagram or a TCP frame
+const maxMessageSize = 64 << 10
+
+// Consumer receives parsed syslog messages. An error means they were
+// refused, typically because buffers are full; syslog has no way to ask the
+// sender to retry, so they are lost.
+type Consumer interface {
+	ReceiveLogs(logs []models.LogRecord) error
+}
+
+// Receiver listens for syslog messages on one protocol
+type Receiver struct {
+	cfg      config.SyslogReceiverConfig
+	consumer Consumer
+	logger   *zap.Logger
+
+	packetConn net.PacketConn
+	listener   net.Listener
+
+	mu     sync.Mutex
+	conns  map[net.Conn]struct{}
+	closed bool
+	wg     sync.WaitGroup
+}
+
+// NewReceiver validates cfg's protocol and format. The protocol defaults
+// to UDP.
+func NewReceiver(cfg config.SyslogReceiverConfig, consumer Consumer, logger *zap.Logger) (*Receiver, error) {
+	switch cfg.Protocol {
+	case "":
+		cfg.Protocol = "udp"
+	case "udp", "tcp":
+	default:
+		return nil, fmt.Errorf("unknown protocol %q", cfg.Protocol)
+	}
+	switch cfg.Format {
+	case "", FormatRFC5424, FormatRFC3164:
+	default:
+		return nil, fmt.Errorf("unknown format %q", cfg.Format)
+	}
+
+	return &Receiver{
+		cfg:      cfg,
+		consumer: consumer,
+		logger:   logger,
+		conns:    make(map[net.Conn]struct{}),
+	}, nil
+}
+
+// Start listens on the configured endpoint and serves in the background
+func (r *Receiver) Start(ctx context.Context) error {
+	var err error
+	if r.cfg.Protocol == "udp" {
+		r.packetConn, err = net.ListenPacket("udp", r.cfg.Endpoint)
+	} else {
+		r.listener, err = net.Listen("tcp", r.cfg.Endpoint)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to listen: %w", err)
+	}
+
+	r.logger.Info("Syslog receiver starting",
+		zap.String("protocol", r.cfg.Protocol),
+		zap.String("endpoint", r.cfg.Endpoint),
+	)
+
+	r.wg.Add(1)
+	go func() {
+		defer r.wg.Done()
+		if r.packetConn != nil {
+			r.serveUDP()
+		} else {
+			r.serveTCP()
+		}
+	}()
+	return nil
+}
+
+// Shutdown stops listening, closes open connections and waits for
+// messages in flight until ctx is done
+func (r *Receiver) Shutdown(ctx context.Context) error {
+	if r.packetConn != nil {
+		r.packetConn.Close()
+	}
+	if r.listener != nil {
+		r.listener.Close()
+	}
+	r.mu.Lock()
+	r.closed = true
+	for conn := range r.conns {
+		conn.Close()
+	}
+	r.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		r.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// serveUDP handles one message per datagram
+func (r *Receiver) serveUDP() {
+	buf := make([]byte, maxMessageSize)
+	for {
+		n, _, err := r.packetConn.ReadFrom(buf)
+		if err != nil {
+			if !errors.Is(err, net.ErrClosed) {
+				r.logger.Error("Syslog UDP read error", zap.Error(err))
+			}
+			return
+		}
+		r.handle(buf[:n])
+	}
+}
+
+func (r *Receiver) serveTCP() {
+	for {
+		conn, err := r.listener.Accept()
+		if err != nil {
+			if !errors.Is(err, net.ErrClosed) {
+				r.logger.Error("Syslog TCP accept error", zap.Error(err))
+			}
+			return
+		}
+
+		// A connection accepted while shutting down would be missed by
+		// Shutdown's sweep
+		r.mu.Lock()
+		if r.closed {
+			r.mu.Unlock()
+			conn.Close()
+			return
+		}
+		r.conns[conn] = struct{}{}
+		r.mu.Unlock()
+
+		r.wg.Add(1)
+		go func() {
+			defer r.wg.Done()
+			r.serveConn(conn)
+
+			r.mu.Lock()
+			delete(r.conns, conn)
+			r.mu.Unlock()
+			conn.Close()
+		}()
+	}
+}
+
+// serveConn handles messages framed by octet counting or newlines, as in
+// RFC 6587, until the connection closes
+func (r *Receiver) serveConn(conn net.Conn) {
+	reader := bufio.NewReaderSize(conn, maxMessageSize)
+	for {
+		msg, err := readFrame(reader)
+		if err != nil {
+			if !errors.Is(err, io.EOF) && !errors.Is(err, net.ErrClosed) {
+				r.logger.Warn("Closing syslog connection",
+					zap.String("remote", conn.RemoteAddr().String()),
+					zap.Error(err),
+				)
+			}
+			return
+		}
+		if len(msg) > 0 {
+			r.handle(msg)
+		}
+	}
+}
+
+// readFrame reads "LENGTH SP MSG" when the frame starts with a digit, and
+// otherwise a newline-terminated message
+func readFrame(reader *bufio.Reader) ([]byte, error) {
+	first, err := reader.Peek(1)
+	if err != nil {
+		return nil, err
+	}
+
+	if first[0] >= '1' && first[0] <= '9' {
+		prefix, err := reader.ReadSlice(' ')
+		if err != nil {
+			return nil, fmt.Errorf("invalid frame length: %w", err)
+		}
+		length, err := strconv.Atoi(string(prefix[:len(prefix)-1]))
+		if err != nil || length > maxMessageSize {
+			return nil, fmt.Errorf("invalid frame length %q", prefix[:len(prefix)-1])
+		}
+		msg := make([]byte, length)
+		if _, err := io.ReadFull(reader, msg); err != nil {
+			return nil, err
+		}
+		return msg, nil
+	}
+
+	line, err := reader.ReadSlice('\n')
+	if errors.Is(err, bufio.ErrBufferFull) {
+		return nil, fmt.Errorf("message exceeds %d bytes", maxMessageSize)
+	}
+	if err != nil && (!errors.Is(err, io.EOF) || len(line) == 0) {
+		return nil, err
+	}
+	return append([]byte(nil), line...), nil
+}
+
+// handle parses a message and hands it to the consumer
+func (r *Receiver) handle(msg []byte) {
+	record, err := Parse(msg, r.cfg.Format, time.Now())
+	if err != nil {
+		r.logger.Debug("Invalid syslog message", zap.Error(err))
+		return
+	}
+
+	if err := r.consumer.ReceiveLogs([]models.LogRecord{record}); err != nil {
+		r.logger.Debug("Syslog message refused", zap.Error(err))
+	}
+}
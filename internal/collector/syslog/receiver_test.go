@@ -0,0 +1,116 @@
+package syslog
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gaurav/watchingcat/internal/config"
+	"github.com/gaurav/watchingcat/pkg/models"
+	"go.uber.org/zap"
+)
+
+// recordingConsumer keeps the logs it receives
+type recordingConsumer struct {
+	mu   sync.Mutex
+	logs []models.LogRecord
+}
+
+func (c *recordingConsumer) ReceiveLogs(logs []models.LogRecord) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.logs = append(c.logs, logs...)
+	return nil
+}
+
+// wait polls until n logs have arrived
+func (c *recordingConsumer) wait(t *testing.T, n int) []models.LogRecord {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		c.mu.Lock()
+		logs := append([]models.LogRecord(nil), c.logs...)
+		c.mu.Unlock()
+		if len(logs) >= n {
+			return logs
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	t.Fatalf("Expected %d logs", n)
+	return nil
+}
+
+func startReceiver(t *testing.T, protocol string) (*Receiver, *recordingConsumer, string) {
+	t.Helper()
+	consumer := &recordingConsumer{}
+	r, err := NewReceiver(config.SyslogReceiverConfig{Protocol: protocol, Endpoint: "127.0.0.1:0"}, consumer, zap.NewNop())
+	if err != nil {
+		t.Fatalf("NewReceiver failed: %v", err)
+	}
+	if err := r.Start(context.Background()); err != nil {
+		t.Fatalf("Start failed: %v", err)
+	}
+	t.Cleanup(func() { r.Shutdown(context.Background()) })
+
+	if r.packetConn != nil {
+		return r, consumer, r.packetConn.LocalAddr().String()
+	}
+	return r, consumer, r.listener.Addr().String()
+}
+
+func TestReceiverUDP(t *testing.T) {
+	_, consumer, addr := startReceiver(t, "udp")
+
+	conn, err := net.Dial("udp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	conn.Write([]byte("<14>1 2024-01-01T00:00:00Z host app - - - over udp\n"))
+
+	logs := consumer.wait(t, 1)
+	if logs[0].Message != "over udp" || logs[0].ServiceName != "app" {
+		t.Errorf("Unexpected record %+v", logs[0])
+	}
+}
+
+func TestReceiverTCPFraming(t *testing.T) {
+	r, consumer, addr := startReceiver(t, "tcp")
+
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	framed := "<14>1 - host app - - - line one\nstill line one"
+	fmt.Fprintf(conn, "%d %s", len(framed), framed)
+	fmt.Fprint(conn, "<14>Jan  2 09:30:00 host app: newline framed\n")
+	fmt.Fprint(conn, "<14>Jan  2 09:30:01 host app: second\n")
+
+	logs := consumer.wait(t, 3)
+	if logs[0].Message != "line one\nstill line one" {
+		t.Errorf("Expected an octet-counted frame to keep its newline, got %q", logs[0].Message)
+	}
+	if logs[1].Message != "newline framed" || logs[2].Message != "second" {
+		t.Errorf("Unexpected newline-framed messages %q and %q", logs[1].Message, logs[2].Message)
+	}
+
+	// Shutdown closes connections that are still open
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := r.Shutdown(ctx); err != nil {
+		t.Errorf("Shutdown failed: %v", err)
+	}
+}
+
+func TestNewReceiverValidates(t *testing.T) {
+	for _, cfg := range []config.SyslogReceiverConfig{{Protocol: "sctp"}, {Format: "cef"}} {
+		if _, err := NewReceiver(cfg, &recordingConsumer{}, zap.NewNop()); err == nil {
+			t.Errorf("Expected an error for %+v", cfg)
+		}
+	}
+}
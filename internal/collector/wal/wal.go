@@ -0,0 +1,299 @@
+package wal
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/gaurav/watchingcat/internal/config"
+	"github.com/gaurav/watchingcat/pkg/models"
+	"go.uber.org/zap"
+)
+
+const (
+	segmentExt = ".wal"
+
+	// headerSize is the record length followed by its CRC32
+	headerSize = 8
+
+	// maxRecordSize guards replay against a corrupt length field
+	maxRecordSize = 256 << 20
+)
+
+var crcTable = crc32.MakeTable(crc32.Castagnoli)
+
+// WAL is a write-ahead log of received telemetry. Batches are appended to
+// the current segment until Rotate seals it. A sealed segment is deleted
+// with Remove once its data has been exported; segments left behind by a
+// previous run are handed to Replay.
+//
+// Each record is a little-endian uint32 length, a CRC32-C of the payload,
+// and the payload itself, a JSON-encoded models.TelemetryBatch.
+type WAL struct {
+	dir    string
+	sync   bool
+	logger *zap.Logger
+
+	mu      sync.Mutex
+	current *os.File
+	writer  *bufio.Writer
+	id      uint64
+	records int
+	pending []uint64
+}
+
+// Open opens the WAL directory, creating it if needed, and starts a new
+// segment after any existing ones
+func Open(cfg config.WALConfig, logger *zap.Logger) (*WAL, error) {
+	if cfg.Directory == "" {
+		return nil, errors.New("wal directory is required")
+	}
+	if err := os.MkdirAll(cfg.Directory, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create wal directory: %w", err)
+	}
+
+	pending, err := listSegments(cfg.Directory)
+	if err != nil {
+		return nil, err
+	}
+
+	w := &WAL{
+		dir:     cfg.Directory,
+		sync:    cfg.Sync,
+		logger:  logger,
+		pending: pending,
+	}
+	if len(pending) > 0 {
+		w.id = pending[len(pending)-1]
+	}
+
+	if err := w.openSegment(); err != nil {
+		return nil, err
+	}
+
+	return w, nil
+}
+
+// Append writes a batch to the current segment
+func (w *WAL) Append(batch models.TelemetryBatch) error {
+	payload, err := json.Marshal(batch)
+	if err != nil {
+		return fmt.Errorf("failed to encode batch: %w", err)
+	}
+
+	var header [headerSize]byte
+	binary.LittleEndian.PutUint32(header[0:4], uint32(len(payload)))
+	binary.LittleEndian.PutUint32(header[4:8], crc32.Checksum(payload, crcTable))
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.current == nil {
+		return errors.New("wal is closed")
+	}
+
+	if _, err := w.writer.Write(header[:]); err != nil {
+		return fmt.Errorf("failed to write wal record: %w", err)
+	}
+	if _, err := w.writer.Write(payload); err != nil {
+		return fmt.Errorf("failed to write wal record: %w", err)
+	}
+	if err := w.writer.Flush(); err != nil {
+		return fmt.Errorf("failed to write wal record: %w", err)
+	}
+	if w.sync {
+		if err := w.current.Sync(); err != nil {
+			return fmt.Errorf("failed to sync wal segment: %w", err)
+		}
+	}
+
+	w.records++
+	return nil
+}
+
+// Rotate seals the current segment and starts a new one. It returns the
+// sealed segment's ID, or 0 if the segment was empty and nothing was sealed.
+func (w *WAL) Rotate() (uint64, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.current == nil {
+		return 0, errors.New("wal is closed")
+	}
+	if w.records == 0 {
+		return 0, nil
+	}
+
+	sealed := w.id
+	if err := w.closeSegment(); err != nil {
+		return 0, err
+	}
+	if err := w.openSegment(); err != nil {
+		return 0, err
+	}
+
+	return sealed, nil
+}
+
+// Remove deletes a sealed segment once its data has been exported
+func (w *WAL) Remove(id uint64) error {
+	err := os.Remove(w.segmentPath(id))
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("failed to remove wal segment: %w", err)
+	}
+	return nil
+}
+
+// Replay reads the segments left by a previous run and calls fn once per
+// segment with all of its records merged into one batch. A torn or corrupt
+// record ends that segment's replay; the records before it are kept.
+func (w *WAL) Replay(fn func(id uint64, batch models.TelemetryBatch)) {
+	w.mu.Lock()
+	pending := w.pending
+	w.pending = nil
+	w.mu.Unlock()
+
+	for _, id := range pending {
+		batch, err := w.readSegment(id)
+		if err != nil {
+			w.logger.Warn("WAL segment truncated during replay",
+				zap.Uint64("segment", id),
+				zap.Error(err),
+			)
+		}
+		fn(id, batch)
+	}
+}
+
+// Close closes the current segment. An empty segment is deleted.
+func (w *WAL) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.current == nil {
+		return nil
+	}
+
+	id, records := w.id, w.records
+	if err := w.closeSegment(); err != nil {
+		return err
+	}
+	if records == 0 {
+		return w.Remove(id)
+	}
+	return nil
+}
+
+// openSegment starts the next segment. Must be called with mu held.
+func (w *WAL) openSegment() error {
+	w.id++
+	f, err := os.OpenFile(w.segmentPath(w.id), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return fmt.Errorf("failed to create wal segment: %w", err)
+	}
+
+	w.current = f
+	w.writer = bufio.NewWriter(f)
+	w.records = 0
+	return nil
+}
+
+// closeSegment flushes, syncs and closes the current segment. Must be
+// called with mu held.
+func (w *WAL) closeSegment() error {
+	f := w.current
+	w.current = nil
+
+	if err := w.writer.Flush(); err != nil {
+		f.Close()
+		return fmt.Errorf("failed to flush wal segment: %w", err)
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return fmt.Errorf("failed to sync wal segment: %w", err)
+	}
+	return f.Close()
+}
+
+// readSegment merges every intact record of a segment into one batch
+func (w *WAL) readSegment(id uint64) (models.TelemetryBatch, error) {
+	var batch models.TelemetryBatch
+
+	f, err := os.Open(w.segmentPath(id))
+	if err != nil {
+		return batch, err
+	}
+	defer f.Close()
+
+	r := bufio.NewReader(f)
+	var header [headerSize]byte
+	for {
+		if _, err := io.ReadFull(r, header[:]); err != nil {
+			if errors.Is(err, io.EOF) {
+				return batch, nil
+			}
+			return batch, fmt.Errorf("short record header: %w", err)
+		}
+
+		size := binary.LittleEndian.Uint32(header[0:4])
+		if size > maxRecordSize {
+			return batch, fmt.Errorf("record size %d exceeds limit", size)
+		}
+
+		payload := make([]byte, size)
+		if _, err := io.ReadFull(r, payload); err != nil {
+			return batch, fmt.Errorf("short record: %w", err)
+		}
+		if crc32.Checksum(payload, crcTable) != binary.LittleEndian.Uint32(header[4:8]) {
+			return batch, errors.New("record checksum mismatch")
+		}
+
+		var record models.TelemetryBatch
+		if err := json.Unmarshal(payload, &record); err != nil {
+			return batch, fmt.Errorf("failed to decode record: %w", err)
+		}
+
+		batch.Spans = append(batch.Spans, record.Spans...)
+		batch.Logs = append(batch.Logs, record.Logs...)
+		batch.Metrics = append(batch.Metrics, record.Metrics...)
+		batch.Exceptions = append(batch.Exceptions, record.Exceptions...)
+	}
+}
+
+func (w *WAL) segmentPath(id uint64) string {
+	return filepath.Join(w.dir, fmt.Sprintf("%016d%s", id, segmentExt))
+}
+
+// listSegments returns the IDs of existing segments in ascending order
+func listSegments(dir string) ([]uint64, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read wal directory: %w", err)
+	}
+
+	var ids []uint64
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !strings.HasSuffix(name, segmentExt) {
+			continue
+		}
+		id, err := strconv.ParseUint(strings.TrimSuffix(name, segmentExt), 10, 64)
+		if err != nil {
+			continue
+		}
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+
+	return ids, nil
+}
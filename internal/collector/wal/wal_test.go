@@ -0,0 +1,117 @@
+package wal
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/gaurav/watchingcat/internal/config"
+	"github.com/gaurav/watchingcat/pkg/models"
+	"go.uber.org/zap"
+)
+
+func openTestWAL(t *testing.T, dir string) *WAL {
+	w, err := Open(config.WALConfig{Directory: dir}, zap.NewNop())
+	if err != nil {
+		t.Fatalf("Failed to open wal: %v", err)
+	}
+	return w
+}
+
+func segments(t *testing.T, dir string) []string {
+	matches, err := filepath.Glob(filepath.Join(dir, "*"+segmentExt))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return matches
+}
+
+func TestWALReplayAfterRestart(t *testing.T) {
+	dir := t.TempDir()
+
+	w := openTestWAL(t, dir)
+	w.Append(models.TelemetryBatch{Spans: []models.Span{{Name: "checkout"}}})
+	w.Append(models.TelemetryBatch{Logs: []models.LogRecord{{Message: "payment failed"}}})
+
+	// Simulate a crash: the segment is never rotated or removed
+	w.Close()
+
+	w = openTestWAL(t, dir)
+	defer w.Close()
+
+	var replayed []models.TelemetryBatch
+	w.Replay(func(id uint64, batch models.TelemetryBatch) {
+		replayed = append(replayed, batch)
+		w.Remove(id)
+	})
+
+	if len(replayed) != 1 {
+		t.Fatalf("Expected 1 replayed segment, got %d", len(replayed))
+	}
+	batch := replayed[0]
+	if len(batch.Spans) != 1 || batch.Spans[0].Name != "checkout" {
+		t.Errorf("Expected span to be replayed, got %+v", batch.Spans)
+	}
+	if len(batch.Logs) != 1 || batch.Logs[0].Message != "payment failed" {
+		t.Errorf("Expected log to be replayed, got %+v", batch.Logs)
+	}
+
+	// Only the new, empty segment remains
+	if n := len(segments(t, dir)); n != 1 {
+		t.Errorf("Expected 1 segment after replay, got %d", n)
+	}
+}
+
+func TestWALRotateAndRemove(t *testing.T) {
+	dir := t.TempDir()
+	w := openTestWAL(t, dir)
+	defer w.Close()
+
+	if id, err := w.Rotate(); err != nil || id != 0 {
+		t.Fatalf("Expected an empty segment not to rotate, got %d, %v", id, err)
+	}
+
+	w.Append(models.TelemetryBatch{Metrics: []models.Metric{{Name: "up", Value: 1}}})
+	id, err := w.Rotate()
+	if err != nil || id == 0 {
+		t.Fatalf("Expected a sealed segment, got %d, %v", id, err)
+	}
+	if n := len(segments(t, dir)); n != 2 {
+		t.Errorf("Expected sealed and current segments, got %d", n)
+	}
+
+	if err := w.Remove(id); err != nil {
+		t.Fatalf("Remove failed: %v", err)
+	}
+	if n := len(segments(t, dir)); n != 1 {
+		t.Errorf("Expected only the current segment, got %d", n)
+	}
+}
+
+func TestWALReplayStopsAtTornRecord(t *testing.T) {
+	dir := t.TempDir()
+
+	w := openTestWAL(t, dir)
+	w.Append(models.TelemetryBatch{Spans: []models.Span{{Name: "first"}}})
+	w.Append(models.TelemetryBatch{Spans: []models.Span{{Name: "second"}}})
+	w.Close()
+
+	// Cut the last record in half as if the process died mid-write
+	path := segments(t, dir)[0]
+	info, _ := os.Stat(path)
+	if err := os.Truncate(path, info.Size()-5); err != nil {
+		t.Fatal(err)
+	}
+
+	w = openTestWAL(t, dir)
+	defer w.Close()
+
+	var spans []models.Span
+	w.Replay(func(id uint64, batch models.TelemetryBatch) {
+		spans = append(spans, batch.Spans...)
+	})
+
+	if len(spans) != 1 || spans[0].Name != "first" {
+		t.Errorf("Expected only the intact record to be replayed, got %+v", spans)
+	}
+}
@@ -0,0 +1,195 @@
+// Package zipkin receives spans in the Zipkin v2 JSON format
+package zipkin
+
+import (
+	"encoding/hex"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gaurav/watchingcat/internal/collector/otlp"
+	"github.com/gaurav/watchingcat/pkg/models"
+)
+
+// Span is a span in the Zipkin v2 JSON format. Timestamps and durations are
+// in microseconds.
+type Span struct {
+	TraceID        string            `json:"traceId"`
+	ID             string            `json:"id"`
+	ParentID       string            `json:"parentId,omitempty"`
+	Name           string            `json:"name,omitempty"`
+	Kind           string            `json:"kind,omitempty"`
+	Timestamp      int64             `json:"timestamp,omitempty"`
+	Duration       int64             `json:"duration,omitempty"`
+	Shared         bool              `json:"shared,omitempty"`
+	LocalEndpoint  *Endpoint         `json:"localEndpoint,omitempty"`
+	RemoteEndpoint *Endpoint         `json:"remoteEndpoint,omitempty"`
+	Annotations    []Annotation      `json:"annotations,omitempty"`
+	Tags           map[string]string `json:"tags,omitempty"`
+}
+
+// Endpoint is the network context of one side of a span
+type Endpoint struct {
+	ServiceName string `json:"serviceName,omitempty"`
+	IPv4        string `json:"ipv4,omitempty"`
+	IPv6        string `json:"ipv6,omitempty"`
+	Port        int    `json:"port,omitempty"`
+}
+
+// Annotation is a timestamped event within a span
+type Annotation struct {
+	Timestamp int64  `json:"timestamp"`
+	Value     string `json:"value"`
+}
+
+// ConvertSpans converts Zipkin spans into model spans. Spans without a valid
+// trace or span ID are skipped; rejected counts them.
+func ConvertSpans(zspans []Span) (spans []models.Span, rejected int) {
+	for _, zs := range zspans {
+		traceID, ok := normalizeID(zs.TraceID, 32)
+		if !ok {
+			rejected++
+			continue
+		}
+		spanID, ok := normalizeID(zs.ID, 16)
+		if !ok {
+			rejected++
+			continue
+		}
+		parentID, _ := normalizeID(zs.ParentID, 16)
+
+		start := microseconds(zs.Timestamp)
+		span := models.Span{
+			TraceID:    traceID,
+			SpanID:     spanID,
+			ParentID:   parentID,
+			Name:       zs.Name,
+			Kind:       spanKind(zs.Kind),
+			StartTime:  start,
+			EndTime:    start.Add(time.Duration(zs.Duration) * time.Microsecond),
+			Attributes: make(map[string]string, len(zs.Tags)+4),
+			Events:     make([]models.SpanEvent, 0, len(zs.Annotations)),
+		}
+
+		for k, v := range zs.Tags {
+			span.Attributes[k] = v
+		}
+		span.Status = status(span.Attributes)
+
+		if e := zs.LocalEndpoint; e != nil {
+			setIfEmpty(span.Attributes, otlp.ServiceNameKey, e.ServiceName)
+			setIfEmpty(span.Attributes, "net.host.ip", firstOf(e.IPv4, e.IPv6))
+			if e.Port > 0 {
+				setIfEmpty(span.Attributes, "net.host.port", strconv.Itoa(e.Port))
+			}
+		}
+		if e := zs.RemoteEndpoint; e != nil {
+			setIfEmpty(span.Attributes, "peer.service", e.ServiceName)
+			setIfEmpty(span.Attributes, "net.peer.ip", firstOf(e.IPv4, e.IPv6))
+			if e.Port > 0 {
+				setIfEmpty(span.Attributes, "net.peer.port", strconv.Itoa(e.Port))
+			}
+		}
+
+		for _, a := range zs.Annotations {
+			span.Events = append(span.Events, models.SpanEvent{
+				Name:       a.Value,
+				Timestamp:  microseconds(a.Timestamp),
+				Attributes: map[string]string{},
+			})
+		}
+
+		spans = append(spans, span)
+	}
+
+	return spans, rejected
+}
+
+// normalizeID lowercases a hex ID and left-pads it with zeros to size
+// characters, so 64-bit Zipkin trace IDs match 128-bit OTLP ones
+func normalizeID(id string, size int) (string, bool) {
+	if id == "" || len(id) > size {
+		return "", false
+	}
+	id = strings.ToLower(id)
+	if _, err := hex.DecodeString(padHex(id)); err != nil {
+		return "", false
+	}
+	if strings.Trim(id, "0") == "" {
+		return "", false
+	}
+	return strings.Repeat("0", size-len(id)) + id, true
+}
+
+func padHex(id string) string {
+	if len(id)%2 == 1 {
+		return "0" + id
+	}
+	return id
+}
+
+// spanKind maps a Zipkin kind to the lowercase names the OTLP receiver uses.
+// A span without a kind is local to its service.
+func spanKind(kind string) string {
+	switch strings.ToUpper(kind) {
+	case "SERVER":
+		return "server"
+	case "CLIENT":
+		return "client"
+	case "PRODUCER":
+		return "producer"
+	case "CONSUMER":
+		return "consumer"
+	}
+	return "internal"
+}
+
+// status derives a span's status from the otel.status_code tag OpenTelemetry
+// exporters set, or from Zipkin's error tag. Both are removed from attrs.
+func status(attrs map[string]string) models.SpanStatus {
+	code, hasCode := attrs["otel.status_code"]
+	message := attrs["otel.status_description"]
+	errTag, hasErr := attrs["error"]
+	delete(attrs, "otel.status_code")
+	delete(attrs, "otel.status_description")
+	delete(attrs, "error")
+
+	switch {
+	case hasCode && (code == "OK" || code == "ERROR"):
+		return models.SpanStatus{Code: code, Message: message}
+	case hasErr:
+		// The error tag holds a message, or just "true"
+		if errTag == "true" {
+			errTag = ""
+		}
+		return models.SpanStatus{Code: "ERROR", Message: errTag}
+	}
+	return models.SpanStatus{Code: "UNSET"}
+}
+
+// microseconds converts microseconds since epoch into a time, keeping zero
+// as zero
+func microseconds(us int64) time.Time {
+	if us == 0 {
+		return time.Time{}
+	}
+	return time.UnixMicro(us).UTC()
+}
+
+func setIfEmpty(attrs map[string]string, key, value string) {
+	if value == "" {
+		return
+	}
+	if _, ok := attrs[key]; !ok {
+		attrs[key] = value
+	}
+}
+
+func firstOf(values ...string) string {
+	for _, v := range values {
+		if v != "" {
+			return v
+		}
+	}
+	return ""
+}
@@ -0,0 +1,136 @@
+package zipkin
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"mime"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/gaurav/watchingcat/internal/collector/httpbody"
+	"github.com/gaurav/watchingcat/internal/config"
+	"github.com/gaurav/watchingcat/pkg/models"
+	"go.uber.org/zap"
+)
+
+// Consumer receives spans decoded from Zipkin requests. An error means the
+// spans were refused, typically because buffers are full.
+type Consumer interface {
+	ReceiveSpans(spans []models.Span) error
+}
+
+// Receiver serves the Zipkin v2 span API over HTTP
+type Receiver struct {
+	cfg      config.ZipkinReceiverConfig
+	consumer Consumer
+	logger   *zap.Logger
+
+	server *http.Server
+}
+
+// NewReceiver creates a Zipkin receiver handing spans to consumer
+func NewReceiver(cfg config.ZipkinReceiverConfig, consumer Consumer, logger *zap.Logger) *Receiver {
+	return &Receiver{cfg: cfg, consumer: consumer, logger: logger}
+}
+
+// Start listens on the configured endpoint and serves in the background
+func (r *Receiver) Start(ctx context.Context) error {
+	listener, err := net.Listen("tcp", r.cfg.Endpoint)
+	if err != nil {
+		return fmt.Errorf("failed to listen: %w", err)
+	}
+
+	r.server = &http.Server{
+		Handler:     NewHandler(r.consumer, r.logger),
+		ReadTimeout: 30 * time.Second,
+		IdleTimeout: 60 * time.Second,
+	}
+
+	r.logger.Info("Zipkin receiver starting",
+		zap.String("endpoint", r.cfg.Endpoint),
+	)
+
+	go func() {
+		if err := r.server.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			r.logger.Error("Zipkin server error", zap.Error(err))
+		}
+	}()
+	return nil
+}
+
+// Shutdown stops accepting requests and waits for in-flight ones until ctx
+// is done
+func (r *Receiver) Shutdown(ctx context.Context) error {
+	if r.server == nil {
+		return nil
+	}
+	return r.server.Shutdown(ctx)
+}
+
+// handler serves POST /api/v2/spans
+type handler struct {
+	consumer Consumer
+	logger   *zap.Logger
+}
+
+// NewHandler returns a handler serving the Zipkin v2 /api/v2/spans endpoint.
+// It accepts a JSON array of spans, optionally gzip-compressed, and answers
+// 202 Accepted like a Zipkin server.
+func NewHandler(consumer Consumer, logger *zap.Logger) http.Handler {
+	h := &handler{consumer: consumer, logger: logger}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/v2/spans", h.handleSpans)
+
+	return mux
+}
+
+func (h *handler) handleSpans(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", "POST")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if ct := r.Header.Get("Content-Type"); ct != "" {
+		if mediaType, _, err := mime.ParseMediaType(ct); err != nil || mediaType != "application/json" {
+			http.Error(w, fmt.Sprintf("unsupported content type %q", ct), http.StatusUnsupportedMediaType)
+			return
+		}
+	}
+
+	body, err := httpbody.Read(w, r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var zspans []Span
+	if err := json.Unmarshal(body, &zspans); err != nil {
+		h.logger.Debug("Failed to decode Zipkin request", zap.Error(err))
+		http.Error(w, fmt.Sprintf("failed to decode spans: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	spans, rejected := ConvertSpans(zspans)
+	if len(spans) > 0 {
+		if err := h.consumer.ReceiveSpans(spans); err != nil {
+			h.logger.Warn("Zipkin spans refused",
+				zap.Int("spans", len(spans)),
+				zap.Error(err),
+			)
+			w.Header().Set("Retry-After", "1")
+			http.Error(w, err.Error(), http.StatusServiceUnavailable)
+			return
+		}
+	}
+
+	h.logger.Debug("Zipkin spans received",
+		zap.Int("spans", len(spans)),
+		zap.Int("rejected", rejected),
+	)
+	w.WriteHeader(http.StatusAccepted)
+}
@@ -0,0 +1,167 @@
+package zipkin
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gaurav/watchingcat/pkg/models"
+	"go.uber.org/zap"
+)
+
+// recordingConsumer keeps the spans it receives, or refuses them with err
+type recordingConsumer struct {
+	spans []models.Span
+	err   error
+}
+
+func (c *recordingConsumer) ReceiveSpans(spans []models.Span) error {
+	if c.err != nil {
+		return c.err
+	}
+	c.spans = append(c.spans, spans...)
+	return nil
+}
+
+const zipkinSpans = `[
+  {
+    "traceId": "5af7183fb1d4cf5f",
+    "parentId": "6b221d5bc9e6496c",
+    "id": "352bff9a74ca9ad2",
+    "kind": "CLIENT",
+    "name": "get /api",
+    "timestamp": 1556604172355737,
+    "duration": 1431,
+    "localEndpoint": {"serviceName": "backend", "ipv4": "192.168.99.1", "port": 3306},
+    "remoteEndpoint": {"serviceName": "inventory", "ipv4": "172.19.0.2", "port": 8080},
+    "annotations": [{"timestamp": 1556604172356000, "value": "wire send"}],
+    "tags": {"http.method": "GET", "http.path": "/api", "error": "connection reset"}
+  },
+  {
+    "traceId": "not-hex",
+    "id": "352bff9a74ca9ad3",
+    "name": "broken"
+  },
+  {
+    "traceId": "5AF7183FB1D4CF5F5AF7183FB1D4CF5F",
+    "id": "6b221d5bc9e6496c",
+    "name": "process",
+    "timestamp": 1556604172355000,
+    "duration": 3000,
+    "localEndpoint": {"serviceName": "backend"},
+    "tags": {"otel.status_code": "OK"}
+  }
+]`
+
+func post(t *testing.T, h http.Handler, body []byte, header map[string]string) *httptest.ResponseRecorder {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodPost, "/api/v2/spans", bytes.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range header {
+		req.Header.Set(k, v)
+	}
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestHandlerConvertsSpans(t *testing.T) {
+	consumer := &recordingConsumer{}
+	rec := post(t, NewHandler(consumer, zap.NewNop()), []byte(zipkinSpans), nil)
+
+	if rec.Code != http.StatusAccepted {
+		t.Fatalf("Expected 202, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if len(consumer.spans) != 2 {
+		t.Fatalf("Expected the span with an invalid trace ID to be skipped, got %d spans", len(consumer.spans))
+	}
+
+	span := consumer.spans[0]
+	if span.TraceID != "00000000000000005af7183fb1d4cf5f" {
+		t.Errorf("Expected a 64-bit trace ID padded to 128 bits, got %s", span.TraceID)
+	}
+	if span.SpanID != "352bff9a74ca9ad2" || span.ParentID != "6b221d5bc9e6496c" {
+		t.Errorf("Unexpected IDs %s/%s", span.SpanID, span.ParentID)
+	}
+	if span.Kind != "client" {
+		t.Errorf("Expected kind client, got %s", span.Kind)
+	}
+	if got := span.EndTime.Sub(span.StartTime); got != 1431*time.Microsecond {
+		t.Errorf("Expected a duration of 1431µs, got %v", got)
+	}
+
+	want := map[string]string{
+		"service.name":  "backend",
+		"net.host.ip":   "192.168.99.1",
+		"net.host.port": "3306",
+		"peer.service":  "inventory",
+		"net.peer.ip":   "172.19.0.2",
+		"net.peer.port": "8080",
+		"http.method":   "GET",
+		"http.path":     "/api",
+	}
+	for k, v := range want {
+		if span.Attributes[k] != v {
+			t.Errorf("Expected attribute %s=%s, got %q", k, v, span.Attributes[k])
+		}
+	}
+	if _, ok := span.Attributes["error"]; ok {
+		t.Error("Expected the error tag to become the span status")
+	}
+	if span.Status.Code != "ERROR" || span.Status.Message != "connection reset" {
+		t.Errorf("Expected an ERROR status from the error tag, got %+v", span.Status)
+	}
+
+	if len(span.Events) != 1 || span.Events[0].Name != "wire send" ||
+		!span.Events[0].Timestamp.Equal(time.UnixMicro(1556604172356000)) {
+		t.Errorf("Expected the annotation as a span event, got %+v", span.Events)
+	}
+
+	if root := consumer.spans[1]; root.TraceID != "5af7183fb1d4cf5f5af7183fb1d4cf5f" || root.Kind != "internal" || root.Status.Code != "OK" {
+		t.Errorf("Unexpected second span %+v", root)
+	}
+}
+
+func TestHandlerAcceptsGzip(t *testing.T) {
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	gz.Write([]byte(zipkinSpans))
+	gz.Close()
+
+	consumer := &recordingConsumer{}
+	rec := post(t, NewHandler(consumer, zap.NewNop()), buf.Bytes(), map[string]string{"Content-Encoding": "gzip"})
+	if rec.Code != http.StatusAccepted || len(consumer.spans) != 2 {
+		t.Fatalf("Expected a gzip body to be accepted, got %d with %d spans", rec.Code, len(consumer.spans))
+	}
+}
+
+func TestHandlerErrors(t *testing.T) {
+	h := NewHandler(&recordingConsumer{}, zap.NewNop())
+
+	if rec := post(t, h, []byte(`{"traceId": "1"}`), nil); rec.Code != http.StatusBadRequest {
+		t.Errorf("Expected 400 for a body that is not a span list, got %d", rec.Code)
+	}
+	if rec := post(t, h, []byte(`[]`), map[string]string{"Content-Type": "application/x-protobuf"}); rec.Code != http.StatusUnsupportedMediaType {
+		t.Errorf("Expected 415 for protobuf, got %d", rec.Code)
+	}
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/v2/spans", nil))
+	if rec.Code != http.StatusMethodNotAllowed {
+		t.Errorf("Expected 405 for GET, got %d", rec.Code)
+	}
+
+	refusing := NewHandler(&recordingConsumer{err: errors.New("buffer full")}, zap.NewNop())
+	rec = post(t, refusing, []byte(zipkinSpans), nil)
+	if rec.Code != http.StatusServiceUnavailable || !strings.Contains(rec.Body.String(), "buffer full") {
+		t.Errorf("Expected 503 when spans are refused, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if rec.Header().Get("Retry-After") == "" {
+		t.Error("Expected a Retry-After header on refusal")
+	}
+}
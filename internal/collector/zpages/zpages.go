@@ -0,0 +1,209 @@
+// Package zpages serves the collector's admin endpoint: its own metrics,
+// debug pages in the spirit of OpenTelemetry zPages, and health checks
+package zpages
+
+import (
+	"html/template"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/gaurav/watchingcat/internal/collector/buffer"
+	"github.com/gaurav/watchingcat/internal/collector/pipeline"
+	"github.com/gaurav/watchingcat/pkg/models"
+	"go.uber.org/zap"
+)
+
+// handler serves the admin endpoints for one pipeline service
+type handler struct {
+	service *pipeline.Service
+	logger  *zap.Logger
+}
+
+// NewHandler returns a handler serving /metrics, /debug/pipelines,
+// /debug/tracez, /healthz and /readyz
+func NewHandler(service *pipeline.Service, logger *zap.Logger) http.Handler {
+	h := &handler{service: service, logger: logger}
+
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", service.MetricsHandler())
+	mux.HandleFunc("/debug/pipelines", h.handlePipelines)
+	mux.HandleFunc("/debug/tracez", h.handleTracez)
+	mux.HandleFunc("/healthz", h.handleHealthz)
+	mux.HandleFunc("/readyz", h.handleReadyz)
+
+	return mux
+}
+
+// handleHealthz reports that the process is up
+func (h *handler) handleHealthz(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Write([]byte("ok\n"))
+}
+
+// handleReadyz reports whether the receivers are accepting data
+func (h *handler) handleReadyz(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	if !h.service.Ready() {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		w.Write([]byte("not ready\n"))
+		return
+	}
+	w.Write([]byte("ready\n"))
+}
+
+// pipelineRow is one pipeline on the pipelines page
+type pipelineRow struct {
+	Name       string
+	Signal     string
+	Receivers  []string
+	Processors []string
+	Exporters  []string
+	Stats      pipeline.Stats
+}
+
+// receiverRow is one receiver's buffer on the pipelines page
+type receiverRow struct {
+	ID    string
+	Stats buffer.Stats
+}
+
+// handlePipelines shows how pipelines are wired and what passed through them
+func (h *handler) handlePipelines(w http.ResponseWriter, r *http.Request) {
+	data := struct {
+		Ready     bool
+		Pipelines []pipelineRow
+		Receivers []receiverRow
+	}{Ready: h.service.Ready()}
+
+	for _, p := range h.service.Pipelines() {
+		cfg := p.Config()
+		data.Pipelines = append(data.Pipelines, pipelineRow{
+			Name:       p.Name(),
+			Signal:     string(p.Signal()),
+			Receivers:  cfg.Receivers,
+			Processors: cfg.Processors,
+			Exporters:  cfg.Exporters,
+			Stats:      p.Stats(),
+		})
+	}
+
+	for id, stats := range h.service.BufferStats() {
+		data.Receivers = append(data.Receivers, receiverRow{ID: id, Stats: stats})
+	}
+	sort.Slice(data.Receivers, func(i, j int) bool { return data.Receivers[i].ID < data.Receivers[j].ID })
+
+	h.render(w, pipelinesPage, data)
+}
+
+// spanRow is one span on the tracez page
+type spanRow struct {
+	Time     string
+	TraceID  string
+	SpanID   string
+	Service  string
+	Name     string
+	Kind     string
+	Duration time.Duration
+	Status   string
+	Error    bool
+}
+
+// tracezSection lists one pipeline's recent spans
+type tracezSection struct {
+	Pipeline string
+	Spans    []spanRow
+}
+
+// handleTracez shows the spans each traces pipeline exported last. The
+// pipeline query parameter limits the page to one pipeline.
+func (h *handler) handleTracez(w http.ResponseWriter, r *http.Request) {
+	only := r.URL.Query().Get("pipeline")
+
+	var sections []tracezSection
+	for _, p := range h.service.Pipelines() {
+		if p.Signal() != pipeline.Traces || (only != "" && p.Name() != only) {
+			continue
+		}
+		section := tracezSection{Pipeline: p.Name()}
+		for _, span := range p.RecentSpans() {
+			section.Spans = append(section.Spans, toSpanRow(span))
+		}
+		sections = append(sections, section)
+	}
+
+	h.render(w, tracezPage, sections)
+}
+
+func toSpanRow(span models.Span) spanRow {
+	return spanRow{
+		Time:     span.StartTime.UTC().Format("15:04:05.000"),
+		TraceID:  span.TraceID,
+		SpanID:   span.SpanID,
+		Service:  span.Attributes["service.name"],
+		Name:     span.Name,
+		Kind:     span.Kind,
+		Duration: span.EndTime.Sub(span.StartTime).Round(time.Microsecond),
+		Status:   span.Status.Code,
+		Error:    span.Status.Code == "ERROR",
+	}
+}
+
+func (h *handler) render(w http.ResponseWriter, page *template.Template, data interface{}) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if err := page.Execute(w, data); err != nil {
+		h.logger.Error("Failed to render debug page", zap.Error(err))
+	}
+}
+
+const pageStyle = `<style>
+body { font-family: sans-serif; margin: 2em; }
+table { border-collapse: collapse; margin-bottom: 2em; }
+th, td { border: 1px solid #ccc; padding: 4px 8px; text-align: left; font-size: 13px; }
+th { background: #eee; }
+td.num { text-align: right; }
+tr.error td { background: #fdd; }
+</style>`
+
+var pipelinesPage = template.Must(template.New("pipelines").Parse(`<!DOCTYPE html>
+<html><head><title>Pipelines</title>` + pageStyle + `</head><body>
+<h1>Pipelines</h1>
+<p>Receivers {{if .Ready}}ready{{else}}not ready{{end}}. <a href="/debug/tracez">Recent spans</a></p>
+<table>
+<tr><th>Pipeline</th><th>Signal</th><th>Receivers</th><th>Processors</th><th>Exporters</th><th>Batches</th><th>Items in</th><th>Items out</th></tr>
+{{range .Pipelines}}<tr>
+<td>{{.Name}}</td><td>{{.Signal}}</td>
+<td>{{range $i, $id := .Receivers}}{{if $i}} → {{end}}{{$id}}{{end}}</td>
+<td>{{range $i, $id := .Processors}}{{if $i}} → {{end}}{{$id}}{{end}}</td>
+<td>{{range $i, $id := .Exporters}}{{if $i}}, {{end}}{{$id}}{{end}}</td>
+<td class="num">{{.Stats.Batches}}</td><td class="num">{{.Stats.ItemsIn}}</td><td class="num">{{.Stats.ItemsOut}}</td>
+</tr>{{end}}
+</table>
+<h2>Receiver buffers</h2>
+<table>
+<tr><th>Receiver</th><th>Spans</th><th>Logs</th><th>Metrics</th><th>Dropped</th><th>Refused</th></tr>
+{{range .Receivers}}<tr>
+<td>{{.ID}}</td>
+<td class="num">{{.Stats.Spans.Buffered}}</td><td class="num">{{.Stats.Logs.Buffered}}</td><td class="num">{{.Stats.Metrics.Buffered}}</td>
+<td class="num">{{.Stats.Spans.Dropped}} / {{.Stats.Logs.Dropped}} / {{.Stats.Metrics.Dropped}}</td>
+<td class="num">{{.Stats.Spans.Refused}} / {{.Stats.Logs.Refused}} / {{.Stats.Metrics.Refused}}</td>
+</tr>{{end}}
+</table>
+</body></html>
+`))
+
+var tracezPage = template.Must(template.New("tracez").Parse(`<!DOCTYPE html>
+<html><head><title>Recent spans</title>` + pageStyle + `</head><body>
+<h1>Recent spans</h1>
+<p><a href="/debug/pipelines">Pipelines</a></p>
+{{range .}}<h2>{{.Pipeline}}</h2>
+{{if .Spans}}<table>
+<tr><th>Start</th><th>Service</th><th>Name</th><th>Kind</th><th>Duration</th><th>Status</th><th>Trace ID</th><th>Span ID</th></tr>
+{{range .Spans}}<tr{{if .Error}} class="error"{{end}}>
+<td>{{.Time}}</td><td>{{.Service}}</td><td>{{.Name}}</td><td>{{.Kind}}</td>
+<td class="num">{{.Duration}}</td><td>{{.Status}}</td><td>{{.TraceID}}</td><td>{{.SpanID}}</td>
+</tr>{{end}}
+</table>{{else}}<p>No spans exported yet.</p>{{end}}
+{{else}}<p>No traces pipelines.</p>{{end}}
+</body></html>
+`))
@@ -0,0 +1,145 @@
+package zpages
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gaurav/watchingcat/internal/collector/exporters"
+	"github.com/gaurav/watchingcat/internal/collector/pipeline"
+	"github.com/gaurav/watchingcat/internal/config"
+	"github.com/gaurav/watchingcat/pkg/models"
+	"go.uber.org/zap"
+)
+
+// fakeReceiver keeps its consumer so the test can send data through it
+type fakeReceiver struct {
+	consumer pipeline.Consumer
+}
+
+func (r *fakeReceiver) Start(ctx context.Context) error    { return nil }
+func (r *fakeReceiver) Shutdown(ctx context.Context) error { return nil }
+
+type nopExporter struct{}
+
+func (nopExporter) Export(ctx context.Context, batch models.TelemetryBatch) error { return nil }
+
+func newTestService(t *testing.T) (*pipeline.Service, *fakeReceiver) {
+	t.Helper()
+
+	recv := &fakeReceiver{}
+	r := pipeline.NewRegistry()
+	r.RegisterReceiver("recv", pipeline.ReceiverFactory{
+		Signals: []pipeline.Signal{pipeline.Traces},
+		Create: func(set pipeline.Settings, cfg config.ComponentConfig, next pipeline.Consumer) (pipeline.Component, error) {
+			recv.consumer = next
+			return recv, nil
+		},
+	})
+	r.RegisterExporter("nop", pipeline.ExporterFactory{
+		Signals: []pipeline.Signal{pipeline.Traces},
+		Create: func(set pipeline.Settings, cfg config.ComponentConfig) (exporters.Exporter, error) {
+			return nopExporter{}, nil
+		},
+	})
+
+	cfg := &config.Config{Collector: config.CollectorConfig{
+		Buffer:    config.BufferConfig{Policy: "drop_newest", Timeout: time.Hour},
+		Telemetry: config.TelemetryConfig{RecentSpans: 10},
+		Receivers: map[string]config.ComponentConfig{"recv": {}},
+		Exporters: map[string]config.ComponentConfig{"nop": {}},
+		Pipelines: map[string]config.PipelineConfig{
+			"traces/frontend": {Receivers: []string{"recv"}, Exporters: []string{"nop"}},
+		},
+	}}
+
+	s, err := pipeline.New(cfg, r, zap.NewNop())
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+	return s, recv
+}
+
+func get(t *testing.T, h http.Handler, path string) (int, string) {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+	body, _ := io.ReadAll(rec.Result().Body)
+	return rec.Code, string(body)
+}
+
+func TestHealthAndReadiness(t *testing.T) {
+	s, _ := newTestService(t)
+	h := NewHandler(s, zap.NewNop())
+
+	if code, _ := get(t, h, "/healthz"); code != http.StatusOK {
+		t.Errorf("Expected /healthz to return 200, got %d", code)
+	}
+	if code, _ := get(t, h, "/readyz"); code != http.StatusServiceUnavailable {
+		t.Errorf("Expected /readyz to return 503 before start, got %d", code)
+	}
+
+	if err := s.Start(context.Background()); err != nil {
+		t.Fatalf("Start failed: %v", err)
+	}
+	if code, _ := get(t, h, "/readyz"); code != http.StatusOK {
+		t.Errorf("Expected /readyz to return 200 once started, got %d", code)
+	}
+
+	s.Shutdown(context.Background())
+	if code, _ := get(t, h, "/readyz"); code != http.StatusServiceUnavailable {
+		t.Errorf("Expected /readyz to return 503 after shutdown, got %d", code)
+	}
+}
+
+func TestDebugPages(t *testing.T) {
+	s, recv := newTestService(t)
+	h := NewHandler(s, zap.NewNop())
+
+	if err := s.Start(context.Background()); err != nil {
+		t.Fatalf("Start failed: %v", err)
+	}
+	start := time.Now()
+	recv.consumer.ReceiveSpans([]models.Span{{
+		TraceID:    "4bf92f3577b34da6a3ce929d0e0e4736",
+		Name:       "GET /checkout",
+		StartTime:  start,
+		EndTime:    start.Add(42 * time.Millisecond),
+		Attributes: map[string]string{"service.name": "frontend"},
+		Status:     models.SpanStatus{Code: "ERROR"},
+	}})
+	s.Shutdown(context.Background())
+
+	_, body := get(t, h, "/debug/pipelines")
+	for _, want := range []string{"traces/frontend", "recv", "nop"} {
+		if !strings.Contains(body, want) {
+			t.Errorf("Expected /debug/pipelines to mention %q", want)
+		}
+	}
+
+	_, body = get(t, h, "/debug/tracez")
+	for _, want := range []string{"GET /checkout", "frontend", "4bf92f3577b34da6a3ce929d0e0e4736", "42ms", `class="error"`} {
+		if !strings.Contains(body, want) {
+			t.Errorf("Expected /debug/tracez to show %q", want)
+		}
+	}
+
+	if _, body = get(t, h, "/debug/tracez?pipeline=traces/other"); strings.Contains(body, "GET /checkout") {
+		t.Error("Expected the pipeline parameter to filter out other pipelines")
+	}
+
+	_, body = get(t, h, "/metrics")
+	for _, want := range []string{
+		`otelcol_receiver_accepted_items_total{receiver="recv",signal="traces"} 1`,
+		`otelcol_exporter_sent_batches_total{exporter="nop"} 1`,
+		`otelcol_pipeline_items_total{direction="out",pipeline="traces/frontend"} 1`,
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("Expected /metrics to contain %s", want)
+		}
+	}
+}
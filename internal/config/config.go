@@ -3,6 +3,8 @@ package config
 import (
 	"fmt"
 	"os"
+	"strconv"
+	"time"
 
 	"github.com/spf13/viper"
 )
@@ -13,6 +15,10 @@ type Config struct {
 	Jaeger        JaegerConfig        `mapstructure:"jaeger"`
 	Prometheus    PrometheusConfig    `mapstructure:"prometheus"`
 	Elasticsearch ElasticsearchConfig `mapstructure:"elasticsearch"`
+	Storage       StorageConfig       `mapstructure:"storage"`
+	TraceStore    TraceStoreConfig    `mapstructure:"trace_store"`
+	MetricStore   MetricStoreConfig   `mapstructure:"metric_store"`
+	LogStore      LogStoreConfig      `mapstructure:"log_store"`
 	Grafana       GrafanaConfig       `mapstructure:"grafana"`
 	Kibana        KibanaConfig        `mapstructure:"kibana"`
 	Redis         RedisConfig         `mapstructure:"redis"`
@@ -20,6 +26,9 @@ type Config struct {
 	Alerts        AlertsConfig        `mapstructure:"alerts"`
 	CORS          CORSConfig          `mapstructure:"cors"`
 	Logging       LoggingConfig       `mapstructure:"logging"`
+	Service       ServiceConfig       `mapstructure:"service"`
+	Collector     CollectorConfig     `mapstructure:"collector"`
+	Metrics       MetricsConfig       `mapstructure:"metrics"`
 }
 
 type ServerConfig struct {
@@ -43,6 +52,45 @@ type ElasticsearchConfig struct {
 	Index   string `mapstructure:"index"`
 }
 
+// StorageConfig picks the store the API reads each signal from: jaeger,
+// elasticsearch and prometheus respectively, or memory for an empty
+// in-memory store. Each signal can also be read from its embedded store.
+type StorageConfig struct {
+	Traces  string `mapstructure:"traces"`
+	Logs    string `mapstructure:"logs"`
+	Metrics string `mapstructure:"metrics"`
+}
+
+// TraceStoreConfig locates the embedded trace store. Spans are grouped into
+// blocks covering BlockDuration of start times; blocks older than
+// Retention are deleted.
+type TraceStoreConfig struct {
+	Directory     string        `mapstructure:"directory"`
+	BlockDuration time.Duration `mapstructure:"block_duration"`
+	Retention     time.Duration `mapstructure:"retention"`
+	Sync          bool          `mapstructure:"sync"` // fsync after every write
+}
+
+// MetricStoreConfig locates the embedded metric store. Samples are grouped
+// into blocks covering BlockDuration; blocks older than Retention are
+// deleted.
+type MetricStoreConfig struct {
+	Directory     string        `mapstructure:"directory"`
+	BlockDuration time.Duration `mapstructure:"block_duration"`
+	Retention     time.Duration `mapstructure:"retention"`
+	Sync          bool          `mapstructure:"sync"` // fsync after every write
+}
+
+// LogStoreConfig locates the embedded log store. Records are grouped into
+// segments covering SegmentDuration of timestamps; segments older than
+// Retention are deleted.
+type LogStoreConfig struct {
+	Directory       string        `mapstructure:"directory"`
+	SegmentDuration time.Duration `mapstructure:"segment_duration"`
+	Retention       time.Duration `mapstructure:"retention"`
+	Sync            bool          `mapstructure:"sync"` // fsync after every write
+}
+
 type GrafanaConfig struct {
 	URL string `mapstructure:"url"`
 }
@@ -88,12 +136,331 @@ type LoggingConfig struct {
 	Format string `mapstructure:"format"` // json, console
 }
 
-// Load reads configuration from file or environment variables
-func Load() (*Config, error) {
-	viper.SetConfigName("backend-config")
-	viper.SetConfigType("yaml")
-	viper.AddConfigPath("./configs")
-	viper.AddConfigPath(".")
+type MetricsConfig struct {
+	Enabled        bool              `mapstructure:"enabled"`
+	ExportInterval time.Duration     `mapstructure:"export_interval"`
+	Histograms     []HistogramConfig `mapstructure:"histograms"`
+}
+
+type HistogramConfig struct {
+	Name    string    `mapstructure:"name"`
+	Buckets []float64 `mapstructure:"buckets"`
+}
+
+// HistogramBuckets returns the buckets of the named histogram, or nil
+func (m MetricsConfig) HistogramBuckets(name string) []float64 {
+	for _, h := range m.Histograms {
+		if h.Name == name {
+			return h.Buckets
+		}
+	}
+	return nil
+}
+
+type ServiceConfig struct {
+	Name        string `mapstructure:"name"`
+	Version     string `mapstructure:"version"`
+	Environment string `mapstructure:"environment"`
+}
+
+// CollectorConfig declares the collector's components by ID, type[/name],
+// and the pipelines connecting them. Each component's settings are decoded
+// by its type when the pipelines are built.
+type CollectorConfig struct {
+	GRPC          EndpointConfig             `mapstructure:"grpc"` // defaults for otlp receivers
+	HTTP          EndpointConfig             `mapstructure:"http"`
+	Buffer        BufferConfig               `mapstructure:"buffer"`
+	MemoryLimiter MemoryLimiterConfig        `mapstructure:"memory_limiter"`
+	WAL           WALConfig                  `mapstructure:"wal"`
+	Receivers     map[string]ComponentConfig `mapstructure:"receivers"`
+	Processors    map[string]ComponentConfig `mapstructure:"processors"`
+	Connectors    map[string]ComponentConfig `mapstructure:"connectors"`
+	Exporters     map[string]ComponentConfig `mapstructure:"exporters"`
+	Pipelines     map[string]PipelineConfig  `mapstructure:"pipelines"`
+	Telemetry     TelemetryConfig            `mapstructure:"telemetry"`
+}
+
+// TelemetryConfig serves the collector's own metrics, debug pages and
+// health checks on an admin endpoint
+type TelemetryConfig struct {
+	Endpoint    string `mapstructure:"endpoint"`     // empty disables the admin endpoint
+	RecentSpans int    `mapstructure:"recent_spans"` // spans kept per pipeline for /debug/tracez
+}
+
+// ComponentConfig holds a component's settings as read from the file
+type ComponentConfig map[string]interface{}
+
+// Decode decodes the settings into a typed config, converting durations
+// and comma separated lists as Load does
+func (c ComponentConfig) Decode(target interface{}) error {
+	v := viper.New()
+	if err := v.MergeConfigMap(c); err != nil {
+		return err
+	}
+	return v.Unmarshal(target)
+}
+
+// Enabled reports whether the settings have enabled: true
+func (c ComponentConfig) Enabled() bool {
+	switch v := c["enabled"].(type) {
+	case bool:
+		return v
+	case string:
+		enabled, _ := strconv.ParseBool(v)
+		return enabled
+	}
+	return false
+}
+
+// PipelineConfig connects receivers through processors to exporters. The
+// pipeline name, signal[/name], selects the signal: traces, metrics or logs.
+type PipelineConfig struct {
+	Receivers  []string `mapstructure:"receivers"`
+	Processors []string `mapstructure:"processors"` // applied in order; connectors may be listed too
+	Exporters  []string `mapstructure:"exporters"`
+}
+
+// OTLPReceiverConfig serves OTLP over gRPC and HTTP. Empty endpoints fall
+// back to collector.grpc and collector.http.
+type OTLPReceiverConfig struct {
+	GRPC EndpointConfig `mapstructure:"grpc"`
+	HTTP EndpointConfig `mapstructure:"http"`
+}
+
+// ZipkinReceiverConfig serves the Zipkin v2 span API
+type ZipkinReceiverConfig struct {
+	Endpoint string `mapstructure:"endpoint"`
+}
+
+// PrometheusReceiverConfig scrapes Prometheus text-format endpoints. The
+// interval and timeout are defaults for scrape configs that set none.
+type PrometheusReceiverConfig struct {
+	ScrapeInterval time.Duration  `mapstructure:"scrape_interval"`
+	ScrapeTimeout  time.Duration  `mapstructure:"scrape_timeout"`
+	ScrapeConfigs  []ScrapeConfig `mapstructure:"scrape_configs"`
+}
+
+// ScrapeConfig is one job: a set of targets scraped alike, following
+// Prometheus' scrape_config
+type ScrapeConfig struct {
+	JobName              string          `mapstructure:"job_name"`
+	ScrapeInterval       time.Duration   `mapstructure:"scrape_interval"`
+	ScrapeTimeout        time.Duration   `mapstructure:"scrape_timeout"`
+	MetricsPath          string          `mapstructure:"metrics_path"`
+	Scheme               string          `mapstructure:"scheme"`
+	HonorLabels          bool            `mapstructure:"honor_labels"`
+	StaticConfigs        []StaticConfig  `mapstructure:"static_configs"`
+	RelabelConfigs       []RelabelConfig `mapstructure:"relabel_configs"`        // applied to targets
+	MetricRelabelConfigs []RelabelConfig `mapstructure:"metric_relabel_configs"` // applied to scraped samples
+}
+
+// StaticConfig lists targets as host:port, with labels added to each
+type StaticConfig struct {
+	Targets []string          `mapstructure:"targets"`
+	Labels  map[string]string `mapstructure:"labels"`
+}
+
+// RelabelConfig rewrites labels like Prometheus relabeling. Action is
+// replace (the default), keep, drop, labelmap, labeldrop or labelkeep.
+type RelabelConfig struct {
+	SourceLabels []string `mapstructure:"source_labels"`
+	Separator    string   `mapstructure:"separator"`
+	Regex        string   `mapstructure:"regex"`
+	TargetLabel  string   `mapstructure:"target_label"`
+	Replacement  string   `mapstructure:"replacement"`
+	Action       string   `mapstructure:"action"`
+}
+
+// HostMetricsReceiverConfig reads node metrics from /proc. RootPath is
+// where the host's root filesystem is mounted when running in a container.
+// Scrapers picks from cpu, memory, disk, network and load; empty means all.
+type HostMetricsReceiverConfig struct {
+	CollectionInterval time.Duration `mapstructure:"collection_interval"`
+	RootPath           string        `mapstructure:"root_path"`
+	Scrapers           []string      `mapstructure:"scrapers"`
+	HostName           string        `mapstructure:"host_name"` // overrides K8S_NODE_NAME, NODE_NAME and the OS host name
+}
+
+// SyslogReceiverConfig listens for syslog messages over UDP or TCP. Format
+// is rfc5424 or rfc3164; empty detects it per message.
+type SyslogReceiverConfig struct {
+	Protocol string `mapstructure:"protocol"`
+	Endpoint string `mapstructure:"endpoint"`
+	Format   string `mapstructure:"format"`
+}
+
+// FileLogReceiverConfig tails JSON-lines log files. StartAt is beginning or
+// end and applies to files found on the first poll without a checkpoint;
+// files appearing later are read from the beginning. Offsets are kept in
+// CheckpointPath when set.
+type FileLogReceiverConfig struct {
+	Include        []string      `mapstructure:"include"`
+	Exclude        []string      `mapstructure:"exclude"`
+	StartAt        string        `mapstructure:"start_at"`
+	PollInterval   time.Duration `mapstructure:"poll_interval"`
+	CheckpointPath string        `mapstructure:"checkpoint_path"`
+}
+
+// BufferConfig bounds the telemetry held between exports
+type BufferConfig struct {
+	Capacity      SignalCapacity `mapstructure:"capacity"`
+	Policy        string         `mapstructure:"policy"`          // drop_oldest, drop_newest, reject
+	SendBatchSize int            `mapstructure:"send_batch_size"` // flush early once a signal reaches this size
+	Timeout       time.Duration  `mapstructure:"timeout"`         // flush at least this often
+}
+
+// SignalCapacity is the maximum number of buffered items per signal
+type SignalCapacity struct {
+	Spans      int `mapstructure:"spans"`
+	Logs       int `mapstructure:"logs"`
+	Metrics    int `mapstructure:"metrics"`
+	Exceptions int `mapstructure:"exceptions"`
+}
+
+// WALConfig enables the on-disk write-ahead log of received telemetry
+type WALConfig struct {
+	Enabled   bool   `mapstructure:"enabled"`
+	Directory string `mapstructure:"directory"`
+	Sync      bool   `mapstructure:"sync"` // fsync after every append
+}
+
+// FilterConfig drops telemetry selected by boolean expressions, such as
+// span.name == "GET /health" or log.severity < "info"
+type FilterConfig struct {
+	Enabled bool     `mapstructure:"enabled"`
+	Drop    []string `mapstructure:"drop"` // drop items matching any expression
+	Keep    []string `mapstructure:"keep"` // drop items of referenced signals matching none
+}
+
+// RedactionConfig masks or hashes sensitive values in spans, logs and
+// exceptions
+type RedactionConfig struct {
+	Enabled    bool                      `mapstructure:"enabled"`
+	Detectors  []RedactionDetectorConfig `mapstructure:"detectors"`
+	HashKey    string                    `mapstructure:"hash_key"`     // HMAC-SHA256 key, required by the hash action
+	HashKeyEnv string                    `mapstructure:"hash_key_env"` // environment variable holding hash_key
+}
+
+// RedactionDetectorConfig is a built-in detector (credit_card, email, ip,
+// bearer_token) or a regex. Action is mask or hash.
+type RedactionDetectorConfig struct {
+	Name    string `mapstructure:"name"`
+	Type    string `mapstructure:"type"`
+	Pattern string `mapstructure:"pattern"` // regex type only
+	Action  string `mapstructure:"action"`
+}
+
+// ExceptionsConfig extracts exception records from span exception events
+type ExceptionsConfig struct {
+	Enabled bool `mapstructure:"enabled"`
+}
+
+// AttributesConfig applies a chain of attribute actions to spans, logs and
+// metrics selected by include and exclude
+type AttributesConfig struct {
+	Enabled    bool                    `mapstructure:"enabled"`
+	Include    MatchConfig             `mapstructure:"include"`
+	Exclude    MatchConfig             `mapstructure:"exclude"`
+	Actions    []AttributeActionConfig `mapstructure:"actions"`
+	HashKey    string                  `mapstructure:"hash_key"`     // HMAC-SHA256 key, required by the hash action
+	HashKeyEnv string                  `mapstructure:"hash_key_env"` // environment variable holding hash_key
+}
+
+// MatchConfig selects telemetry by service and by span or metric name. An
+// empty list matches everything.
+type MatchConfig struct {
+	MatchType string   `mapstructure:"match_type"` // strict or regexp
+	Services  []string `mapstructure:"services"`
+	Names     []string `mapstructure:"names"`
+}
+
+// AttributeActionConfig is one attribute action. Action is one of insert,
+// update, upsert, delete, hash, rename or extract.
+type AttributeActionConfig struct {
+	Key           string `mapstructure:"key"`
+	Action        string `mapstructure:"action"`
+	Value         string `mapstructure:"value"`
+	FromAttribute string `mapstructure:"from_attribute"` // copy the value of another attribute instead
+	NewKey        string `mapstructure:"new_key"`        // target of rename
+	Pattern       string `mapstructure:"pattern"`        // extract: named groups become attributes
+}
+
+// TailSamplingConfig holds spans per trace for a decision window and keeps
+// the whole trace if any policy samples it
+type TailSamplingConfig struct {
+	Enabled      bool                   `mapstructure:"enabled"`
+	DecisionWait time.Duration          `mapstructure:"decision_wait"`
+	NumTraces    int                    `mapstructure:"num_traces"` // traces held at once
+	Policies     []SamplingPolicyConfig `mapstructure:"policies"`
+}
+
+// SamplingPolicyConfig is one tail sampling policy. Which fields apply
+// depends on Type: status_code, latency, string_attribute, rate_limiting
+// or probabilistic.
+type SamplingPolicyConfig struct {
+	Name               string        `mapstructure:"name"`
+	Type               string        `mapstructure:"type"`
+	Threshold          time.Duration `mapstructure:"threshold"`           // latency
+	Key                string        `mapstructure:"key"`                 // string_attribute
+	Values             []string      `mapstructure:"values"`              // string_attribute
+	TracesPerSecond    int           `mapstructure:"traces_per_second"`   // rate_limiting, per service
+	SamplingPercentage float64       `mapstructure:"sampling_percentage"` // probabilistic
+}
+
+// SpanMetricsConfig derives request, error and duration metrics from spans
+type SpanMetricsConfig struct {
+	Enabled   bool          `mapstructure:"enabled"`
+	Histogram string        `mapstructure:"histogram"`  // name of a metrics.histograms entry providing the buckets
+	Interval  time.Duration `mapstructure:"interval"`   // how often every series is emitted
+	MaxSeries int           `mapstructure:"max_series"` // series tracked before further label sets share one overflow series
+	Expiry    time.Duration `mapstructure:"expiry"`     // series without spans for this long are dropped
+}
+
+// ServiceGraphConfig derives client to server call metrics from parent and
+// child spans of different services
+type ServiceGraphConfig struct {
+	Enabled    bool          `mapstructure:"enabled"`
+	Histogram  string        `mapstructure:"histogram"`   // name of a metrics.histograms entry providing the buckets
+	MaxPending int           `mapstructure:"max_pending"` // spans remembered while waiting for their parent or children
+	Interval   time.Duration `mapstructure:"interval"`    // how often every edge is emitted
+	MaxSeries  int           `mapstructure:"max_series"`  // edges tracked before further calls share one overflow series
+	Expiry     time.Duration `mapstructure:"expiry"`      // edges without calls for this long are dropped
+}
+
+// MemoryLimiterConfig refuses incoming data while the heap is above a limit
+type MemoryLimiterConfig struct {
+	LimitMiB      int           `mapstructure:"limit_mib"` // 0 disables the limiter
+	CheckInterval time.Duration `mapstructure:"check_interval"`
+}
+
+type EndpointConfig struct {
+	Endpoint string `mapstructure:"endpoint"`
+}
+
+type ExporterConfig struct {
+	Enabled        bool     `mapstructure:"enabled"`
+	Endpoint       string   `mapstructure:"endpoint"`
+	Endpoints      []string `mapstructure:"endpoints"`
+	IndexPrefix    string   `mapstructure:"index_prefix"`
+	MaxRetries     int      `mapstructure:"max_retries"`
+	Namespace      string   `mapstructure:"namespace"`
+	RemoteWriteURL string   `mapstructure:"remote_write_url"`
+	QueueSize      int      `mapstructure:"queue_size"`
+	Insecure       bool     `mapstructure:"insecure"`
+}
+
+// Load reads configuration from file or environment variables.
+// If a path is given it is read directly, otherwise backend-config.yaml
+// is looked up in ./configs and the working directory.
+func Load(path ...string) (*Config, error) {
+	if len(path) > 0 && path[0] != "" {
+		viper.SetConfigFile(path[0])
+	} else {
+		viper.SetConfigName("backend-config")
+		viper.SetConfigType("yaml")
+		viper.AddConfigPath("./configs")
+		viper.AddConfigPath(".")
+	}
 
 	// Set defaults
 	setDefaults()
@@ -115,6 +482,7 @@ func Load() (*Config, error) {
 	if err := viper.Unmarshal(&config); err != nil {
 		return nil, fmt.Errorf("unable to decode config: %w", err)
 	}
+	keepEmptyComponents(&config.Collector)
 
 	// Override with environment variables if set
 	if port := os.Getenv("PORT"); port != "" {
@@ -133,6 +501,29 @@ func Load() (*Config, error) {
 	return &config, nil
 }
 
+// keepEmptyComponents restores collector components declared without
+// settings, such as "otlp: {}", which Unmarshal drops
+func keepEmptyComponents(cc *CollectorConfig) {
+	sections := map[string]*map[string]ComponentConfig{
+		"receivers":  &cc.Receivers,
+		"processors": &cc.Processors,
+		"connectors": &cc.Connectors,
+		"exporters":  &cc.Exporters,
+	}
+	for section, components := range sections {
+		declared, _ := viper.Get("collector." + section).(map[string]interface{})
+		for id := range declared {
+			if _, ok := (*components)[id]; ok {
+				continue
+			}
+			if *components == nil {
+				*components = make(map[string]ComponentConfig)
+			}
+			(*components)[id] = ComponentConfig{}
+		}
+	}
+}
+
 func setDefaults() {
 	// Server defaults
 	viper.SetDefault("server.port", 8090)
@@ -149,7 +540,24 @@ func setDefaults() {
 	// Elasticsearch defaults
 	viper.SetDefault("elasticsearch.url", "http://localhost:9200")
 	viper.SetDefault("elasticsearch.timeout", "10s")
-	viper.SetDefault("elasticsearch.index", "logs-*")
+	viper.SetDefault("elasticsearch.index", "logs-*,otel-logs-*")
+
+	// Storage defaults
+	viper.SetDefault("storage.traces", "jaeger")
+	viper.SetDefault("storage.logs", "elasticsearch")
+	viper.SetDefault("storage.metrics", "prometheus")
+	viper.SetDefault("trace_store.directory", "./data/traces")
+	viper.SetDefault("trace_store.block_duration", "1h")
+	viper.SetDefault("trace_store.retention", "72h")
+	viper.SetDefault("trace_store.sync", false)
+	viper.SetDefault("metric_store.directory", "./data/metrics")
+	viper.SetDefault("metric_store.block_duration", "2h")
+	viper.SetDefault("metric_store.retention", "360h")
+	viper.SetDefault("metric_store.sync", false)
+	viper.SetDefault("log_store.directory", "./data/logs")
+	viper.SetDefault("log_store.segment_duration", "1h")
+	viper.SetDefault("log_store.retention", "168h")
+	viper.SetDefault("log_store.sync", false)
 
 	// Grafana defaults
 	viper.SetDefault("grafana.url", "http://localhost:3000")
@@ -180,4 +588,36 @@ func setDefaults() {
 	// Logging defaults
 	viper.SetDefault("logging.level", "info")
 	viper.SetDefault("logging.format", "json")
+
+	// Service defaults
+	viper.SetDefault("service.name", "watchingcat")
+	viper.SetDefault("service.version", "dev")
+	viper.SetDefault("service.environment", "development")
+
+	// Collector defaults
+	viper.SetDefault("collector.grpc.endpoint", "0.0.0.0:4317")
+	viper.SetDefault("collector.http.endpoint", "0.0.0.0:4318")
+	viper.SetDefault("collector.buffer.capacity.spans", 50000)
+	viper.SetDefault("collector.buffer.capacity.logs", 50000)
+	viper.SetDefault("collector.buffer.capacity.metrics", 50000)
+	viper.SetDefault("collector.buffer.capacity.exceptions", 10000)
+	viper.SetDefault("collector.buffer.policy", "drop_oldest")
+	viper.SetDefault("collector.buffer.send_batch_size", 1024)
+	viper.SetDefault("collector.buffer.timeout", "10s")
+	viper.SetDefault("collector.memory_limiter.check_interval", "1s")
+	viper.SetDefault("collector.wal.directory", "data/wal")
+	viper.SetDefault("collector.telemetry.endpoint", "0.0.0.0:8888")
+	viper.SetDefault("collector.telemetry.recent_spans", 100)
+	viper.SetDefault("collector.processors.exceptions.enabled", true)
+	viper.SetDefault("collector.processors.tail_sampling.decision_wait", "10s")
+	viper.SetDefault("collector.processors.tail_sampling.num_traces", 50000)
+	viper.SetDefault("collector.connectors.spanmetrics.histogram", "http_request_duration")
+	viper.SetDefault("collector.connectors.spanmetrics.interval", "15s")
+	viper.SetDefault("collector.connectors.spanmetrics.max_series", 10000)
+	viper.SetDefault("collector.connectors.spanmetrics.expiry", "5m")
+	viper.SetDefault("collector.connectors.servicegraph.histogram", "http_request_duration")
+	viper.SetDefault("collector.connectors.servicegraph.max_pending", 10000)
+	viper.SetDefault("collector.connectors.servicegraph.interval", "15s")
+	viper.SetDefault("collector.connectors.servicegraph.max_series", 10000)
+	viper.SetDefault("collector.connectors.servicegraph.expiry", "5m")
 }
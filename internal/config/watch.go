@@ -0,0 +1,62 @@
+package config
+
+import (
+	"context"
+	"path/filepath"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// watchDebounce groups the several events an editor's save produces into
+// one change
+const watchDebounce = 200 * time.Millisecond
+
+// Watch calls onChange when the config file at path is written or replaced,
+// until ctx is done. The directory is watched rather than the file, so
+// editors that save by renaming and Kubernetes ConfigMaps that swap a
+// symlink are noticed too.
+func Watch(ctx context.Context, path string, onChange func()) error {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return err
+	}
+
+	file := filepath.Clean(path)
+	if err := watcher.Add(filepath.Dir(file)); err != nil {
+		watcher.Close()
+		return err
+	}
+	target, _ := filepath.EvalSymlinks(file)
+
+	go func() {
+		defer watcher.Close()
+
+		var pending <-chan time.Time
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case event, ok := <-watcher.Events:
+				if !ok {
+					return
+				}
+				current, _ := filepath.EvalSymlinks(file)
+				written := filepath.Clean(event.Name) == file && (event.Has(fsnotify.Write) || event.Has(fsnotify.Create))
+				if written || (current != "" && current != target) {
+					target = current
+					pending = time.After(watchDebounce)
+				}
+			case _, ok := <-watcher.Errors:
+				// A dropped event only delays a reload until the next change
+				if !ok {
+					return
+				}
+			case <-pending:
+				pending = nil
+				onChange()
+			}
+		}
+	}()
+	return nil
+}
@@ -35,15 +35,23 @@ type SearchResult struct {
 		Total struct {
 			Value int `json:"value"`
 		} `json:"total"`
-		Hits []struct {
-			ID     string   `json:"_id"`
-			Source LogEntry `json:"_source"`
-		} `json:"hits"`
+		Hits []SearchHit `json:"hits"`
 	} `json:"hits"`
 }
 
-// NewElasticsearchDAO creates a new Elasticsearch DAO
-func NewElasticsearchDAO(url string, logger *zap.Logger) *ElasticsearchDAO {
+// SearchHit is a single log entry in search results
+type SearchHit struct {
+	ID     string   `json:"_id"`
+	Source LogEntry `json:"_source"`
+}
+
+// NewElasticsearchDAO creates a new Elasticsearch DAO searching the given
+// index pattern (defaults to logs-*)
+func NewElasticsearchDAO(url, index string, logger *zap.Logger) *ElasticsearchDAO {
+	if index == "" {
+		index = "logs-*"
+	}
+
 	cfg := elasticsearch.Config{
 		Addresses: []string{url},
 	}
@@ -53,14 +61,14 @@ func NewElasticsearchDAO(url string, logger *zap.Logger) *ElasticsearchDAO {
 		logger.Error("Failed to create Elasticsearch client", zap.Error(err))
 		return &ElasticsearchDAO{
 			client: nil,
-			index:  "logs-*",
+			index:  index,
 			logger: logger,
 		}
 	}
 
 	return &ElasticsearchDAO{
 		client: client,
-		index:  "logs-*",
+		index:  index,
 		logger: logger,
 	}
 }
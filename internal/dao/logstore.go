@@ -0,0 +1,92 @@
+package dao
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/gaurav/watchingcat/internal/logstore"
+)
+
+// logTimestampLayout matches the timestamps the collector indexes into
+// Elasticsearch
+const logTimestampLayout = "2006-01-02T15:04:05.000Z"
+
+// LogStoreReader is a LogReader over the embedded log store. Entries have
+// the shape of the documents the collector indexes into Elasticsearch.
+type LogStoreReader struct {
+	store *logstore.Store
+}
+
+// NewLogStoreReader creates a log reader over store
+func NewLogStoreReader(store *logstore.Store) *LogStoreReader {
+	return &LogStoreReader{store: store}
+}
+
+// Ping checks that the store's directory is accessible
+func (r *LogStoreReader) Ping(ctx context.Context) error {
+	if err := r.store.Ping(); err != nil {
+		return fmt.Errorf("log store unavailable: %w", err)
+	}
+	return nil
+}
+
+// SearchLogs returns a page of matching entries, most recent first, with
+// the total number of matches
+func (r *LogStoreReader) SearchLogs(ctx context.Context, params LogSearchParams) (*SearchResult, error) {
+	found, err := r.store.Search(logstore.Query{
+		Text:    params.Query,
+		Service: params.Service,
+		Level:   params.Level,
+		TraceID: params.TraceID,
+		Start:   params.StartTime,
+		End:     params.EndTime,
+		From:    params.From,
+		Size:    params.Size,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to search logs: %w", err)
+	}
+
+	result := &SearchResult{}
+	result.Hits.Total.Value = found.Total
+	for _, rec := range found.Records {
+		result.Hits.Hits = append(result.Hits.Hits, SearchHit{
+			ID:     rec.ID,
+			Source: logEntryFromStore(rec),
+		})
+	}
+	return result, nil
+}
+
+// GetLogsByTraceID returns the entries of a trace
+func (r *LogStoreReader) GetLogsByTraceID(ctx context.Context, traceID string) ([]LogEntry, error) {
+	result, err := r.SearchLogs(ctx, LogSearchParams{TraceID: traceID, Size: 1000})
+	if err != nil {
+		return nil, err
+	}
+
+	logs := make([]LogEntry, len(result.Hits.Hits))
+	for i, hit := range result.Hits.Hits {
+		logs[i] = hit.Source
+	}
+	return logs, nil
+}
+
+// logEntryFromStore maps a stored record onto the log entry shape
+func logEntryFromStore(rec logstore.Record) LogEntry {
+	entry := LogEntry{
+		Timestamp: rec.Timestamp.UTC().Format(logTimestampLayout),
+		Level:     rec.Severity,
+		Message:   rec.Message,
+		Service:   rec.ServiceName,
+		TraceID:   rec.TraceID,
+		SpanID:    rec.SpanID,
+	}
+	if len(rec.Attributes) > 0 {
+		entry.Attributes = make(map[string]interface{}, len(rec.Attributes))
+		for k, v := range rec.Attributes {
+			entry.Attributes[k] = v
+		}
+	}
+	return entry
+}
@@ -0,0 +1,76 @@
+package dao
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/gaurav/watchingcat/internal/config"
+	"github.com/gaurav/watchingcat/internal/logstore"
+	"github.com/gaurav/watchingcat/pkg/models"
+	"go.uber.org/zap"
+)
+
+func TestLogStoreReader(t *testing.T) {
+	dir := t.TempDir()
+	store, err := logstore.Open(config.LogStoreConfig{Directory: dir}, zap.NewNop())
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	defer store.Close()
+
+	now := time.Now().Truncate(time.Millisecond)
+	err = store.Write([]models.LogRecord{
+		{
+			Timestamp: now.Add(-time.Minute), Severity: "INFO", ServiceName: "checkout",
+			Message: "Order placed", TraceID: "abc", SpanID: "1",
+			Attributes: map[string]string{"order.id": "42"},
+		},
+		{Timestamp: now, Severity: "ERROR", ServiceName: "checkout", Message: "Payment declined", TraceID: "abc"},
+		{Timestamp: now, Severity: "ERROR", ServiceName: "payments", Message: "Card declined"},
+	})
+	if err != nil {
+		t.Fatalf("Write failed: %v", err)
+	}
+
+	cfg := &config.Config{
+		Storage:  config.StorageConfig{Logs: "embedded"},
+		LogStore: config.LogStoreConfig{Directory: dir},
+	}
+	reader, err := NewLogReader(cfg, zap.NewNop())
+	if err != nil {
+		t.Fatalf("NewLogReader failed: %v", err)
+	}
+	ctx := context.Background()
+
+	if err := reader.Ping(ctx); err != nil {
+		t.Errorf("Ping failed: %v", err)
+	}
+
+	result, err := reader.SearchLogs(ctx, LogSearchParams{Query: "declined", Level: "error", Size: 1})
+	if err != nil {
+		t.Fatalf("SearchLogs failed: %v", err)
+	}
+	if result.Hits.Total.Value != 2 || len(result.Hits.Hits) != 1 || result.Hits.Hits[0].ID == "" {
+		t.Fatalf("Expected one of two hits, got %+v", result)
+	}
+
+	result, _ = reader.SearchLogs(ctx, LogSearchParams{Service: "checkout", StartTime: now.Add(-2 * time.Minute), EndTime: now.Add(-time.Second)})
+	if result.Hits.Total.Value != 1 {
+		t.Fatalf("Expected the earlier checkout entry, got %+v", result)
+	}
+	entry := result.Hits.Hits[0].Source
+	if entry.Timestamp != now.Add(-time.Minute).UTC().Format(logTimestampLayout) || entry.Level != "INFO" ||
+		entry.Service != "checkout" || entry.SpanID != "1" || entry.Attributes["order.id"] != "42" {
+		t.Errorf("Unexpected entry %+v", entry)
+	}
+
+	logs, err := reader.GetLogsByTraceID(ctx, "abc")
+	if err != nil || len(logs) != 2 || logs[0].Message != "Payment declined" {
+		t.Errorf("Expected the trace's entries, most recent first, got %+v %v", logs, err)
+	}
+
+	if _, err := reader.SearchLogs(ctx, LogSearchParams{Query: `"unterminated`}); err == nil {
+		t.Error("Expected an invalid query to fail")
+	}
+}
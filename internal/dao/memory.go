@@ -0,0 +1,382 @@
+package dao
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// MemoryTraceReader is a TraceReader over traces held in memory, for tests
+// and for running the API without a trace backend. Searches follow Jaeger:
+// a trace matches when one of its spans meets every condition.
+type MemoryTraceReader struct {
+	mu     sync.RWMutex
+	traces []Trace
+	err    error
+}
+
+// NewMemoryTraceReader creates a trace reader holding traces
+func NewMemoryTraceReader(traces ...Trace) *MemoryTraceReader {
+	return &MemoryTraceReader{traces: traces}
+}
+
+// Add stores more traces
+func (m *MemoryTraceReader) Add(traces ...Trace) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.traces = append(m.traces, traces...)
+}
+
+// SetError makes every call fail with err, or succeed again when nil
+func (m *MemoryTraceReader) SetError(err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.err = err
+}
+
+// Ping reports the configured error
+func (m *MemoryTraceReader) Ping(ctx context.Context) error {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.err
+}
+
+// GetTrace returns the trace with traceID
+func (m *MemoryTraceReader) GetTrace(ctx context.Context, traceID string) (*Trace, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	if m.err != nil {
+		return nil, m.err
+	}
+
+	for _, t := range m.traces {
+		if strings.EqualFold(t.TraceID, traceID) {
+			trace := t
+			return &trace, nil
+		}
+	}
+	return nil, fmt.Errorf("trace %s not found", traceID)
+}
+
+// SearchTraces returns matching traces, most recent first
+func (m *MemoryTraceReader) SearchTraces(ctx context.Context, params SearchParams) ([]Trace, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	if m.err != nil {
+		return nil, m.err
+	}
+
+	var minDuration, maxDuration time.Duration
+	var err error
+	if params.MinDuration != "" {
+		if minDuration, err = time.ParseDuration(params.MinDuration); err != nil {
+			return nil, fmt.Errorf("invalid minDuration: %w", err)
+		}
+	}
+	if params.MaxDuration != "" {
+		if maxDuration, err = time.ParseDuration(params.MaxDuration); err != nil {
+			return nil, fmt.Errorf("invalid maxDuration: %w", err)
+		}
+	}
+
+	matches := func(t Trace, s Span) bool {
+		duration := time.Duration(s.Duration) * time.Microsecond
+		switch {
+		case params.ServiceName != "" && t.Processes[s.ProcessID].ServiceName != params.ServiceName,
+			params.Operation != "" && s.OperationName != params.Operation,
+			minDuration > 0 && duration < minDuration,
+			maxDuration > 0 && duration > maxDuration,
+			params.Start != 0 && s.StartTime < params.Start,
+			params.End != 0 && s.StartTime > params.End:
+			return false
+		}
+		for k, v := range params.Tags {
+			if !hasTag(s.Tags, k, v) {
+				return false
+			}
+		}
+		return true
+	}
+
+	var traces []Trace
+	for _, t := range m.traces {
+		for _, s := range t.Spans {
+			if matches(t, s) {
+				traces = append(traces, t)
+				break
+			}
+		}
+	}
+
+	sort.SliceStable(traces, func(i, j int) bool {
+		return traceStart(traces[i]) > traceStart(traces[j])
+	})
+	if params.Limit > 0 && len(traces) > params.Limit {
+		traces = traces[:params.Limit]
+	}
+	return traces, nil
+}
+
+// GetServices returns the services of all spans, sorted
+func (m *MemoryTraceReader) GetServices(ctx context.Context) ([]string, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	if m.err != nil {
+		return nil, m.err
+	}
+
+	seen := make(map[string]bool)
+	for _, t := range m.traces {
+		for _, s := range t.Spans {
+			if service := t.Processes[s.ProcessID].ServiceName; service != "" {
+				seen[service] = true
+			}
+		}
+	}
+	return sortedKeys(seen), nil
+}
+
+// GetOperations returns the operations of a service's spans, sorted
+func (m *MemoryTraceReader) GetOperations(ctx context.Context, serviceName string) ([]string, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	if m.err != nil {
+		return nil, m.err
+	}
+
+	seen := make(map[string]bool)
+	for _, t := range m.traces {
+		for _, s := range t.Spans {
+			if t.Processes[s.ProcessID].ServiceName == serviceName {
+				seen[s.OperationName] = true
+			}
+		}
+	}
+	return sortedKeys(seen), nil
+}
+
+func hasTag(tags []Tag, key, value string) bool {
+	for _, tag := range tags {
+		if tag.Key == key && fmt.Sprint(tag.Value) == value {
+			return true
+		}
+	}
+	return false
+}
+
+// traceStart returns the earliest span start of a trace
+func traceStart(t Trace) int64 {
+	var start int64
+	for i, s := range t.Spans {
+		if i == 0 || s.StartTime < start {
+			start = s.StartTime
+		}
+	}
+	return start
+}
+
+// MemoryLogReader is a LogReader over log entries held in memory, for tests
+// and for running the API without a log backend. The query matches
+// messages case-insensitively.
+type MemoryLogReader struct {
+	mu      sync.RWMutex
+	entries []LogEntry
+	err     error
+}
+
+// NewMemoryLogReader creates a log reader holding entries
+func NewMemoryLogReader(entries ...LogEntry) *MemoryLogReader {
+	return &MemoryLogReader{entries: entries}
+}
+
+// Add stores more log entries
+func (m *MemoryLogReader) Add(entries ...LogEntry) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.entries = append(m.entries, entries...)
+}
+
+// SetError makes every call fail with err, or succeed again when nil
+func (m *MemoryLogReader) SetError(err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.err = err
+}
+
+// Ping reports the configured error
+func (m *MemoryLogReader) Ping(ctx context.Context) error {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.err
+}
+
+// SearchLogs returns a page of matching entries, most recent first, with
+// the total number of matches
+func (m *MemoryLogReader) SearchLogs(ctx context.Context, params LogSearchParams) (*SearchResult, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	if m.err != nil {
+		return nil, m.err
+	}
+
+	query := strings.ToLower(params.Query)
+	var matched []LogEntry
+	for _, e := range m.entries {
+		ts, _ := time.Parse(time.RFC3339Nano, e.Timestamp)
+		switch {
+		case params.Service != "" && !strings.EqualFold(e.Service, params.Service),
+			params.Level != "" && !strings.EqualFold(e.Level, params.Level),
+			params.TraceID != "" && e.TraceID != params.TraceID,
+			!params.StartTime.IsZero() && ts.Before(params.StartTime),
+			!params.EndTime.IsZero() && ts.After(params.EndTime),
+			query != "" && !strings.Contains(strings.ToLower(e.Message), query):
+			continue
+		}
+		matched = append(matched, e)
+	}
+
+	// RFC 3339 timestamps in UTC sort as strings
+	sort.SliceStable(matched, func(i, j int) bool {
+		return matched[i].Timestamp > matched[j].Timestamp
+	})
+
+	result := &SearchResult{}
+	result.Hits.Total.Value = len(matched)
+	for i := params.From; i < len(matched) && (params.Size <= 0 || i < params.From+params.Size); i++ {
+		result.Hits.Hits = append(result.Hits.Hits, SearchHit{
+			ID:     fmt.Sprint(i),
+			Source: matched[i],
+		})
+	}
+	return result, nil
+}
+
+// GetLogsByTraceID returns the entries of a trace
+func (m *MemoryLogReader) GetLogsByTraceID(ctx context.Context, traceID string) ([]LogEntry, error) {
+	result, err := m.SearchLogs(ctx, LogSearchParams{TraceID: traceID, Size: 1000})
+	if err != nil {
+		return nil, err
+	}
+
+	logs := make([]LogEntry, len(result.Hits.Hits))
+	for i, hit := range result.Hits.Hits {
+		logs[i] = hit.Source
+	}
+	return logs, nil
+}
+
+// MemoryMetricReader is a MetricReader answering queries with canned
+// results, for tests and for running the API without a metrics backend.
+// Queries without a result return an empty one; labels come from the
+// series added.
+type MemoryMetricReader struct {
+	mu      sync.RWMutex
+	results map[string]*QueryResult
+	series  []map[string]string
+	err     error
+}
+
+// NewMemoryMetricReader creates a metric reader with no results
+func NewMemoryMetricReader() *MemoryMetricReader {
+	return &MemoryMetricReader{results: make(map[string]*QueryResult)}
+}
+
+// SetResult makes query return result, for both instant and range queries
+func (m *MemoryMetricReader) SetResult(query string, result *QueryResult) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.results[query] = result
+}
+
+// AddSeries stores label sets for GetLabels and GetLabelValues
+func (m *MemoryMetricReader) AddSeries(series ...map[string]string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.series = append(m.series, series...)
+}
+
+// SetError makes every call fail with err, or succeed again when nil
+func (m *MemoryMetricReader) SetError(err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.err = err
+}
+
+// Ping reports the configured error
+func (m *MemoryMetricReader) Ping(ctx context.Context) error {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.err
+}
+
+// Query returns the result set for query, or an empty vector
+func (m *MemoryMetricReader) Query(ctx context.Context, query string, timestamp time.Time) (*QueryResult, error) {
+	return m.result(query, "vector")
+}
+
+// QueryRange returns the result set for query, or an empty matrix
+func (m *MemoryMetricReader) QueryRange(ctx context.Context, query string, start, end time.Time, step time.Duration) (*QueryResult, error) {
+	return m.result(query, "matrix")
+}
+
+func (m *MemoryMetricReader) result(query, resultType string) (*QueryResult, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	if m.err != nil {
+		return nil, m.err
+	}
+
+	if result, ok := m.results[query]; ok {
+		return result, nil
+	}
+	result := &QueryResult{Status: "success"}
+	result.Data.ResultType = resultType
+	result.Data.Result = []MetricResult{}
+	return result, nil
+}
+
+// GetLabels returns the label names of all series, sorted
+func (m *MemoryMetricReader) GetLabels(ctx context.Context) ([]string, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	if m.err != nil {
+		return nil, m.err
+	}
+
+	seen := make(map[string]bool)
+	for _, s := range m.series {
+		for name := range s {
+			seen[name] = true
+		}
+	}
+	return sortedKeys(seen), nil
+}
+
+// GetLabelValues returns the values of a label across series, sorted
+func (m *MemoryMetricReader) GetLabelValues(ctx context.Context, label string) ([]string, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	if m.err != nil {
+		return nil, m.err
+	}
+
+	seen := make(map[string]bool)
+	for _, s := range m.series {
+		if v, ok := s[label]; ok {
+			seen[v] = true
+		}
+	}
+	return sortedKeys(seen), nil
+}
+
+func sortedKeys(set map[string]bool) []string {
+	keys := make([]string, 0, len(set))
+	for k := range set {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,96 @@
+package dao
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/gaurav/watchingcat/internal/config"
+	"go.uber.org/zap"
+)
+
+func TestNewReaders(t *testing.T) {
+	cfg := &config.Config{}
+	if r, err := NewTraceReader(cfg, zap.NewNop()); err != nil || r.(*JaegerDAO) == nil {
+		t.Errorf("Expected Jaeger by default, got %T %v", r, err)
+	}
+
+	cfg.Storage = config.StorageConfig{Traces: "memory", Logs: "memory", Metrics: "memory"}
+	if r, _ := NewTraceReader(cfg, zap.NewNop()); r == nil {
+		t.Error("Expected an in-memory trace reader")
+	}
+	if r, _ := NewLogReader(cfg, zap.NewNop()); r == nil {
+		t.Error("Expected an in-memory log reader")
+	}
+	if r, _ := NewMetricReader(cfg, zap.NewNop()); r == nil {
+		t.Error("Expected an in-memory metric reader")
+	}
+
+	cfg.Storage.Logs = "loki"
+	if _, err := NewLogReader(cfg, zap.NewNop()); err == nil {
+		t.Error("Expected an unknown store to be rejected")
+	}
+}
+
+func TestMemorySearchTraces(t *testing.T) {
+	reader := NewMemoryTraceReader(
+		Trace{
+			TraceID: "old",
+			Spans: []Span{
+				{SpanID: "a", OperationName: "GET /", StartTime: 100, Duration: 1000, ProcessID: "p1"},
+				{SpanID: "b", OperationName: "query", StartTime: 200, Duration: 900000, ProcessID: "p2"},
+			},
+			Processes: map[string]Process{"p1": {ServiceName: "web"}, "p2": {ServiceName: "db"}},
+		},
+		Trace{
+			TraceID:   "new",
+			Spans:     []Span{{SpanID: "c", OperationName: "GET /", StartTime: 500, Duration: 2000, ProcessID: "p1"}},
+			Processes: map[string]Process{"p1": {ServiceName: "web"}},
+		},
+	)
+	ctx := context.Background()
+
+	traces, err := reader.SearchTraces(ctx, SearchParams{ServiceName: "web"})
+	if err != nil || len(traces) != 2 || traces[0].TraceID != "new" {
+		t.Fatalf("Expected both traces newest first, got %v %v", traces, err)
+	}
+
+	// A single span has to satisfy every condition
+	traces, _ = reader.SearchTraces(ctx, SearchParams{ServiceName: "web", MinDuration: "100ms"})
+	if len(traces) != 0 {
+		t.Errorf("Expected the slow db span not to qualify web, got %d traces", len(traces))
+	}
+
+	traces, _ = reader.SearchTraces(ctx, SearchParams{ServiceName: "web", Limit: 1})
+	if len(traces) != 1 {
+		t.Errorf("Expected the limit to apply, got %d traces", len(traces))
+	}
+
+	if _, err := reader.SearchTraces(ctx, SearchParams{MinDuration: "soon"}); err == nil {
+		t.Error("Expected an invalid duration to fail")
+	}
+}
+
+func TestMemorySearchLogs(t *testing.T) {
+	reader := NewMemoryLogReader(
+		LogEntry{Timestamp: "2024-01-02T10:00:00Z", Level: "INFO", Message: "Started", Service: "web"},
+		LogEntry{Timestamp: "2024-01-02T11:00:00Z", Level: "error", Message: "Connection refused", Service: "web"},
+		LogEntry{Timestamp: "2024-01-02T12:00:00Z", Level: "error", Message: "connection reset", Service: "db"},
+	)
+	ctx := context.Background()
+
+	result, err := reader.SearchLogs(ctx, LogSearchParams{Query: "CONNECTION", Size: 10})
+	if err != nil || result.Hits.Total.Value != 2 || result.Hits.Hits[0].Source.Service != "db" {
+		t.Fatalf("Expected two case-insensitive matches newest first, got %+v %v", result, err)
+	}
+
+	result, _ = reader.SearchLogs(ctx, LogSearchParams{Level: "info", Size: 10})
+	if result.Hits.Total.Value != 1 {
+		t.Errorf("Expected the level to match case-insensitively, got %d", result.Hits.Total.Value)
+	}
+
+	result, _ = reader.SearchLogs(ctx, LogSearchParams{StartTime: time.Date(2024, 1, 2, 10, 30, 0, 0, time.UTC), From: 1, Size: 10})
+	if result.Hits.Total.Value != 2 || len(result.Hits.Hits) != 1 || result.Hits.Hits[0].Source.Service != "web" {
+		t.Errorf("Expected the second page of the time range, got %+v", result.Hits)
+	}
+}
@@ -0,0 +1,90 @@
+package dao
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/gaurav/watchingcat/internal/metricstore"
+)
+
+// MetricStoreReader is a MetricReader over the embedded metric store.
+// Results have the shape of Prometheus' query API; a scalar result is
+// returned as a vector with one unlabelled element.
+type MetricStoreReader struct {
+	store *metricstore.Store
+}
+
+// NewMetricStoreReader creates a metric reader over store
+func NewMetricStoreReader(store *metricstore.Store) *MetricStoreReader {
+	return &MetricStoreReader{store: store}
+}
+
+// Ping checks that the store's directory is accessible
+func (r *MetricStoreReader) Ping(ctx context.Context) error {
+	if err := r.store.Ping(); err != nil {
+		return fmt.Errorf("metric store unavailable: %w", err)
+	}
+	return nil
+}
+
+// Query evaluates an instant query, at the current time if timestamp is zero
+func (r *MetricStoreReader) Query(ctx context.Context, query string, timestamp time.Time) (*QueryResult, error) {
+	if timestamp.IsZero() {
+		timestamp = time.Now()
+	}
+	result, err := r.store.Query(query, timestamp)
+	if err != nil {
+		return nil, fmt.Errorf("failed to execute query: %w", err)
+	}
+	return queryResultFromStore(result), nil
+}
+
+// QueryRange evaluates a range query
+func (r *MetricStoreReader) QueryRange(ctx context.Context, query string, start, end time.Time, step time.Duration) (*QueryResult, error) {
+	result, err := r.store.QueryRange(query, start, end, step)
+	if err != nil {
+		return nil, fmt.Errorf("failed to execute range query: %w", err)
+	}
+	return queryResultFromStore(result), nil
+}
+
+// GetLabels returns all label names, sorted
+func (r *MetricStoreReader) GetLabels(ctx context.Context) ([]string, error) {
+	return r.store.LabelNames(), nil
+}
+
+// GetLabelValues returns the values of a label, sorted
+func (r *MetricStoreReader) GetLabelValues(ctx context.Context, label string) ([]string, error) {
+	return r.store.LabelValues(label), nil
+}
+
+// queryResultFromStore converts a store result to Prometheus' shape, where
+// a sample is a [seconds, "value"] pair
+func queryResultFromStore(result *metricstore.Result) *QueryResult {
+	out := &QueryResult{Status: "success"}
+	out.Data.ResultType = string(result.Type)
+	if result.Type == metricstore.ValueScalar {
+		out.Data.ResultType = string(metricstore.ValueVector)
+	}
+	out.Data.Result = make([]MetricResult, 0, len(result.Series))
+
+	for _, s := range result.Series {
+		mr := MetricResult{Metric: s.Labels.Map()}
+		if result.Type == metricstore.ValueMatrix {
+			mr.Values = make([][]interface{}, len(s.Samples))
+			for i, sample := range s.Samples {
+				mr.Values[i] = promSample(sample)
+			}
+		} else if len(s.Samples) > 0 {
+			mr.Value = promSample(s.Samples[0])
+		}
+		out.Data.Result = append(out.Data.Result, mr)
+	}
+	return out
+}
+
+func promSample(s metricstore.Sample) []interface{} {
+	return []interface{}{float64(s.T) / 1000, strconv.FormatFloat(s.V, 'f', -1, 64)}
+}
@@ -0,0 +1,72 @@
+package dao
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/gaurav/watchingcat/internal/config"
+	"github.com/gaurav/watchingcat/internal/metricstore"
+	"go.uber.org/zap"
+)
+
+func TestMetricStoreReader(t *testing.T) {
+	dir := t.TempDir()
+	store, err := metricstore.Open(config.MetricStoreConfig{Directory: dir}, zap.NewNop())
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	defer store.Close()
+
+	now := time.Now().Truncate(time.Second)
+	labels := metricstore.FromMap(map[string]string{metricstore.MetricName: "up", "service_name": "web"})
+	err = store.Write([]metricstore.Series{{
+		Labels:  labels,
+		Samples: []metricstore.Sample{{T: now.Add(-time.Minute).UnixMilli(), V: 1}, {T: now.UnixMilli(), V: 0.5}},
+	}})
+	if err != nil {
+		t.Fatalf("Write failed: %v", err)
+	}
+
+	cfg := &config.Config{
+		Storage:     config.StorageConfig{Metrics: "embedded"},
+		MetricStore: config.MetricStoreConfig{Directory: dir},
+	}
+	reader, err := NewMetricReader(cfg, zap.NewNop())
+	if err != nil {
+		t.Fatalf("NewMetricReader failed: %v", err)
+	}
+	ctx := context.Background()
+
+	result, err := reader.Query(ctx, `up`, now)
+	if err != nil {
+		t.Fatalf("Query failed: %v", err)
+	}
+	if result.Status != "success" || result.Data.ResultType != "vector" || len(result.Data.Result) != 1 {
+		t.Fatalf("Unexpected result %+v", result)
+	}
+	mr := result.Data.Result[0]
+	if mr.Metric["service_name"] != "web" || mr.Value[0] != float64(now.Unix()) || mr.Value[1] != "0.5" {
+		t.Errorf("Unexpected sample %+v", mr)
+	}
+
+	result, err = reader.QueryRange(ctx, `up`, now.Add(-time.Minute), now, time.Minute)
+	if err != nil || result.Data.ResultType != "matrix" || len(result.Data.Result) != 1 || len(result.Data.Result[0].Values) != 2 {
+		t.Errorf("Expected a matrix with two points, got %+v %v", result, err)
+	}
+
+	result, err = reader.Query(ctx, `1`, now)
+	if err != nil || result.Data.ResultType != "vector" || len(result.Data.Result) != 1 || len(result.Data.Result[0].Metric) != 0 {
+		t.Errorf("Expected a scalar as an unlabelled vector, got %+v %v", result, err)
+	}
+
+	if _, err := reader.Query(ctx, `up[`, now); err == nil {
+		t.Error("Expected an invalid query to fail")
+	}
+	if names, _ := reader.GetLabels(ctx); len(names) != 2 {
+		t.Errorf("Unexpected labels %v", names)
+	}
+	if values, _ := reader.GetLabelValues(ctx, "service_name"); len(values) != 1 || values[0] != "web" {
+		t.Errorf("Unexpected label values %v", values)
+	}
+}
@@ -0,0 +1,103 @@
+package dao
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/gaurav/watchingcat/internal/config"
+	"github.com/gaurav/watchingcat/internal/logstore"
+	"github.com/gaurav/watchingcat/internal/metricstore"
+	"github.com/gaurav/watchingcat/internal/tracestore"
+	"go.uber.org/zap"
+)
+
+// TraceReader reads traces and the services and operations seen in them
+type TraceReader interface {
+	Ping(ctx context.Context) error
+	GetTrace(ctx context.Context, traceID string) (*Trace, error)
+	SearchTraces(ctx context.Context, params SearchParams) ([]Trace, error)
+	GetServices(ctx context.Context) ([]string, error)
+	GetOperations(ctx context.Context, serviceName string) ([]string, error)
+}
+
+// LogReader searches logs
+type LogReader interface {
+	Ping(ctx context.Context) error
+	SearchLogs(ctx context.Context, params LogSearchParams) (*SearchResult, error)
+	GetLogsByTraceID(ctx context.Context, traceID string) ([]LogEntry, error)
+}
+
+// MetricReader evaluates PromQL queries and lists labels
+type MetricReader interface {
+	Ping(ctx context.Context) error
+	Query(ctx context.Context, query string, timestamp time.Time) (*QueryResult, error)
+	QueryRange(ctx context.Context, query string, start, end time.Time, step time.Duration) (*QueryResult, error)
+	GetLabels(ctx context.Context) ([]string, error)
+	GetLabelValues(ctx context.Context, label string) ([]string, error)
+}
+
+var (
+	_ TraceReader  = (*JaegerDAO)(nil)
+	_ LogReader    = (*ElasticsearchDAO)(nil)
+	_ MetricReader = (*PrometheusDAO)(nil)
+
+	_ TraceReader  = (*TraceStoreReader)(nil)
+	_ LogReader    = (*LogStoreReader)(nil)
+	_ MetricReader = (*MetricStoreReader)(nil)
+
+	_ TraceReader  = (*MemoryTraceReader)(nil)
+	_ LogReader    = (*MemoryLogReader)(nil)
+	_ MetricReader = (*MemoryMetricReader)(nil)
+)
+
+// NewTraceReader creates the trace reader selected by storage.traces
+func NewTraceReader(cfg *config.Config, logger *zap.Logger) (TraceReader, error) {
+	switch cfg.Storage.Traces {
+	case "", "jaeger":
+		return NewJaegerDAO(cfg.Jaeger.URL, logger), nil
+	case "embedded":
+		store, err := tracestore.OpenReader(cfg.TraceStore, logger)
+		if err != nil {
+			return nil, err
+		}
+		return NewTraceStoreReader(store), nil
+	case "memory":
+		return NewMemoryTraceReader(), nil
+	}
+	return nil, fmt.Errorf("unknown trace storage %q", cfg.Storage.Traces)
+}
+
+// NewLogReader creates the log reader selected by storage.logs
+func NewLogReader(cfg *config.Config, logger *zap.Logger) (LogReader, error) {
+	switch cfg.Storage.Logs {
+	case "", "elasticsearch":
+		return NewElasticsearchDAO(cfg.Elasticsearch.URL, cfg.Elasticsearch.Index, logger), nil
+	case "embedded":
+		store, err := logstore.OpenReader(cfg.LogStore, logger)
+		if err != nil {
+			return nil, err
+		}
+		return NewLogStoreReader(store), nil
+	case "memory":
+		return NewMemoryLogReader(), nil
+	}
+	return nil, fmt.Errorf("unknown log storage %q", cfg.Storage.Logs)
+}
+
+// NewMetricReader creates the metric reader selected by storage.metrics
+func NewMetricReader(cfg *config.Config, logger *zap.Logger) (MetricReader, error) {
+	switch cfg.Storage.Metrics {
+	case "", "prometheus":
+		return NewPrometheusDAO(cfg.Prometheus.URL, logger), nil
+	case "embedded":
+		store, err := metricstore.OpenReader(cfg.MetricStore, logger)
+		if err != nil {
+			return nil, err
+		}
+		return NewMetricStoreReader(store), nil
+	case "memory":
+		return NewMemoryMetricReader(), nil
+	}
+	return nil, fmt.Errorf("unknown metric storage %q", cfg.Storage.Metrics)
+}
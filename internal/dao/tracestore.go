@@ -0,0 +1,187 @@
+package dao
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gaurav/watchingcat/internal/tracestore"
+	"github.com/gaurav/watchingcat/pkg/models"
+)
+
+// TraceStoreReader is a TraceReader over the embedded trace store. Spans
+// are returned in the shape Jaeger's API uses, with one process per
+// service.
+type TraceStoreReader struct {
+	store *tracestore.Store
+}
+
+// NewTraceStoreReader creates a trace reader over store
+func NewTraceStoreReader(store *tracestore.Store) *TraceStoreReader {
+	return &TraceStoreReader{store: store}
+}
+
+// Ping checks that the store's directory is accessible
+func (r *TraceStoreReader) Ping(ctx context.Context) error {
+	if err := r.store.Ping(); err != nil {
+		return fmt.Errorf("trace store unavailable: %w", err)
+	}
+	return nil
+}
+
+// GetTrace returns the trace with traceID
+func (r *TraceStoreReader) GetTrace(ctx context.Context, traceID string) (*Trace, error) {
+	t, err := r.store.GetTrace(strings.ToLower(traceID))
+	if errors.Is(err, tracestore.ErrTraceNotFound) {
+		return nil, fmt.Errorf("trace %s not found", traceID)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read trace: %w", err)
+	}
+
+	trace := traceFromStore(t)
+	return &trace, nil
+}
+
+// SearchTraces returns matching traces, most recent first
+func (r *TraceStoreReader) SearchTraces(ctx context.Context, params SearchParams) ([]Trace, error) {
+	q := tracestore.Query{
+		Service:   params.ServiceName,
+		Operation: params.Operation,
+		Tags:      params.Tags,
+		Limit:     params.Limit,
+	}
+
+	var err error
+	if params.MinDuration != "" {
+		if q.MinDuration, err = time.ParseDuration(params.MinDuration); err != nil {
+			return nil, fmt.Errorf("invalid minDuration: %w", err)
+		}
+	}
+	if params.MaxDuration != "" {
+		if q.MaxDuration, err = time.ParseDuration(params.MaxDuration); err != nil {
+			return nil, fmt.Errorf("invalid maxDuration: %w", err)
+		}
+	}
+	if params.Start != 0 {
+		q.Start = time.UnixMicro(params.Start)
+	}
+	if params.End != 0 {
+		q.End = time.UnixMicro(params.End)
+	}
+
+	found, err := r.store.FindTraces(q)
+	if err != nil {
+		return nil, fmt.Errorf("failed to search traces: %w", err)
+	}
+
+	traces := make([]Trace, len(found))
+	for i, t := range found {
+		traces[i] = traceFromStore(t)
+	}
+	return traces, nil
+}
+
+// GetServices returns the services of all stored spans, sorted
+func (r *TraceStoreReader) GetServices(ctx context.Context) ([]string, error) {
+	return r.store.Services(), nil
+}
+
+// GetOperations returns the operations of a service's spans, sorted
+func (r *TraceStoreReader) GetOperations(ctx context.Context, serviceName string) ([]string, error) {
+	return r.store.Operations(serviceName), nil
+}
+
+// traceFromStore converts stored spans to a Jaeger-shaped trace. Span
+// attributes become tags, except service.name which names the process.
+func traceFromStore(t tracestore.Trace) Trace {
+	trace := Trace{
+		TraceID:   t.ID,
+		Spans:     make([]Span, 0, len(t.Spans)),
+		Processes: make(map[string]Process),
+	}
+
+	processIDs := make(map[string]string)
+	for _, s := range t.Spans {
+		service := s.Attributes["service.name"]
+		processID, ok := processIDs[service]
+		if !ok {
+			processID = fmt.Sprintf("p%d", len(processIDs)+1)
+			processIDs[service] = processID
+			trace.Processes[processID] = Process{ServiceName: service, Tags: []Tag{}}
+		}
+
+		span := Span{
+			TraceID:       s.TraceID,
+			SpanID:        s.SpanID,
+			OperationName: s.Name,
+			References:    []Reference{},
+			StartTime:     s.StartTime.UnixMicro(),
+			Duration:      s.EndTime.Sub(s.StartTime).Microseconds(),
+			Tags:          spanTags(s),
+			Logs:          make([]Log, 0, len(s.Events)),
+			ProcessID:     processID,
+		}
+		if s.ParentID != "" {
+			span.References = append(span.References, Reference{
+				RefType: "CHILD_OF",
+				TraceID: s.TraceID,
+				SpanID:  s.ParentID,
+			})
+		}
+		for _, e := range s.Events {
+			fields := append([]Tag{stringTag("event", e.Name)}, stringTags(e.Attributes, "")...)
+			span.Logs = append(span.Logs, Log{Timestamp: e.Timestamp.UnixMicro(), Fields: fields})
+		}
+		trace.Spans = append(trace.Spans, span)
+	}
+	return trace
+}
+
+// spanTags returns a span's attributes as tags, plus the kind and status
+// tags Jaeger adds where the attributes do not set them
+func spanTags(s models.Span) []Tag {
+	tags := stringTags(s.Attributes, "service.name")
+	derive := func(tag Tag) {
+		if _, ok := s.Attributes[tag.Key]; !ok {
+			tags = append(tags, tag)
+		}
+	}
+	if s.Kind != "" {
+		derive(stringTag("span.kind", s.Kind))
+	}
+	if s.Status.Code != "" {
+		derive(stringTag("otel.status_code", s.Status.Code))
+	}
+	if s.Status.Code == "ERROR" {
+		derive(Tag{Key: "error", Type: "bool", Value: true})
+	}
+	if s.Status.Message != "" {
+		derive(stringTag("otel.status_description", s.Status.Message))
+	}
+	return tags
+}
+
+// stringTags converts attributes to tags sorted by key, leaving out skip
+func stringTags(attrs map[string]string, skip string) []Tag {
+	keys := make([]string, 0, len(attrs))
+	for k := range attrs {
+		if k != skip {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+
+	tags := make([]Tag, len(keys))
+	for i, k := range keys {
+		tags[i] = stringTag(k, attrs[k])
+	}
+	return tags
+}
+
+func stringTag(key, value string) Tag {
+	return Tag{Key: key, Type: "string", Value: value}
+}
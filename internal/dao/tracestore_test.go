@@ -0,0 +1,100 @@
+package dao
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/gaurav/watchingcat/internal/config"
+	"github.com/gaurav/watchingcat/internal/tracestore"
+	"github.com/gaurav/watchingcat/pkg/models"
+	"go.uber.org/zap"
+)
+
+func TestTraceStoreReader(t *testing.T) {
+	dir := t.TempDir()
+	store, err := tracestore.Open(config.TraceStoreConfig{Directory: dir}, zap.NewNop())
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	defer store.Close()
+
+	start := time.Now().Truncate(time.Microsecond)
+	err = store.Write([]models.Span{
+		{
+			TraceID: "abc", SpanID: "1", Name: "GET /", Kind: "server",
+			StartTime: start, EndTime: start.Add(20 * time.Millisecond),
+			Attributes: map[string]string{"service.name": "web", "http.method": "GET"},
+			Status:     models.SpanStatus{Code: "ERROR"},
+		},
+		{
+			TraceID: "abc", SpanID: "2", ParentID: "1", Name: "query", Kind: "client",
+			StartTime: start.Add(time.Millisecond), EndTime: start.Add(5 * time.Millisecond),
+			Attributes: map[string]string{"service.name": "db"},
+			Events:     []models.SpanEvent{{Name: "retry", Timestamp: start.Add(2 * time.Millisecond)}},
+		},
+	})
+	if err != nil {
+		t.Fatalf("Write failed: %v", err)
+	}
+
+	cfg := &config.Config{
+		Storage:    config.StorageConfig{Traces: "embedded"},
+		TraceStore: config.TraceStoreConfig{Directory: dir},
+	}
+	reader, err := NewTraceReader(cfg, zap.NewNop())
+	if err != nil {
+		t.Fatalf("NewTraceReader failed: %v", err)
+	}
+	ctx := context.Background()
+
+	trace, err := reader.GetTrace(ctx, "ABC")
+	if err != nil {
+		t.Fatalf("GetTrace failed: %v", err)
+	}
+	if len(trace.Spans) != 2 || len(trace.Processes) != 2 {
+		t.Fatalf("Expected two spans from two processes, got %+v", trace)
+	}
+	root, child := trace.Spans[0], trace.Spans[1]
+	if trace.Processes[root.ProcessID].ServiceName != "web" || root.Duration != 20000 || root.StartTime != start.UnixMicro() {
+		t.Errorf("Unexpected root span %+v", root)
+	}
+	if !hasTag(root.Tags, "http.method", "GET") || !hasTag(root.Tags, "span.kind", "server") || !hasTag(root.Tags, "error", "true") {
+		t.Errorf("Expected attribute, kind and error tags, got %+v", root.Tags)
+	}
+	if hasTag(root.Tags, "service.name", "web") {
+		t.Error("Expected service.name to name the process rather than be a tag")
+	}
+	if len(child.References) != 1 || child.References[0].SpanID != "1" || len(child.Logs) != 1 {
+		t.Errorf("Expected a parent reference and an event log, got %+v", child)
+	}
+
+	if _, err := reader.GetTrace(ctx, "missing"); err == nil {
+		t.Error("Expected an unknown trace to fail")
+	}
+
+	traces, err := reader.SearchTraces(ctx, SearchParams{ServiceName: "web", MinDuration: "10ms", Tags: map[string]string{"error": "true"}})
+	if err != nil || len(traces) != 1 {
+		t.Errorf("Expected one match, got %v %v", traces, err)
+	}
+	traces, _ = reader.SearchTraces(ctx, SearchParams{ServiceName: "db", MinDuration: "10ms"})
+	if len(traces) != 0 {
+		t.Errorf("Expected no match, got %v", traces)
+	}
+	traces, _ = reader.SearchTraces(ctx, SearchParams{Start: start.Add(time.Second).UnixMicro()})
+	if len(traces) != 0 {
+		t.Errorf("Expected the start bound to exclude the trace, got %v", traces)
+	}
+	if _, err := reader.SearchTraces(ctx, SearchParams{MinDuration: "soon"}); err == nil {
+		t.Error("Expected an invalid duration to be rejected")
+	}
+
+	services, _ := reader.GetServices(ctx)
+	if len(services) != 2 || services[0] != "db" {
+		t.Errorf("Unexpected services %v", services)
+	}
+	operations, _ := reader.GetOperations(ctx, "db")
+	if len(operations) != 1 || operations[0] != "query" {
+		t.Errorf("Unexpected operations %v", operations)
+	}
+}
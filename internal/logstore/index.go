@@ -0,0 +1,156 @@
+package logstore
+
+import (
+	"strings"
+	"unicode"
+)
+
+const (
+	servicePrefix = "service:"
+	levelPrefix   = "level:"
+	tracePrefix   = "trace:"
+	attrPrefix    = "attr:"
+	textPrefix    = "text:"
+)
+
+// index is the inverted index of a set of records, addressed by position.
+// Service, level, trace ID and attribute terms match a field exactly,
+// ignoring case; text terms are the words of the message and attribute
+// values.
+type index struct {
+	IDs   []string `json:"ids"`
+	Times []int64  `json:"times"` // Unix nanoseconds
+	// Postings maps a term to the ascending positions of the records
+	// containing it
+	Postings map[string][]int `json:"postings"`
+}
+
+func newIndex() index {
+	return index{Postings: make(map[string][]int)}
+}
+
+// add indexes a record at the next position
+func (x *index) add(r Record) {
+	pos := len(x.IDs)
+	x.IDs = append(x.IDs, r.ID)
+	x.Times = append(x.Times, r.Timestamp.UnixNano())
+	for term := range recordTerms(r) {
+		x.Postings[term] = append(x.Postings[term], pos)
+	}
+}
+
+func serviceTerm(service string) string {
+	return servicePrefix + strings.ToLower(service)
+}
+
+func levelTerm(level string) string {
+	return levelPrefix + strings.ToLower(level)
+}
+
+func traceTerm(traceID string) string {
+	return tracePrefix + strings.ToLower(traceID)
+}
+
+func attrTerm(key, value string) string {
+	return attrPrefix + key + "\x00" + strings.ToLower(value)
+}
+
+func textTerm(word string) string {
+	return textPrefix + word
+}
+
+// recordTerms returns the distinct terms of a record
+func recordTerms(r Record) map[string]bool {
+	terms := map[string]bool{
+		serviceTerm(r.ServiceName): true,
+		levelTerm(r.Severity):      true,
+	}
+	if r.TraceID != "" {
+		terms[traceTerm(r.TraceID)] = true
+	}
+	for k, v := range r.Attributes {
+		terms[attrTerm(k, v)] = true
+	}
+	for _, words := range recordText(r) {
+		for _, w := range words {
+			terms[textTerm(w)] = true
+		}
+	}
+	return terms
+}
+
+// recordText returns the words of the message and of each attribute value
+func recordText(r Record) [][]string {
+	text := make([][]string, 0, len(r.Attributes)+1)
+	text = append(text, tokenize(r.Message))
+	for _, v := range r.Attributes {
+		text = append(text, tokenize(v))
+	}
+	return text
+}
+
+// tokenize splits text into lower-case words of letters and digits
+func tokenize(text string) []string {
+	return strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
+
+// intersect returns the positions present in both ascending lists
+func intersect(a, b []int) []int {
+	var out []int
+	for i, j := 0, 0; i < len(a) && j < len(b); {
+		switch {
+		case a[i] < b[j]:
+			i++
+		case a[i] > b[j]:
+			j++
+		default:
+			out = append(out, a[i])
+			i++
+			j++
+		}
+	}
+	return out
+}
+
+// subtract returns the positions in a that are not in b, both ascending
+func subtract(a, b []int) []int {
+	var out []int
+	j := 0
+	for _, p := range a {
+		for j < len(b) && b[j] < p {
+			j++
+		}
+		if j < len(b) && b[j] == p {
+			continue
+		}
+		out = append(out, p)
+	}
+	return out
+}
+
+// union merges ascending lists into one without duplicates
+func union(lists ...[]int) []int {
+	var out []int
+	for _, list := range lists {
+		merged := make([]int, 0, len(out)+len(list))
+		i, j := 0, 0
+		for i < len(out) || j < len(list) {
+			switch {
+			case j == len(list) || i < len(out) && out[i] < list[j]:
+				merged = append(merged, out[i])
+				i++
+			case i == len(out) || list[j] < out[i]:
+				merged = append(merged, list[j])
+				j++
+			default:
+				merged = append(merged, out[i])
+				i++
+				j++
+			}
+		}
+		out = merged
+	}
+	return out
+}
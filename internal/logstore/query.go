@@ -0,0 +1,277 @@
+package logstore
+
+import (
+	"fmt"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// Query selects the records meeting every condition. Zero fields are not
+// checked. Matches are ordered most recent first; From skips that many and
+// a positive Size limits how many are returned.
+//
+// Text is a search in a subset of Lucene's query syntax, where every clause
+// must match and case is ignored:
+//
+//	word       a word of the message or of an attribute value
+//	wor*       a word starting with wor
+//	"a b"      words appearing together and in order
+//	key:value  service, level, trace_id or an attribute equal to value
+//	-clause    records the clause does not match
+type Query struct {
+	Text    string
+	Service string
+	Level   string
+	TraceID string
+	Start   time.Time
+	End     time.Time
+	From    int
+	Size    int
+}
+
+// Result is a page of matching records and the total number of matches
+type Result struct {
+	Total   int
+	Records []Record
+}
+
+// clause is one condition of a query. Exactly one of term, words and
+// prefix is set.
+type clause struct {
+	negate bool
+	term   string   // a field term
+	words  []string // words that must all appear, together if more than one
+	prefix string   // the start of a word
+}
+
+// phrase reports whether the clause has to be checked against records
+func (c clause) phrase() bool {
+	return len(c.words) > 1
+}
+
+// matcher is a compiled query
+type matcher struct {
+	clauses    []clause
+	start, end int64 // Unix nanoseconds; zero is unbounded
+	phrases    bool
+}
+
+func compile(q Query) (*matcher, error) {
+	clauses, err := parseText(q.Text)
+	if err != nil {
+		return nil, err
+	}
+	if q.Service != "" {
+		clauses = append(clauses, clause{term: serviceTerm(q.Service)})
+	}
+	if q.Level != "" {
+		clauses = append(clauses, clause{term: levelTerm(q.Level)})
+	}
+	if q.TraceID != "" {
+		clauses = append(clauses, clause{term: traceTerm(q.TraceID)})
+	}
+
+	m := &matcher{clauses: clauses}
+	if !q.Start.IsZero() {
+		m.start = q.Start.UnixNano()
+	}
+	if !q.End.IsZero() {
+		m.end = q.End.UnixNano()
+	}
+	for _, c := range clauses {
+		if c.phrase() {
+			m.phrases = true
+		}
+	}
+	return m, nil
+}
+
+// parseText splits a search into clauses
+func parseText(text string) ([]clause, error) {
+	var clauses []clause
+	runes := []rune(text)
+
+	for i := 0; i < len(runes); {
+		if unicode.IsSpace(runes[i]) {
+			i++
+			continue
+		}
+
+		negate := false
+		if runes[i] == '-' {
+			negate = true
+			i++
+		}
+
+		// A token runs to the next space outside quotes
+		start, quoted := i, false
+		for ; i < len(runes) && (quoted || !unicode.IsSpace(runes[i])); i++ {
+			if runes[i] == '"' {
+				quoted = !quoted
+			}
+		}
+		if quoted {
+			return nil, fmt.Errorf("unterminated quote at %d", start)
+		}
+
+		c, ok, err := parseClause(string(runes[start:i]))
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			c.negate = negate
+			clauses = append(clauses, c)
+		}
+	}
+	return clauses, nil
+}
+
+// parseClause parses one token of a search. Tokens without words, such as
+// a lone *, match everything and are dropped.
+func parseClause(token string) (clause, bool, error) {
+	if strings.HasPrefix(token, `"`) {
+		words := tokenize(strings.Trim(token, `"`))
+		return clause{words: words}, len(words) > 0, nil
+	}
+
+	if key, value, ok := strings.Cut(token, ":"); ok && key != "" && value != "" {
+		value = strings.Trim(value, `"`)
+		switch strings.ToLower(key) {
+		case "service":
+			return clause{term: serviceTerm(value)}, true, nil
+		case "level":
+			return clause{term: levelTerm(value)}, true, nil
+		case "trace_id":
+			return clause{term: traceTerm(value)}, true, nil
+		}
+		return clause{term: attrTerm(key, value)}, true, nil
+	}
+
+	if prefix, ok := strings.CutSuffix(token, "*"); ok {
+		words := tokenize(prefix)
+		switch {
+		case len(words) == 0:
+			return clause{}, false, nil
+		case len(words) > 1 || words[0] != strings.ToLower(prefix):
+			return clause{}, false, fmt.Errorf("unsupported wildcard %q", token)
+		}
+		return clause{prefix: words[0]}, true, nil
+	}
+
+	words := tokenize(token)
+	return clause{words: words}, len(words) > 0, nil
+}
+
+// candidates returns the ascending positions in x of the records matching
+// the query according to the index. Phrases are only matched word by word;
+// when the query has any, candidates still have to be verified.
+func (m *matcher) candidates(x *index) []int {
+	var positions []int
+	first := true
+	for _, c := range m.clauses {
+		if c.negate {
+			continue
+		}
+		postings := c.postings(x)
+		if first {
+			positions, first = postings, false
+		} else {
+			positions = intersect(positions, postings)
+		}
+		if len(positions) == 0 {
+			return nil
+		}
+	}
+	if first {
+		positions = make([]int, len(x.IDs))
+		for i := range positions {
+			positions[i] = i
+		}
+	}
+
+	for _, c := range m.clauses {
+		if c.negate && !c.phrase() {
+			positions = subtract(positions, c.postings(x))
+		}
+	}
+
+	if m.start == 0 && m.end == 0 {
+		return positions
+	}
+	var out []int
+	for _, p := range positions {
+		if m.inRange(x.Times[p]) {
+			out = append(out, p)
+		}
+	}
+	return out
+}
+
+// postings returns the positions of the records containing the clause's
+// term or all of its words
+func (c clause) postings(x *index) []int {
+	switch {
+	case c.term != "":
+		return x.Postings[c.term]
+	case c.prefix != "":
+		var lists [][]int
+		for term, postings := range x.Postings {
+			if strings.HasPrefix(term, textPrefix+c.prefix) {
+				lists = append(lists, postings)
+			}
+		}
+		return union(lists...)
+	}
+
+	var positions []int
+	for i, w := range c.words {
+		if i == 0 {
+			positions = x.Postings[textTerm(w)]
+		} else {
+			positions = intersect(positions, x.Postings[textTerm(w)])
+		}
+	}
+	return positions
+}
+
+// inRange reports whether a timestamp falls in the query's time range
+func (m *matcher) inRange(t int64) bool {
+	return (m.start == 0 || t >= m.start) && (m.end == 0 || t <= m.end)
+}
+
+// overlaps reports whether any of the time range from min to max falls in
+// the query's
+func (m *matcher) overlaps(min, max int64) bool {
+	return (m.start == 0 || max >= m.start) && (m.end == 0 || min <= m.end)
+}
+
+// verify checks a candidate record against the query's phrases
+func (m *matcher) verify(r Record) bool {
+	if !m.phrases {
+		return true
+	}
+	text := recordText(r)
+	for _, c := range m.clauses {
+		if c.phrase() && containsPhrase(text, c.words) == c.negate {
+			return false
+		}
+	}
+	return true
+}
+
+// containsPhrase reports whether any of the word lists holds the phrase
+func containsPhrase(text [][]string, phrase []string) bool {
+	for _, words := range text {
+	next:
+		for i := 0; i+len(phrase) <= len(words); i++ {
+			for j, w := range phrase {
+				if words[i+j] != w {
+					continue next
+				}
+			}
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,200 @@
+package logstore
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/gaurav/watchingcat/internal/windowstore"
+)
+
+const (
+	dataFile  = "data"
+	indexFile = "index"
+
+	// pageSize is the number of records compressed together
+	pageSize = 256
+)
+
+// segment is an immutable set of records on disk, ordered by timestamp. The
+// data file holds pages of pageSize records, each a gzip member containing
+// the records as JSON. The gzipped JSON index holds every record's ID,
+// timestamp and terms, so searches only decompress the pages holding the
+// records returned or the phrases checked.
+type segment struct {
+	dir   string
+	index segmentIndex
+}
+
+type segmentIndex struct {
+	MinTime int64       `json:"min_time"` // Unix nanoseconds
+	MaxTime int64       `json:"max_time"`
+	Pages   []pageEntry `json:"pages"`
+	Records index       `json:"records"`
+}
+
+// pageEntry locates a page in the data file
+type pageEntry struct {
+	Offset int64 `json:"offset"`
+	Length int64 `json:"length"`
+}
+
+// MaxTime returns the timestamp of the segment's latest record
+func (s *segment) MaxTime() time.Time {
+	return time.Unix(0, s.index.MaxTime)
+}
+
+// writeSegment writes records to a new segment directory. The segment is
+// built under a temporary name and renamed into place once complete.
+func writeSegment(dir string, records []Record) (*segment, error) {
+	tmp := dir + windowstore.TmpExt
+	if err := os.MkdirAll(tmp, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create segment: %w", err)
+	}
+	defer os.RemoveAll(tmp)
+
+	sorted := append([]Record(nil), records...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].Timestamp.Before(sorted[j].Timestamp)
+	})
+
+	var data bytes.Buffer
+	index := segmentIndex{Records: newIndex()}
+	for start := 0; start < len(sorted); start += pageSize {
+		page := sorted[start:min(start+pageSize, len(sorted))]
+
+		entry := pageEntry{Offset: int64(data.Len())}
+		zw := gzip.NewWriter(&data)
+		if err := json.NewEncoder(zw).Encode(page); err != nil {
+			return nil, fmt.Errorf("failed to encode records: %w", err)
+		}
+		if err := zw.Close(); err != nil {
+			return nil, fmt.Errorf("failed to compress records: %w", err)
+		}
+		entry.Length = int64(data.Len()) - entry.Offset
+		index.Pages = append(index.Pages, entry)
+
+		for _, r := range page {
+			index.Records.add(r)
+		}
+	}
+	if len(sorted) > 0 {
+		index.MinTime = sorted[0].Timestamp.UnixNano()
+		index.MaxTime = sorted[len(sorted)-1].Timestamp.UnixNano()
+	}
+
+	if err := writeFile(filepath.Join(tmp, dataFile), data.Bytes()); err != nil {
+		return nil, err
+	}
+
+	var encoded bytes.Buffer
+	zw := gzip.NewWriter(&encoded)
+	if err := json.NewEncoder(zw).Encode(index); err != nil {
+		return nil, fmt.Errorf("failed to encode segment index: %w", err)
+	}
+	if err := zw.Close(); err != nil {
+		return nil, fmt.Errorf("failed to compress segment index: %w", err)
+	}
+	if err := writeFile(filepath.Join(tmp, indexFile), encoded.Bytes()); err != nil {
+		return nil, err
+	}
+
+	if err := os.Rename(tmp, dir); err != nil {
+		return nil, fmt.Errorf("failed to commit segment: %w", err)
+	}
+	return &segment{dir: dir, index: index}, nil
+}
+
+// writeFile writes and syncs a segment file
+func writeFile(path string, data []byte) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("failed to create %s: %w", path, err)
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return fmt.Errorf("failed to write %s: %w", path, err)
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return fmt.Errorf("failed to sync %s: %w", path, err)
+	}
+	return f.Close()
+}
+
+// openSegment loads a segment's index
+func openSegment(dir string) (*segment, error) {
+	f, err := os.Open(filepath.Join(dir, indexFile))
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	zr, err := gzip.NewReader(f)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read segment index: %w", err)
+	}
+	var index segmentIndex
+	if err := json.NewDecoder(zr).Decode(&index); err != nil {
+		return nil, fmt.Errorf("failed to decode segment index: %w", err)
+	}
+	if index.Records.Postings == nil {
+		index.Records.Postings = make(map[string][]int)
+	}
+	return &segment{dir: dir, index: index}, nil
+}
+
+// records reads the records at the given positions, decompressing each page
+// once
+func (s *segment) records(positions []int) ([]Record, error) {
+	if len(positions) == 0 {
+		return nil, nil
+	}
+
+	f, err := os.Open(filepath.Join(s.dir, dataFile))
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	pages := make(map[int][]Record)
+	out := make([]Record, len(positions))
+	for i, pos := range positions {
+		n := pos / pageSize
+		page, ok := pages[n]
+		if !ok {
+			if page, err = s.readPage(f, n); err != nil {
+				return nil, err
+			}
+			pages[n] = page
+		}
+		if pos%pageSize >= len(page) {
+			return nil, fmt.Errorf("segment %s is missing record %d", s.dir, pos)
+		}
+		out[i] = page[pos%pageSize]
+	}
+	return out, nil
+}
+
+func (s *segment) readPage(f *os.File, n int) ([]Record, error) {
+	if n >= len(s.index.Pages) {
+		return nil, fmt.Errorf("segment %s is missing page %d", s.dir, n)
+	}
+	entry := s.index.Pages[n]
+
+	zr, err := gzip.NewReader(io.NewSectionReader(f, entry.Offset, entry.Length))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read page %d: %w", n, err)
+	}
+	var page []Record
+	if err := json.NewDecoder(zr).Decode(&page); err != nil {
+		return nil, fmt.Errorf("failed to decode page %d: %w", n, err)
+	}
+	return page, nil
+}
@@ -0,0 +1,289 @@
+// Package logstore is an embedded log store. Records are grouped into
+// windows by timestamp. Open windows are kept in memory and logged to disk;
+// once a window has ended it is written out as a compressed segment with an
+// inverted index over its words and fields. One process writes to a store
+// directory while others may open it read-only.
+package logstore
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/fs"
+	"sort"
+	"time"
+
+	"github.com/gaurav/watchingcat/internal/config"
+	"github.com/gaurav/watchingcat/internal/windowstore"
+	"github.com/gaurav/watchingcat/pkg/models"
+	"go.uber.org/zap"
+)
+
+const (
+	defaultSegmentDuration = time.Hour
+	defaultRetention       = 7 * 24 * time.Hour
+
+	// lateRecordGrace keeps a window open for late records after it ends
+	lateRecordGrace = 5 * time.Minute
+)
+
+var errReadOnly = errors.New("log store is read-only")
+
+// Record is a log record with the ID the store gave it
+type Record struct {
+	ID string `json:"id"`
+	models.LogRecord
+}
+
+// Store holds logs in a directory on disk
+type Store struct {
+	segmentDuration time.Duration
+	retention       time.Duration
+	sync            bool
+	store           *windowstore.Store[Record, *head, *segment]
+}
+
+// head is a window of records not yet written to a segment
+type head struct {
+	start   time.Time
+	records []Record
+	index   index
+}
+
+func newHead(start time.Time) *head {
+	return &head{start: start, index: newIndex()}
+}
+
+func (h *head) Add(records []Record) int {
+	for _, r := range records {
+		h.records = append(h.records, r)
+		h.index.add(r)
+	}
+	return 0
+}
+
+func (h *head) Len() int {
+	return len(h.records)
+}
+
+var format = windowstore.Format[Record, *head, *segment]{
+	NewHead: newHead,
+	WritePart: func(dir string, h *head) (*segment, error) {
+		return writeSegment(dir, h.records)
+	},
+	OpenPart: openSegment,
+}
+
+// Open opens the store for writing, creating its directory if needed and
+// recovering the windows logged by a previous run
+func Open(cfg config.LogStoreConfig, logger *zap.Logger) (*Store, error) {
+	s := newStore(cfg)
+	store, err := windowstore.Open(s.config(cfg.Directory), format, logger)
+	if err != nil {
+		return nil, err
+	}
+	s.store = store
+	return s, nil
+}
+
+// OpenReader opens the store read-only. Segments and records written by
+// the writing process are picked up as searches arrive.
+func OpenReader(cfg config.LogStoreConfig, logger *zap.Logger) (*Store, error) {
+	s := newStore(cfg)
+	store, err := windowstore.OpenReader(s.config(cfg.Directory), format, logger)
+	if err != nil {
+		return nil, err
+	}
+	s.store = store
+	return s, nil
+}
+
+func newStore(cfg config.LogStoreConfig) *Store {
+	segmentDuration := cfg.SegmentDuration
+	if segmentDuration <= 0 {
+		segmentDuration = defaultSegmentDuration
+	}
+	retention := cfg.Retention
+	if retention <= 0 {
+		retention = defaultRetention
+	}
+	return &Store{segmentDuration: segmentDuration, retention: retention, sync: cfg.Sync}
+}
+
+func (s *Store) config(dir string) windowstore.Config {
+	return windowstore.Config{
+		Name:      "log store",
+		Part:      "segment",
+		Directory: dir,
+		Window:    s.segmentDuration,
+		Grace:     lateRecordGrace,
+		Retention: s.retention,
+		Sync:      s.sync,
+	}
+}
+
+// Write adds log records to the store, stamping records without a
+// timestamp with the current time. Records older than the retention period
+// are dropped.
+func (s *Store) Write(logs []models.LogRecord) error {
+	if s.store.ReadOnly() {
+		return errReadOnly
+	}
+
+	now := time.Now()
+	cutoff := now.Add(-s.retention)
+	windows := make(map[int64][]Record)
+	for _, log := range logs {
+		if log.Timestamp.IsZero() {
+			log.Timestamp = now
+		}
+		if log.Timestamp.Before(cutoff) {
+			continue
+		}
+		id, err := newID()
+		if err != nil {
+			return err
+		}
+		start := log.Timestamp.Truncate(s.segmentDuration).Unix()
+		windows[start] = append(windows[start], Record{ID: id, LogRecord: log})
+	}
+
+	return s.store.Write(windows)
+}
+
+// newID returns a random record ID
+func newID() (string, error) {
+	var b [8]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return "", fmt.Errorf("failed to generate record ID: %w", err)
+	}
+	return hex.EncodeToString(b[:]), nil
+}
+
+// Close stops background maintenance and closes the logs of open windows,
+// which are recovered when the store is next opened
+func (s *Store) Close() error {
+	return s.store.Close()
+}
+
+// Ping checks that the store's directory is accessible
+func (s *Store) Ping() error {
+	return s.store.Ping()
+}
+
+// hit is a matching record, either held by an open window or at a position
+// in a segment
+type hit struct {
+	time    int64
+	id      string
+	record  *Record
+	segment *segment
+	pos     int
+}
+
+// Search returns a page of the records matching the query, most recent
+// first, and the total number of matches. Candidates come from the indexes
+// of open windows and segments; only phrases are checked against the
+// records themselves.
+func (s *Store) Search(q Query) (Result, error) {
+	m, err := compile(q)
+	if err != nil {
+		return Result{}, err
+	}
+
+	var result Result
+	err = s.store.View(func(heads []*head, segments []*segment) (err error) {
+		result, err = searchParts(m, q, heads, segments)
+		return err
+	})
+	return result, err
+}
+
+// searchParts returns a page of the matching records held by heads and
+// segments
+func searchParts(m *matcher, q Query, heads []*head, segments []*segment) (Result, error) {
+	var hits []hit
+	seen := make(map[string]bool)
+	collect := func(h hit) {
+		if !seen[h.id] {
+			seen[h.id] = true
+			hits = append(hits, h)
+		}
+	}
+
+	for _, h := range heads {
+		for _, pos := range m.candidates(&h.index) {
+			r := &h.records[pos]
+			if m.verify(*r) {
+				collect(hit{time: h.index.Times[pos], id: r.ID, record: r})
+			}
+		}
+	}
+	for _, seg := range segments {
+		if !m.overlaps(seg.index.MinTime, seg.index.MaxTime) {
+			continue
+		}
+		positions := m.candidates(&seg.index.Records)
+		if m.phrases {
+			records, err := seg.records(positions)
+			if errors.Is(err, fs.ErrNotExist) {
+				// Deleted by retention since the segment was listed
+				continue
+			}
+			if err != nil {
+				return Result{}, err
+			}
+			var verified []int
+			for i, r := range records {
+				if m.verify(r) {
+					verified = append(verified, positions[i])
+				}
+			}
+			positions = verified
+		}
+		for _, pos := range positions {
+			collect(hit{time: seg.index.Records.Times[pos], id: seg.index.Records.IDs[pos], segment: seg, pos: pos})
+		}
+	}
+
+	sort.Slice(hits, func(i, j int) bool {
+		if hits[i].time != hits[j].time {
+			return hits[i].time > hits[j].time
+		}
+		return hits[i].id < hits[j].id
+	})
+
+	result := Result{Total: len(hits)}
+	if q.From >= len(hits) {
+		return result, nil
+	}
+	page := hits[max(q.From, 0):]
+	if q.Size > 0 && len(page) > q.Size {
+		page = page[:q.Size]
+	}
+
+	result.Records = make([]Record, len(page))
+	bySegment := make(map[*segment][]int)
+	for i, h := range page {
+		if h.record != nil {
+			result.Records[i] = *h.record
+		} else {
+			bySegment[h.segment] = append(bySegment[h.segment], i)
+		}
+	}
+	for seg, indexes := range bySegment {
+		positions := make([]int, len(indexes))
+		for j, i := range indexes {
+			positions[j] = page[i].pos
+		}
+		records, err := seg.records(positions)
+		if err != nil {
+			return Result{}, err
+		}
+		for j, i := range indexes {
+			result.Records[i] = records[j]
+		}
+	}
+	return result, nil
+}
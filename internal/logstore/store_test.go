@@ -0,0 +1,295 @@
+package logstore
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/gaurav/watchingcat/internal/config"
+	"github.com/gaurav/watchingcat/pkg/models"
+	"go.uber.org/zap"
+)
+
+func openTestStore(t *testing.T, dir string) *Store {
+	t.Helper()
+	s, err := Open(config.LogStoreConfig{Directory: dir}, zap.NewNop())
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	t.Cleanup(func() { s.Close() })
+	return s
+}
+
+// testLogs returns records a second apart ending at end
+func testLogs(end time.Time) []models.LogRecord {
+	logs := []models.LogRecord{
+		{Severity: "INFO", ServiceName: "checkout", Message: "Order placed", TraceID: "aaa", Attributes: map[string]string{"order.id": "42"}},
+		{Severity: "ERROR", ServiceName: "checkout", Message: "Payment declined by card issuer", TraceID: "aaa"},
+		{Severity: "WARN", ServiceName: "payments", Message: "Card issuer slow to respond", TraceID: "bbb"},
+		{Severity: "ERROR", ServiceName: "payments", Message: "Connection timeout talking to issuer", Attributes: map[string]string{"peer": "issuer-api"}},
+		{Severity: "info", ServiceName: "frontend", Message: "GET /cart declined-items"},
+	}
+	for i := range logs {
+		logs[i].Timestamp = end.Add(time.Duration(i-len(logs)+1) * time.Second)
+	}
+	return logs
+}
+
+func messages(result Result) []string {
+	var out []string
+	for _, r := range result.Records {
+		out = append(out, r.Message)
+	}
+	return out
+}
+
+// searcher is a store, or a segment searched on its own
+type searcher interface {
+	Search(q Query) (Result, error)
+}
+
+type segmentSearcher struct{ seg *segment }
+
+func (s segmentSearcher) Search(q Query) (Result, error) {
+	m, err := compile(q)
+	if err != nil {
+		return Result{}, err
+	}
+	return searchParts(m, q, nil, []*segment{s.seg})
+}
+
+func search(t *testing.T, s searcher, q Query) Result {
+	t.Helper()
+	result, err := s.Search(q)
+	if err != nil {
+		t.Fatalf("Search %+v failed: %v", q, err)
+	}
+	return result
+}
+
+func TestParseText(t *testing.T) {
+	clauses, err := parseText(`timeout -"card issuer" conn* service:Web peer:"issuer api" *`)
+	if err != nil {
+		t.Fatalf("parseText failed: %v", err)
+	}
+	if len(clauses) != 5 {
+		t.Fatalf("Expected 5 clauses, got %+v", clauses)
+	}
+	if clauses[0].words[0] != "timeout" || !clauses[1].negate || len(clauses[1].words) != 2 {
+		t.Errorf("Unexpected word clauses %+v", clauses[:2])
+	}
+	if clauses[2].prefix != "conn" || clauses[3].term != serviceTerm("web") || clauses[4].term != attrTerm("peer", "issuer api") {
+		t.Errorf("Unexpected clauses %+v", clauses[2:])
+	}
+
+	for _, text := range []string{`"card issuer`, `ca-rd*`} {
+		if _, err := parseText(text); err == nil {
+			t.Errorf("Expected %q to be rejected", text)
+		}
+	}
+}
+
+func TestStoreSearch(t *testing.T) {
+	s := openTestStore(t, t.TempDir())
+	now := time.Now()
+	if err := s.Write(testLogs(now)); err != nil {
+		t.Fatalf("Write failed: %v", err)
+	}
+	testSearch(t, s, now)
+}
+
+// testSearch runs the same searches against open windows and segments
+func testSearch(t *testing.T, s searcher, now time.Time) {
+	t.Helper()
+
+	result := search(t, s, Query{})
+	if result.Total != 5 || result.Records[0].Message != "GET /cart declined-items" || result.Records[0].ID == "" {
+		t.Fatalf("Expected all records, most recent first, got %+v", result)
+	}
+
+	for _, tc := range []struct {
+		query Query
+		want  []string
+	}{
+		{Query{Level: "error"}, []string{"Connection timeout talking to issuer", "Payment declined by card issuer"}},
+		{Query{Service: "Payments", Level: "WARN"}, []string{"Card issuer slow to respond"}},
+		{Query{TraceID: "AAA"}, []string{"Payment declined by card issuer", "Order placed"}},
+		{Query{Text: "declined"}, []string{"GET /cart declined-items", "Payment declined by card issuer"}},
+		{Query{Text: "ISSUER card"}, []string{"Card issuer slow to respond", "Payment declined by card issuer"}},
+		{Query{Text: `"card issuer"`}, []string{"Card issuer slow to respond", "Payment declined by card issuer"}},
+		{Query{Text: `"issuer card"`}, nil},
+		{Query{Text: `issuer -"by card"`}, []string{"Connection timeout talking to issuer", "Card issuer slow to respond"}},
+		{Query{Text: "issuer -level:error"}, []string{"Card issuer slow to respond"}},
+		{Query{Text: "conn*"}, []string{"Connection timeout talking to issuer"}},
+		{Query{Text: "peer:Issuer-API"}, []string{"Connection timeout talking to issuer"}},
+		{Query{Text: "42"}, []string{"Order placed"}},
+		{Query{Text: "service:checkout trace_id:aaa order"}, []string{"Order placed"}},
+		{Query{Text: "nothing"}, nil},
+		{Query{Start: now.Add(-2 * time.Second), End: now.Add(-time.Second)}, []string{"Connection timeout talking to issuer", "Card issuer slow to respond"}},
+		{Query{Start: now.Add(time.Second)}, nil},
+	} {
+		got := messages(search(t, s, tc.query))
+		if fmt.Sprint(got) != fmt.Sprint(tc.want) {
+			t.Errorf("Search %+v: expected %q, got %q", tc.query, tc.want, got)
+		}
+	}
+
+	result = search(t, s, Query{From: 1, Size: 2})
+	if result.Total != 5 || fmt.Sprint(messages(result)) != fmt.Sprint([]string{"Connection timeout talking to issuer", "Card issuer slow to respond"}) {
+		t.Errorf("Unexpected page %+v", result)
+	}
+	if result = search(t, s, Query{From: 10, Size: 2}); result.Total != 5 || len(result.Records) != 0 {
+		t.Errorf("Expected an empty page past the end, got %+v", result)
+	}
+
+	if _, err := s.Search(Query{Text: `"open`}); err == nil {
+		t.Error("Expected an invalid search to fail")
+	}
+}
+
+func TestStoreSegments(t *testing.T) {
+	dir := t.TempDir()
+	s := openTestStore(t, dir)
+	end := time.Now().Add(-3 * time.Hour).Truncate(time.Hour).Add(30 * time.Minute)
+	if err := s.Write(testLogs(end)); err != nil {
+		t.Fatalf("Write failed: %v", err)
+	}
+
+	// Enough records to fill several pages, in the window before
+	var bulk []models.LogRecord
+	for i := 0; i < 2*pageSize+10; i++ {
+		bulk = append(bulk, models.LogRecord{
+			Timestamp:   end.Add(-time.Hour - time.Duration(i)*time.Millisecond),
+			Severity:    "DEBUG",
+			ServiceName: "worker",
+			Message:     fmt.Sprintf("processed job %d", i),
+		})
+	}
+	if err := s.Write(bulk); err != nil {
+		t.Fatalf("Write failed: %v", err)
+	}
+	s.store.Maintain(time.Now())
+
+	if heads, segments := counts(s); heads != 0 || segments != 2 {
+		t.Fatalf("Expected the windows to be cut into segments, got %d heads and %d segments", heads, segments)
+	}
+	logs, _ := os.ReadDir(filepath.Join(dir, "wal"))
+	if len(logs) != 0 {
+		t.Errorf("Expected the windows' logs to be removed, got %d", len(logs))
+	}
+
+	result := search(t, s, Query{Service: "worker", From: pageSize, Size: 3})
+	if result.Total != 2*pageSize+10 || fmt.Sprint(messages(result)) != fmt.Sprintf("[processed job %d processed job %d processed job %d]", pageSize, pageSize+1, pageSize+2) {
+		t.Errorf("Unexpected page from the segment %+v", messages(result))
+	}
+	result = search(t, s, Query{Text: `"job 300"`})
+	if fmt.Sprint(messages(result)) != "[processed job 300]" {
+		t.Errorf("Expected a phrase match from the segment, got %q", messages(result))
+	}
+	testSearch(t, segmentSearcher{segmentEnding(s, end)}, end)
+
+	// Late records reopen the window and are searched alongside the segment
+	if err := s.Write([]models.LogRecord{{Timestamp: end.Add(-time.Hour / 2), ServiceName: "checkout", Message: "late"}}); err != nil {
+		t.Fatalf("Write failed: %v", err)
+	}
+	if result = search(t, s, Query{Service: "checkout"}); result.Total != 3 || result.Records[2].Message != "late" {
+		t.Errorf("Expected records from the segment and the log, got %q", messages(result))
+	}
+
+	// Past the retention period segments are deleted
+	s.store.Maintain(time.Now().Add(defaultRetention + 4*time.Hour))
+	if _, segments := counts(s); segments != 0 {
+		t.Errorf("Expected expired segments to be deleted, got %d", segments)
+	}
+}
+
+// segmentEnding returns the segment whose last record is at end
+func segmentEnding(s *Store, end time.Time) *segment {
+	var last *segment
+	s.store.View(func(heads []*head, segments []*segment) error {
+		for _, seg := range segments {
+			if seg.index.MaxTime == end.UnixNano() {
+				last = seg
+			}
+		}
+		return nil
+	})
+	return last
+}
+
+// counts returns the number of open windows and segments
+func counts(s *Store) (heads, segments int) {
+	s.store.View(func(h []*head, seg []*segment) error {
+		heads, segments = len(h), len(seg)
+		return nil
+	})
+	return heads, segments
+}
+
+func TestStoreRecovery(t *testing.T) {
+	dir := t.TempDir()
+	s := openTestStore(t, dir)
+	if err := s.Write([]models.LogRecord{{Message: "first"}}); err != nil {
+		t.Fatalf("Write failed: %v", err)
+	}
+	if err := s.Write([]models.LogRecord{{Message: "second"}}); err != nil {
+		t.Fatalf("Write failed: %v", err)
+	}
+	s.Close()
+
+	// Tear the last entry, as a crash mid-write would
+	logs, _ := filepath.Glob(filepath.Join(dir, "wal", "*.wal"))
+	if len(logs) != 1 {
+		t.Fatalf("Expected one log, got %v", logs)
+	}
+	info, _ := os.Stat(logs[0])
+	if err := os.Truncate(logs[0], info.Size()-3); err != nil {
+		t.Fatal(err)
+	}
+
+	s = openTestStore(t, dir)
+	if result := search(t, s, Query{}); fmt.Sprint(messages(result)) != "[first]" {
+		t.Fatalf("Expected the intact entry to be recovered, got %q", messages(result))
+	}
+	if err := s.Write([]models.LogRecord{{Message: "third"}}); err != nil {
+		t.Fatalf("Write failed: %v", err)
+	}
+	s.Close()
+
+	s = openTestStore(t, dir)
+	if result := search(t, s, Query{}); result.Total != 2 {
+		t.Errorf("Expected entries after the truncation to be readable, got %q", messages(result))
+	}
+}
+
+func TestStoreReader(t *testing.T) {
+	dir := t.TempDir()
+	w := openTestStore(t, dir)
+	r, err := OpenReader(config.LogStoreConfig{Directory: dir}, zap.NewNop())
+	if err != nil {
+		t.Fatalf("OpenReader failed: %v", err)
+	}
+	r.store.RefreshEvery = 0
+
+	if err := r.Write(nil); err != errReadOnly {
+		t.Errorf("Expected writes to a reader to fail, got %v", err)
+	}
+
+	old := time.Now().Add(-3 * time.Hour)
+	if err := w.Write([]models.LogRecord{{Timestamp: old, Message: "old"}}); err != nil {
+		t.Fatalf("Write failed: %v", err)
+	}
+	if result := search(t, r, Query{}); result.Total != 1 {
+		t.Fatalf("Expected the reader to see logged records, got %q", messages(result))
+	}
+
+	w.store.Maintain(time.Now())
+	if err := w.Write([]models.LogRecord{{Message: "new"}}); err != nil {
+		t.Fatalf("Write failed: %v", err)
+	}
+	if result := search(t, r, Query{}); fmt.Sprint(messages(result)) != "[new old]" {
+		t.Errorf("Expected records from the segment and the new log, got %q", messages(result))
+	}
+}
@@ -0,0 +1,327 @@
+package metricstore
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/gaurav/watchingcat/internal/windowstore"
+)
+
+const (
+	chunksFile = "chunks"
+	indexFile  = "index"
+)
+
+// block is an immutable set of series on disk. The chunks file holds the
+// series' Gorilla chunks back to back. The gzipped JSON index lists each
+// series' labels and chunks, and maps every label name and value to the
+// series carrying it, so selects only decode chunks of matching series.
+type block struct {
+	dir   string
+	index blockIndex
+}
+
+type blockIndex struct {
+	MinTime int64         `json:"min_time"`
+	MaxTime int64         `json:"max_time"`
+	Series  []seriesEntry `json:"series"` // sorted by labels
+	// Postings maps label names and values to the ascending positions in
+	// Series of the series carrying them
+	Postings map[string]map[string][]int `json:"postings"`
+}
+
+type seriesEntry struct {
+	Labels Labels      `json:"labels"`
+	Chunks []chunkMeta `json:"chunks"`
+}
+
+// chunkMeta locates a chunk in the chunks file
+type chunkMeta struct {
+	MinTime int64 `json:"min_time"`
+	MaxTime int64 `json:"max_time"`
+	Count   int   `json:"count"`
+	Offset  int64 `json:"offset"`
+	Length  int64 `json:"length"`
+}
+
+// MaxTime returns the time of the block's latest sample
+func (b *block) MaxTime() time.Time {
+	return time.UnixMilli(b.index.MaxTime)
+}
+
+// writeBlock writes series to a new block directory. The block is built
+// under a temporary name and renamed into place once complete.
+func writeBlock(dir string, series map[string]*memSeries) (*block, error) {
+	tmp := dir + windowstore.TmpExt
+	if err := os.MkdirAll(tmp, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create block: %w", err)
+	}
+	defer os.RemoveAll(tmp)
+
+	keys := make([]string, 0, len(series))
+	for key := range series {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var data bytes.Buffer
+	index := blockIndex{Postings: make(map[string]map[string][]int)}
+	empty := true
+	for _, key := range keys {
+		s := series[key]
+		if len(s.chunks) == 0 {
+			continue
+		}
+
+		entry := seriesEntry{Labels: s.labels}
+		for _, c := range s.chunks {
+			meta := chunkMeta{
+				MinTime: c.minT,
+				MaxTime: c.maxT,
+				Count:   c.count,
+				Offset:  int64(data.Len()),
+			}
+			data.Write(c.bytes())
+			meta.Length = int64(data.Len()) - meta.Offset
+			entry.Chunks = append(entry.Chunks, meta)
+
+			if empty || c.minT < index.MinTime {
+				index.MinTime = c.minT
+			}
+			if empty || c.maxT > index.MaxTime {
+				index.MaxTime = c.maxT
+			}
+			empty = false
+		}
+
+		i := len(index.Series)
+		for _, l := range s.labels {
+			values := index.Postings[l.Name]
+			if values == nil {
+				values = make(map[string][]int)
+				index.Postings[l.Name] = values
+			}
+			values[l.Value] = append(values[l.Value], i)
+		}
+		index.Series = append(index.Series, entry)
+	}
+
+	if err := writeFile(filepath.Join(tmp, chunksFile), data.Bytes()); err != nil {
+		return nil, err
+	}
+
+	var encoded bytes.Buffer
+	zw := gzip.NewWriter(&encoded)
+	if err := json.NewEncoder(zw).Encode(index); err != nil {
+		return nil, fmt.Errorf("failed to encode block index: %w", err)
+	}
+	if err := zw.Close(); err != nil {
+		return nil, fmt.Errorf("failed to compress block index: %w", err)
+	}
+	if err := writeFile(filepath.Join(tmp, indexFile), encoded.Bytes()); err != nil {
+		return nil, err
+	}
+
+	if err := os.Rename(tmp, dir); err != nil {
+		return nil, fmt.Errorf("failed to commit block: %w", err)
+	}
+	return &block{dir: dir, index: index}, nil
+}
+
+// writeFile writes and syncs a block file
+func writeFile(path string, data []byte) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("failed to create %s: %w", path, err)
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return fmt.Errorf("failed to write %s: %w", path, err)
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return fmt.Errorf("failed to sync %s: %w", path, err)
+	}
+	return f.Close()
+}
+
+// openBlock loads a block's index
+func openBlock(dir string) (*block, error) {
+	f, err := os.Open(filepath.Join(dir, indexFile))
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	zr, err := gzip.NewReader(f)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read block index: %w", err)
+	}
+	var index blockIndex
+	if err := json.NewDecoder(zr).Decode(&index); err != nil {
+		return nil, fmt.Errorf("failed to decode block index: %w", err)
+	}
+	return &block{dir: dir, index: index}, nil
+}
+
+// candidates returns the positions of the series that may match according
+// to the postings. Matchers that also match a missing label cannot narrow
+// the search and are checked against the labels afterwards.
+func (b *block) candidates(matchers []*Matcher) []int {
+	var positions []int
+	narrowed := false
+	for _, m := range matchers {
+		if m.Matches("") {
+			continue
+		}
+
+		var union []int
+		if m.Type == MatchEqual {
+			union = b.index.Postings[m.Name][m.Value]
+		} else {
+			for value, postings := range b.index.Postings[m.Name] {
+				if m.Matches(value) {
+					union = merge(union, postings)
+				}
+			}
+		}
+
+		if !narrowed {
+			positions, narrowed = union, true
+		} else {
+			positions = intersect(positions, union)
+		}
+		if len(positions) == 0 {
+			return nil
+		}
+	}
+
+	if !narrowed {
+		positions = make([]int, len(b.index.Series))
+		for i := range positions {
+			positions[i] = i
+		}
+	}
+	return positions
+}
+
+// selectSeries reads the samples between mint and maxt of the series
+// matching every matcher
+func (b *block) selectSeries(mint, maxt int64, matchers []*Matcher) ([]Series, error) {
+	if b.index.MaxTime < mint || b.index.MinTime > maxt {
+		return nil, nil
+	}
+
+	var f *os.File
+	defer func() {
+		if f != nil {
+			f.Close()
+		}
+	}()
+
+	var out []Series
+	for _, i := range b.candidates(matchers) {
+		entry := b.index.Series[i]
+		if !matchAll(entry.Labels, matchers) {
+			continue
+		}
+
+		var samples []Sample
+		for _, meta := range entry.Chunks {
+			if meta.MaxTime < mint || meta.MinTime > maxt {
+				continue
+			}
+			if f == nil {
+				var err error
+				if f, err = os.Open(filepath.Join(b.dir, chunksFile)); err != nil {
+					return nil, err
+				}
+			}
+
+			data := make([]byte, meta.Length)
+			if _, err := f.ReadAt(data, meta.Offset); err != nil {
+				return nil, fmt.Errorf("failed to read chunk: %w", err)
+			}
+			decoded, err := decodeChunk(data, meta.Count)
+			if err != nil {
+				return nil, fmt.Errorf("failed to decode chunk: %w", err)
+			}
+			samples = append(samples, inRange(decoded, mint, maxt)...)
+		}
+		if len(samples) > 0 {
+			out = append(out, Series{Labels: entry.Labels, Samples: samples})
+		}
+	}
+	return out, nil
+}
+
+// labelNames returns the label names seen in the block
+func (b *block) labelNames() []string {
+	names := make([]string, 0, len(b.index.Postings))
+	for name := range b.index.Postings {
+		names = append(names, name)
+	}
+	return names
+}
+
+// labelValues returns the values of a label seen in the block
+func (b *block) labelValues(name string) []string {
+	values := make([]string, 0, len(b.index.Postings[name]))
+	for value := range b.index.Postings[name] {
+		values = append(values, value)
+	}
+	return values
+}
+
+// inRange returns the samples between mint and maxt inclusive
+func inRange(samples []Sample, mint, maxt int64) []Sample {
+	lo := sort.Search(len(samples), func(i int) bool { return samples[i].T >= mint })
+	hi := sort.Search(len(samples), func(i int) bool { return samples[i].T > maxt })
+	return samples[lo:hi]
+}
+
+// intersect returns the positions present in both ascending lists
+func intersect(a, b []int) []int {
+	var out []int
+	for i, j := 0, 0; i < len(a) && j < len(b); {
+		switch {
+		case a[i] < b[j]:
+			i++
+		case a[i] > b[j]:
+			j++
+		default:
+			out = append(out, a[i])
+			i++
+			j++
+		}
+	}
+	return out
+}
+
+// merge returns the positions present in either ascending list
+func merge(a, b []int) []int {
+	out := make([]int, 0, len(a)+len(b))
+	i, j := 0, 0
+	for i < len(a) && j < len(b) {
+		switch {
+		case a[i] < b[j]:
+			out = append(out, a[i])
+			i++
+		case a[i] > b[j]:
+			out = append(out, b[j])
+			j++
+		default:
+			out = append(out, a[i])
+			i++
+			j++
+		}
+	}
+	out = append(out, a[i:]...)
+	return append(out, b[j:]...)
+}
@@ -0,0 +1,287 @@
+package metricstore
+
+import (
+	"errors"
+	"math"
+	"math/bits"
+)
+
+// Samples of a series are held in chunks compressed as in Facebook's
+// Gorilla paper. The first sample is stored raw. Later timestamps are
+// stored as the difference between consecutive deltas, in as few bits as
+// the difference allows; values are XORed with the previous value and only
+// the meaningful bits of the result are stored.
+
+// maxChunkSamples caps a chunk's size so reads decode little they skip
+const maxChunkSamples = 120
+
+var errChunkEnd = errors.New("unexpected end of chunk")
+
+// Sample is a value at a timestamp in milliseconds since the epoch
+type Sample struct {
+	T int64   `json:"t"`
+	V float64 `json:"v"`
+}
+
+// chunk is an append-only Gorilla-encoded run of samples in time order
+type chunk struct {
+	w     bitWriter
+	count int
+	minT  int64
+	maxT  int64
+
+	// encoder state
+	delta    int64
+	value    float64
+	leading  uint8
+	trailing uint8
+}
+
+func newChunk() *chunk {
+	return &chunk{leading: 0xff}
+}
+
+// append adds a sample, which must be later than the chunk's last one
+func (c *chunk) append(s Sample) {
+	switch c.count {
+	case 0:
+		c.w.writeBits(uint64(s.T), 64)
+		c.w.writeBits(math.Float64bits(s.V), 64)
+		c.minT = s.T
+	default:
+		delta := s.T - c.maxT
+		writeDoD(&c.w, delta-c.delta)
+		c.delta = delta
+		c.writeValue(s.V)
+	}
+	c.maxT = s.T
+	c.value = s.V
+	c.count++
+}
+
+// writeDoD writes a delta of deltas in the smallest of Gorilla's buckets,
+// sized for millisecond timestamps
+func writeDoD(w *bitWriter, dod int64) {
+	switch {
+	case dod == 0:
+		w.writeBit(false)
+	case fitsBits(dod, 14):
+		w.writeBits(0b10, 2)
+		w.writeBits(uint64(dod), 14)
+	case fitsBits(dod, 17):
+		w.writeBits(0b110, 3)
+		w.writeBits(uint64(dod), 17)
+	case fitsBits(dod, 20):
+		w.writeBits(0b1110, 4)
+		w.writeBits(uint64(dod), 20)
+	default:
+		w.writeBits(0b1111, 4)
+		w.writeBits(uint64(dod), 64)
+	}
+}
+
+// fitsBits reports whether v fits in an n-bit two's complement integer
+func fitsBits(v int64, n uint) bool {
+	return v >= -(1<<(n-1)) && v < 1<<(n-1)
+}
+
+// writeValue writes v XORed with the previous value. When the meaningful
+// bits fit in the previous window only they are written; otherwise the new
+// window's leading zero count and length come first.
+func (c *chunk) writeValue(v float64) {
+	xor := math.Float64bits(v) ^ math.Float64bits(c.value)
+	if xor == 0 {
+		c.w.writeBit(false)
+		return
+	}
+	c.w.writeBit(true)
+
+	leading := uint8(bits.LeadingZeros64(xor))
+	trailing := uint8(bits.TrailingZeros64(xor))
+	if leading > 31 {
+		leading = 31
+	}
+
+	if c.leading != 0xff && leading >= c.leading && trailing >= c.trailing {
+		c.w.writeBit(false)
+		c.w.writeBits(xor>>c.trailing, int(64-c.leading-c.trailing))
+		return
+	}
+
+	c.leading, c.trailing = leading, trailing
+	significant := 64 - leading - trailing
+	c.w.writeBit(true)
+	c.w.writeBits(uint64(leading), 5)
+	// 64 significant bits do not fit in 6 bits and are written as 0
+	c.w.writeBits(uint64(significant)&0x3f, 6)
+	c.w.writeBits(xor>>trailing, int(significant))
+}
+
+// bytes returns the encoded chunk
+func (c *chunk) bytes() []byte {
+	return c.w.buf
+}
+
+// samples decodes the chunk's samples
+func (c *chunk) samples() ([]Sample, error) {
+	return decodeChunk(c.w.buf, c.count)
+}
+
+// decodeChunk decodes count samples from an encoded chunk
+func decodeChunk(data []byte, count int) ([]Sample, error) {
+	r := bitReader{buf: data}
+	samples := make([]Sample, 0, count)
+
+	var (
+		t, delta          int64
+		value             uint64
+		leading, trailing uint8
+	)
+	for i := 0; i < count; i++ {
+		if i == 0 {
+			rawT, err := r.readBits(64)
+			if err != nil {
+				return nil, err
+			}
+			rawV, err := r.readBits(64)
+			if err != nil {
+				return nil, err
+			}
+			t, value = int64(rawT), rawV
+			samples = append(samples, Sample{T: t, V: math.Float64frombits(value)})
+			continue
+		}
+
+		dod, err := readDoD(&r)
+		if err != nil {
+			return nil, err
+		}
+		delta += dod
+		t += delta
+
+		changed, err := r.readBit()
+		if err != nil {
+			return nil, err
+		}
+		if changed {
+			newWindow, err := r.readBit()
+			if err != nil {
+				return nil, err
+			}
+			if newWindow {
+				l, err := r.readBits(5)
+				if err != nil {
+					return nil, err
+				}
+				n, err := r.readBits(6)
+				if err != nil {
+					return nil, err
+				}
+				if n == 0 {
+					n = 64
+				}
+				leading = uint8(l)
+				trailing = 64 - leading - uint8(n)
+			}
+			xor, err := r.readBits(int(64 - leading - trailing))
+			if err != nil {
+				return nil, err
+			}
+			value ^= xor << trailing
+		}
+		samples = append(samples, Sample{T: t, V: math.Float64frombits(value)})
+	}
+	return samples, nil
+}
+
+// readDoD reads a delta of deltas written by writeDoD
+func readDoD(r *bitReader) (int64, error) {
+	var prefix int
+	for prefix < 4 {
+		bit, err := r.readBit()
+		if err != nil {
+			return 0, err
+		}
+		if !bit {
+			break
+		}
+		prefix++
+	}
+
+	var size int
+	switch prefix {
+	case 0:
+		return 0, nil
+	case 1:
+		size = 14
+	case 2:
+		size = 17
+	case 3:
+		size = 20
+	default:
+		size = 64
+	}
+
+	v, err := r.readBits(size)
+	if err != nil {
+		return 0, err
+	}
+	if size < 64 && v&(1<<(size-1)) != 0 {
+		// Sign-extend
+		v |= ^uint64(0) << size
+	}
+	return int64(v), nil
+}
+
+// bitWriter appends bits to a byte slice, most significant bit first
+type bitWriter struct {
+	buf []byte
+	n   uint // bits written
+}
+
+func (w *bitWriter) writeBit(bit bool) {
+	if w.n%8 == 0 {
+		w.buf = append(w.buf, 0)
+	}
+	if bit {
+		w.buf[len(w.buf)-1] |= 1 << (7 - w.n%8)
+	}
+	w.n++
+}
+
+// writeBits writes the low nbits of v
+func (w *bitWriter) writeBits(v uint64, nbits int) {
+	for i := nbits - 1; i >= 0; i-- {
+		w.writeBit(v>>uint(i)&1 == 1)
+	}
+}
+
+// bitReader reads bits written by bitWriter
+type bitReader struct {
+	buf []byte
+	pos uint
+}
+
+func (r *bitReader) readBit() (bool, error) {
+	if r.pos >= uint(len(r.buf))*8 {
+		return false, errChunkEnd
+	}
+	bit := r.buf[r.pos/8]>>(7-r.pos%8)&1 == 1
+	r.pos++
+	return bit, nil
+}
+
+func (r *bitReader) readBits(nbits int) (uint64, error) {
+	var v uint64
+	for i := 0; i < nbits; i++ {
+		bit, err := r.readBit()
+		if err != nil {
+			return 0, err
+		}
+		v <<= 1
+		if bit {
+			v |= 1
+		}
+	}
+	return v, nil
+}
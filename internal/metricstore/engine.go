@@ -0,0 +1,418 @@
+package metricstore
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// lookback is how far back an instant selector looks for a series' latest
+// sample, as in Prometheus
+const lookback = 5 * time.Minute
+
+// maxRangeSteps caps the points a range query evaluates
+const maxRangeSteps = 11000
+
+// ValueType is the type of a query result
+type ValueType string
+
+const (
+	ValueVector ValueType = "vector"
+	ValueMatrix ValueType = "matrix"
+	ValueScalar ValueType = "scalar"
+)
+
+// Result is the outcome of a query. A vector holds one sample per series
+// and a scalar a single unlabelled series with one sample.
+type Result struct {
+	Type   ValueType
+	Series []Series
+}
+
+// vectorSample is one element of an instant vector
+type vectorSample struct {
+	labels Labels
+	value  float64
+}
+
+// Query evaluates a query at ts
+func (s *Store) Query(query string, ts time.Time) (*Result, error) {
+	root, err := parse(query)
+	if err != nil {
+		return nil, err
+	}
+
+	t := ts.UnixMilli()
+	if err := s.load(root, t, t); err != nil {
+		return nil, err
+	}
+
+	switch n := root.(type) {
+	case *numberNode:
+		return &Result{Type: ValueScalar, Series: []Series{{Labels: Labels{}, Samples: []Sample{{T: t, V: n.value}}}}}, nil
+	case *selectorNode:
+		if n.rng > 0 {
+			return &Result{Type: ValueMatrix, Series: rangeAt(n, t)}, nil
+		}
+	}
+
+	vec, err := evalVector(root, t)
+	if err != nil {
+		return nil, err
+	}
+	result := &Result{Type: ValueVector, Series: make([]Series, len(vec))}
+	for i, v := range vec {
+		result.Series[i] = Series{Labels: v.labels, Samples: []Sample{{T: t, V: v.value}}}
+	}
+	return result, nil
+}
+
+// QueryRange evaluates a query at every step from start to end
+func (s *Store) QueryRange(query string, start, end time.Time, step time.Duration) (*Result, error) {
+	if step <= 0 {
+		return nil, errors.New("step must be positive")
+	}
+	if end.Before(start) {
+		return nil, errors.New("end must not be before start")
+	}
+	if end.Sub(start)/step > maxRangeSteps {
+		return nil, fmt.Errorf("range query exceeds %d steps", maxRangeSteps)
+	}
+
+	root, err := parse(query)
+	if err != nil {
+		return nil, err
+	}
+	if isRange(root) {
+		return nil, errors.New("range query must evaluate to an instant vector or scalar")
+	}
+
+	mint, maxt := start.UnixMilli(), end.UnixMilli()
+	if err := s.load(root, mint, maxt); err != nil {
+		return nil, err
+	}
+
+	series := make(map[string]*Series)
+	for t := mint; t <= maxt; t += step.Milliseconds() {
+		if n, ok := root.(*numberNode); ok {
+			add(series, Labels{}, Sample{T: t, V: n.value})
+			continue
+		}
+		vec, err := evalVector(root, t)
+		if err != nil {
+			return nil, err
+		}
+		for _, v := range vec {
+			add(series, v.labels, Sample{T: t, V: v.value})
+		}
+	}
+	return &Result{Type: ValueMatrix, Series: sortedSeries(series)}, nil
+}
+
+func add(series map[string]*Series, labels Labels, sample Sample) {
+	key := labels.key()
+	s := series[key]
+	if s == nil {
+		s = &Series{Labels: labels}
+		series[key] = s
+	}
+	s.Samples = append(s.Samples, sample)
+}
+
+func sortedSeries(series map[string]*Series) []Series {
+	keys := make([]string, 0, len(series))
+	for key := range series {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	out := make([]Series, len(keys))
+	for i, key := range keys {
+		out[i] = *series[key]
+	}
+	return out
+}
+
+// load reads the samples every selector needs to be evaluated between
+// mint and maxt
+func (s *Store) load(n node, mint, maxt int64) error {
+	switch n := n.(type) {
+	case *selectorNode:
+		window := lookback
+		if n.rng > 0 {
+			window = n.rng
+		}
+		series, err := s.Select(mint-window.Milliseconds(), maxt, n.matchers...)
+		if err != nil {
+			return err
+		}
+		n.series = series
+	case *callNode:
+		for _, arg := range n.args {
+			if err := s.load(arg, mint, maxt); err != nil {
+				return err
+			}
+		}
+	case *aggregateNode:
+		return s.load(n.arg, mint, maxt)
+	}
+	return nil
+}
+
+// evalVector evaluates an instant vector expression at t
+func evalVector(n node, t int64) ([]vectorSample, error) {
+	switch n := n.(type) {
+	case *selectorNode:
+		return instantAt(n, t), nil
+	case *callNode:
+		return evalCall(n, t)
+	case *aggregateNode:
+		vec, err := evalVector(n.arg, t)
+		if err != nil {
+			return nil, err
+		}
+		return aggregate(n, vec), nil
+	}
+	return nil, fmt.Errorf("expression does not evaluate to an instant vector")
+}
+
+// instantAt returns each series' latest sample in the lookback window
+// ending at t
+func instantAt(sel *selectorNode, t int64) []vectorSample {
+	var vec []vectorSample
+	for _, s := range sel.series {
+		samples := inRange(s.Samples, t-lookback.Milliseconds()+1, t)
+		if len(samples) == 0 {
+			continue
+		}
+		vec = append(vec, vectorSample{labels: s.Labels, value: samples[len(samples)-1].V})
+	}
+	return vec
+}
+
+// rangeAt returns each series' samples in the selector's range ending at t
+func rangeAt(sel *selectorNode, t int64) []Series {
+	var out []Series
+	for _, s := range sel.series {
+		samples := inRange(s.Samples, t-sel.rng.Milliseconds()+1, t)
+		if len(samples) > 0 {
+			out = append(out, Series{Labels: s.Labels, Samples: samples})
+		}
+	}
+	return out
+}
+
+func evalCall(call *callNode, t int64) ([]vectorSample, error) {
+	switch call.fn {
+	case "rate", "increase":
+		sel := call.args[0].(*selectorNode)
+		var vec []vectorSample
+		for _, s := range rangeAt(sel, t) {
+			v, ok := extrapolatedIncrease(s.Samples, t, sel.rng)
+			if !ok {
+				continue
+			}
+			if call.fn == "rate" {
+				v /= sel.rng.Seconds()
+			}
+			vec = append(vec, vectorSample{labels: s.Labels.Without(MetricName), value: v})
+		}
+		return vec, nil
+
+	case "histogram_quantile":
+		q := call.args[0].(*numberNode).value
+		vec, err := evalVector(call.args[1], t)
+		if err != nil {
+			return nil, err
+		}
+		return histogramQuantile(q, vec), nil
+	}
+	return nil, fmt.Errorf("unsupported function %q", call.fn)
+}
+
+// extrapolatedIncrease computes a counter's increase over the range ending
+// at t the way Prometheus does: counter resets are added back and the
+// increase between the first and last samples is extrapolated towards the
+// range boundaries, but not past where the counter would reach zero.
+func extrapolatedIncrease(samples []Sample, t int64, rng time.Duration) (float64, bool) {
+	if len(samples) < 2 {
+		return 0, false
+	}
+	first, last := samples[0], samples[len(samples)-1]
+
+	increase := last.V - first.V
+	for i := 1; i < len(samples); i++ {
+		if samples[i].V < samples[i-1].V {
+			increase += samples[i-1].V
+		}
+	}
+
+	rangeStart := float64(t-rng.Milliseconds()) / 1000
+	rangeEnd := float64(t) / 1000
+	firstT, lastT := float64(first.T)/1000, float64(last.T)/1000
+
+	sampled := lastT - firstT
+	toStart := firstT - rangeStart
+	toEnd := rangeEnd - lastT
+	average := sampled / float64(len(samples)-1)
+
+	if increase > 0 && first.V >= 0 {
+		if toZero := sampled * (first.V / increase); toZero < toStart {
+			toStart = toZero
+		}
+	}
+
+	threshold := average * 1.1
+	extrapolated := sampled
+	if toStart < threshold {
+		extrapolated += toStart
+	} else {
+		extrapolated += average / 2
+	}
+	if toEnd < threshold {
+		extrapolated += toEnd
+	} else {
+		extrapolated += average / 2
+	}
+	return increase * extrapolated / sampled, true
+}
+
+// bucket is a cumulative histogram bucket
+type bucket struct {
+	upper float64
+	count float64
+}
+
+// histogramQuantile estimates the q-quantile of each histogram in vec from
+// its le buckets, interpolating linearly within the bucket the quantile
+// falls in
+func histogramQuantile(q float64, vec []vectorSample) []vectorSample {
+	type histogram struct {
+		labels  Labels
+		buckets []bucket
+	}
+	histograms := make(map[string]*histogram)
+	var keys []string
+	for _, v := range vec {
+		le := v.labels.Get("le")
+		upper, err := strconv.ParseFloat(le, 64)
+		if le == "" || err != nil {
+			continue
+		}
+		labels := v.labels.Without("le", MetricName)
+		key := labels.key()
+		h := histograms[key]
+		if h == nil {
+			h = &histogram{labels: labels}
+			histograms[key] = h
+			keys = append(keys, key)
+		}
+		h.buckets = append(h.buckets, bucket{upper: upper, count: v.value})
+	}
+	sort.Strings(keys)
+
+	out := make([]vectorSample, 0, len(keys))
+	for _, key := range keys {
+		h := histograms[key]
+		out = append(out, vectorSample{labels: h.labels, value: bucketQuantile(q, h.buckets)})
+	}
+	return out
+}
+
+func bucketQuantile(q float64, buckets []bucket) float64 {
+	switch {
+	case math.IsNaN(q):
+		return math.NaN()
+	case q < 0:
+		return math.Inf(-1)
+	case q > 1:
+		return math.Inf(1)
+	}
+
+	sort.Slice(buckets, func(i, j int) bool { return buckets[i].upper < buckets[j].upper })
+	if len(buckets) < 2 || !math.IsInf(buckets[len(buckets)-1].upper, 1) {
+		return math.NaN()
+	}
+	// Rates of cumulative counts can dip slightly; keep them monotonic
+	for i := 1; i < len(buckets); i++ {
+		if buckets[i].count < buckets[i-1].count {
+			buckets[i].count = buckets[i-1].count
+		}
+	}
+
+	total := buckets[len(buckets)-1].count
+	if total == 0 {
+		return math.NaN()
+	}
+	rank := q * total
+	b := sort.Search(len(buckets)-1, func(i int) bool { return buckets[i].count >= rank })
+
+	switch {
+	case b == len(buckets)-1:
+		return buckets[len(buckets)-2].upper
+	case b == 0 && buckets[0].upper <= 0:
+		return buckets[0].upper
+	}
+
+	start, end, count := 0.0, buckets[b].upper, buckets[b].count
+	if b > 0 {
+		start = buckets[b-1].upper
+		count -= buckets[b-1].count
+		rank -= buckets[b-1].count
+	}
+	return start + (end-start)*(rank/count)
+}
+
+// aggregate combines a vector's samples by the aggregation's grouping
+func aggregate(agg *aggregateNode, vec []vectorSample) []vectorSample {
+	type group struct {
+		labels Labels
+		value  float64
+		count  int
+	}
+	groups := make(map[string]*group)
+	var keys []string
+	without := append([]string{MetricName}, agg.grouping...)
+
+	for _, v := range vec {
+		labels := v.labels.Only(agg.grouping...)
+		if agg.without {
+			labels = v.labels.Without(without...)
+		}
+
+		key := labels.key()
+		g := groups[key]
+		if g == nil {
+			g = &group{labels: labels, value: v.value}
+			groups[key] = g
+			keys = append(keys, key)
+		} else {
+			switch agg.op {
+			case "sum", "avg":
+				g.value += v.value
+			case "min":
+				g.value = math.Min(g.value, v.value)
+			case "max":
+				g.value = math.Max(g.value, v.value)
+			}
+		}
+		g.count++
+	}
+	sort.Strings(keys)
+
+	out := make([]vectorSample, 0, len(keys))
+	for _, key := range keys {
+		g := groups[key]
+		switch agg.op {
+		case "avg":
+			g.value /= float64(g.count)
+		case "count":
+			g.value = float64(g.count)
+		}
+		out = append(out, vectorSample{labels: g.labels, value: g.value})
+	}
+	return out
+}
@@ -0,0 +1,198 @@
+package metricstore
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+// writeCounters writes a counter per service increasing by rate per second,
+// sampled every 15s for the ten minutes before end
+func writeCounters(t *testing.T, s *Store, end time.Time, rates map[string]float64) {
+	t.Helper()
+	var series []Series
+	for service, rate := range rates {
+		var samples []Sample
+		for i := 0; i <= 40; i++ {
+			ts := end.Add(-10 * time.Minute).Add(time.Duration(i) * 15 * time.Second)
+			samples = append(samples, Sample{T: ts.UnixMilli(), V: rate * 15 * float64(i)})
+		}
+		series = append(series, testSeries("requests_total", map[string]string{"service_name": service, "code": "200"}, samples...))
+	}
+	if err := s.Write(series); err != nil {
+		t.Fatalf("Write failed: %v", err)
+	}
+}
+
+func approx(a, b float64) bool {
+	return math.Abs(a-b) < 1e-6
+}
+
+func TestParseErrors(t *testing.T) {
+	for _, query := range []string{
+		`rate(requests_total)`,
+		`sum(requests_total[5m])`,
+		`requests_total{code="200"`,
+		`{code=~".*"}`,
+		`requests_total[5q]`,
+		`label_replace(up)`,
+		`histogram_quantile(up, latency_bucket)`,
+		`up + 1`,
+		`up{code=~"("}`,
+	} {
+		if _, err := parse(query); err == nil {
+			t.Errorf("Expected %q to be rejected", query)
+		}
+	}
+
+	for _, query := range []string{
+		`up`,
+		`{__name__="up", job!~"test.*"}`,
+		`sum without (code) (rate(requests_total{code=~'2..'}[1m]))`,
+		`sum(rate(requests_total[5m])) by (service_name)`,
+		`histogram_quantile(0.99, sum by (le, service_name) (rate(latency_bucket[1h30m])))`,
+		`count(up)`,
+		`0.5`,
+	} {
+		if _, err := parse(query); err != nil {
+			t.Errorf("Expected %q to parse, got %v", query, err)
+		}
+	}
+}
+
+func TestQuerySelectorsAndRate(t *testing.T) {
+	s := openTestStore(t, t.TempDir())
+	now := time.Now().Truncate(time.Second)
+	writeCounters(t, s, now, map[string]float64{"web": 2, "api": 0.5})
+
+	result, err := s.Query(`requests_total{service_name="web"}`, now)
+	if err != nil {
+		t.Fatalf("Query failed: %v", err)
+	}
+	if result.Type != ValueVector || len(result.Series) != 1 || result.Series[0].Samples[0].V != 1200 {
+		t.Fatalf("Expected the latest web sample, got %+v", result)
+	}
+
+	result, _ = s.Query(`requests_total[1m]`, now)
+	if result.Type != ValueMatrix || len(result.Series) != 2 || len(result.Series[0].Samples) != 4 {
+		t.Errorf("Expected a minute of samples per series, got %+v", result)
+	}
+
+	result, err = s.Query(`rate(requests_total{service_name="web"}[5m])`, now)
+	if err != nil || len(result.Series) != 1 || !approx(result.Series[0].Samples[0].V, 2) {
+		t.Fatalf("Expected a rate of 2/s, got %+v %v", result, err)
+	}
+	if result.Series[0].Labels.Get(MetricName) != "" {
+		t.Error("Expected rate to drop the metric name")
+	}
+
+	result, _ = s.Query(`increase(requests_total{service_name="api"}[5m])`, now)
+	if len(result.Series) != 1 || !approx(result.Series[0].Samples[0].V, 150) {
+		t.Errorf("Expected an increase of 150, got %+v", result)
+	}
+
+	result, _ = s.Query(`sum by (code) (rate(requests_total[5m]))`, now)
+	if len(result.Series) != 1 || !approx(result.Series[0].Samples[0].V, 2.5) || result.Series[0].Labels.Get("code") != "200" {
+		t.Errorf("Expected the rates summed by code, got %+v", result)
+	}
+	result, _ = s.Query(`max without (code) (rate(requests_total[5m]))`, now)
+	if len(result.Series) != 2 || result.Series[1].Labels.Get("service_name") != "web" || !approx(result.Series[1].Samples[0].V, 2) {
+		t.Errorf("Expected a series per service, got %+v", result)
+	}
+	result, _ = s.Query(`count(requests_total)`, now)
+	if len(result.Series) != 1 || result.Series[0].Samples[0].V != 2 {
+		t.Errorf("Expected two series counted, got %+v", result)
+	}
+
+	// Samples older than the lookback are not returned
+	result, _ = s.Query(`requests_total`, now.Add(10*time.Minute))
+	if len(result.Series) != 0 {
+		t.Errorf("Expected stale series to be dropped, got %+v", result)
+	}
+
+	result, _ = s.Query(`42`, now)
+	if result.Type != ValueScalar || result.Series[0].Samples[0].V != 42 {
+		t.Errorf("Expected a scalar, got %+v", result)
+	}
+}
+
+func TestQueryCounterReset(t *testing.T) {
+	s := openTestStore(t, t.TempDir())
+	now := time.Now().Truncate(time.Second)
+	var samples []Sample
+	values := []float64{10, 20, 30, 5, 15}
+	for i, v := range values {
+		samples = append(samples, Sample{T: now.Add(time.Duration(i-4) * 15 * time.Second).UnixMilli(), V: v})
+	}
+	if err := s.Write([]Series{testSeries("restarts_total", nil, samples...)}); err != nil {
+		t.Fatalf("Write failed: %v", err)
+	}
+
+	// 20 before the reset plus 15 after it, over the 60s sampled
+	result, _ := s.Query(`increase(restarts_total[61s])`, now)
+	if len(result.Series) != 1 || !approx(result.Series[0].Samples[0].V, 35*61.0/60) {
+		t.Errorf("Expected the reset to be added back, got %+v", result)
+	}
+}
+
+func TestHistogramQuantile(t *testing.T) {
+	s := openTestStore(t, t.TempDir())
+	now := time.Now().Truncate(time.Second)
+
+	buckets := map[string]float64{"0.1": 50, "0.5": 90, "1": 100, "+Inf": 100}
+	var series []Series
+	for le, count := range buckets {
+		series = append(series, testSeries("latency_bucket", map[string]string{"service_name": "web", "le": le},
+			Sample{T: now.Add(-time.Minute).UnixMilli(), V: 0},
+			Sample{T: now.UnixMilli(), V: count},
+		))
+	}
+	if err := s.Write(series); err != nil {
+		t.Fatalf("Write failed: %v", err)
+	}
+
+	result, err := s.Query(`histogram_quantile(0.5, latency_bucket)`, now)
+	if err != nil || len(result.Series) != 1 || !approx(result.Series[0].Samples[0].V, 0.1) {
+		t.Fatalf("Expected the median at 0.1, got %+v %v", result, err)
+	}
+	if result.Series[0].Labels.Get("le") != "" || result.Series[0].Labels.Get("service_name") != "web" {
+		t.Errorf("Expected le to be dropped, got %v", result.Series[0].Labels)
+	}
+
+	result, _ = s.Query(`histogram_quantile(0.7, sum by (le) (rate(latency_bucket[2m])))`, now)
+	if len(result.Series) != 1 || !approx(result.Series[0].Samples[0].V, 0.3) {
+		t.Errorf("Expected 0.7 interpolated to 0.3, got %+v", result)
+	}
+
+	// Beyond the highest finite bucket the quantile is that bucket's bound
+	result, _ = s.Query(`histogram_quantile(1, latency_bucket)`, now)
+	if len(result.Series) != 1 || result.Series[0].Samples[0].V != 1 {
+		t.Errorf("Expected 1, got %+v", result)
+	}
+}
+
+func TestQueryRange(t *testing.T) {
+	s := openTestStore(t, t.TempDir())
+	now := time.Now().Truncate(time.Second)
+	writeCounters(t, s, now, map[string]float64{"web": 2})
+
+	result, err := s.QueryRange(`sum(rate(requests_total[1m]))`, now.Add(-5*time.Minute), now, time.Minute)
+	if err != nil {
+		t.Fatalf("QueryRange failed: %v", err)
+	}
+	if result.Type != ValueMatrix || len(result.Series) != 1 || len(result.Series[0].Samples) != 6 {
+		t.Fatalf("Expected six points, got %+v", result)
+	}
+	for _, sample := range result.Series[0].Samples {
+		if !approx(sample.V, 2) {
+			t.Errorf("Expected a rate of 2/s, got %v", sample)
+		}
+	}
+
+	if _, err := s.QueryRange(`requests_total[1m]`, now.Add(-time.Minute), now, time.Second); err == nil {
+		t.Error("Expected a range vector to be rejected")
+	}
+	if _, err := s.QueryRange(`up`, now.Add(-time.Hour*24*365), now, time.Second); err == nil {
+		t.Error("Expected too many steps to be rejected")
+	}
+}
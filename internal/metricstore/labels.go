@@ -0,0 +1,163 @@
+package metricstore
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// MetricName is the label holding a series' metric name
+const MetricName = "__name__"
+
+// Label is a name/value pair identifying a series
+type Label struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+// Labels is a set of labels sorted by name
+type Labels []Label
+
+// FromMap builds labels from a map, leaving out empty values
+func FromMap(m map[string]string) Labels {
+	ls := make(Labels, 0, len(m))
+	for name, value := range m {
+		if value != "" {
+			ls = append(ls, Label{Name: name, Value: value})
+		}
+	}
+	sort.Slice(ls, func(i, j int) bool { return ls[i].Name < ls[j].Name })
+	return ls
+}
+
+// Map returns the labels as a map
+func (ls Labels) Map() map[string]string {
+	m := make(map[string]string, len(ls))
+	for _, l := range ls {
+		m[l.Name] = l.Value
+	}
+	return m
+}
+
+// Get returns the value of a label, or "" if it is not set
+func (ls Labels) Get(name string) string {
+	for _, l := range ls {
+		if l.Name == name {
+			return l.Value
+		}
+	}
+	return ""
+}
+
+// Without returns the labels other than the named ones
+func (ls Labels) Without(names ...string) Labels {
+	out := make(Labels, 0, len(ls))
+	for _, l := range ls {
+		if !containsString(names, l.Name) {
+			out = append(out, l)
+		}
+	}
+	return out
+}
+
+// Only returns the named labels
+func (ls Labels) Only(names ...string) Labels {
+	out := make(Labels, 0, len(names))
+	for _, l := range ls {
+		if containsString(names, l.Name) {
+			out = append(out, l)
+		}
+	}
+	return out
+}
+
+// key identifies the label set in maps
+func (ls Labels) key() string {
+	var b strings.Builder
+	for _, l := range ls {
+		b.WriteString(l.Name)
+		b.WriteByte(0xfe)
+		b.WriteString(l.Value)
+		b.WriteByte(0xff)
+	}
+	return b.String()
+}
+
+func (ls Labels) String() string {
+	parts := make([]string, len(ls))
+	for i, l := range ls {
+		parts[i] = fmt.Sprintf("%s=%q", l.Name, l.Value)
+	}
+	return "{" + strings.Join(parts, ", ") + "}"
+}
+
+func containsString(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// MatchType is a label matcher operator
+type MatchType string
+
+const (
+	MatchEqual     MatchType = "="
+	MatchNotEqual  MatchType = "!="
+	MatchRegexp    MatchType = "=~"
+	MatchNotRegexp MatchType = "!~"
+)
+
+// Matcher selects series by one label. Regular expressions are anchored
+// at both ends, as in PromQL. A missing label matches as the empty string.
+type Matcher struct {
+	Type  MatchType
+	Name  string
+	Value string
+	re    *regexp.Regexp
+}
+
+// NewMatcher creates a matcher, compiling its pattern if it has one
+func NewMatcher(t MatchType, name, value string) (*Matcher, error) {
+	m := &Matcher{Type: t, Name: name, Value: value}
+	switch t {
+	case MatchEqual, MatchNotEqual:
+	case MatchRegexp, MatchNotRegexp:
+		re, err := regexp.Compile("^(?:" + value + ")$")
+		if err != nil {
+			return nil, fmt.Errorf("invalid pattern %q: %w", value, err)
+		}
+		m.re = re
+	default:
+		return nil, fmt.Errorf("unknown match type %q", t)
+	}
+	return m, nil
+}
+
+// Matches reports whether a label value satisfies the matcher
+func (m *Matcher) Matches(value string) bool {
+	switch m.Type {
+	case MatchEqual:
+		return value == m.Value
+	case MatchNotEqual:
+		return value != m.Value
+	case MatchRegexp:
+		return m.re.MatchString(value)
+	case MatchNotRegexp:
+		return !m.re.MatchString(value)
+	}
+	return false
+}
+
+// matchAll reports whether the labels satisfy every matcher
+func matchAll(ls Labels, matchers []*Matcher) bool {
+	for _, m := range matchers {
+		if !m.Matches(ls.Get(m.Name)) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,499 @@
+package metricstore
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// The query language is a subset of PromQL:
+//
+//	http_requests_total{service_name="web", code=~"5.."}
+//	rate(http_requests_total[5m])
+//	sum by (service_name) (rate(http_requests_total[5m]))
+//	histogram_quantile(0.95, sum by (le) (rate(latency_bucket[5m])))
+//
+// Selectors take =, !=, =~ and !~ matchers and an optional range. The
+// functions are rate, increase and histogram_quantile, and the aggregations
+// sum, avg, min, max and count with an optional by or without clause.
+// Number literals are allowed; binary operators are not.
+
+var (
+	functions    = map[string]bool{"rate": true, "increase": true, "histogram_quantile": true}
+	aggregations = map[string]bool{"sum": true, "avg": true, "min": true, "max": true, "count": true}
+)
+
+// node is a parsed query expression
+type node interface{}
+
+type numberNode struct {
+	value float64
+}
+
+// selectorNode selects series by matchers; a range makes it a range
+// vector. series holds the samples loaded for evaluation.
+type selectorNode struct {
+	matchers []*Matcher
+	rng      time.Duration
+	series   []Series
+}
+
+type callNode struct {
+	fn   string
+	args []node
+}
+
+type aggregateNode struct {
+	op       string
+	without  bool
+	grouping []string
+	arg      node
+}
+
+// tokenKind classifies lexer tokens
+type tokenKind int
+
+const (
+	tokenEOF tokenKind = iota
+	tokenIdent
+	tokenString
+	tokenNumber
+	tokenDuration // the contents of [...]
+	tokenMatchOp
+	tokenLParen
+	tokenRParen
+	tokenLBrace
+	tokenRBrace
+	tokenComma
+)
+
+type token struct {
+	kind tokenKind
+	text string
+	num  float64
+	pos  int
+}
+
+// lex splits a query into tokens
+func lex(input string) ([]token, error) {
+	var tokens []token
+	i := 0
+
+	for i < len(input) {
+		c := input[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			i++
+
+		case c == '(':
+			tokens = append(tokens, token{kind: tokenLParen, pos: i})
+			i++
+		case c == ')':
+			tokens = append(tokens, token{kind: tokenRParen, pos: i})
+			i++
+		case c == '{':
+			tokens = append(tokens, token{kind: tokenLBrace, pos: i})
+			i++
+		case c == '}':
+			tokens = append(tokens, token{kind: tokenRBrace, pos: i})
+			i++
+		case c == ',':
+			tokens = append(tokens, token{kind: tokenComma, pos: i})
+			i++
+
+		case c == '[':
+			end := strings.IndexByte(input[i:], ']')
+			if end < 0 {
+				return nil, fmt.Errorf("unterminated range at %d", i)
+			}
+			text := strings.TrimSpace(input[i+1 : i+end])
+			tokens = append(tokens, token{kind: tokenDuration, text: text, pos: i})
+			i += end + 1
+
+		case c == '"' || c == '\'' || c == '`':
+			end := i + 1
+			for end < len(input) && input[end] != c {
+				if input[end] == '\\' && c != '`' {
+					end++
+				}
+				end++
+			}
+			if end >= len(input) {
+				return nil, fmt.Errorf("unterminated string at %d", i)
+			}
+			var s string
+			switch c {
+			case '`':
+				s = input[i+1 : end]
+			case '\'':
+				unquoted, err := strconv.Unquote(`"` + strings.ReplaceAll(input[i+1:end], `"`, `\"`) + `"`)
+				if err != nil {
+					return nil, fmt.Errorf("invalid string at %d: %w", i, err)
+				}
+				s = unquoted
+			default:
+				unquoted, err := strconv.Unquote(input[i : end+1])
+				if err != nil {
+					return nil, fmt.Errorf("invalid string at %d: %w", i, err)
+				}
+				s = unquoted
+			}
+			tokens = append(tokens, token{kind: tokenString, text: s, pos: i})
+			i = end + 1
+
+		case c >= '0' && c <= '9' || c == '.' || (c == '-' && i+1 < len(input) && (input[i+1] >= '0' && input[i+1] <= '9' || input[i+1] == '.')):
+			end := i + 1
+			for end < len(input) && (input[end] >= '0' && input[end] <= '9' || input[end] == '.' || input[end] == 'e' || input[end] == 'E' ||
+				(input[end] == '-' || input[end] == '+') && (input[end-1] == 'e' || input[end-1] == 'E')) {
+				end++
+			}
+			n, err := strconv.ParseFloat(input[i:end], 64)
+			if err != nil {
+				return nil, fmt.Errorf("invalid number %q at %d", input[i:end], i)
+			}
+			tokens = append(tokens, token{kind: tokenNumber, num: n, text: input[i:end], pos: i})
+			i = end
+
+		case c == '=' || c == '!':
+			op := string(c)
+			if i+1 < len(input) && (input[i+1] == '=' || input[i+1] == '~') {
+				op += string(input[i+1])
+			}
+			switch op {
+			case "=", "!=", "=~", "!~":
+				tokens = append(tokens, token{kind: tokenMatchOp, text: op, pos: i})
+			default:
+				return nil, fmt.Errorf("unsupported operator %q at %d", op, i)
+			}
+			i += len(op)
+
+		case c == '_' || c == ':' || unicode.IsLetter(rune(c)):
+			end := i + 1
+			for end < len(input) && (input[end] == '_' || input[end] == ':' || unicode.IsLetter(rune(input[end])) || unicode.IsDigit(rune(input[end]))) {
+				end++
+			}
+			tokens = append(tokens, token{kind: tokenIdent, text: input[i:end], pos: i})
+			i = end
+
+		default:
+			return nil, fmt.Errorf("unexpected character %q at %d", c, i)
+		}
+	}
+
+	return append(tokens, token{kind: tokenEOF, pos: len(input)}), nil
+}
+
+// parse parses a query
+func parse(query string) (node, error) {
+	tokens, err := lex(query)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &parser{tokens: tokens}
+	root, err := p.parseExpr()
+	if err != nil {
+		return nil, err
+	}
+	if t := p.peek(); t.kind != tokenEOF {
+		return nil, fmt.Errorf("unexpected token at %d", t.pos)
+	}
+	return root, nil
+}
+
+// parser is a recursive descent parser over tokens
+type parser struct {
+	tokens []token
+	pos    int
+}
+
+func (p *parser) peek() token {
+	return p.tokens[p.pos]
+}
+
+func (p *parser) next() token {
+	t := p.tokens[p.pos]
+	if t.kind != tokenEOF {
+		p.pos++
+	}
+	return t
+}
+
+func (p *parser) expect(kind tokenKind, what string) (token, error) {
+	t := p.next()
+	if t.kind != kind {
+		return t, fmt.Errorf("expected %s at %d", what, t.pos)
+	}
+	return t, nil
+}
+
+// parseExpr parses a number, selector, function call, aggregation or
+// parenthesized expression
+func (p *parser) parseExpr() (node, error) {
+	t := p.peek()
+	switch t.kind {
+	case tokenNumber:
+		p.next()
+		return &numberNode{value: t.num}, nil
+
+	case tokenLParen:
+		p.next()
+		n, err := p.parseExpr()
+		if err != nil {
+			return nil, err
+		}
+		if _, err := p.expect(tokenRParen, "')'"); err != nil {
+			return nil, err
+		}
+		return n, nil
+
+	case tokenLBrace:
+		return p.parseSelector("")
+
+	case tokenIdent:
+		p.next()
+		switch {
+		case t.text == "Inf" || t.text == "inf":
+			return &numberNode{value: math.Inf(1)}, nil
+		case t.text == "NaN" || t.text == "nan":
+			return &numberNode{value: math.NaN()}, nil
+		case aggregations[t.text]:
+			return p.parseAggregate(t.text)
+		case functions[t.text] && p.peek().kind == tokenLParen:
+			return p.parseCall(t.text)
+		case p.peek().kind == tokenLParen:
+			return nil, fmt.Errorf("unsupported function %q at %d", t.text, t.pos)
+		}
+		return p.parseSelector(t.text)
+	}
+	return nil, fmt.Errorf("unexpected token at %d", t.pos)
+}
+
+// parseSelector parses the optional matchers and range following a metric
+// name
+func (p *parser) parseSelector(name string) (node, error) {
+	sel := &selectorNode{}
+	if name != "" {
+		m, _ := NewMatcher(MatchEqual, MetricName, name)
+		sel.matchers = append(sel.matchers, m)
+	}
+
+	if p.peek().kind == tokenLBrace {
+		p.next()
+		for p.peek().kind != tokenRBrace {
+			label, err := p.expect(tokenIdent, "label name")
+			if err != nil {
+				return nil, err
+			}
+			op, err := p.expect(tokenMatchOp, "label matcher")
+			if err != nil {
+				return nil, err
+			}
+			value, err := p.expect(tokenString, "label value")
+			if err != nil {
+				return nil, err
+			}
+			m, err := NewMatcher(MatchType(op.text), label.text, value.text)
+			if err != nil {
+				return nil, fmt.Errorf("at %d: %w", op.pos, err)
+			}
+			sel.matchers = append(sel.matchers, m)
+
+			if p.peek().kind != tokenComma {
+				break
+			}
+			p.next()
+		}
+		if _, err := p.expect(tokenRBrace, "'}'"); err != nil {
+			return nil, err
+		}
+	}
+
+	if len(sel.matchers) == 0 {
+		return nil, fmt.Errorf("selector at %d needs a metric name or matcher", p.peek().pos)
+	}
+	nonEmpty := false
+	for _, m := range sel.matchers {
+		if !m.Matches("") {
+			nonEmpty = true
+		}
+	}
+	if !nonEmpty {
+		return nil, fmt.Errorf("selector at %d must have a matcher that does not match the empty string", p.peek().pos)
+	}
+
+	if t := p.peek(); t.kind == tokenDuration {
+		p.next()
+		rng, err := parseDuration(t.text)
+		if err != nil {
+			return nil, fmt.Errorf("invalid range at %d: %w", t.pos, err)
+		}
+		sel.rng = rng
+	}
+	return sel, nil
+}
+
+// parseCall parses a function's arguments and checks their types
+func (p *parser) parseCall(fn string) (node, error) {
+	open, _ := p.expect(tokenLParen, "'('")
+
+	call := &callNode{fn: fn}
+	for p.peek().kind != tokenRParen {
+		arg, err := p.parseExpr()
+		if err != nil {
+			return nil, err
+		}
+		call.args = append(call.args, arg)
+		if p.peek().kind != tokenComma {
+			break
+		}
+		p.next()
+	}
+	if _, err := p.expect(tokenRParen, "')'"); err != nil {
+		return nil, err
+	}
+
+	switch fn {
+	case "rate", "increase":
+		if len(call.args) != 1 || !isRange(call.args[0]) {
+			return nil, fmt.Errorf("%s at %d takes one range vector", fn, open.pos)
+		}
+	case "histogram_quantile":
+		if len(call.args) != 2 {
+			return nil, fmt.Errorf("%s at %d takes a quantile and a vector", fn, open.pos)
+		}
+		if _, ok := call.args[0].(*numberNode); !ok {
+			return nil, fmt.Errorf("%s at %d needs a number quantile", fn, open.pos)
+		}
+		if !isInstant(call.args[1]) {
+			return nil, fmt.Errorf("%s at %d needs an instant vector", fn, open.pos)
+		}
+	}
+	return call, nil
+}
+
+// parseAggregate parses an aggregation, with its by or without clause
+// before or after the argument
+func (p *parser) parseAggregate(op string) (node, error) {
+	agg := &aggregateNode{op: op}
+	if err := p.parseGrouping(agg); err != nil {
+		return nil, err
+	}
+
+	open, err := p.expect(tokenLParen, "'('")
+	if err != nil {
+		return nil, err
+	}
+	if agg.arg, err = p.parseExpr(); err != nil {
+		return nil, err
+	}
+	if _, err := p.expect(tokenRParen, "')'"); err != nil {
+		return nil, err
+	}
+	if !isInstant(agg.arg) {
+		return nil, fmt.Errorf("%s at %d needs an instant vector", op, open.pos)
+	}
+
+	if agg.grouping == nil {
+		if err := p.parseGrouping(agg); err != nil {
+			return nil, err
+		}
+	}
+	return agg, nil
+}
+
+// parseGrouping parses an optional by (...) or without (...) clause
+func (p *parser) parseGrouping(agg *aggregateNode) error {
+	t := p.peek()
+	if t.kind != tokenIdent || (t.text != "by" && t.text != "without") {
+		return nil
+	}
+	p.next()
+	agg.without = t.text == "without"
+
+	if _, err := p.expect(tokenLParen, "'('"); err != nil {
+		return err
+	}
+	agg.grouping = []string{}
+	for p.peek().kind != tokenRParen {
+		label, err := p.expect(tokenIdent, "label name")
+		if err != nil {
+			return err
+		}
+		agg.grouping = append(agg.grouping, label.text)
+		if p.peek().kind != tokenComma {
+			break
+		}
+		p.next()
+	}
+	_, err := p.expect(tokenRParen, "')'")
+	return err
+}
+
+// isRange reports whether n evaluates to a range vector
+func isRange(n node) bool {
+	sel, ok := n.(*selectorNode)
+	return ok && sel.rng > 0
+}
+
+// isInstant reports whether n evaluates to an instant vector
+func isInstant(n node) bool {
+	switch n := n.(type) {
+	case *selectorNode:
+		return n.rng == 0
+	case *callNode, *aggregateNode:
+		return true
+	}
+	return false
+}
+
+// parseDuration parses a PromQL duration such as 5m or 1h30m. Units are
+// ms, s, m, h, d, w and y.
+func parseDuration(s string) (time.Duration, error) {
+	units := map[string]time.Duration{
+		"ms": time.Millisecond,
+		"s":  time.Second,
+		"m":  time.Minute,
+		"h":  time.Hour,
+		"d":  24 * time.Hour,
+		"w":  7 * 24 * time.Hour,
+		"y":  365 * 24 * time.Hour,
+	}
+
+	if s == "" {
+		return 0, fmt.Errorf("empty duration")
+	}
+	var total time.Duration
+	for s != "" {
+		i := 0
+		for i < len(s) && s[i] >= '0' && s[i] <= '9' {
+			i++
+		}
+		if i == 0 {
+			return 0, fmt.Errorf("invalid duration %q", s)
+		}
+		n, err := strconv.ParseInt(s[:i], 10, 64)
+		if err != nil {
+			return 0, err
+		}
+		s = s[i:]
+
+		j := 0
+		for j < len(s) && (s[j] < '0' || s[j] > '9') {
+			j++
+		}
+		unit, ok := units[s[:j]]
+		if !ok {
+			return 0, fmt.Errorf("unknown duration unit %q", s[:j])
+		}
+		total += time.Duration(n) * unit
+		s = s[j:]
+	}
+	if total <= 0 {
+		return 0, fmt.Errorf("duration must be positive")
+	}
+	return total, nil
+}
@@ -0,0 +1,329 @@
+// Package metricstore is an embedded time-series store with a PromQL
+// subset. Samples are grouped into windows by timestamp. Open windows are
+// kept in memory as Gorilla-compressed chunks and logged to disk; once a
+// window has ended it is written out as a block with an inverted index on
+// label names and values. One process writes to a store directory while
+// others may open it read-only.
+package metricstore
+
+import (
+	"errors"
+	"io/fs"
+	"sort"
+	"time"
+
+	"github.com/gaurav/watchingcat/internal/config"
+	"github.com/gaurav/watchingcat/internal/windowstore"
+	"go.uber.org/zap"
+)
+
+const (
+	defaultBlockDuration = 2 * time.Hour
+	defaultRetention     = 15 * 24 * time.Hour
+
+	// lateSampleGrace keeps a window open for late samples after it ends
+	lateSampleGrace = 5 * time.Minute
+)
+
+var errReadOnly = errors.New("metric store is read-only")
+
+// Series is a labelled run of samples in time order
+type Series struct {
+	Labels  Labels   `json:"labels"`
+	Samples []Sample `json:"samples"`
+}
+
+// Store holds time series in a directory on disk
+type Store struct {
+	blockDuration time.Duration
+	retention     time.Duration
+	sync          bool
+	store         *windowstore.Store[Series, *head, *block]
+}
+
+// head is a window of samples not yet written to a block
+type head struct {
+	start  time.Time
+	series map[string]*memSeries // by labels key
+}
+
+func newHead(start time.Time) *head {
+	return &head{start: start, series: make(map[string]*memSeries)}
+}
+
+// memSeries holds a series' samples in a window
+type memSeries struct {
+	labels Labels
+	chunks []*chunk
+}
+
+// Add appends samples to the window's series. Samples not later than the
+// last one of their series are dropped, as a chunk only grows forwards.
+func (h *head) Add(series []Series) (dropped int) {
+	for _, s := range series {
+		key := s.Labels.key()
+		ms := h.series[key]
+		if ms == nil {
+			ms = &memSeries{labels: s.Labels}
+			h.series[key] = ms
+		}
+		for _, sample := range s.Samples {
+			if !ms.append(sample) {
+				dropped++
+			}
+		}
+	}
+	return dropped
+}
+
+func (s *memSeries) append(sample Sample) bool {
+	if n := len(s.chunks); n > 0 {
+		last := s.chunks[n-1]
+		if sample.T <= last.maxT {
+			return false
+		}
+		if last.count < maxChunkSamples {
+			last.append(sample)
+			return true
+		}
+	}
+	c := newChunk()
+	c.append(sample)
+	s.chunks = append(s.chunks, c)
+	return true
+}
+
+func (h *head) Len() int {
+	return len(h.series)
+}
+
+var format = windowstore.Format[Series, *head, *block]{
+	NewHead: newHead,
+	WritePart: func(dir string, h *head) (*block, error) {
+		return writeBlock(dir, h.series)
+	},
+	OpenPart: openBlock,
+}
+
+// Open opens the store for writing, creating its directory if needed and
+// recovering the windows logged by a previous run
+func Open(cfg config.MetricStoreConfig, logger *zap.Logger) (*Store, error) {
+	s := newStore(cfg)
+	store, err := windowstore.Open(s.config(cfg.Directory), format, logger)
+	if err != nil {
+		return nil, err
+	}
+	s.store = store
+	return s, nil
+}
+
+// OpenReader opens the store read-only. Blocks and samples written by the
+// writing process are picked up as queries arrive.
+func OpenReader(cfg config.MetricStoreConfig, logger *zap.Logger) (*Store, error) {
+	s := newStore(cfg)
+	store, err := windowstore.OpenReader(s.config(cfg.Directory), format, logger)
+	if err != nil {
+		return nil, err
+	}
+	s.store = store
+	return s, nil
+}
+
+func newStore(cfg config.MetricStoreConfig) *Store {
+	blockDuration := cfg.BlockDuration
+	if blockDuration <= 0 {
+		blockDuration = defaultBlockDuration
+	}
+	retention := cfg.Retention
+	if retention <= 0 {
+		retention = defaultRetention
+	}
+	return &Store{blockDuration: blockDuration, retention: retention, sync: cfg.Sync}
+}
+
+func (s *Store) config(dir string) windowstore.Config {
+	return windowstore.Config{
+		Name:      "metric store",
+		Part:      "block",
+		Directory: dir,
+		Window:    s.blockDuration,
+		Grace:     lateSampleGrace,
+		Retention: s.retention,
+		Sync:      s.sync,
+	}
+}
+
+// Write adds samples to the store. Samples older than the retention period
+// are dropped, as are samples not later than the last one written to their
+// series in the same window.
+func (s *Store) Write(series []Series) error {
+	if s.store.ReadOnly() {
+		return errReadOnly
+	}
+
+	cutoff := time.Now().Add(-s.retention).UnixMilli()
+	windows := make(map[int64][]Series)
+	for _, ser := range series {
+		byWindow := make(map[int64][]Sample)
+		for _, sample := range ser.Samples {
+			if sample.T < cutoff {
+				continue
+			}
+			start := time.UnixMilli(sample.T).Truncate(s.blockDuration).Unix()
+			byWindow[start] = append(byWindow[start], sample)
+		}
+		for start, samples := range byWindow {
+			windows[start] = append(windows[start], Series{Labels: ser.Labels, Samples: samples})
+		}
+	}
+	return s.store.Write(windows)
+}
+
+// Close stops background maintenance and closes the logs of open windows,
+// which are recovered when the store is next opened
+func (s *Store) Close() error {
+	return s.store.Close()
+}
+
+// Ping checks that the store's directory is accessible
+func (s *Store) Ping() error {
+	return s.store.Ping()
+}
+
+// Select returns the samples between mint and maxt, in milliseconds and
+// inclusive, of the series matching every matcher, ordered by labels
+func (s *Store) Select(mint, maxt int64, matchers ...*Matcher) ([]Series, error) {
+	parts := make(map[string][]Series)
+	err := s.store.View(func(heads []*head, blocks []*block) error {
+		for _, h := range heads {
+			end := h.start.Add(s.blockDuration).UnixMilli()
+			if h.start.UnixMilli() > maxt || end <= mint {
+				continue
+			}
+			for key, ms := range h.series {
+				if !matchAll(ms.labels, matchers) {
+					continue
+				}
+				var samples []Sample
+				for _, c := range ms.chunks {
+					if c.maxT < mint || c.minT > maxt {
+						continue
+					}
+					decoded, err := c.samples()
+					if err != nil {
+						return err
+					}
+					samples = append(samples, inRange(decoded, mint, maxt)...)
+				}
+				if len(samples) > 0 {
+					parts[key] = append(parts[key], Series{Labels: ms.labels, Samples: samples})
+				}
+			}
+		}
+		for _, b := range blocks {
+			series, err := b.selectSeries(mint, maxt, matchers)
+			if errors.Is(err, fs.ErrNotExist) {
+				// Deleted by retention since the block was listed
+				continue
+			}
+			if err != nil {
+				return err
+			}
+			for _, ser := range series {
+				key := ser.Labels.key()
+				parts[key] = append(parts[key], ser)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	keys := make([]string, 0, len(parts))
+	for key := range parts {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	out := make([]Series, 0, len(keys))
+	for _, key := range keys {
+		out = append(out, mergeSeries(parts[key]))
+	}
+	return out, nil
+}
+
+// mergeSeries combines the parts of one series read from several places,
+// ordering samples by time and dropping duplicate timestamps
+func mergeSeries(parts []Series) Series {
+	if len(parts) == 1 {
+		return parts[0]
+	}
+
+	var samples []Sample
+	for _, p := range parts {
+		samples = append(samples, p.Samples...)
+	}
+	sort.SliceStable(samples, func(i, j int) bool { return samples[i].T < samples[j].T })
+
+	out := samples[:0]
+	for i, sample := range samples {
+		if i > 0 && sample.T == out[len(out)-1].T {
+			continue
+		}
+		out = append(out, sample)
+	}
+	return Series{Labels: parts[0].Labels, Samples: out}
+}
+
+// LabelNames returns the names of all labels in the store, sorted
+func (s *Store) LabelNames() []string {
+	set := make(map[string]bool)
+	s.store.View(func(heads []*head, blocks []*block) error {
+		for _, h := range heads {
+			for _, ms := range h.series {
+				for _, l := range ms.labels {
+					set[l.Name] = true
+				}
+			}
+		}
+		for _, b := range blocks {
+			for _, name := range b.labelNames() {
+				set[name] = true
+			}
+		}
+		return nil
+	})
+	return sortedNames(set)
+}
+
+// LabelValues returns the values of a label across all series, sorted
+func (s *Store) LabelValues(name string) []string {
+	set := make(map[string]bool)
+	s.store.View(func(heads []*head, blocks []*block) error {
+		for _, h := range heads {
+			for _, ms := range h.series {
+				set[ms.labels.Get(name)] = true
+			}
+		}
+		for _, b := range blocks {
+			for _, value := range b.labelValues(name) {
+				set[value] = true
+			}
+		}
+		return nil
+	})
+	return sortedNames(set)
+}
+
+// sortedNames returns the non-empty names in the set, sorted
+func sortedNames(set map[string]bool) []string {
+	names := make([]string, 0, len(set))
+	for name := range set {
+		if name != "" {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
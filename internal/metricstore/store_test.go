@@ -0,0 +1,259 @@
+package metricstore
+
+import (
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/gaurav/watchingcat/internal/config"
+	"go.uber.org/zap"
+)
+
+func openTestStore(t *testing.T, dir string) *Store {
+	t.Helper()
+	s, err := Open(config.MetricStoreConfig{Directory: dir}, zap.NewNop())
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	t.Cleanup(func() { s.Close() })
+	return s
+}
+
+func testSeries(name string, labels map[string]string, samples ...Sample) Series {
+	m := map[string]string{MetricName: name}
+	for k, v := range labels {
+		m[k] = v
+	}
+	return Series{Labels: FromMap(m), Samples: samples}
+}
+
+func mustMatcher(t *testing.T, typ MatchType, name, value string) *Matcher {
+	t.Helper()
+	m, err := NewMatcher(typ, name, value)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return m
+}
+
+// counts returns the number of open windows and blocks
+func counts(s *Store) (heads, blocks int) {
+	s.store.View(func(h []*head, b []*block) error {
+		heads, blocks = len(h), len(b)
+		return nil
+	})
+	return heads, blocks
+}
+
+func TestChunkRoundTrip(t *testing.T) {
+	samples := []Sample{
+		{T: 1000, V: 1},
+		{T: 2000, V: 1},
+		{T: 3000, V: 2.5},
+		{T: 3001, V: -7},
+		{T: 9000, V: math.Inf(1)},
+		{T: 5_000_000, V: 1e-300},
+		{T: 5_000_001, V: 0},
+		{T: 9_000_000_000, V: 42},
+	}
+	c := newChunk()
+	for _, s := range samples {
+		c.append(s)
+	}
+
+	decoded, err := decodeChunk(c.bytes(), c.count)
+	if err != nil {
+		t.Fatalf("decodeChunk failed: %v", err)
+	}
+	if len(decoded) != len(samples) {
+		t.Fatalf("Expected %d samples, got %d", len(samples), len(decoded))
+	}
+	for i := range samples {
+		if decoded[i] != samples[i] {
+			t.Errorf("Sample %d: expected %v, got %v", i, samples[i], decoded[i])
+		}
+	}
+
+	// Regular samples compress well below 16 bytes each
+	c = newChunk()
+	for i := 0; i < maxChunkSamples; i++ {
+		c.append(Sample{T: int64(i) * 15000, V: float64(i / 10)})
+	}
+	if size := len(c.bytes()); size > maxChunkSamples*2 {
+		t.Errorf("Expected a compact chunk, got %d bytes", size)
+	}
+}
+
+func TestStoreSelect(t *testing.T) {
+	s := openTestStore(t, t.TempDir())
+	now := time.Now().UnixMilli()
+
+	err := s.Write([]Series{
+		testSeries("requests_total", map[string]string{"service_name": "web", "code": "200"}, Sample{T: now - 2000, V: 1}, Sample{T: now - 1000, V: 2}),
+		testSeries("requests_total", map[string]string{"service_name": "web", "code": "500"}, Sample{T: now - 1000, V: 1}),
+		testSeries("requests_total", map[string]string{"service_name": "api", "code": "200"}, Sample{T: now - 1000, V: 5}),
+		testSeries("queue_depth", map[string]string{"service_name": "api"}, Sample{T: now, V: 3}),
+	})
+	if err != nil {
+		t.Fatalf("Write failed: %v", err)
+	}
+
+	series, err := s.Select(now-time.Hour.Milliseconds(), now,
+		mustMatcher(t, MatchEqual, MetricName, "requests_total"),
+		mustMatcher(t, MatchEqual, "service_name", "web"),
+	)
+	if err != nil || len(series) != 2 || len(series[0].Samples) != 2 {
+		t.Fatalf("Expected two web series, got %+v %v", series, err)
+	}
+
+	series, _ = s.Select(now-time.Hour.Milliseconds(), now, mustMatcher(t, MatchRegexp, "code", "5.."))
+	if len(series) != 1 || series[0].Labels.Get("service_name") != "web" {
+		t.Errorf("Expected the 500 series, got %+v", series)
+	}
+	// A matcher that matches a missing label selects series without it
+	series, _ = s.Select(now-time.Hour.Milliseconds(), now,
+		mustMatcher(t, MatchEqual, "service_name", "api"),
+		mustMatcher(t, MatchEqual, "code", ""),
+	)
+	if len(series) != 1 || series[0].Labels.Get(MetricName) != "queue_depth" {
+		t.Errorf("Expected queue_depth, got %+v", series)
+	}
+	series, _ = s.Select(now-1500, now, mustMatcher(t, MatchEqual, MetricName, "requests_total"))
+	if len(series) != 3 || len(series[len(series)-1].Samples) != 1 {
+		t.Errorf("Expected the time range to trim samples, got %+v", series)
+	}
+
+	// Out-of-order samples are dropped
+	if err := s.Write([]Series{testSeries("queue_depth", map[string]string{"service_name": "api"}, Sample{T: now - 5000, V: 9})}); err != nil {
+		t.Fatalf("Write failed: %v", err)
+	}
+	series, _ = s.Select(0, now, mustMatcher(t, MatchEqual, MetricName, "queue_depth"))
+	if len(series) != 1 || len(series[0].Samples) != 1 {
+		t.Errorf("Expected the late sample to be dropped, got %+v", series)
+	}
+
+	if got := s.LabelNames(); len(got) != 3 || got[0] != MetricName {
+		t.Errorf("Unexpected label names %v", got)
+	}
+	if got := s.LabelValues("service_name"); len(got) != 2 || got[0] != "api" {
+		t.Errorf("Unexpected label values %v", got)
+	}
+}
+
+func TestStoreBlocks(t *testing.T) {
+	dir := t.TempDir()
+	s := openTestStore(t, dir)
+	start := time.Now().Add(-5 * time.Hour).Truncate(2 * time.Hour).UnixMilli()
+
+	var samples []Sample
+	for i := 0; i < 300; i++ {
+		samples = append(samples, Sample{T: start + int64(i)*15000, V: float64(i)})
+	}
+	err := s.Write([]Series{
+		testSeries("requests_total", map[string]string{"service_name": "web"}, samples...),
+		testSeries("requests_total", map[string]string{"service_name": "api"}, Sample{T: start, V: 1}),
+	})
+	if err != nil {
+		t.Fatalf("Write failed: %v", err)
+	}
+	s.store.Maintain(time.Now())
+
+	if heads, blocks := counts(s); heads != 0 || blocks != 1 {
+		t.Fatalf("Expected the window to be cut into a block, got %d heads and %d blocks", heads, blocks)
+	}
+	logs, _ := os.ReadDir(filepath.Join(dir, "wal"))
+	if len(logs) != 0 {
+		t.Errorf("Expected the window's log to be removed, got %d", len(logs))
+	}
+
+	series, err := s.Select(start+100*15000, start+199*15000, mustMatcher(t, MatchEqual, "service_name", "web"))
+	if err != nil || len(series) != 1 || len(series[0].Samples) != 100 || series[0].Samples[0].V != 100 {
+		t.Fatalf("Expected 100 samples from the block, got %+v %v", series, err)
+	}
+	series, _ = s.Select(start, start+time.Hour.Milliseconds(), mustMatcher(t, MatchNotEqual, "service_name", "web"), mustMatcher(t, MatchEqual, MetricName, "requests_total"))
+	if len(series) != 1 || series[0].Labels.Get("service_name") != "api" {
+		t.Errorf("Expected the api series, got %+v", series)
+	}
+	if got := s.LabelValues("service_name"); len(got) != 2 {
+		t.Errorf("Expected label values from the block index, got %v", got)
+	}
+
+	// Late samples reopen the window and are merged with the block on read
+	if err := s.Write([]Series{testSeries("requests_total", map[string]string{"service_name": "api"}, Sample{T: start + 1000, V: 2})}); err != nil {
+		t.Fatalf("Write failed: %v", err)
+	}
+	series, _ = s.Select(start, start+time.Hour.Milliseconds(), mustMatcher(t, MatchEqual, "service_name", "api"))
+	if len(series) != 1 || len(series[0].Samples) != 2 {
+		t.Errorf("Expected samples from the block and the log, got %+v", series)
+	}
+
+	// Past the retention period blocks are deleted
+	s.store.Maintain(time.Now().Add(defaultRetention + 4*time.Hour))
+	if _, blocks := counts(s); blocks != 0 {
+		t.Errorf("Expected expired blocks to be deleted, got %d", blocks)
+	}
+}
+
+func TestStoreRecovery(t *testing.T) {
+	dir := t.TempDir()
+	s := openTestStore(t, dir)
+	now := time.Now().UnixMilli()
+	labels := map[string]string{"service_name": "web"}
+	if err := s.Write([]Series{testSeries("up", labels, Sample{T: now - 1000, V: 1})}); err != nil {
+		t.Fatalf("Write failed: %v", err)
+	}
+	if err := s.Write([]Series{testSeries("up", labels, Sample{T: now, V: 0})}); err != nil {
+		t.Fatalf("Write failed: %v", err)
+	}
+	s.Close()
+
+	// Tear the last record, as a crash mid-write would
+	logs, _ := filepath.Glob(filepath.Join(dir, "wal", "*.wal"))
+	if len(logs) != 1 {
+		t.Fatalf("Expected one log, got %v", logs)
+	}
+	info, _ := os.Stat(logs[0])
+	if err := os.Truncate(logs[0], info.Size()-3); err != nil {
+		t.Fatal(err)
+	}
+
+	s = openTestStore(t, dir)
+	series, err := s.Select(0, now, mustMatcher(t, MatchEqual, MetricName, "up"))
+	if err != nil || len(series) != 1 || len(series[0].Samples) != 1 || series[0].Samples[0].V != 1 {
+		t.Fatalf("Expected the intact record to be recovered, got %+v %v", series, err)
+	}
+}
+
+func TestStoreReader(t *testing.T) {
+	dir := t.TempDir()
+	w := openTestStore(t, dir)
+	r, err := OpenReader(config.MetricStoreConfig{Directory: dir}, zap.NewNop())
+	if err != nil {
+		t.Fatalf("OpenReader failed: %v", err)
+	}
+	r.store.RefreshEvery = 0
+
+	if err := r.Write(nil); err != errReadOnly {
+		t.Errorf("Expected writes to a reader to fail, got %v", err)
+	}
+
+	old := time.Now().Add(-5 * time.Hour).UnixMilli()
+	if err := w.Write([]Series{testSeries("up", map[string]string{"job": "a"}, Sample{T: old, V: 1})}); err != nil {
+		t.Fatalf("Write failed: %v", err)
+	}
+	if series, err := r.Select(0, old, mustMatcher(t, MatchEqual, MetricName, "up")); err != nil || len(series) != 1 {
+		t.Fatalf("Expected the reader to see logged samples, got %+v %v", series, err)
+	}
+
+	w.store.Maintain(time.Now())
+	now := time.Now().UnixMilli()
+	if err := w.Write([]Series{testSeries("up", map[string]string{"job": "b"}, Sample{T: now, V: 1})}); err != nil {
+		t.Fatalf("Write failed: %v", err)
+	}
+	series, _ := r.Select(0, now, mustMatcher(t, MatchEqual, MetricName, "up"))
+	if len(series) != 2 || len(series[0].Samples) != 1 {
+		t.Errorf("Expected series from the block and the new log, got %+v", series)
+	}
+}
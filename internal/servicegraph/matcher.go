@@ -0,0 +1,110 @@
+package servicegraph
+
+// spanKey identifies a span within its trace
+type spanKey struct {
+	traceID string
+	spanID  string
+}
+
+// pendingEntry records the insertion order of a remembered span or of the
+// children waiting for a parent, for eviction
+type pendingEntry struct {
+	key     spanKey
+	waiting bool
+}
+
+// Matcher pairs spans with their parents as they arrive. Spans may arrive in
+// any order and across batches: seen spans are remembered so later children
+// find their parent, and children are held until their parent arrives. At
+// most maxPending entries are kept; the oldest are forgotten first.
+//
+// Matcher is not safe for concurrent use.
+type Matcher struct {
+	maxPending int
+	spans      map[spanKey]Span
+	waiting    map[spanKey][]Span // children by parent key
+	order      []pendingEntry
+}
+
+// NewMatcher creates a matcher remembering up to maxPending spans
+func NewMatcher(maxPending int) *Matcher {
+	if maxPending <= 0 {
+		maxPending = 1
+	}
+	return &Matcher{
+		maxPending: maxPending,
+		spans:      make(map[spanKey]Span),
+		waiting:    make(map[spanKey][]Span),
+	}
+}
+
+// Add records a span and returns the calls it completes: one with its parent
+// if the parent has been seen, and one for each child that was waiting for
+// it. Parent and child spans of the same service are not calls.
+func (m *Matcher) Add(span Span) []Call {
+	var calls []Call
+
+	key := spanKey{span.TraceID, span.SpanID}
+	if children, ok := m.waiting[key]; ok {
+		delete(m.waiting, key)
+		for _, child := range children {
+			if call, ok := newCall(span, child); ok {
+				calls = append(calls, call)
+			}
+		}
+	}
+
+	if span.ParentID != "" {
+		parentKey := spanKey{span.TraceID, span.ParentID}
+		if parent, ok := m.spans[parentKey]; ok {
+			if call, ok := newCall(parent, span); ok {
+				calls = append(calls, call)
+			}
+		} else {
+			if _, ok := m.waiting[parentKey]; !ok {
+				m.remember(pendingEntry{key: parentKey, waiting: true})
+			}
+			m.waiting[parentKey] = append(m.waiting[parentKey], span)
+		}
+	}
+
+	if _, ok := m.spans[key]; !ok {
+		m.remember(pendingEntry{key: key})
+	}
+	m.spans[key] = span
+
+	return calls
+}
+
+// Pending returns the number of remembered spans and waiting parents
+func (m *Matcher) Pending() int {
+	return len(m.order)
+}
+
+// remember appends an entry, evicting the oldest when full
+func (m *Matcher) remember(entry pendingEntry) {
+	for len(m.order) >= m.maxPending {
+		oldest := m.order[0]
+		m.order = m.order[1:]
+		if oldest.waiting {
+			delete(m.waiting, oldest.key)
+		} else {
+			delete(m.spans, oldest.key)
+		}
+	}
+	m.order = append(m.order, entry)
+}
+
+// newCall builds the call from parent to child, if they belong to
+// different services
+func newCall(parent, child Span) (Call, bool) {
+	if parent.Service == "" || child.Service == "" || parent.Service == child.Service {
+		return Call{}, false
+	}
+	return Call{
+		Client:   parent.Service,
+		Server:   child.Service,
+		Duration: child.Duration,
+		Error:    child.Error,
+	}, true
+}
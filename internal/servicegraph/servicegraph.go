@@ -0,0 +1,178 @@
+// Package servicegraph derives service-to-service call edges from the
+// parent/child relationships between spans.
+package servicegraph
+
+import (
+	"math"
+	"sort"
+	"time"
+
+	"github.com/gaurav/watchingcat/internal/dao"
+	"github.com/gaurav/watchingcat/pkg/models"
+)
+
+// Span is the part of a span needed to build the graph
+type Span struct {
+	TraceID  string
+	SpanID   string
+	ParentID string
+	Service  string
+	Duration time.Duration
+	Error    bool
+}
+
+// Call is a request from the parent span's service to the child span's
+// service. Duration and Error are taken from the server side.
+type Call struct {
+	Client   string
+	Server   string
+	Duration time.Duration
+	Error    bool
+}
+
+// Edge aggregates the calls from one service to another
+type Edge struct {
+	Client string  `json:"client"`
+	Server string  `json:"server"`
+	Calls  uint64  `json:"calls"`
+	Errors uint64  `json:"errors"`
+	P50Ms  float64 `json:"p50_ms"`
+	P95Ms  float64 `json:"p95_ms"`
+	P99Ms  float64 `json:"p99_ms"`
+}
+
+// FromModels converts collector spans
+func FromModels(spans []models.Span) []Span {
+	converted := make([]Span, 0, len(spans))
+	for _, s := range spans {
+		converted = append(converted, Span{
+			TraceID:  s.TraceID,
+			SpanID:   s.SpanID,
+			ParentID: s.ParentID,
+			Service:  s.Attributes["service.name"],
+			Duration: s.EndTime.Sub(s.StartTime),
+			Error:    s.Status.Code == "ERROR",
+		})
+	}
+	return converted
+}
+
+// FromJaeger converts the spans of a Jaeger trace. The parent is the first
+// CHILD_OF reference, falling back to the first reference of any type.
+func FromJaeger(trace dao.Trace) []Span {
+	converted := make([]Span, 0, len(trace.Spans))
+	for _, s := range trace.Spans {
+		parentID := ""
+		for _, ref := range s.References {
+			if ref.RefType == "CHILD_OF" {
+				parentID = ref.SpanID
+				break
+			}
+		}
+		if parentID == "" && len(s.References) > 0 {
+			parentID = s.References[0].SpanID
+		}
+
+		converted = append(converted, Span{
+			TraceID:  s.TraceID,
+			SpanID:   s.SpanID,
+			ParentID: parentID,
+			Service:  trace.Processes[s.ProcessID].ServiceName,
+			Duration: time.Duration(s.Duration) * time.Microsecond,
+			Error:    jaegerError(s.Tags),
+		})
+	}
+	return converted
+}
+
+// jaegerError reports whether span tags mark the span as failed
+func jaegerError(tags []dao.Tag) bool {
+	for _, tag := range tags {
+		switch tag.Key {
+		case "error":
+			if v, ok := tag.Value.(bool); ok && v {
+				return true
+			}
+			if v, ok := tag.Value.(string); ok && v == "true" {
+				return true
+			}
+		case "otel.status_code":
+			if v, ok := tag.Value.(string); ok && v == "ERROR" {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Build returns the edges between services found in complete traces, sorted
+// by client and server
+func Build(spans []Span) []Edge {
+	// Each span may hold an entry for itself and one for its waiting children
+	matcher := NewMatcher(2 * len(spans))
+
+	var calls []Call
+	for _, span := range spans {
+		calls = append(calls, matcher.Add(span)...)
+	}
+
+	return Aggregate(calls)
+}
+
+// Aggregate groups calls into edges with latency percentiles
+func Aggregate(calls []Call) []Edge {
+	type edgeKey struct{ client, server string }
+	type edgeCalls struct {
+		errors    uint64
+		durations []float64
+	}
+
+	byEdge := make(map[edgeKey]*edgeCalls)
+	for _, call := range calls {
+		key := edgeKey{call.Client, call.Server}
+		e, ok := byEdge[key]
+		if !ok {
+			e = &edgeCalls{}
+			byEdge[key] = e
+		}
+		if call.Error {
+			e.errors++
+		}
+		e.durations = append(e.durations, float64(call.Duration)/float64(time.Millisecond))
+	}
+
+	edges := make([]Edge, 0, len(byEdge))
+	for key, e := range byEdge {
+		sort.Float64s(e.durations)
+		edges = append(edges, Edge{
+			Client: key.client,
+			Server: key.server,
+			Calls:  uint64(len(e.durations)),
+			Errors: e.errors,
+			P50Ms:  percentile(e.durations, 0.50),
+			P95Ms:  percentile(e.durations, 0.95),
+			P99Ms:  percentile(e.durations, 0.99),
+		})
+	}
+
+	sort.Slice(edges, func(i, j int) bool {
+		if edges[i].Client != edges[j].Client {
+			return edges[i].Client < edges[j].Client
+		}
+		return edges[i].Server < edges[j].Server
+	})
+
+	return edges
+}
+
+// percentile returns the nearest-rank percentile of sorted values
+func percentile(sorted []float64, p float64) float64 {
+	if len(sorted) == 0 {
+		return 0
+	}
+	rank := int(math.Ceil(p*float64(len(sorted)))) - 1
+	if rank < 0 {
+		rank = 0
+	}
+	return sorted[rank]
+}
@@ -0,0 +1,86 @@
+package servicegraph
+
+import (
+	"testing"
+	"time"
+
+	"github.com/gaurav/watchingcat/internal/dao"
+)
+
+func TestBuildEdges(t *testing.T) {
+	spans := []Span{
+		// Children arrive before their parents
+		{TraceID: "t1", SpanID: "b", ParentID: "a", Service: "cart", Duration: 20 * time.Millisecond},
+		{TraceID: "t1", SpanID: "c", ParentID: "a", Service: "catalog", Duration: 5 * time.Millisecond, Error: true},
+		{TraceID: "t1", SpanID: "a", Service: "frontend", Duration: 30 * time.Millisecond},
+		// Internal spans of one service are not calls
+		{TraceID: "t1", SpanID: "d", ParentID: "b", Service: "cart", Duration: time.Millisecond},
+		{TraceID: "t2", SpanID: "a", Service: "frontend", Duration: 50 * time.Millisecond},
+		{TraceID: "t2", SpanID: "b", ParentID: "a", Service: "cart", Duration: 40 * time.Millisecond},
+	}
+
+	edges := Build(spans)
+	if len(edges) != 2 {
+		t.Fatalf("Expected 2 edges, got %+v", edges)
+	}
+
+	cart := edges[0]
+	if cart.Client != "frontend" || cart.Server != "cart" || cart.Calls != 2 || cart.Errors != 0 {
+		t.Errorf("Unexpected cart edge %+v", cart)
+	}
+	if cart.P50Ms != 20 || cart.P99Ms != 40 {
+		t.Errorf("Expected p50 20ms and p99 40ms, got %v and %v", cart.P50Ms, cart.P99Ms)
+	}
+
+	catalog := edges[1]
+	if catalog.Server != "catalog" || catalog.Calls != 1 || catalog.Errors != 1 {
+		t.Errorf("Unexpected catalog edge %+v", catalog)
+	}
+}
+
+func TestMatcherEvictsOldest(t *testing.T) {
+	m := NewMatcher(3)
+
+	for _, id := range []string{"a", "x", "y", "z"} {
+		m.Add(Span{TraceID: "t", SpanID: id, Service: "frontend"})
+	}
+
+	if calls := m.Add(Span{TraceID: "t", SpanID: "b", ParentID: "a", Service: "cart"}); len(calls) != 0 {
+		t.Errorf("Expected the evicted parent not to match, got %+v", calls)
+	}
+	if calls := m.Add(Span{TraceID: "t", SpanID: "c", ParentID: "z", Service: "cart"}); len(calls) != 1 {
+		t.Errorf("Expected a call to the remembered parent, got %+v", calls)
+	}
+	if m.Pending() > 3 {
+		t.Errorf("Expected at most 3 pending entries, got %d", m.Pending())
+	}
+}
+
+func TestFromJaeger(t *testing.T) {
+	trace := dao.Trace{
+		TraceID: "t1",
+		Spans: []dao.Span{
+			{TraceID: "t1", SpanID: "a", ProcessID: "p1", Duration: 3000},
+			{
+				TraceID:    "t1",
+				SpanID:     "b",
+				ProcessID:  "p2",
+				Duration:   1000,
+				References: []dao.Reference{{RefType: "CHILD_OF", TraceID: "t1", SpanID: "a"}},
+				Tags:       []dao.Tag{{Key: "error", Type: "bool", Value: true}},
+			},
+		},
+		Processes: map[string]dao.Process{
+			"p1": {ServiceName: "frontend"},
+			"p2": {ServiceName: "checkout"},
+		},
+	}
+
+	edges := Build(FromJaeger(trace))
+	if len(edges) != 1 {
+		t.Fatalf("Expected 1 edge, got %+v", edges)
+	}
+	if e := edges[0]; e.Client != "frontend" || e.Server != "checkout" || e.Errors != 1 || e.P50Ms != 1 {
+		t.Errorf("Unexpected edge %+v", e)
+	}
+}
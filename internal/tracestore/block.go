@@ -0,0 +1,333 @@
+package tracestore
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gaurav/watchingcat/internal/windowstore"
+	"github.com/gaurav/watchingcat/pkg/models"
+)
+
+const (
+	dataFile  = "data"
+	indexFile = "index"
+
+	servicePrefix   = "service:"
+	operationPrefix = "operation:"
+	tagPrefix       = "tag:"
+)
+
+// block is an immutable set of traces on disk. The data file holds one gzip
+// member per trace containing its spans as JSON. The gzipped JSON index maps
+// trace IDs to their member and lists the traces containing each service,
+// operation and tag, so searches only decompress likely matches.
+type block struct {
+	dir   string
+	index blockIndex
+}
+
+type blockIndex struct {
+	MinTime time.Time    `json:"min_time"`
+	MaxTime time.Time    `json:"max_time"`
+	Traces  []traceEntry `json:"traces"` // sorted by ID
+	// Postings maps a service, operation or tag term to the ascending
+	// positions in Traces of the traces containing it
+	Postings map[string][]int `json:"postings"`
+}
+
+// traceEntry locates a trace in the data file and summarizes its spans.
+// Start and End bound the spans' start times.
+type traceEntry struct {
+	ID          string        `json:"id"`
+	Offset      int64         `json:"offset"`
+	Length      int64         `json:"length"`
+	Start       time.Time     `json:"start"`
+	End         time.Time     `json:"end"`
+	MinDuration time.Duration `json:"min_duration"`
+	MaxDuration time.Duration `json:"max_duration"`
+}
+
+func serviceTerm(service string) string {
+	return servicePrefix + service
+}
+
+func operationTerm(service, operation string) string {
+	return operationPrefix + service + "\x00" + operation
+}
+
+func tagTerm(key, value string) string {
+	return tagPrefix + key + "\x00" + value
+}
+
+// writeBlock writes traces to a new block directory. The block is built
+// under a temporary name and renamed into place once complete.
+func writeBlock(dir string, traces map[string][]models.Span) (*block, error) {
+	tmp := dir + windowstore.TmpExt
+	if err := os.MkdirAll(tmp, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create block: %w", err)
+	}
+	defer os.RemoveAll(tmp)
+
+	ids := make([]string, 0, len(traces))
+	for id := range traces {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	var data bytes.Buffer
+	index := blockIndex{Postings: make(map[string][]int)}
+	for i, id := range ids {
+		spans := mergeSpans(traces[id])
+
+		entry := traceEntry{ID: id, Offset: int64(data.Len())}
+		zw := gzip.NewWriter(&data)
+		if err := json.NewEncoder(zw).Encode(spans); err != nil {
+			return nil, fmt.Errorf("failed to encode trace %s: %w", id, err)
+		}
+		if err := zw.Close(); err != nil {
+			return nil, fmt.Errorf("failed to compress trace %s: %w", id, err)
+		}
+		entry.Length = int64(data.Len()) - entry.Offset
+
+		terms := make(map[string]bool)
+		for j, s := range spans {
+			duration := s.EndTime.Sub(s.StartTime)
+			if j == 0 || duration < entry.MinDuration {
+				entry.MinDuration = duration
+			}
+			if j == 0 || duration > entry.MaxDuration {
+				entry.MaxDuration = duration
+			}
+
+			service := s.Attributes[serviceNameKey]
+			terms[serviceTerm(service)] = true
+			terms[operationTerm(service, s.Name)] = true
+			spanTags(s, func(k, v string) {
+				terms[tagTerm(k, v)] = true
+			})
+		}
+		entry.Start = spans[0].StartTime
+		entry.End = spans[len(spans)-1].StartTime
+		for term := range terms {
+			index.Postings[term] = append(index.Postings[term], i)
+		}
+
+		if i == 0 || entry.Start.Before(index.MinTime) {
+			index.MinTime = entry.Start
+		}
+		if i == 0 || entry.End.After(index.MaxTime) {
+			index.MaxTime = entry.End
+		}
+		index.Traces = append(index.Traces, entry)
+	}
+
+	if err := writeFile(filepath.Join(tmp, dataFile), data.Bytes()); err != nil {
+		return nil, err
+	}
+
+	var encoded bytes.Buffer
+	zw := gzip.NewWriter(&encoded)
+	if err := json.NewEncoder(zw).Encode(index); err != nil {
+		return nil, fmt.Errorf("failed to encode block index: %w", err)
+	}
+	if err := zw.Close(); err != nil {
+		return nil, fmt.Errorf("failed to compress block index: %w", err)
+	}
+	if err := writeFile(filepath.Join(tmp, indexFile), encoded.Bytes()); err != nil {
+		return nil, err
+	}
+
+	if err := os.Rename(tmp, dir); err != nil {
+		return nil, fmt.Errorf("failed to commit block: %w", err)
+	}
+	return &block{dir: dir, index: index}, nil
+}
+
+// writeFile writes and syncs a block file
+func writeFile(path string, data []byte) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("failed to create %s: %w", path, err)
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return fmt.Errorf("failed to write %s: %w", path, err)
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return fmt.Errorf("failed to sync %s: %w", path, err)
+	}
+	return f.Close()
+}
+
+// openBlock loads a block's index
+func openBlock(dir string) (*block, error) {
+	f, err := os.Open(filepath.Join(dir, indexFile))
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	zr, err := gzip.NewReader(f)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read block index: %w", err)
+	}
+	var index blockIndex
+	if err := json.NewDecoder(zr).Decode(&index); err != nil {
+		return nil, fmt.Errorf("failed to decode block index: %w", err)
+	}
+	return &block{dir: dir, index: index}, nil
+}
+
+// MaxTime returns the latest start time of the block's spans
+func (b *block) MaxTime() time.Time {
+	return b.index.MaxTime
+}
+
+// trace reads a trace's spans, returning nil if the block does not hold it
+func (b *block) trace(id string) ([]models.Span, error) {
+	traces := b.index.Traces
+	i := sort.Search(len(traces), func(i int) bool { return traces[i].ID >= id })
+	if i == len(traces) || traces[i].ID != id {
+		return nil, nil
+	}
+	entry := traces[i]
+
+	f, err := os.Open(filepath.Join(b.dir, dataFile))
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	zr, err := gzip.NewReader(io.NewSectionReader(f, entry.Offset, entry.Length))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read trace %s: %w", id, err)
+	}
+	var spans []models.Span
+	if err := json.NewDecoder(zr).Decode(&spans); err != nil {
+		return nil, fmt.Errorf("failed to decode trace %s: %w", id, err)
+	}
+	return spans, nil
+}
+
+// candidates returns the traces that may match the query according to the
+// index. The spans still have to be checked, since the index does not
+// record which span carried each term.
+func (b *block) candidates(q Query) []traceEntry {
+	if !q.Start.IsZero() && b.index.MaxTime.Before(q.Start) ||
+		!q.End.IsZero() && b.index.MinTime.After(q.End) {
+		return nil
+	}
+
+	var lists [][]int
+	if q.Service != "" {
+		lists = append(lists, b.index.Postings[serviceTerm(q.Service)])
+	}
+	if q.Operation != "" && q.Service != "" {
+		lists = append(lists, b.index.Postings[operationTerm(q.Service, q.Operation)])
+	} else if q.Operation != "" {
+		lists = append(lists, b.operationPostings(q.Operation))
+	}
+	for k, v := range q.Tags {
+		lists = append(lists, b.index.Postings[tagTerm(k, v)])
+	}
+
+	var positions []int
+	if len(lists) == 0 {
+		positions = make([]int, len(b.index.Traces))
+		for i := range positions {
+			positions[i] = i
+		}
+	}
+	for i, postings := range lists {
+		if i == 0 {
+			positions = postings
+		} else {
+			positions = intersect(positions, postings)
+		}
+		if len(positions) == 0 {
+			return nil
+		}
+	}
+
+	var entries []traceEntry
+	for _, i := range positions {
+		e := b.index.Traces[i]
+		switch {
+		case !q.Start.IsZero() && e.End.Before(q.Start),
+			!q.End.IsZero() && e.Start.After(q.End),
+			q.MinDuration > 0 && e.MaxDuration < q.MinDuration,
+			q.MaxDuration > 0 && e.MinDuration > q.MaxDuration:
+			continue
+		}
+		entries = append(entries, e)
+	}
+	return entries
+}
+
+// operationPostings unions the postings of an operation across all services
+func (b *block) operationPostings(operation string) []int {
+	set := make(map[int]bool)
+	for term, postings := range b.index.Postings {
+		if strings.HasPrefix(term, operationPrefix) && strings.HasSuffix(term, "\x00"+operation) {
+			for _, i := range postings {
+				set[i] = true
+			}
+		}
+	}
+	positions := make([]int, 0, len(set))
+	for i := range set {
+		positions = append(positions, i)
+	}
+	sort.Ints(positions)
+	return positions
+}
+
+// services returns the services seen in the block
+func (b *block) services() []string {
+	var services []string
+	for term := range b.index.Postings {
+		if service, ok := strings.CutPrefix(term, servicePrefix); ok {
+			services = append(services, service)
+		}
+	}
+	return services
+}
+
+// operations returns the operations of a service seen in the block
+func (b *block) operations(service string) []string {
+	var operations []string
+	prefix := operationPrefix + service + "\x00"
+	for term := range b.index.Postings {
+		if operation, ok := strings.CutPrefix(term, prefix); ok {
+			operations = append(operations, operation)
+		}
+	}
+	return operations
+}
+
+// intersect returns the positions present in both ascending lists
+func intersect(a, b []int) []int {
+	var out []int
+	for i, j := 0, 0; i < len(a) && j < len(b); {
+		switch {
+		case a[i] < b[j]:
+			i++
+		case a[i] > b[j]:
+			j++
+		default:
+			out = append(out, a[i])
+			i++
+			j++
+		}
+	}
+	return out
+}
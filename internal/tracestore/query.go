@@ -0,0 +1,119 @@
+package tracestore
+
+import (
+	"sort"
+	"time"
+
+	"github.com/gaurav/watchingcat/pkg/models"
+)
+
+const serviceNameKey = "service.name"
+
+// Trace is the spans of one trace, ordered by start time
+type Trace struct {
+	ID    string
+	Spans []models.Span
+}
+
+// Start returns the start time of the trace's earliest span
+func (t Trace) Start() time.Time {
+	if len(t.Spans) == 0 {
+		return time.Time{}
+	}
+	return t.Spans[0].StartTime
+}
+
+// Query selects traces with at least one span meeting every condition. Zero
+// fields are not checked; a zero Limit returns all matches.
+type Query struct {
+	Service     string
+	Operation   string
+	MinDuration time.Duration
+	MaxDuration time.Duration
+	Start       time.Time
+	End         time.Time
+	Tags        map[string]string
+	Limit       int
+}
+
+// matchSpan reports whether one span meets all of the query's conditions
+func (q Query) matchSpan(s models.Span) bool {
+	duration := s.EndTime.Sub(s.StartTime)
+	switch {
+	case q.Service != "" && s.Attributes[serviceNameKey] != q.Service,
+		q.Operation != "" && s.Name != q.Operation,
+		q.MinDuration > 0 && duration < q.MinDuration,
+		q.MaxDuration > 0 && duration > q.MaxDuration,
+		!q.Start.IsZero() && s.StartTime.Before(q.Start),
+		!q.End.IsZero() && s.StartTime.After(q.End):
+		return false
+	}
+	for k, v := range q.Tags {
+		if value, ok := tagValue(s, k); !ok || value != v {
+			return false
+		}
+	}
+	return true
+}
+
+// match reports whether any span of the trace meets the query
+func (q Query) match(t Trace) bool {
+	for _, s := range t.Spans {
+		if q.matchSpan(s) {
+			return true
+		}
+	}
+	return false
+}
+
+// tagValue looks a tag up in the span's attributes, falling back to the
+// tags Jaeger derives from the span kind and status
+func tagValue(s models.Span, key string) (string, bool) {
+	if v, ok := s.Attributes[key]; ok {
+		return v, true
+	}
+	switch key {
+	case "span.kind":
+		return s.Kind, s.Kind != ""
+	case "otel.status_code":
+		return s.Status.Code, s.Status.Code != ""
+	case "error":
+		return "true", s.Status.Code == "ERROR"
+	}
+	return "", false
+}
+
+// spanTags calls fn for every attribute and derived tag of the span
+func spanTags(s models.Span, fn func(key, value string)) {
+	for k, v := range s.Attributes {
+		fn(k, v)
+	}
+	for _, key := range []string{"span.kind", "otel.status_code", "error"} {
+		if _, ok := s.Attributes[key]; ok {
+			continue
+		}
+		if v, ok := tagValue(s, key); ok {
+			fn(key, v)
+		}
+	}
+}
+
+// mergeSpans combines spans of the same trace read from several places,
+// dropping duplicates by span ID and ordering them by start time
+func mergeSpans(parts ...[]models.Span) []models.Span {
+	seen := make(map[string]bool)
+	var spans []models.Span
+	for _, part := range parts {
+		for _, s := range part {
+			if seen[s.SpanID] {
+				continue
+			}
+			seen[s.SpanID] = true
+			spans = append(spans, s)
+		}
+	}
+	sort.SliceStable(spans, func(i, j int) bool {
+		return spans[i].StartTime.Before(spans[j].StartTime)
+	})
+	return spans
+}
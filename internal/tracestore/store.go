@@ -0,0 +1,316 @@
+// Package tracestore is an embedded trace store. Spans are grouped into
+// windows by start time. Open windows are kept in memory and logged to
+// disk; once a window has ended it is written out as a compressed, indexed
+// block. One process writes to a store directory while others may open it
+// read-only.
+package tracestore
+
+import (
+	"errors"
+	"io/fs"
+	"sort"
+	"time"
+
+	"github.com/gaurav/watchingcat/internal/config"
+	"github.com/gaurav/watchingcat/internal/windowstore"
+	"github.com/gaurav/watchingcat/pkg/models"
+	"go.uber.org/zap"
+)
+
+const (
+	defaultBlockDuration = time.Hour
+	defaultRetention     = 72 * time.Hour
+
+	// lateSpanGrace keeps a window open for late spans after it ends
+	lateSpanGrace = 5 * time.Minute
+)
+
+// ErrTraceNotFound is returned by GetTrace for unknown trace IDs
+var ErrTraceNotFound = errors.New("trace not found")
+
+var errReadOnly = errors.New("trace store is read-only")
+
+// Store holds traces in a directory on disk
+type Store struct {
+	blockDuration time.Duration
+	retention     time.Duration
+	sync          bool
+	store         *windowstore.Store[models.Span, *head, *block]
+}
+
+// head is a window of spans not yet written to a block
+type head struct {
+	start  time.Time
+	traces map[string][]models.Span
+}
+
+func newHead(start time.Time) *head {
+	return &head{start: start, traces: make(map[string][]models.Span)}
+}
+
+func (h *head) Add(spans []models.Span) int {
+	for _, s := range spans {
+		h.traces[s.TraceID] = append(h.traces[s.TraceID], s)
+	}
+	return 0
+}
+
+func (h *head) Len() int {
+	return len(h.traces)
+}
+
+var format = windowstore.Format[models.Span, *head, *block]{
+	NewHead: newHead,
+	WritePart: func(dir string, h *head) (*block, error) {
+		return writeBlock(dir, h.traces)
+	},
+	OpenPart: openBlock,
+}
+
+// Open opens the store for writing, creating its directory if needed and
+// recovering the windows logged by a previous run
+func Open(cfg config.TraceStoreConfig, logger *zap.Logger) (*Store, error) {
+	s := newStore(cfg)
+	store, err := windowstore.Open(s.config(cfg.Directory), format, logger)
+	if err != nil {
+		return nil, err
+	}
+	s.store = store
+	return s, nil
+}
+
+// OpenReader opens the store read-only. Blocks and spans written by the
+// writing process are picked up as queries arrive.
+func OpenReader(cfg config.TraceStoreConfig, logger *zap.Logger) (*Store, error) {
+	s := newStore(cfg)
+	store, err := windowstore.OpenReader(s.config(cfg.Directory), format, logger)
+	if err != nil {
+		return nil, err
+	}
+	s.store = store
+	return s, nil
+}
+
+func newStore(cfg config.TraceStoreConfig) *Store {
+	blockDuration := cfg.BlockDuration
+	if blockDuration <= 0 {
+		blockDuration = defaultBlockDuration
+	}
+	retention := cfg.Retention
+	if retention <= 0 {
+		retention = defaultRetention
+	}
+	return &Store{blockDuration: blockDuration, retention: retention, sync: cfg.Sync}
+}
+
+func (s *Store) config(dir string) windowstore.Config {
+	return windowstore.Config{
+		Name:      "trace store",
+		Part:      "block",
+		Directory: dir,
+		Window:    s.blockDuration,
+		Grace:     lateSpanGrace,
+		Retention: s.retention,
+		Sync:      s.sync,
+	}
+}
+
+// Write adds spans to the store. Spans older than the retention period are
+// dropped.
+func (s *Store) Write(spans []models.Span) error {
+	if s.store.ReadOnly() {
+		return errReadOnly
+	}
+
+	cutoff := time.Now().Add(-s.retention)
+	windows := make(map[int64][]models.Span)
+	for _, span := range spans {
+		if span.StartTime.Before(cutoff) {
+			continue
+		}
+		start := span.StartTime.Truncate(s.blockDuration).Unix()
+		windows[start] = append(windows[start], span)
+	}
+	return s.store.Write(windows)
+}
+
+// Close stops background maintenance and closes the logs of open windows,
+// which are recovered when the store is next opened
+func (s *Store) Close() error {
+	return s.store.Close()
+}
+
+// Ping checks that the store's directory is accessible
+func (s *Store) Ping() error {
+	return s.store.Ping()
+}
+
+// GetTrace returns all spans of a trace
+func (s *Store) GetTrace(id string) (Trace, error) {
+	var t Trace
+	err := s.store.View(func(heads []*head, blocks []*block) (err error) {
+		t, err = trace(id, heads, blocks)
+		return err
+	})
+	return t, err
+}
+
+// trace gathers a trace's spans from open windows and blocks
+func trace(id string, heads []*head, blocks []*block) (Trace, error) {
+	var parts [][]models.Span
+	for _, h := range heads {
+		if spans := h.traces[id]; len(spans) > 0 {
+			parts = append(parts, spans)
+		}
+	}
+	for _, b := range blocks {
+		spans, err := b.trace(id)
+		if errors.Is(err, fs.ErrNotExist) {
+			// Deleted by retention since the block was listed
+			continue
+		}
+		if err != nil {
+			return Trace{}, err
+		}
+		if len(spans) > 0 {
+			parts = append(parts, spans)
+		}
+	}
+
+	if len(parts) == 0 {
+		return Trace{}, ErrTraceNotFound
+	}
+	return Trace{ID: id, Spans: mergeSpans(parts...)}, nil
+}
+
+// FindTraces returns the traces matching the query, most recent first.
+// Candidates are taken from the block indexes and open windows, then
+// checked against the full trace.
+func (s *Store) FindTraces(q Query) ([]Trace, error) {
+	var traces []Trace
+	err := s.store.View(func(heads []*head, blocks []*block) (err error) {
+		traces, err = findTraces(q, heads, blocks)
+		return err
+	})
+	return traces, err
+}
+
+func findTraces(q Query, heads []*head, blocks []*block) ([]Trace, error) {
+	starts := make(map[string]time.Time)
+	candidate := func(id string, start time.Time) {
+		if prev, ok := starts[id]; !ok || start.After(prev) {
+			starts[id] = start
+		}
+	}
+	for _, h := range heads {
+		for id, spans := range h.traces {
+			if q.match(Trace{ID: id, Spans: spans}) {
+				candidate(id, earliest(spans))
+			}
+		}
+	}
+	for _, b := range blocks {
+		for _, e := range b.candidates(q) {
+			candidate(e.ID, e.Start)
+		}
+	}
+
+	ids := make([]string, 0, len(starts))
+	for id := range starts {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool {
+		if !starts[ids[i]].Equal(starts[ids[j]]) {
+			return starts[ids[i]].After(starts[ids[j]])
+		}
+		return ids[i] < ids[j]
+	})
+
+	var traces []Trace
+	for _, id := range ids {
+		if q.Limit > 0 && len(traces) >= q.Limit {
+			break
+		}
+		t, err := trace(id, heads, blocks)
+		if errors.Is(err, ErrTraceNotFound) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		if q.match(t) {
+			traces = append(traces, t)
+		}
+	}
+
+	sort.SliceStable(traces, func(i, j int) bool {
+		return traces[i].Start().After(traces[j].Start())
+	})
+	return traces, nil
+}
+
+func earliest(spans []models.Span) time.Time {
+	start := spans[0].StartTime
+	for _, s := range spans[1:] {
+		if s.StartTime.Before(start) {
+			start = s.StartTime
+		}
+	}
+	return start
+}
+
+// Services returns the names of all services with spans in the store
+func (s *Store) Services() []string {
+	set := make(map[string]bool)
+	s.store.View(func(heads []*head, blocks []*block) error {
+		for _, h := range heads {
+			for _, spans := range h.traces {
+				for _, span := range spans {
+					set[span.Attributes[serviceNameKey]] = true
+				}
+			}
+		}
+		for _, b := range blocks {
+			for _, service := range b.services() {
+				set[service] = true
+			}
+		}
+		return nil
+	})
+	return sortedNames(set)
+}
+
+// Operations returns the span names seen for a service
+func (s *Store) Operations(service string) []string {
+	set := make(map[string]bool)
+	s.store.View(func(heads []*head, blocks []*block) error {
+		for _, h := range heads {
+			for _, spans := range h.traces {
+				for _, span := range spans {
+					if span.Attributes[serviceNameKey] == service {
+						set[span.Name] = true
+					}
+				}
+			}
+		}
+		for _, b := range blocks {
+			for _, operation := range b.operations(service) {
+				set[operation] = true
+			}
+		}
+		return nil
+	})
+	return sortedNames(set)
+}
+
+// sortedNames returns the non-empty names in the set, sorted
+func sortedNames(set map[string]bool) []string {
+	names := make([]string, 0, len(set))
+	for name := range set {
+		if name != "" {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
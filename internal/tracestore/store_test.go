@@ -0,0 +1,222 @@
+package tracestore
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/gaurav/watchingcat/internal/config"
+	"github.com/gaurav/watchingcat/pkg/models"
+	"go.uber.org/zap"
+)
+
+func testSpan(traceID, spanID, service, name string, start time.Time, duration time.Duration) models.Span {
+	return models.Span{
+		TraceID:    traceID,
+		SpanID:     spanID,
+		Name:       name,
+		Kind:       "server",
+		StartTime:  start,
+		EndTime:    start.Add(duration),
+		Attributes: map[string]string{"service.name": service},
+		Status:     models.SpanStatus{Code: "OK"},
+	}
+}
+
+func openTestStore(t *testing.T, dir string) *Store {
+	t.Helper()
+	s, err := Open(config.TraceStoreConfig{Directory: dir}, zap.NewNop())
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	t.Cleanup(func() { s.Close() })
+	return s
+}
+
+func TestStoreQueries(t *testing.T) {
+	s := openTestStore(t, t.TempDir())
+	now := time.Now().Truncate(time.Millisecond)
+
+	slow := testSpan("t2", "c", "db", "query", now.Add(-time.Minute), 2*time.Second)
+	slow.Attributes["db.system"] = "postgres"
+	slow.Status.Code = "ERROR"
+	err := s.Write([]models.Span{
+		testSpan("t1", "a", "web", "GET /", now.Add(-2*time.Minute), 10*time.Millisecond),
+		testSpan("t1", "b", "db", "query", now.Add(-2*time.Minute+time.Millisecond), 5*time.Millisecond),
+		testSpan("t2", "d", "web", "GET /cart", now.Add(-time.Minute-time.Millisecond), 3*time.Second),
+		slow,
+	})
+	if err != nil {
+		t.Fatalf("Write failed: %v", err)
+	}
+
+	trace, err := s.GetTrace("t1")
+	if err != nil || len(trace.Spans) != 2 || trace.Spans[0].SpanID != "a" {
+		t.Fatalf("Expected t1 with its spans in start order, got %+v %v", trace, err)
+	}
+	if _, err := s.GetTrace("missing"); err != ErrTraceNotFound {
+		t.Errorf("Expected ErrTraceNotFound, got %v", err)
+	}
+
+	traces, _ := s.FindTraces(Query{Service: "db"})
+	if len(traces) != 2 || traces[0].ID != "t2" {
+		t.Errorf("Expected both traces newest first, got %+v", traces)
+	}
+	traces, _ = s.FindTraces(Query{Service: "db", MinDuration: time.Second})
+	if len(traces) != 1 || traces[0].ID != "t2" {
+		t.Errorf("Expected only the slow trace, got %+v", traces)
+	}
+	// A single span has to satisfy every condition
+	traces, _ = s.FindTraces(Query{Service: "web", Operation: "query"})
+	if len(traces) != 0 {
+		t.Errorf("Expected no match across spans, got %+v", traces)
+	}
+	traces, _ = s.FindTraces(Query{Tags: map[string]string{"db.system": "postgres", "error": "true"}})
+	if len(traces) != 1 || traces[0].ID != "t2" {
+		t.Errorf("Expected a match on tags, got %+v", traces)
+	}
+	traces, _ = s.FindTraces(Query{Limit: 1})
+	if len(traces) != 1 || traces[0].ID != "t2" {
+		t.Errorf("Expected the limit to keep the newest trace, got %+v", traces)
+	}
+
+	if got := s.Services(); len(got) != 2 || got[0] != "db" || got[1] != "web" {
+		t.Errorf("Unexpected services %v", got)
+	}
+	if got := s.Operations("web"); len(got) != 2 || got[0] != "GET /" || got[1] != "GET /cart" {
+		t.Errorf("Unexpected operations %v", got)
+	}
+}
+
+// counts returns the number of open windows and blocks
+func counts(s *Store) (heads, blocks int) {
+	s.store.View(func(h []*head, b []*block) error {
+		heads, blocks = len(h), len(b)
+		return nil
+	})
+	return heads, blocks
+}
+
+func TestStoreBlocks(t *testing.T) {
+	dir := t.TempDir()
+	s := openTestStore(t, dir)
+	start := time.Now().Add(-3 * time.Hour).Truncate(time.Hour)
+
+	err := s.Write([]models.Span{
+		testSpan("t1", "a", "web", "GET /", start.Add(time.Minute), 10*time.Millisecond),
+		testSpan("t2", "b", "api", "POST /order", start.Add(2*time.Minute), 2*time.Second),
+	})
+	if err != nil {
+		t.Fatalf("Write failed: %v", err)
+	}
+	s.store.Maintain(time.Now())
+
+	if heads, blocks := counts(s); heads != 0 || blocks != 1 {
+		t.Fatalf("Expected the window to be cut into a block, got %d heads and %d blocks", heads, blocks)
+	}
+	logs, _ := os.ReadDir(filepath.Join(dir, "wal"))
+	if len(logs) != 0 {
+		t.Errorf("Expected the window's log to be removed, got %d", len(logs))
+	}
+
+	// Late spans reopen the window and are merged with the block on read
+	late := testSpan("t1", "c", "db", "query", start.Add(time.Minute+time.Millisecond), time.Millisecond)
+	if err := s.Write([]models.Span{late}); err != nil {
+		t.Fatalf("Write failed: %v", err)
+	}
+	trace, err := s.GetTrace("t1")
+	if err != nil || len(trace.Spans) != 2 {
+		t.Fatalf("Expected spans from the block and the log, got %+v %v", trace, err)
+	}
+
+	traces, _ := s.FindTraces(Query{Service: "api", MinDuration: time.Second})
+	if len(traces) != 1 || traces[0].ID != "t2" {
+		t.Errorf("Expected the block index to find t2, got %+v", traces)
+	}
+	traces, _ = s.FindTraces(Query{Service: "api", MaxDuration: time.Second})
+	if len(traces) != 0 {
+		t.Errorf("Expected the duration index to exclude t2, got %+v", traces)
+	}
+	if got := s.Operations("api"); len(got) != 1 || got[0] != "POST /order" {
+		t.Errorf("Unexpected operations %v", got)
+	}
+
+	// Past the retention period blocks are deleted
+	s.store.Maintain(time.Now().Add(defaultRetention + 2*time.Hour))
+	if _, blocks := counts(s); blocks != 0 {
+		t.Errorf("Expected expired blocks to be deleted, got %d", blocks)
+	}
+}
+
+func TestStoreRecovery(t *testing.T) {
+	dir := t.TempDir()
+	s := openTestStore(t, dir)
+	now := time.Now()
+	if err := s.Write([]models.Span{testSpan("t1", "a", "web", "GET /", now, time.Millisecond)}); err != nil {
+		t.Fatalf("Write failed: %v", err)
+	}
+	if err := s.Write([]models.Span{testSpan("t1", "b", "web", "render", now, time.Millisecond)}); err != nil {
+		t.Fatalf("Write failed: %v", err)
+	}
+	s.Close()
+
+	// Tear the last record, as a crash mid-write would
+	logs, _ := filepath.Glob(filepath.Join(dir, "wal", "*.wal"))
+	if len(logs) != 1 {
+		t.Fatalf("Expected one log, got %v", logs)
+	}
+	info, _ := os.Stat(logs[0])
+	if err := os.Truncate(logs[0], info.Size()-3); err != nil {
+		t.Fatal(err)
+	}
+
+	s = openTestStore(t, dir)
+	trace, err := s.GetTrace("t1")
+	if err != nil || len(trace.Spans) != 1 || trace.Spans[0].SpanID != "a" {
+		t.Fatalf("Expected the intact record to be recovered, got %+v %v", trace, err)
+	}
+
+	// New records follow the last intact one
+	if err := s.Write([]models.Span{testSpan("t1", "c", "web", "render", now, time.Millisecond)}); err != nil {
+		t.Fatalf("Write failed: %v", err)
+	}
+	s.Close()
+	s = openTestStore(t, dir)
+	if trace, _ := s.GetTrace("t1"); len(trace.Spans) != 2 {
+		t.Errorf("Expected two spans after reopening, got %+v", trace)
+	}
+}
+
+func TestStoreReader(t *testing.T) {
+	dir := t.TempDir()
+	w := openTestStore(t, dir)
+	r, err := OpenReader(config.TraceStoreConfig{Directory: dir}, zap.NewNop())
+	if err != nil {
+		t.Fatalf("OpenReader failed: %v", err)
+	}
+	r.store.RefreshEvery = 0
+
+	if err := r.Write(nil); err != errReadOnly {
+		t.Errorf("Expected writes to a reader to fail, got %v", err)
+	}
+
+	old := time.Now().Add(-3 * time.Hour)
+	if err := w.Write([]models.Span{testSpan("t1", "a", "web", "GET /", old, time.Millisecond)}); err != nil {
+		t.Fatalf("Write failed: %v", err)
+	}
+	if trace, err := r.GetTrace("t1"); err != nil || len(trace.Spans) != 1 {
+		t.Fatalf("Expected the reader to see logged spans, got %+v %v", trace, err)
+	}
+
+	w.store.Maintain(time.Now())
+	if err := w.Write([]models.Span{testSpan("t2", "b", "api", "GET /", time.Now(), time.Millisecond)}); err != nil {
+		t.Fatalf("Write failed: %v", err)
+	}
+	if got := r.Services(); len(got) != 2 {
+		t.Errorf("Expected services from the block and the new log, got %v", got)
+	}
+	if trace, err := r.GetTrace("t1"); err != nil || len(trace.Spans) != 1 {
+		t.Errorf("Expected t1 once from its block, got %+v %v", trace, err)
+	}
+}
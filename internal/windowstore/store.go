@@ -0,0 +1,536 @@
+// Package windowstore is the storage shared by the embedded trace, metric
+// and log stores. Records are grouped into windows by time. Open windows are
+// kept in memory and logged to disk; once a window has ended it is written
+// out as an immutable part, and parts past the retention period are
+// deleted. One process writes to a store directory while others may open
+// it read-only.
+//
+// Each store supplies a Format: how an open window holds records in memory
+// and how a part is written and read.
+package windowstore
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+const (
+	maintenanceInterval = time.Minute
+	refreshInterval     = time.Second
+
+	walDir = "wal"
+	walExt = ".wal"
+
+	// TmpExt marks a part still being written. Parts are built under it and
+	// renamed into place once complete.
+	TmpExt = ".tmp"
+)
+
+// Head is an open window's records in memory
+type Head[R any] interface {
+	// Add adds records to the window and returns how many it dropped
+	Add(records []R) (dropped int)
+	// Len returns the number of records in the window
+	Len() int
+}
+
+// Part is a window written to disk
+type Part interface {
+	// MaxTime returns the time of the part's latest record
+	MaxTime() time.Time
+}
+
+// Format is how a store keeps records in memory and on disk
+type Format[R any, H Head[R], P Part] struct {
+	NewHead   func(start time.Time) H
+	WritePart func(dir string, head H) (P, error)
+	OpenPart  func(dir string) (P, error)
+}
+
+// Config describes a store directory
+type Config struct {
+	Name      string // names the store in errors and logs, e.g. "trace store"
+	Part      string // what a part is called, e.g. "block"; parts are kept in its plural
+	Directory string
+	Window    time.Duration // span of record times per window
+	Grace     time.Duration // keeps a window open for late records after it ends
+	Retention time.Duration
+	Sync      bool // fsync each write before it returns
+}
+
+// Store holds windows of records in a directory on disk
+type Store[R any, H Head[R], P Part] struct {
+	cfg      Config
+	format   Format[R, H, P]
+	partsDir string
+	readOnly bool
+	logger   *zap.Logger
+
+	// RefreshEvery is how often a read-only store looks for the writer's
+	// changes
+	RefreshEvery time.Duration
+
+	mu        sync.RWMutex
+	windows   map[int64]*window[H] // by start in Unix seconds
+	parts     map[string]P         // by directory name
+	closed    bool
+	refreshed time.Time
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+// window is an open window and its log
+type window[H any] struct {
+	start  time.Time
+	path   string
+	head   H
+	file   *os.File    // the writer's open log
+	offset int64       // how far a reader has read the log
+	info   os.FileInfo // the log a reader has read, to notice it being replaced
+}
+
+// Open opens the store for writing, creating its directory if needed and
+// recovering the windows logged by a previous run
+func Open[R any, H Head[R], P Part](cfg Config, format Format[R, H, P], logger *zap.Logger) (*Store[R, H, P], error) {
+	s, err := newStore(cfg, format, false, logger)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, dir := range []string{walDir, s.partsDir} {
+		if err := os.MkdirAll(filepath.Join(cfg.Directory, dir), 0o755); err != nil {
+			return nil, fmt.Errorf("failed to create %s: %w", cfg.Name, err)
+		}
+	}
+
+	// Remove parts left half-written by a crash
+	tmp, _ := filepath.Glob(filepath.Join(cfg.Directory, s.partsDir, "*"+TmpExt))
+	for _, dir := range tmp {
+		os.RemoveAll(dir)
+	}
+
+	if err := s.syncParts(); err != nil {
+		return nil, err
+	}
+	if err := s.recover(); err != nil {
+		s.closeWindows()
+		return nil, err
+	}
+
+	s.stop = make(chan struct{})
+	s.done = make(chan struct{})
+	go s.run()
+
+	s.logger.Info("Store opened",
+		zap.String("directory", cfg.Directory),
+		zap.Int(s.partsDir, len(s.parts)),
+		zap.Int("open_windows", len(s.windows)),
+	)
+
+	return s, nil
+}
+
+// OpenReader opens the store read-only. Parts and records written by the
+// writing process are picked up by View.
+func OpenReader[R any, H Head[R], P Part](cfg Config, format Format[R, H, P], logger *zap.Logger) (*Store[R, H, P], error) {
+	return newStore(cfg, format, true, logger)
+}
+
+func newStore[R any, H Head[R], P Part](cfg Config, format Format[R, H, P], readOnly bool, logger *zap.Logger) (*Store[R, H, P], error) {
+	if cfg.Directory == "" {
+		return nil, fmt.Errorf("%s directory is required", cfg.Name)
+	}
+
+	return &Store[R, H, P]{
+		cfg:          cfg,
+		format:       format,
+		partsDir:     cfg.Part + "s",
+		readOnly:     readOnly,
+		logger:       logger.With(zap.String("store", cfg.Name)),
+		RefreshEvery: refreshInterval,
+		windows:      make(map[int64]*window[H]),
+		parts:        make(map[string]P),
+	}, nil
+}
+
+// ReadOnly reports whether the store was opened with OpenReader
+func (s *Store[R, H, P]) ReadOnly() bool {
+	return s.readOnly
+}
+
+// Write logs records to the windows starting at the given Unix seconds and
+// adds them to the windows' heads. Unless the store syncs, the records can
+// be lost to a power failure once Write returns, though not to a crash of
+// the process.
+func (s *Store[R, H, P]) Write(windows map[int64][]R) error {
+	if s.readOnly {
+		return fmt.Errorf("%s is read-only", s.cfg.Name)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return fmt.Errorf("%s is closed", s.cfg.Name)
+	}
+
+	for start, batch := range windows {
+		w, err := s.openWindow(start)
+		if err != nil {
+			return err
+		}
+		if err := appendEntry(w.file, batch, s.cfg.Sync); err != nil {
+			return err
+		}
+		if dropped := w.head.Add(batch); dropped > 0 {
+			s.logger.Debug("Dropped records", zap.Int("records", dropped))
+		}
+	}
+
+	return nil
+}
+
+// openWindow returns the window starting at start, creating its log if
+// needed. Must be called with mu held.
+func (s *Store[R, H, P]) openWindow(start int64) (*window[H], error) {
+	if w, ok := s.windows[start]; ok {
+		return w, nil
+	}
+
+	path := filepath.Join(s.cfg.Directory, walDir, strconv.FormatInt(start, 10)+walExt)
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open %s log: %w", s.cfg.Name, err)
+	}
+
+	w := s.newWindow(start, path)
+	w.file = f
+	s.windows[start] = w
+	return w, nil
+}
+
+func (s *Store[R, H, P]) newWindow(start int64, path string) *window[H] {
+	return &window[H]{
+		start: time.Unix(start, 0),
+		path:  path,
+		head:  s.format.NewHead(time.Unix(start, 0)),
+	}
+}
+
+// recover reloads the windows logged by a previous run. A torn or corrupt
+// entry ends a log; it is truncated there so new entries follow the last
+// intact one.
+func (s *Store[R, H, P]) recover() error {
+	entries, err := os.ReadDir(filepath.Join(s.cfg.Directory, walDir))
+	if err != nil {
+		return fmt.Errorf("failed to read %s log: %w", s.cfg.Name, err)
+	}
+
+	for _, entry := range entries {
+		start, ok := parseWindow(entry.Name())
+		if !ok {
+			continue
+		}
+		path := filepath.Join(s.cfg.Directory, walDir, entry.Name())
+
+		records, offset, err := readEntries[R](path, 0)
+		if errors.Is(err, errCorruptEntry) {
+			s.logger.Warn("Truncating log at a corrupt entry",
+				zap.String("path", path),
+				zap.Int64("offset", offset),
+			)
+		} else if err != nil {
+			return fmt.Errorf("failed to read %s: %w", path, err)
+		}
+		if err := os.Truncate(path, offset); err != nil {
+			return fmt.Errorf("failed to truncate %s: %w", path, err)
+		}
+
+		w, err := s.openWindow(start)
+		if err != nil {
+			return err
+		}
+		w.head.Add(records)
+	}
+
+	return nil
+}
+
+// parseWindow extracts the window start from a log file name
+func parseWindow(name string) (int64, bool) {
+	if !strings.HasSuffix(name, walExt) {
+		return 0, false
+	}
+	start, err := strconv.ParseInt(strings.TrimSuffix(name, walExt), 10, 64)
+	return start, err == nil
+}
+
+// run cuts finished windows into parts and applies retention until the
+// store is closed
+func (s *Store[R, H, P]) run() {
+	defer close(s.done)
+
+	ticker := time.NewTicker(maintenanceInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.stop:
+			return
+		case now := <-ticker.C:
+			s.Maintain(now)
+		}
+	}
+}
+
+// Maintain writes the windows that ended before now, allowing for late
+// records, to parts and deletes parts past the retention period. It runs
+// every minute while the store is open for writing.
+func (s *Store[R, H, P]) Maintain(now time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for start, w := range s.windows {
+		if now.Before(w.start.Add(s.cfg.Window + s.cfg.Grace)) {
+			continue
+		}
+		if err := s.cut(start, w); err != nil {
+			s.logger.Warn("Failed to write "+s.cfg.Part,
+				zap.Time("window", w.start),
+				zap.Error(err),
+			)
+		}
+	}
+
+	cutoff := now.Add(-s.cfg.Retention)
+	for name, p := range s.parts {
+		if !p.MaxTime().Before(cutoff) {
+			continue
+		}
+		if err := os.RemoveAll(filepath.Join(s.cfg.Directory, s.partsDir, name)); err != nil {
+			s.logger.Warn("Failed to delete expired "+s.cfg.Part, zap.String(s.cfg.Part, name), zap.Error(err))
+			continue
+		}
+		delete(s.parts, name)
+		s.logger.Debug("Deleted expired "+s.cfg.Part, zap.String(s.cfg.Part, name))
+	}
+}
+
+// cut writes a window to a part and removes its log. Must be called with
+// mu held.
+func (s *Store[R, H, P]) cut(start int64, w *window[H]) error {
+	if n := w.head.Len(); n > 0 {
+		// Late records can produce several parts for the same window
+		name := fmt.Sprintf("%d-%d", start, time.Now().UnixNano())
+		p, err := s.format.WritePart(filepath.Join(s.cfg.Directory, s.partsDir, name), w.head)
+		if err != nil {
+			return err
+		}
+		s.parts[name] = p
+
+		s.logger.Debug("Written "+s.cfg.Part,
+			zap.String(s.cfg.Part, name),
+			zap.Int("records", n),
+		)
+	}
+
+	w.file.Close()
+	if err := os.Remove(w.path); err != nil {
+		s.logger.Warn("Failed to remove log", zap.String("path", w.path), zap.Error(err))
+	}
+	delete(s.windows, start)
+	return nil
+}
+
+// Close stops background maintenance and closes the logs of open windows,
+// which are recovered when the store is next opened
+func (s *Store[R, H, P]) Close() error {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return nil
+	}
+	s.closed = true
+	s.mu.Unlock()
+
+	if s.stop != nil {
+		close(s.stop)
+		<-s.done
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.closeWindows()
+}
+
+func (s *Store[R, H, P]) closeWindows() error {
+	var errs []error
+	for _, w := range s.windows {
+		if w.file == nil {
+			continue
+		}
+		if err := w.file.Sync(); err != nil {
+			errs = append(errs, err)
+		}
+		if err := w.file.Close(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Ping checks that the store's directory is accessible
+func (s *Store[R, H, P]) Ping() error {
+	_, err := os.Stat(filepath.Join(s.cfg.Directory, s.partsDir))
+	return err
+}
+
+// View calls fn with the heads of the open windows, ordered by start, and
+// the parts, ordered by name. A read-only store first picks up the
+// writer's changes. fn must not keep the heads or parts past its return.
+//
+// A reader reads logs before parts, so a window cut in between is seen in
+// both a head and a part rather than missed; fn must drop the duplicates.
+func (s *Store[R, H, P]) View(fn func(heads []H, parts []P) error) error {
+	s.refresh()
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	starts := make([]int64, 0, len(s.windows))
+	for start := range s.windows {
+		starts = append(starts, start)
+	}
+	sort.Slice(starts, func(i, j int) bool { return starts[i] < starts[j] })
+	heads := make([]H, len(starts))
+	for i, start := range starts {
+		heads[i] = s.windows[start].head
+	}
+
+	names := make([]string, 0, len(s.parts))
+	for name := range s.parts {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	parts := make([]P, len(names))
+	for i, name := range names {
+		parts[i] = s.parts[name]
+	}
+
+	return fn(heads, parts)
+}
+
+// refresh picks up a read-only store's changes from the writer
+func (s *Store[R, H, P]) refresh() {
+	if !s.readOnly {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if time.Since(s.refreshed) < s.RefreshEvery {
+		return
+	}
+	s.refreshed = time.Now()
+
+	if err := s.syncWindows(); err != nil {
+		s.logger.Warn("Failed to read log", zap.Error(err))
+	}
+	if err := s.syncParts(); err != nil {
+		s.logger.Warn("Failed to read "+s.partsDir, zap.Error(err))
+	}
+}
+
+// syncWindows reads the entries the writer has logged since the last call.
+// Must be called with mu held.
+func (s *Store[R, H, P]) syncWindows() error {
+	entries, err := os.ReadDir(filepath.Join(s.cfg.Directory, walDir))
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+
+	seen := make(map[int64]bool)
+	for _, entry := range entries {
+		start, ok := parseWindow(entry.Name())
+		if !ok {
+			continue
+		}
+		path := filepath.Join(s.cfg.Directory, walDir, entry.Name())
+		info, err := os.Stat(path)
+		if err != nil {
+			continue
+		}
+		seen[start] = true
+
+		// A window cut and then reopened by late records has a new log
+		w := s.windows[start]
+		if w == nil || !os.SameFile(w.info, info) {
+			w = s.newWindow(start, path)
+			s.windows[start] = w
+		}
+		w.info = info
+
+		records, offset, err := readEntries[R](path, w.offset)
+		if errors.Is(err, errCorruptEntry) {
+			s.logger.Warn("Corrupt entry in log", zap.String("path", path), zap.Int64("offset", offset))
+		} else if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return err
+		}
+		w.head.Add(records)
+		w.offset = offset
+	}
+
+	for start := range s.windows {
+		if !seen[start] {
+			delete(s.windows, start)
+		}
+	}
+	return nil
+}
+
+// syncParts loads new parts and forgets deleted ones. Must be called with
+// mu held.
+func (s *Store[R, H, P]) syncParts() error {
+	entries, err := os.ReadDir(filepath.Join(s.cfg.Directory, s.partsDir))
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+
+	seen := make(map[string]bool)
+	for _, entry := range entries {
+		name := entry.Name()
+		if !entry.IsDir() || strings.HasSuffix(name, TmpExt) {
+			continue
+		}
+		seen[name] = true
+		if _, ok := s.parts[name]; ok {
+			continue
+		}
+
+		p, err := s.format.OpenPart(filepath.Join(s.cfg.Directory, s.partsDir, name))
+		if err != nil {
+			if !errors.Is(err, fs.ErrNotExist) {
+				s.logger.Warn("Skipping unreadable "+s.cfg.Part, zap.String(s.cfg.Part, name), zap.Error(err))
+			}
+			continue
+		}
+		s.parts[name] = p
+	}
+
+	for name := range s.parts {
+		if !seen[name] {
+			delete(s.parts, name)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,177 @@
+package windowstore
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// testHead holds a window's strings
+type testHead struct {
+	start   time.Time
+	records []string
+}
+
+func (h *testHead) Add(records []string) int {
+	h.records = append(h.records, records...)
+	return 0
+}
+
+func (h *testHead) Len() int {
+	return len(h.records)
+}
+
+// testPart is a window's strings written to a single file
+type testPart struct {
+	maxTime time.Time
+	records []string
+}
+
+func (p *testPart) MaxTime() time.Time {
+	return p.maxTime
+}
+
+var testFormat = Format[string, *testHead, *testPart]{
+	NewHead: func(start time.Time) *testHead {
+		return &testHead{start: start}
+	},
+	WritePart: func(dir string, h *testHead) (*testPart, error) {
+		p := &testPart{maxTime: h.start.Add(time.Hour), records: h.records}
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			return nil, err
+		}
+		data, _ := json.Marshal(p.records)
+		return p, os.WriteFile(filepath.Join(dir, "records"), data, 0o644)
+	},
+	OpenPart: func(dir string) (*testPart, error) {
+		data, err := os.ReadFile(filepath.Join(dir, "records"))
+		if err != nil {
+			return nil, err
+		}
+		p := &testPart{maxTime: time.Now()}
+		return p, json.Unmarshal(data, &p.records)
+	},
+}
+
+func testConfig(dir string) Config {
+	return Config{
+		Name:      "test store",
+		Part:      "part",
+		Directory: dir,
+		Window:    time.Hour,
+		Grace:     time.Minute,
+		Retention: 24 * time.Hour,
+		Sync:      true,
+	}
+}
+
+func openTestStore(t *testing.T, dir string) *Store[string, *testHead, *testPart] {
+	t.Helper()
+	s, err := Open(testConfig(dir), testFormat, zap.NewNop())
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	t.Cleanup(func() { s.Close() })
+	return s
+}
+
+// contents returns the records of the open windows and the parts
+func contents(s *Store[string, *testHead, *testPart]) (heads, parts []string) {
+	s.View(func(hs []*testHead, ps []*testPart) error {
+		for _, h := range hs {
+			heads = append(heads, h.records...)
+		}
+		for _, p := range ps {
+			parts = append(parts, p.records...)
+		}
+		return nil
+	})
+	return heads, parts
+}
+
+func TestStoreRecovery(t *testing.T) {
+	dir := t.TempDir()
+	s := openTestStore(t, dir)
+	start := time.Now().Truncate(time.Hour).Unix()
+	if err := s.Write(map[int64][]string{start: {"first"}}); err != nil {
+		t.Fatalf("Write failed: %v", err)
+	}
+	if err := s.Write(map[int64][]string{start: {"second"}}); err != nil {
+		t.Fatalf("Write failed: %v", err)
+	}
+	s.Close()
+
+	if err := s.Write(map[int64][]string{start: {"closed"}}); err == nil {
+		t.Error("Expected writes to a closed store to fail")
+	}
+
+	// Tear the last entry, as a crash mid-write would
+	logs, _ := filepath.Glob(filepath.Join(dir, walDir, "*"+walExt))
+	if len(logs) != 1 {
+		t.Fatalf("Expected one log, got %v", logs)
+	}
+	info, _ := os.Stat(logs[0])
+	if err := os.Truncate(logs[0], info.Size()-3); err != nil {
+		t.Fatal(err)
+	}
+
+	s = openTestStore(t, dir)
+	if heads, _ := contents(s); len(heads) != 1 || heads[0] != "first" {
+		t.Fatalf("Expected the intact entry to be recovered, got %q", heads)
+	}
+	if err := s.Write(map[int64][]string{start: {"third"}}); err != nil {
+		t.Fatalf("Write failed: %v", err)
+	}
+	s.Close()
+
+	s = openTestStore(t, dir)
+	if heads, _ := contents(s); len(heads) != 2 || heads[1] != "third" {
+		t.Errorf("Expected entries after the truncation to be readable, got %q", heads)
+	}
+}
+
+func TestStoreMaintain(t *testing.T) {
+	dir := t.TempDir()
+	s := openTestStore(t, dir)
+	now := time.Now()
+	old := now.Add(-3 * time.Hour).Truncate(time.Hour).Unix()
+	current := now.Truncate(time.Hour).Unix()
+	if err := s.Write(map[int64][]string{old: {"old"}, current: {"current"}}); err != nil {
+		t.Fatalf("Write failed: %v", err)
+	}
+
+	r, err := OpenReader(testConfig(dir), testFormat, zap.NewNop())
+	if err != nil {
+		t.Fatalf("OpenReader failed: %v", err)
+	}
+	r.RefreshEvery = 0
+	if heads, _ := contents(r); len(heads) != 2 {
+		t.Fatalf("Expected the reader to see logged records, got %q", heads)
+	}
+
+	// Only the window that has ended is cut
+	s.Maintain(now)
+	heads, parts := contents(s)
+	if len(heads) != 1 || heads[0] != "current" || len(parts) != 1 || parts[0] != "old" {
+		t.Fatalf("Expected the old window to be cut, got heads %q and parts %q", heads, parts)
+	}
+	if logs, _ := filepath.Glob(filepath.Join(dir, walDir, "*"+walExt)); len(logs) != 1 {
+		t.Errorf("Expected the old window's log to be removed, got %v", logs)
+	}
+	if heads, parts := contents(r); len(heads) != 1 || len(parts) != 1 {
+		t.Errorf("Expected the reader to see the part and the open window, got heads %q and parts %q", heads, parts)
+	}
+
+	// Past the retention period parts are deleted
+	s.Maintain(now.Add(48 * time.Hour))
+	if _, parts := contents(s); len(parts) != 0 {
+		t.Errorf("Expected expired parts to be deleted, got %q", parts)
+	}
+	if _, parts := contents(r); len(parts) != 0 {
+		t.Errorf("Expected the reader to forget deleted parts, got %q", parts)
+	}
+}
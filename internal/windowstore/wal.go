@@ -0,0 +1,91 @@
+package windowstore
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+)
+
+// Each open window is logged to its own file, so a store survives restarts
+// and readers in other processes can see recent records. Each write is one
+// entry in the log: a little-endian uint32 length, a CRC32-C of the
+// payload, and the payload itself, a JSON array of records.
+
+const entryHeaderSize = 8
+
+var (
+	crcTable = crc32.MakeTable(crc32.Castagnoli)
+
+	errCorruptEntry = errors.New("corrupt log entry")
+)
+
+// appendEntry writes records as one entry with a single write, so a
+// concurrent reader sees either nothing or a whole header. With sync the
+// entry is flushed to disk before appendEntry returns.
+func appendEntry[R any](f *os.File, records []R, sync bool) error {
+	payload, err := json.Marshal(records)
+	if err != nil {
+		return fmt.Errorf("failed to encode records: %w", err)
+	}
+
+	entry := make([]byte, entryHeaderSize+len(payload))
+	binary.LittleEndian.PutUint32(entry[0:4], uint32(len(payload)))
+	binary.LittleEndian.PutUint32(entry[4:8], crc32.Checksum(payload, crcTable))
+	copy(entry[entryHeaderSize:], payload)
+
+	if _, err := f.Write(entry); err != nil {
+		return fmt.Errorf("failed to write records: %w", err)
+	}
+	if sync {
+		if err := f.Sync(); err != nil {
+			return fmt.Errorf("failed to sync records: %w", err)
+		}
+	}
+	return nil
+}
+
+// readEntries reads the whole entries from offset onwards and returns their
+// records and the offset after the last one. An entry still being written
+// ends the read without an error; a corrupt entry returns errCorruptEntry
+// along with everything before it.
+func readEntries[R any](path string, offset int64) ([]R, int64, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, offset, err
+	}
+	defer f.Close()
+
+	if _, err := f.Seek(offset, io.SeekStart); err != nil {
+		return nil, offset, err
+	}
+	data, err := io.ReadAll(f)
+	if err != nil {
+		return nil, offset, err
+	}
+
+	var records []R
+	for len(data) >= entryHeaderSize {
+		length := int(binary.LittleEndian.Uint32(data[0:4]))
+		if len(data) < entryHeaderSize+length {
+			break
+		}
+		payload := data[entryHeaderSize : entryHeaderSize+length]
+		if crc32.Checksum(payload, crcTable) != binary.LittleEndian.Uint32(data[4:8]) {
+			return records, offset, errCorruptEntry
+		}
+
+		var batch []R
+		if err := json.Unmarshal(payload, &batch); err != nil {
+			return records, offset, errCorruptEntry
+		}
+		records = append(records, batch...)
+
+		data = data[entryHeaderSize+length:]
+		offset += int64(entryHeaderSize + length)
+	}
+	return records, offset, nil
+}
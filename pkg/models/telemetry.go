@@ -48,6 +48,21 @@ type Metric struct {
 	Timestamp   time.Time         `json:"timestamp"`
 	Attributes  map[string]string `json:"attributes"`
 	ServiceName string            `json:"service_name"`
+	Histogram   *HistogramData    `json:"histogram,omitempty"`
+	Temporality string            `json:"temporality,omitempty"` // delta, or empty for cumulative
+}
+
+// TemporalityDelta marks a point holding the change since the previous
+// point of its series rather than a running total
+const TemporalityDelta = "delta"
+
+// HistogramData holds the bucket distribution of a histogram data point.
+// Buckets has one more entry than Bounds; the last bucket is +Inf.
+type HistogramData struct {
+	Count   uint64    `json:"count"`
+	Sum     float64   `json:"sum"`
+	Bounds  []float64 `json:"bounds"`
+	Buckets []uint64  `json:"buckets"`
 }
 
 // ExceptionRecord represents an exception/error